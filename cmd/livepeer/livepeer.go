@@ -84,6 +84,8 @@ func main() {
 	// Network & Addresses:
 	network := flag.String("network", "offchain", "Network to connect to")
 	rtmpAddr := flag.String("rtmpAddr", "127.0.0.1:"+RtmpPort, "Address to bind for RTMP commands")
+	srtAddr := flag.String("srtAddr", "", "Address to bind for SRT ingest. SRT ingest is disabled if not set")
+	srtPassphrase := flag.String("srtPassphrase", "", "Passphrase SRT callers must encrypt their stream with, 10 to 79 characters long")
 	cliAddr := flag.String("cliAddr", "127.0.0.1:"+CliPort, "Address to bind for  CLI commands")
 	httpAddr := flag.String("httpAddr", "", "Address to bind for HTTP commands")
 	serviceAddr := flag.String("serviceAddr", "", "Orchestrator only. Overrides the on-chain serviceURI that broadcasters can use to contact this node; may be an IP or hostname.")
@@ -91,17 +93,29 @@ func main() {
 	verifierURL := flag.String("verifierUrl", "", "URL of the verifier to use")
 
 	verifierPath := flag.String("verifierPath", "", "Path to verifier shared volume")
+	verificationRedundancy := flag.Int("verificationRedundancy", 1, "Number of orchestrators to send each segment to in parallel")
+	verificationSampleRate := flag.Float64("verificationSampleRate", 1.0, "Fraction of segments to verify, between 0 and 1")
+	orchBanDuration := flag.Duration("orchBanDuration", time.Hour, "How long to stop using an orchestrator after it fails verification. Set to 0 to disable")
 
 	// Transcoding:
 	orchestrator := flag.Bool("orchestrator", false, "Set to true to be an orchestrator")
 	transcoder := flag.Bool("transcoder", false, "Set to true to be a transcoder")
 	broadcaster := flag.Bool("broadcaster", false, "Set to true to be a broadcaster")
-	orchSecret := flag.String("orchSecret", "", "Shared secret with the orchestrator as a standalone transcoder")
+	orchSecret := flag.String("orchSecret", "", "Shared secret with the orchestrator as a standalone transcoder, or a token issued to the transcoder by the orchestrator")
+	localFallback := flag.Bool("localFallback", false, "Hand segments to standalone transcoders, transcoding locally only when none of them can. Requires -orchestrator and -transcoder")
 	transcodingOptions := flag.String("transcodingOptions", "P240p30fps16x9,P360p30fps16x9", "Transcoding options for broadcast job")
 	maxAttempts := flag.Int("maxAttempts", 3, "Maximum transcode attempts")
+	segmentDeadlineFactor := flag.Float64("segmentDeadlineFactor", server.SegmentDeadlineFactor, "Stop retrying a segment on other orchestrators once this multiple of its duration has passed. Set to 0 to retry until -maxAttempts is reached")
+	maxPushSize := flag.Int64("maxPushSize", server.MaxPushBodySize, "Maximum size in bytes of a segment pushed over HTTP ingest. Set to 0 for no limit")
+	lowLatencyHLS := flag.Bool("llhls", false, "Serve low-latency HLS (LL-HLS) media playlists, with each transcoded segment as a partial segment")
+	sourceVariant := flag.Bool("sourceVariant", server.SourceVariant, "List the untouched source as a variant in the HLS master playlist, so streams stay playable without transcoding")
+	llhlsSegDuration := flag.Float64("llhlsSegmentDuration", core.LLHLSSegmentDuration, "Target duration in seconds of the full LL-HLS segments assembled from partial segments")
 	maxSessions := flag.Int("maxSessions", 10, "Maximum number of concurrent transcoding sessions for Orchestrator, maximum number or RTMP streams for Broadcaster, or maximum capacity for transcoder")
 	currentManifest := flag.Bool("currentManifest", false, "Expose the currently active ManifestID as \"/stream/current.m3u8\"")
 	nvidia := flag.String("nvidia", "", "Comma-separated list of Nvidia GPU device IDs to use for transcoding")
+	transcoderCodecs := flag.String("transcoderCodecs", "h264", "Comma-separated list of video codecs the transcoder can encode, out of h264, h265 and vp9")
+	maxResolution := flag.String("maxResolution", "", "Largest rendition resolution the transcoder accepts, eg. 1920x1080. Unlimited if not set")
+	maxPixelRate := flag.Int64("maxPixelRate", 0, "Rendition pixels per second the transcoder can encode in real time. New streams are refused once their load would exceed it. 0 disables the check")
 
 	// Onchain:
 	ethAcctAddr := flag.String("ethAcctAddr", "", "Existing Eth account address")
@@ -123,6 +137,9 @@ func main() {
 	maxPricePerUnit := flag.Int("maxPricePerUnit", 0, "The maximum transcoding price (in wei) per 'pixelsPerUnit' a broadcaster is willing to accept. If not set explicitly, broadcaster is willing to accept ANY price")
 	// Unit of pixels for both O's basePriceInfo and B's MaxBroadcastPrice
 	pixelsPerUnit := flag.Int("pixelsPerUnit", 1, "Amount of pixels per unit. Set to '> 1' to have smaller price granularity than 1 wei / pixel")
+	// Broadcaster orchestrator selection
+	selectionStrategy := flag.String("selectionStrategy", server.SelectionMinLS, "Orchestrator selection strategy. One of 'minls' (lowest latency score) or 'weighted' (price, success rate, latency and stake)")
+	selectionWeights := flag.String("selectionWeights", "", "Weights for the 'weighted' selection strategy, e.g. price=2,success=1,latency=1,stake=0")
 	// Interval to poll for blocks
 	blockPollingInterval := flag.Int("blockPollingInterval", 5, "Interval in seconds at which different blockchain event services poll for blocks")
 	// Metrics & logging:
@@ -134,11 +151,20 @@ func main() {
 	datadir := flag.String("datadir", "", "data directory")
 	s3bucket := flag.String("s3bucket", "", "S3 region/bucket (e.g. eu-central-1/testbucket)")
 	s3creds := flag.String("s3creds", "", "S3 credentials (in form ACCESSKEYID/ACCESSKEY)")
+	s3endpoint := flag.String("s3endpoint", "", "Base URL of an S3-compatible service such as MinIO, Ceph or R2 (e.g. http://minio:9000); defaults to AWS S3")
+	s3pathStyle := flag.Bool("s3pathStyle", false, "Address the S3 bucket as a path of the endpoint rather than as a subdomain")
+	s3presignedPut := flag.Bool("s3presignedPut", false, "Give orchestrators presigned PUT URLs for S3 uploads instead of a POST policy")
 	gsBucket := flag.String("gsbucket", "", "Google storage bucket")
 	gsKey := flag.String("gskey", "", "Google Storage private key file name (in json format)")
+	recordStore := flag.String("recordStore", "", "Object store to record streams into for VOD playback, e.g. s3://ACCESSKEYID:ACCESSKEY@region/bucket, gs://bucket?keyfile=key.json or file:///path/to/dir?prefix=/recordings/")
+	localStorage := flag.String("localStorage", "", "Directory to keep segments in on disk instead of in memory, when no cloud storage is used")
+	localStorageMaxAge := flag.Duration("localStorageMaxAge", 0, "Remove segments in -localStorage older than this; 0 to keep them")
+	localStorageMaxSize := flag.Int64("localStorageMaxSize", 0, "Remove the oldest segments once -localStorage holds more than this many bytes; 0 for no limit")
 
 	// API
 	authWebhookURL := flag.String("authWebhookUrl", "", "RTMP authentication webhook URL")
+	eventWebhookURL := flag.String("eventWebhookUrl", "", "URL to send stream lifecycle events to")
+	eventWebhookSecret := flag.String("eventWebhookSecret", "", "Secret to sign stream lifecycle events with")
 	orchWebhookURL := flag.String("orchWebhookUrl", "", "Orchestrator discovery callback URL")
 
 	flag.Parse()
@@ -248,6 +274,28 @@ func main() {
 		} else {
 			n.Transcoder = core.NewLocalTranscoder(*datadir)
 		}
+
+		codecs, err := core.ParseVideoCodecs(*transcoderCodecs)
+		if err != nil {
+			glog.Fatalf("Invalid -transcoderCodecs %v: %v", *transcoderCodecs, err)
+		}
+		var maxPixels int64
+		if *maxResolution != "" {
+			var w, h int64
+			if _, err := fmt.Sscanf(*maxResolution, "%dx%d", &w, &h); err != nil || w <= 0 || h <= 0 {
+				glog.Fatalf("Invalid -maxResolution %v; must be of the form WIDTHxHEIGHT", *maxResolution)
+			}
+			maxPixels = w * h
+		}
+		if *maxPixelRate < 0 {
+			glog.Fatalf("Invalid -maxPixelRate %v", *maxPixelRate)
+		}
+		caps := core.NewCapabilities(codecs, *nvidia != "", maxPixels)
+		if len(caps.Codecs) < len(codecs) {
+			glog.Warningf("Not advertising -transcoderCodecs %v without a GPU encoder", *transcoderCodecs)
+		}
+		caps.PixelRate = *maxPixelRate
+		n.SetCapabilities(caps)
 	}
 
 	if *orchestrator {
@@ -255,6 +303,10 @@ func main() {
 		if !*transcoder {
 			n.TranscoderManager = core.NewRemoteTranscoderManager()
 			n.Transcoder = n.TranscoderManager
+		} else if *localFallback {
+			n.TranscoderManager = core.NewRemoteTranscoderManager()
+			n.TranscoderManager.SetLocalFallback(n.Transcoder)
+			n.Transcoder = n.TranscoderManager
 		}
 	} else if *transcoder {
 		n.NodeType = core.TranscoderNode
@@ -608,6 +660,13 @@ func main() {
 	if *s3bucket != "" {
 		s3bp := strings.Split(*s3bucket, "/")
 		drivers.S3BUCKET = s3bp[1]
+		if *s3endpoint != "" || *s3pathStyle {
+			drivers.S3HOST, err = drivers.S3BucketURL(*s3endpoint, s3bp[1], *s3pathStyle)
+			if err != nil {
+				glog.Error("Invalid S3 endpoint: ", err)
+				return
+			}
+		}
 	}
 	if *gsBucket != "" && *gsKey == "" || *gsBucket == "" && *gsKey != "" {
 		glog.Error("Should specify both gsbucket and gskey")
@@ -618,7 +677,19 @@ func main() {
 	if *s3bucket != "" && *s3creds != "" {
 		br := strings.Split(*s3bucket, "/")
 		cr := strings.Split(*s3creds, "/")
-		drivers.NodeStorage = drivers.NewS3Driver(br[0], br[1], cr[0], cr[1])
+		drivers.NodeStorage, err = drivers.NewS3DriverWithConfig(drivers.S3Config{
+			Endpoint:        *s3endpoint,
+			Region:          br[0],
+			Bucket:          br[1],
+			PathStyle:       *s3pathStyle,
+			AccessKey:       cr[0],
+			AccessKeySecret: cr[1],
+			PresignedPut:    *s3presignedPut,
+		})
+		if err != nil {
+			glog.Error("Error creating S3 driver: ", err)
+			return
+		}
 	}
 
 	if *gsBucket != "" && *gsKey != "" {
@@ -640,9 +711,19 @@ func main() {
 		// TODO provide an option to disable this?
 		*rtmpAddr = defaultAddr(*rtmpAddr, "127.0.0.1", RtmpPort)
 		*httpAddr = defaultAddr(*httpAddr, "127.0.0.1", RpcPort)
+		server.SRTAddr = *srtAddr
+		server.SRTPassphrase = *srtPassphrase
 
 		bcast := core.NewBroadcaster(n)
 
+		// Orchestrator allow/deny list, managed through the CLI
+		server.OrchAccess, err = server.NewOrchAccessList(n.Database)
+		if err != nil {
+			glog.Errorf("Error loading orchestrator access list: %v", err)
+			return
+		}
+		server.OrchBanDuration = *orchBanDuration
+
 		// When the node is on-chain mode always cache the on-chain orchestrators and poll for updates
 		// Right now we rely on the DBOrchestratorPoolCache constructor to do this. Consider separating the logic
 		// caching/polling from the logic for fetching orchestrators during discovery
@@ -681,6 +762,14 @@ func main() {
 			glog.Info("Using auth webhook URL ", *authWebhookURL)
 			server.AuthWebhookURL = *authWebhookURL
 		}
+		if *eventWebhookURL != "" {
+			_, err := validateURL(*eventWebhookURL)
+			if err != nil {
+				glog.Fatal("Error setting event webhook URL ", err)
+			}
+			glog.Info("Using event webhook URL ", *eventWebhookURL)
+			server.Events = server.NewEventWebhook(*eventWebhookURL, *eventWebhookSecret)
+		}
 
 		// Set up verifier
 		if *verifierURL != "" {
@@ -702,9 +791,44 @@ func main() {
 		} else if *network != "offchain" {
 			server.Policy = &verification.Policy{Retries: 2}
 		}
+		if server.Policy == nil && *verificationRedundancy > 1 {
+			server.Policy = &verification.Policy{Retries: 2}
+		}
+		if server.Policy != nil {
+			server.Policy.Redundancy = *verificationRedundancy
+			server.Policy.SampleRate = verification.SampleRate(*verificationSampleRate)
+		}
 
 		// Set max transcode attempts. <=0 is OK; it just means "don't transcode"
 		server.MaxAttempts = *maxAttempts
+		server.SegmentDeadlineFactor = *segmentDeadlineFactor
+
+		var weights *server.SelectionWeights
+		if *selectionWeights != "" {
+			w, err := server.ParseSelectionWeights(*selectionWeights)
+			if err != nil {
+				glog.Errorf("Error parsing -selectionWeights: %v", err)
+				return
+			}
+			weights = &w
+		}
+		if err := server.BroadcastCfg.SetSelectionStrategy(*selectionStrategy, weights); err != nil {
+			glog.Errorf("Error setting orchestrator selection strategy: %v", err)
+			return
+		}
+
+		server.MaxPushBodySize = *maxPushSize
+		server.LowLatencyHLS = *lowLatencyHLS
+		server.SourceVariant = *sourceVariant
+		core.LLHLSSegmentDuration = *llhlsSegDuration
+
+		if *recordStore != "" {
+			server.RecordStorage, err = drivers.ParseOSURL(*recordStore)
+			if err != nil {
+				glog.Errorf("Error creating record store: %v", err)
+				return
+			}
+		}
 
 	} else if n.NodeType == core.OrchestratorNode {
 		suri, err := getServiceURI(n, *serviceAddr)
@@ -716,12 +840,30 @@ func main() {
 		// take the port to listen to from the service URI
 		*httpAddr = defaultAddr(*httpAddr, "", n.GetServiceURI().Port())
 
-		if !*transcoder && n.OrchSecret == "" {
-			glog.Fatal("Running an orchestrator requires an -orchSecret for standalone mode or -transcoder for orchestrator+transcoder mode")
+		if n.TranscoderManager != nil {
+			// Per-transcoder tokens, managed through the CLI
+			n.TranscoderTokens, err = core.NewTranscoderTokens(n.Database)
+			if err != nil {
+				glog.Errorf("Error loading transcoder tokens: %v", err)
+				return
+			}
+			if n.OrchSecret == "" && len(n.TranscoderTokens.List()) == 0 {
+				glog.Warning("No -orchSecret or transcoder tokens; standalone transcoders can't register until a token is issued through the CLI")
+			}
 		}
 	}
 	*cliAddr = defaultAddr(*cliAddr, "127.0.0.1", CliPort)
 
+	if drivers.NodeStorage == nil && *localStorage != "" {
+		// base URI will be empty for broadcasters; that's OK
+		retention := drivers.FSRetention{MaxAge: *localStorageMaxAge, MaxSize: *localStorageMaxSize}
+		drivers.NodeStorage, err = drivers.NewFSDriver(*localStorage, n.GetServiceURI(), drivers.FSDefaultPrefix, retention)
+		if err != nil {
+			glog.Errorf("Error creating local storage: %v", err)
+			return
+		}
+	}
+
 	if drivers.NodeStorage == nil {
 		// base URI will be empty for broadcasters; that's OK
 		drivers.NodeStorage = drivers.NewMemoryDriver(n.GetServiceURI())
@@ -784,6 +926,9 @@ func main() {
 	case core.BroadcasterNode:
 		glog.Infof("***Livepeer Running in Broadcaster Mode***")
 		glog.Infof("Video Ingest Endpoint - rtmp://%v", *rtmpAddr)
+		if *srtAddr != "" {
+			glog.Infof("Video Ingest Endpoint - srt://%v", *srtAddr)
+		}
 	case core.TranscoderNode:
 		glog.Infof("**Liveepeer Running in Transcoder Mode***")
 	}
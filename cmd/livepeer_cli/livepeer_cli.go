@@ -96,11 +96,20 @@ func (w *wizard) initializeOptions() []wizardOpt {
 		{desc: "Invoke \"reward\"", invoke: w.callReward, orchestrator: true},
 		{desc: "Invoke multi-step \"become an orchestrator\"", invoke: w.activateOrchestrator, orchestrator: true},
 		{desc: "Set orchestrator config", invoke: w.setOrchestratorConfig, orchestrator: true},
+		{desc: "List remote transcoders", invoke: w.remoteTranscoderStats, orchestrator: true},
+		{desc: "Drain a remote transcoder", invoke: w.drainRemoteTranscoder, orchestrator: true},
+		{desc: "List transcoder tokens", invoke: w.transcoderTokenStats, orchestrator: true},
+		{desc: "Issue a transcoder token", invoke: w.issueTranscoderToken, orchestrator: true},
+		{desc: "Revoke a transcoder token", invoke: w.revokeTranscoderToken, orchestrator: true},
 		{desc: "Invoke \"deposit broadcasting funds\" (ETH)", invoke: w.deposit, notOrchestrator: true},
 		{desc: "Invoke \"unlock broadcasting funds\"", invoke: w.unlock, notOrchestrator: true},
 		{desc: "Invoke \"cancel unlock of broadcasting funds\"", invoke: w.cancelUnlock, notOrchestrator: true},
 		{desc: "Invoke \"withdraw broadcasting funds\"", invoke: w.withdraw, notOrchestrator: true},
 		{desc: "Set broadcast config", invoke: w.setBroadcastConfig, notOrchestrator: true},
+		{desc: "View orchestrator access list", invoke: w.orchAccessListStats, notOrchestrator: true},
+		{desc: "Allow an orchestrator", invoke: w.allowOrchestrator, notOrchestrator: true},
+		{desc: "Deny an orchestrator", invoke: w.denyOrchestrator, notOrchestrator: true},
+		{desc: "Remove an orchestrator from the access list", invoke: w.removeOrchestratorAccess, notOrchestrator: true},
 		{desc: "Set Eth gas price", invoke: w.setGasPrice},
 		{desc: "Get test LPT", invoke: w.requestTokens, testnet: true},
 		{desc: "Get test ETH", invoke: func() {
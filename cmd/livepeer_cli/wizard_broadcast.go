@@ -82,6 +82,17 @@ func (w *wizard) setBroadcastConfig() {
 		"transcodingOptions": {fmt.Sprintf("%v", transOpts)},
 	}
 
+	fmt.Printf("Enter the orchestrator selection strategy, 'minls' or 'weighted' (default: unchanged) - ")
+	if strategy := w.readDefaultString(""); strategy != "" {
+		val.Set("selectionStrategy", strategy)
+		if strategy == "weighted" {
+			fmt.Printf("Enter the selection weights, eg. price=2,success=1,latency=1,stake=0 (default: unchanged) - ")
+			if weights := w.readDefaultString(""); weights != "" {
+				val.Set("selectionWeights", weights)
+			}
+		}
+	}
+
 	httpPostWithParams(fmt.Sprintf("http://%v:%v/setBroadcastConfig", w.host, w.httpPort), val)
 }
 
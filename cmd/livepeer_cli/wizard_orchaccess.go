@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/golang/glog"
+	lpcommon "github.com/livepeer/go-livepeer/common"
+	"github.com/olekukonko/tablewriter"
+)
+
+func (w *wizard) orchAccessListStats() {
+	entries, err := w.getOrchAccessList()
+	if err != nil {
+		glog.Errorf("Error getting orchestrator access list: %v", err)
+		return
+	}
+
+	fmt.Println("+-------------------------+")
+	fmt.Println("|ORCHESTRATOR ACCESS LIST |")
+	fmt.Println("+-------------------------+")
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Orchestrator", "Policy", "Expires", "Reason"})
+	for _, e := range entries {
+		expires := "Never"
+		if e.ExpiresAt > 0 {
+			expires = time.Unix(e.ExpiresAt, 0).Format(time.RFC1123)
+		}
+		table.Append([]string{e.Orchestrator, e.Policy, expires, e.Reason})
+	}
+	table.Render()
+}
+
+func (w *wizard) getOrchAccessList() ([]*lpcommon.DBOrchAccess, error) {
+	resp, err := http.Get(fmt.Sprintf("http://%v:%v/orchestratorAccessList", w.host, w.httpPort))
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	result, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s", result)
+	}
+
+	var entries []*lpcommon.DBOrchAccess
+	if err := json.Unmarshal(result, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (w *wizard) allowOrchestrator() {
+	fmt.Printf("Enter the ETH address or service URI of the orchestrator to allow - ")
+	orch := w.readString()
+	fmt.Printf("Enter a reason (optional) - ")
+	reason := w.readDefaultString("")
+
+	val := url.Values{
+		"orchestrator": {orch},
+		"reason":       {reason},
+	}
+	fmt.Println(httpPostWithParams(fmt.Sprintf("http://%v:%v/allowOrchestrator", w.host, w.httpPort), val))
+}
+
+func (w *wizard) denyOrchestrator() {
+	fmt.Printf("Enter the ETH address or service URI of the orchestrator to deny - ")
+	orch := w.readString()
+	fmt.Printf("Enter how long to deny the orchestrator for, eg. 1h30m (default: indefinitely) - ")
+	duration := w.readStringAndValidate(func(in string) (string, error) {
+		if in == "" {
+			return in, nil
+		}
+		if d, err := time.ParseDuration(in); err != nil || d <= 0 {
+			return "", fmt.Errorf("invalid duration")
+		}
+		return in, nil
+	})
+	fmt.Printf("Enter a reason (optional) - ")
+	reason := w.readDefaultString("")
+
+	val := url.Values{
+		"orchestrator": {orch},
+		"duration":     {duration},
+		"reason":       {reason},
+	}
+	fmt.Println(httpPostWithParams(fmt.Sprintf("http://%v:%v/denyOrchestrator", w.host, w.httpPort), val))
+}
+
+func (w *wizard) removeOrchestratorAccess() {
+	w.orchAccessListStats()
+	fmt.Printf("Enter the ETH address or service URI of the orchestrator to remove from the access list - ")
+	orch := w.readString()
+
+	val := url.Values{
+		"orchestrator": {orch},
+	}
+	fmt.Println(httpPostWithParams(fmt.Sprintf("http://%v:%v/removeOrchestratorAccess", w.host, w.httpPort), val))
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/net"
+	"github.com/olekukonko/tablewriter"
+)
+
+func (w *wizard) remoteTranscoderStats() {
+	transcoders, err := w.getRemoteTranscoders()
+	if err != nil {
+		glog.Errorf("Error getting remote transcoders: %v", err)
+		return
+	}
+
+	fmt.Println("+-------------------+")
+	fmt.Println("|REMOTE TRANSCODERS |")
+	fmt.Println("+-------------------+")
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Address", "Name", "Load", "Capacity", "Errors", "Error Score", "Last Seen", "Draining"})
+	for _, t := range transcoders {
+		table.Append([]string{
+			t.Address,
+			t.Name,
+			strconv.Itoa(t.Load),
+			strconv.Itoa(t.Capacity),
+			strconv.Itoa(t.Errors),
+			strconv.FormatFloat(t.ErrorScore, 'f', 2, 64),
+			t.LastSeen.Format(time.RFC1123),
+			strconv.FormatBool(t.Draining),
+		})
+	}
+	table.Render()
+}
+
+func (w *wizard) getRemoteTranscoders() ([]net.RemoteTranscoderState, error) {
+	resp, err := http.Get(fmt.Sprintf("http://%v:%v/registeredTranscoders", w.host, w.httpPort))
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	result, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s", result)
+	}
+
+	var transcoders []net.RemoteTranscoderState
+	if err := json.Unmarshal(result, &transcoders); err != nil {
+		return nil, err
+	}
+	return transcoders, nil
+}
+
+func (w *wizard) drainRemoteTranscoder() {
+	w.remoteTranscoderStats()
+	fmt.Printf("Enter the address of the transcoder to drain - ")
+	addr := w.readString()
+
+	val := url.Values{
+		"address": {addr},
+	}
+	fmt.Println(httpPostWithParams(fmt.Sprintf("http://%v:%v/drainTranscoder", w.host, w.httpPort), val))
+}
+
+func (w *wizard) transcoderTokenStats() {
+	tokens, err := w.getTranscoderTokens()
+	if err != nil {
+		glog.Errorf("Error getting transcoder tokens: %v", err)
+		return
+	}
+
+	fmt.Println("+------------------+")
+	fmt.Println("|TRANSCODER TOKENS |")
+	fmt.Println("+------------------+")
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Name", "Issued"})
+	for _, t := range tokens {
+		table.Append([]string{t.Name, time.Unix(t.CreatedAt, 0).Format(time.RFC1123)})
+	}
+	table.Render()
+}
+
+func (w *wizard) getTranscoderTokens() ([]common.DBTranscoderToken, error) {
+	resp, err := http.Get(fmt.Sprintf("http://%v:%v/transcoderTokens", w.host, w.httpPort))
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	result, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s", result)
+	}
+
+	var tokens []common.DBTranscoderToken
+	if err := json.Unmarshal(result, &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (w *wizard) issueTranscoderToken() {
+	fmt.Printf("Enter a name for the transcoder - ")
+	name := w.readString()
+
+	val := url.Values{
+		"name": {name},
+	}
+	fmt.Println(httpPostWithParams(fmt.Sprintf("http://%v:%v/issueTranscoderToken", w.host, w.httpPort), val))
+	fmt.Println("Start the transcoder with the token above as its -orchSecret; it can't be displayed again.")
+}
+
+func (w *wizard) revokeTranscoderToken() {
+	w.transcoderTokenStats()
+	fmt.Printf("Enter the name of the transcoder whose token to revoke - ")
+	name := w.readString()
+
+	val := url.Values{
+		"name": {name},
+	}
+	fmt.Println(httpPostWithParams(fmt.Sprintf("http://%v:%v/revokeTranscoderToken", w.host, w.httpPort), val))
+}
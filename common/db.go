@@ -37,6 +37,12 @@ type DB struct {
 	findLatestMiniHeader             *sql.Stmt
 	findAllMiniHeadersSortedByNumber *sql.Stmt
 	deleteMiniHeader                 *sql.Stmt
+	setOrchAccess                    *sql.Stmt
+	deleteOrchAccess                 *sql.Stmt
+	selectOrchAccess                 *sql.Stmt
+	setTranscoderToken               *sql.Stmt
+	deleteTranscoderToken            *sql.Stmt
+	selectTranscoderTokens           *sql.Stmt
 }
 
 // DBOrch is the type binding for a row result from the orchestrators table
@@ -57,6 +63,33 @@ type DBUnbondingLock struct {
 	WithdrawRound int64
 }
 
+// Policies of an orchestrator access list entry
+const (
+	OrchAccessAllow = "allow"
+	OrchAccessDeny  = "deny"
+)
+
+// DBOrchAccess is the type binding for a row result from the orchestratorAccess table
+type DBOrchAccess struct {
+	// Ethereum address or service URI of the orchestrator
+	Orchestrator string
+	// OrchAccessAllow or OrchAccessDeny
+	Policy string
+	Reason string
+	// Unix time after which the entry no longer applies; 0 if it never expires
+	ExpiresAt int64
+}
+
+// DBTranscoderToken is the type binding for a row result from the transcoderTokens table
+type DBTranscoderToken struct {
+	// Name identifying the standalone transcoder the token was issued to
+	Name string
+	// Hex encoded SHA-256 hash of the token; the token itself isn't kept
+	TokenHash string `json:"-"`
+	// Unix time the token was issued
+	CreatedAt int64
+}
+
 // DBOrchFilter is an object used to attach a filter to a selectOrch query
 type DBOrchFilter struct {
 	MaxPrice     *big.Rat
@@ -122,6 +155,21 @@ var schema = `
 	);
 
 	CREATE INDEX IF NOT EXISTS idx_blockheaders_number ON blockheaders(number);
+
+	CREATE TABLE IF NOT EXISTS orchestratorAccess (
+		orchestrator STRING NOT NULL,
+		policy STRING NOT NULL,
+		createdAt STRING DEFAULT CURRENT_TIMESTAMP NOT NULL,
+		reason STRING,
+		expiresAt int64 DEFAULT 0 NOT NULL,
+		PRIMARY KEY(orchestrator, policy)
+	);
+
+	CREATE TABLE IF NOT EXISTS transcoderTokens (
+		name STRING PRIMARY KEY,
+		tokenHash STRING NOT NULL,
+		createdAt int64 NOT NULL
+	);
 `
 
 func NewDBOrch(ethereumAddr string, serviceURI string, pricePerPixel int64, activationRound int64, deactivationRound int64, stake int64) *DBOrch {
@@ -313,6 +361,52 @@ func InitDB(dbPath string) (*DB, error) {
 	}
 	d.deleteMiniHeader = stmt
 
+	// Orchestrator access list prepared statements
+	stmt, err = db.Prepare("INSERT OR REPLACE INTO orchestratorAccess(orchestrator, policy, reason, expiresAt, createdAt) VALUES(?, ?, ?, ?, datetime())")
+	if err != nil {
+		glog.Error("Unable to prepare setOrchAccess ", err)
+		d.Close()
+		return nil, err
+	}
+	d.setOrchAccess = stmt
+	stmt, err = db.Prepare("DELETE FROM orchestratorAccess WHERE orchestrator=?")
+	if err != nil {
+		glog.Error("Unable to prepare deleteOrchAccess ", err)
+		d.Close()
+		return nil, err
+	}
+	d.deleteOrchAccess = stmt
+	stmt, err = db.Prepare("SELECT orchestrator, policy, reason, expiresAt FROM orchestratorAccess WHERE expiresAt = 0 OR expiresAt > ? ORDER BY orchestrator")
+	if err != nil {
+		glog.Error("Unable to prepare selectOrchAccess ", err)
+		d.Close()
+		return nil, err
+	}
+	d.selectOrchAccess = stmt
+
+	// Transcoder token prepared statements
+	stmt, err = db.Prepare("INSERT OR REPLACE INTO transcoderTokens(name, tokenHash, createdAt) VALUES(?, ?, ?)")
+	if err != nil {
+		glog.Error("Unable to prepare setTranscoderToken ", err)
+		d.Close()
+		return nil, err
+	}
+	d.setTranscoderToken = stmt
+	stmt, err = db.Prepare("DELETE FROM transcoderTokens WHERE name=?")
+	if err != nil {
+		glog.Error("Unable to prepare deleteTranscoderToken ", err)
+		d.Close()
+		return nil, err
+	}
+	d.deleteTranscoderToken = stmt
+	stmt, err = db.Prepare("SELECT name, tokenHash, createdAt FROM transcoderTokens ORDER BY name")
+	if err != nil {
+		glog.Error("Unable to prepare selectTranscoderTokens ", err)
+		d.Close()
+		return nil, err
+	}
+	d.selectTranscoderTokens = stmt
+
 	glog.V(DEBUG).Info("Initialized DB node")
 	return &d, nil
 }
@@ -358,6 +452,24 @@ func (db *DB) Close() {
 	if db.deleteMiniHeader != nil {
 		db.deleteMiniHeader.Close()
 	}
+	if db.setOrchAccess != nil {
+		db.setOrchAccess.Close()
+	}
+	if db.deleteOrchAccess != nil {
+		db.deleteOrchAccess.Close()
+	}
+	if db.selectOrchAccess != nil {
+		db.selectOrchAccess.Close()
+	}
+	if db.setTranscoderToken != nil {
+		db.setTranscoderToken.Close()
+	}
+	if db.deleteTranscoderToken != nil {
+		db.deleteTranscoderToken.Close()
+	}
+	if db.selectTranscoderTokens != nil {
+		db.selectTranscoderTokens.Close()
+	}
 	if db.dbh != nil {
 		db.dbh.Close()
 	}
@@ -820,3 +932,100 @@ func decodeLogsJSON(logsEnc []byte) ([]types.Log, error) {
 	}
 	return logs, nil
 }
+
+// SetOrchAccess adds an orchestrator access list entry, replacing any existing entry with the same orchestrator and policy
+func (db *DB) SetOrchAccess(entry *DBOrchAccess) error {
+	if entry == nil || entry.Orchestrator == "" {
+		return errors.New("must provide an orchestrator")
+	}
+	if entry.Policy != OrchAccessAllow && entry.Policy != OrchAccessDeny {
+		return fmt.Errorf("invalid orchestrator access policy %q", entry.Policy)
+	}
+	glog.V(DEBUG).Infof("db: Setting orchestrator access orch=%v policy=%v expiresAt=%v", entry.Orchestrator, entry.Policy, entry.ExpiresAt)
+	_, err := db.setOrchAccess.Exec(entry.Orchestrator, entry.Policy, entry.Reason, entry.ExpiresAt)
+	if err != nil {
+		glog.Errorf("db: Error setting orchestrator access orch=%v: %v", entry.Orchestrator, err)
+		return err
+	}
+	return nil
+}
+
+// DeleteOrchAccess removes the access list entries of an orchestrator.
+// This method will return nil for non-existent entries
+func (db *DB) DeleteOrchAccess(orch string) error {
+	glog.V(DEBUG).Infof("db: Deleting orchestrator access orch=%v", orch)
+	_, err := db.deleteOrchAccess.Exec(orch)
+	if err != nil {
+		glog.Errorf("db: Error deleting orchestrator access orch=%v: %v", orch, err)
+		return err
+	}
+	return nil
+}
+
+// OrchAccessList returns the orchestrator access list entries that have not expired by the given unix time
+func (db *DB) OrchAccessList(now int64) ([]*DBOrchAccess, error) {
+	rows, err := db.selectOrchAccess.Query(now)
+	if err != nil {
+		glog.Error("db: Unable to select orchestrator access list ", err)
+		return nil, err
+	}
+	defer rows.Close()
+	entries := []*DBOrchAccess{}
+	for rows.Next() {
+		var (
+			entry  DBOrchAccess
+			reason sql.NullString
+		)
+		if err := rows.Scan(&entry.Orchestrator, &entry.Policy, &reason, &entry.ExpiresAt); err != nil {
+			return nil, err
+		}
+		entry.Reason = reason.String
+		entries = append(entries, &entry)
+	}
+	return entries, nil
+}
+
+// SetTranscoderToken adds a transcoder token, replacing any existing token with the same name
+func (db *DB) SetTranscoderToken(token *DBTranscoderToken) error {
+	if token == nil || token.Name == "" || token.TokenHash == "" {
+		return errors.New("must provide a name and token hash")
+	}
+	glog.V(DEBUG).Infof("db: Setting transcoder token name=%v", token.Name)
+	_, err := db.setTranscoderToken.Exec(token.Name, token.TokenHash, token.CreatedAt)
+	if err != nil {
+		glog.Errorf("db: Error setting transcoder token name=%v: %v", token.Name, err)
+		return err
+	}
+	return nil
+}
+
+// DeleteTranscoderToken removes the token with the given name.
+// This method will return nil for non-existent tokens
+func (db *DB) DeleteTranscoderToken(name string) error {
+	glog.V(DEBUG).Infof("db: Deleting transcoder token name=%v", name)
+	_, err := db.deleteTranscoderToken.Exec(name)
+	if err != nil {
+		glog.Errorf("db: Error deleting transcoder token name=%v: %v", name, err)
+		return err
+	}
+	return nil
+}
+
+// TranscoderTokens returns every transcoder token, ordered by name
+func (db *DB) TranscoderTokens() ([]*DBTranscoderToken, error) {
+	rows, err := db.selectTranscoderTokens.Query()
+	if err != nil {
+		glog.Error("db: Unable to select transcoder tokens ", err)
+		return nil, err
+	}
+	defer rows.Close()
+	tokens := []*DBTranscoderToken{}
+	for rows.Next() {
+		var token DBTranscoderToken
+		if err := rows.Scan(&token.Name, &token.TokenHash, &token.CreatedAt); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, &token)
+	}
+	return tokens, nil
+}
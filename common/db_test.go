@@ -1145,3 +1145,92 @@ func defaultMiniHeader() *blockwatch.MiniHeader {
 	block.Logs = []types.Log{log}
 	return block
 }
+
+func TestOrchAccess(t *testing.T) {
+	dbh, dbraw, err := TempDB(t)
+	defer dbh.Close()
+	defer dbraw.Close()
+	assert := assert.New(t)
+	require := require.New(t)
+	require.Nil(err)
+
+	// invalid entries
+	assert.NotNil(dbh.SetOrchAccess(nil))
+	assert.NotNil(dbh.SetOrchAccess(&DBOrchAccess{Policy: OrchAccessAllow}))
+	assert.NotNil(dbh.SetOrchAccess(&DBOrchAccess{Orchestrator: "https://a:8935", Policy: "foo"}))
+
+	entries, err := dbh.OrchAccessList(100)
+	require.Nil(err)
+	assert.Empty(entries)
+
+	allow := &DBOrchAccess{Orchestrator: "https://a:8935", Policy: OrchAccessAllow, Reason: "trusted"}
+	deny := &DBOrchAccess{Orchestrator: "https://a:8935", Policy: OrchAccessDeny, Reason: "bad output", ExpiresAt: 200}
+	other := &DBOrchAccess{Orchestrator: "0x0000000000000000000000000000000000000001", Policy: OrchAccessDeny}
+	require.Nil(dbh.SetOrchAccess(allow))
+	require.Nil(dbh.SetOrchAccess(deny))
+	require.Nil(dbh.SetOrchAccess(other))
+
+	// both policies are kept for an orchestrator
+	entries, err = dbh.OrchAccessList(100)
+	require.Nil(err)
+	assert.ElementsMatch([]*DBOrchAccess{allow, deny, other}, entries)
+
+	// expired entries are skipped
+	entries, err = dbh.OrchAccessList(200)
+	require.Nil(err)
+	assert.ElementsMatch([]*DBOrchAccess{allow, other}, entries)
+
+	// replaced for the same orchestrator and policy
+	deny.ExpiresAt = 300
+	require.Nil(dbh.SetOrchAccess(deny))
+	entries, err = dbh.OrchAccessList(200)
+	require.Nil(err)
+	assert.ElementsMatch([]*DBOrchAccess{allow, deny, other}, entries)
+
+	// deleted for every policy
+	require.Nil(dbh.DeleteOrchAccess("https://a:8935"))
+	require.Nil(dbh.DeleteOrchAccess("https://nonexistent"))
+	entries, err = dbh.OrchAccessList(100)
+	require.Nil(err)
+	assert.Equal([]*DBOrchAccess{other}, entries)
+}
+
+func TestTranscoderTokens(t *testing.T) {
+	dbh, dbraw, err := TempDB(t)
+	defer dbh.Close()
+	defer dbraw.Close()
+	assert := assert.New(t)
+	require := require.New(t)
+	require.Nil(err)
+
+	// invalid tokens
+	assert.NotNil(dbh.SetTranscoderToken(nil))
+	assert.NotNil(dbh.SetTranscoderToken(&DBTranscoderToken{TokenHash: "abc"}))
+	assert.NotNil(dbh.SetTranscoderToken(&DBTranscoderToken{Name: "t1"}))
+
+	tokens, err := dbh.TranscoderTokens()
+	require.Nil(err)
+	assert.Empty(tokens)
+
+	t1 := &DBTranscoderToken{Name: "t1", TokenHash: "abc", CreatedAt: 100}
+	t2 := &DBTranscoderToken{Name: "t2", TokenHash: "def", CreatedAt: 200}
+	require.Nil(dbh.SetTranscoderToken(t2))
+	require.Nil(dbh.SetTranscoderToken(t1))
+	tokens, err = dbh.TranscoderTokens()
+	require.Nil(err)
+	assert.Equal([]*DBTranscoderToken{t1, t2}, tokens)
+
+	// replaced for the same name
+	t1.TokenHash = "ghi"
+	t1.CreatedAt = 300
+	require.Nil(dbh.SetTranscoderToken(t1))
+	tokens, err = dbh.TranscoderTokens()
+	require.Nil(err)
+	assert.Equal([]*DBTranscoderToken{t1, t2}, tokens)
+
+	require.Nil(dbh.DeleteTranscoderToken("t1"))
+	require.Nil(dbh.DeleteTranscoderToken("nonexistent"))
+	tokens, err = dbh.TranscoderTokens()
+	require.Nil(err)
+	assert.Equal([]*DBTranscoderToken{t2}, tokens)
+}
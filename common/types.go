@@ -15,7 +15,7 @@ type Broadcaster interface {
 
 type OrchestratorPool interface {
 	GetURLs() []*url.URL
-	GetOrchestrators(int) ([]*net.OrchestratorInfo, error)
+	GetOrchestrators(int, *net.Capabilities, func(*net.OrchestratorInfo) bool) ([]*net.OrchestratorInfo, error)
 	Size() int
 }
 
@@ -25,6 +25,18 @@ type OrchestratorStore interface {
 	UpdateOrch(orch *DBOrch) error
 }
 
+type OrchAccessStore interface {
+	SetOrchAccess(entry *DBOrchAccess) error
+	DeleteOrchAccess(orch string) error
+	OrchAccessList(now int64) ([]*DBOrchAccess, error)
+}
+
+type TranscoderTokenStore interface {
+	SetTranscoderToken(token *DBTranscoderToken) error
+	DeleteTranscoderToken(name string) error
+	TranscoderTokens() ([]*DBTranscoderToken, error)
+}
+
 type RoundsManager interface {
 	LastInitializedRound() *big.Int
 }
\ No newline at end of file
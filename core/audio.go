@@ -0,0 +1,125 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/livepeer/go-livepeer/net"
+	"github.com/livepeer/lpms/ffmpeg"
+)
+
+var ErrUnknownAudioCodec = errors.New("ErrUnknownAudioCodec")
+var ErrInvalidAudioProfile = errors.New("ErrInvalidAudioProfile")
+
+// DefaultAudioBitrate is the bitrate advertised for audio renditions whose
+// bitrate is unknown, eg. when the source audio is passed through
+const DefaultAudioBitrate = 128000
+
+// AudioCodec is the audio codec of a rendition
+type AudioCodec int
+
+const (
+	AudioCopy AudioCodec = iota // Passes the source audio through
+	AudioAAC
+	AudioNone // Strips the audio
+)
+
+// ParseAudioCodec parses a user supplied audio codec name. An empty name
+// maps to the default of passing the source audio through.
+func ParseAudioCodec(name string) (AudioCodec, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "copy":
+		return AudioCopy, nil
+	case "aac":
+		return AudioAAC, nil
+	case "none", "drop":
+		return AudioNone, nil
+	}
+	return AudioCopy, ErrUnknownAudioCodec
+}
+
+func (c AudioCodec) String() string {
+	switch c {
+	case AudioAAC:
+		return "aac"
+	case AudioNone:
+		return "none"
+	}
+	return "copy"
+}
+
+// AudioProfile describes the audio of a rendition. The zero value passes
+// the source audio through alongside the video.
+type AudioProfile struct {
+	Codec AudioCodec
+	// Bitrate of re-encoded audio in bits per second; encoder default if zero
+	Bitrate int
+	// The rendition has no video
+	AudioOnly bool
+}
+
+// Validate checks that the profile leaves the rendition with some media
+func (a AudioProfile) Validate() error {
+	if a.Bitrate < 0 || (a.AudioOnly && a.Codec == AudioNone) {
+		return ErrInvalidAudioProfile
+	}
+	return nil
+}
+
+// Bandwidth returns the bitrate to advertise for the audio of the rendition
+func (a AudioProfile) Bandwidth() int {
+	if a.Codec == AudioAAC && a.Bitrate > 0 {
+		return a.Bitrate
+	}
+	return DefaultAudioBitrate
+}
+
+// flatten serializes the audio settings of the i-th rendition so they can
+// be covered by segment signatures
+func (a AudioProfile) flatten(i int) string {
+	return fmt.Sprintf("%d:%v:%d:%t;", i, a.Codec, a.Bitrate, a.AudioOnly)
+}
+
+// setNet sets the audio fields of a protocol profile
+func (a AudioProfile) setNet(p *net.VideoProfile) {
+	switch a.Codec {
+	case AudioAAC:
+		p.AudioCodec = net.VideoProfile_AAC
+	case AudioNone:
+		p.AudioCodec = net.VideoProfile_AUDIO_NONE
+	}
+	p.AudioBitrate = int32(a.Bitrate)
+	p.AudioOnly = a.AudioOnly
+}
+
+// netAudioProfile returns the audio settings of a protocol profile
+func netAudioProfile(p *net.VideoProfile) AudioProfile {
+	a := AudioProfile{Bitrate: int(p.AudioBitrate), AudioOnly: p.AudioOnly}
+	switch p.AudioCodec {
+	case net.VideoProfile_AAC:
+		a.Codec = AudioAAC
+	case net.VideoProfile_AUDIO_NONE:
+		a.Codec = AudioNone
+	}
+	return a
+}
+
+// audioTranscodeOptions returns the encoder settings for the audio and
+// video of a rendition
+func audioTranscodeOptions(a AudioProfile) (audioEnc, videoEnc ffmpeg.ComponentOptions) {
+	audioEnc = ffmpeg.ComponentOptions{Name: "copy"}
+	switch a.Codec {
+	case AudioAAC:
+		audioEnc = ffmpeg.ComponentOptions{Name: "aac"}
+		if a.Bitrate > 0 {
+			audioEnc.Opts = map[string]string{"b": fmt.Sprint(a.Bitrate)}
+		}
+	case AudioNone:
+		audioEnc = ffmpeg.ComponentOptions{Name: "drop"}
+	}
+	if a.AudioOnly {
+		videoEnc = ffmpeg.ComponentOptions{Name: "drop"}
+	}
+	return audioEnc, videoEnc
+}
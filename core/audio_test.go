@@ -0,0 +1,43 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAudioCodec(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		name  string
+		codec AudioCodec
+	}{
+		{"", AudioCopy},
+		{"copy", AudioCopy},
+		{"AAC", AudioAAC},
+		{" none ", AudioNone},
+		{"drop", AudioNone},
+	}
+	for _, tt := range tests {
+		codec, err := ParseAudioCodec(tt.name)
+		assert.Nil(err)
+		assert.Equal(tt.codec, codec)
+	}
+
+	_, err := ParseAudioCodec("opus")
+	assert.Equal(ErrUnknownAudioCodec, err)
+}
+
+func TestAudioProfile_Validate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Nil(AudioProfile{}.Validate())
+	assert.Nil(AudioProfile{Codec: AudioNone}.Validate())
+	assert.Nil(AudioProfile{Codec: AudioAAC, Bitrate: 64000, AudioOnly: true}.Validate())
+	assert.Nil(AudioProfile{AudioOnly: true}.Validate())
+
+	// A rendition without audio or video
+	assert.Equal(ErrInvalidAudioProfile, AudioProfile{Codec: AudioNone, AudioOnly: true}.Validate())
+	assert.Equal(ErrInvalidAudioProfile, AudioProfile{Codec: AudioAAC, Bitrate: -1}.Validate())
+}
@@ -0,0 +1,226 @@
+package core
+
+import (
+	"strings"
+
+	"github.com/livepeer/go-livepeer/drivers"
+	"github.com/livepeer/go-livepeer/net"
+	"github.com/livepeer/lpms/ffmpeg"
+)
+
+// gpuVideoCodecs are the video codecs Nvidia transcoders encode on the GPU
+var gpuVideoCodecs = map[VideoCodec]bool{CodecH264: true, CodecH265: true}
+
+// NewCapabilities returns the capabilities of a node that encodes with the
+// given video codecs. GPU nodes only advertise the codecs they have a
+// hardware encoder for. A maxPixels of zero doesn't limit rendition sizes.
+// The node can upload to any storage its drivers can open sessions for.
+func NewCapabilities(codecs []VideoCodec, gpu bool, maxPixels int64) *net.Capabilities {
+	caps := &net.Capabilities{
+		Formats:   []net.VideoProfile_Format{net.VideoProfile_MPEGTS, net.VideoProfile_MP4},
+		Storage:   append([]net.OSInfo_StorageType{}, drivers.SessionStorage...),
+		MaxPixels: maxPixels,
+		Gpu:       gpu,
+		Audio:     true,
+		// Images are encoded in software from frames decoded in software
+		Images: !gpu,
+	}
+	for _, c := range codecs {
+		if gpu && !gpuVideoCodecs[c] {
+			continue
+		}
+		caps.Codecs = appendCodec(caps.Codecs, netVideoCodec(c))
+	}
+	return caps
+}
+
+// DefaultCapabilities returns the capabilities of a node that hasn't been
+// configured otherwise
+func DefaultCapabilities(gpu bool) *net.Capabilities {
+	return NewCapabilities([]VideoCodec{CodecH264}, gpu, 0)
+}
+
+// LegacyCapabilities returns the capabilities assumed for nodes that don't
+// advertise any. Such nodes predate capabilities but already upload to both
+// S3 and Google Cloud Storage.
+func LegacyCapabilities() *net.Capabilities {
+	return &net.Capabilities{
+		Codecs:  []net.VideoProfile_VideoCodec{net.VideoProfile_H264},
+		Formats: []net.VideoProfile_Format{net.VideoProfile_MPEGTS},
+		Storage: []net.OSInfo_StorageType{net.OSInfo_S3, net.OSInfo_GOOGLE},
+	}
+}
+
+// ParseVideoCodecs parses a comma separated list of video codec names
+func ParseVideoCodecs(list string) ([]VideoCodec, error) {
+	var codecs []VideoCodec
+	for _, name := range strings.Split(list, ",") {
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+		c, err := ParseVideoCodec(name)
+		if err != nil {
+			return nil, err
+		}
+		codecs = append(codecs, c)
+	}
+	if len(codecs) == 0 {
+		return nil, ErrUnknownVideoCodec
+	}
+	return codecs, nil
+}
+
+// StreamCapabilities returns the capabilities needed to transcode a stream
+// into the given renditions
+func StreamCapabilities(profiles []ffmpeg.VideoProfile, format SegmentFormat, renditions RenditionProfiles) *net.Capabilities {
+
+	caps := &net.Capabilities{}
+	if format == FormatMP4 {
+		caps.Formats = []net.VideoProfile_Format{net.VideoProfile_MP4}
+	} else {
+		caps.Formats = []net.VideoProfile_Format{net.VideoProfile_MPEGTS}
+	}
+	for _, p := range profiles {
+		r := renditions[p.Name]
+		if r.Audio != (AudioProfile{}) {
+			caps.Audio = true
+		}
+		if r.Audio.AudioOnly {
+			continue
+		}
+		if r.Thumbnail != nil {
+			caps.Images = true
+		} else {
+			caps.Codecs = appendCodec(caps.Codecs, netVideoCodec(r.Encoding.Codec))
+		}
+		if w, h, err := ffmpeg.VideoProfileResolution(p); err == nil && int64(w*h) > caps.MaxPixels {
+			caps.MaxPixels = int64(w * h)
+		}
+	}
+	return caps
+}
+
+// IntersectCapabilities returns the capabilities shared by both nodes. Nil
+// capabilities are treated as legacy ones.
+func IntersectCapabilities(a, b *net.Capabilities) *net.Capabilities {
+	if a == nil {
+		a = LegacyCapabilities()
+	}
+	if b == nil {
+		b = LegacyCapabilities()
+	}
+	caps := &net.Capabilities{
+		Gpu:    a.Gpu && b.Gpu,
+		Audio:  a.Audio && b.Audio,
+		Images: a.Images && b.Images,
+	}
+	for _, c := range a.Codecs {
+		if hasCodec(b.Codecs, c) {
+			caps.Codecs = append(caps.Codecs, c)
+		}
+	}
+	for _, f := range a.Formats {
+		if hasFormat(b.Formats, f) {
+			caps.Formats = append(caps.Formats, f)
+		}
+	}
+	for _, s := range a.Storage {
+		if hasStorage(b.Storage, s) {
+			caps.Storage = append(caps.Storage, s)
+		}
+	}
+	switch {
+	case a.MaxPixels == 0:
+		caps.MaxPixels = b.MaxPixels
+	case b.MaxPixels == 0 || a.MaxPixels < b.MaxPixels:
+		caps.MaxPixels = a.MaxPixels
+	default:
+		caps.MaxPixels = b.MaxPixels
+	}
+	return caps
+}
+
+// CapabilitiesSatisfy returns whether a node with the capabilities `have`
+// can transcode a stream requiring the capabilities `want`. Nil `have`
+// capabilities are treated as legacy ones; nil `want` capabilities are
+// always satisfied.
+func CapabilitiesSatisfy(have, want *net.Capabilities) bool {
+	if want == nil {
+		return true
+	}
+	if have == nil {
+		have = LegacyCapabilities()
+	}
+	for _, c := range want.Codecs {
+		if !hasCodec(have.Codecs, c) {
+			return false
+		}
+	}
+	for _, f := range want.Formats {
+		if !hasFormat(have.Formats, f) {
+			return false
+		}
+	}
+	for _, s := range want.Storage {
+		if !hasStorage(have.Storage, s) {
+			return false
+		}
+	}
+	if have.MaxPixels > 0 && want.MaxPixels > have.MaxPixels {
+		return false
+	}
+	if want.Gpu && !have.Gpu {
+		return false
+	}
+	if want.Audio && !have.Audio {
+		return false
+	}
+	if want.Images && !have.Images {
+		return false
+	}
+	return true
+}
+
+func netVideoCodec(c VideoCodec) net.VideoProfile_VideoCodec {
+	switch c {
+	case CodecH265:
+		return net.VideoProfile_H265
+	case CodecVP9:
+		return net.VideoProfile_VP9
+	}
+	return net.VideoProfile_H264
+}
+
+func appendCodec(codecs []net.VideoProfile_VideoCodec, c net.VideoProfile_VideoCodec) []net.VideoProfile_VideoCodec {
+	if hasCodec(codecs, c) {
+		return codecs
+	}
+	return append(codecs, c)
+}
+
+func hasCodec(codecs []net.VideoProfile_VideoCodec, c net.VideoProfile_VideoCodec) bool {
+	for _, v := range codecs {
+		if v == c {
+			return true
+		}
+	}
+	return false
+}
+
+func hasFormat(formats []net.VideoProfile_Format, f net.VideoProfile_Format) bool {
+	for _, v := range formats {
+		if v == f {
+			return true
+		}
+	}
+	return false
+}
+
+func hasStorage(storage []net.OSInfo_StorageType, s net.OSInfo_StorageType) bool {
+	for _, v := range storage {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,141 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/livepeer/go-livepeer/drivers"
+	"github.com/livepeer/go-livepeer/net"
+	"github.com/livepeer/lpms/ffmpeg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseVideoCodecs(t *testing.T) {
+	assert := assert.New(t)
+
+	codecs, err := ParseVideoCodecs("h264, hevc,,vp9")
+	assert.Nil(err)
+	assert.Equal([]VideoCodec{CodecH264, CodecH265, CodecVP9}, codecs)
+
+	_, err = ParseVideoCodecs("h264,av1")
+	assert.Equal(ErrUnknownVideoCodec, err)
+
+	_, err = ParseVideoCodecs(" , ")
+	assert.Equal(ErrUnknownVideoCodec, err)
+}
+
+func TestStreamCapabilities(t *testing.T) {
+	assert := assert.New(t)
+	profiles := []ffmpeg.VideoProfile{ffmpeg.P720p30fps16x9, ffmpeg.P360p30fps16x9, ffmpeg.P144p30fps16x9}
+
+	// Defaults only need legacy capabilities
+	caps := StreamCapabilities(profiles, FormatMPEGTS, nil)
+	assert.Equal([]net.VideoProfile_VideoCodec{net.VideoProfile_H264}, caps.Codecs)
+	assert.Equal([]net.VideoProfile_Format{net.VideoProfile_MPEGTS}, caps.Formats)
+	assert.Equal(int64(1280*720), caps.MaxPixels)
+	assert.False(caps.Audio)
+	assert.True(CapabilitiesSatisfy(LegacyCapabilities(), caps))
+
+	// Audio-only renditions don't need a video codec or size
+	renditions := RenditionProfiles{
+		ffmpeg.P720p30fps16x9.Name: {Audio: AudioProfile{Codec: AudioAAC, AudioOnly: true}},
+		ffmpeg.P360p30fps16x9.Name: {Encoding: VideoEncoding{Codec: CodecVP9}},
+	}
+	caps = StreamCapabilities(profiles, FormatMP4, renditions)
+	assert.Equal([]net.VideoProfile_VideoCodec{net.VideoProfile_VP9, net.VideoProfile_H264}, caps.Codecs)
+	assert.Equal([]net.VideoProfile_Format{net.VideoProfile_MP4}, caps.Formats)
+	assert.Equal(int64(640*360), caps.MaxPixels)
+	assert.True(caps.Audio)
+	assert.False(CapabilitiesSatisfy(LegacyCapabilities(), caps))
+	assert.True(CapabilitiesSatisfy(NewCapabilities([]VideoCodec{CodecH264, CodecVP9}, false, 0), caps))
+
+	// Thumbnail renditions need images rather than a video codec
+	renditions = RenditionProfiles{
+		ffmpeg.P720p30fps16x9.Name: {Thumbnail: &ThumbnailProfile{}},
+		ffmpeg.P360p30fps16x9.Name: {Encoding: VideoEncoding{Codec: CodecVP9}},
+	}
+	caps = StreamCapabilities(profiles, FormatMPEGTS, renditions)
+	assert.Equal([]net.VideoProfile_VideoCodec{net.VideoProfile_VP9, net.VideoProfile_H264}, caps.Codecs)
+	assert.Equal(int64(1280*720), caps.MaxPixels)
+	assert.True(caps.Images)
+	assert.True(CapabilitiesSatisfy(NewCapabilities([]VideoCodec{CodecH264, CodecVP9}, false, 0), caps))
+	assert.False(CapabilitiesSatisfy(NewCapabilities([]VideoCodec{CodecH264, CodecVP9}, true, 0), caps))
+}
+
+func TestCapabilitiesSatisfy(t *testing.T) {
+	assert := assert.New(t)
+	have := NewCapabilities([]VideoCodec{CodecH264, CodecH265}, false, 1920*1080)
+
+	assert.True(CapabilitiesSatisfy(have, nil))
+	assert.True(CapabilitiesSatisfy(nil, nil))
+	assert.True(CapabilitiesSatisfy(have, &net.Capabilities{}))
+	assert.True(CapabilitiesSatisfy(have, &net.Capabilities{
+		Codecs:    []net.VideoProfile_VideoCodec{net.VideoProfile_H265},
+		Formats:   []net.VideoProfile_Format{net.VideoProfile_MP4},
+		Storage:   []net.OSInfo_StorageType{net.OSInfo_GOOGLE},
+		MaxPixels: 1920 * 1080,
+		Audio:     true,
+	}))
+
+	assert.False(CapabilitiesSatisfy(have, &net.Capabilities{Codecs: []net.VideoProfile_VideoCodec{net.VideoProfile_VP9}}))
+	assert.False(CapabilitiesSatisfy(have, &net.Capabilities{MaxPixels: 3840 * 2160}))
+	assert.False(CapabilitiesSatisfy(have, &net.Capabilities{Gpu: true}))
+
+	// Missing capabilities are treated as legacy ones
+	assert.True(CapabilitiesSatisfy(nil, &net.Capabilities{
+		Codecs:    []net.VideoProfile_VideoCodec{net.VideoProfile_H264},
+		Formats:   []net.VideoProfile_Format{net.VideoProfile_MPEGTS},
+		Storage:   []net.OSInfo_StorageType{net.OSInfo_S3, net.OSInfo_GOOGLE},
+		MaxPixels: 3840 * 2160,
+	}))
+	assert.False(CapabilitiesSatisfy(nil, &net.Capabilities{Formats: []net.VideoProfile_Format{net.VideoProfile_MP4}}))
+	assert.False(CapabilitiesSatisfy(nil, &net.Capabilities{Storage: []net.OSInfo_StorageType{net.OSInfo_DIRECT}}))
+	assert.False(CapabilitiesSatisfy(nil, &net.Capabilities{Audio: true}))
+}
+
+func TestNewCapabilities_Storage(t *testing.T) {
+	assert := assert.New(t)
+
+	// Storage follows the drivers sessions can be opened with
+	caps := NewCapabilities([]VideoCodec{CodecH264}, false, 0)
+	assert.Equal(drivers.SessionStorage, caps.Storage)
+	caps.Storage[0] = net.OSInfo_DIRECT
+	assert.Equal(net.OSInfo_S3, drivers.SessionStorage[0])
+}
+
+func TestNewCapabilities_GPU(t *testing.T) {
+	assert := assert.New(t)
+	codecs := []VideoCodec{CodecH264, CodecH265, CodecVP9}
+
+	caps := NewCapabilities(codecs, false, 0)
+	assert.Equal([]net.VideoProfile_VideoCodec{net.VideoProfile_H264, net.VideoProfile_H265, net.VideoProfile_VP9}, caps.Codecs)
+	assert.True(caps.Images)
+
+	// VP9 and images have no hardware encoder
+	caps = NewCapabilities(codecs, true, 0)
+	assert.Equal([]net.VideoProfile_VideoCodec{net.VideoProfile_H264, net.VideoProfile_H265}, caps.Codecs)
+	assert.False(caps.Images)
+	assert.True(caps.Gpu)
+}
+
+func TestIntersectCapabilities(t *testing.T) {
+	assert := assert.New(t)
+	a := NewCapabilities([]VideoCodec{CodecH264, CodecH265}, true, 1920*1080)
+	b := NewCapabilities([]VideoCodec{CodecH265, CodecVP9}, true, 0)
+
+	caps := IntersectCapabilities(a, b)
+	assert.Equal([]net.VideoProfile_VideoCodec{net.VideoProfile_H265}, caps.Codecs)
+	assert.Equal(a.Formats, caps.Formats)
+	assert.Equal(a.Storage, caps.Storage)
+	assert.Equal(int64(1920*1080), caps.MaxPixels)
+	assert.True(caps.Gpu)
+	assert.True(caps.Audio)
+	assert.Equal(caps, IntersectCapabilities(b, a))
+
+	caps = IntersectCapabilities(a, nil)
+	assert.Equal(LegacyCapabilities().Codecs, caps.Codecs)
+	assert.Equal(LegacyCapabilities().Formats, caps.Formats)
+	assert.Equal(LegacyCapabilities().Storage, caps.Storage)
+	assert.Equal(int64(1920*1080), caps.MaxPixels)
+	assert.False(caps.Gpu)
+	assert.False(caps.Audio)
+}
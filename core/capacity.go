@@ -0,0 +1,109 @@
+package core
+
+import (
+	"errors"
+
+	"github.com/livepeer/lpms/ffmpeg"
+)
+
+// ErrOrchOverloaded is returned for new streams that would push the
+// transcoding load past what can be encoded in real time. Unlike
+// ErrOrchCap, it depends on the stream, so others may still be accepted.
+var ErrOrchOverloaded = errors.New("OrchestratorOverloaded")
+
+// Frame rate assumed for renditions that keep the source frame rate
+const defaultCostFramerate = 30
+
+// streamPixelRate estimates the rendition pixels per second that have to
+// be encoded to transcode a stream in real time
+func streamPixelRate(profiles []ffmpeg.VideoProfile) int64 {
+	withRate := make([]ffmpeg.VideoProfile, len(profiles))
+	for i, p := range profiles {
+		if p.Framerate == 0 {
+			p.Framerate = defaultCostFramerate
+		}
+		withRate[i] = p
+	}
+	return int64(calculateCost(withRate))
+}
+
+// PixelRate returns the rendition pixels per second the node's transcoders
+// can encode in real time, or 0 if unknown
+func (n *LivepeerNode) PixelRate() int64 {
+	if n.TranscoderManager != nil && n.Transcoder == n.TranscoderManager {
+		return n.TranscoderManager.PixelRate()
+	}
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.capabilities.GetPixelRate()
+}
+
+// PixelLoad returns the rendition pixels per second of the streams being
+// transcoded, as measured from their latest segments or estimated from
+// their profiles until one has been transcoded
+func (n *LivepeerNode) PixelLoad() int64 {
+	n.segmentMutex.RLock()
+	defer n.segmentMutex.RUnlock()
+	return n.pixelLoad
+}
+
+// checkPixelRate checks whether a new stream with the profiles fits within
+// the transcoders' real-time capacity. Without profiles, it checks whether
+// there's capacity left for any stream. Expects `n.segmentMutex` to be
+// locked by the caller.
+func (n *LivepeerNode) checkPixelRate(profiles []ffmpeg.VideoProfile) error {
+	limit := n.PixelRate()
+	if limit <= 0 {
+		return nil
+	}
+	if n.pixelLoad >= limit || n.pixelLoad+streamPixelRate(profiles) > limit {
+		return ErrOrchOverloaded
+	}
+	return nil
+}
+
+// updatePixelLoad replaces the load of an admitted stream with the rendition
+// pixels per second measured from a transcoded segment. Segments without
+// pixel counts or a duration leave the load as is.
+func (n *LivepeerNode) updatePixelLoad(mid ManifestID, td *TranscodeData, duration float64) {
+	if n == nil || td == nil || duration <= 0 {
+		return
+	}
+	var pixels int64
+	for _, s := range td.Segments {
+		pixels += s.Pixels
+	}
+	if pixels <= 0 {
+		return
+	}
+	rate := int64(float64(pixels) / duration)
+	n.segmentMutex.Lock()
+	defer n.segmentMutex.Unlock()
+	// Streams that were released aren't counted again
+	if cost, ok := n.segmentCosts[mid]; ok {
+		n.pixelLoad += rate - cost
+		n.segmentCosts[mid] = rate
+	}
+}
+
+// PixelRate returns the total pixel rate of the live transcoders, or 0 if
+// none of them report one. Transcoders without a pixel rate are counted at
+// the average rate per session of those that report one.
+func (rtm *RemoteTranscoderManager) PixelRate() int64 {
+	rtm.RTmutex.Lock()
+	defer rtm.RTmutex.Unlock()
+	var total int64
+	var reported, unreported int
+	for _, transcoder := range rtm.liveTranscoders {
+		if rate := transcoder.capabilities.GetPixelRate(); rate > 0 {
+			total += rate
+			reported += transcoder.capacity
+		} else {
+			unreported += transcoder.capacity
+		}
+	}
+	if reported > 0 {
+		total += total * int64(unreported) / int64(reported)
+	}
+	return total
+}
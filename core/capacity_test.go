@@ -0,0 +1,168 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/livepeer/go-livepeer/drivers"
+	"github.com/livepeer/go-livepeer/net"
+	"github.com/livepeer/lpms/ffmpeg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamPixelRate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(int64(256*144*30+426*240*30), streamPixelRate([]ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9, ffmpeg.P240p30fps16x9}))
+
+	// Renditions keeping the source frame rate are assumed to be 30fps
+	p := ffmpeg.P720p60fps16x9
+	p.Framerate = 0
+	assert.Equal(int64(1280*720*defaultCostFramerate), streamPixelRate([]ffmpeg.VideoProfile{p}))
+
+	// Audio-only renditions have no pixels
+	assert.Equal(int64(0), streamPixelRate([]ffmpeg.VideoProfile{{Name: "audio", Resolution: "0x0"}}))
+	assert.Equal(int64(0), streamPixelRate(nil))
+}
+
+func TestOrchCheckCapacity_PixelRate(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	drivers.NodeStorage = drivers.NewMemoryDriver(nil)
+	n, _ := NewLivepeerNode(nil, "", nil)
+	o := NewOrchestrator(n, nil)
+	md := StubSegTranscodingMetadata()
+	cost := streamPixelRate(md.Profiles)
+
+	// Unlimited without a known pixel rate
+	assert.Equal(int64(0), n.PixelRate())
+	assert.Nil(o.CheckCapacity(md))
+
+	caps := DefaultCapabilities(false)
+	caps.PixelRate = cost + cost/2
+	n.SetCapabilities(caps)
+	assert.Equal(caps.PixelRate, n.PixelRate())
+	assert.Nil(o.CheckCapacity(md))
+	assert.Nil(o.CheckCapacity(nil))
+
+	_, err := n.getSegmentChan(md)
+	require.Nil(err)
+	assert.Equal(cost, n.PixelLoad())
+
+	// Another stream of the same cost doesn't fit, but a cheaper one does
+	md2 := StubSegTranscodingMetadata()
+	md2.ManifestID = ManifestID(t.Name())
+	assert.Equal(ErrOrchOverloaded, o.CheckCapacity(md2))
+	_, err = n.getSegmentChan(md2)
+	assert.Equal(ErrOrchOverloaded, err)
+	md2.Profiles = md2.Profiles[:1]
+	assert.Nil(o.CheckCapacity(md2))
+
+	// Streams already admitted are still accepted once the load is full
+	caps.PixelRate = cost
+	assert.Equal(ErrOrchOverloaded, o.CheckCapacity(nil))
+	assert.Equal(ErrOrchOverloaded, o.CheckCapacity(md2))
+	assert.Nil(o.CheckCapacity(md))
+}
+
+func TestPixelLoad_Release(t *testing.T) {
+	drivers.NodeStorage = drivers.NewMemoryDriver(nil)
+	n, _ := NewLivepeerNode(nil, "", nil)
+	md := StubSegTranscodingMetadata()
+	oldTimeout := transcodeLoopTimeout
+	defer func() { transcodeLoopTimeout = oldTimeout }()
+	transcodeLoopTimeout = 100 * time.Millisecond
+
+	_, err := n.getSegmentChan(md)
+	require.Nil(t, err)
+	assert.Equal(t, streamPixelRate(md.Profiles), n.PixelLoad())
+
+	// The stream's load is released along with its segment loop
+	waitForTranscoderLoopTimeout(n, md.ManifestID)
+	assert.Equal(t, int64(0), n.PixelLoad())
+}
+
+func TestRemoteTranscoderManager_PixelRate(t *testing.T) {
+	assert := assert.New(t)
+	m := NewRemoteTranscoderManager()
+	n, _ := NewLivepeerNode(nil, "", nil)
+	n.TranscoderManager = m
+	n.Transcoder = m
+	strm := &StubTranscoderServer{}
+	strm2 := &StubTranscoderServer{manager: m}
+	strm3 := &StubTranscoderServer{manager: m}
+
+	// Own capabilities are ignored when transcoding remotely
+	n.SetCapabilities(&net.Capabilities{PixelRate: 1000})
+	assert.Equal(int64(0), n.PixelRate())
+
+	caps := DefaultCapabilities(false)
+	caps.PixelRate = 3000
+	caps2 := DefaultCapabilities(true)
+	caps2.PixelRate = 5000
+	wg1, wg2, wg3 := newWg(1), newWg(1), newWg(1)
+	go func() { m.Manage(strm, "", 5, caps); wg1.Done() }()
+	go func() { m.Manage(strm2, "", 5, caps2); wg2.Done() }()
+	time.Sleep(1 * time.Millisecond) // allow the manager to activate
+	assert.Equal(int64(8000), m.PixelRate())
+	assert.Equal(int64(8000), n.PixelRate())
+
+	// Transcoders without a pixel rate add the average rate per session
+	go func() { m.Manage(strm3, "", 2, nil); wg3.Done() }()
+	time.Sleep(1 * time.Millisecond) // allow the manager to activate
+	assert.Equal(int64(8000+2*800), m.PixelRate())
+
+	m.liveTranscoders[strm3].eof <- struct{}{}
+	assert.True(wgWait(wg3)) // time limit
+	m.liveTranscoders[strm2].eof <- struct{}{}
+	assert.True(wgWait(wg2)) // time limit
+	assert.Equal(int64(3000), m.PixelRate())
+	m.liveTranscoders[strm].eof <- struct{}{}
+	assert.True(wgWait(wg1)) // time limit
+	assert.Equal(int64(0), m.PixelRate())
+}
+
+func TestPixelLoad_Measured(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	drivers.NodeStorage = drivers.NewMemoryDriver(nil)
+	n, _ := NewLivepeerNode(nil, "", nil)
+	md := StubSegTranscodingMetadata()
+	md2 := StubSegTranscodingMetadata()
+	md2.ManifestID = ManifestID(t.Name())
+	oldTimeout := transcodeLoopTimeout
+	defer func() { transcodeLoopTimeout = oldTimeout }()
+	transcodeLoopTimeout = 100 * time.Millisecond
+
+	_, err := n.getSegmentChan(md)
+	require.Nil(err)
+	_, err = n.getSegmentChan(md2)
+	require.Nil(err)
+	cost := streamPixelRate(md.Profiles)
+	assert.Equal(2*cost, n.PixelLoad())
+
+	// The estimate is replaced by the pixels encoded per second of video
+	td := &TranscodeData{Segments: []*TranscodedSegmentData{{Pixels: 3000}, {Pixels: 1000}}}
+	n.updatePixelLoad(md.ManifestID, td, 2)
+	assert.Equal(cost+2000, n.PixelLoad())
+	n.updatePixelLoad(md.ManifestID, td, 4)
+	assert.Equal(cost+1000, n.PixelLoad())
+
+	// Segments without pixel counts or a duration are ignored
+	n.updatePixelLoad(md.ManifestID, &TranscodeData{Segments: []*TranscodedSegmentData{{}}}, 2)
+	n.updatePixelLoad(md.ManifestID, td, 0)
+	n.updatePixelLoad(md.ManifestID, nil, 2)
+	assert.Equal(cost+1000, n.PixelLoad())
+
+	// So are streams that aren't admitted
+	n.updatePixelLoad("unknown", td, 2)
+	assert.Equal(cost+1000, n.PixelLoad())
+
+	// The measured load is released with the stream
+	waitForTranscoderLoopTimeout(n, md.ManifestID)
+	waitForTranscoderLoopTimeout(n, md2.ManifestID)
+	assert.Equal(int64(0), n.PixelLoad())
+	n.updatePixelLoad(md.ManifestID, td, 2)
+	assert.Equal(int64(0), n.PixelLoad())
+}
@@ -95,7 +95,7 @@ func TestTranscodeSeg(t *testing.T) {
 	assert.Nil(res.Err)
 	assert.Nil(res.Sig)
 	// sanity check results
-	resBytes, _ := n.Transcoder.Transcode("", "", profiles)
+	resBytes, _ := n.Transcoder.Transcode(&SegTranscodingMetadata{Profiles: profiles})
 	for i, trData := range res.TranscodeData.Segments {
 		assert.Equal(resBytes.Segments[i].Data, trData.Data)
 	}
@@ -114,6 +114,56 @@ func TestTranscodeSeg(t *testing.T) {
 	assert.Equal(resHash, res.Sig)
 }
 
+// uploadingTranscoder returns renditions as if a remote transcoder had
+// uploaded them into the broadcaster's storage
+type uploadingTranscoder struct {
+	segments []*TranscodedSegmentData
+}
+
+func (t *uploadingTranscoder) Transcode(md *SegTranscodingMetadata) (*TranscodeData, error) {
+	return &TranscodeData{Segments: t.segments, Transcoder: "uploader"}, nil
+}
+
+func TestTranscodeSeg_UploadedRenditions(t *testing.T) {
+	assert := assert.New(t)
+	tmp, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(tmp)
+
+	profiles := []ffmpeg.VideoProfile{ffmpeg.P720p60fps16x9, ffmpeg.P144p30fps16x9}
+	tr := &uploadingTranscoder{segments: []*TranscodedSegmentData{
+		{URI: "https://bucket/720p/100.ts", Hash: ethCrypto.Keccak256([]byte("720p")), Pixels: 1},
+		// Renditions the transcoder couldn't upload are returned as data
+		{Data: []byte("Transcoded_P144p30fps16x9_data"), Pixels: 2},
+	}}
+	n, _ := NewLivepeerNode(nil, tmp, nil)
+	n.Transcoder = tr
+	n.Eth = &eth.StubClient{}
+	conf := transcodeConfig{LocalOS: (drivers.NewMemoryDriver(nil)).NewSession("")}
+	md := &SegTranscodingMetadata{Profiles: profiles}
+
+	// The transcoder's hashes are signed along with those of the data
+	res := n.transcodeSeg(conf, StubSegment(), md)
+	assert.Nil(res.Err)
+	assert.Equal(tr.segments, res.TranscodeData.Segments)
+	resHash := ethCrypto.Keccak256(tr.segments[0].Hash, ethCrypto.Keccak256(tr.segments[1].Data))
+	assert.Equal(resHash, res.Sig)
+	// and the transcoder vouching for them is named
+	assert.Equal("uploader", res.Transcoder)
+
+	// Nobody is named when the orchestrator hashed every rendition
+	uploaded := tr.segments[0]
+	tr.segments[0] = &TranscodedSegmentData{Data: []byte("Transcoded_P720p60fps16x9_data")}
+	res = n.transcodeSeg(conf, StubSegment(), md)
+	assert.Nil(res.Err)
+	assert.Empty(res.Transcoder)
+	tr.segments[0] = uploaded
+
+	// Uploaded renditions need a hash to sign
+	tr.segments[0].Hash = nil
+	res = n.transcodeSeg(conf, StubSegment(), md)
+	assert.EqualError(res.Err, "MissingSegmentHash")
+}
+
 func TestTranscodeLoop_GivenNoSegmentsPastTimeout_CleansSegmentChan(t *testing.T) {
 	//Set up the node
 	drivers.NodeStorage = drivers.NewMemoryDriver(nil)
@@ -0,0 +1,186 @@
+package core
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/livepeer/m3u8"
+)
+
+const (
+	mpdNamespace       = "urn:mpeg:dash:schema:mpd:2011"
+	mpdProfileLive     = "urn:mpeg:dash:profile:isoff-live:2011"
+	mpdProfileMPEGTS   = "urn:mpeg:dash:profile:mp2t-simple:2011"
+	mpdTimescale       = 1000
+	mpdDefaultDuration = 2.0
+)
+
+// MPD is a dynamic MPEG-DASH manifest. Segments are listed explicitly
+// since their URIs are chosen by the object storage.
+type MPD struct {
+	XMLName               xml.Name    `xml:"MPD"`
+	XMLNS                 string      `xml:"xmlns,attr"`
+	Profiles              string      `xml:"profiles,attr"`
+	Type                  string      `xml:"type,attr"`
+	AvailabilityStartTime string      `xml:"availabilityStartTime,attr"`
+	PublishTime           string      `xml:"publishTime,attr"`
+	MinimumUpdatePeriod   string      `xml:"minimumUpdatePeriod,attr"`
+	MinBufferTime         string      `xml:"minBufferTime,attr"`
+	TimeShiftBufferDepth  string      `xml:"timeShiftBufferDepth,attr"`
+	Periods               []MPDPeriod `xml:"Period"`
+}
+
+type MPDPeriod struct {
+	ID             string             `xml:"id,attr"`
+	Start          string             `xml:"start,attr"`
+	AdaptationSets []MPDAdaptationSet `xml:"AdaptationSet"`
+}
+
+type MPDAdaptationSet struct {
+	ID               int                 `xml:"id,attr"`
+	MimeType         string              `xml:"mimeType,attr"`
+	SegmentAlignment bool                `xml:"segmentAlignment,attr"`
+	Representations  []MPDRepresentation `xml:"Representation"`
+}
+
+type MPDRepresentation struct {
+	ID          string          `xml:"id,attr"`
+	Bandwidth   uint32          `xml:"bandwidth,attr"`
+	Width       int             `xml:"width,attr,omitempty"`
+	Height      int             `xml:"height,attr,omitempty"`
+	Codecs      string          `xml:"codecs,attr,omitempty"`
+	SegmentList *MPDSegmentList `xml:"SegmentList"`
+}
+
+type MPDSegmentList struct {
+	Timescale       uint64             `xml:"timescale,attr"`
+	StartNumber     uint64             `xml:"startNumber,attr"`
+	Initialization  *MPDInitialization `xml:"Initialization,omitempty"`
+	SegmentTimeline MPDSegmentTimeline `xml:"SegmentTimeline"`
+	SegmentURLs     []MPDSegmentURL    `xml:"SegmentURL"`
+}
+
+type MPDInitialization struct {
+	SourceURL string `xml:"sourceURL,attr"`
+}
+
+type MPDSegmentTimeline struct {
+	S []MPDTimelineEntry `xml:"S"`
+}
+
+type MPDTimelineEntry struct {
+	T *uint64 `xml:"t,attr,omitempty"`
+	D uint64  `xml:"d,attr"`
+}
+
+type MPDSegmentURL struct {
+	Media string `xml:"media,attr"`
+}
+
+// Encode renders the manifest as an XML document
+func (mpd *MPD) Encode() ([]byte, error) {
+	b, err := xml.MarshalIndent(mpd, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), b...), nil
+}
+
+// GetDASHManifest builds a dynamic MPD from the media playlists of the
+// stream, with one AdaptationSet per rendition. Returns nil if no segments
+// have been inserted yet.
+func (mgr *BasicPlaylistManager) GetDASHManifest() *MPD {
+	mgr.mapSync.RLock()
+	defer mgr.mapSync.RUnlock()
+
+	var sets []MPDAdaptationSet
+	maxDuration, bufferDepth := 0.0, 0.0
+	mpegts := false
+	for i, variant := range mgr.masterPList.Variants {
+		rendition := strings.TrimSuffix(path.Base(variant.URI), ".m3u8")
+		segs := mediaSegments(mgr.mediaLists[rendition])
+		if len(segs) == 0 {
+			continue
+		}
+		format, _ := SegmentFormatFromExt(path.Ext(segs[0].URI))
+		mpegts = mpegts || format == FormatMPEGTS
+
+		t := uint64(math.Round(mgr.elapsed[rendition] * mpdTimescale))
+		list := &MPDSegmentList{Timescale: mpdTimescale, StartNumber: segs[0].SeqId}
+		if segs[0].Map != nil {
+			list.Initialization = &MPDInitialization{SourceURL: segs[0].Map.URI}
+		}
+		total := 0.0
+		for j, seg := range segs {
+			entry := MPDTimelineEntry{D: uint64(math.Round(seg.Duration * mpdTimescale))}
+			if j == 0 {
+				entry.T = &t
+			}
+			list.SegmentTimeline.S = append(list.SegmentTimeline.S, entry)
+			list.SegmentURLs = append(list.SegmentURLs, MPDSegmentURL{Media: seg.URI})
+			maxDuration = math.Max(maxDuration, seg.Duration)
+			total += seg.Duration
+		}
+		bufferDepth = math.Max(bufferDepth, total)
+
+		rep := MPDRepresentation{ID: rendition, Bandwidth: variant.Bandwidth, Codecs: variant.Codecs, SegmentList: list}
+		fmt.Sscanf(variant.Resolution, "%dx%d", &rep.Width, &rep.Height)
+		mimeType := format.DASHMimeType()
+		if mgr.renditions[rendition].Audio.AudioOnly {
+			mimeType = strings.Replace(mimeType, "video/", "audio/", 1)
+		}
+		sets = append(sets, MPDAdaptationSet{
+			ID:               i,
+			MimeType:         mimeType,
+			SegmentAlignment: true,
+			Representations:  []MPDRepresentation{rep},
+		})
+	}
+	if len(sets) == 0 {
+		return nil
+	}
+	if maxDuration <= 0 {
+		maxDuration = mpdDefaultDuration
+	}
+
+	profiles := mpdProfileLive
+	if mpegts {
+		profiles = mpdProfileMPEGTS
+	}
+	return &MPD{
+		XMLNS:                 mpdNamespace,
+		Profiles:              profiles,
+		Type:                  "dynamic",
+		AvailabilityStartTime: mgr.startTime.UTC().Format(time.RFC3339),
+		PublishTime:           time.Now().UTC().Format(time.RFC3339),
+		MinimumUpdatePeriod:   mpdDuration(maxDuration),
+		MinBufferTime:         mpdDuration(maxDuration),
+		TimeShiftBufferDepth:  mpdDuration(bufferDepth),
+		Periods:               []MPDPeriod{{ID: "0", Start: "PT0S", AdaptationSets: sets}},
+	}
+}
+
+// mediaSegments returns the segments in the window of a media playlist, in
+// sequence order
+func mediaSegments(mpl *m3u8.MediaPlaylist) []*m3u8.MediaSegment {
+	if mpl == nil {
+		return nil
+	}
+	var segs []*m3u8.MediaSegment
+	for _, seg := range mpl.Segments {
+		if seg != nil {
+			segs = append(segs, seg)
+		}
+	}
+	sort.Slice(segs, func(i, j int) bool { return segs[i].SeqId < segs[j].SeqId })
+	return segs
+}
+
+func mpdDuration(secs float64) string {
+	return fmt.Sprintf("PT%.3fS", secs)
+}
@@ -0,0 +1,104 @@
+package core
+
+import (
+	"fmt"
+	"testing"
+
+	ffmpeg "github.com/livepeer/lpms/ffmpeg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetDASHManifest(t *testing.T) {
+	assert := assert.New(t)
+	c := NewBasicPlaylistManager(RandomManifestID(), nil)
+	assert.Nil(c.GetDASHManifest())
+
+	p144, p240 := &ffmpeg.P144p30fps16x9, &ffmpeg.P240p30fps16x9
+	for i := uint64(0); i < 3; i++ {
+		require.Nil(t, c.InsertHLSSegment(p144, i, fmt.Sprintf("p144/%d.ts", i), 2))
+		require.Nil(t, c.InsertHLSSegment(p240, i, fmt.Sprintf("p240/%d.ts", i), 2.5))
+	}
+	mpd := c.GetDASHManifest()
+	require.NotNil(t, mpd)
+	assert.Equal("dynamic", mpd.Type)
+	assert.Equal(mpdProfileMPEGTS, mpd.Profiles)
+	assert.Equal("PT2.500S", mpd.MinimumUpdatePeriod)
+	assert.Equal("PT7.500S", mpd.TimeShiftBufferDepth)
+	require.Len(t, mpd.Periods, 1)
+
+	// one adaptation set per rendition
+	sets := mpd.Periods[0].AdaptationSets
+	require.Len(t, sets, 2)
+	assert.Equal("video/mp2t", sets[0].MimeType)
+	require.Len(t, sets[0].Representations, 1)
+	rep := sets[0].Representations[0]
+	assert.Equal(p144.Name, rep.ID)
+	assert.Equal(256, rep.Width)
+	assert.Equal(144, rep.Height)
+	assert.Nil(rep.SegmentList.Initialization)
+	assert.Equal(uint64(0), rep.SegmentList.StartNumber)
+	assert.Equal([]MPDSegmentURL{{"p144/0.ts"}, {"p144/1.ts"}, {"p144/2.ts"}}, rep.SegmentList.SegmentURLs)
+	timeline := rep.SegmentList.SegmentTimeline.S
+	require.Len(t, timeline, 3)
+	assert.Equal(uint64(0), *timeline[0].T)
+	assert.Equal(uint64(2000), timeline[0].D)
+	assert.Nil(timeline[1].T)
+	assert.Equal(p240.Name, sets[1].Representations[0].ID)
+	assert.Equal(uint64(2500), sets[1].Representations[0].SegmentList.SegmentTimeline.S[0].D)
+
+	// segments sliding out of the window advance the timeline
+	for i := uint64(3); i < uint64(LIVE_LIST_LENGTH)+2; i++ {
+		require.Nil(t, c.InsertHLSSegment(p144, i, fmt.Sprintf("p144/%d.ts", i), 2))
+	}
+	rep = c.GetDASHManifest().Periods[0].AdaptationSets[0].Representations[0]
+	assert.Equal(uint64(2), rep.SegmentList.StartNumber)
+	assert.Equal(uint64(4000), *rep.SegmentList.SegmentTimeline.S[0].T)
+	assert.Len(rep.SegmentList.SegmentURLs, int(LIVE_LIST_LENGTH))
+	assert.Equal("p144/2.ts", rep.SegmentList.SegmentURLs[0].Media)
+
+	data, err := c.GetDASHManifest().Encode()
+	require.Nil(t, err)
+	assert.Contains(string(data), `<MPD xmlns="urn:mpeg:dash:schema:mpd:2011"`)
+	assert.Contains(string(data), `<S t="4000" d="2000"></S>`)
+}
+
+func TestGetDASHManifest_ConcurrentInsert(t *testing.T) {
+	c := NewBasicPlaylistManager(RandomManifestID(), nil)
+	p144 := &ffmpeg.P144p30fps16x9
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := uint64(0); i < 200; i++ {
+			require.Nil(t, c.InsertHLSSegment(p144, i, fmt.Sprintf("p144/%d.ts", i), 2))
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			mpd := c.GetDASHManifest()
+			require.NotNil(t, mpd)
+			list := mpd.Periods[0].AdaptationSets[0].Representations[0].SegmentList
+			assert.Len(t, list.SegmentURLs, len(list.SegmentTimeline.S))
+			assert.Equal(t, "p144/199.ts", list.SegmentURLs[len(list.SegmentURLs)-1].Media)
+			return
+		default:
+			c.GetDASHManifest()
+		}
+	}
+}
+
+func TestGetDASHManifest_FragmentedMP4(t *testing.T) {
+	assert := assert.New(t)
+	c := NewBasicPlaylistManager(RandomManifestID(), nil)
+	profile := &ffmpeg.P144p30fps16x9
+	c.SetHLSInitSegment(profile, "p144/init/abc.mp4")
+	require.Nil(t, c.InsertHLSSegment(profile, 0, "p144/0.m4s", 2))
+
+	mpd := c.GetDASHManifest()
+	require.NotNil(t, mpd)
+	assert.Equal(mpdProfileLive, mpd.Profiles)
+	set := mpd.Periods[0].AdaptationSets[0]
+	assert.Equal("video/mp4", set.MimeType)
+	assert.Equal(&MPDInitialization{SourceURL: "p144/init/abc.mp4"}, set.Representations[0].SegmentList.Initialization)
+}
@@ -0,0 +1,329 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/livepeer/go-livepeer/net"
+	"github.com/livepeer/lpms/ffmpeg"
+)
+
+var ErrUnknownVideoCodec = errors.New("ErrUnknownVideoCodec")
+var ErrUnknownEncoderProfile = errors.New("ErrUnknownEncoderProfile")
+var ErrInvalidVideoEncoding = errors.New("ErrInvalidVideoEncoding")
+
+// Highest constant rate factor accepted by the encoders
+const maxCRF = 63
+
+// VideoCodec is the video codec of a rendition
+type VideoCodec int
+
+const (
+	CodecH264 VideoCodec = iota
+	CodecH265
+	CodecVP9 // Only muxed into fragmented MP4
+)
+
+// ParseVideoCodec parses a user supplied video codec name. An empty name
+// maps to the default of H.264.
+func ParseVideoCodec(name string) (VideoCodec, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "h264", "avc":
+		return CodecH264, nil
+	case "h265", "hevc":
+		return CodecH265, nil
+	case "vp9":
+		return CodecVP9, nil
+	}
+	return CodecH264, ErrUnknownVideoCodec
+}
+
+func (c VideoCodec) String() string {
+	switch c {
+	case CodecH265:
+		return "h265"
+	case CodecVP9:
+		return "vp9"
+	}
+	return "h264"
+}
+
+// EncoderProfile is the H.264 profile a rendition is encoded with
+type EncoderProfile int
+
+const (
+	ProfileDefault EncoderProfile = iota // Chosen by the encoder
+	ProfileH264Baseline
+	ProfileH264Main
+	ProfileH264High
+)
+
+// ParseEncoderProfile parses a user supplied encoder profile name. An empty
+// name leaves the profile to the encoder.
+func ParseEncoderProfile(name string) (EncoderProfile, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "":
+		return ProfileDefault, nil
+	case "baseline":
+		return ProfileH264Baseline, nil
+	case "main":
+		return ProfileH264Main, nil
+	case "high":
+		return ProfileH264High, nil
+	}
+	return ProfileDefault, ErrUnknownEncoderProfile
+}
+
+func (p EncoderProfile) String() string {
+	switch p {
+	case ProfileH264Baseline:
+		return "baseline"
+	case ProfileH264Main:
+		return "main"
+	case ProfileH264High:
+		return "high"
+	}
+	return ""
+}
+
+// VideoEncoding describes how the video of a rendition is encoded. The zero
+// value is H.264 with the encoder's defaults, at the target bitrate.
+type VideoEncoding struct {
+	Codec   VideoCodec
+	Profile EncoderProfile
+	// Number of frames between keyframes; encoder default if zero
+	GOP int
+	// Constant rate factor; encodes at the target bitrate if zero
+	CRF int
+}
+
+// Validate checks the settings against each other and the codec
+func (e VideoEncoding) Validate() error {
+	if e.GOP < 0 || e.CRF < 0 || e.CRF > maxCRF {
+		return ErrInvalidVideoEncoding
+	}
+	if e.Profile != ProfileDefault && e.Codec != CodecH264 {
+		return ErrInvalidVideoEncoding
+	}
+	return nil
+}
+
+// Codecs returns the RFC 6381 codec of the video for HLS CODECS attributes,
+// or an empty string if it depends on the encoder's defaults. The level is
+// the lowest one that fits the profile's size, frame rate and bitrate.
+func (e VideoEncoding) Codecs(profile ffmpeg.VideoProfile) string {
+	if e.Codec == CodecH264 && e.Profile == ProfileDefault {
+		return ""
+	}
+	w, h, err := ffmpeg.VideoProfileResolution(profile)
+	if err != nil || w <= 0 || h <= 0 {
+		return ""
+	}
+	fps := int64(profile.Framerate)
+	if fps <= 0 {
+		fps = levelFramerate
+	}
+	kbps, _ := strconv.ParseInt(strings.Replace(profile.Bitrate, "k", "000", 1), 10, 64)
+	kbps /= 1000
+	switch e.Codec {
+	case CodecH265:
+		size := int64(w * h)
+		level := findLevel(hevcLevels, size, maxInt64(int64(w), int64(h)), size*fps, kbps)
+		return fmt.Sprintf("hvc1.1.6.L%d.90", level)
+	case CodecVP9:
+		size := int64(w * h)
+		return fmt.Sprintf("vp09.00.%02d.08", findLevel(vp9Levels, size, 0, size*fps, kbps))
+	}
+	// H.264 limits are in macroblocks, and higher for the High profile
+	mbW, mbH := int64((w+15)/16), int64((h+15)/16)
+	if e.Profile == ProfileH264High {
+		kbps = kbps * 4 / 5
+	}
+	level := findLevel(h264Levels, mbW*mbH, maxInt64(mbW, mbH), mbW*mbH*fps, kbps)
+	switch e.Profile {
+	case ProfileH264Baseline:
+		return fmt.Sprintf("avc1.42E0%02X", level)
+	case ProfileH264Main:
+		return fmt.Sprintf("avc1.4D40%02X", level)
+	}
+	return fmt.Sprintf("avc1.6400%02X", level)
+}
+
+// Frame rate assumed for levels of renditions keeping the source frame rate
+const levelFramerate = 60
+
+// codecLevel holds the limits of a codec level. Sizes are in luma samples,
+// or macroblocks for H.264.
+type codecLevel struct {
+	id            int
+	maxFrameSize  int64
+	maxSampleRate int64
+	maxKbps       int64
+}
+
+// H.264 levels from Table A-1 of ITU-T H.264, without level 1b
+var h264Levels = []codecLevel{
+	{10, 99, 1485, 64},
+	{11, 396, 3000, 192},
+	{12, 396, 6000, 384},
+	{13, 396, 11880, 768},
+	{20, 396, 11880, 2000},
+	{21, 792, 19800, 4000},
+	{22, 1620, 20250, 4000},
+	{30, 1620, 40500, 10000},
+	{31, 3600, 108000, 14000},
+	{32, 5120, 216000, 20000},
+	{40, 8192, 245760, 20000},
+	{41, 8192, 245760, 50000},
+	{42, 8704, 522240, 50000},
+	{50, 22080, 589824, 135000},
+	{51, 36864, 983040, 240000},
+	{52, 36864, 2073600, 240000},
+	{60, 139264, 4177920, 240000},
+	{61, 139264, 8355840, 480000},
+	{62, 139264, 16711680, 800000},
+}
+
+// HEVC Main tier levels from Table A.8 of ITU-T H.265. Ids are 30 times
+// the level number.
+var hevcLevels = []codecLevel{
+	{30, 36864, 552960, 128},
+	{60, 122880, 3686400, 1500},
+	{63, 245760, 7372800, 3000},
+	{90, 552960, 16588800, 6000},
+	{93, 983040, 33177600, 10000},
+	{120, 2228224, 66846720, 12000},
+	{123, 2228224, 133693440, 20000},
+	{150, 8912896, 267386880, 25000},
+	{153, 8912896, 534773760, 40000},
+	{156, 8912896, 1069547520, 60000},
+	{180, 35651584, 1069547520, 60000},
+	{183, 35651584, 2139095040, 120000},
+	{186, 35651584, 4278190080, 240000},
+}
+
+// VP9 levels from Annex A of the VP9 bitstream specification
+var vp9Levels = []codecLevel{
+	{10, 36864, 829440, 200},
+	{11, 73728, 2764800, 800},
+	{20, 122880, 4608000, 1800},
+	{21, 245760, 9216000, 3600},
+	{30, 552960, 20736000, 7200},
+	{31, 983040, 36864000, 12000},
+	{40, 2228224, 83558400, 18000},
+	{41, 2228224, 160432128, 30000},
+	{50, 8912896, 311951360, 60000},
+	{51, 8912896, 588251136, 120000},
+	{52, 8912896, 1176502272, 180000},
+	{60, 35651584, 1176502272, 180000},
+	{61, 35651584, 2353004544, 240000},
+	{62, 35651584, 4706009088, 480000},
+}
+
+// findLevel returns the lowest level within whose limits a video fits,
+// or the highest level if none. Frames with a side over sqrt(8 * max frame
+// size) exceed H.264 and HEVC levels; a zero side skips that check.
+func findLevel(levels []codecLevel, frameSize, side, sampleRate, kbps int64) int {
+	for _, l := range levels {
+		if frameSize <= l.maxFrameSize && side*side <= 8*l.maxFrameSize &&
+			sampleRate <= l.maxSampleRate && kbps <= l.maxKbps {
+			return l.id
+		}
+	}
+	return levels[len(levels)-1].id
+}
+
+func maxInt64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// flatten serializes the encoding settings of the i-th rendition so they
+// can be covered by segment signatures
+func (e VideoEncoding) flatten(i int) string {
+	return fmt.Sprintf("%d:%v:%v:%d:%d;", i, e.Codec, e.Profile, e.GOP, e.CRF)
+}
+
+// setNet sets the encoding fields of a protocol profile
+func (e VideoEncoding) setNet(p *net.VideoProfile) {
+	switch e.Codec {
+	case CodecH265:
+		p.Codec = net.VideoProfile_H265
+	case CodecVP9:
+		p.Codec = net.VideoProfile_VP9
+	}
+	switch e.Profile {
+	case ProfileH264Baseline:
+		p.Profile = net.VideoProfile_H264_BASELINE
+	case ProfileH264Main:
+		p.Profile = net.VideoProfile_H264_MAIN
+	case ProfileH264High:
+		p.Profile = net.VideoProfile_H264_HIGH
+	}
+	p.Gop = int32(e.GOP)
+	p.Crf = int32(e.CRF)
+}
+
+// netVideoEncoding returns the encoding settings of a protocol profile
+func netVideoEncoding(p *net.VideoProfile) VideoEncoding {
+	enc := VideoEncoding{GOP: int(p.Gop), CRF: int(p.Crf)}
+	switch p.Codec {
+	case net.VideoProfile_H265:
+		enc.Codec = CodecH265
+	case net.VideoProfile_VP9:
+		enc.Codec = CodecVP9
+	}
+	switch p.Profile {
+	case net.VideoProfile_H264_BASELINE:
+		enc.Profile = ProfileH264Baseline
+	case net.VideoProfile_H264_MAIN:
+		enc.Profile = ProfileH264Main
+	case net.VideoProfile_H264_HIGH:
+		enc.Profile = ProfileH264High
+	}
+	return enc
+}
+
+// videoEncoderOptions returns the encoder settings for the video of a
+// rendition. Default settings leave the encoder to the transcoder. H.264 is
+// also left to LPMS, which picks the encoder and scaling filters for the
+// acceleration; other codecs name their encoder.
+func videoEncoderOptions(e VideoEncoding, accel ffmpeg.Acceleration) ffmpeg.ComponentOptions {
+	if e == (VideoEncoding{}) {
+		return ffmpeg.ComponentOptions{}
+	}
+	nvidia := accel == ffmpeg.Nvidia
+	// LPMS only sets forced-idr when no options are given
+	opts := map[string]string{"forced-idr": "1"}
+	enc := ffmpeg.ComponentOptions{Opts: opts}
+	switch e.Codec {
+	case CodecH265:
+		enc.Name = "libx265"
+		if nvidia {
+			enc.Name = "hevc_nvenc"
+		}
+	case CodecVP9:
+		// No hardware encoder
+		enc.Name = "libvpx-vp9"
+		delete(opts, "forced-idr")
+	}
+	if e.Profile != ProfileDefault {
+		opts["profile"] = e.Profile.String()
+	}
+	if e.GOP > 0 {
+		opts["g"] = fmt.Sprint(e.GOP)
+	}
+	if e.CRF > 0 {
+		if nvidia && e.Codec != CodecVP9 {
+			opts["rc"] = "vbr"
+			opts["cq"] = fmt.Sprint(e.CRF)
+		} else {
+			opts["crf"] = fmt.Sprint(e.CRF)
+		}
+	}
+	return enc
+}
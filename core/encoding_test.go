@@ -0,0 +1,98 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/livepeer/lpms/ffmpeg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseVideoCodec(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		name  string
+		codec VideoCodec
+	}{
+		{"", CodecH264},
+		{"H264", CodecH264},
+		{"avc", CodecH264},
+		{"h265", CodecH265},
+		{" HEVC ", CodecH265},
+		{"vp9", CodecVP9},
+	}
+	for _, tt := range tests {
+		codec, err := ParseVideoCodec(tt.name)
+		assert.Nil(err)
+		assert.Equal(tt.codec, codec)
+	}
+
+	_, err := ParseVideoCodec("av1")
+	assert.Equal(ErrUnknownVideoCodec, err)
+}
+
+func TestParseEncoderProfile(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, p := range []EncoderProfile{ProfileDefault, ProfileH264Baseline, ProfileH264Main, ProfileH264High} {
+		parsed, err := ParseEncoderProfile(p.String())
+		assert.Nil(err)
+		assert.Equal(p, parsed)
+	}
+	p, err := ParseEncoderProfile("High")
+	assert.Nil(err)
+	assert.Equal(ProfileH264High, p)
+
+	_, err = ParseEncoderProfile("extended")
+	assert.Equal(ErrUnknownEncoderProfile, err)
+}
+
+func TestVideoEncoding_Validate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Nil(VideoEncoding{}.Validate())
+	assert.Nil(VideoEncoding{Profile: ProfileH264Main, GOP: 60, CRF: 23}.Validate())
+	assert.Nil(VideoEncoding{Codec: CodecVP9, CRF: 63}.Validate())
+
+	for _, invalid := range []VideoEncoding{
+		{GOP: -1},
+		{CRF: -1},
+		{CRF: 64},
+		{Codec: CodecH265, Profile: ProfileH264High},
+	} {
+		assert.Equal(ErrInvalidVideoEncoding, invalid.Validate(), invalid)
+	}
+}
+
+func TestVideoEncoding_Codecs(t *testing.T) {
+	assert := assert.New(t)
+
+	hd := ffmpeg.VideoProfile{Resolution: "1280x720", Bitrate: "3000k", Framerate: 30}
+	fullHD := ffmpeg.VideoProfile{Resolution: "1920x1080", Bitrate: "6000000", Framerate: 60}
+	tests := []struct {
+		enc     VideoEncoding
+		profile ffmpeg.VideoProfile
+		codecs  string
+	}{
+		// Left to the encoder
+		{VideoEncoding{}, hd, ""},
+		{VideoEncoding{GOP: 30}, hd, ""},
+		{VideoEncoding{Profile: ProfileH264Main}, ffmpeg.VideoProfile{Resolution: "invalid"}, ""},
+
+		{VideoEncoding{Profile: ProfileH264Baseline}, hd, "avc1.42E01F"},
+		{VideoEncoding{Profile: ProfileH264Main}, fullHD, "avc1.4D402A"},
+		// The source frame rate is assumed to be at most 60fps
+		{VideoEncoding{Profile: ProfileH264High}, ffmpeg.VideoProfile{Resolution: "1920x1080", Bitrate: "6000k"}, "avc1.64002A"},
+		// High profile allows higher bitrates
+		{VideoEncoding{Profile: ProfileH264Main}, ffmpeg.VideoProfile{Resolution: "1280x720", Bitrate: "17000k", Framerate: 30}, "avc1.4D4020"},
+		{VideoEncoding{Profile: ProfileH264High}, ffmpeg.VideoProfile{Resolution: "1280x720", Bitrate: "17000k", Framerate: 30}, "avc1.64001F"},
+		{VideoEncoding{Codec: CodecH265}, hd, "hvc1.1.6.L93.90"},
+		{VideoEncoding{Codec: CodecH265}, ffmpeg.VideoProfile{Resolution: "3840x2160", Bitrate: "20000k", Framerate: 30}, "hvc1.1.6.L150.90"},
+		{VideoEncoding{Codec: CodecVP9}, hd, "vp09.00.31.08"},
+		// Beyond the highest level
+		{VideoEncoding{Profile: ProfileH264High}, ffmpeg.VideoProfile{Resolution: "16384x16384", Bitrate: "1000k"}, "avc1.64003E"},
+	}
+	for _, tt := range tests {
+		assert.Equal(tt.codecs, tt.enc.Codecs(tt.profile), tt.profile.Resolution)
+	}
+}
@@ -0,0 +1,126 @@
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+var ErrUnknownFormat = errors.New("ErrUnknownFormat")
+var ErrMalformedMP4 = errors.New("ErrMalformedMP4")
+
+// SegmentFormat is the container format of a media segment
+type SegmentFormat int
+
+const (
+	FormatMPEGTS SegmentFormat = iota
+	FormatMP4                  // Fragmented MP4 / CMAF
+)
+
+// ParseSegmentFormat parses a user supplied container name. An empty name
+// maps to the default of MPEG-TS.
+func ParseSegmentFormat(name string) (SegmentFormat, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "ts", "mpegts":
+		return FormatMPEGTS, nil
+	case "mp4", "fmp4", "cmaf":
+		return FormatMP4, nil
+	}
+	return FormatMPEGTS, ErrUnknownFormat
+}
+
+// SegmentFormatFromExt returns the format of a segment given its file extension
+func SegmentFormatFromExt(ext string) (SegmentFormat, bool) {
+	switch strings.ToLower(ext) {
+	case ".ts":
+		return FormatMPEGTS, true
+	case ".mp4", ".m4s":
+		return FormatMP4, true
+	}
+	return FormatMPEGTS, false
+}
+
+func (f SegmentFormat) String() string {
+	switch f {
+	case FormatMP4:
+		return "mp4"
+	}
+	return "mpegts"
+}
+
+// Ext returns the file extension for complete segments of the format
+func (f SegmentFormat) Ext() string {
+	switch f {
+	case FormatMP4:
+		return ".mp4"
+	}
+	return ".ts"
+}
+
+// MediaExt returns the file extension for the media section of segments of
+// the format, as referenced from playlists. Fragmented MP4 media is stored
+// apart from its initialization section, as a CMAF fragment.
+func (f SegmentFormat) MediaExt() string {
+	switch f {
+	case FormatMP4:
+		return ".m4s"
+	}
+	return ".ts"
+}
+
+// ContentType returns the MIME type for segments of the format
+func (f SegmentFormat) ContentType() string {
+	switch f {
+	case FormatMP4:
+		return "video/mp4"
+	}
+	return "video/MP2T"
+}
+
+// DASHMimeType returns the MIME type used in DASH manifests for segments
+// of the format
+func (f SegmentFormat) DASHMimeType() string {
+	switch f {
+	case FormatMP4:
+		return "video/mp4"
+	}
+	return "video/mp2t"
+}
+
+// SplitFMP4 splits a self-contained fragmented MP4 segment into its
+// initialization section (ftyp + moov) and its media section (any
+// styp / sidx boxes and the moof + mdat pairs that follow). If the segment
+// carries no initialization section, the returned init is nil.
+func SplitFMP4(data []byte) ([]byte, []byte, error) {
+	offset := 0
+	for offset < len(data) {
+		if len(data)-offset < 8 {
+			return nil, nil, ErrMalformedMP4
+		}
+		size := uint64(binary.BigEndian.Uint32(data[offset:]))
+		typ := string(data[offset+4 : offset+8])
+		switch size {
+		case 0:
+			// box extends to the end of the data
+			size = uint64(len(data) - offset)
+		case 1:
+			if len(data)-offset < 16 {
+				return nil, nil, ErrMalformedMP4
+			}
+			size = binary.BigEndian.Uint64(data[offset+8:])
+		}
+		if size < 8 || size > uint64(len(data)-offset) {
+			return nil, nil, ErrMalformedMP4
+		}
+		switch typ {
+		case "styp", "sidx", "moof", "mdat":
+			if offset == 0 {
+				return nil, data, nil
+			}
+			return data[:offset], data[offset:], nil
+		}
+		offset += int(size)
+	}
+	// Only an initialization section; no media
+	return data, nil, nil
+}
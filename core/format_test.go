@@ -0,0 +1,103 @@
+package core
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func mp4Box(typ string, payload []byte) []byte {
+	box := make([]byte, 8+len(payload))
+	binary.BigEndian.PutUint32(box, uint32(len(box)))
+	copy(box[4:], typ)
+	copy(box[8:], payload)
+	return box
+}
+
+func TestSplitFMP4(t *testing.T) {
+	assert := assert.New(t)
+
+	ftyp := mp4Box("ftyp", []byte("iso5"))
+	moov := mp4Box("moov", []byte("movie"))
+	moof := mp4Box("moof", []byte("fragment"))
+	mdat := mp4Box("mdat", []byte("data"))
+	join := func(boxes ...[]byte) []byte {
+		var b []byte
+		for _, v := range boxes {
+			b = append(b, v...)
+		}
+		return b
+	}
+
+	// Self-contained segment
+	initData, media, err := SplitFMP4(join(ftyp, moov, moof, mdat))
+	assert.Nil(err)
+	assert.Equal(join(ftyp, moov), initData)
+	assert.Equal(join(moof, mdat), media)
+
+	// Media only
+	initData, media, err = SplitFMP4(join(moof, mdat))
+	assert.Nil(err)
+	assert.Nil(initData)
+	assert.Equal(join(moof, mdat), media)
+
+	// Init only
+	initData, media, err = SplitFMP4(join(ftyp, moov))
+	assert.Nil(err)
+	assert.Equal(join(ftyp, moov), initData)
+	assert.Nil(media)
+
+	// Truncated box
+	_, _, err = SplitFMP4(join(ftyp, moov)[:10])
+	assert.Equal(ErrMalformedMP4, err)
+
+	// Box size larger than data
+	bad := mp4Box("moov", []byte("movie"))
+	binary.BigEndian.PutUint32(bad, 100)
+	_, _, err = SplitFMP4(join(ftyp, bad))
+	assert.Equal(ErrMalformedMP4, err)
+
+	// Extended size box
+	large := make([]byte, 16+4)
+	binary.BigEndian.PutUint32(large, 1)
+	copy(large[4:], "moov")
+	binary.BigEndian.PutUint64(large[8:], uint64(len(large)))
+	initData, media, err = SplitFMP4(join(ftyp, large, moof))
+	assert.Nil(err)
+	assert.Equal(join(ftyp, large), initData)
+	assert.Equal(moof, media)
+}
+
+func TestSegmentFormat(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, name := range []string{"", "ts", "MPEGTS"} {
+		f, err := ParseSegmentFormat(name)
+		assert.Nil(err)
+		assert.Equal(FormatMPEGTS, f)
+	}
+	for _, name := range []string{"mp4", "fMP4", "cmaf"} {
+		f, err := ParseSegmentFormat(name)
+		assert.Nil(err)
+		assert.Equal(FormatMP4, f)
+	}
+	_, err := ParseSegmentFormat("flv")
+	assert.Equal(ErrUnknownFormat, err)
+
+	f, ok := SegmentFormatFromExt(".m4s")
+	assert.True(ok)
+	assert.Equal(FormatMP4, f)
+	f, ok = SegmentFormatFromExt(".ts")
+	assert.True(ok)
+	assert.Equal(FormatMPEGTS, f)
+	_, ok = SegmentFormatFromExt(".m3u8")
+	assert.False(ok)
+
+	assert.Equal(".mp4", FormatMP4.Ext())
+	assert.Equal(".m4s", FormatMP4.MediaExt())
+	assert.Equal("video/mp4", FormatMP4.ContentType())
+	assert.Equal(".ts", FormatMPEGTS.Ext())
+	assert.Equal(".ts", FormatMPEGTS.MediaExt())
+	assert.Equal("video/MP2T", FormatMPEGTS.ContentType())
+}
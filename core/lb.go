@@ -45,8 +45,9 @@ func NewLoadBalancingTranscoder(devices string, newTranscoderFn newTranscoderFn)
 	}
 }
 
-func (lb *LoadBalancingTranscoder) Transcode(job string, fname string, profiles []ffmpeg.VideoProfile) (*TranscodeData, error) {
+func (lb *LoadBalancingTranscoder) Transcode(md *SegTranscodingMetadata) (*TranscodeData, error) {
 
+	job := string(md.ManifestID)
 	lb.mu.RLock()
 	session, exists := lb.sessions[job]
 	lb.mu.RUnlock()
@@ -54,15 +55,15 @@ func (lb *LoadBalancingTranscoder) Transcode(job string, fname string, profiles
 		glog.V(common.DEBUG).Info("LB: Using existing transcode session for ", session.key)
 	} else {
 		var err error
-		session, err = lb.createSession(job, fname, profiles)
+		session, err = lb.createSession(job, md.Profiles)
 		if err != nil {
 			return nil, err
 		}
 	}
-	return session.Transcode(job, fname, profiles)
+	return session.Transcode(md)
 }
 
-func (lb *LoadBalancingTranscoder) createSession(job string, fname string, profiles []ffmpeg.VideoProfile) (*transcoderSession, error) {
+func (lb *LoadBalancingTranscoder) createSession(job string, profiles []ffmpeg.VideoProfile) (*transcoderSession, error) {
 
 	lb.mu.Lock()
 	defer lb.mu.Unlock()
@@ -125,10 +126,8 @@ func (lb *LoadBalancingTranscoder) leastLoaded() string {
 }
 
 type transcoderParams struct {
-	job      string
-	fname    string
-	profiles []ffmpeg.VideoProfile
-	res      chan struct {
+	md  *SegTranscodingMetadata
+	res chan struct {
 		*TranscodeData
 		error
 	}
@@ -177,8 +176,7 @@ func (sess *transcoderSession) loop() {
 			return
 		case params := <-sess.sender:
 			cancel()
-			res, err :=
-				sess.transcoder.Transcode(params.job, params.fname, params.profiles)
+			res, err := sess.transcoder.Transcode(params.md)
 			params.res <- struct {
 				*TranscodeData
 				error
@@ -191,8 +189,8 @@ func (sess *transcoderSession) loop() {
 	}
 }
 
-func (sess *transcoderSession) Transcode(job string, fname string, profiles []ffmpeg.VideoProfile) (*TranscodeData, error) {
-	params := &transcoderParams{job: job, fname: fname, profiles: profiles,
+func (sess *transcoderSession) Transcode(md *SegTranscodingMetadata) (*TranscodeData, error) {
+	params := &transcoderParams{md: md,
 		res: make(chan struct {
 			*TranscodeData
 			error
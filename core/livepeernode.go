@@ -22,6 +22,7 @@ import (
 
 	"github.com/livepeer/go-livepeer/common"
 	"github.com/livepeer/go-livepeer/eth"
+	"github.com/livepeer/go-livepeer/net"
 )
 
 var ErrTranscoderAvail = errors.New("ErrTranscoderUnavailable")
@@ -59,6 +60,7 @@ type LivepeerNode struct {
 	OrchSecret        string
 	Transcoder        Transcoder
 	TranscoderManager *RemoteTranscoderManager
+	TranscoderTokens  *TranscoderTokens
 	Balances          *AddressBalances
 	ErrorMonitor      *errorMonitor
 
@@ -70,7 +72,12 @@ type LivepeerNode struct {
 	// Transcoder private fields
 	priceInfo    *big.Rat
 	serviceURI   url.URL
+	capabilities *net.Capabilities
 	segmentMutex *sync.RWMutex
+	// Estimated rendition pixels per second of each stream being
+	// transcoded, and their total. Protected by segmentMutex.
+	segmentCosts map[ManifestID]int64
+	pixelLoad    int64
 }
 
 //NewLivepeerNode creates a new Livepeer Node. Eth can be nil.
@@ -82,6 +89,7 @@ func NewLivepeerNode(e eth.LivepeerEthClient, wd string, dbh *common.DB) (*Livep
 		Database:     dbh,
 		SegmentChans: make(map[ManifestID]SegmentChan),
 		segmentMutex: &sync.RWMutex{},
+		segmentCosts: make(map[ManifestID]int64),
 	}, nil
 }
 
@@ -110,3 +118,28 @@ func (n *LivepeerNode) GetBasePrice() *big.Rat {
 	defer n.mu.RUnlock()
 	return n.priceInfo
 }
+
+// SetCapabilities sets the transcoding capabilities of the node's own transcoder
+func (n *LivepeerNode) SetCapabilities(caps *net.Capabilities) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.capabilities = caps
+}
+
+// Capabilities returns the transcoding capabilities of the node. Nodes that
+// hand segments off to remote transcoders only advertise the capabilities
+// shared by all of them.
+func (n *LivepeerNode) Capabilities() *net.Capabilities {
+	n.mu.RLock()
+	caps := n.capabilities
+	n.mu.RUnlock()
+	if n.TranscoderManager != nil && n.Transcoder == n.TranscoderManager {
+		if remote := n.TranscoderManager.Capabilities(); remote != nil {
+			return remote
+		}
+	}
+	if caps == nil {
+		return DefaultCapabilities(false)
+	}
+	return caps
+}
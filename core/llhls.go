@@ -0,0 +1,408 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"path"
+	"sync"
+	"time"
+)
+
+// Target duration, in seconds, of the full segments assembled from
+// low-latency HLS parts. Each transcoded segment becomes one part, so the
+// part duration, and with it the latency, follows the ingested segments.
+var LLHLSSegmentDuration = 6.0
+
+// Number of full segments kept in a low-latency media playlist
+const LLHLS_LIST_LENGTH = 12
+
+// Number of trailing full segments that keep their parts listed
+const llhlsPartSegments = 3
+
+var ErrLLHLSDisabled = errors.New("ErrLLHLSDisabled")
+var ErrLLHLSBadRequest = errors.New("ErrLLHLSBadRequest")
+var ErrLLHLSTimeout = errors.New("ErrLLHLSTimeout")
+
+// LLHLSRequest holds the delivery directives of a low-latency playlist request
+type LLHLSRequest struct {
+	// Media sequence number to block for (_HLS_msn); negative if absent
+	MSN int64
+	// Part index within MSN to block for (_HLS_part); negative if absent
+	Part int64
+	// Whether a delta update was requested (_HLS_skip=YES)
+	Skip bool
+}
+
+type llhlsPart struct {
+	seqNo       uint64
+	uri         string // where the part is stored
+	duration    float64
+	initURI     string
+	independent bool
+}
+
+type llhlsSegment struct {
+	msn      uint64
+	uri      string
+	duration float64
+	initURI  string
+	parts    []llhlsPart
+	// Whether all parts of the segment went missing
+	gap bool
+}
+
+// llhlsPlaylist is the low-latency media playlist of a single rendition.
+// Parts are numbered after the segments they were made from: with n parts
+// per full segment, segment seqNo is part seqNo%n of the full segment with
+// media sequence number seqNo/n. Every rendition thus numbers a part the
+// same, and the URI of a part is known before it arrives.
+type llhlsPlaylist struct {
+	// Serializes inserts; held while a full segment is being assembled
+	insertLock sync.Mutex
+	// Prefix of the URIs the parts are served at
+	base string
+	// Number of parts per full segment
+	n uint64
+
+	mu       sync.Mutex
+	segments []*llhlsSegment
+	pending  []llhlsPart // parts of the in-progress segment
+	nextMSN  uint64
+	// Sequence number of the next part to publish, once started
+	next    uint64
+	started bool
+	// Set once the in-progress segment has all its parts and is being
+	// assembled; later parts are held until it is complete
+	closing bool
+	// Parts that arrived ahead of the next one, by sequence number
+	held map[uint64]llhlsPart
+	ext  string
+	// Closed and replaced whenever the playlist changes
+	updated chan struct{}
+}
+
+func newLLHLSPlaylist(base string, n uint64) *llhlsPlaylist {
+	return &llhlsPlaylist{
+		base:    base,
+		n:       n,
+		held:    make(map[uint64]llhlsPart),
+		updated: make(chan struct{}),
+	}
+}
+
+// llhlsPartsPerSegment returns how many parts of the given duration make
+// up a full segment
+func llhlsPartsPerSegment(duration float64) uint64 {
+	if duration <= 0 {
+		return 1
+	}
+	return uint64(math.Max(1, math.Round(LLHLSSegmentDuration/duration)))
+}
+
+func (pl *llhlsPlaylist) notify() {
+	close(pl.updated)
+	pl.updated = make(chan struct{})
+}
+
+// partURI returns the URI the part with the given sequence number is
+// served at
+func (pl *llhlsPlaylist) partURI(seqNo uint64) string {
+	return fmt.Sprintf("%s/%d.%d%s", pl.base, seqNo/pl.n, seqNo%pl.n, pl.ext)
+}
+
+// addPart adds a part to the playlist. Parts are published in order of
+// their sequence numbers; a part that arrives early is held until those
+// before it arrive, or until a part of a later full segment arrives, in
+// which case the missing ones are skipped. If the in-progress segment has
+// all its parts, they are returned with its MSN for assembly.
+func (pl *llhlsPlaylist) addPart(part llhlsPart) ([]llhlsPart, uint64) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	if !pl.started {
+		pl.started = true
+		pl.next, pl.nextMSN = part.seqNo, part.seqNo/pl.n
+		pl.ext = path.Ext(part.uri)
+	}
+	if part.seqNo < pl.next {
+		// Too late, the part has been skipped
+		return nil, pl.nextMSN
+	}
+	pl.held[part.seqNo] = part
+	return pl.publish()
+}
+
+// publish moves the held parts that are next in order into the playlist.
+// Must be called with the lock held.
+func (pl *llhlsPlaylist) publish() ([]llhlsPart, uint64) {
+	defer pl.notify()
+	for !pl.closing {
+		part, ok := pl.held[pl.next]
+		if ok {
+			delete(pl.held, pl.next)
+			pl.pending = append(pl.pending, part)
+		} else if !pl.heldFrom(pl.next + pl.n) {
+			break
+		}
+		pl.next++
+		if pl.next%pl.n != 0 {
+			continue
+		}
+		if len(pl.pending) > 0 {
+			pl.closing = true
+			break
+		}
+		// Every part of the segment is missing
+		pl.appendSegment(&llhlsSegment{
+			msn:      pl.nextMSN,
+			uri:      pl.partURI(pl.nextMSN * pl.n),
+			duration: float64(pl.n) * pl.partTarget(),
+			gap:      true,
+		})
+	}
+	if !pl.closing {
+		return nil, pl.nextMSN
+	}
+	return append([]llhlsPart(nil), pl.pending...), pl.nextMSN
+}
+
+// heldFrom checks whether a part at or after seqNo is held. Must be called
+// with the lock held.
+func (pl *llhlsPlaylist) heldFrom(seqNo uint64) bool {
+	for s := range pl.held {
+		if s >= seqNo {
+			return true
+		}
+	}
+	return false
+}
+
+// completeSegment moves the parts of the in-progress segment into a full
+// segment available at uri, then publishes the parts held meanwhile. Like
+// addPart, it returns the parts of the next segment if that is complete too.
+func (pl *llhlsPlaylist) completeSegment(uri string, parts []llhlsPart) ([]llhlsPart, uint64) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	seg := &llhlsSegment{msn: pl.nextMSN, uri: uri, parts: parts, initURI: parts[0].initURI}
+	for _, p := range parts {
+		seg.duration += p.duration
+	}
+	pl.appendSegment(seg)
+	pl.pending = nil
+	pl.closing = false
+	return pl.publish()
+}
+
+// appendSegment adds a full segment, sliding the oldest one out of the
+// playlist if it is full. Must be called with the lock held.
+func (pl *llhlsPlaylist) appendSegment(seg *llhlsSegment) {
+	pl.segments = append(pl.segments, seg)
+	if len(pl.segments) > LLHLS_LIST_LENGTH {
+		pl.segments = pl.segments[len(pl.segments)-LLHLS_LIST_LENGTH:]
+	}
+	pl.nextMSN++
+}
+
+// part returns the storage URI of a published part, or an empty string if
+// the part was skipped or slid out of the playlist. Must be called with the
+// lock held.
+func (pl *llhlsPlaylist) part(seqNo uint64) string {
+	for _, p := range pl.pending {
+		if p.seqNo == seqNo {
+			return p.uri
+		}
+	}
+	for _, s := range pl.segments {
+		for _, p := range s.parts {
+			if p.seqNo == seqNo {
+				return p.uri
+			}
+		}
+	}
+	return ""
+}
+
+func (pl *llhlsPlaylist) targetDuration() float64 {
+	target := LLHLSSegmentDuration
+	for _, s := range pl.segments {
+		target = math.Max(target, s.duration)
+	}
+	return math.Ceil(target)
+}
+
+func (pl *llhlsPlaylist) partTarget() float64 {
+	target := 0.0
+	for _, s := range pl.segments {
+		for _, p := range s.parts {
+			target = math.Max(target, p.duration)
+		}
+	}
+	for _, p := range pl.pending {
+		target = math.Max(target, p.duration)
+	}
+	return target
+}
+
+// ready checks whether the playlist satisfies the blocking request.
+// Must be called with the lock held.
+func (pl *llhlsPlaylist) ready(req LLHLSRequest) (bool, error) {
+	if req.MSN < 0 {
+		if req.Part >= 0 {
+			return false, ErrLLHLSBadRequest
+		}
+		return true, nil
+	}
+	if req.Part >= int64(pl.n) {
+		return false, ErrLLHLSBadRequest
+	}
+	if !pl.started {
+		return false, nil
+	}
+	msn := uint64(req.MSN)
+	if msn > pl.nextMSN+1 {
+		// More than two segments beyond the last one in the playlist
+		return false, ErrLLHLSBadRequest
+	}
+	if msn < pl.nextMSN {
+		return true, nil
+	}
+	// Parts that were skipped count as available
+	return msn == pl.nextMSN && req.Part >= 0 && pl.next > msn*pl.n+uint64(req.Part), nil
+}
+
+// block waits until cond is satisfied by the playlist, for at most three
+// target durations, and returns with the lock held
+func (pl *llhlsPlaylist) block(ctx context.Context, cond func() (bool, error)) error {
+	pl.mu.Lock()
+	timeout := time.Duration(3 * pl.targetDuration() * float64(time.Second))
+	pl.mu.Unlock()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for {
+		pl.mu.Lock()
+		ok, err := cond()
+		if err != nil {
+			pl.mu.Unlock()
+			return err
+		}
+		if ok {
+			return nil
+		}
+		updated := pl.updated
+		pl.mu.Unlock()
+		select {
+		case <-updated:
+		case <-ctx.Done():
+			return ErrLLHLSTimeout
+		}
+	}
+}
+
+// wait blocks until the playlist satisfies the request, then encodes it
+func (pl *llhlsPlaylist) wait(ctx context.Context, req LLHLSRequest) ([]byte, error) {
+	err := pl.block(ctx, func() (bool, error) { return pl.ready(req) })
+	if err != nil {
+		return nil, err
+	}
+	defer pl.mu.Unlock()
+	return pl.encode(req.Skip), nil
+}
+
+// waitPart blocks until the part is published, as it may be requested
+// ahead of time from the preload hint, then returns its storage URI
+func (pl *llhlsPlaylist) waitPart(ctx context.Context, msn, part uint64) (string, error) {
+	if part >= pl.n {
+		return "", nil
+	}
+	seqNo := msn*pl.n + part
+	err := pl.block(ctx, func() (bool, error) {
+		if !pl.started {
+			return false, nil
+		}
+		if msn > pl.nextMSN+1 {
+			return false, ErrLLHLSBadRequest
+		}
+		return pl.next > seqNo, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	defer pl.mu.Unlock()
+	return pl.part(seqNo), nil
+}
+
+// encode renders the playlist. Must be called with the lock held.
+func (pl *llhlsPlaylist) encode(skip bool) []byte {
+	target := pl.targetDuration()
+	partTarget := pl.partTarget()
+	skipUntil := 6 * target
+
+	buf := &bytes.Buffer{}
+	buf.WriteString("#EXTM3U\n")
+	buf.WriteString("#EXT-X-VERSION:9\n")
+	fmt.Fprintf(buf, "#EXT-X-TARGETDURATION:%d\n", int(target))
+	fmt.Fprintf(buf, "#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES,CAN-SKIP-UNTIL=%.1f,PART-HOLD-BACK=%.3f\n",
+		skipUntil, 3*partTarget)
+	fmt.Fprintf(buf, "#EXT-X-PART-INF:PART-TARGET=%.3f\n", partTarget)
+	msn := pl.nextMSN
+	if len(pl.segments) > 0 {
+		msn = pl.segments[0].msn
+	}
+	fmt.Fprintf(buf, "#EXT-X-MEDIA-SEQUENCE:%d\n", msn)
+
+	skipped := 0
+	if skip {
+		// Segments that start more than skipUntil seconds before the end
+		// of the playlist are replaced by a single EXT-X-SKIP tag
+		remaining := 0.0
+		for _, s := range pl.segments {
+			remaining += s.duration
+		}
+		for _, s := range pl.segments {
+			if remaining <= skipUntil {
+				break
+			}
+			remaining -= s.duration
+			skipped++
+		}
+		if skipped > 0 {
+			fmt.Fprintf(buf, "#EXT-X-SKIP:SKIPPED-SEGMENTS=%d\n", skipped)
+		}
+	}
+
+	initURI := ""
+	writeMap := func(uri string) {
+		if uri != "" && uri != initURI {
+			fmt.Fprintf(buf, "#EXT-X-MAP:URI=\"%s\"\n", uri)
+		}
+		initURI = uri
+	}
+	writeParts := func(parts []llhlsPart) {
+		for _, p := range parts {
+			writeMap(p.initURI)
+			fmt.Fprintf(buf, "#EXT-X-PART:DURATION=%.3f,URI=\"%s\"", p.duration, pl.partURI(p.seqNo))
+			if p.independent {
+				buf.WriteString(",INDEPENDENT=YES")
+			}
+			buf.WriteString("\n")
+		}
+	}
+	for i, s := range pl.segments[skipped:] {
+		if s.gap {
+			fmt.Fprintf(buf, "#EXT-X-GAP\n#EXTINF:%.3f,\n%s\n", s.duration, s.uri)
+			continue
+		}
+		if skipped+i >= len(pl.segments)-llhlsPartSegments {
+			writeParts(s.parts)
+		}
+		writeMap(s.initURI)
+		fmt.Fprintf(buf, "#EXTINF:%.3f,\n%s\n", s.duration, s.uri)
+	}
+	writeParts(pl.pending)
+	if pl.started {
+		fmt.Fprintf(buf, "#EXT-X-PRELOAD-HINT:TYPE=PART,URI=\"%s\"\n", pl.partURI(pl.next))
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,285 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/livepeer/go-livepeer/drivers"
+	ffmpeg "github.com/livepeer/lpms/ffmpeg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newLLHLSManager(t *testing.T) (*BasicPlaylistManager, drivers.OSSession) {
+	sess := drivers.NewMemoryDriver(nil).NewSession("llhls")
+	mgr := NewBasicPlaylistManager("llhls", sess)
+	mgr.EnableLowLatencyHLS()
+	require.True(t, mgr.LowLatencyHLS())
+	return mgr, sess
+}
+
+func insertLLHLSPart(t *testing.T, mgr *BasicPlaylistManager, sess drivers.OSSession, profile *ffmpeg.VideoProfile, seqNo uint64, duration float64) string {
+	uri, err := sess.SaveData(fmt.Sprintf("%s/%d.ts", profile.Name, seqNo), []byte(fmt.Sprintf("part%d;", seqNo)))
+	require.Nil(t, err)
+	require.Nil(t, mgr.InsertHLSPart(profile, seqNo, uri, duration, true))
+	return uri
+}
+
+func TestLLHLS_Disabled(t *testing.T) {
+	mgr := NewBasicPlaylistManager("llhls", nil)
+	assert.False(t, mgr.LowLatencyHLS())
+	assert.Equal(t, ErrLLHLSDisabled, mgr.InsertHLSPart(&ffmpeg.P144p30fps16x9, 0, "a.ts", 2, true))
+	_, err := mgr.GetLLHLSMediaPlaylist(context.Background(), "P144p30fps16x9", LLHLSRequest{MSN: -1, Part: -1})
+	assert.Equal(t, ErrLLHLSDisabled, err)
+}
+
+func TestLLHLS_PartsAndSegments(t *testing.T) {
+	assert := assert.New(t)
+	defer func(d float64) { LLHLSSegmentDuration = d }(LLHLSSegmentDuration)
+	LLHLSSegmentDuration = 6.0
+	mgr, sess := newLLHLSManager(t)
+	profile := &ffmpeg.P144p30fps16x9
+	noBlock := LLHLSRequest{MSN: -1, Part: -1}
+
+	// unknown rendition
+	pl, err := mgr.GetLLHLSMediaPlaylist(context.Background(), profile.Name, noBlock)
+	assert.Nil(err)
+	assert.Nil(pl)
+
+	// parts of an in-progress segment
+	insertLLHLSPart(t, mgr, sess, profile, 0, 2)
+	insertLLHLSPart(t, mgr, sess, profile, 1, 2)
+	pl, err = mgr.GetLLHLSMediaPlaylist(context.Background(), profile.Name, noBlock)
+	require.Nil(t, err)
+	assert.Equal(`#EXTM3U
+#EXT-X-VERSION:9
+#EXT-X-TARGETDURATION:6
+#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES,CAN-SKIP-UNTIL=36.0,PART-HOLD-BACK=6.000
+#EXT-X-PART-INF:PART-TARGET=2.000
+#EXT-X-MEDIA-SEQUENCE:0
+#EXT-X-PART:DURATION=2.000,URI="/stream/llhls/P144p30fps16x9/part/0.0.ts",INDEPENDENT=YES
+#EXT-X-PART:DURATION=2.000,URI="/stream/llhls/P144p30fps16x9/part/0.1.ts",INDEPENDENT=YES
+#EXT-X-PRELOAD-HINT:TYPE=PART,URI="/stream/llhls/P144p30fps16x9/part/0.2.ts"
+`, string(pl))
+	assert.Nil(mgr.GetHLSMediaPlaylist(profile.Name).Segments[0])
+
+	// reaching the target duration assembles a full segment from the parts
+	insertLLHLSPart(t, mgr, sess, profile, 2, 2)
+	pl, err = mgr.GetLLHLSMediaPlaylist(context.Background(), profile.Name, noBlock)
+	require.Nil(t, err)
+	assert.Contains(string(pl), `#EXT-X-PART:DURATION=2.000,URI="/stream/llhls/P144p30fps16x9/part/0.2.ts",INDEPENDENT=YES
+#EXTINF:6.000,
+/stream/llhls/P144p30fps16x9/seg/0.ts
+#EXT-X-PRELOAD-HINT:TYPE=PART,URI="/stream/llhls/P144p30fps16x9/part/1.0.ts"
+`)
+	mem := sess.(*drivers.MemorySession)
+	assert.Equal("part0;part1;part2;", string(mem.GetData("/stream/llhls/P144p30fps16x9/seg/0.ts")))
+
+	// the regular media playlist only carries full segments
+	mpl := mgr.GetHLSMediaPlaylist(profile.Name)
+	require.NotNil(t, mpl.Segments[0])
+	assert.Equal("/stream/llhls/P144p30fps16x9/seg/0.ts", mpl.Segments[0].URI)
+	assert.Equal(6.0, mpl.Segments[0].Duration)
+	assert.Equal(uint(1), mpl.Count())
+}
+
+func TestLLHLS_InitSegment(t *testing.T) {
+	mgr, sess := newLLHLSManager(t)
+	profile := &ffmpeg.P144p30fps16x9
+	mgr.SetHLSInitSegment(profile, "init/abc.mp4")
+	uri, err := sess.SaveData(profile.Name+"/0.m4s", []byte("frag"))
+	require.Nil(t, err)
+	require.Nil(t, mgr.InsertHLSPart(profile, 0, uri, 2, true))
+	pl, err := mgr.GetLLHLSMediaPlaylist(context.Background(), profile.Name, LLHLSRequest{MSN: -1, Part: -1})
+	require.Nil(t, err)
+	assert.Contains(t, string(pl), "#EXT-X-MAP:URI=\"init/abc.mp4\"\n#EXT-X-PART:DURATION=2.000,URI=\"/stream/llhls/P144p30fps16x9/part/0.0.m4s\"")
+}
+
+func TestLLHLS_PartOrder(t *testing.T) {
+	assert := assert.New(t)
+	defer func(d float64) { LLHLSSegmentDuration = d }(LLHLSSegmentDuration)
+	LLHLSSegmentDuration = 6.0
+	mgr, sess := newLLHLSManager(t)
+	mem := sess.(*drivers.MemorySession)
+	profile := &ffmpeg.P144p30fps16x9
+	other := &ffmpeg.P240p30fps16x9
+	ctx := context.Background()
+	get := func(profile *ffmpeg.VideoProfile) string {
+		pl, err := mgr.GetLLHLSMediaPlaylist(ctx, profile.Name, LLHLSRequest{MSN: -1, Part: -1})
+		require.Nil(t, err)
+		return string(pl)
+	}
+
+	// the media sequence number follows the segment sequence numbers, and
+	// parts not starting with a keyframe aren't independent
+	uri, err := sess.SaveData(profile.Name+"/7.ts", []byte("part7;"))
+	require.Nil(t, err)
+	require.Nil(t, mgr.InsertHLSPart(profile, 7, uri, 2, false))
+	pl := get(profile)
+	assert.Contains(pl, "#EXT-X-MEDIA-SEQUENCE:2\n")
+	assert.Contains(pl, `#EXT-X-PART:DURATION=2.000,URI="/stream/llhls/P144p30fps16x9/part/2.1.ts"
+#EXT-X-PRELOAD-HINT:TYPE=PART,URI="/stream/llhls/P144p30fps16x9/part/2.2.ts"
+`)
+
+	// parts arriving early are held until those before them arrive
+	insertLLHLSPart(t, mgr, sess, profile, 9, 2)
+	assert.NotContains(get(profile), "part/3.0.ts")
+	insertLLHLSPart(t, mgr, sess, profile, 8, 2)
+	pl = get(profile)
+	assert.Contains(pl, `#EXTINF:4.000,
+/stream/llhls/P144p30fps16x9/seg/2.ts
+#EXT-X-PART:DURATION=2.000,URI="/stream/llhls/P144p30fps16x9/part/3.0.ts",INDEPENDENT=YES
+#EXT-X-PRELOAD-HINT:TYPE=PART,URI="/stream/llhls/P144p30fps16x9/part/3.1.ts"
+`)
+	assert.Equal("part7;part8;", string(mem.GetData("/stream/llhls/P144p30fps16x9/seg/2.ts")))
+
+	// other renditions number the same parts alike
+	insertLLHLSPart(t, mgr, sess, other, 9, 2)
+	pl = get(other)
+	assert.Contains(pl, "#EXT-X-MEDIA-SEQUENCE:3\n")
+	assert.Contains(pl, `URI="/stream/llhls/P240p30fps16x9/part/3.0.ts"`)
+
+	// missing parts are skipped once a part of a later segment arrives
+	insertLLHLSPart(t, mgr, sess, profile, 11, 2)
+	assert.NotContains(get(profile), "part/3.2.ts")
+	insertLLHLSPart(t, mgr, sess, profile, 13, 2)
+	pl = get(profile)
+	assert.Contains(pl, `#EXT-X-PART:DURATION=2.000,URI="/stream/llhls/P144p30fps16x9/part/3.2.ts",INDEPENDENT=YES
+#EXTINF:4.000,
+/stream/llhls/P144p30fps16x9/seg/3.ts
+#EXT-X-PRELOAD-HINT:TYPE=PART,URI="/stream/llhls/P144p30fps16x9/part/4.0.ts"
+`)
+	assert.Equal("part9;part11;", string(mem.GetData("/stream/llhls/P144p30fps16x9/seg/3.ts")))
+
+	// late parts are dropped
+	insertLLHLSPart(t, mgr, sess, profile, 10, 2)
+	assert.NotContains(get(profile), "part/3.1.ts")
+
+	// segments with every part missing are gaps
+	insertLLHLSPart(t, mgr, sess, profile, 17, 2)
+	insertLLHLSPart(t, mgr, sess, profile, 23, 2)
+	pl = get(profile)
+	assert.Contains(pl, `#EXTINF:2.000,
+/stream/llhls/P144p30fps16x9/seg/5.ts
+#EXT-X-GAP
+#EXTINF:6.000,
+/stream/llhls/P144p30fps16x9/part/6.0.ts
+#EXT-X-PRELOAD-HINT:TYPE=PART,URI="/stream/llhls/P144p30fps16x9/part/7.0.ts"
+`)
+
+	// parts are looked up by number, waiting for those not yet available
+	uri, err = mgr.GetLLHLSPart(ctx, profile.Name, 2, 1)
+	assert.Nil(err)
+	assert.Equal("/stream/llhls/P144p30fps16x9/7.ts", uri)
+	uri, err = mgr.GetLLHLSPart(ctx, profile.Name, 3, 1)
+	assert.Nil(err)
+	assert.Equal("", uri)
+	_, err = mgr.GetLLHLSPart(ctx, profile.Name, 9, 0)
+	assert.Equal(ErrLLHLSBadRequest, err)
+	done := make(chan string)
+	go func() {
+		uri, err := mgr.GetLLHLSPart(ctx, profile.Name, 7, 0)
+		assert.Nil(err)
+		done <- uri
+	}()
+	select {
+	case <-done:
+		t.Fatal("Did not block")
+	case <-time.After(50 * time.Millisecond):
+	}
+	insertLLHLSPart(t, mgr, sess, profile, 21, 2)
+	select {
+	case uri := <-done:
+		assert.Equal("/stream/llhls/P144p30fps16x9/21.ts", uri)
+	case <-time.After(time.Second):
+		t.Fatal("Did not unblock")
+	}
+}
+
+func TestLLHLS_BlockingReload(t *testing.T) {
+	assert := assert.New(t)
+	defer func(d float64) { LLHLSSegmentDuration = d }(LLHLSSegmentDuration)
+	LLHLSSegmentDuration = 1.0
+	mgr, sess := newLLHLSManager(t)
+	profile := &ffmpeg.P144p30fps16x9
+	insertLLHLSPart(t, mgr, sess, profile, 0, 0.5)
+	ctx := context.Background()
+
+	// already available
+	_, err := mgr.GetLLHLSMediaPlaylist(ctx, profile.Name, LLHLSRequest{MSN: 0, Part: 0})
+	assert.Nil(err)
+
+	// part without msn, or too far in the future
+	_, err = mgr.GetLLHLSMediaPlaylist(ctx, profile.Name, LLHLSRequest{MSN: -1, Part: 0})
+	assert.Equal(ErrLLHLSBadRequest, err)
+	_, err = mgr.GetLLHLSMediaPlaylist(ctx, profile.Name, LLHLSRequest{MSN: 2, Part: -1})
+	assert.Equal(ErrLLHLSBadRequest, err)
+
+	// blocks until the requested part appears
+	done := make(chan []byte)
+	go func() {
+		pl, err := mgr.GetLLHLSMediaPlaylist(ctx, profile.Name, LLHLSRequest{MSN: 0, Part: 1})
+		assert.Nil(err)
+		done <- pl
+	}()
+	select {
+	case <-done:
+		t.Fatal("Did not block")
+	case <-time.After(50 * time.Millisecond):
+	}
+	insertLLHLSPart(t, mgr, sess, profile, 1, 0.5)
+	select {
+	case pl := <-done:
+		assert.Contains(string(pl), "/stream/llhls/P144p30fps16x9/part/0.1.ts")
+	case <-time.After(time.Second):
+		t.Fatal("Did not unblock")
+	}
+
+	// times out after three target durations
+	started := time.Now()
+	_, err = mgr.GetLLHLSMediaPlaylist(ctx, profile.Name, LLHLSRequest{MSN: 2, Part: -1})
+	assert.Equal(ErrLLHLSTimeout, err)
+	assert.True(time.Since(started) >= 3*time.Second)
+
+	// cancelled with the request
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = mgr.GetLLHLSMediaPlaylist(cctx, profile.Name, LLHLSRequest{MSN: 2, Part: -1})
+	assert.Equal(ErrLLHLSTimeout, err)
+}
+
+func TestLLHLS_DeltaUpdate(t *testing.T) {
+	assert := assert.New(t)
+	defer func(d float64) { LLHLSSegmentDuration = d }(LLHLSSegmentDuration)
+	LLHLSSegmentDuration = 1.0
+	mgr, sess := newLLHLSManager(t)
+	profile := &ffmpeg.P144p30fps16x9
+	for i := uint64(0); i < 10; i++ {
+		insertLLHLSPart(t, mgr, sess, profile, i, 1)
+	}
+
+	pl, err := mgr.GetLLHLSMediaPlaylist(context.Background(), profile.Name, LLHLSRequest{MSN: -1, Part: -1})
+	require.Nil(t, err)
+	assert.Equal(10, strings.Count(string(pl), "#EXTINF"))
+	assert.NotContains(string(pl), "#EXT-X-SKIP")
+
+	// six target durations must remain
+	pl, err = mgr.GetLLHLSMediaPlaylist(context.Background(), profile.Name, LLHLSRequest{MSN: -1, Part: -1, Skip: true})
+	require.Nil(t, err)
+	assert.Contains(string(pl), "#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-SKIP:SKIPPED-SEGMENTS=4\n")
+	assert.Equal(6, strings.Count(string(pl), "#EXTINF"))
+	// parts are only listed for the last segments
+	assert.Equal(3, strings.Count(string(pl), "#EXT-X-PART:"))
+
+	// the window is bounded
+	for i := uint64(10); i < 20; i++ {
+		insertLLHLSPart(t, mgr, sess, profile, i, 1)
+	}
+	pl, err = mgr.GetLLHLSMediaPlaylist(context.Background(), profile.Name, LLHLSRequest{MSN: -1, Part: -1})
+	require.Nil(t, err)
+	assert.Equal(LLHLS_LIST_LENGTH, strings.Count(string(pl), "#EXTINF"))
+	assert.Contains(string(pl), "#EXT-X-MEDIA-SEQUENCE:8\n")
+}
@@ -74,7 +74,7 @@ func TestServeTranscoder(t *testing.T) {
 	strm := &StubTranscoderServer{}
 
 	// test that a transcoder was created
-	go n.serveTranscoder(strm, 5)
+	go n.serveTranscoder(strm, "", 5, nil)
 	time.Sleep(1 * time.Second)
 
 	tc, ok := n.TranscoderManager.liveTranscoders[strm]
@@ -97,21 +97,35 @@ func TestRemoteTranscoder(t *testing.T) {
 	m := NewRemoteTranscoderManager()
 	initTranscoder := func() (*RemoteTranscoder, *StubTranscoderServer) {
 		strm := &StubTranscoderServer{manager: m}
-		tc := NewRemoteTranscoder(m, strm, 5)
+		tc := NewRemoteTranscoder(m, strm, "", 5, nil)
 		return tc, strm
 	}
 
 	// happy path
 	tc, strm := initTranscoder()
-	res, err := tc.Transcode("", "", nil)
+	res, err := tc.Transcode(&SegTranscodingMetadata{})
 	if err != nil || string(res.Segments[0].Data) != "asdf" {
 		t.Error("Error transcoding ", err)
 	}
 
+	// the broadcaster's storage is passed on for direct uploads
+	tc, strm = initTranscoder()
+	md := StubSegTranscodingMetadata()
+	_, err = tc.Transcode(md)
+	if err != nil || strm.Notified.Storage != md.OS || strm.Notified.SeqNo != md.Seq {
+		t.Error("Storage not passed to transcoder ", err, strm.Notified)
+	}
+
+	// results are attributed to the transcoder's address without a name
+	res, err = tc.Transcode(md)
+	if err != nil || res.Transcoder != tc.addr {
+		t.Error("Results not attributed to transcoder ", err, res.Transcoder)
+	}
+
 	// error on remote while transcoding
 	tc, strm = initTranscoder()
 	strm.TranscodeError = fmt.Errorf("TranscodeError")
-	res, err = tc.Transcode("", "", nil)
+	res, err = tc.Transcode(&SegTranscodingMetadata{})
 	if err != strm.TranscodeError {
 		t.Error("Unexpected error ", err, res)
 	}
@@ -120,7 +134,7 @@ func TestRemoteTranscoder(t *testing.T) {
 	tc, strm = initTranscoder()
 
 	strm.SendError = fmt.Errorf("SendError")
-	_, err = tc.Transcode("", "", nil)
+	_, err = tc.Transcode(&SegTranscodingMetadata{})
 	if _, fatal := err.(RemoteTranscoderFatalError); !fatal ||
 		err.Error() != strm.SendError.Error() {
 		t.Error("Unexpected error ", err, fatal)
@@ -131,7 +145,7 @@ func TestRemoteTranscoder(t *testing.T) {
 	strm.WithholdResults = true
 	m.taskCount = 1001
 	RemoteTranscoderTimeout = 1 * time.Millisecond
-	_, err = tc.Transcode("", "fileName", nil)
+	_, err = tc.Transcode(&SegTranscodingMetadata{Fname: "fileName"})
 	if err.Error() != "Remote transcoder took too long" {
 		t.Error("Unexpected error: ", err)
 	}
@@ -180,7 +194,7 @@ func TestManageTranscoders(t *testing.T) {
 
 	// test that transcoder is added to liveTranscoders and remoteTranscoders
 	wg1 := newWg(1)
-	go func() { m.Manage(strm, 5); wg1.Done() }()
+	go func() { m.Manage(strm, "", 5, nil); wg1.Done() }()
 	time.Sleep(1 * time.Millisecond) // allow the manager to activate
 
 	assert.NotNil(m.liveTranscoders[strm])
@@ -194,7 +208,7 @@ func TestManageTranscoders(t *testing.T) {
 
 	// test that additional transcoder is added to liveTranscoders and remoteTranscoders
 	wg2 := newWg(1)
-	go func() { m.Manage(strm2, 4); wg2.Done() }()
+	go func() { m.Manage(strm2, "", 4, nil); wg2.Done() }()
 	time.Sleep(1 * time.Millisecond) // allow the manager to activate
 
 	assert.NotNil(m.liveTranscoders[strm])
@@ -221,6 +235,46 @@ func TestManageTranscoders(t *testing.T) {
 	assert.Equal(0, m.RegisteredTranscodersCount())
 }
 
+func TestManageTranscoders_Capabilities(t *testing.T) {
+	m := NewRemoteTranscoderManager()
+	n, _ := NewLivepeerNode(nil, "", nil)
+	n.TranscoderManager = m
+	n.Transcoder = m
+	strm := &StubTranscoderServer{}
+	strm2 := &StubTranscoderServer{manager: m}
+	assert := assert.New(t)
+
+	// no transcoders; fall back to the node's own capabilities
+	assert.Nil(m.Capabilities())
+	assert.Equal(DefaultCapabilities(false), n.Capabilities())
+
+	gpu := NewCapabilities([]VideoCodec{CodecH264, CodecH265}, true, 0)
+	wg1 := newWg(1)
+	go func() { m.Manage(strm, "", 5, gpu); wg1.Done() }()
+	time.Sleep(1 * time.Millisecond) // allow the manager to activate
+	assert.Equal(gpu, m.Capabilities())
+	assert.Equal(gpu, n.Capabilities())
+
+	// transcoders without capabilities only share the legacy ones
+	wg2 := newWg(1)
+	go func() { m.Manage(strm2, "", 4, nil); wg2.Done() }()
+	time.Sleep(1 * time.Millisecond) // allow the manager to activate
+	caps := m.Capabilities()
+	assert.Equal([]net.VideoProfile_VideoCodec{net.VideoProfile_H264}, caps.Codecs)
+	assert.Equal([]net.VideoProfile_Format{net.VideoProfile_MPEGTS}, caps.Formats)
+	assert.Equal([]net.OSInfo_StorageType{net.OSInfo_S3, net.OSInfo_GOOGLE}, caps.Storage)
+	assert.False(caps.Gpu)
+	assert.False(caps.Audio)
+
+	m.liveTranscoders[strm2].eof <- struct{}{}
+	assert.True(wgWait(wg2)) // time limit
+	assert.Equal(gpu, m.Capabilities())
+
+	m.liveTranscoders[strm].eof <- struct{}{}
+	assert.True(wgWait(wg1)) // time limit
+	assert.Nil(m.Capabilities())
+}
+
 func TestSelectTranscoder(t *testing.T) {
 	m := NewRemoteTranscoderManager()
 	strm := &StubTranscoderServer{manager: m, WithholdResults: false}
@@ -233,9 +287,9 @@ func TestSelectTranscoder(t *testing.T) {
 
 	// register transcoders, which adds transcoder to liveTranscoders and remoteTranscoders
 	wg := newWg(1)
-	go func() { m.Manage(strm, 2) }()
+	go func() { m.Manage(strm, "", 2, nil) }()
 	time.Sleep(1 * time.Millisecond) // allow time for first stream to register
-	go func() { m.Manage(strm2, 1); wg.Done() }()
+	go func() { m.Manage(strm2, "", 1, nil); wg.Done() }()
 	time.Sleep(1 * time.Millisecond) // allow time for second stream to register
 
 	assert.NotNil(m.liveTranscoders[strm])
@@ -245,23 +299,23 @@ func TestSelectTranscoder(t *testing.T) {
 	// assert transcoder is returned from selectTranscoder
 	t1 := m.liveTranscoders[strm]
 	t2 := m.liveTranscoders[strm2]
-	currentTranscoder := m.selectTranscoder()
+	currentTranscoder := m.selectTranscoder(nil)
 	assert.Equal(t2, currentTranscoder)
 	assert.Equal(1, t2.load)
 	assert.NotNil(m.liveTranscoders[strm])
 	assert.Len(m.remoteTranscoders, 2)
 
 	// assert transcoder with less load selected
-	currentTranscoder2 := m.selectTranscoder()
+	currentTranscoder2 := m.selectTranscoder(nil)
 	assert.Equal(t1, currentTranscoder2)
 	assert.Equal(1, t1.load)
 
-	currentTranscoder3 := m.selectTranscoder()
+	currentTranscoder3 := m.selectTranscoder(nil)
 	assert.Equal(t1, currentTranscoder3)
 	assert.Equal(2, t1.load)
 
 	// assert no transcoder returned if all at they capacity
-	noTrans := m.selectTranscoder()
+	noTrans := m.selectTranscoder(nil)
 	assert.Nil(noTrans)
 
 	m.completeTranscoders(t1)
@@ -275,14 +329,14 @@ func TestSelectTranscoder(t *testing.T) {
 	assert.NotNil(m.liveTranscoders[strm])
 
 	// assert t1 is selected and t2 drained
-	currentTranscoder = m.selectTranscoder()
+	currentTranscoder = m.selectTranscoder(nil)
 	assert.Equal(t1, currentTranscoder)
 	assert.Equal(1, t1.load)
 	assert.NotNil(m.liveTranscoders[strm])
 	assert.Len(m.remoteTranscoders, 2)
 
 	// assert transcoder gets added back to remoteTranscoders if no transcoding error
-	_, err := m.Transcode("", "", nil)
+	_, err := m.Transcode(&SegTranscodingMetadata{})
 	assert.Nil(err)
 	assert.Len(m.remoteTranscoders, 2)
 	assert.Equal(1, t1.load)
@@ -300,12 +354,12 @@ func TestTranscoderManagerTranscoding(t *testing.T) {
 	assert.Empty(m.remoteTranscoders)
 
 	// Attempt to transcode when no transcoders in the set
-	_, err := m.Transcode("", "", nil)
+	_, err := m.Transcode(&SegTranscodingMetadata{})
 	assert.NotNil(err)
 	assert.Equal(err.Error(), "No transcoders available")
 
 	wg := newWg(1)
-	go func() { m.Manage(s, 5); wg.Done() }()
+	go func() { m.Manage(s, "", 5, nil); wg.Done() }()
 	time.Sleep(1 * time.Millisecond)
 
 	assert.Len(m.remoteTranscoders, 1) // sanity
@@ -313,14 +367,14 @@ func TestTranscoderManagerTranscoding(t *testing.T) {
 	assert.NotNil(m.liveTranscoders[s])
 
 	// happy path
-	res, err := m.Transcode("", "", nil)
+	res, err := m.Transcode(&SegTranscodingMetadata{})
 	assert.Nil(err)
 	assert.Len(res.Segments, 1)
 	assert.Equal(string(res.Segments[0].Data), "asdf")
 
 	// non-fatal error should not remove from list
 	s.TranscodeError = fmt.Errorf("TranscodeError")
-	_, err = m.Transcode("", "", nil)
+	_, err = m.Transcode(&SegTranscodingMetadata{})
 	assert.Equal(s.TranscodeError, err)
 	assert.Len(m.remoteTranscoders, 1)           // sanity
 	assert.Equal(0, m.remoteTranscoders[0].load) // sanity
@@ -330,36 +384,241 @@ func TestTranscoderManagerTranscoding(t *testing.T) {
 
 	// fatal error should retry and remove from list
 	s.SendError = fmt.Errorf("SendError")
-	_, err = m.Transcode("", "", nil)
+	_, err = m.Transcode(&SegTranscodingMetadata{})
 	assert.True(wgWait(wg)) // should disconnect manager
 	assert.NotNil(err)
 	assert.Equal(err.Error(), "No transcoders available")
-	_, err = m.Transcode("", "", nil) // need second try to remove from remoteTranscoders
+	_, err = m.Transcode(&SegTranscodingMetadata{}) // need second try to remove from remoteTranscoders
 	assert.NotNil(err)
 	assert.Equal(err.Error(), "No transcoders available")
 	assert.Len(m.liveTranscoders, 0)
 	assert.Len(m.remoteTranscoders, 0) // retries drain the list
 	s.SendError = nil
 
-	// fatal error should not retry
+	// timeouts remove the transcoder too
 	wg.Add(1)
-	go func() { m.Manage(s, 5); wg.Done() }()
+	go func() { m.Manage(s, "", 5, nil); wg.Done() }()
 	time.Sleep(1 * time.Millisecond)
 
 	assert.Len(m.remoteTranscoders, 1) // sanity check
 	assert.Len(m.liveTranscoders, 1)
 	s.WithholdResults = true
 	RemoteTranscoderTimeout = 1 * time.Millisecond
-	_, err = m.Transcode("", "", nil)
-	_, fatal := err.(RemoteTranscoderFatalError)
+	_, err = m.Transcode(&SegTranscodingMetadata{})
 	wg.Wait()
-	assert.True(fatal)
+	assert.Equal(ErrNoTranscodersAvailable, err)
 	assert.Len(m.liveTranscoders, 0)
-	assert.Len(m.remoteTranscoders, 1) // no retries, so don't drain
 	s.WithholdResults = false
 	RemoteTranscoderTimeout = 8 * time.Second
 }
 
+func TestTranscoderManagerRetries(t *testing.T) {
+	assert := assert.New(t)
+	m := NewRemoteTranscoderManager()
+	s := &StubTranscoderServer{manager: m}
+	s2 := &StubTranscoderServer{manager: m}
+	defer func() { RemoteTranscoderTimeout = 8 * time.Second }()
+
+	wg, wg2 := newWg(1), newWg(1)
+	go func() { m.Manage(s, "", 5, nil); wg.Done() }()
+	go func() { m.Manage(s2, "", 5, nil); wg2.Done() }()
+	time.Sleep(1 * time.Millisecond)
+	t1, t2 := m.liveTranscoders[s], m.liveTranscoders[s2]
+
+	// failing transcoders are picked after healthier ones
+	failure := fmt.Errorf("failure")
+	m.updateErrorScore(t2, failure)
+	assert.Equal(t1, m.selectTranscoder(nil))
+	m.completeTranscoders(t1)
+	m.updateErrorScore(t1, failure)
+	m.updateErrorScore(t1, failure)
+	assert.Equal(t2, m.selectTranscoder(nil))
+	m.completeTranscoders(t2)
+
+	// errors are retried on another transcoder
+	s2.TranscodeError = fmt.Errorf("TranscodeError2")
+	res, err := m.Transcode(&SegTranscodingMetadata{})
+	assert.Nil(err)
+	assert.Equal("asdf", string(res.Segments[0].Data))
+	assert.Equal(1.0, t1.errorScore)
+	assert.Equal(2.0, t2.errorScore)
+
+	// the last error is returned once every transcoder has failed
+	s.TranscodeError = fmt.Errorf("TranscodeError")
+	_, err = m.Transcode(&SegTranscodingMetadata{})
+	assert.Equal(s2.TranscodeError, err)
+	assert.Equal(2.0, t1.errorScore)
+	assert.Equal(3.0, t2.errorScore)
+	assert.Equal(3, t2.errors)
+	assert.Equal(0, t1.load)
+	assert.Equal(0, t2.load)
+
+	// unless there is a local fallback
+	fallback := &StubTranscoder{}
+	m.SetLocalFallback(fallback)
+	_, err = m.Transcode(&SegTranscodingMetadata{})
+	assert.Nil(err)
+	assert.Equal(1, fallback.SegCount)
+	m.SetLocalFallback(nil)
+	s.TranscodeError, s2.TranscodeError = nil, nil
+
+	// timeouts are retried on another transcoder, and the timed out one removed
+	s.WithholdResults = true
+	RemoteTranscoderTimeout = 1 * time.Millisecond
+	_, err = m.Transcode(&SegTranscodingMetadata{})
+	assert.Nil(err)
+	assert.True(wgWait(wg))
+	assert.Nil(m.liveTranscoders[s])
+	assert.Equal(1, m.RegisteredTranscodersCount())
+
+	// nothing is retried past the deadline
+	oldDeadline := RemoteTranscodeDeadline
+	defer func() { RemoteTranscodeDeadline = oldDeadline }()
+	RemoteTranscodeDeadline = 0
+	m.SetLocalFallback(fallback)
+	_, err = m.Transcode(&SegTranscodingMetadata{})
+	assert.Equal(ErrNoTranscodersAvailable, err)
+	assert.Equal(1, fallback.SegCount)
+
+	m.liveTranscoders[s2].eof <- struct{}{}
+	assert.True(wgWait(wg2))
+}
+
+func TestTranscoderManagerRetries_Timeout(t *testing.T) {
+	assert := assert.New(t)
+	m := NewRemoteTranscoderManager()
+	s := &StubTranscoderServer{manager: m, WithholdResults: true}
+	s2 := &StubTranscoderServer{manager: m}
+
+	wg, wg2 := newWg(1), newWg(1)
+	go func() { m.Manage(s, "", 5, nil); wg.Done() }()
+	go func() { m.Manage(s2, "", 5, nil); wg2.Done() }()
+	time.Sleep(1 * time.Millisecond)
+	// the withholding transcoder is picked first
+	m.updateErrorScore(m.liveTranscoders[s2], fmt.Errorf("failure"))
+
+	// Attempts get half of the time left, even though the per-task timeout
+	// is longer than the whole segment deadline
+	assert.True(RemoteTranscoderTimeout >= common.HTTPTimeout)
+	start := time.Now()
+	res, err := m.Transcode(&SegTranscodingMetadata{Deadline: start.Add(400 * time.Millisecond)})
+	assert.Nil(err)
+	assert.Equal("asdf", string(res.Segments[0].Data))
+	assert.True(time.Since(start) < 400*time.Millisecond)
+	// running out of the segment's time doesn't disconnect the transcoder
+	assert.Equal(2, m.RegisteredTranscodersCount())
+
+	// the local fallback takes over when the last transcoder times out
+	s2.WithholdResults = true
+	fallback := &StubTranscoder{}
+	m.SetLocalFallback(fallback)
+	_, err = m.Transcode(&SegTranscodingMetadata{Deadline: time.Now().Add(400 * time.Millisecond)})
+	assert.Nil(err)
+	assert.Equal(1, fallback.SegCount)
+	assert.Equal(2, m.RegisteredTranscodersCount())
+
+	// without a fallback, the segment fails with the timeout
+	m.SetLocalFallback(nil)
+	_, err = m.Transcode(&SegTranscodingMetadata{Deadline: time.Now().Add(100 * time.Millisecond)})
+	assert.Equal(ErrRemoteTranscoderTimeout, err)
+	assert.Equal(2, m.RegisteredTranscodersCount())
+
+	m.liveTranscoders[s].eof <- struct{}{}
+	assert.True(wgWait(wg))
+	m.liveTranscoders[s2].eof <- struct{}{}
+	assert.True(wgWait(wg2))
+}
+
+func TestRemoteTranscoder_Heartbeats(t *testing.T) {
+	assert := assert.New(t)
+	m := NewRemoteTranscoderManager()
+	oldInterval, oldMissed := RemoteTranscoderHeartbeatInterval, RemoteTranscoderMaxMissedHeartbeats
+	defer func() {
+		RemoteTranscoderHeartbeatInterval, RemoteTranscoderMaxMissedHeartbeats = oldInterval, oldMissed
+	}()
+	RemoteTranscoderHeartbeatInterval = 5 * time.Millisecond
+	RemoteTranscoderMaxMissedHeartbeats = 2
+
+	// responsive transcoders stay connected
+	s := &StubTranscoderServer{manager: m}
+	wg := newWg(1)
+	go func() { m.Manage(s, "", 5, nil); wg.Done() }()
+	time.Sleep(1 * time.Millisecond)
+	m.RTmutex.Lock()
+	registered := m.liveTranscoders[s].lastSeen
+	m.RTmutex.Unlock()
+	time.Sleep(50 * time.Millisecond)
+	assert.False(wgWait2(wg, time.Millisecond))
+	state := m.RegisteredTranscodersState()
+	assert.Len(state, 1)
+	assert.True(state[0].LastSeen.After(registered))
+
+	m.liveTranscoders[s].eof <- struct{}{}
+	assert.True(wgWait(wg))
+
+	// transcoders that stop answering are disconnected
+	s = &StubTranscoderServer{manager: m, WithholdResults: true}
+	wg.Add(1)
+	var err error
+	go func() { err = m.Manage(s, "", 5, nil); wg.Done() }()
+	assert.True(wgWait(wg))
+	assert.Nil(err)
+	assert.Equal(0, m.RegisteredTranscodersCount())
+}
+
+func TestRemoteTranscoderManager_Drain(t *testing.T) {
+	assert := assert.New(t)
+	m := NewRemoteTranscoderManager()
+	s := &StubTranscoderServer{manager: m}
+
+	assert.Equal(ErrUnknownTranscoder, m.Drain("TestAddress"))
+
+	wg := newWg(1)
+	var err error
+	go func() { err = m.Manage(s, "", 5, nil); wg.Done() }()
+	time.Sleep(1 * time.Millisecond)
+
+	// failed tasks are counted
+	s.TranscodeError = fmt.Errorf("TranscodeError")
+	_, terr := m.Transcode(&SegTranscodingMetadata{})
+	assert.Equal(s.TranscodeError, terr)
+	s.TranscodeError = nil
+
+	t1 := m.selectTranscoder(nil)
+	assert.NotNil(t1)
+	assert.Equal(ErrUnknownTranscoder, m.Drain("unknown"))
+	assert.Nil(m.Drain("TestAddress"))
+	assert.Equal([]net.RemoteTranscoderState{{
+		Address:    "TestAddress",
+		Capacity:   5,
+		Load:       1,
+		Errors:     1,
+		ErrorScore: 1,
+		LastSeen:   t1.lastSeen,
+		Draining:   true,
+	}}, m.RegisteredTranscodersState())
+
+	// draining transcoders get no new tasks but keep running their own
+	assert.Nil(m.selectTranscoder(nil))
+	_, terr = m.Transcode(&SegTranscodingMetadata{})
+	assert.EqualError(terr, "No transcoders available")
+	assert.False(wgWait2(wg, 10*time.Millisecond))
+
+	// and are disconnected once the tasks are done
+	m.completeTranscoders(t1)
+	assert.True(wgWait(wg))
+	assert.Equal(ErrTranscoderDrained, err)
+	assert.Empty(m.RegisteredTranscodersState())
+
+	// idle transcoders are disconnected right away
+	wg.Add(1)
+	go func() { err = m.Manage(s, "", 5, nil); wg.Done() }()
+	time.Sleep(1 * time.Millisecond)
+	assert.Nil(m.Drain("TestAddress"))
+	assert.True(wgWait(wg))
+	assert.Equal(ErrTranscoderDrained, err)
+}
+
 func TestTaskChan(t *testing.T) {
 	n := NewRemoteTranscoderManager()
 	// Sanity check task ID
@@ -434,11 +693,14 @@ type StubTranscoderServer struct {
 	SendError       error
 	TranscodeError  error
 	WithholdResults bool
+	// Last message sent to the transcoder
+	Notified *net.NotifySegment
 
 	common.StubServerStream
 }
 
 func (s *StubTranscoderServer) Send(n *net.NotifySegment) error {
+	s.Notified = n
 	res := RemoteTranscoderResult{
 		TranscodeData: &TranscodeData{
 			Segments: []*TranscodedSegmentData{
@@ -525,18 +787,18 @@ func TestOrchCheckCapacity(t *testing.T) {
 	assert := assert.New(t)
 
 	// happy case
-	assert.Nil(o.CheckCapacity(md.ManifestID))
+	assert.Nil(o.CheckCapacity(md))
 
 	// capped case
 	MaxSessions = 0
-	assert.Equal(ErrOrchCap, o.CheckCapacity(md.ManifestID))
+	assert.Equal(ErrOrchCap, o.CheckCapacity(md))
 
 	// ensure existing segment chans pass while cap is active
 	MaxSessions = cap
 	_, err := n.getSegmentChan(md) // store md into segment chans
 	assert.Nil(err)
 	MaxSessions = 0
-	assert.Nil(o.CheckCapacity(md.ManifestID))
+	assert.Nil(o.CheckCapacity(md))
 }
 
 func TestProcessPayment_GivenRecipientError_ReturnsNil(t *testing.T) {
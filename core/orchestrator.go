@@ -27,7 +27,7 @@ import (
 
 	lpcrypto "github.com/livepeer/go-livepeer/crypto"
 	lpmon "github.com/livepeer/go-livepeer/monitor"
-	ffmpeg "github.com/livepeer/lpms/ffmpeg"
+	"github.com/livepeer/lpms/ffmpeg"
 	"github.com/livepeer/lpms/stream"
 )
 
@@ -75,28 +75,44 @@ func (orch *orchestrator) Address() ethcommon.Address {
 	return orch.address
 }
 
-func (orch *orchestrator) TranscoderSecret() string {
-	return orch.node.OrchSecret
+// AuthenticateTranscoder checks the credentials presented by a standalone
+// transcoder, returning the name of the token they match. Transcoders
+// using the shared orchestrator secret have an empty name.
+func (orch *orchestrator) AuthenticateTranscoder(creds string) (string, error) {
+	return orch.node.authenticateTranscoder(creds)
 }
 
-func (orch *orchestrator) CheckCapacity(mid ManifestID) error {
+// CheckCapacity checks whether a segment of the stream can be accepted.
+// Streams already being transcoded always are. New streams are refused past
+// the session limit, or if the transcoders can't encode their renditions in
+// real time on top of the current load. A nil md checks for room for any
+// new stream.
+func (orch *orchestrator) CheckCapacity(md *SegTranscodingMetadata) error {
 	orch.node.segmentMutex.RLock()
 	defer orch.node.segmentMutex.RUnlock()
-	if _, ok := orch.node.SegmentChans[mid]; ok {
-		return nil
+	var profiles []ffmpeg.VideoProfile
+	if md != nil {
+		if _, ok := orch.node.SegmentChans[md.ManifestID]; ok {
+			return nil
+		}
+		profiles = md.Profiles
 	}
 	if len(orch.node.SegmentChans) >= MaxSessions {
 		return ErrOrchCap
 	}
-	return nil
+	return orch.node.checkPixelRate(profiles)
 }
 
 func (orch *orchestrator) TranscodeSeg(md *SegTranscodingMetadata, seg *stream.HLSSegment) (*TranscodeResult, error) {
 	return orch.node.sendToTranscodeLoop(md, seg)
 }
 
-func (orch *orchestrator) ServeTranscoder(stream net.Transcoder_RegisterTranscoderServer, capacity int) {
-	orch.node.serveTranscoder(stream, capacity)
+func (orch *orchestrator) ServeTranscoder(stream net.Transcoder_RegisterTranscoderServer, name string, capacity int, caps *net.Capabilities) error {
+	return orch.node.serveTranscoder(stream, name, capacity, caps)
+}
+
+func (orch *orchestrator) Capabilities() *net.Capabilities {
+	return orch.node.Capabilities()
 }
 
 func (orch *orchestrator) TranscoderResults(tcID int64, res *RemoteTranscoderResult) {
@@ -368,18 +384,26 @@ type TranscodeResult struct {
 	Sig           []byte
 	TranscodeData *TranscodeData
 	OS            drivers.OSSession
+	// Remote transcoder whose hashes of the renditions it uploaded were
+	// signed as is; empty if every rendition was hashed by the orchestrator
+	Transcoder string
 }
 
 // TranscodeData contains the transcoding output for an input segment
 type TranscodeData struct {
-	Segments []*TranscodedSegmentData
-	Pixels   int64 // Decoded pixels
+	Segments   []*TranscodedSegmentData
+	Pixels     int64  // Decoded pixels
+	Transcoder string // Name, or address without one, of the remote transcoder
 }
 
 // TranscodedSegmentData contains encoded data for a profile
 type TranscodedSegmentData struct {
 	Data   []byte
 	Pixels int64 // Encoded pixels
+	// Set instead of Data for renditions a remote transcoder uploaded into
+	// the broadcaster's storage, along with the hash of the rendition
+	URI  string
+	Hash []byte
 }
 
 type SegChanData struct {
@@ -391,6 +415,8 @@ type SegChanData struct {
 type RemoteTranscoderResult struct {
 	TranscodeData *TranscodeData
 	Err           error
+	// Name of the transcoder that sent the results
+	Transcoder string
 }
 
 type SegmentChan chan *SegChanData
@@ -424,9 +450,27 @@ func (rtm *RemoteTranscoderManager) addTaskChan() (int64, TranscoderChan) {
 	return taskID, rtm.taskChans[taskID]
 }
 
+// addTask creates the results channel of a task assigned to the named
+// transcoder. Only results sent under that name are accepted for the task.
+func (rtm *RemoteTranscoderManager) addTask(owner string) (int64, TranscoderChan) {
+	taskID, tc := rtm.addTaskChan()
+	rtm.taskMutex.Lock()
+	rtm.taskOwners[taskID] = owner
+	rtm.taskMutex.Unlock()
+	return taskID, tc
+}
+
+func (rtm *RemoteTranscoderManager) taskOwner(taskID int64) (string, bool) {
+	rtm.taskMutex.RLock()
+	defer rtm.taskMutex.RUnlock()
+	owner, ok := rtm.taskOwners[taskID]
+	return owner, ok
+}
+
 func (rtm *RemoteTranscoderManager) removeTaskChan(taskID int64) {
 	rtm.taskMutex.Lock()
 	defer rtm.taskMutex.Unlock()
+	delete(rtm.taskOwners, taskID)
 	if _, ok := rtm.taskChans[taskID]; !ok {
 		glog.V(common.DEBUG).Info("Transcoder channel nonexistent for job ", taskID)
 		return
@@ -444,12 +488,19 @@ func (n *LivepeerNode) getSegmentChan(md *SegTranscodingMetadata) (SegmentChan,
 	if len(n.SegmentChans) >= MaxSessions {
 		return nil, ErrOrchCap
 	}
+	if err := n.checkPixelRate(md.Profiles); err != nil {
+		glog.Errorf("Not enough transcoding capacity for manifestID=%s load=%d limit=%d", md.ManifestID, n.pixelLoad, n.PixelRate())
+		return nil, err
+	}
 	sc := make(SegmentChan, 1)
 	glog.V(common.DEBUG).Info("Creating new segment chan for manifest ", md.ManifestID)
 	if err := n.transcodeSegmentLoop(md, sc); err != nil {
 		return nil, err
 	}
 	n.SegmentChans[md.ManifestID] = sc
+	cost := streamPixelRate(md.Profiles)
+	n.segmentCosts[md.ManifestID] = cost
+	n.pixelLoad += cost
 	if lpmon.Enabled {
 		lpmon.CurrentSessions(len(n.SegmentChans))
 	}
@@ -458,6 +509,10 @@ func (n *LivepeerNode) getSegmentChan(md *SegTranscodingMetadata) (SegmentChan,
 
 func (n *LivepeerNode) sendToTranscodeLoop(md *SegTranscodingMetadata, seg *stream.HLSSegment) (*TranscodeResult, error) {
 	glog.V(common.DEBUG).Infof("Starting to transcode segment manifestID=%s seqNo=%d", string(md.ManifestID), md.Seq)
+	if md.Deadline.IsZero() {
+		// The time spent waiting behind earlier segments counts too
+		md.Deadline = time.Now().Add(RemoteTranscodeDeadline)
+	}
 	ch, err := n.getSegmentChan(md)
 	if err != nil {
 		glog.Error("Could not find segment chan ", err)
@@ -534,7 +589,8 @@ func (n *LivepeerNode) transcodeSeg(config transcodeConfig, seg *stream.HLSSegme
 
 	//Do the transcoding
 	start := time.Now()
-	tData, err := transcoder.Transcode(string(md.ManifestID), url, md.Profiles)
+	md.Fname = url
+	tData, err := transcoder.Transcode(md)
 	if err != nil {
 		glog.Errorf("Error transcoding manifestID=%s segNo=%d segName=%s - %v", string(md.ManifestID), seg.SeqNo, seg.Name, err)
 		return terr(err)
@@ -556,8 +612,22 @@ func (n *LivepeerNode) transcodeSeg(config transcodeConfig, seg *stream.HLSSegme
 	// Prepare the result object
 	var tr TranscodeResult
 	segHashes := make([][]byte, len(tSegments))
+	uploaded := 0
 
 	for i := range md.Profiles {
+		if tSegments[i].URI != "" {
+			// Uploaded by the transcoder, which hashed it
+			if len(tSegments[i].Hash) != 32 {
+				glog.Errorf("Missing hash of uploaded segment for manifestID=%s seqNo=%d uri=%s",
+					string(md.ManifestID), seg.SeqNo, tSegments[i].URI)
+				return terr(fmt.Errorf("MissingSegmentHash"))
+			}
+			glog.V(common.DEBUG).Infof("Transcoded segment manifestID=%s seqNo=%d profile=%s uri=%s",
+				string(md.ManifestID), seg.SeqNo, md.Profiles[i].Name, tSegments[i].URI)
+			segHashes[i] = tSegments[i].Hash
+			uploaded++
+			continue
+		}
 		if tSegments[i].Data == nil || len(tSegments[i].Data) < 25 {
 			glog.Errorf("Cannot find transcoded segment for manifestID=%s seqNo=%d len=%d",
 				string(md.ManifestID), seg.SeqNo, len(tSegments[i].Data))
@@ -571,6 +641,14 @@ func (n *LivepeerNode) transcodeSeg(config transcodeConfig, seg *stream.HLSSegme
 	os.Remove(fname)
 	tr.OS = config.OS
 	tr.TranscodeData = tData
+	n.updatePixelLoad(md.ManifestID, tData, seg.Duration)
+	if uploaded > 0 {
+		// We never see the uploaded data, so the signature vouches for
+		// hashes only the transcoder has checked
+		tr.Transcoder = tData.Transcoder
+		glog.Infof("Signing unchecked hashes of uploaded renditions manifestID=%s seqNo=%d transcoder=%s renditions=%d",
+			string(md.ManifestID), seg.SeqNo, tr.Transcoder, uploaded)
+	}
 
 	if n == nil || n.Eth == nil {
 		return &tr
@@ -619,6 +697,8 @@ func (n *LivepeerNode) transcodeSegmentLoop(md *SegTranscodingMetadata, segChan
 				if _, ok := n.SegmentChans[md.ManifestID]; ok {
 					close(n.SegmentChans[md.ManifestID])
 					delete(n.SegmentChans, md.ManifestID)
+					n.pixelLoad -= n.segmentCosts[md.ManifestID]
+					delete(n.segmentCosts, md.ManifestID)
 					if lpmon.Enabled {
 						lpmon.CurrentSessions(len(n.SegmentChans))
 					}
@@ -634,10 +714,11 @@ func (n *LivepeerNode) transcodeSegmentLoop(md *SegTranscodingMetadata, segChan
 	return nil
 }
 
-func (n *LivepeerNode) serveTranscoder(stream net.Transcoder_RegisterTranscoderServer, capacity int) {
+func (n *LivepeerNode) serveTranscoder(stream net.Transcoder_RegisterTranscoderServer, name string, capacity int, caps *net.Capabilities) error {
 	from := common.GetConnectionAddr(stream.Context())
-	n.TranscoderManager.Manage(stream, capacity)
-	glog.V(common.DEBUG).Infof("Closing transcoder=%s channel", from)
+	err := n.TranscoderManager.Manage(stream, name, capacity, caps)
+	glog.V(common.DEBUG).Infof("Closing transcoder=%s name=%s channel err=%v", from, name, err)
+	return err
 }
 
 func (rtm *RemoteTranscoderManager) transcoderResults(tcID int64, res *RemoteTranscoderResult) {
@@ -645,16 +726,32 @@ func (rtm *RemoteTranscoderManager) transcoderResults(tcID int64, res *RemoteTra
 	if err != nil {
 		return // do we need to return anything?
 	}
+	if owner, ok := rtm.taskOwner(tcID); ok && owner != res.Transcoder {
+		glog.Errorf("Dropping results for taskId=%d from transcoder name=%s assigned to name=%s", tcID, res.Transcoder, owner)
+		return
+	}
 	remoteChan <- res
 }
 
 type RemoteTranscoder struct {
-	manager  *RemoteTranscoderManager
-	stream   net.Transcoder_RegisterTranscoderServer
-	eof      chan struct{}
-	addr     string
-	capacity int
-	load     int
+	manager      *RemoteTranscoderManager
+	stream       net.Transcoder_RegisterTranscoderServer
+	eof          chan struct{}
+	addr         string
+	capacity     int
+	capabilities *net.Capabilities
+	load         int
+	errors       int
+	errorScore   float64
+	lastSeen     time.Time
+	draining     bool
+
+	// Name of the token the transcoder authenticated with; empty when it
+	// used the shared orchestrator secret
+	name string
+
+	// gRPC streams don't support concurrent sends
+	sendLock sync.Mutex
 }
 
 // RemoteTranscoderFatalError wraps error to indicate that error is fatal
@@ -671,6 +768,22 @@ func NewRemoteTranscoderFatalError(err error) error {
 var RemoteTranscoderTimeout = 8 * time.Second
 var ErrRemoteTranscoderTimeout = errors.New("Remote transcoder took too long")
 
+// RemoteTranscoderHeartbeatInterval is how often transcoders are checked for
+// liveness. A transcoder is disconnected after missing
+// RemoteTranscoderMaxMissedHeartbeats heartbeats in a row.
+var RemoteTranscoderHeartbeatInterval = 10 * time.Second
+var RemoteTranscoderMaxMissedHeartbeats = 3
+var ErrRemoteTranscoderHeartbeat = errors.New("Remote transcoder missed heartbeat")
+
+var ErrTranscoderDrained = errors.New("Transcoder drained")
+var ErrUnknownTranscoder = errors.New("ErrUnknownTranscoder")
+var ErrNoTranscodersAvailable = errors.New("No transcoders available")
+
+// RemoteTranscodeDeadline bounds the time spent on a segment from when it's
+// received, including retries on remote transcoders. Broadcasters stop
+// waiting for results after common.HTTPTimeout.
+var RemoteTranscodeDeadline = common.HTTPTimeout
+
 func (rt *RemoteTranscoder) done() {
 	// select so we don't block indefinitely if there's no listener
 	select {
@@ -679,9 +792,67 @@ func (rt *RemoteTranscoder) done() {
 	}
 }
 
+func (rt *RemoteTranscoder) send(msg *net.NotifySegment) error {
+	rt.sendLock.Lock()
+	defer rt.sendLock.Unlock()
+	return rt.stream.Send(msg)
+}
+
+// heartbeat checks that the transcoder is still responsive
+func (rt *RemoteTranscoder) heartbeat() error {
+	taskID, taskChan := rt.manager.addTask(rt.name)
+	defer rt.manager.removeTaskChan(taskID)
+	if err := rt.send(&net.NotifySegment{TaskId: taskID, Heartbeat: true}); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), RemoteTranscoderHeartbeatInterval)
+	defer cancel()
+	select {
+	case <-ctx.Done():
+		return ErrRemoteTranscoderHeartbeat
+	case <-taskChan:
+		// Transcoders predating heartbeats answer with a transcoding error,
+		// which shows they're alive all the same
+		rt.manager.seen(rt)
+		return nil
+	}
+}
+
+// checkHeartbeats sends heartbeats to the transcoder until stop is closed,
+// disconnecting the transcoder if it misses too many of them
+func (rt *RemoteTranscoder) checkHeartbeats(stop chan struct{}) {
+	ticker := time.NewTicker(RemoteTranscoderHeartbeatInterval)
+	defer ticker.Stop()
+	missed := 0
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		err := rt.heartbeat()
+		if err == nil {
+			missed = 0
+			continue
+		}
+		missed++
+		glog.Errorf("Missed heartbeat from transcoder=%s missed=%d err=%v", rt.addr, missed, err)
+		if missed >= RemoteTranscoderMaxMissedHeartbeats {
+			glog.Errorf("Disconnecting unresponsive transcoder=%s", rt.addr)
+			rt.done()
+			return
+		}
+	}
+}
+
 // Transcode do actual transcoding by sending work to remote transcoder and waiting for the result
-func (rt *RemoteTranscoder) Transcode(job string, fname string, profiles []ffmpeg.VideoProfile) (*TranscodeData, error) {
-	taskID, taskChan := rt.manager.addTaskChan()
+func (rt *RemoteTranscoder) Transcode(md *SegTranscodingMetadata) (*TranscodeData, error) {
+	return rt.transcode(md, RemoteTranscoderTimeout)
+}
+
+func (rt *RemoteTranscoder) transcode(md *SegTranscodingMetadata, timeout time.Duration) (*TranscodeData, error) {
+	fname := md.Fname
+	taskID, taskChan := rt.manager.addTask(rt.name)
 	defer rt.manager.removeTaskChan(taskID)
 	signalEOF := func(err error) (*TranscodeData, error) {
 		rt.done()
@@ -689,40 +860,68 @@ func (rt *RemoteTranscoder) Transcode(job string, fname string, profiles []ffmpe
 		return nil, RemoteTranscoderFatalError{err}
 	}
 
-	fullProfiles, err := common.FFmpegProfiletoNetProfile(profiles)
+	fullProfiles, err := common.FFmpegProfiletoNetProfile(md.Profiles)
 	if err != nil {
 		return nil, err
 	}
+	if md.Format == FormatMP4 {
+		for _, p := range fullProfiles {
+			p.Format = net.VideoProfile_MP4
+		}
+	}
+	SetNetRenditionProfiles(fullProfiles, md.Profiles, md.Renditions)
 
 	msg := &net.NotifySegment{
-		Job:          job,
+		Job:          string(md.ManifestID),
 		Url:          fname,
 		TaskId:       taskID,
 		FullProfiles: fullProfiles,
+		// Lets the transcoder upload the renditions into the broadcaster's
+		// storage rather than through us
+		Storage: md.OS,
+		SeqNo:   md.Seq,
 	}
-	err = rt.stream.Send(msg)
+	err = rt.send(msg)
 
 	if err != nil {
 		return signalEOF(err)
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), RemoteTranscoderTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 	select {
 	case <-ctx.Done():
+		if timeout < RemoteTranscoderTimeout {
+			// Cut short by the segment's deadline, which doesn't make the
+			// transcoder unresponsive; heartbeats catch those that are
+			glog.Errorf("Segment deadline reached on remote transcoder=%s taskId=%d fname=%s timeout=%v", rt.addr, taskID, fname, timeout)
+			return nil, ErrRemoteTranscoderTimeout
+		}
 		return signalEOF(ErrRemoteTranscoderTimeout)
 	case chanData := <-taskChan:
-		glog.Infof("Successfully received results from remote transcoder=%s segments=%d taskId=%d fname=%s err=%v",
-			rt.addr, len(chanData.TranscodeData.Segments), taskID, fname, chanData.Err)
+		rt.manager.seen(rt)
+		glog.Infof("Successfully received results from remote transcoder=%s name=%s segments=%d taskId=%d fname=%s err=%v",
+			rt.addr, rt.name, len(chanData.TranscodeData.Segments), taskID, fname, chanData.Err)
+		chanData.TranscodeData.Transcoder = rt.name
+		if rt.name == "" {
+			chanData.TranscodeData.Transcoder = rt.addr
+		}
 		return chanData.TranscodeData, chanData.Err
 	}
 }
-func NewRemoteTranscoder(m *RemoteTranscoderManager, stream net.Transcoder_RegisterTranscoderServer, capacity int) *RemoteTranscoder {
+func NewRemoteTranscoder(m *RemoteTranscoderManager, stream net.Transcoder_RegisterTranscoderServer, name string, capacity int, caps *net.Capabilities) *RemoteTranscoder {
+	if caps == nil {
+		// Transcoder predates capability advertisement
+		caps = LegacyCapabilities()
+	}
 	return &RemoteTranscoder{
-		manager:  m,
-		stream:   stream,
-		eof:      make(chan struct{}, 1),
-		capacity: capacity,
-		addr:     common.GetConnectionAddr(stream.Context()),
+		manager:      m,
+		stream:       stream,
+		eof:          make(chan struct{}, 1),
+		capacity:     capacity,
+		capabilities: caps,
+		addr:         common.GetConnectionAddr(stream.Context()),
+		name:         name,
+		lastSeen:     time.Now(),
 	}
 }
 
@@ -732,15 +931,18 @@ func NewRemoteTranscoderManager() *RemoteTranscoderManager {
 		liveTranscoders:   map[net.Transcoder_RegisterTranscoderServer]*RemoteTranscoder{},
 		RTmutex:           &sync.Mutex{},
 
-		taskMutex: &sync.RWMutex{},
-		taskChans: make(map[int64]TranscoderChan),
+		taskMutex:  &sync.RWMutex{},
+		taskChans:  make(map[int64]TranscoderChan),
+		taskOwners: make(map[int64]string),
 	}
 }
 
 type byLoadFactor []*RemoteTranscoder
 
+// Transcoders count their error score as extra load, so those that failed
+// recently are picked after healthier ones
 func loadFactor(r *RemoteTranscoder) float64 {
-	return float64(r.load) / float64(r.capacity)
+	return (float64(r.load) + r.errorScore) / float64(r.capacity)
 }
 
 func (r byLoadFactor) Len() int      { return len(r) }
@@ -754,10 +956,21 @@ type RemoteTranscoderManager struct {
 	liveTranscoders   map[net.Transcoder_RegisterTranscoderServer]*RemoteTranscoder
 	RTmutex           *sync.Mutex
 
+	// Transcodes segments that no remote transcoder could, if set
+	fallback Transcoder
+
 	// For tracking tasks assigned to remote transcoders
 	taskMutex *sync.RWMutex
 	taskChans map[int64]TranscoderChan
-	taskCount int64
+	// Name of the transcoder each task was assigned to
+	taskOwners map[int64]string
+	taskCount  int64
+}
+
+// SetLocalFallback sets a transcoder to use for segments when no remote
+// transcoder is available, or all of those tried have failed
+func (rtm *RemoteTranscoderManager) SetLocalFallback(t Transcoder) {
+	rtm.fallback = t
 }
 
 // RegisteredTranscodersCount returns number of registered transcoders
@@ -772,16 +985,97 @@ func (rtm *RemoteTranscoderManager) RegisteredTranscodersInfo() []net.RemoteTran
 	rtm.RTmutex.Lock()
 	res := make([]net.RemoteTranscoderInfo, 0, len(rtm.liveTranscoders))
 	for _, transcoder := range rtm.liveTranscoders {
-		res = append(res, net.RemoteTranscoderInfo{Address: transcoder.addr, Capacity: transcoder.capacity})
+		res = append(res, net.RemoteTranscoderInfo{Address: transcoder.addr, Name: transcoder.name, Capacity: transcoder.capacity})
 	}
 	rtm.RTmutex.Unlock()
 	return res
 }
 
-// Manage adds transcoder to list of live transcoders. Doesn't return untill transcoder disconnects
-func (rtm *RemoteTranscoderManager) Manage(stream net.Transcoder_RegisterTranscoderServer, capacity int) {
+// RegisteredTranscodersState returns the state of each registered
+// transcoder, ordered by address
+func (rtm *RemoteTranscoderManager) RegisteredTranscodersState() []net.RemoteTranscoderState {
+	rtm.RTmutex.Lock()
+	res := make([]net.RemoteTranscoderState, 0, len(rtm.liveTranscoders))
+	for _, t := range rtm.liveTranscoders {
+		res = append(res, net.RemoteTranscoderState{
+			Address:    t.addr,
+			Name:       t.name,
+			Capacity:   t.capacity,
+			Load:       t.load,
+			Errors:     t.errors,
+			ErrorScore: t.errorScore,
+			LastSeen:   t.lastSeen,
+			Draining:   t.draining,
+		})
+	}
+	rtm.RTmutex.Unlock()
+	sort.Slice(res, func(i, j int) bool { return res[i].Address < res[j].Address })
+	return res
+}
+
+// Drain stops assigning tasks to the transcoder at the given address, and
+// disconnects it once the tasks it is running are done
+func (rtm *RemoteTranscoderManager) Drain(addr string) error {
+	rtm.RTmutex.Lock()
+	defer rtm.RTmutex.Unlock()
+	for _, t := range rtm.liveTranscoders {
+		if t.addr != addr {
+			continue
+		}
+		glog.Infof("Draining transcoder=%s load=%d", addr, t.load)
+		t.draining = true
+		if t.load <= 0 {
+			t.done()
+		}
+		return nil
+	}
+	return ErrUnknownTranscoder
+}
+
+// Disconnect disconnects the transcoders that authenticated with the named
+// token, returning how many there were
+func (rtm *RemoteTranscoderManager) Disconnect(name string) int {
+	rtm.RTmutex.Lock()
+	defer rtm.RTmutex.Unlock()
+	count := 0
+	for _, t := range rtm.liveTranscoders {
+		if t.name != name {
+			continue
+		}
+		glog.Infof("Disconnecting transcoder=%s name=%s", t.addr, name)
+		t.done()
+		count++
+	}
+	return count
+}
+
+func (rtm *RemoteTranscoderManager) seen(t *RemoteTranscoder) {
+	rtm.RTmutex.Lock()
+	t.lastSeen = time.Now()
+	rtm.RTmutex.Unlock()
+}
+
+// Capabilities returns the capabilities shared by all live transcoders, or
+// nil if there are none
+func (rtm *RemoteTranscoderManager) Capabilities() *net.Capabilities {
+	rtm.RTmutex.Lock()
+	defer rtm.RTmutex.Unlock()
+	var caps *net.Capabilities
+	for _, transcoder := range rtm.liveTranscoders {
+		if caps == nil {
+			caps = transcoder.capabilities
+			continue
+		}
+		caps = IntersectCapabilities(caps, transcoder.capabilities)
+	}
+	return caps
+}
+
+// Manage adds transcoder to list of live transcoders. Doesn't return untill transcoder disconnects.
+// Returns ErrTranscoderDrained if the transcoder was disconnected by draining it.
+func (rtm *RemoteTranscoderManager) Manage(stream net.Transcoder_RegisterTranscoderServer, name string, capacity int, caps *net.Capabilities) error {
 	from := common.GetConnectionAddr(stream.Context())
-	transcoder := NewRemoteTranscoder(rtm, stream, capacity)
+	transcoder := NewRemoteTranscoder(rtm, stream, name, capacity, caps)
 	go func() {
 		ctx := stream.Context()
 		<-ctx.Done()
@@ -803,11 +1097,16 @@ func (rtm *RemoteTranscoderManager) Manage(stream net.Transcoder_RegisterTransco
 		monitor.SetTranscodersNumberAndLoad(totalLoad, totalCapacity, liveTranscodersNum)
 	}
 
+	stopHeartbeats := make(chan struct{})
+	go transcoder.checkHeartbeats(stopHeartbeats)
+
 	<-transcoder.eof
+	close(stopHeartbeats)
 	glog.Infof("Got transcoder=%s eof, removing from live transcoders map", from)
 
 	rtm.RTmutex.Lock()
 	delete(rtm.liveTranscoders, transcoder.stream)
+	drained := transcoder.draining
 	if monitor.Enabled {
 		totalLoad, totalCapacity, liveTranscodersNum = rtm.totalLoadAndCapacity()
 	}
@@ -815,27 +1114,33 @@ func (rtm *RemoteTranscoderManager) Manage(stream net.Transcoder_RegisterTransco
 	if monitor.Enabled {
 		monitor.SetTranscodersNumberAndLoad(totalLoad, totalCapacity, liveTranscodersNum)
 	}
+	if drained {
+		return ErrTranscoderDrained
+	}
+	return nil
 }
 
-func (rtm *RemoteTranscoderManager) selectTranscoder() *RemoteTranscoder {
+// selectTranscoder picks the live transcoder with the lowest load factor
+// that has spare capacity, skipping any in exclude
+func (rtm *RemoteTranscoderManager) selectTranscoder(exclude map[*RemoteTranscoder]bool) *RemoteTranscoder {
 	rtm.RTmutex.Lock()
 	defer rtm.RTmutex.Unlock()
 
-	checkTranscoders := func(rtm *RemoteTranscoderManager) bool {
-		return len(rtm.remoteTranscoders) > 0
-	}
-
-	for checkTranscoders(rtm) {
-		last := len(rtm.remoteTranscoders) - 1
-		currentTranscoder := rtm.remoteTranscoders[last]
+	// Transcoders are sorted by descending load factor, so start at the end
+	for i := len(rtm.remoteTranscoders) - 1; i >= 0; i-- {
+		currentTranscoder := rtm.remoteTranscoders[i]
 		if _, ok := rtm.liveTranscoders[currentTranscoder.stream]; !ok {
 			// transcoder does not exist in table; remove and retry
-			rtm.remoteTranscoders = rtm.remoteTranscoders[:last]
+			rtm.remoteTranscoders = append(rtm.remoteTranscoders[:i], rtm.remoteTranscoders[i+1:]...)
 			continue
 		}
-		if currentTranscoder.load == currentTranscoder.capacity {
-			// Head of queue is at capacity, so the rest must be too. Exit early
-			return nil
+		if currentTranscoder.draining || exclude[currentTranscoder] {
+			continue
+		}
+		if currentTranscoder.load >= currentTranscoder.capacity {
+			// The error score is part of the load factor, so transcoders
+			// further down the queue may still have capacity
+			continue
 		}
 		currentTranscoder.load++
 		sort.Sort(byLoadFactor(rtm.remoteTranscoders))
@@ -855,6 +1160,24 @@ func (rtm *RemoteTranscoderManager) completeTranscoders(trans *RemoteTranscoder)
 	}
 	t.load--
 	sort.Sort(byLoadFactor(rtm.remoteTranscoders))
+	if t.draining && t.load <= 0 {
+		glog.Infof("Drained transcoder=%s", t.addr)
+		t.done()
+	}
+}
+
+// updateErrorScore records the outcome of a task on the transcoder. Each
+// failure adds one to its error score, and each success halves it.
+func (rtm *RemoteTranscoderManager) updateErrorScore(t *RemoteTranscoder, err error) {
+	rtm.RTmutex.Lock()
+	defer rtm.RTmutex.Unlock()
+	if err != nil {
+		t.errors++
+		t.errorScore++
+	} else {
+		t.errorScore /= 2
+	}
+	sort.Sort(byLoadFactor(rtm.remoteTranscoders))
 }
 
 // Caller of this function should hold RTmutex lock
@@ -867,22 +1190,50 @@ func (rtm *RemoteTranscoderManager) totalLoadAndCapacity() (int, int, int) {
 	return load, capacity, len(rtm.liveTranscoders)
 }
 
-// Transcode does actual transcoding using remote transcoder from the pool
-func (rtm *RemoteTranscoderManager) Transcode(job string, fname string, profiles []ffmpeg.VideoProfile) (*TranscodeData, error) {
-	currentTranscoder := rtm.selectTranscoder()
-	if currentTranscoder == nil {
-		return nil, errors.New("No transcoders available")
-	}
-	res, err := currentTranscoder.Transcode(job, fname, profiles)
-	_, fatal := err.(RemoteTranscoderFatalError)
-	if fatal {
-		// Don't retry if we've timed out; broadcaster likely to have moved on
-		// XXX problematic for VOD when we *should* retry
-		if err.(RemoteTranscoderFatalError).error == ErrRemoteTranscoderTimeout {
-			return res, err
+// Transcode does actual transcoding using remote transcoder from the pool.
+// Failed tasks are retried on other transcoders, and then on the local
+// fallback if there is one, until the segment's deadline has passed. Each
+// attempt gets at most half of the time left before the deadline, so a
+// transcoder that times out leaves time for another one. Transcoders are
+// only disconnected when they time out on the full RemoteTranscoderTimeout.
+func (rtm *RemoteTranscoderManager) Transcode(md *SegTranscodingMetadata) (*TranscodeData, error) {
+	deadline := md.Deadline
+	if deadline.IsZero() {
+		deadline = time.Now().Add(RemoteTranscodeDeadline)
+	}
+	tried := make(map[*RemoteTranscoder]bool)
+	var err error
+	for {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			break
+		}
+		currentTranscoder := rtm.selectTranscoder(tried)
+		if currentTranscoder == nil {
+			break
+		}
+		tried[currentTranscoder] = true
+		timeout := RemoteTranscoderTimeout
+		if remaining/2 < timeout {
+			timeout = remaining / 2
 		}
-		return rtm.Transcode(job, fname, profiles)
+		var res *TranscodeData
+		res, err = currentTranscoder.transcode(md, timeout)
+		rtm.completeTranscoders(currentTranscoder)
+		rtm.updateErrorScore(currentTranscoder, err)
+		if err == nil {
+			return res, nil
+		}
+		glog.Errorf("Task failed on transcoder=%s manifestID=%s fname=%s attempts=%d err=%v",
+			currentTranscoder.addr, md.ManifestID, md.Fname, len(tried), err)
+	}
+	if rtm.fallback != nil && time.Now().Before(deadline) {
+		glog.Infof("Transcoding with local fallback manifestID=%s fname=%s attempts=%d", md.ManifestID, md.Fname, len(tried))
+		return rtm.fallback.Transcode(md)
+	}
+	if _, fatal := err.(RemoteTranscoderFatalError); err == nil || fatal {
+		// Transcoders with fatal errors are gone
+		return nil, ErrNoTranscodersAvailable
 	}
-	rtm.completeTranscoders(currentTranscoder)
-	return res, err
+	return nil, err
 }
@@ -1,8 +1,12 @@
 package core
 
 import (
+	"context"
 	"fmt"
+	"path"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/livepeer/go-livepeer/drivers"
@@ -12,6 +16,12 @@ import (
 
 const LIVE_LIST_LENGTH uint = 6
 
+// Group of the audio-only renditions in the master playlist
+const audioGroupID = "audio"
+
+// Codecs advertised for audio, assuming AAC
+const audioCodecs = "mp4a.40.2"
+
 //	PlaylistManager manages playlists and data for one video stream, backed by one object storage.
 type PlaylistManager interface {
 	ManifestID() ManifestID
@@ -19,10 +29,38 @@ type PlaylistManager interface {
 	// Inserts in media playlist given a link to a segment
 	InsertHLSSegment(profile *ffmpeg.VideoProfile, seqNo uint64, uri string, duration float64) error
 
+	// Sets the initialization section (EXT-X-MAP) referenced by segments
+	// subsequently inserted for the profile. Used for fragmented MP4.
+	SetHLSInitSegment(profile *ffmpeg.VideoProfile, uri string)
+
 	GetHLSMasterPlaylist() *m3u8.MasterPlaylist
 
+	// Updates the bandwidth and resolution advertised for a rendition in the
+	// master playlist, eg. as measured from its segments. The bandwidth only
+	// increases, as it's the peak bitrate; zero values are ignored.
+	UpdateHLSVariant(rendition string, bandwidth uint32, resolution string)
+
 	GetHLSMediaPlaylist(rendition string) *m3u8.MediaPlaylist
 
+	// Dynamic MPEG-DASH manifest covering the same segments as the HLS playlists
+	GetDASHManifest() *MPD
+
+	// Thumbnail renditions. Inserted images are saved at the rendition's
+	// interval and listed in its JSON index rather than in playlists.
+	InsertThumbnail(profile *ffmpeg.VideoProfile, seqNo uint64, data []byte, duration float64) error
+	GetThumbnailIndex(rendition string) *ThumbnailIndex
+
+	// Low-latency HLS. Each inserted part is listed as an EXT-X-PART; parts
+	// are concatenated into full segments of LLHLSSegmentDuration. Parts
+	// are marked independent if they start with a keyframe.
+	LowLatencyHLS() bool
+	InsertHLSPart(profile *ffmpeg.VideoProfile, seqNo uint64, uri string, duration float64, independent bool) error
+	// Returns the low-latency media playlist, blocking as requested
+	GetLLHLSMediaPlaylist(ctx context.Context, rendition string, req LLHLSRequest) ([]byte, error)
+	// Returns the storage URI of a part once it is available, or an empty
+	// string if it never will be
+	GetLLHLSPart(ctx context.Context, rendition string, msn, part uint64) (string, error)
+
 	GetOSSession() drivers.OSSession
 
 	Cleanup()
@@ -34,7 +72,25 @@ type BasicPlaylistManager struct {
 	// Live playlist used for broadcasting
 	masterPList *m3u8.MasterPlaylist
 	mediaLists  map[string]*m3u8.MediaPlaylist
+	initMaps    map[string]*m3u8.Map
 	mapSync     *sync.RWMutex
+	// Start of the stream and, per rendition, the total duration of the
+	// segments that slid out of the window. Used for DASH timelines.
+	startTime time.Time
+	elapsed   map[string]float64
+	// Low-latency playlists; nil unless enabled
+	llLists map[string]*llhlsPlaylist
+	// Parts per full low-latency segment, set from the first part so that
+	// all renditions number their parts alike
+	llParts uint64
+	// Audio, encoding and thumbnail settings of the renditions
+	renditions RenditionProfiles
+	// Audio-only renditions listed as alternatives in the master playlist
+	audioGroup []*m3u8.Alternative
+	// Indexes of the thumbnail renditions
+	thumbTracks map[string]*thumbnailTrack
+	// Renditions served without being listed in the master playlist
+	unlisted map[string]bool
 }
 
 // NewBasicPlaylistManager create new BasicPlaylistManager struct
@@ -46,11 +102,52 @@ func NewBasicPlaylistManager(manifestID ManifestID,
 		manifestID:     manifestID,
 		masterPList:    m3u8.NewMasterPlaylist(),
 		mediaLists:     make(map[string]*m3u8.MediaPlaylist),
+		initMaps:       make(map[string]*m3u8.Map),
 		mapSync:        &sync.RWMutex{},
+		startTime:      time.Now(),
+		elapsed:        make(map[string]float64),
+		thumbTracks:    make(map[string]*thumbnailTrack),
 	}
 	return bplm
 }
 
+// EnableLowLatencyHLS switches the manager to low-latency HLS. Must be
+// called before any segment is inserted.
+func (mgr *BasicPlaylistManager) EnableLowLatencyHLS() {
+	mgr.mapSync.Lock()
+	defer mgr.mapSync.Unlock()
+	if mgr.llLists == nil {
+		mgr.llLists = make(map[string]*llhlsPlaylist)
+	}
+}
+
+// SetRenditionProfiles sets the audio, encoding and thumbnail settings of
+// the renditions, which determine how they are listed in the master
+// playlist. Must be called before any segment is inserted.
+func (mgr *BasicPlaylistManager) SetRenditionProfiles(renditions RenditionProfiles) {
+	mgr.mapSync.Lock()
+	defer mgr.mapSync.Unlock()
+	mgr.renditions = renditions
+}
+
+// UnlistHLSVariant keeps the rendition out of the master playlist, while
+// still serving its media playlist. Must be called before any segment is
+// inserted.
+func (mgr *BasicPlaylistManager) UnlistHLSVariant(rendition string) {
+	mgr.mapSync.Lock()
+	defer mgr.mapSync.Unlock()
+	if mgr.unlisted == nil {
+		mgr.unlisted = make(map[string]bool)
+	}
+	mgr.unlisted[rendition] = true
+}
+
+func (mgr *BasicPlaylistManager) LowLatencyHLS() bool {
+	mgr.mapSync.RLock()
+	defer mgr.mapSync.RUnlock()
+	return mgr.llLists != nil
+}
+
 func (mgr *BasicPlaylistManager) ManifestID() ManifestID {
 	return mgr.manifestID
 }
@@ -82,12 +179,52 @@ func (mgr *BasicPlaylistManager) getOrCreatePL(profile *ffmpeg.VideoProfile) (*m
 		return nil, err
 	}
 	mgr.mediaLists[profile.Name] = mpl
-	vParams := ffmpeg.VideoProfileToVariantParams(*profile)
+	if mgr.unlisted[profile.Name] {
+		return mpl, nil
+	}
 	url := fmt.Sprintf("%v/%v.m3u8", mgr.manifestID, profile.Name)
+	if audio := mgr.renditions[profile.Name].Audio; audio.AudioOnly {
+		mgr.appendAudioRendition(profile.Name, url, mpl, audio)
+		return mpl, nil
+	}
+	vParams := ffmpeg.VideoProfileToVariantParams(*profile)
+	if codecs := mgr.renditions[profile.Name].Encoding.Codecs(*profile); codecs != "" {
+		if mgr.renditions[profile.Name].Audio.Codec != AudioNone {
+			codecs += "," + audioCodecs
+		}
+		vParams.Codecs = codecs
+	}
+	if len(mgr.audioGroup) > 0 {
+		vParams.Audio, vParams.Alternatives = audioGroupID, mgr.audioGroup
+	}
 	mgr.masterPList.Append(url, mpl, vParams)
 	return mpl, nil
 }
 
+// appendAudioRendition lists an audio-only rendition in the master playlist,
+// both as a variant of its own for audio-only playback and as an alternative
+// in the audio group that the video renditions refer to
+func (mgr *BasicPlaylistManager) appendAudioRendition(name, url string, mpl *m3u8.MediaPlaylist, audio AudioProfile) {
+	mgr.audioGroup = append(mgr.audioGroup, &m3u8.Alternative{
+		GroupId:    audioGroupID,
+		URI:        url,
+		Type:       "AUDIO",
+		Name:       name,
+		Default:    len(mgr.audioGroup) == 0,
+		Autoselect: "YES",
+	})
+	for _, v := range mgr.masterPList.Variants {
+		if mgr.renditions[strings.TrimSuffix(path.Base(v.URI), ".m3u8")].Audio.AudioOnly {
+			continue
+		}
+		v.Audio, v.Alternatives = audioGroupID, mgr.audioGroup
+	}
+	mgr.masterPList.Append(url, mpl, m3u8.VariantParams{
+		Bandwidth: uint32(audio.Bandwidth()),
+		Codecs:    audioCodecs,
+	})
+}
+
 func (mgr *BasicPlaylistManager) InsertHLSSegment(profile *ffmpeg.VideoProfile, seqNo uint64, uri string,
 	duration float64) error {
 
@@ -96,7 +233,24 @@ func (mgr *BasicPlaylistManager) InsertHLSSegment(profile *ffmpeg.VideoProfile,
 		return err
 	}
 	mseg := newMediaSegment(uri, duration)
+	mgr.mapSync.RLock()
+	mseg.Map = mgr.initMaps[profile.Name]
+	mgr.mapSync.RUnlock()
+	return mgr.insertMediaSegment(profile.Name, mpl, seqNo, mseg)
+}
+
+// insertMediaSegment inserts into the media playlist, sliding the oldest
+// segment out of the window if it is full. Holds the write lock, since the
+// DASH manifest reads the segments of the playlists under the read lock.
+func (mgr *BasicPlaylistManager) insertMediaSegment(rendition string, mpl *m3u8.MediaPlaylist, seqNo uint64,
+	mseg *m3u8.MediaSegment) error {
+
+	mgr.mapSync.Lock()
+	defer mgr.mapSync.Unlock()
 	if mpl.Count() >= mpl.WinSize() {
+		if segs := mediaSegments(mpl); len(segs) > 0 {
+			mgr.elapsed[rendition] += segs[0].Duration
+		}
 		mpl.Remove()
 	}
 	if mpl.Count() == 0 {
@@ -106,9 +260,128 @@ func (mgr *BasicPlaylistManager) InsertHLSSegment(profile *ffmpeg.VideoProfile,
 	return mpl.InsertSegment(seqNo, mseg)
 }
 
-// GetHLSMasterPlaylist ..
+func (mgr *BasicPlaylistManager) getOrCreateLLPL(rendition string, partDuration float64) *llhlsPlaylist {
+	mgr.mapSync.Lock()
+	defer mgr.mapSync.Unlock()
+	if mgr.llLists == nil {
+		return nil
+	}
+	pl, ok := mgr.llLists[rendition]
+	if !ok {
+		if mgr.llParts == 0 {
+			mgr.llParts = llhlsPartsPerSegment(partDuration)
+		}
+		pl = newLLHLSPlaylist(fmt.Sprintf("/stream/%s/%s/part", mgr.manifestID, rendition), mgr.llParts)
+		mgr.llLists[rendition] = pl
+	}
+	return pl
+}
+
+func (mgr *BasicPlaylistManager) InsertHLSPart(profile *ffmpeg.VideoProfile, seqNo uint64, uri string,
+	duration float64, independent bool) error {
+
+	llpl := mgr.getOrCreateLLPL(profile.Name, duration)
+	if llpl == nil {
+		return ErrLLHLSDisabled
+	}
+	mpl, err := mgr.getOrCreatePL(profile)
+	if err != nil {
+		return err
+	}
+	mgr.mapSync.RLock()
+	initMap := mgr.initMaps[profile.Name]
+	mgr.mapSync.RUnlock()
+	part := llhlsPart{seqNo: seqNo, uri: uri, duration: duration, independent: independent}
+	if initMap != nil {
+		part.initURI = initMap.URI
+	}
+	ext := path.Ext(uri)
+
+	llpl.insertLock.Lock()
+	defer llpl.insertLock.Unlock()
+	// Parts held back may complete several segments at once
+	parts, msn := llpl.addPart(part)
+	for len(parts) > 0 {
+		// Assemble the full segment from its parts
+		var data []byte
+		for _, p := range parts {
+			d, err := mgr.getPartData(p.uri)
+			if err != nil {
+				glog.Errorf("Error fetching LL-HLS part manifestID=%s uri=%s err=%v", mgr.manifestID, p.uri, err)
+				return err
+			}
+			data = append(data, d...)
+		}
+		name := fmt.Sprintf("%s/seg/%d%s", profile.Name, msn, ext)
+		segURI, err := mgr.storageSession.SaveData(name, data)
+		if err != nil {
+			glog.Errorf("Error saving LL-HLS segment manifestID=%s name=%s err=%v", mgr.manifestID, name, err)
+			return err
+		}
+		completed := parts
+		parts, msn = llpl.completeSegment(segURI, completed)
+
+		// Keep the regular media playlist in sync with the full segments
+		mseg := newMediaSegment(segURI, 0)
+		for _, p := range completed {
+			mseg.Duration += p.duration
+		}
+		mseg.Map = initMap
+		mseg.SeqId = completed[0].seqNo / llpl.n
+		if err := mgr.insertMediaSegment(profile.Name, mpl, mseg.SeqId, mseg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (mgr *BasicPlaylistManager) getPartData(uri string) ([]byte, error) {
+	if local, ok := mgr.storageSession.(drivers.LocalSession); ok {
+		if data := local.GetData(uri); data != nil {
+			return data, nil
+		}
+	}
+	return drivers.GetSegmentData(uri)
+}
+
+func (mgr *BasicPlaylistManager) SetHLSInitSegment(profile *ffmpeg.VideoProfile, uri string) {
+	mgr.mapSync.Lock()
+	defer mgr.mapSync.Unlock()
+	if m, ok := mgr.initMaps[profile.Name]; ok && m.URI == uri {
+		return
+	}
+	mgr.initMaps[profile.Name] = &m3u8.Map{URI: uri}
+}
+
+// GetHLSMasterPlaylist returns a copy of the master playlist, as its
+// variants keep being updated while the stream is live
 func (mgr *BasicPlaylistManager) GetHLSMasterPlaylist() *m3u8.MasterPlaylist {
-	return mgr.masterPList
+	mgr.mapSync.RLock()
+	defer mgr.mapSync.RUnlock()
+	masterPL := m3u8.NewMasterPlaylist()
+	for _, v := range mgr.masterPList.Variants {
+		masterPL.Append(v.URI, v.Chunklist, v.VariantParams)
+	}
+	return masterPL
+}
+
+// UpdateHLSVariant raises the bandwidth and sets the resolution advertised
+// for the rendition in the master playlist
+func (mgr *BasicPlaylistManager) UpdateHLSVariant(rendition string, bandwidth uint32, resolution string) {
+	mgr.mapSync.Lock()
+	defer mgr.mapSync.Unlock()
+	url := fmt.Sprintf("%v/%v.m3u8", mgr.manifestID, rendition)
+	for _, v := range mgr.masterPList.Variants {
+		if v.URI != url {
+			continue
+		}
+		if bandwidth > v.Bandwidth {
+			v.Bandwidth = bandwidth
+		}
+		if resolution != "" {
+			v.Resolution = resolution
+		}
+	}
 }
 
 // GetHLSMediaPlaylist ...
@@ -116,6 +389,42 @@ func (mgr *BasicPlaylistManager) GetHLSMediaPlaylist(rendition string) *m3u8.Med
 	return mgr.getPL(rendition)
 }
 
+// GetLLHLSMediaPlaylist returns the encoded low-latency media playlist for
+// the rendition once it satisfies the blocking request. Waits at most three
+// target durations before returning ErrLLHLSTimeout.
+func (mgr *BasicPlaylistManager) GetLLHLSMediaPlaylist(ctx context.Context, rendition string,
+	req LLHLSRequest) ([]byte, error) {
+
+	mgr.mapSync.RLock()
+	if mgr.llLists == nil {
+		mgr.mapSync.RUnlock()
+		return nil, ErrLLHLSDisabled
+	}
+	llpl := mgr.llLists[rendition]
+	mgr.mapSync.RUnlock()
+	if llpl == nil {
+		return nil, nil
+	}
+	return llpl.wait(ctx, req)
+}
+
+// GetLLHLSPart returns the storage URI of a low-latency part, waiting for
+// it like GetLLHLSMediaPlaylist since it may be requested from the preload
+// hint before it is available
+func (mgr *BasicPlaylistManager) GetLLHLSPart(ctx context.Context, rendition string, msn, part uint64) (string, error) {
+	mgr.mapSync.RLock()
+	if mgr.llLists == nil {
+		mgr.mapSync.RUnlock()
+		return "", ErrLLHLSDisabled
+	}
+	llpl := mgr.llLists[rendition]
+	mgr.mapSync.RUnlock()
+	if llpl == nil {
+		return "", nil
+	}
+	return llpl.waitPart(ctx, msn, part)
+}
+
 func newMediaSegment(uri string, duration float64) *m3u8.MediaSegment {
 	return &m3u8.MediaSegment{
 		URI:      uri,
@@ -2,7 +2,10 @@ package core
 
 import (
 	"bytes"
+	"fmt"
 	"net/url"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/livepeer/go-livepeer/drivers"
@@ -56,6 +59,7 @@ func TestGetOrCreatePL(t *testing.T) {
 	}
 
 	// Sanity check some master PL properties
+	masterPL = c.GetHLSMasterPlaylist()
 	expectedRes := vProfile.Resolution
 	if len(masterPL.Variants) != 1 || masterPL.Variants[0].Resolution != expectedRes {
 		t.Error("Master PL had some unexpected variants or properties")
@@ -69,6 +73,7 @@ func TestGetOrCreatePL(t *testing.T) {
 		t.Error("Mismatched profile or error ", err)
 	}
 	// Further sanity check some master PL properties
+	masterPL = c.GetHLSMasterPlaylist()
 	if len(masterPL.Variants) != 1 || masterPL.Variants[0].Resolution != expectedRes {
 		t.Error("Master PL had some unexpected variants or properties")
 	}
@@ -80,6 +85,7 @@ func TestGetOrCreatePL(t *testing.T) {
 		t.Error("Matched profile or error ", err)
 	}
 	// Further sanity check some master PL properties
+	masterPL = c.GetHLSMasterPlaylist()
 	if len(masterPL.Variants) != 2 || masterPL.Variants[1].Resolution != vProfile.Resolution {
 		t.Error("Master PL had some unexpected variants or properties")
 	}
@@ -186,3 +192,195 @@ func TestCleanup(t *testing.T) {
 		t.Fatal("Data should be cleaned up")
 	}
 }
+
+func TestSetHLSInitSegment(t *testing.T) {
+	c := NewBasicPlaylistManager(RandomManifestID(), nil)
+	vProfile := &ffmpeg.P144p30fps16x9
+
+	// No init section by default
+	if err := c.InsertHLSSegment(vProfile, 1, "test_seg/1.ts", 2); err != nil {
+		t.Fatal(err)
+	}
+	c.SetHLSInitSegment(vProfile, "test_seg/init/a.mp4")
+	if err := c.InsertHLSSegment(vProfile, 2, "test_seg/2.m4s", 2); err != nil {
+		t.Fatal(err)
+	}
+	// Same init section is reused
+	c.SetHLSInitSegment(vProfile, "test_seg/init/a.mp4")
+	if err := c.InsertHLSSegment(vProfile, 3, "test_seg/3.m4s", 2); err != nil {
+		t.Fatal(err)
+	}
+
+	mpl := c.GetHLSMediaPlaylist(vProfile.Name)
+	if mpl.Segments[0].Map != nil {
+		t.Error("Unexpected map for first segment")
+	}
+	if mpl.Segments[1].Map == nil || mpl.Segments[1].Map.URI != "test_seg/init/a.mp4" {
+		t.Error("Expected map for second segment")
+	}
+	if mpl.Segments[1].Map != mpl.Segments[2].Map {
+		t.Error("Expected map to be shared between segments")
+	}
+
+	// Other renditions are unaffected
+	if err := c.InsertHLSSegment(&ffmpeg.P240p30fps16x9, 1, "other/1.ts", 2); err != nil {
+		t.Fatal(err)
+	}
+	if c.GetHLSMediaPlaylist(ffmpeg.P240p30fps16x9.Name).Segments[0].Map != nil {
+		t.Error("Unexpected map for other rendition")
+	}
+}
+
+func TestAudioRenditions(t *testing.T) {
+	mid := RandomManifestID()
+	c := NewBasicPlaylistManager(mid, nil)
+	audio := &ffmpeg.VideoProfile{Name: "audio_64k"}
+	c.SetRenditionProfiles(RenditionProfiles{
+		audio.Name:                 {Audio: AudioProfile{Codec: AudioAAC, Bitrate: 64000, AudioOnly: true}},
+		ffmpeg.P144p30fps16x9.Name: {Audio: AudioProfile{Codec: AudioNone}},
+	})
+
+	// Video renditions refer to the audio group once it exists
+	if err := c.InsertHLSSegment(&ffmpeg.P144p30fps16x9, 1, "test_seg/1.ts", 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.InsertHLSSegment(audio, 1, "audio_64k/1.ts", 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.InsertHLSSegment(&ffmpeg.P240p30fps16x9, 1, "other/1.ts", 2); err != nil {
+		t.Fatal(err)
+	}
+
+	masterPL := c.GetHLSMasterPlaylist()
+	if len(masterPL.Variants) != 3 {
+		t.Fatal("Unexpected variants ", len(masterPL.Variants))
+	}
+	for _, i := range []int{0, 2} {
+		v := masterPL.Variants[i]
+		if v.Audio != "audio" || len(v.Alternatives) != 1 {
+			t.Error("Expected audio group for variant ", v.URI)
+		}
+	}
+	alt := masterPL.Variants[0].Alternatives[0]
+	if alt.Type != "AUDIO" || alt.GroupId != "audio" || alt.Name != audio.Name || !alt.Default ||
+		alt.URI != fmt.Sprintf("%v/%v.m3u8", mid, audio.Name) {
+		t.Error("Unexpected audio alternative ", alt)
+	}
+
+	// Audio-only renditions are also variants for audio-only playback
+	v := masterPL.Variants[1]
+	if v.Audio != "" || v.Resolution != "" || v.Codecs != "mp4a.40.2" || v.Bandwidth != 64000 {
+		t.Error("Unexpected audio variant ", v.VariantParams)
+	}
+	if !strings.Contains(masterPL.String(), "TYPE=AUDIO") {
+		t.Error("Expected audio group in master playlist ", masterPL.String())
+	}
+
+	// Audio-only renditions are listed as audio in DASH manifests
+	sets := c.GetDASHManifest().Periods[0].AdaptationSets
+	if len(sets) != 3 || sets[0].MimeType != "video/mp2t" || sets[1].MimeType != "audio/mp2t" {
+		t.Error("Unexpected DASH adaptation sets ", sets)
+	}
+}
+
+func TestVideoEncodingCodecs(t *testing.T) {
+	c := NewBasicPlaylistManager(RandomManifestID(), nil)
+	profiles := []ffmpeg.VideoProfile{
+		{Name: "low", Resolution: "256x144", Bitrate: "200k", Framerate: 30},
+		{Name: "hd", Resolution: "1920x1080", Bitrate: "6000k", Framerate: 60},
+		{Name: "default", Resolution: "640x360", Bitrate: "1000k"},
+	}
+	c.SetRenditionProfiles(RenditionProfiles{
+		"low":     {Encoding: VideoEncoding{Profile: ProfileH264Baseline}},
+		"hd":      {Encoding: VideoEncoding{Codec: CodecH265}, Audio: AudioProfile{Codec: AudioNone}},
+		"default": {Encoding: VideoEncoding{GOP: 30}},
+	})
+	for i := range profiles {
+		if err := c.InsertHLSSegment(&profiles[i], 1, profiles[i].Name+"/1.ts", 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Codecs are advertised when known, with audio unless it's stripped
+	variants := c.GetHLSMasterPlaylist().Variants
+	expected := []string{"avc1.42E00C,mp4a.40.2", "hvc1.1.6.L123.90", ""}
+	for i, codecs := range expected {
+		if variants[i].Codecs != codecs {
+			t.Errorf("Expected codecs=%q for %s, got %q", codecs, profiles[i].Name, variants[i].Codecs)
+		}
+	}
+	if !strings.Contains(c.GetHLSMasterPlaylist().String(), `CODECS="hvc1.1.6.L123.90"`) {
+		t.Error("Expected codecs in master playlist")
+	}
+	rep := c.GetDASHManifest().Periods[0].AdaptationSets[1].Representations[0]
+	if rep.Codecs != "hvc1.1.6.L123.90" {
+		t.Error("Unexpected DASH codecs ", rep.Codecs)
+	}
+}
+
+func TestUpdateHLSVariant(t *testing.T) {
+	mid := RandomManifestID()
+	c := NewBasicPlaylistManager(mid, nil)
+	source := &ffmpeg.VideoProfile{Name: "source", Resolution: "0x0", Bitrate: "4000k"}
+	if err := c.InsertHLSSegment(source, 1, "source/1.ts", 2); err != nil {
+		t.Fatal(err)
+	}
+
+	c.UpdateHLSVariant(source.Name, 2500000, "1280x720")
+	v := c.GetHLSMasterPlaylist().Variants[0]
+	if v.Bandwidth != 2500000 || v.Resolution != "1280x720" {
+		t.Error("Unexpected variant ", v.VariantParams)
+	}
+
+	// The bandwidth is the peak, and unknown values are kept
+	c.UpdateHLSVariant(source.Name, 1000000, "")
+	c.UpdateHLSVariant("unknown", 9000000, "1920x1080")
+	v = c.GetHLSMasterPlaylist().Variants[0]
+	if v.Bandwidth != 2500000 || v.Resolution != "1280x720" {
+		t.Error("Unexpected variant ", v.VariantParams)
+	}
+	c.UpdateHLSVariant(source.Name, 3000000, "1920x1080")
+	v = c.GetHLSMasterPlaylist().Variants[0]
+	if v.Bandwidth != 3000000 || v.Resolution != "1920x1080" {
+		t.Error("Unexpected variant ", v.VariantParams)
+	}
+
+	// Returned playlists are copies, so can be read while the stream updates
+	v.Bandwidth = 1
+	if c.GetHLSMasterPlaylist().Variants[0].Bandwidth != 3000000 {
+		t.Error("Master playlist was modified through a returned copy")
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			c.UpdateHLSVariant(source.Name, uint32(3000000+i), "1920x1080")
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		_ = c.GetHLSMasterPlaylist().String()
+	}
+	wg.Wait()
+}
+
+func TestUnlistHLSVariant(t *testing.T) {
+	c := NewBasicPlaylistManager(RandomManifestID(), nil)
+	source := &ffmpeg.VideoProfile{Name: "source", Resolution: "1280x720", Bitrate: "4000k"}
+	c.UnlistHLSVariant(source.Name)
+	if err := c.InsertHLSSegment(source, 1, "source/1.ts", 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.InsertHLSSegment(&ffmpeg.P144p30fps16x9, 1, "P144p30fps16x9/1.ts", 2); err != nil {
+		t.Fatal(err)
+	}
+
+	// The media playlist is still served
+	if mpl := c.GetHLSMediaPlaylist(source.Name); mpl == nil || mpl.Segments[0].URI != "source/1.ts" {
+		t.Error("Expected source media playlist")
+	}
+	variants := c.GetHLSMasterPlaylist().Variants
+	if len(variants) != 1 || variants[0].Resolution != ffmpeg.P144p30fps16x9.Resolution {
+		t.Error("Unexpected variants ", variants)
+	}
+}
@@ -0,0 +1,193 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/livepeer/go-livepeer/drivers"
+	ffmpeg "github.com/livepeer/lpms/ffmpeg"
+	"github.com/livepeer/m3u8"
+)
+
+var ErrRecordingFinalized = errors.New("ErrRecordingFinalized")
+var ErrRecordingQueueFull = errors.New("ErrRecordingQueueFull")
+
+// Name of the VOD master playlist within a recording
+const RecordingMasterPlaylist = "index.m3u8"
+
+// Number of segments that may be waiting to be stored for a recording.
+// Segments queued beyond that are dropped from the recording.
+var RecordingQueueSize = 64
+
+// SegmentStoreFunc stores a segment into the session of a recording and
+// returns the URI of the segment, and of its initialization section if any
+type SegmentStoreFunc func(sess drivers.OSSession) (string, string, error)
+
+type recordTask struct {
+	profile  ffmpeg.VideoProfile
+	seqNo    uint64
+	duration float64
+	store    SegmentStoreFunc
+}
+
+// StreamRecorder tracks the segments of a live stream persisted to object
+// storage, and writes VOD playlists for them once the stream ends.
+type StreamRecorder struct {
+	manifestID ManifestID
+	sess       drivers.OSSession
+
+	// Segments waiting to be stored, in the order they were recorded
+	queue chan *recordTask
+	done  chan struct{}
+
+	mu        sync.Mutex
+	profiles  []ffmpeg.VideoProfile
+	segments  map[string][]*m3u8.MediaSegment
+	closed    bool // no more segments are queued
+	finalized bool
+}
+
+// NewStreamRecorder creates a recorder writing into the given session
+func NewStreamRecorder(manifestID ManifestID, sess drivers.OSSession) *StreamRecorder {
+	r := &StreamRecorder{
+		manifestID: manifestID,
+		sess:       sess,
+		queue:      make(chan *recordTask, RecordingQueueSize),
+		done:       make(chan struct{}),
+		segments:   make(map[string][]*m3u8.MediaSegment),
+	}
+	go r.storeLoop()
+	return r
+}
+
+func (r *StreamRecorder) GetOSSession() drivers.OSSession {
+	return r.sess
+}
+
+// Record queues a segment to be stored with the given function and added to
+// the recording, so slow storage doesn't hold up the live stream
+func (r *StreamRecorder) Record(profile *ffmpeg.VideoProfile, seqNo uint64, duration float64,
+	store SegmentStoreFunc) error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return ErrRecordingFinalized
+	}
+	select {
+	case r.queue <- &recordTask{profile: *profile, seqNo: seqNo, duration: duration, store: store}:
+		return nil
+	default:
+		return ErrRecordingQueueFull
+	}
+}
+
+func (r *StreamRecorder) storeLoop() {
+	defer close(r.done)
+	for task := range r.queue {
+		uri, initURI, err := task.store(r.sess)
+		if err == nil {
+			err = r.InsertSegment(&task.profile, task.seqNo, uri, initURI, task.duration)
+		}
+		if err != nil {
+			glog.Errorf("Error recording segment manifestID=%s rendition=%s seqNo=%d err=%v",
+				r.manifestID, task.profile.Name, task.seqNo, err)
+		}
+	}
+}
+
+// InsertSegment adds an already stored segment to the recording. The
+// initURI is the initialization section for fragmented MP4, if any.
+func (r *StreamRecorder) InsertSegment(profile *ffmpeg.VideoProfile, seqNo uint64, uri, initURI string,
+	duration float64) error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.finalized {
+		return ErrRecordingFinalized
+	}
+	segs, ok := r.segments[profile.Name]
+	if !ok {
+		r.profiles = append(r.profiles, *profile)
+	}
+	mseg := newMediaSegment(uri, duration)
+	mseg.SeqId = seqNo
+	if initURI != "" {
+		mseg.Map = &m3u8.Map{URI: initURI}
+	}
+	r.segments[profile.Name] = append(segs, mseg)
+	return nil
+}
+
+// Finalize waits for the queued segments to be stored, then writes a media
+// playlist for every recorded rendition, closed with EXT-X-ENDLIST, and a
+// master playlist referencing them. Returns the URI of the master playlist.
+// Segments can no longer be recorded afterwards.
+func (r *StreamRecorder) Finalize() (string, error) {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return "", ErrRecordingFinalized
+	}
+	r.closed = true
+	close(r.queue)
+	r.mu.Unlock()
+	<-r.done
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.finalized = true
+	if len(r.profiles) == 0 {
+		return "", nil
+	}
+
+	master := m3u8.NewMasterPlaylist()
+	for _, profile := range r.profiles {
+		mpl, err := vodMediaPlaylist(r.segments[profile.Name])
+		if err != nil {
+			glog.Errorf("Error building VOD playlist manifestID=%s rendition=%s err=%v", r.manifestID, profile.Name, err)
+			return "", err
+		}
+		name := fmt.Sprintf("%s.m3u8", profile.Name)
+		if _, err := r.sess.SaveData(name, mpl.Encode().Bytes()); err != nil {
+			glog.Errorf("Error saving VOD playlist manifestID=%s name=%s err=%v", r.manifestID, name, err)
+			return "", err
+		}
+		master.Append(name, mpl, ffmpeg.VideoProfileToVariantParams(profile))
+	}
+	uri, err := r.sess.SaveData(RecordingMasterPlaylist, master.Encode().Bytes())
+	if err != nil {
+		glog.Errorf("Error saving VOD master playlist manifestID=%s err=%v", r.manifestID, err)
+		return "", err
+	}
+	glog.Infof("Finalized recording manifestID=%s uri=%s", r.manifestID, uri)
+	return uri, nil
+}
+
+func vodMediaPlaylist(segs []*m3u8.MediaSegment) (*m3u8.MediaPlaylist, error) {
+	sort.SliceStable(segs, func(i, j int) bool { return segs[i].SeqId < segs[j].SeqId })
+	mpl, err := m3u8.NewMediaPlaylist(0, uint(len(segs)))
+	if err != nil {
+		return nil, err
+	}
+	mpl.MediaType = m3u8.VOD
+	if len(segs) > 0 {
+		mpl.SeqNo = segs[0].SeqId
+	}
+	for i, seg := range segs {
+		if i > 0 && segs[i-1].SeqId == seg.SeqId {
+			// retried segment; keep the first copy
+			continue
+		}
+		if err := mpl.InsertSegment(seg.SeqId, seg); err != nil {
+			return nil, err
+		}
+		mpl.TargetDuration = math.Max(mpl.TargetDuration, math.Ceil(seg.Duration))
+	}
+	mpl.Close()
+	return mpl, nil
+}
@@ -0,0 +1,105 @@
+package core
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/livepeer/go-livepeer/drivers"
+	ffmpeg "github.com/livepeer/lpms/ffmpeg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamRecorder(t *testing.T) {
+	assert := assert.New(t)
+	sess := drivers.NewMemoryDriver(nil).NewSession("rec")
+	r := NewStreamRecorder("rec", sess)
+	assert.Equal(sess, r.GetOSSession())
+
+	// nothing recorded
+	uri, err := NewStreamRecorder("empty", sess).Finalize()
+	assert.Nil(err)
+	assert.Empty(uri)
+
+	source, p144 := &ffmpeg.VideoProfile{Name: "source", Resolution: "1280x720", Bitrate: "4000k"}, &ffmpeg.P144p30fps16x9
+	// out of order and retried segments
+	require.Nil(t, r.InsertSegment(source, 1, "source/1.ts", "", 2.5))
+	require.Nil(t, r.InsertSegment(source, 0, "source/0.ts", "", 2))
+	require.Nil(t, r.InsertSegment(p144, 0, "p144/0.m4s", "p144/init/abc.mp4", 2))
+	require.Nil(t, r.InsertSegment(p144, 0, "p144/0.m4s", "p144/init/abc.mp4", 2))
+
+	uri, err = r.Finalize()
+	require.Nil(t, err)
+	assert.Equal("/stream/rec/index.m3u8", uri)
+	mem := sess.(*drivers.MemorySession)
+
+	master := string(mem.GetData(uri))
+	assert.Contains(master, "#EXT-X-STREAM-INF")
+	assert.Contains(master, "\nsource.m3u8\n")
+	assert.Contains(master, "\n"+p144.Name+".m3u8\n")
+	assert.True(strings.Index(master, "source.m3u8") < strings.Index(master, p144.Name+".m3u8"))
+
+	mpl := string(mem.GetData("/stream/rec/source.m3u8"))
+	assert.Contains(mpl, "#EXT-X-PLAYLIST-TYPE:VOD")
+	assert.Contains(mpl, "#EXT-X-TARGETDURATION:3")
+	assert.Contains(mpl, "#EXT-X-ENDLIST")
+	assert.True(strings.Index(mpl, "source/0.ts") < strings.Index(mpl, "source/1.ts"))
+
+	mpl = string(mem.GetData("/stream/rec/" + p144.Name + ".m3u8"))
+	assert.Contains(mpl, `#EXT-X-MAP:URI="p144/init/abc.mp4"`)
+	assert.Equal(1, strings.Count(mpl, "p144/0.m4s"))
+	assert.Contains(mpl, "#EXT-X-ENDLIST")
+
+	// no more segments once finalized
+	assert.Equal(ErrRecordingFinalized, r.InsertSegment(source, 2, "source/2.ts", "", 2))
+	_, err = r.Finalize()
+	assert.Equal(ErrRecordingFinalized, err)
+}
+
+func TestStreamRecorder_Queue(t *testing.T) {
+	assert := assert.New(t)
+	defer func(n int) { RecordingQueueSize = n }(RecordingQueueSize)
+	RecordingQueueSize = 1
+	sess := drivers.NewMemoryDriver(nil).NewSession("rec")
+	r := NewStreamRecorder("rec", sess)
+	profile := &ffmpeg.P144p30fps16x9
+
+	// hold up the queue until released
+	release := make(chan struct{})
+	stored := make(chan struct{})
+	require.Nil(t, r.Record(profile, 0, 2, func(sess drivers.OSSession) (string, string, error) {
+		close(stored)
+		<-release
+		uri, err := sess.SaveData("p144/0.ts", []byte("seg0"))
+		return uri, "", err
+	}))
+	<-stored
+	require.Nil(t, r.Record(profile, 1, 2, func(sess drivers.OSSession) (string, string, error) {
+		return "", "", errors.New("storage error")
+	}))
+	// full queue; the segment is dropped
+	assert.Equal(ErrRecordingQueueFull, r.Record(profile, 2, 2, nil))
+
+	// finalizing waits for the queued segments
+	done := make(chan string)
+	go func() {
+		uri, err := r.Finalize()
+		assert.Nil(err)
+		done <- uri
+	}()
+	select {
+	case <-done:
+		t.Error("Finalized before the queue was drained")
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(release)
+	uri := <-done
+	assert.Equal("/stream/rec/index.m3u8", uri)
+	mpl := string(sess.(*drivers.MemorySession).GetData("/stream/rec/" + profile.Name + ".m3u8"))
+	assert.Contains(mpl, "p144/0.ts")
+	assert.NotContains(mpl, "1.ts")
+
+	assert.Equal(ErrRecordingFinalized, r.Record(profile, 3, 2, nil))
+}
@@ -0,0 +1,142 @@
+package core
+
+import (
+	"github.com/livepeer/go-livepeer/net"
+	"github.com/livepeer/lpms/ffmpeg"
+)
+
+// RenditionProfile holds the settings of a rendition that an
+// ffmpeg.VideoProfile can't express. The zero value is a video rendition
+// encoded with the default settings that passes the source audio through.
+type RenditionProfile struct {
+	Audio    AudioProfile
+	Encoding VideoEncoding
+	// Set for thumbnail renditions, which carry images instead of video
+	Thumbnail *ThumbnailProfile
+}
+
+// Validate checks the settings of the rendition
+func (r RenditionProfile) Validate() error {
+	if err := r.Audio.Validate(); err != nil {
+		return err
+	}
+	if err := r.Encoding.Validate(); err != nil {
+		return err
+	}
+	if r.Thumbnail != nil {
+		if err := r.Thumbnail.Validate(); err != nil {
+			return err
+		}
+		if r.Audio.AudioOnly {
+			return ErrInvalidThumbnailProfile
+		}
+	}
+	return nil
+}
+
+// IsDefault returns whether the rendition only uses default settings
+func (r RenditionProfile) IsDefault() bool {
+	return r.Audio == (AudioProfile{}) && r.Encoding == (VideoEncoding{}) && r.Thumbnail == nil
+}
+
+// RenditionProfiles holds the settings of a stream's renditions, keyed by
+// profile name. Renditions without an entry use the default settings.
+type RenditionProfiles map[string]RenditionProfile
+
+// HasAudioOnly returns whether any rendition only carries audio
+func (r RenditionProfiles) HasAudioOnly() bool {
+	for _, p := range r {
+		if p.Audio.AudioOnly {
+			return true
+		}
+	}
+	return false
+}
+
+// RequiresMP4 returns whether a rendition uses a codec that can only be
+// muxed into fragmented MP4
+func (r RenditionProfiles) RequiresMP4() bool {
+	for _, p := range r {
+		if p.Encoding.Codec == CodecVP9 {
+			return true
+		}
+	}
+	return false
+}
+
+// IsThumbnail returns whether a rendition is extracted as images
+func (r RenditionProfiles) IsThumbnail(rendition string) bool {
+	return r[rendition].Thumbnail != nil
+}
+
+// flatten serializes the non-default settings of the profiles, in order, so
+// they can be covered by segment signatures. The audio, encoding and
+// thumbnail settings of all profiles are serialized in turn.
+func (r RenditionProfiles) flatten(profiles []ffmpeg.VideoProfile) []byte {
+	var buf []byte
+	for i, p := range profiles {
+		if a := r[p.Name].Audio; a != (AudioProfile{}) {
+			buf = append(buf, a.flatten(i)...)
+		}
+	}
+	for i, p := range profiles {
+		if enc := r[p.Name].Encoding; enc != (VideoEncoding{}) {
+			buf = append(buf, enc.flatten(i)...)
+		}
+	}
+	for i, p := range profiles {
+		if thumb := r[p.Name].Thumbnail; thumb != nil {
+			buf = append(buf, thumb.flatten(i)...)
+		}
+	}
+	return buf
+}
+
+// SetNetRenditionProfiles sets the rendition fields of protocol profiles
+// converted from the given profiles
+func SetNetRenditionProfiles(netProfiles []*net.VideoProfile, profiles []ffmpeg.VideoProfile, renditions RenditionProfiles) {
+	for i, p := range netProfiles {
+		if i >= len(profiles) {
+			break
+		}
+		r := renditions[profiles[i].Name]
+		r.Audio.setNet(p)
+		r.Encoding.setNet(p)
+		if r.Thumbnail != nil {
+			r.Thumbnail.setNet(p)
+		}
+	}
+}
+
+// NetRenditionProfiles returns the rendition settings of protocol profiles,
+// keyed by the names of the profiles they were converted to. Returns nil if
+// every rendition uses the default settings.
+func NetRenditionProfiles(netProfiles []*net.VideoProfile, profiles []ffmpeg.VideoProfile) RenditionProfiles {
+	var renditions RenditionProfiles
+	for i, p := range netProfiles {
+		if i >= len(profiles) {
+			break
+		}
+		r := RenditionProfile{
+			Audio:     netAudioProfile(p),
+			Encoding:  netVideoEncoding(p),
+			Thumbnail: netThumbnailProfile(p),
+		}
+		if r.IsDefault() {
+			continue
+		}
+		if renditions == nil {
+			renditions = make(RenditionProfiles)
+		}
+		renditions[profiles[i].Name] = r
+	}
+	return renditions
+}
+
+// RenditionExt returns the file extension for segments of a rendition
+func RenditionExt(rendition string, format SegmentFormat, renditions RenditionProfiles) string {
+	if thumb := renditions[rendition].Thumbnail; thumb != nil {
+		return thumb.Format.Ext()
+	}
+	return format.Ext()
+}
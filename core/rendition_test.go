@@ -0,0 +1,101 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/livepeer/go-livepeer/net"
+	"github.com/livepeer/lpms/ffmpeg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenditionProfile_Validate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Nil(RenditionProfile{}.Validate())
+	assert.Nil(RenditionProfile{Audio: AudioProfile{Codec: AudioAAC, AudioOnly: true}}.Validate())
+	assert.Nil(RenditionProfile{Thumbnail: &ThumbnailProfile{Format: ImagePNG}}.Validate())
+
+	assert.Equal(ErrInvalidAudioProfile, RenditionProfile{Audio: AudioProfile{Bitrate: -1}}.Validate())
+	assert.Equal(ErrInvalidVideoEncoding, RenditionProfile{Encoding: VideoEncoding{GOP: -1}}.Validate())
+	assert.Equal(ErrInvalidThumbnailProfile, RenditionProfile{Thumbnail: &ThumbnailProfile{Interval: -1}}.Validate())
+	// Images need video
+	assert.Equal(ErrInvalidThumbnailProfile, RenditionProfile{
+		Audio:     AudioProfile{AudioOnly: true},
+		Thumbnail: &ThumbnailProfile{},
+	}.Validate())
+}
+
+func TestRenditionProfiles(t *testing.T) {
+	assert := assert.New(t)
+
+	var renditions RenditionProfiles
+	assert.False(renditions.HasAudioOnly())
+	assert.False(renditions.RequiresMP4())
+	assert.False(renditions.IsThumbnail("thumb"))
+
+	renditions = RenditionProfiles{
+		"audio": {Audio: AudioProfile{AudioOnly: true}},
+		"vp9":   {Encoding: VideoEncoding{Codec: CodecVP9}},
+		"thumb": {Thumbnail: &ThumbnailProfile{Format: ImagePNG}},
+	}
+	assert.True(renditions.HasAudioOnly())
+	assert.True(renditions.RequiresMP4())
+	assert.True(renditions.IsThumbnail("thumb"))
+	assert.False(renditions.IsThumbnail("vp9"))
+
+	assert.Equal(".png", RenditionExt("thumb", FormatMPEGTS, renditions))
+	assert.Equal(".ts", RenditionExt("vp9", FormatMPEGTS, renditions))
+	assert.Equal(".mp4", RenditionExt("vp9", FormatMP4, nil))
+}
+
+func TestNetRenditionProfiles(t *testing.T) {
+	assert := assert.New(t)
+
+	profiles := []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9, ffmpeg.P240p30fps16x9, ffmpeg.P360p30fps16x9, {Name: "audio"}}
+	renditions := RenditionProfiles{
+		ffmpeg.P144p30fps16x9.Name: {
+			Audio:    AudioProfile{Codec: AudioNone},
+			Encoding: VideoEncoding{Profile: ProfileH264Main, GOP: 60},
+		},
+		ffmpeg.P360p30fps16x9.Name: {
+			Encoding:  VideoEncoding{Codec: CodecVP9, CRF: 31},
+			Thumbnail: &ThumbnailProfile{Format: ImagePNG, Interval: 10 * time.Second},
+		},
+		"audio": {Audio: AudioProfile{Codec: AudioAAC, Bitrate: 64000, AudioOnly: true}},
+	}
+	netProfiles := []*net.VideoProfile{{}, {}, {}, {}}
+	SetNetRenditionProfiles(netProfiles, profiles, renditions)
+	assert.Equal(&net.VideoProfile{
+		AudioCodec: net.VideoProfile_AUDIO_NONE,
+		Profile:    net.VideoProfile_H264_MAIN,
+		Gop:        60,
+	}, netProfiles[0])
+	assert.Equal(&net.VideoProfile{}, netProfiles[1])
+	assert.Equal(&net.VideoProfile{Codec: net.VideoProfile_VP9, Crf: 31, Image: net.VideoProfile_PNG}, netProfiles[2])
+	assert.Equal(&net.VideoProfile{AudioCodec: net.VideoProfile_AAC, AudioBitrate: 64000, AudioOnly: true}, netProfiles[3])
+
+	// Round trip, leaving out default settings. The thumbnail interval only
+	// matters to the broadcaster and isn't sent.
+	renditions[ffmpeg.P360p30fps16x9.Name].Thumbnail.Interval = 0
+	assert.Equal(renditions, NetRenditionProfiles(netProfiles, profiles))
+
+	// No custom settings
+	assert.Nil(NetRenditionProfiles([]*net.VideoProfile{{}}, profiles))
+	assert.Nil(NetRenditionProfiles(nil, nil))
+}
+
+func TestRenditionProfiles_Flatten(t *testing.T) {
+	assert := assert.New(t)
+
+	profiles := []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9, ffmpeg.P240p30fps16x9}
+	assert.Empty(RenditionProfiles(nil).flatten(profiles))
+	assert.Empty(RenditionProfiles{ffmpeg.P144p30fps16x9.Name: {}}.flatten(profiles))
+
+	// Audio, then encoding, then thumbnail settings of every rendition
+	renditions := RenditionProfiles{
+		ffmpeg.P144p30fps16x9.Name: {Encoding: VideoEncoding{GOP: 30}, Thumbnail: &ThumbnailProfile{Interval: time.Second}},
+		ffmpeg.P240p30fps16x9.Name: {Audio: AudioProfile{Codec: AudioAAC, Bitrate: 96000}},
+	}
+	assert.Equal("1:aac:96000:false;0:h264::30:0;0:jpeg;", string(renditions.flatten(profiles)))
+}
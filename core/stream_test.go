@@ -23,6 +23,34 @@ func TestSegmentFlatten(t *testing.T) {
 	if !bytes.Equal(ethcrypto.Keccak256(md.Flatten()), sHash) {
 		t.Error("Flattened segment + hash did not match expected hash")
 	}
+
+	// Default audio settings don't change the flattened segment
+	flat := md.Flatten()
+	md.Renditions = RenditionProfiles{ffmpeg.P144p30fps16x9.Name: {}}
+	if !bytes.Equal(md.Flatten(), flat) {
+		t.Error("Default audio settings changed the flattened segment")
+	}
+	md.Renditions = RenditionProfiles{ffmpeg.P144p30fps16x9.Name: {Audio: AudioProfile{Codec: AudioNone}}}
+	if bytes.Equal(md.Flatten(), flat) {
+		t.Error("Audio settings were not flattened")
+	}
+	md.Renditions = RenditionProfiles{ffmpeg.P240p30fps16x9.Name: {}}
+	if !bytes.Equal(md.Flatten(), flat) {
+		t.Error("Default encoding settings changed the flattened segment")
+	}
+	md.Renditions = RenditionProfiles{ffmpeg.P240p30fps16x9.Name: {Encoding: VideoEncoding{GOP: 30}}}
+	if bytes.Equal(md.Flatten(), flat) {
+		t.Error("Encoding settings were not flattened")
+	}
+	md.Renditions = nil
+	md.Format = FormatMP4
+	if bytes.Equal(md.Flatten(), flat) {
+		t.Error("Format was not flattened")
+	}
+	md.Format = FormatMPEGTS
+	if !bytes.Equal(md.Flatten(), flat) {
+		t.Error("Default format changed the flattened segment")
+	}
 }
 
 func TestRandomIdGenerator(t *testing.T) {
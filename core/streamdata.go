@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"math/big"
 	"strings"
+	"time"
 
 	ethcommon "github.com/ethereum/go-ethereum/common"
 
@@ -26,16 +27,27 @@ type SegTranscodingMetadata struct {
 	Hash       ethcommon.Hash
 	Profiles   []ffmpeg.VideoProfile
 	OS         *net.OSInfo
+	Format     SegmentFormat     // Container of the transcoded segments
+	Renditions RenditionProfiles // Audio, encoding and thumbnail settings of the renditions
+	Fname      string            // Local path or URL of the segment to transcode
+	Deadline   time.Time         // When the broadcaster stops waiting for the results; unset if unknown
 }
 
 func (md *SegTranscodingMetadata) Flatten() []byte {
 	profiles := common.ProfilesToHex(md.Profiles)
 	seq := big.NewInt(md.Seq).Bytes()
-	buf := make([]byte, len(md.ManifestID)+32+len(md.Hash.Bytes())+len(profiles))
+	// Empty unless audio, encoding or thumbnail settings are customized, for compatibility
+	settings := md.Renditions.flatten(md.Profiles)
+	// MPEG-TS is the default and left out, for compatibility
+	if md.Format != FormatMPEGTS {
+		settings = append(settings, fmt.Sprintf("format:%v;", md.Format)...)
+	}
+	buf := make([]byte, len(md.ManifestID)+32+len(md.Hash.Bytes())+len(profiles)+len(settings))
 	i := copy(buf[0:], []byte(md.ManifestID))
 	i += copy(buf[i:], ethcommon.LeftPadBytes(seq, 32))
 	i += copy(buf[i:], md.Hash.Bytes())
 	i += copy(buf[i:], []byte(profiles))
+	i += copy(buf[i:], settings)
 	// i += copy(buf[i:], []byte(s.OS))
 	return buf
 }
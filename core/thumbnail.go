@@ -0,0 +1,230 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/livepeer/go-livepeer/net"
+	"github.com/livepeer/lpms/ffmpeg"
+)
+
+var ErrUnknownImageFormat = errors.New("ErrUnknownImageFormat")
+var ErrInvalidThumbnailProfile = errors.New("ErrInvalidThumbnailProfile")
+var ErrNotThumbnail = errors.New("ErrNotThumbnail")
+
+// Number of images kept in the index of a thumbnail rendition
+const thumbnailIndexSize = 1000
+
+// ImageFormat is the image format of a thumbnail rendition
+type ImageFormat int
+
+const (
+	ImageJPEG ImageFormat = iota
+	ImagePNG
+)
+
+// ParseImageFormat parses a user supplied image format name. An empty name
+// maps to the default of JPEG.
+func ParseImageFormat(name string) (ImageFormat, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "jpeg", "jpg":
+		return ImageJPEG, nil
+	case "png":
+		return ImagePNG, nil
+	}
+	return ImageJPEG, ErrUnknownImageFormat
+}
+
+// ImageFormatFromExt returns the image format for a file extension, if any
+func ImageFormatFromExt(ext string) (ImageFormat, bool) {
+	switch strings.ToLower(ext) {
+	case ".jpg", ".jpeg":
+		return ImageJPEG, true
+	case ".png":
+		return ImagePNG, true
+	}
+	return ImageJPEG, false
+}
+
+func (f ImageFormat) String() string {
+	if f == ImagePNG {
+		return "png"
+	}
+	return "jpeg"
+}
+
+// Ext returns the file extension for images of the format
+func (f ImageFormat) Ext() string {
+	if f == ImagePNG {
+		return ".png"
+	}
+	return ".jpg"
+}
+
+// ContentType returns the MIME type for images of the format
+func (f ImageFormat) ContentType() string {
+	if f == ImagePNG {
+		return "image/png"
+	}
+	return "image/jpeg"
+}
+
+// ThumbnailProfile describes a thumbnail rendition, which has an image of
+// the rendition's size extracted from each segment instead of video
+type ThumbnailProfile struct {
+	Format ImageFormat
+	// Minimum time between images kept in the index; every segment's image
+	// is kept if zero
+	Interval time.Duration
+}
+
+// Validate checks the thumbnail settings
+func (t ThumbnailProfile) Validate() error {
+	if t.Interval < 0 {
+		return ErrInvalidThumbnailProfile
+	}
+	return nil
+}
+
+// flatten serializes the thumbnail settings of the i-th rendition so they
+// can be covered by segment signatures. The interval only matters to the
+// broadcaster and isn't included.
+func (t ThumbnailProfile) flatten(i int) string {
+	return fmt.Sprintf("%d:%v;", i, t.Format)
+}
+
+// setNet sets the image fields of a protocol profile
+func (t ThumbnailProfile) setNet(p *net.VideoProfile) {
+	p.Image = net.VideoProfile_JPEG
+	if t.Format == ImagePNG {
+		p.Image = net.VideoProfile_PNG
+	}
+}
+
+// netThumbnailProfile returns the thumbnail settings of a protocol profile,
+// or nil if the rendition carries video
+func netThumbnailProfile(p *net.VideoProfile) *ThumbnailProfile {
+	switch p.Image {
+	case net.VideoProfile_JPEG:
+		return &ThumbnailProfile{Format: ImageJPEG}
+	case net.VideoProfile_PNG:
+		return &ThumbnailProfile{Format: ImagePNG}
+	}
+	return nil
+}
+
+const (
+	// Muxer writing thumbnail images
+	thumbnailMuxer = "image2"
+	// Frame rate thumbnail renditions are encoded at, so only a few frames
+	// of each segment are encoded
+	thumbnailFramerate = 1
+)
+
+// thumbnailTranscodeOptions returns the encoder and muxer settings for a
+// thumbnail rendition. Each frame overwrites the image, leaving the last
+// frame of the segment.
+func thumbnailTranscodeOptions(t ThumbnailProfile) (videoEnc, audioEnc, muxer ffmpeg.ComponentOptions) {
+	videoEnc = ffmpeg.ComponentOptions{
+		Name: "mjpeg",
+		// Decoded frames are limited range YUV, which is non-standard in JPEG
+		Opts: map[string]string{"strict": "unofficial"},
+	}
+	if t.Format == ImagePNG {
+		videoEnc = ffmpeg.ComponentOptions{Name: "png"}
+	}
+	audioEnc = ffmpeg.ComponentOptions{Name: "drop"}
+	muxer = ffmpeg.ComponentOptions{
+		Name: thumbnailMuxer,
+		Opts: map[string]string{"update": "1"},
+	}
+	return videoEnc, audioEnc, muxer
+}
+
+// ThumbnailImage is an image of a thumbnail rendition
+type ThumbnailImage struct {
+	URI   string `json:"uri"`
+	SeqNo uint64 `json:"seqNo"`
+	// Offset of the image from the start of the stream, in seconds
+	Time float64 `json:"time"`
+}
+
+// ThumbnailIndex lists the most recent images of a thumbnail rendition
+type ThumbnailIndex struct {
+	Rendition  string           `json:"rendition"`
+	Format     string           `json:"format"`
+	Resolution string           `json:"resolution"`
+	Images     []ThumbnailImage `json:"images"`
+}
+
+// thumbnailTrack holds the index of a thumbnail rendition
+type thumbnailTrack struct {
+	lock  sync.Mutex
+	index ThumbnailIndex
+	// Stream time covered by the segments inserted so far
+	elapsed float64
+}
+
+// InsertThumbnail saves the image extracted from a segment of a thumbnail
+// rendition and lists it in the rendition's index, unless the previous
+// image is more recent than the rendition's interval
+func (mgr *BasicPlaylistManager) InsertThumbnail(profile *ffmpeg.VideoProfile, seqNo uint64, data []byte,
+	duration float64) error {
+
+	mgr.mapSync.Lock()
+	thumb := mgr.renditions[profile.Name].Thumbnail
+	if thumb == nil {
+		mgr.mapSync.Unlock()
+		return ErrNotThumbnail
+	}
+	track, ok := mgr.thumbTracks[profile.Name]
+	if !ok {
+		track = &thumbnailTrack{index: ThumbnailIndex{
+			Rendition:  profile.Name,
+			Format:     thumb.Format.String(),
+			Resolution: profile.Resolution,
+			Images:     []ThumbnailImage{},
+		}}
+		mgr.thumbTracks[profile.Name] = track
+	}
+	mgr.mapSync.Unlock()
+
+	track.lock.Lock()
+	defer track.lock.Unlock()
+	// The image is the last frame of the segment
+	track.elapsed += duration
+	images := track.index.Images
+	if n := len(images); n > 0 && track.elapsed-images[n-1].Time < thumb.Interval.Seconds() {
+		return nil
+	}
+	name := fmt.Sprintf("%s/%d%s", profile.Name, seqNo, thumb.Format.Ext())
+	uri, err := mgr.storageSession.SaveData(name, data)
+	if err != nil {
+		return err
+	}
+	images = append(images, ThumbnailImage{URI: uri, SeqNo: seqNo, Time: track.elapsed})
+	if len(images) > thumbnailIndexSize {
+		images = images[len(images)-thumbnailIndexSize:]
+	}
+	track.index.Images = images
+	return nil
+}
+
+// GetThumbnailIndex returns the index of a thumbnail rendition, or nil if
+// the rendition has no images yet
+func (mgr *BasicPlaylistManager) GetThumbnailIndex(rendition string) *ThumbnailIndex {
+	mgr.mapSync.RLock()
+	track, ok := mgr.thumbTracks[rendition]
+	mgr.mapSync.RUnlock()
+	if !ok {
+		return nil
+	}
+	track.lock.Lock()
+	defer track.lock.Unlock()
+	index := track.index
+	index.Images = append([]ThumbnailImage{}, track.index.Images...)
+	return &index
+}
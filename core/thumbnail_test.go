@@ -0,0 +1,92 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/livepeer/go-livepeer/drivers"
+	"github.com/livepeer/lpms/ffmpeg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseImageFormat(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, f := range []ImageFormat{ImageJPEG, ImagePNG} {
+		parsed, err := ParseImageFormat(f.String())
+		assert.Nil(err)
+		assert.Equal(f, parsed)
+		fromExt, ok := ImageFormatFromExt(f.Ext())
+		assert.True(ok)
+		assert.Equal(f, fromExt)
+	}
+	f, err := ParseImageFormat(" JPG ")
+	assert.Nil(err)
+	assert.Equal(ImageJPEG, f)
+
+	_, err = ParseImageFormat("gif")
+	assert.Equal(ErrUnknownImageFormat, err)
+	_, ok := ImageFormatFromExt(".ts")
+	assert.False(ok)
+
+	assert.Equal(ErrInvalidThumbnailProfile, ThumbnailProfile{Interval: -time.Second}.Validate())
+}
+
+func TestInsertThumbnail(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	mid := RandomManifestID()
+	storage := drivers.NewMemoryDriver(nil).NewSession(string(mid))
+	mgr := NewBasicPlaylistManager(mid, storage)
+	thumbProfile := ffmpeg.P144p30fps16x9
+	videoProfile := ffmpeg.P240p30fps16x9
+	mgr.SetRenditionProfiles(RenditionProfiles{thumbProfile.Name: {Thumbnail: &ThumbnailProfile{Format: ImagePNG, Interval: 5 * time.Second}}})
+
+	assert.Equal(ErrNotThumbnail, mgr.InsertThumbnail(&videoProfile, 0, []byte("img"), 2))
+	assert.Nil(mgr.GetThumbnailIndex(thumbProfile.Name))
+
+	// Images closer than the interval to the previous one are skipped
+	for seqNo := uint64(0); seqNo < 6; seqNo++ {
+		require.Nil(mgr.InsertThumbnail(&thumbProfile, seqNo, []byte{byte(seqNo)}, 2))
+	}
+	index := mgr.GetThumbnailIndex(thumbProfile.Name)
+	require.NotNil(index)
+	assert.Equal(thumbProfile.Name, index.Rendition)
+	assert.Equal("png", index.Format)
+	assert.Equal(thumbProfile.Resolution, index.Resolution)
+	require.Len(index.Images, 2)
+	assert.Equal(uint64(0), index.Images[0].SeqNo)
+	assert.Equal(2.0, index.Images[0].Time)
+	assert.Equal(uint64(3), index.Images[1].SeqNo)
+	assert.Equal(8.0, index.Images[1].Time)
+
+	// Images are saved into the stream's storage
+	assert.Equal("/stream/"+string(mid)+"/"+thumbProfile.Name+"/3.png", index.Images[1].URI)
+	assert.Equal([]byte{3}, storage.(*drivers.MemorySession).GetData(string(mid)+"/"+thumbProfile.Name+"/3.png"))
+
+	// The returned index is a copy
+	index.Images[0].SeqNo = 100
+	assert.Equal(uint64(0), mgr.GetThumbnailIndex(thumbProfile.Name).Images[0].SeqNo)
+
+	// Thumbnail renditions aren't listed in the playlists
+	assert.Len(mgr.GetHLSMasterPlaylist().Variants, 0)
+}
+
+func TestInsertThumbnail_IndexSize(t *testing.T) {
+	assert := assert.New(t)
+
+	mid := RandomManifestID()
+	mgr := NewBasicPlaylistManager(mid, drivers.NewMemoryDriver(nil).NewSession(string(mid)))
+	profile := ffmpeg.P144p30fps16x9
+	mgr.SetRenditionProfiles(RenditionProfiles{profile.Name: {Thumbnail: &ThumbnailProfile{}}})
+
+	for seqNo := uint64(0); seqNo < thumbnailIndexSize+10; seqNo++ {
+		assert.Nil(mgr.InsertThumbnail(&profile, seqNo, []byte("img"), 1))
+	}
+	images := mgr.GetThumbnailIndex(profile.Name).Images
+	assert.Len(images, thumbnailIndexSize)
+	assert.Equal(uint64(10), images[0].SeqNo)
+	assert.Equal(uint64(thumbnailIndexSize+9), images[len(images)-1].SeqNo)
+}
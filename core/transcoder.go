@@ -18,22 +18,23 @@ import (
 )
 
 type Transcoder interface {
-	Transcode(job string, fname string, profiles []ffmpeg.VideoProfile) (*TranscodeData, error)
+	Transcode(md *SegTranscodingMetadata) (*TranscodeData, error)
 }
 
 type LocalTranscoder struct {
 	workDir string
 }
 
-func (lt *LocalTranscoder) Transcode(job string, fname string, profiles []ffmpeg.VideoProfile) (*TranscodeData, error) {
+func (lt *LocalTranscoder) Transcode(md *SegTranscodingMetadata) (*TranscodeData, error) {
 	// Set up in / out config
 	in := &ffmpeg.TranscodeOptionsIn{
-		Fname: fname,
+		Fname: md.Fname,
 		Accel: ffmpeg.Software,
 	}
-	opts := profilesToTranscodeOptions(lt.workDir, ffmpeg.Software, profiles)
+	profiles := md.Profiles
+	opts := profilesToTranscodeOptions(lt.workDir, ffmpeg.Software, profiles, md.Format, md.Renditions)
 
-	_, seqNo, parseErr := parseURI(fname)
+	_, seqNo, parseErr := parseURI(md.Fname)
 	start := time.Now()
 
 	res, err := ffmpeg.Transcode3(in, opts)
@@ -62,10 +63,9 @@ type nvSegResult struct {
 }
 
 type nvSegData struct {
-	session  *ffmpeg.Transcoder
-	fname    string
-	profiles []ffmpeg.VideoProfile
-	res      chan *nvSegResult
+	session *ffmpeg.Transcoder
+	md      *SegTranscodingMetadata
+	res     chan *nvSegResult
 }
 
 type NvidiaTranscoder struct {
@@ -114,13 +114,12 @@ func (ss *segStack) pop() *nvSegData {
 	return seg
 }
 
-func (nv *NvidiaTranscoder) Transcode(job string, fname string, profiles []ffmpeg.VideoProfile) (*TranscodeData, error) {
+func (nv *NvidiaTranscoder) Transcode(md *SegTranscodingMetadata) (*TranscodeData, error) {
 
 	segData := &nvSegData{
-		session:  nv.session,
-		fname:    fname,
-		profiles: profiles,
-		res:      make(chan *nvSegResult, 1),
+		session: nv.session,
+		md:      md,
+		res:     make(chan *nvSegResult, 1),
 	}
 	nv.device.push(segData)
 	res := <-segData.res
@@ -154,12 +153,15 @@ func runTranscodeLoop(stack *segStack, workDir string) {
 	for {
 		seg := stack.pop()
 		// Set up in / out config
+		opts := profilesToTranscodeOptions(workDir, ffmpeg.Nvidia, seg.md.Profiles, seg.md.Format, seg.md.Renditions)
+		for i := range opts {
+			opts[i].Device = stack.gpu
+		}
 		in := &ffmpeg.TranscodeOptionsIn{
-			Fname:  seg.fname,
-			Accel:  ffmpeg.Nvidia,
+			Fname:  seg.md.Fname,
+			Accel:  nvidiaDecodeAccel(opts),
 			Device: stack.gpu,
 		}
-		opts := profilesToTranscodeOptions(workDir, ffmpeg.Nvidia, seg.profiles)
 		// Do the Transcoding
 		res, err := seg.session.Transcode(in, opts)
 		if err != nil {
@@ -171,6 +173,21 @@ func runTranscodeLoop(stack *segStack, workDir string) {
 	}
 }
 
+// nvidiaDecodeAccel returns where a segment transcoded on a GPU is decoded.
+// LPMS only builds a CUDA filter graph for the encoders it picks itself, so
+// renditions naming their encoder need software decoding; LPMS then uploads
+// the frames of the renditions it encodes on the GPU.
+func nvidiaDecodeAccel(opts []ffmpeg.TranscodeOptions) ffmpeg.Acceleration {
+	for _, o := range opts {
+		switch o.VideoEncoder.Name {
+		case "", "drop", "copy":
+		default:
+			return ffmpeg.Software
+		}
+	}
+	return ffmpeg.Nvidia
+}
+
 func parseURI(uri string) (string, uint64, error) {
 	var mid string
 	var seqNo uint64
@@ -198,7 +215,12 @@ func resToTranscodeData(res *ffmpeg.TranscodeResults, opts []ffmpeg.TranscodeOpt
 			glog.Error("Cannot read transcoded output for ", oname)
 			return nil, err
 		}
-		segments[i] = &TranscodedSegmentData{Data: o, Pixels: res.Encoded[i].Pixels}
+		pixels := res.Encoded[i].Pixels
+		if opts[i].Muxer.Name == thumbnailMuxer && res.Encoded[i].Frames > 0 {
+			// Only the last frame is kept in the image
+			pixels /= int64(res.Encoded[i].Frames)
+		}
+		segments[i] = &TranscodedSegmentData{Data: o, Pixels: pixels}
 		os.Remove(oname)
 	}
 
@@ -208,14 +230,44 @@ func resToTranscodeData(res *ffmpeg.TranscodeResults, opts []ffmpeg.TranscodeOpt
 	}, nil
 }
 
-func profilesToTranscodeOptions(workDir string, accel ffmpeg.Acceleration, profiles []ffmpeg.VideoProfile) []ffmpeg.TranscodeOptions {
+func profilesToTranscodeOptions(workDir string, accel ffmpeg.Acceleration, profiles []ffmpeg.VideoProfile, format SegmentFormat,
+	renditions RenditionProfiles) []ffmpeg.TranscodeOptions {
+
 	opts := make([]ffmpeg.TranscodeOptions, len(profiles), len(profiles))
 	for i := range profiles {
+		r := renditions[profiles[i].Name]
+		if thumb := r.Thumbnail; thumb != nil {
+			videoEnc, audioEnc, muxer := thumbnailTranscodeOptions(*thumb)
+			profile := profiles[i]
+			profile.Framerate = thumbnailFramerate
+			opts[i] = ffmpeg.TranscodeOptions{
+				Oname:        fmt.Sprintf("%s/out_%s%s", workDir, common.RandName(), thumb.Format.Ext()),
+				Profile:      profile,
+				Accel:        accel,
+				VideoEncoder: videoEnc,
+				AudioEncoder: audioEnc,
+				Muxer:        muxer,
+			}
+			continue
+		}
+		audioEnc, videoEnc := audioTranscodeOptions(r.Audio)
+		if videoEnc.Name == "" {
+			videoEnc = videoEncoderOptions(r.Encoding, accel)
+		}
 		o := ffmpeg.TranscodeOptions{
-			Oname:        fmt.Sprintf("%s/out_%s.ts", workDir, common.RandName()),
+			Oname:        fmt.Sprintf("%s/out_%s%s", workDir, common.RandName(), format.Ext()),
 			Profile:      profiles[i],
 			Accel:        accel,
-			AudioEncoder: ffmpeg.ComponentOptions{Name: "copy"},
+			VideoEncoder: videoEnc,
+			AudioEncoder: audioEnc,
+		}
+		if format == FormatMP4 {
+			// Fragmented output so the init section can be split off and
+			// the fragments served as CMAF media segments
+			o.Muxer = ffmpeg.ComponentOptions{
+				Name: "mp4",
+				Opts: map[string]string{"movflags": "frag_keyframe+empty_moov+default_base_moof"},
+			}
 		}
 		opts[i] = o
 	}
@@ -20,7 +20,7 @@ func TestLocalTranscoder(t *testing.T) {
 	ffmpeg.InitFFmpeg()
 
 	profiles := []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9, ffmpeg.P240p30fps16x9}
-	res, err := tc.Transcode("", "test.ts", profiles)
+	res, err := tc.Transcode(&SegTranscodingMetadata{Fname: "test.ts", Profiles: profiles})
 	if err != nil {
 		t.Error("Error transcoding ", err)
 	}
@@ -47,7 +47,7 @@ func TestNvidia_Transcoder(t *testing.T) {
 
 	// transcoding should fail due to invalid devices
 	profiles := []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9, ffmpeg.P240p30fps16x9}
-	_, err := tc.Transcode("", fname, profiles)
+	_, err := tc.Transcode(&SegTranscodingMetadata{Fname: fname, Profiles: profiles})
 	if err == nil ||
 		(err.Error() != "Unknown error occurred" &&
 			err.Error() != "Cannot allocate memory") {
@@ -61,7 +61,7 @@ func TestNvidia_Transcoder(t *testing.T) {
 	}
 	StartNvidiaTranscoders(dev, tmp)
 	tc = NewNvidiaTranscoder(dev)
-	res, err := tc.Transcode("", fname, profiles)
+	res, err := tc.Transcode(&SegTranscodingMetadata{Fname: fname, Profiles: profiles})
 	if err != nil {
 		t.Error(err)
 	}
@@ -79,12 +79,12 @@ func TestNvidia_Stack(t *testing.T) {
 	assert.Empty(ss.segs, "Sanity check for empty stack")
 	for i := 0; i < 1000; i++ {
 		fname := fmt.Sprintf("%d", i)
-		ss.push(&nvSegData{fname: fname})
+		ss.push(&nvSegData{md: &SegTranscodingMetadata{Fname: fname}})
 	}
 	for i := 999; i >= 0; i-- {
 		fname := fmt.Sprintf("%d", i)
 		seg := ss.pop()
-		assert.Equal(fname, seg.fname)
+		assert.Equal(fname, seg.md.Fname)
 	}
 	assert.Empty(ss.segs, "Stack nonempty") // sanity check
 
@@ -128,7 +128,7 @@ func TestNvidia_ConcurrentTranscodes(t *testing.T) {
 	wg := newWg(5)
 	for i := 0; i < 5; i++ {
 		go func() {
-			res, err := tc.Transcode("", "test2.ts", profiles)
+			res, err := tc.Transcode(&SegTranscodingMetadata{Fname: "test2.ts", Profiles: profiles})
 			assert.Nil(err, "Error transcoding")
 			assert.InEpsilon(487484, len(res.Segments[0].Data), 0.01, fmt.Sprintf("Expected within 1%% of %d", len(res.Segments[0].Data)))
 			assert.InEpsilon(766288, len(res.Segments[1].Data), 0.01, fmt.Sprintf("Expected within 1%% of %d", len(res.Segments[1].Data)))
@@ -210,6 +210,15 @@ func TestResToTranscodeData(t *testing.T) {
 	assert.Equal(int64(300), tData.Segments[1].Pixels)
 	assert.True(fileDNE(file1.Name()))
 	assert.True(fileDNE(file2.Name()))
+
+	// Thumbnails are charged for the one frame they keep
+	res = &ffmpeg.TranscodeResults{Encoded: []ffmpeg.MediaInfo{{Frames: 4, Pixels: 400}}}
+	file1, err = ioutil.TempFile(tempDir, "foo")
+	require.Nil(err)
+	opts = []ffmpeg.TranscodeOptions{{Oname: file1.Name(), Muxer: ffmpeg.ComponentOptions{Name: "image2"}}}
+	tData, err = resToTranscodeData(res, opts)
+	assert.Nil(err)
+	assert.Equal(int64(100), tData.Segments[0].Pixels)
 }
 
 func TestProfilesToTranscodeOptions(t *testing.T) {
@@ -225,12 +234,12 @@ func TestProfilesToTranscodeOptions(t *testing.T) {
 
 	// Test 0 profiles
 	profiles := []ffmpeg.VideoProfile{}
-	opts := profilesToTranscodeOptions(workDir, ffmpeg.Software, profiles)
+	opts := profilesToTranscodeOptions(workDir, ffmpeg.Software, profiles, FormatMPEGTS, nil)
 	assert.Equal(0, len(opts))
 
 	// Test 1 profile
 	profiles = []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9}
-	opts = profilesToTranscodeOptions(workDir, ffmpeg.Software, profiles)
+	opts = profilesToTranscodeOptions(workDir, ffmpeg.Software, profiles, FormatMPEGTS, nil)
 	assert.Equal(1, len(opts))
 	assert.Equal("foo/out_bar.ts", opts[0].Oname)
 	assert.Equal(ffmpeg.Software, opts[0].Accel)
@@ -239,7 +248,7 @@ func TestProfilesToTranscodeOptions(t *testing.T) {
 
 	// Test > 1 profile
 	profiles = []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9, ffmpeg.P240p30fps16x9}
-	opts = profilesToTranscodeOptions(workDir, ffmpeg.Software, profiles)
+	opts = profilesToTranscodeOptions(workDir, ffmpeg.Software, profiles, FormatMPEGTS, nil)
 	assert.Equal(2, len(opts))
 
 	for i, p := range profiles {
@@ -250,7 +259,7 @@ func TestProfilesToTranscodeOptions(t *testing.T) {
 	}
 
 	// Test different acceleration value
-	opts = profilesToTranscodeOptions(workDir, ffmpeg.Nvidia, profiles)
+	opts = profilesToTranscodeOptions(workDir, ffmpeg.Nvidia, profiles, FormatMPEGTS, nil)
 	assert.Equal(2, len(opts))
 
 	for i, p := range profiles {
@@ -259,6 +268,85 @@ func TestProfilesToTranscodeOptions(t *testing.T) {
 		assert.Equal(p, opts[i].Profile)
 		assert.Equal("copy", opts[i].AudioEncoder.Name)
 	}
+
+	// Test fragmented mp4 output
+	opts = profilesToTranscodeOptions(workDir, ffmpeg.Software, profiles, FormatMP4, nil)
+	assert.Equal(2, len(opts))
+
+	for i, p := range profiles {
+		assert.Equal("foo/out_bar.mp4", opts[i].Oname)
+		assert.Equal(p, opts[i].Profile)
+		assert.Equal("mp4", opts[i].Muxer.Name)
+		assert.Equal("frag_keyframe+empty_moov+default_base_moof", opts[i].Muxer.Opts["movflags"])
+	}
+
+	// Test audio settings
+	profiles = []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9, ffmpeg.P240p30fps16x9, {Name: "audio"}}
+	renditions := RenditionProfiles{
+		ffmpeg.P144p30fps16x9.Name: {Audio: AudioProfile{Codec: AudioNone}},
+		ffmpeg.P240p30fps16x9.Name: {Audio: AudioProfile{Codec: AudioAAC, Bitrate: 96000}},
+		"audio":                    {Audio: AudioProfile{Codec: AudioAAC, AudioOnly: true}},
+	}
+	opts = profilesToTranscodeOptions(workDir, ffmpeg.Software, profiles, FormatMPEGTS, renditions)
+	assert.Equal(3, len(opts))
+	assert.Equal("drop", opts[0].AudioEncoder.Name)
+	assert.Equal("", opts[0].VideoEncoder.Name)
+	assert.Equal("aac", opts[1].AudioEncoder.Name)
+	assert.Equal("96000", opts[1].AudioEncoder.Opts["b"])
+	assert.Equal("", opts[1].VideoEncoder.Name)
+	assert.Equal("aac", opts[2].AudioEncoder.Name)
+	assert.Nil(opts[2].AudioEncoder.Opts)
+	assert.Equal("drop", opts[2].VideoEncoder.Name)
+
+	// Test video encoding settings
+	renditions = RenditionProfiles{
+		ffmpeg.P144p30fps16x9.Name: {Audio: AudioProfile{Codec: AudioNone}, Encoding: VideoEncoding{Profile: ProfileH264Baseline, GOP: 60}},
+		ffmpeg.P240p30fps16x9.Name: {Encoding: VideoEncoding{Codec: CodecH265, CRF: 28}},
+		"audio":                    {Audio: AudioProfile{Codec: AudioAAC, AudioOnly: true}, Encoding: VideoEncoding{Codec: CodecVP9}},
+	}
+	opts = profilesToTranscodeOptions(workDir, ffmpeg.Software, profiles, FormatMPEGTS, renditions)
+	assert.Equal(ffmpeg.ComponentOptions{Opts: map[string]string{"forced-idr": "1", "profile": "baseline", "g": "60"}}, opts[0].VideoEncoder,
+		"LPMS picks the H.264 encoder")
+	assert.Equal(ffmpeg.ComponentOptions{Name: "libx265", Opts: map[string]string{"forced-idr": "1", "crf": "28"}}, opts[1].VideoEncoder)
+	assert.Equal("drop", opts[2].VideoEncoder.Name, "Audio-only renditions drop the video")
+	assert.Equal(ffmpeg.Nvidia, nvidiaDecodeAccel(opts[:1]))
+	renditions["audio"] = RenditionProfile{Encoding: VideoEncoding{Codec: CodecVP9, CRF: 30}}
+	opts = profilesToTranscodeOptions(workDir, ffmpeg.Nvidia, profiles, FormatMPEGTS, renditions)
+	assert.Equal(ffmpeg.ComponentOptions{Opts: map[string]string{"forced-idr": "1", "profile": "baseline", "g": "60"}}, opts[0].VideoEncoder,
+		"LPMS picks the H.264 encoder and its CUDA filters")
+	assert.Equal(ffmpeg.ComponentOptions{Name: "hevc_nvenc", Opts: map[string]string{"forced-idr": "1", "rc": "vbr", "cq": "28"}}, opts[1].VideoEncoder)
+	assert.Equal(ffmpeg.ComponentOptions{Name: "libvpx-vp9", Opts: map[string]string{"crf": "30"}}, opts[2].VideoEncoder)
+	for _, o := range opts {
+		assert.Equal(ffmpeg.Nvidia, o.Accel)
+	}
+	// Named encoders can't take CUDA frames, so the segment is decoded in
+	// software and uploaded for the GPU encoded renditions
+	assert.Equal(ffmpeg.Software, nvidiaDecodeAccel(opts))
+	assert.Equal(ffmpeg.Nvidia, nvidiaDecodeAccel(opts[:1]))
+
+	// Default settings are left to the transcoder
+	opts = profilesToTranscodeOptions(workDir, ffmpeg.Software, profiles, FormatMPEGTS, RenditionProfiles{"audio": {}})
+	assert.Equal(ffmpeg.ComponentOptions{}, opts[2].VideoEncoder)
+
+	// Test thumbnail renditions
+	profiles = []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9, ffmpeg.P240p30fps16x9, ffmpeg.P360p30fps16x9}
+	renditions = RenditionProfiles{
+		ffmpeg.P240p30fps16x9.Name: {Thumbnail: &ThumbnailProfile{Format: ImageJPEG, Interval: 10 * time.Second}},
+		ffmpeg.P360p30fps16x9.Name: {Thumbnail: &ThumbnailProfile{Format: ImagePNG}},
+	}
+	opts = profilesToTranscodeOptions(workDir, ffmpeg.Software, profiles, FormatMP4, renditions)
+	assert.Equal(3, len(opts))
+	assert.Equal("foo/out_bar.mp4", opts[0].Oname)
+	assert.Equal("mp4", opts[0].Muxer.Name)
+	assert.Equal("foo/out_bar.jpg", opts[1].Oname)
+	assert.Equal(ffmpeg.P240p30fps16x9.Resolution, opts[1].Profile.Resolution)
+	assert.Equal(uint(1), opts[1].Profile.Framerate, "Thumbnails encode a frame per second")
+	assert.Equal("mjpeg", opts[1].VideoEncoder.Name)
+	assert.Equal("drop", opts[1].AudioEncoder.Name)
+	assert.Equal(ffmpeg.ComponentOptions{Name: "image2", Opts: map[string]string{"update": "1"}}, opts[1].Muxer)
+	assert.Equal("foo/out_bar.png", opts[2].Oname)
+	assert.Equal(ffmpeg.ComponentOptions{Name: "png"}, opts[2].VideoEncoder)
+	assert.Equal("image2", opts[2].Muxer.Name)
 }
 
 func TestAudioCopy(t *testing.T) {
@@ -282,7 +370,7 @@ func TestAudioCopy(t *testing.T) {
 	assert.Nil(err)
 
 	profs := []ffmpeg.VideoProfile{ffmpeg.P720p30fps16x9} // dummy
-	res, err := tc.Transcode("", audioSample, profs)
+	res, err := tc.Transcode(&SegTranscodingMetadata{Fname: audioSample, Profiles: profs})
 	assert.Nil(err)
 
 	o, err := ioutil.ReadFile(audioSample)
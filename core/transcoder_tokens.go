@@ -0,0 +1,145 @@
+package core
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/livepeer/go-livepeer/common"
+)
+
+var ErrTranscoderAuth = errors.New("ErrTranscoderAuth")
+var ErrInvalidTranscoderName = errors.New("ErrInvalidTranscoderName")
+var ErrUnknownTranscoderToken = errors.New("ErrUnknownTranscoderToken")
+
+// Number of random bytes in a transcoder token
+const transcoderTokenSize = 32
+
+// TranscoderTokens holds the tokens issued to standalone transcoders. Each
+// token identifies a single transcoder by name, so it can be revoked
+// without affecting the others. Only hashes of the tokens are kept.
+type TranscoderTokens struct {
+	store common.TranscoderTokenStore
+
+	mu     sync.RWMutex
+	tokens map[string]*common.DBTranscoderToken // keyed by name
+	hashes map[string]string                    // token hash to name
+}
+
+// NewTranscoderTokens loads the tokens kept in the store
+func NewTranscoderTokens(store common.TranscoderTokenStore) (*TranscoderTokens, error) {
+	tokens, err := store.TranscoderTokens()
+	if err != nil {
+		return nil, err
+	}
+	t := &TranscoderTokens{
+		store:  store,
+		tokens: make(map[string]*common.DBTranscoderToken),
+		hashes: make(map[string]string),
+	}
+	for _, token := range tokens {
+		t.tokens[token.Name] = token
+		t.hashes[token.TokenHash] = token.Name
+	}
+	return t, nil
+}
+
+func hashTranscoderToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// Issue creates a token for the named transcoder, replacing its previous
+// token if any. The token is only returned here and can't be recovered.
+func (t *TranscoderTokens) Issue(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || strings.ContainsAny(name, " \t\r\n") {
+		return "", ErrInvalidTranscoderName
+	}
+	buf := make([]byte, transcoderTokenSize)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+	entry := &common.DBTranscoderToken{
+		Name:      name,
+		TokenHash: hashTranscoderToken(token),
+		CreatedAt: time.Now().Unix(),
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.store.SetTranscoderToken(entry); err != nil {
+		return "", err
+	}
+	if prev, ok := t.tokens[name]; ok {
+		delete(t.hashes, prev.TokenHash)
+	}
+	t.tokens[name] = entry
+	t.hashes[entry.TokenHash] = name
+	glog.Infof("Issued transcoder token name=%s", name)
+	return token, nil
+}
+
+// Revoke removes the token of the named transcoder
+func (t *TranscoderTokens) Revoke(name string) error {
+	name = strings.TrimSpace(name)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entry, ok := t.tokens[name]
+	if !ok {
+		return ErrUnknownTranscoderToken
+	}
+	if err := t.store.DeleteTranscoderToken(name); err != nil {
+		return err
+	}
+	delete(t.tokens, name)
+	delete(t.hashes, entry.TokenHash)
+	glog.Infof("Revoked transcoder token name=%s", name)
+	return nil
+}
+
+// Identify returns the name of the transcoder the token was issued to
+func (t *TranscoderTokens) Identify(token string) (string, bool) {
+	if token == "" {
+		return "", false
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	name, ok := t.hashes[hashTranscoderToken(token)]
+	return name, ok
+}
+
+// List returns the issued tokens, without their hashes, ordered by name
+func (t *TranscoderTokens) List() []common.DBTranscoderToken {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	list := make([]common.DBTranscoderToken, 0, len(t.tokens))
+	for _, entry := range t.tokens {
+		list = append(list, common.DBTranscoderToken{Name: entry.Name, CreatedAt: entry.CreatedAt})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// authenticateTranscoder returns the name of the token presented by a
+// standalone transcoder. The shared orchestrator secret, if set, is also
+// accepted and identifies the transcoder by an empty name.
+func (n *LivepeerNode) authenticateTranscoder(creds string) (string, error) {
+	if n.TranscoderTokens != nil {
+		if name, ok := n.TranscoderTokens.Identify(creds); ok {
+			return name, nil
+		}
+	}
+	if n.OrchSecret != "" && subtle.ConstantTimeCompare([]byte(creds), []byte(n.OrchSecret)) == 1 {
+		return "", nil
+	}
+	return "", ErrTranscoderAuth
+}
@@ -0,0 +1,153 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTranscoderTokens(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	dbh, dbraw, err := common.TempDB(t)
+	require.Nil(err)
+	defer dbh.Close()
+	defer dbraw.Close()
+
+	tokens, err := NewTranscoderTokens(dbh)
+	require.Nil(err)
+	assert.Empty(tokens.List())
+
+	_, err = tokens.Issue(" ")
+	assert.Equal(ErrInvalidTranscoderName, err)
+	_, err = tokens.Issue("rig 1")
+	assert.Equal(ErrInvalidTranscoderName, err)
+
+	token1, err := tokens.Issue("rig1")
+	require.Nil(err)
+	token2, err := tokens.Issue("rig2")
+	require.Nil(err)
+	assert.NotEqual(token1, token2)
+
+	name, ok := tokens.Identify(token1)
+	assert.True(ok)
+	assert.Equal("rig1", name)
+	name, ok = tokens.Identify(token2)
+	assert.True(ok)
+	assert.Equal("rig2", name)
+	_, ok = tokens.Identify("")
+	assert.False(ok)
+	_, ok = tokens.Identify("foo")
+	assert.False(ok)
+
+	// Hashes aren't listed
+	list := tokens.List()
+	require.Len(list, 2)
+	assert.Equal("rig1", list[0].Name)
+	assert.Equal("rig2", list[1].Name)
+	assert.Empty(list[0].TokenHash)
+	assert.InDelta(time.Now().Unix(), list[0].CreatedAt, 5)
+
+	// Reissuing replaces the previous token
+	token3, err := tokens.Issue("rig1")
+	require.Nil(err)
+	_, ok = tokens.Identify(token1)
+	assert.False(ok)
+	name, ok = tokens.Identify(token3)
+	assert.True(ok)
+	assert.Equal("rig1", name)
+
+	assert.Equal(ErrUnknownTranscoderToken, tokens.Revoke("nonexistent"))
+	require.Nil(tokens.Revoke("rig2"))
+	_, ok = tokens.Identify(token2)
+	assert.False(ok)
+
+	// Tokens are persisted
+	tokens, err = NewTranscoderTokens(dbh)
+	require.Nil(err)
+	require.Len(tokens.List(), 1)
+	name, ok = tokens.Identify(token3)
+	assert.True(ok)
+	assert.Equal("rig1", name)
+	_, ok = tokens.Identify(token2)
+	assert.False(ok)
+}
+
+func TestAuthenticateTranscoder(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	dbh, dbraw, err := common.TempDB(t)
+	require.Nil(err)
+	defer dbh.Close()
+	defer dbraw.Close()
+	n, _ := NewLivepeerNode(nil, "", nil)
+	o := NewOrchestrator(n, nil)
+
+	// Nothing is accepted without a secret or tokens
+	_, err = o.AuthenticateTranscoder("")
+	assert.Equal(ErrTranscoderAuth, err)
+
+	n.OrchSecret = "secret"
+	name, err := o.AuthenticateTranscoder("secret")
+	assert.Nil(err)
+	assert.Equal("", name)
+	_, err = o.AuthenticateTranscoder("foo")
+	assert.Equal(ErrTranscoderAuth, err)
+
+	n.TranscoderTokens, err = NewTranscoderTokens(dbh)
+	require.Nil(err)
+	token, err := n.TranscoderTokens.Issue("rig1")
+	require.Nil(err)
+	name, err = o.AuthenticateTranscoder(token)
+	assert.Nil(err)
+	assert.Equal("rig1", name)
+
+	// The shared secret still works alongside tokens, unless unset
+	_, err = o.AuthenticateTranscoder("secret")
+	assert.Nil(err)
+	n.OrchSecret = ""
+	_, err = o.AuthenticateTranscoder("secret")
+	assert.Equal(ErrTranscoderAuth, err)
+	_, err = o.AuthenticateTranscoder(token)
+	assert.Nil(err)
+}
+
+func TestRemoteTranscoder_Identity(t *testing.T) {
+	assert := assert.New(t)
+	m := NewRemoteTranscoderManager()
+	strm := &StubTranscoderServer{manager: m}
+	strm2 := &StubTranscoderServer{manager: m}
+
+	wg1, wg2 := newWg(1), newWg(1)
+	go func() { m.Manage(strm, "rig1", 5, nil); wg1.Done() }()
+	go func() { m.Manage(strm2, "rig2", 5, nil); wg2.Done() }()
+	time.Sleep(1 * time.Millisecond) // allow the manager to activate
+
+	info := m.RegisteredTranscodersInfo()
+	names := []string{info[0].Name, info[1].Name}
+	assert.ElementsMatch([]string{"rig1", "rig2"}, names)
+
+	// Results are only accepted from the transcoder the task was assigned to
+	taskID, taskChan := m.addTask("rig1")
+	m.transcoderResults(taskID, &RemoteTranscoderResult{Transcoder: "rig2"})
+	m.transcoderResults(taskID, &RemoteTranscoderResult{})
+	assert.Len(taskChan, 0)
+	m.transcoderResults(taskID, &RemoteTranscoderResult{Transcoder: "rig1"})
+	assert.Len(taskChan, 1)
+	m.removeTaskChan(taskID)
+	_, ok := m.taskOwner(taskID)
+	assert.False(ok)
+
+	// Disconnecting by name leaves the other transcoders alone
+	assert.Equal(0, m.Disconnect("nonexistent"))
+	assert.Equal(1, m.Disconnect("rig2"))
+	assert.True(wgWait(wg2)) // time limit
+	assert.Equal(1, m.RegisteredTranscodersCount())
+	assert.Equal("rig1", m.RegisteredTranscodersState()[0].Name)
+
+	m.liveTranscoders[strm].eof <- struct{}{}
+	assert.True(wgWait(wg1)) // time limit
+}
@@ -90,7 +90,9 @@ func (dbo *DBOrchestratorPoolCache) GetURLs() []*url.URL {
 	return uris
 }
 
-func (dbo *DBOrchestratorPoolCache) GetOrchestrators(numOrchestrators int) ([]*net.OrchestratorInfo, error) {
+func (dbo *DBOrchestratorPoolCache) GetOrchestrators(numOrchestrators int, caps *net.Capabilities,
+	streamPred func(*net.OrchestratorInfo) bool) ([]*net.OrchestratorInfo, error) {
+
 	uris, err := dbo.getURLs()
 	if err != nil || len(uris) <= 0 {
 		return nil, err
@@ -122,7 +124,7 @@ func (dbo *DBOrchestratorPoolCache) GetOrchestrators(numOrchestrators int) ([]*n
 
 	orchPool := NewOrchestratorPoolWithPred(dbo.bcast, uris, pred)
 
-	orchInfos, err := orchPool.GetOrchestrators(numOrchestrators)
+	orchInfos, err := orchPool.GetOrchestrators(numOrchestrators, caps, streamPred)
 	if err != nil || len(orchInfos) <= 0 {
 		return nil, err
 	}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/core"
 	"github.com/livepeer/go-livepeer/monitor"
 	"github.com/livepeer/go-livepeer/net"
 	"github.com/livepeer/go-livepeer/server"
@@ -53,12 +54,29 @@ func (o *orchestratorPool) GetURLs() []*url.URL {
 	return o.uris
 }
 
-func (o *orchestratorPool) GetOrchestrators(numOrchestrators int) ([]*net.OrchestratorInfo, error) {
-	numAvailableOrchs := len(o.uris)
+// GetOrchestrators returns up to numOrchestrators orchestrators that have the
+// capabilities required by a stream, and that the stream's own predicate
+// accepts. Nil caps or pred matches any orchestrator.
+func (o *orchestratorPool) GetOrchestrators(numOrchestrators int, caps *net.Capabilities,
+	pred func(*net.OrchestratorInfo) bool) ([]*net.OrchestratorInfo, error) {
+
+	// Skip orchestrators denied by the access list without contacting them
+	var uris []*url.URL
+	for _, uri := range o.uris {
+		if server.OrchAccess.PermittedURI(uri) {
+			uris = append(uris, uri)
+		}
+	}
+
+	if len(uris) == 0 {
+		return []*net.OrchestratorInfo{}, nil
+	}
+
+	numAvailableOrchs := len(uris)
 	numOrchestrators = int(math.Min(float64(numAvailableOrchs), float64(numOrchestrators)))
 	ctx, cancel := context.WithTimeout(context.Background(), getOrchestratorsTimeoutLoop)
 	orchInfos := []*net.OrchestratorInfo{}
-	orchChan := make(chan struct{}, len(o.uris))
+	orchChan := make(chan struct{}, len(uris))
 	numResp := 0
 	numSuccessResp := 0
 	respLock := sync.Mutex{}
@@ -68,19 +86,23 @@ func (o *orchestratorPool) GetOrchestrators(numOrchestrators int) ([]*net.Orches
 		respLock.Lock()
 		defer respLock.Unlock()
 		numResp++
-		if err == nil && (o.pred == nil || o.pred(info)) {
-			orchInfos = append(orchInfos, info)
-			numSuccessResp++
+		if err == nil && (o.pred == nil || o.pred(info)) && (pred == nil || pred(info)) && server.OrchAccess.Permitted(info) {
+			if core.CapabilitiesSatisfy(info.Capabilities, caps) {
+				orchInfos = append(orchInfos, info)
+				numSuccessResp++
+			} else {
+				glog.V(common.DEBUG).Infof("orchestrator lacks required capabilities - orch=%v", info.GetTranscoder())
+			}
 		}
 		if err != nil && monitor.Enabled {
 			monitor.LogDiscoveryError(err.Error())
 		}
-		if numSuccessResp >= numOrchestrators || numResp >= len(o.uris) {
+		if numSuccessResp >= numOrchestrators || numResp >= len(uris) {
 			orchChan <- struct{}{}
 		}
 	}
 
-	for _, uri := range o.uris {
+	for _, uri := range uris {
 		go getOrchInfo(uri)
 	}
 
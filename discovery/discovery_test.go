@@ -68,7 +68,7 @@ func TestDeadLock(t *testing.T) {
 	uris := stringsToURIs(addresses)
 	assert := assert.New(t)
 	pool := NewOrchestratorPool(nil, uris)
-	infos, err := pool.GetOrchestrators(1)
+	infos, err := pool.GetOrchestrators(1, nil, nil)
 	assert.Nil(err, "Should not be error")
 	assert.Len(infos, 1, "Should return one orchestrator")
 	assert.Equal("transcoderfromtestserver", infos[0].Transcoder)
@@ -110,7 +110,7 @@ func TestDeadLock_NewOrchestratorPoolWithPred(t *testing.T) {
 	}
 
 	pool := NewOrchestratorPoolWithPred(nil, uris, pred)
-	infos, err := pool.GetOrchestrators(1)
+	infos, err := pool.GetOrchestrators(1, nil, nil)
 
 	assert.Nil(err, "Should not be error")
 	assert.Len(infos, 1, "Should return one orchestrator")
@@ -226,7 +226,7 @@ func TestNewDBOrchestratorPoolCache_GivenListOfOrchs_CreatesPoolCacheCorrectly(t
 	pool, err := NewDBOrchestratorPoolCache(ctx, node, &stubRoundsManager{})
 	require.NoError(err)
 	assert.Equal(pool.Size(), 3)
-	orchs, err := pool.GetOrchestrators(pool.Size())
+	orchs, err := pool.GetOrchestrators(pool.Size(), nil, nil)
 	for _, o := range orchs {
 		assert.Equal(o.PriceInfo, expPriceInfo)
 		assert.Equal(o.Transcoder, expTranscoder)
@@ -565,7 +565,7 @@ func TestCachedPool_AllOrchestratorsTooExpensive_ReturnsEmptyList(t *testing.T)
 
 	urls := pool.GetURLs()
 	assert.Len(urls, 0)
-	infos, err := pool.GetOrchestrators(len(addresses))
+	infos, err := pool.GetOrchestrators(len(addresses), nil, nil)
 
 	assert.Nil(err, "Should not be error")
 	assert.Len(infos, 0)
@@ -659,7 +659,7 @@ func TestCachedPool_GetOrchestrators_MaxBroadcastPriceNotSet(t *testing.T) {
 	for _, url := range urls {
 		assert.Contains(addresses, url.String())
 	}
-	infos, err := pool.GetOrchestrators(50)
+	infos, err := pool.GetOrchestrators(50, nil, nil)
 	for _, info := range infos {
 		assert.Equal(info.PriceInfo, expPriceInfo)
 		assert.Equal(info.Transcoder, expTranscoder)
@@ -772,7 +772,7 @@ func TestCachedPool_N_OrchestratorsGoodPricing_ReturnsNOrchestrators(t *testing.
 		assert.Contains(addresses[25:], url.String())
 	}
 
-	infos, err := pool.GetOrchestrators(len(orchestrators))
+	infos, err := pool.GetOrchestrators(len(orchestrators), nil, nil)
 
 	assert.Nil(err, "Should not be error")
 	assert.Len(infos, 25)
@@ -835,7 +835,7 @@ func TestCachedPool_GetOrchestrators_TicketParamsValidation(t *testing.T) {
 	sender.On("ValidateTicketParams", mock.Anything).Return(errors.New("ValidateTicketParams error")).Times(25)
 	sender.On("ValidateTicketParams", mock.Anything).Return(nil).Times(25)
 
-	infos, err := pool.GetOrchestrators(len(addresses))
+	infos, err := pool.GetOrchestrators(len(addresses), nil, nil)
 	assert.Nil(err)
 	assert.Len(infos, 25)
 	sender.AssertNumberOfCalls(t, "ValidateTicketParams", 50)
@@ -843,7 +843,7 @@ func TestCachedPool_GetOrchestrators_TicketParamsValidation(t *testing.T) {
 	// Test 0 out of 50 orchs pass ticket params validation
 	sender.On("ValidateTicketParams", mock.Anything).Return(errors.New("ValidateTicketParams error")).Times(50)
 
-	infos, err = pool.GetOrchestrators(len(addresses))
+	infos, err = pool.GetOrchestrators(len(addresses), nil, nil)
 	assert.Nil(err)
 	assert.Len(infos, 0)
 	sender.AssertNumberOfCalls(t, "ValidateTicketParams", 100)
@@ -942,7 +942,7 @@ func TestCachedPool_GetOrchestrators_OnlyActiveOrchestrators(t *testing.T) {
 	for _, url := range urls {
 		assert.Contains(addresses[:25], url.String())
 	}
-	infos, err := pool.GetOrchestrators(50)
+	infos, err := pool.GetOrchestrators(50, nil, nil)
 	for _, info := range infos {
 		assert.Equal(info.PriceInfo, expPriceInfo)
 		assert.Equal(info.Transcoder, expTranscoder)
@@ -980,7 +980,7 @@ func TestNewWHOrchestratorPoolCache(t *testing.T) {
 
 	// assert that list is not refreshed if lastRequest is less than 1 min ago and hash is the same
 	lastReq := whpool.lastRequest
-	orchInfo, err := whpool.GetOrchestrators(2)
+	orchInfo, err := whpool.GetOrchestrators(2, nil, nil)
 	require.Nil(err)
 	assert.Len(orchInfo, 2)
 	assert.Equal(3, whpool.Size())
@@ -996,7 +996,7 @@ func TestNewWHOrchestratorPoolCache(t *testing.T) {
 	//  assert that list is not refreshed if lastRequest is more than 1 min ago and hash is the same
 	lastReq = time.Now().Add(-2 * time.Minute)
 	whpool.lastRequest = lastReq
-	orchInfo, err = whpool.GetOrchestrators(2)
+	orchInfo, err = whpool.GetOrchestrators(2, nil, nil)
 	require.Nil(err)
 	assert.Len(orchInfo, 2)
 	assert.Equal(3, whpool.Size())
@@ -1016,7 +1016,7 @@ func TestNewWHOrchestratorPoolCache(t *testing.T) {
 	//  assert that list is not refreshed if lastRequest is less than 1 min ago and hash is not the same
 	lastReq = time.Now()
 	whpool.lastRequest = lastReq
-	orchInfo, err = whpool.GetOrchestrators(2)
+	orchInfo, err = whpool.GetOrchestrators(2, nil, nil)
 	require.Nil(err)
 	assert.Len(orchInfo, 2)
 	assert.Equal(3, whpool.Size())
@@ -1033,7 +1033,7 @@ func TestNewWHOrchestratorPoolCache(t *testing.T) {
 	//  assert that list is refreshed if lastRequest is longer than 1 min ago and hash is not the same
 	lastReq = time.Now().Add(-2 * time.Minute)
 	whpool.lastRequest = lastReq
-	orchInfo, err = whpool.GetOrchestrators(2)
+	orchInfo, err = whpool.GetOrchestrators(2, nil, nil)
 	require.Nil(err)
 	assert.Len(orchInfo, 2)
 	assert.Equal(3, whpool.Size())
@@ -1108,3 +1108,117 @@ func TestEthOrchToDBOrch(t *testing.T) {
 	assert.Equal(dbo.ActivationRound, o.ActivationRound.Int64())
 	assert.Equal(dbo.DeactivationRound,  int64(math.MaxInt64))
 }
+
+func TestOrchestratorPool_OrchAccess(t *testing.T) {
+	defer func(l *server.OrchAccessList) { server.OrchAccess = l }(server.OrchAccess)
+	assert := assert.New(t)
+	require := require.New(t)
+	dbh, dbraw, err := common.TempDB(t)
+	defer dbh.Close()
+	defer dbraw.Close()
+	require.Nil(err)
+
+	var mu sync.Mutex
+	contacted := make(map[string]bool)
+	serverGetOrchInfo = func(ctx context.Context, bcast common.Broadcaster, orchestratorServer *url.URL) (*net.OrchestratorInfo, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		contacted[orchestratorServer.Host] = true
+		recipient := ethcommon.BytesToAddress([]byte(orchestratorServer.Host))
+		return &net.OrchestratorInfo{
+			Transcoder:   orchestratorServer.String(),
+			TicketParams: &net.TicketParams{Recipient: recipient.Bytes()},
+		}, nil
+	}
+
+	server.OrchAccess, err = server.NewOrchAccessList(dbh)
+	require.Nil(err)
+	require.Nil(server.OrchAccess.Deny("https://127.0.0.1:8936", "", 0))
+	require.Nil(server.OrchAccess.Deny(ethcommon.BytesToAddress([]byte("127.0.0.1:8937")).Hex(), "", 0))
+
+	uris := stringsToURIs([]string{"https://127.0.0.1:8936", "https://127.0.0.1:8937", "https://127.0.0.1:8938"})
+	pool := NewOrchestratorPool(nil, uris)
+	infos, err := pool.GetOrchestrators(3, nil, nil)
+	assert.Nil(err)
+	require.Len(infos, 1)
+	assert.Equal("https://127.0.0.1:8938", infos[0].Transcoder)
+
+	// denied URIs are not contacted at all
+	assert.False(contacted["127.0.0.1:8936"])
+	assert.True(contacted["127.0.0.1:8937"])
+
+	// nothing left to contact
+	require.Nil(server.OrchAccess.Deny("https://127.0.0.1:8937", "", 0))
+	require.Nil(server.OrchAccess.Deny("https://127.0.0.1:8938", "", 0))
+	infos, err = pool.GetOrchestrators(3, nil, nil)
+	assert.Nil(err)
+	assert.Empty(infos)
+}
+
+func TestOrchestratorPool_Capabilities(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	h265 := core.NewCapabilities([]core.VideoCodec{core.CodecH264, core.CodecH265}, false, 0)
+	serverGetOrchInfo = func(ctx context.Context, bcast common.Broadcaster, orchestratorServer *url.URL) (*net.OrchestratorInfo, error) {
+		info := &net.OrchestratorInfo{Transcoder: orchestratorServer.String()}
+		switch orchestratorServer.Host {
+		case "127.0.0.1:8937":
+			info.Capabilities = h265
+		case "127.0.0.1:8938":
+			info.Capabilities = core.NewCapabilities([]core.VideoCodec{core.CodecH264}, false, 1280*720)
+		}
+		return info, nil
+	}
+
+	uris := stringsToURIs([]string{"https://127.0.0.1:8936", "https://127.0.0.1:8937", "https://127.0.0.1:8938"})
+	pool := NewOrchestratorPool(nil, uris)
+
+	// Any orchestrator can transcode if nothing is required
+	infos, err := pool.GetOrchestrators(3, nil, nil)
+	assert.Nil(err)
+	assert.Len(infos, 3)
+
+	// Orchestrators without capabilities only support the legacy ones
+	infos, err = pool.GetOrchestrators(3, &net.Capabilities{Codecs: []net.VideoProfile_VideoCodec{net.VideoProfile_H265}}, nil)
+	assert.Nil(err)
+	require.Len(infos, 1)
+	assert.Equal("https://127.0.0.1:8937", infos[0].Transcoder)
+
+	// Renditions too large for an orchestrator
+	infos, err = pool.GetOrchestrators(3, &net.Capabilities{
+		Codecs:    []net.VideoProfile_VideoCodec{net.VideoProfile_H264},
+		MaxPixels: 1920 * 1080,
+	}, nil)
+	assert.Nil(err)
+	assert.Len(infos, 2)
+	for _, info := range infos {
+		assert.NotEqual("https://127.0.0.1:8938", info.Transcoder)
+	}
+}
+
+func TestOrchestratorPool_StreamPredicate(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	serverGetOrchInfo = func(ctx context.Context, bcast common.Broadcaster, orchestratorServer *url.URL) (*net.OrchestratorInfo, error) {
+		if orchestratorServer.Host == "127.0.0.1:8936" {
+			// Answers first
+			return &net.OrchestratorInfo{Transcoder: orchestratorServer.String()}, nil
+		}
+		time.Sleep(20 * time.Millisecond)
+		return &net.OrchestratorInfo{Transcoder: orchestratorServer.String()}, nil
+	}
+	uris := stringsToURIs([]string{"https://127.0.0.1:8936", "https://127.0.0.1:8937", "https://127.0.0.1:8938"})
+	pool := NewOrchestratorPool(nil, uris)
+
+	// Orchestrators the stream doesn't accept don't count towards the number
+	// asked for
+	pred := func(info *net.OrchestratorInfo) bool { return info.Transcoder != "https://127.0.0.1:8936" }
+	infos, err := pool.GetOrchestrators(2, nil, pred)
+	assert.Nil(err)
+	require.Len(infos, 2)
+	for _, info := range infos {
+		assert.NotEqual("https://127.0.0.1:8936", info.Transcoder)
+	}
+}
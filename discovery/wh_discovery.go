@@ -90,7 +90,9 @@ func (w *webhookPool) Size() int {
 	return len(w.GetURLs())
 }
 
-func (w *webhookPool) GetOrchestrators(numOrchestrators int) ([]*net.OrchestratorInfo, error) {
+func (w *webhookPool) GetOrchestrators(numOrchestrators int, caps *net.Capabilities,
+	pred func(*net.OrchestratorInfo) bool) ([]*net.OrchestratorInfo, error) {
+
 	_, err := w.getURLs()
 	if err != nil {
 		return nil, err
@@ -99,7 +101,7 @@ func (w *webhookPool) GetOrchestrators(numOrchestrators int) ([]*net.Orchestrato
 	w.mu.RLock()
 	defer w.mu.RUnlock()
 
-	return w.pool.GetOrchestrators(numOrchestrators)
+	return w.pool.GetOrchestrators(numOrchestrators, caps, pred)
 }
 
 var getURLsfromWebhook = func(cbUrl *url.URL) ([]byte, error) {
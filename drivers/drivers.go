@@ -3,9 +3,14 @@ package drivers
 
 import (
 	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang/glog"
@@ -16,6 +21,8 @@ import (
 // NodeStorage is current node's primary driver
 var NodeStorage OSDriver
 
+var ErrUnsupportedOSURL = errors.New("ErrUnsupportedOSURL")
+
 // OSDriver common interface for Object Storage
 type OSDriver interface {
 	NewSession(path string) OSSession
@@ -32,6 +39,32 @@ type OSSession interface {
 	IsExternal() bool
 }
 
+// LocalSession is implemented by sessions that keep data on this node and
+// can read it back given its URI
+type LocalSession interface {
+	GetData(uri string) []byte
+}
+
+// ReaderSession is implemented by sessions that can save data as it is
+// read, without holding all of it in memory first. The size is the number
+// of bytes the reader yields, or -1 if unknown. Errors returned by the
+// reader abort the save.
+type ReaderSession interface {
+	SaveReader(name string, r io.Reader, size int64) (string, error)
+}
+
+// PresignedSession is implemented by sessions that can grant other nodes
+// write access to individual objects rather than to the whole session
+type PresignedSession interface {
+	// PresignedInfo returns info allowing uploads of the named objects, or
+	// nil if access is granted to the whole session through GetInfo
+	PresignedInfo(names []string) *net.OSInfo
+}
+
+// SessionStorage lists the storage types of the OSInfo that NewSession can
+// open, which this node can upload to on behalf of other nodes
+var SessionStorage = []net.OSInfo_StorageType{net.OSInfo_S3, net.OSInfo_GOOGLE}
+
 // NewSession returns new session based on OSInfo received from the network
 func NewSession(info *net.OSInfo) OSSession {
 	if info == nil {
@@ -46,11 +79,79 @@ func NewSession(info *net.OSInfo) OSSession {
 	return nil
 }
 
+// ParseOSURL creates a driver from a URL describing an object store, either
+// s3://ACCESSKEYID:ACCESSKEY@region/bucket?endpoint=http://host:9000&pathStyle=true&presignedPut=true,
+// gs://bucket?keyfile=/path/to/key.json or
+// file:///path/to/dir?maxAge=24h&maxSize=1073741824&prefix=/files/
+func ParseOSURL(input string) (OSDriver, error) {
+	u, err := url.Parse(input)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "s3":
+		secret, ok := u.User.Password()
+		bucket := strings.Trim(u.Path, "/")
+		if !ok || u.User.Username() == "" || u.Host == "" || bucket == "" {
+			return nil, fmt.Errorf("Invalid S3 URL; expected s3://ACCESSKEYID:ACCESSKEY@region/bucket")
+		}
+		query := u.Query()
+		cfg := S3Config{
+			Endpoint:        query.Get("endpoint"),
+			Region:          u.Host,
+			Bucket:          bucket,
+			AccessKey:       u.User.Username(),
+			AccessKeySecret: secret,
+		}
+		if v := query.Get("pathStyle"); v != "" {
+			if cfg.PathStyle, err = strconv.ParseBool(v); err != nil {
+				return nil, err
+			}
+		}
+		if v := query.Get("presignedPut"); v != "" {
+			if cfg.PresignedPut, err = strconv.ParseBool(v); err != nil {
+				return nil, err
+			}
+		}
+		return NewS3DriverWithConfig(cfg)
+	case "gs":
+		keyFile := u.Query().Get("keyfile")
+		if u.Host == "" || keyFile == "" {
+			return nil, fmt.Errorf("Invalid GS URL; expected gs://bucket?keyfile=/path/to/key.json")
+		}
+		return NewGoogleDriver(u.Host, keyFile)
+	case "file":
+		if u.Path == "" {
+			return nil, fmt.Errorf("Invalid file URL; expected file:///path/to/dir")
+		}
+		var retention FSRetention
+		query := u.Query()
+		if maxAge := query.Get("maxAge"); maxAge != "" {
+			if retention.MaxAge, err = time.ParseDuration(maxAge); err != nil {
+				return nil, err
+			}
+		}
+		if maxSize := query.Get("maxSize"); maxSize != "" {
+			if retention.MaxSize, err = strconv.ParseInt(maxSize, 10, 64); err != nil {
+				return nil, err
+			}
+		}
+		return NewFSDriver(u.Path, nil, query.Get("prefix"), retention)
+	}
+	return nil, ErrUnsupportedOSURL
+}
+
 func IsOwnExternal(uri string) bool {
 	return IsOwnStorageS3(uri) || IsOwnStorageGS(uri)
 }
 
 func GetSegmentData(uri string) ([]byte, error) {
+	// Read straight from disk if the data is in our filesystem storage
+	if fs, ok := NodeStorage.(*FSOS); ok {
+		if data := fs.GetData(uri); data != nil {
+			return data, nil
+		}
+	}
 	return getSegmentDataHTTP(uri)
 }
 
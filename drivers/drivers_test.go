@@ -0,0 +1,77 @@
+package drivers
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/livepeer/go-livepeer/net"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseOSURL(t *testing.T) {
+	assert := assert.New(t)
+
+	d, err := ParseOSURL("s3://user:secret@us-east-1/bucket")
+	assert.Nil(err)
+	s3, ok := d.(*s3OS)
+	assert.True(ok)
+	assert.Equal("us-east-1", s3.region)
+	assert.Equal("bucket", s3.bucket)
+	assert.Equal("user", s3.awsAccessKeyID)
+	assert.Equal("secret", s3.awsSecretAccessKey)
+
+	assert.Equal("https://bucket.s3.amazonaws.com", s3.host)
+	assert.False(s3.presignedPut)
+
+	d, err = ParseOSURL("s3://user:secret@us-east-1/bucket?endpoint=http://minio:9000&pathStyle=true&presignedPut=true")
+	require.Nil(t, err)
+	s3 = d.(*s3OS)
+	assert.Equal("http://minio:9000/bucket", s3.host)
+	assert.Equal("http://minio:9000", s3.endpoint)
+	assert.True(s3.presignedPut)
+	_, err = ParseOSURL("s3://user:secret@us-east-1/bucket?pathStyle=maybe")
+	assert.NotNil(err)
+
+	_, err = ParseOSURL("s3://user@us-east-1/bucket")
+	assert.NotNil(err)
+	_, err = ParseOSURL("s3://user:secret@us-east-1")
+	assert.NotNil(err)
+
+	_, err = ParseOSURL("gs://bucket")
+	assert.NotNil(err)
+	_, err = ParseOSURL("gs://bucket?keyfile=/nonexistent.json")
+	assert.NotNil(err)
+
+	dir, err := ioutil.TempDir("", "parseosurl")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	d, err = ParseOSURL("file://" + dir + "?maxAge=1h&maxSize=1024&prefix=/recordings/")
+	require.Nil(t, err)
+	fs, ok := d.(*FSOS)
+	require.True(t, ok)
+	assert.Equal("/recordings/", fs.Prefix())
+	assert.Equal(FSRetention{MaxAge: time.Hour, MaxSize: 1024}, fs.retention)
+	_, err = ParseOSURL("file://" + dir + "?maxAge=1x")
+	assert.NotNil(err)
+	_, err = ParseOSURL("file://" + dir + "?maxSize=big")
+	assert.NotNil(err)
+
+	_, err = ParseOSURL("ftp://example.com/dir")
+	assert.Equal(ErrUnsupportedOSURL, err)
+}
+
+func TestNewSession_SessionStorage(t *testing.T) {
+	assert := assert.New(t)
+
+	// Sessions can be opened for every storage type advertised to other nodes
+	for _, s := range SessionStorage {
+		sess := NewSession(&net.OSInfo{StorageType: s, S3Info: &net.S3OSInfo{Host: "https://example.com"}})
+		if assert.NotNil(sess, s.String()) {
+			assert.Equal(s, sess.GetInfo().StorageType)
+		}
+	}
+	assert.Nil(NewSession(&net.OSInfo{StorageType: net.OSInfo_DIRECT}))
+}
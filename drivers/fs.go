@@ -0,0 +1,278 @@
+package drivers
+
+import (
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/livepeer/go-livepeer/net"
+)
+
+// Default HTTP path prefix under which filesystem storage is served
+const FSDefaultPrefix = "/files/"
+
+var fsRetentionInterval = time.Minute
+
+// Prefix of files being written, before they're renamed into place
+const fsTempPrefix = ".tmp-"
+
+// FSRetention limits how much data a filesystem storage keeps. Zero values
+// mean no limit.
+type FSRetention struct {
+	// Files older than this are removed
+	MaxAge time.Duration
+	// Oldest files are removed once the total size exceeds this many bytes
+	MaxSize int64
+}
+
+// FSOS is a durable object storage backed by a local directory. Saved files
+// are served over HTTP under a path prefix; see ServeHTTP.
+type FSOS struct {
+	baseDir   string
+	baseURI   *url.URL
+	prefix    string
+	retention FSRetention
+	// Held while files are written or removed
+	lock sync.Mutex
+}
+
+type FSSession struct {
+	os   *FSOS
+	path string
+}
+
+// NewFSDriver creates a filesystem storage rooted at baseDir. URIs of saved
+// files are baseURI + prefix + file path; baseURI may be nil for relative
+// URIs. If retention limits are set, they are enforced periodically.
+func NewFSDriver(baseDir string, baseURI *url.URL, prefix string, retention FSRetention) (*FSOS, error) {
+	if err := os.MkdirAll(baseDir, 0755); err != nil {
+		return nil, err
+	}
+	if prefix == "" {
+		prefix = FSDefaultPrefix
+	}
+	fs := &FSOS{
+		baseDir:   baseDir,
+		baseURI:   baseURI,
+		prefix:    "/" + strings.Trim(prefix, "/") + "/",
+		retention: retention,
+	}
+	if retention.MaxAge > 0 || retention.MaxSize > 0 {
+		go fs.retentionLoop()
+	}
+	return fs, nil
+}
+
+func (ostore *FSOS) NewSession(path string) OSSession {
+	return &FSSession{os: ostore, path: path}
+}
+
+// Prefix returns the HTTP path prefix the storage is served under
+func (ostore *FSOS) Prefix() string {
+	return ostore.prefix
+}
+
+// ServeHTTP serves saved files. Requests must be for paths under Prefix.
+func (ostore *FSOS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, ostore.prefix) {
+		http.NotFound(w, r)
+		return
+	}
+	fname := ostore.filePath(strings.TrimPrefix(r.URL.Path, ostore.prefix))
+	info, err := os.Stat(fname)
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", fsContentType(fname))
+	http.ServeFile(w, r, fname)
+}
+
+// GetData reads a saved file given its URI, or nil if there is no such file
+func (ostore *FSOS) GetData(uri string) []byte {
+	name, ok := ostore.nameFromURI(uri)
+	if !ok {
+		return nil
+	}
+	data, err := ioutil.ReadFile(ostore.filePath(name))
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+func (ostore *FSOS) nameFromURI(uri string) (string, bool) {
+	if ostore.baseURI != nil {
+		uri = strings.TrimPrefix(uri, ostore.baseURI.String())
+	}
+	if !strings.HasPrefix(uri, ostore.prefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(uri, ostore.prefix), true
+}
+
+// filePath maps a storage path to a location within the base directory;
+// paths can't escape it
+func (ostore *FSOS) filePath(name string) string {
+	return filepath.Join(ostore.baseDir, filepath.FromSlash(path.Clean("/"+name)))
+}
+
+func (ostore *FSOS) uri(name string) string {
+	uri := ostore.prefix + strings.TrimPrefix(path.Clean("/"+name), "/")
+	if ostore.baseURI != nil {
+		return ostore.baseURI.String() + uri
+	}
+	return uri
+}
+
+func (ostore *FSOS) retentionLoop() {
+	ticker := time.NewTicker(fsRetentionInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		ostore.prune(time.Now())
+	}
+}
+
+type fsFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// prune removes files past the age limit, then the oldest files until the
+// total size is within the size limit. The directory is walked without the
+// lock so writes aren't held up; candidates are checked again under the
+// lock before being removed.
+func (ostore *FSOS) prune(now time.Time) {
+	var files []fsFile
+	var total int64
+	err := filepath.Walk(ostore.baseDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || strings.HasPrefix(info.Name(), fsTempPrefix) {
+			return nil
+		}
+		files = append(files, fsFile{path: p, size: info.Size(), modTime: info.ModTime()})
+		total += info.Size()
+		return nil
+	})
+	if err != nil {
+		glog.Errorf("Error applying storage retention dir=%s err=%v", ostore.baseDir, err)
+		return
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	for _, f := range files {
+		expired := ostore.retention.MaxAge > 0 && now.Sub(f.modTime) > ostore.retention.MaxAge
+		oversized := ostore.retention.MaxSize > 0 && total > ostore.retention.MaxSize
+		if !expired && !oversized {
+			// Files are ordered by age, so the rest are within limits
+			break
+		}
+		if ostore.removeUnchanged(f) {
+			total -= f.size
+		}
+	}
+}
+
+// removeUnchanged removes a file found while pruning, unless it was
+// rewritten since. Returns whether the file is gone.
+func (ostore *FSOS) removeUnchanged(f fsFile) bool {
+	ostore.lock.Lock()
+	defer ostore.lock.Unlock()
+	info, err := os.Stat(f.path)
+	if os.IsNotExist(err) {
+		return true
+	}
+	if err != nil || !info.ModTime().Equal(f.modTime) {
+		return false
+	}
+	return ostore.remove(f.path)
+}
+
+// remove deletes a file along with any directories left empty. Must be
+// called with the lock held, so directories aren't removed from under a
+// file being saved.
+func (ostore *FSOS) remove(p string) bool {
+	if err := os.Remove(p); err != nil {
+		glog.Errorf("Error removing file=%s err=%v", p, err)
+		return false
+	}
+	for dir := filepath.Dir(p); dir != filepath.Clean(ostore.baseDir); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return true
+}
+
+func (session *FSSession) SaveData(name string, data []byte) (string, error) {
+	name = session.path + "/" + name
+	fname := session.os.filePath(name)
+
+	session.os.lock.Lock()
+	defer session.os.lock.Unlock()
+	if err := os.MkdirAll(filepath.Dir(fname), 0755); err != nil {
+		return "", err
+	}
+	// Write to a temporary file first so readers never see partial data
+	tmp, err := ioutil.TempFile(filepath.Dir(fname), fsTempPrefix)
+	if err != nil {
+		return "", err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), fname); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return session.os.uri(name), nil
+}
+
+// GetData reads a saved file given its URI, or nil if there is no such file
+func (session *FSSession) GetData(uri string) []byte {
+	return session.os.GetData(uri)
+}
+
+// EndSession is a no-op; files are kept until removed by retention
+func (session *FSSession) EndSession() {
+}
+
+func (session *FSSession) GetInfo() *net.OSInfo {
+	return nil
+}
+
+func (session *FSSession) IsExternal() bool {
+	return false
+}
+
+func fsContentType(fname string) string {
+	switch path.Ext(fname) {
+	case ".ts":
+		return "video/MP2T"
+	case ".m4s", ".mp4":
+		return "video/mp4"
+	case ".m3u8":
+		return "application/vnd.apple.mpegurl"
+	case ".mpd":
+		return "application/dash+xml"
+	}
+	if typ := mime.TypeByExtension(path.Ext(fname)); typ != "" {
+		return typ
+	}
+	return "application/octet-stream"
+}
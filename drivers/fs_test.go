@@ -0,0 +1,162 @@
+package drivers
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFSSession(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "fsos")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	fs, err := NewFSDriver(dir, nil, "", FSRetention{})
+	require.Nil(t, err)
+	assert.Equal(FSDefaultPrefix, fs.Prefix())
+	sess := fs.NewSession("mid")
+	assert.False(sess.IsExternal())
+	assert.Nil(sess.GetInfo())
+
+	uri, err := sess.SaveData("P144p30fps16x9/1.ts", []byte("data"))
+	require.Nil(t, err)
+	assert.Equal("/files/mid/P144p30fps16x9/1.ts", uri)
+	data, err := ioutil.ReadFile(filepath.Join(dir, "mid", "P144p30fps16x9", "1.ts"))
+	require.Nil(t, err)
+	assert.Equal([]byte("data"), data)
+	assert.Equal([]byte("data"), sess.(LocalSession).GetData(uri))
+	assert.Nil(fs.GetData("/files/mid/P144p30fps16x9/2.ts"))
+	assert.Nil(fs.GetData("/other/mid/P144p30fps16x9/1.ts"))
+
+	// overwrites
+	_, err = sess.SaveData("P144p30fps16x9/1.ts", []byte("new data"))
+	require.Nil(t, err)
+	assert.Equal([]byte("new data"), fs.GetData(uri))
+
+	// names can't escape the base directory
+	uri, err = sess.SaveData("../../../escape.ts", []byte("data"))
+	require.Nil(t, err)
+	assert.Equal("/files/escape.ts", uri)
+	_, err = os.Stat(filepath.Join(dir, "escape.ts"))
+	assert.Nil(err)
+
+	// data is kept after the session ends
+	sess.EndSession()
+	assert.Equal([]byte("new data"), fs.GetData("/files/mid/P144p30fps16x9/1.ts"))
+
+	// absolute URIs
+	base, _ := url.Parse("https://127.0.0.1:8935")
+	fs, err = NewFSDriver(dir, base, "/recordings", FSRetention{})
+	require.Nil(t, err)
+	assert.Equal("/recordings/", fs.Prefix())
+	uri, err = fs.NewSession("mid").SaveData("index.m3u8", []byte("#EXTM3U"))
+	require.Nil(t, err)
+	assert.Equal("https://127.0.0.1:8935/recordings/mid/index.m3u8", uri)
+	assert.Equal([]byte("#EXTM3U"), fs.GetData(uri))
+}
+
+func TestFSServeHTTP(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "fsos")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	fs, err := NewFSDriver(dir, nil, "", FSRetention{})
+	require.Nil(t, err)
+	_, err = fs.NewSession("mid").SaveData("P144p30fps16x9/1.ts", []byte("data"))
+	require.Nil(t, err)
+
+	get := func(path string) *http.Response {
+		w := httptest.NewRecorder()
+		fs.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w.Result()
+	}
+	resp := get("/files/mid/P144p30fps16x9/1.ts")
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal("video/MP2T", resp.Header.Get("Content-Type"))
+	assert.Equal("data", string(body))
+
+	assert.Equal(http.StatusNotFound, get("/files/mid/P144p30fps16x9/2.ts").StatusCode)
+	assert.Equal(http.StatusNotFound, get("/files/mid").StatusCode)
+	assert.Equal(http.StatusNotFound, get("/other/mid/P144p30fps16x9/1.ts").StatusCode)
+}
+
+func TestFSGetSegmentData(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fsos")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	fs, err := NewFSDriver(dir, nil, "", FSRetention{})
+	require.Nil(t, err)
+	uri, err := fs.NewSession("mid").SaveData("1.ts", []byte("data"))
+	require.Nil(t, err)
+
+	defer func(s OSDriver) { NodeStorage = s }(NodeStorage)
+	NodeStorage = fs
+	data, err := GetSegmentData(uri)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("data"), data)
+}
+
+func TestFSRetention(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "fsos")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	fs, err := NewFSDriver(dir, nil, "", FSRetention{})
+	require.Nil(t, err)
+	sess := fs.NewSession("mid")
+
+	now := time.Now()
+	save := func(name string, size int, age time.Duration) string {
+		uri, err := sess.SaveData(name, make([]byte, size))
+		require.Nil(t, err)
+		fname := filepath.Join(dir, "mid", filepath.FromSlash(name))
+		require.Nil(t, os.Chtimes(fname, now.Add(-age), now.Add(-age)))
+		return uri
+	}
+	old := save("old/1.ts", 10, 2*time.Hour)
+	a := save("P144p30fps16x9/1.ts", 10, 30*time.Minute)
+	b := save("P144p30fps16x9/2.ts", 10, 20*time.Minute)
+	c := save("P144p30fps16x9/3.ts", 10, 10*time.Minute)
+
+	// no limits
+	fs.prune(now)
+	assert.NotNil(fs.GetData(old))
+
+	// by age; empty directories are removed too
+	fs.retention = FSRetention{MaxAge: time.Hour}
+	fs.prune(now)
+	assert.Nil(fs.GetData(old))
+	_, err = os.Stat(filepath.Join(dir, "mid", "old"))
+	assert.True(os.IsNotExist(err))
+	assert.NotNil(fs.GetData(a))
+
+	// by size, oldest first
+	fs.retention = FSRetention{MaxSize: 20}
+	fs.prune(now)
+	assert.Nil(fs.GetData(a))
+	assert.NotNil(fs.GetData(b))
+	assert.NotNil(fs.GetData(c))
+	_, err = os.Stat(dir)
+	assert.Nil(err)
+
+	// files rewritten after the walk are kept
+	fname := filepath.Join(dir, "mid", "P144p30fps16x9", "2.ts")
+	info, err := os.Stat(fname)
+	require.Nil(t, err)
+	stale := fsFile{path: fname, size: info.Size(), modTime: info.ModTime()}
+	save("P144p30fps16x9/2.ts", 10, 0)
+	assert.False(fs.removeUnchanged(stale))
+	assert.NotNil(fs.GetData(b))
+	stale.path = filepath.Join(dir, "mid", "nonexistent.ts")
+	assert.True(fs.removeUnchanged(stale))
+}
@@ -1,6 +1,7 @@
 package drivers
 
 import (
+	"bufio"
 	"bytes"
 	"crypto/hmac"
 	"crypto/sha256"
@@ -8,9 +9,12 @@ import (
 	"encoding/hex"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"mime/multipart"
 	"net/http"
+	"net/url"
 	"path"
+	"sort"
 	"strings"
 	"time"
 
@@ -27,21 +31,30 @@ import (
 // S3_POLICY_EXPIRE_IN_HOURS how long access rights given to other node will be valid
 const S3_POLICY_EXPIRE_IN_HOURS = 24
 
+// Region used for signing requests to S3-compatible stores that don't
+// have regions, such as MinIO
+const s3DefaultRegion = "us-east-1"
+
 /* S3OS S# backed object storage driver. For own storage access key and access key secret
    should be specified. To give to other nodes access to own S3 storage so called 'POST' policy
    is created. This policy is valid for S3_POLICY_EXPIRE_IN_HOURS hours.
+   Alternatively, with presigned PUTs other nodes are given SigV4 presigned URLs
+   for each object they are expected to upload.
 */
 type s3OS struct {
 	host               string
+	endpoint           string
 	region             string
 	bucket             string
 	awsAccessKeyID     string
 	awsSecretAccessKey string
+	presignedPut       bool
 	s3svc              *s3.S3
 }
 
 type s3Session struct {
 	host        string
+	endpoint    string
 	key         string
 	policy      string
 	signature   string
@@ -49,61 +62,139 @@ type s3Session struct {
 	xAmzDate    string
 	storageType net.OSInfo_StorageType
 	fields      map[string]string
+	// URLs for uploading objects by name, received from the storage owner
+	presignedURLs map[string]string
+	// Storage this session belongs to, if it is our own
+	owner *s3OS
+}
+
+// S3Config describes an S3 or S3-compatible object store
+type S3Config struct {
+	// Base URL of an S3-compatible service, e.g. http://minio:9000.
+	// Defaults to AWS S3.
+	Endpoint string
+	Region   string
+	Bucket   string
+	// Address the bucket as a path of the endpoint rather than as a subdomain
+	PathStyle       bool
+	AccessKey       string
+	AccessKeySecret string
+	// Grant other nodes write access via presigned PUT URLs rather than a
+	// POST policy
+	PresignedPut bool
 }
 
 // S3BUCKET s3 bucket owned by this node
 var S3BUCKET string
 
+// S3HOST base URL of the s3 bucket owned by this node, if not on AWS
+var S3HOST string
+
 func s3Host(bucket string) string {
 	return fmt.Sprintf("https://%s.s3.amazonaws.com", bucket)
 }
 
+// S3BucketURL returns the base URL of objects in a bucket. Buckets are
+// addressed as subdomains of the endpoint unless pathStyle is set.
+func S3BucketURL(endpoint, bucket string, pathStyle bool) (string, error) {
+	if endpoint == "" {
+		if !pathStyle {
+			return s3Host(bucket), nil
+		}
+		endpoint = "https://s3.amazonaws.com"
+	}
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("Invalid S3 endpoint %s", endpoint)
+	}
+	if pathStyle {
+		return fmt.Sprintf("%s://%s/%s", u.Scheme, u.Host, bucket), nil
+	}
+	return fmt.Sprintf("%s://%s.%s", u.Scheme, bucket, u.Host), nil
+}
+
 // IsOwnStorageS3 returns true if uri points to S3 bucket owned by this node
 func IsOwnStorageS3(uri string) bool {
+	if S3HOST != "" {
+		return strings.HasPrefix(uri, S3HOST)
+	}
 	return strings.HasPrefix(uri, s3Host(S3BUCKET))
 }
 
 func newS3Session(info *net.S3OSInfo) OSSession {
 	sess := &s3Session{
-		host:        info.Host,
-		key:         info.Key,
-		policy:      info.Policy,
-		signature:   info.Signature,
-		xAmzDate:    info.XAmzDate,
-		credential:  info.Credential,
-		storageType: net.OSInfo_S3,
+		host:          info.Host,
+		endpoint:      info.Endpoint,
+		key:           info.Key,
+		policy:        info.Policy,
+		signature:     info.Signature,
+		xAmzDate:      info.XAmzDate,
+		credential:    info.Credential,
+		storageType:   net.OSInfo_S3,
+		presignedURLs: info.PresignedUrls,
 	}
 	sess.fields = s3GetFields(sess)
 	return sess
 }
 
 func NewS3Driver(region, bucket, accessKey, accessKeySecret string) OSDriver {
+	os, _ := NewS3DriverWithConfig(S3Config{
+		Region:          region,
+		Bucket:          bucket,
+		AccessKey:       accessKey,
+		AccessKeySecret: accessKeySecret,
+	})
+	return os
+}
+
+// NewS3DriverWithConfig creates a driver for an S3 or S3-compatible store
+func NewS3DriverWithConfig(cfg S3Config) (OSDriver, error) {
+	host, err := S3BucketURL(cfg.Endpoint, cfg.Bucket, cfg.PathStyle)
+	if err != nil {
+		return nil, err
+	}
+	region := cfg.Region
+	if region == "" && cfg.Endpoint != "" {
+		region = s3DefaultRegion
+	}
 	os := &s3OS{
-		host:               s3Host(bucket),
+		host:               host,
+		endpoint:           cfg.Endpoint,
 		region:             region,
-		bucket:             bucket,
-		awsAccessKeyID:     accessKey,
-		awsSecretAccessKey: accessKeySecret,
+		bucket:             cfg.Bucket,
+		awsAccessKeyID:     cfg.AccessKey,
+		awsSecretAccessKey: cfg.AccessKeySecret,
+		presignedPut:       cfg.PresignedPut,
 	}
 	if os.awsAccessKeyID != "" {
 		creds := credentials.NewStaticCredentials(os.awsAccessKeyID, os.awsSecretAccessKey, "")
-		cfg := aws.NewConfig().WithRegion(os.region).WithCredentials(creds)
-		os.s3svc = s3.New(session.New(), cfg)
+		awsCfg := aws.NewConfig().WithRegion(os.region).WithCredentials(creds)
+		if cfg.Endpoint != "" {
+			awsCfg = awsCfg.WithEndpoint(cfg.Endpoint)
+		}
+		awsCfg = awsCfg.WithS3ForcePathStyle(cfg.PathStyle)
+		os.s3svc = s3.New(session.New(), awsCfg)
 	}
-	return os
+	return os, nil
 }
 
 func (os *s3OS) NewSession(path string) OSSession {
-	policy, signature, credential, xAmzDate := createPolicy(os.awsAccessKeyID,
-		os.bucket, os.region, os.awsSecretAccessKey, path)
 	sess := &s3Session{
-		host:        s3Host(os.bucket),
+		host:        os.host,
+		endpoint:    os.endpoint,
 		key:         path,
-		policy:      policy,
-		signature:   signature,
-		credential:  credential,
-		xAmzDate:    xAmzDate,
 		storageType: net.OSInfo_S3,
+		owner:       os,
+	}
+	if !os.presignedPut {
+		sess.policy, sess.signature, sess.credential, sess.xAmzDate = createPolicy(os.awsAccessKeyID,
+			os.bucket, os.region, os.awsSecretAccessKey, path)
 	}
 	sess.fields = s3GetFields(sess)
 	return sess
@@ -126,10 +217,33 @@ func (os *s3Session) EndSession() {
 }
 
 func (os *s3Session) SaveData(name string, data []byte) (string, error) {
+	return os.SaveReader(name, bytes.NewReader(data), int64(len(data)))
+}
+
+// SaveReader uploads data as it is read. S3 needs the length of uploads
+// upfront, so data of unknown size is read fully first.
+func (os *s3Session) SaveReader(name string, r io.Reader, size int64) (string, error) {
+	if size < 0 {
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return "", err
+		}
+		r, size = bytes.NewReader(data), int64(len(data))
+	}
 	// tentativeUrl just used for logging
 	tentativeURL := path.Join(os.host, os.key, name)
 	glog.V(common.VERBOSE).Infof("Saving to S3 %s", tentativeURL)
-	path, err := os.postData(name, data)
+	// The content type is detected from the start of the data
+	br := bufio.NewReaderSize(r, 512)
+	head, _ := br.Peek(512)
+	fileType := http.DetectContentType(head)
+	var path string
+	var err error
+	if uploadURL := os.uploadURL(name); uploadURL != "" {
+		path, err = os.putData(uploadURL, name, br, size, fileType)
+	} else {
+		path, err = os.postData(name, br, size, fileType)
+	}
 	if err != nil {
 		// handle error
 		glog.Errorf("Save S3 error: %v", err)
@@ -146,25 +260,90 @@ func (os *s3Session) getAbsURL(path string) string {
 	return os.host + "/" + path
 }
 
+// GetInfo returns the info other nodes need to upload into this session.
+// Returns nil for own storage using presigned PUTs, since no policy covers
+// the whole session; see PresignedInfo.
 func (os *s3Session) GetInfo() *net.OSInfo {
+	if os.owner != nil && os.owner.presignedPut {
+		return nil
+	}
 	oi := &net.OSInfo{
 		S3Info: &net.S3OSInfo{
-			Host:       os.host,
-			Key:        os.key,
-			Policy:     os.policy,
-			Signature:  os.signature,
-			Credential: os.credential,
-			XAmzDate:   os.xAmzDate,
+			Host:          os.host,
+			Key:           os.key,
+			Policy:        os.policy,
+			Signature:     os.signature,
+			Credential:    os.credential,
+			XAmzDate:      os.xAmzDate,
+			Endpoint:      os.endpoint,
+			PresignedUrls: os.presignedURLs,
 		},
 		StorageType: os.storageType,
 	}
 	return oi
 }
 
+// PresignedInfo returns info allowing other nodes to upload the named
+// objects into this session through presigned PUT URLs. Returns nil if the
+// storage uses POST policies instead.
+func (os *s3Session) PresignedInfo(names []string) *net.OSInfo {
+	if os.owner == nil || !os.owner.presignedPut {
+		return nil
+	}
+	urls := make(map[string]string, len(names))
+	for _, name := range names {
+		urls[name] = os.owner.presignPut(path.Join(os.key, name), time.Now())
+	}
+	return &net.OSInfo{
+		S3Info: &net.S3OSInfo{
+			Host:          os.host,
+			Key:           os.key,
+			Endpoint:      os.endpoint,
+			PresignedUrls: urls,
+		},
+		StorageType: os.storageType,
+	}
+}
+
+// uploadURL returns the presigned URL to upload the named object with, or
+// an empty string to upload using the POST policy
+func (os *s3Session) uploadURL(name string) string {
+	if os.owner != nil && os.owner.presignedPut {
+		return os.owner.presignPut(path.Join(os.key, name), time.Now())
+	}
+	return os.presignedURLs[name]
+}
+
+// putData uploads an object using a presigned PUT URL
+func (os *s3Session) putData(uploadURL, fileName string, data io.Reader, size int64, fileType string) (string, error) {
+	req, err := http.NewRequest("PUT", uploadURL, data)
+	if err != nil {
+		glog.Error(err)
+		return "", err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", fileType)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		glog.Error(err)
+		return "", err
+	}
+	body := &bytes.Buffer{}
+	_, err = body.ReadFrom(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		glog.Error(err)
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		glog.Error("Got response from from S3: ", body)
+		return "", fmt.Errorf("S3 upload failed status=%d body=%s", resp.StatusCode, body.String())
+	}
+	return path.Join(os.key, fileName), nil
+}
+
 // if s3 storage is not our own, we are saving data into it using POST request
-func (os *s3Session) postData(fileName string, buffer []byte) (string, error) {
-	fileBytes := bytes.NewReader(buffer)
-	fileType := http.DetectContentType(buffer)
+func (os *s3Session) postData(fileName string, data io.Reader, size int64, fileType string) (string, error) {
 	path, fileName := path.Split(path.Join(os.key, fileName))
 	fields := map[string]string{
 		"acl":          "public-read",
@@ -175,7 +354,7 @@ func (os *s3Session) postData(fileName string, buffer []byte) (string, error) {
 	for k, v := range os.fields {
 		fields[k] = v
 	}
-	req, err := newfileUploadRequest(os.host, fields, fileBytes, fileName)
+	req, err := newfileUploadRequest(os.host, fields, data, size, fileName)
 	if err != nil {
 		glog.Error(err)
 		return "", err
@@ -217,6 +396,66 @@ func signString(stringToSign, sregion, amzDate, secret string) string {
 	return sSignature
 }
 
+// presignPut returns a SigV4 query-authenticated URL for uploading the
+// object at key with a PUT request. The URL is valid for
+// S3_POLICY_EXPIRE_IN_HOURS hours from now.
+func (os *s3OS) presignPut(key string, now time.Time) string {
+	const timeFormat = "20060102T150405Z"
+	const shortTimeFormat = "20060102"
+
+	u, _ := url.Parse(os.host + "/" + strings.TrimPrefix(key, "/"))
+	amzDate := now.UTC().Format(timeFormat)
+	shortDate := now.UTC().Format(shortTimeFormat)
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", shortDate, os.region)
+	query := url.Values{
+		"X-Amz-Algorithm":     {"AWS4-HMAC-SHA256"},
+		"X-Amz-Credential":    {os.awsAccessKeyID + "/" + scope},
+		"X-Amz-Date":          {amzDate},
+		"X-Amz-Expires":       {fmt.Sprintf("%d", S3_POLICY_EXPIRE_IN_HOURS*3600)},
+		"X-Amz-SignedHeaders": {"host"},
+		"x-amz-acl":           {"public-read"},
+	}
+	canonicalQuery := s3CanonicalQuery(query)
+	canonicalRequest := strings.Join([]string{
+		"PUT",
+		u.EscapedPath(),
+		canonicalQuery,
+		"host:" + u.Host + "\n",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+	signature := signString(stringToSign, os.region, shortDate, os.awsSecretAccessKey)
+	u.RawQuery = canonicalQuery + "&X-Amz-Signature=" + signature
+	return u.String()
+}
+
+// s3CanonicalQuery encodes query parameters sorted by name, as required
+// for SigV4 signing
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	params := make([]string, 0, len(keys))
+	for _, k := range keys {
+		// SigV4 requires spaces encoded as %20 rather than +
+		params = append(params, s3Escape(k)+"="+s3Escape(query.Get(k)))
+	}
+	return strings.Join(params, "&")
+}
+
+func s3Escape(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
+
 // createPolicy returns policy, signature, xAmzCredentail and xAmzDate
 func createPolicy(key, bucket, region, secret, path string) (string, string, string, string) {
 	const timeFormat = "2006-01-02T15:04:05.999Z"
@@ -241,27 +480,35 @@ func createPolicy(key, bucket, region, secret, path string) (string, string, str
 	return policy, signString(policy, region, xAmzDate, secret), xAmzCredential, xAmzDate + "T000000Z"
 }
 
-func newfileUploadRequest(uri string, params map[string]string, fData io.Reader, fileName string) (*http.Request, error) {
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
+// newfileUploadRequest creates a multipart form upload of the file. The
+// file data is streamed into the request rather than copied into the form.
+func newfileUploadRequest(uri string, params map[string]string, fData io.Reader, size int64, fileName string) (*http.Request, error) {
+	form := &bytes.Buffer{}
+	writer := multipart.NewWriter(form)
 	for key, val := range params {
 		err := writer.WriteField(key, val)
 		if err != nil {
 			glog.Error(err)
 		}
 	}
-	part, err := writer.CreateFormFile("file", fileName)
+	_, err := writer.CreateFormFile("file", fileName)
 	if err != nil {
 		return nil, err
 	}
-	_, err = io.Copy(part, fData)
-
+	head := append([]byte(nil), form.Bytes()...)
+	form.Reset()
 	err = writer.Close()
 	if err != nil {
 		return nil, err
 	}
+	tail := form.Bytes()
 
+	body := io.MultiReader(bytes.NewReader(head), fData, bytes.NewReader(tail))
 	req, err := http.NewRequest("POST", uri, body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(head)) + size + int64(len(tail))
 	req.Header.Set("Content-Type", writer.FormDataContentType())
-	return req, err
+	return req, nil
 }
@@ -0,0 +1,242 @@
+package drivers
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/livepeer/go-livepeer/net"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestS3BucketURL(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		endpoint  string
+		pathStyle bool
+		expected  string
+	}{
+		{"", false, "https://bucket.s3.amazonaws.com"},
+		{"", true, "https://s3.amazonaws.com/bucket"},
+		{"http://minio:9000", true, "http://minio:9000/bucket"},
+		{"http://minio:9000/", false, "http://bucket.minio:9000"},
+		{"account.r2.cloudflarestorage.com", true, "https://account.r2.cloudflarestorage.com/bucket"},
+	}
+	for _, tt := range tests {
+		host, err := S3BucketURL(tt.endpoint, "bucket", tt.pathStyle)
+		assert.Nil(err)
+		assert.Equal(tt.expected, host)
+	}
+	_, err := S3BucketURL("http://", "bucket", true)
+	assert.NotNil(err)
+}
+
+func TestIsOwnStorageS3(t *testing.T) {
+	assert := assert.New(t)
+	defer func() { S3BUCKET, S3HOST = "", "" }()
+
+	S3BUCKET = "bucket"
+	assert.True(IsOwnStorageS3("https://bucket.s3.amazonaws.com/a/0.ts"))
+	assert.False(IsOwnStorageS3("http://minio:9000/bucket/a/0.ts"))
+
+	S3HOST = "http://minio:9000/bucket"
+	assert.True(IsOwnStorageS3("http://minio:9000/bucket/a/0.ts"))
+	assert.True(IsOwnExternal("http://minio:9000/bucket/a/0.ts"))
+	assert.False(IsOwnStorageS3("https://bucket.s3.amazonaws.com/a/0.ts"))
+}
+
+func TestS3PresignPut(t *testing.T) {
+	assert := assert.New(t)
+	d, err := NewS3DriverWithConfig(S3Config{
+		Endpoint:        "http://minio:9000",
+		Bucket:          "bucket",
+		PathStyle:       true,
+		AccessKey:       "user",
+		AccessKeySecret: "secret",
+		PresignedPut:    true,
+	})
+	require.Nil(t, err)
+	os := d.(*s3OS)
+	// regions default for S3-compatible stores
+	assert.Equal("us-east-1", os.region)
+
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	u, err := url.Parse(os.presignPut("mid/P144p30fps16x9/0.ts", now))
+	require.Nil(t, err)
+	assert.Equal("minio:9000", u.Host)
+	assert.Equal("/bucket/mid/P144p30fps16x9/0.ts", u.Path)
+	query := u.Query()
+	assert.Equal("AWS4-HMAC-SHA256", query.Get("X-Amz-Algorithm"))
+	assert.Equal("user/20200102/us-east-1/s3/aws4_request", query.Get("X-Amz-Credential"))
+	assert.Equal("20200102T030405Z", query.Get("X-Amz-Date"))
+	assert.Equal("86400", query.Get("X-Amz-Expires"))
+	assert.Equal("host", query.Get("X-Amz-SignedHeaders"))
+	assert.Equal("public-read", query.Get("x-amz-acl"))
+	assert.Len(query.Get("X-Amz-Signature"), 64)
+	// the signature must come last and cover the sorted parameters
+	assert.True(strings.HasPrefix(u.RawQuery, "X-Amz-Algorithm=AWS4-HMAC-SHA256&X-Amz-Credential=user%2F20200102%2Fus-east-1%2Fs3%2Faws4_request&"))
+	assert.Contains(u.RawQuery, "&x-amz-acl=public-read&X-Amz-Signature=")
+
+	// deterministic, and depends on the secret
+	assert.Equal(u.String(), os.presignPut("mid/P144p30fps16x9/0.ts", now))
+	os.awsSecretAccessKey = "other"
+	assert.NotEqual(u.String(), os.presignPut("mid/P144p30fps16x9/0.ts", now))
+}
+
+func TestS3PresignedUpload(t *testing.T) {
+	assert := assert.New(t)
+	var uploads []*http.Request
+	var bodies []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		uploads = append(uploads, r)
+		bodies = append(bodies, string(body))
+	}))
+	defer ts.Close()
+
+	d, err := NewS3DriverWithConfig(S3Config{
+		Endpoint:        ts.URL,
+		Bucket:          "bucket",
+		PathStyle:       true,
+		AccessKey:       "user",
+		AccessKeySecret: "secret",
+		PresignedPut:    true,
+	})
+	require.Nil(t, err)
+	sess := d.NewSession("mid")
+	assert.True(sess.IsExternal())
+	// no policy covers the whole session
+	assert.Nil(sess.GetInfo())
+
+	// own uploads are presigned too
+	uri, err := sess.SaveData("source/0.ts", []byte("source"))
+	require.Nil(t, err)
+	assert.Equal(ts.URL+"/bucket/mid/source/0.ts", uri)
+	require.Len(t, uploads, 1)
+	assert.Equal("PUT", uploads[0].Method)
+	assert.Equal("/bucket/mid/source/0.ts", uploads[0].URL.Path)
+	assert.NotEmpty(uploads[0].URL.Query().Get("X-Amz-Signature"))
+	assert.Equal("source", bodies[0])
+
+	// other nodes get URLs for the named objects only
+	info := sess.(PresignedSession).PresignedInfo([]string{"P144p30fps16x9/0.ts"})
+	require.NotNil(t, info)
+	assert.Equal(net.OSInfo_S3, info.StorageType)
+	assert.Equal(ts.URL, info.S3Info.Endpoint)
+	assert.Empty(info.S3Info.Policy)
+	require.Len(t, info.S3Info.PresignedUrls, 1)
+
+	remote := NewSession(info)
+	uri, err = remote.SaveData("P144p30fps16x9/0.ts", []byte("rendition"))
+	require.Nil(t, err)
+	assert.Equal(ts.URL+"/bucket/mid/P144p30fps16x9/0.ts", uri)
+	require.Len(t, uploads, 2)
+	assert.Equal("PUT", uploads[1].Method)
+	assert.Equal("rendition", bodies[1])
+	// info is passed along as received
+	assert.Equal(info.S3Info.PresignedUrls, remote.GetInfo().S3Info.PresignedUrls)
+	assert.Equal(ts.URL, remote.GetInfo().S3Info.Endpoint)
+
+	// objects without a presigned URL fall back to the POST policy
+	_, err = remote.SaveData("P144p30fps16x9/1.ts", []byte("rendition"))
+	require.Nil(t, err)
+	require.Len(t, uploads, 3)
+	assert.Equal("POST", uploads[2].Method)
+
+	// errors are reported
+	ts.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "AccessDenied", http.StatusForbidden)
+	})
+	_, err = remote.SaveData("P144p30fps16x9/0.ts", []byte("rendition"))
+	assert.NotNil(err)
+}
+
+func TestS3SaveReader(t *testing.T) {
+	assert := assert.New(t)
+	var uploads []*http.Request
+	var bodies []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := ""
+		if r.Method == "POST" {
+			if f, _, err := r.FormFile("file"); err == nil {
+				data, _ := ioutil.ReadAll(f)
+				body = string(data)
+			}
+		} else {
+			data, _ := ioutil.ReadAll(r.Body)
+			body = string(data)
+		}
+		uploads = append(uploads, r)
+		bodies = append(bodies, body)
+	}))
+	defer ts.Close()
+
+	for _, presigned := range []bool{true, false} {
+		uploads, bodies = nil, nil
+		d, err := NewS3DriverWithConfig(S3Config{
+			Endpoint:        ts.URL,
+			Bucket:          "bucket",
+			PathStyle:       true,
+			AccessKey:       "user",
+			AccessKeySecret: "secret",
+			PresignedPut:    presigned,
+		})
+		require.Nil(t, err)
+		sess, ok := d.NewSession("mid").(ReaderSession)
+		require.True(t, ok)
+
+		// Data of known size is streamed with its length
+		_, err = sess.SaveReader("source/0.ts", ioutil.NopCloser(strings.NewReader("source")), 6)
+		require.Nil(t, err)
+		require.Len(t, uploads, 1)
+		assert.Equal("source", bodies[0])
+		assert.Empty(uploads[0].TransferEncoding)
+		if presigned {
+			assert.Equal(int64(6), uploads[0].ContentLength)
+		}
+
+		// Data of unknown size is read first
+		_, err = sess.SaveReader("source/1.ts", ioutil.NopCloser(strings.NewReader("source1")), -1)
+		require.Nil(t, err)
+		require.Len(t, uploads, 2)
+		assert.Equal("source1", bodies[1])
+		assert.Empty(uploads[1].TransferEncoding)
+
+		// Reader errors abort the upload
+		_, err = sess.SaveReader("source/2.ts", &errReader{}, 6)
+		assert.NotNil(err)
+	}
+}
+
+type errReader struct{}
+
+func (r *errReader) Read(p []byte) (int, error) {
+	return 0, errors.New("ReadError")
+}
+
+func TestS3PolicySession(t *testing.T) {
+	assert := assert.New(t)
+	d, err := NewS3DriverWithConfig(S3Config{
+		Endpoint:        "http://minio:9000",
+		Region:          "eu-central-1",
+		Bucket:          "bucket",
+		PathStyle:       true,
+		AccessKey:       "user",
+		AccessKeySecret: "secret",
+	})
+	require.Nil(t, err)
+	sess := d.NewSession("mid")
+	info := sess.GetInfo()
+	require.NotNil(t, info)
+	assert.Equal("http://minio:9000/bucket", info.S3Info.Host)
+	assert.Equal("http://minio:9000", info.S3Info.Endpoint)
+	assert.NotEmpty(info.S3Info.Policy)
+	assert.Contains(info.S3Info.Credential, "/eu-central-1/s3/aws4_request")
+	assert.Nil(sess.(PresignedSession).PresignedInfo([]string{"a.ts"}))
+}
@@ -42,6 +42,8 @@ const (
 	SegmentTranscodeErrorSaveData           SegmentTranscodeError = "SaveData"
 	SegmentTranscodeErrorSessionEnded       SegmentTranscodeError = "SessionEnded"
 	SegmentTranscodeErrorPlaylist           SegmentTranscodeError = "Playlist"
+	SegmentTranscodeErrorMaxAttempts        SegmentTranscodeError = "MaxAttempts"
+	SegmentTranscodeErrorDeadline           SegmentTranscodeError = "Deadline"
 
 	numberOfSegmentsToCalcAverage = 30
 	gweiConversionFactor          = 1000000000
@@ -71,6 +73,7 @@ type (
 		kSender                       tag.Key
 		kRecipient                    tag.Key
 		kManifestID                   tag.Key
+		kEventType                    tag.Key
 		mSegmentSourceAppeared        *stats.Int64Measure
 		mSegmentEmerged               *stats.Int64Measure
 		mSegmentEmergedUnprocessed    *stats.Int64Measure
@@ -86,10 +89,12 @@ type (
 		mStreamCreated                *stats.Int64Measure
 		mStreamStarted                *stats.Int64Measure
 		mStreamEnded                  *stats.Int64Measure
+		mEventDropped                 *stats.Int64Measure
 		mMaxSessions                  *stats.Int64Measure
 		mCurrentSessions              *stats.Int64Measure
 		mDiscoveryError               *stats.Int64Measure
 		mTranscodeRetried             *stats.Int64Measure
+		mTranscodeAttempts            *stats.Int64Measure
 		mTranscodersNumber            *stats.Int64Measure
 		mTranscodersCapacity          *stats.Int64Measure
 		mTranscodersLoad              *stats.Int64Measure
@@ -173,6 +178,7 @@ func InitCensus(nodeType, nodeID, version string) {
 	census.kSender = tag.MustNewKey("sender")
 	census.kRecipient = tag.MustNewKey("recipient")
 	census.kManifestID = tag.MustNewKey("manifestID")
+	census.kEventType = tag.MustNewKey("event_type")
 	census.ctx, err = tag.New(ctx, tag.Insert(census.kNodeType, nodeType), tag.Insert(census.kNodeID, nodeID))
 	if err != nil {
 		glog.Fatal("Error creating context", err)
@@ -192,10 +198,12 @@ func InitCensus(nodeType, nodeID, version string) {
 	census.mStreamCreated = stats.Int64("stream_created_total", "StreamCreated", "tot")
 	census.mStreamStarted = stats.Int64("stream_started_total", "StreamStarted", "tot")
 	census.mStreamEnded = stats.Int64("stream_ended_total", "StreamEnded", "tot")
+	census.mEventDropped = stats.Int64("event_webhook_dropped_total", "EventDropped", "tot")
 	census.mMaxSessions = stats.Int64("max_sessions_total", "MaxSessions", "tot")
 	census.mCurrentSessions = stats.Int64("current_sessions_total", "Number of currently transcded streams", "tot")
 	census.mDiscoveryError = stats.Int64("discovery_errors_total", "Number of discover errors", "tot")
 	census.mTranscodeRetried = stats.Int64("transcode_retried", "Number of times segment transcode was retried", "tot")
+	census.mTranscodeAttempts = stats.Int64("transcode_attempts_total", "Number of times segments were submitted for transcoding, including retries", "tot")
 	census.mTranscodersNumber = stats.Int64("transcoders_number", "Number of transcoders currently connected to orchestrator", "tot")
 	census.mTranscodersCapacity = stats.Int64("transcoders_capacity", "Total advertised capacity of transcoders currently connected to orchestrator", "tot")
 	census.mTranscodersLoad = stats.Int64("transcoders_load", "Total load of transcoders currently connected to orchestrator", "tot")
@@ -278,6 +286,13 @@ func InitCensus(nodeType, nodeID, version string) {
 			TagKeys:     baseTags,
 			Aggregation: view.Count(),
 		},
+		{
+			Name:        "event_webhook_dropped_total",
+			Measure:     census.mEventDropped,
+			Description: "Number of stream events dropped before being sent to the event webhook",
+			TagKeys:     append([]tag.Key{census.kEventType}, baseTags...),
+			Aggregation: view.Count(),
+		},
 		{
 			Name:        "stream_create_failed_total",
 			Measure:     census.mStreamCreateFailed,
@@ -418,6 +433,13 @@ func InitCensus(nodeType, nodeID, version string) {
 			TagKeys:     append([]tag.Key{census.kTry}, baseTags...),
 			Aggregation: view.Count(),
 		},
+		{
+			Name:        "transcode_attempts_total",
+			Measure:     census.mTranscodeAttempts,
+			Description: "Number of times segments were submitted for transcoding, including retries",
+			TagKeys:     append([]tag.Key{census.kTry}, baseTags...),
+			Aggregation: view.Count(),
+		},
 		{
 			Name:        "transcoders_number",
 			Measure:     census.mTranscodersNumber,
@@ -603,6 +625,18 @@ func (cen *censusMetricsCounter) successRate() float64 {
 	return 1
 }
 
+// StreamSuccessRate returns the fraction of recent segments of the stream
+// that were transcoded, if any were completed yet
+func StreamSuccessRate(nonce uint64) (float64, bool) {
+	census.lock.Lock()
+	defer census.lock.Unlock()
+	avg, ok := census.success[nonce]
+	if !ok {
+		return 1, false
+	}
+	return avg.successRate()
+}
+
 func (sa *segmentsAverager) successRate() (float64, bool) {
 	var emerged, transcoded int
 	if sa.end == -1 {
@@ -759,19 +793,22 @@ func TranscodeTry(nonce, seqNo uint64) {
 			ts.tries++
 			try = ts.tries
 			av.tries[seqNo] = ts
-			label := ">10"
-			if ts.tries < 11 {
-				label = strconv.Itoa(ts.tries)
-			}
-			ctx, err := tag.New(census.ctx, tag.Insert(census.kTry, label))
-			if err != nil {
-				glog.Error("Error creating context", err)
-				return
-			}
-			stats.Record(ctx, census.mTranscodeRetried.M(1))
 		} else {
 			av.tries[seqNo] = tryData{tries: 1, first: time.Now()}
 		}
+		label := ">10"
+		if try < 11 {
+			label = strconv.Itoa(try)
+		}
+		ctx, err := tag.New(census.ctx, tag.Insert(census.kTry, label))
+		if err != nil {
+			glog.Error("Error creating context", err)
+			return
+		}
+		stats.Record(ctx, census.mTranscodeAttempts.M(1))
+		if try > 1 {
+			stats.Record(ctx, census.mTranscodeRetried.M(1))
+		}
 		glog.V(logLevel).Infof("Trying to transcode segment nonce=%d seqNo=%d try=%d", nonce, seqNo, try)
 	}
 }
@@ -979,6 +1016,22 @@ func (cen *censusMetricsCounter) streamCreateFailed(nonce uint64, reason string)
 	stats.Record(cen.ctx, cen.mStreamCreateFailed.M(1))
 }
 
+func EventDropped(eventType string) {
+	glog.V(logLevel).Infof("Logging EventDropped... type=%s", eventType)
+	census.eventDropped(eventType)
+}
+
+func (cen *censusMetricsCounter) eventDropped(eventType string) {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	ctx, err := tag.New(cen.ctx, tag.Insert(cen.kEventType, eventType))
+	if err != nil {
+		glog.Error("Error creating context", err)
+		return
+	}
+	stats.Record(ctx, cen.mEventDropped.M(1))
+}
+
 func newAverager() *segmentsAverager {
 	return &segmentsAverager{
 		segments: make([]segmentCount, numberOfSegmentsToCalcAverage),
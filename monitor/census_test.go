@@ -75,6 +75,12 @@ func TestLastSegmentTimeout(t *testing.T) {
 	if sr := census.successRate(); sr != 0.75 {
 		t.Fatalf("Success rate should be 0.75, not %f", sr)
 	}
+	if sr, has := StreamSuccessRate(1); !has || sr != 0.75 {
+		t.Fatalf("Stream success rate should be 0.75, not %f", sr)
+	}
+	if _, has := StreamSuccessRate(5); has {
+		t.Fatal("Unknown stream should not have a success rate")
+	}
 	StreamEnded(1)
 	if len(census.success) != 0 {
 		t.Fatalf("Should be no streams, instead have %d", len(census.success))
@@ -1,12 +1,36 @@
 package net
 
 import (
+	"time"
+
 	"github.com/livepeer/m3u8"
 )
 
 type RemoteTranscoderInfo struct {
-	Address  string
+	Address string
+	// Name of the token the transcoder authenticated with, if any
+	Name     string
+	Capacity int
+}
+
+// RemoteTranscoderState describes how a transcoder registered with the
+// orchestrator is doing
+type RemoteTranscoderState struct {
+	Address string
+	// Name of the token the transcoder authenticated with, if any
+	Name     string
 	Capacity int
+	Load     int
+	// Number of tasks that failed on the transcoder
+	Errors int
+	// Grows with each failed task and halves with each successful one;
+	// transcoders with higher scores are given fewer tasks
+	ErrorScore float64
+	// Last time the transcoder answered a heartbeat or returned results
+	LastSeen time.Time
+	// Set once the transcoder is being drained; it gets no new tasks and
+	// is disconnected when its running tasks are done
+	Draining bool
 }
 
 type NodeStatus struct {
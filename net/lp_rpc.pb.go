@@ -52,6 +52,146 @@ func (OSInfo_StorageType) EnumDescriptor() ([]byte, []int) {
 	return fileDescriptor_034e29c79f9ba827, []int{2, 0}
 }
 
+type VideoProfile_Format int32
+
+const (
+	VideoProfile_MPEGTS VideoProfile_Format = 0
+	VideoProfile_MP4    VideoProfile_Format = 1
+)
+
+var VideoProfile_Format_name = map[int32]string{
+	0: "MPEGTS",
+	1: "MP4",
+}
+
+var VideoProfile_Format_value = map[string]int32{
+	"MPEGTS": 0,
+	"MP4":    1,
+}
+
+func (x VideoProfile_Format) String() string {
+	return proto.EnumName(VideoProfile_Format_name, int32(x))
+}
+
+func (VideoProfile_Format) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_034e29c79f9ba827, []int{8, 0}
+}
+
+type VideoProfile_AudioCodec int32
+
+const (
+	VideoProfile_AUDIO_COPY VideoProfile_AudioCodec = 0
+	VideoProfile_AAC        VideoProfile_AudioCodec = 1
+	VideoProfile_AUDIO_NONE VideoProfile_AudioCodec = 2
+)
+
+var VideoProfile_AudioCodec_name = map[int32]string{
+	0: "AUDIO_COPY",
+	1: "AAC",
+	2: "AUDIO_NONE",
+}
+
+var VideoProfile_AudioCodec_value = map[string]int32{
+	"AUDIO_COPY": 0,
+	"AAC":        1,
+	"AUDIO_NONE": 2,
+}
+
+func (x VideoProfile_AudioCodec) String() string {
+	return proto.EnumName(VideoProfile_AudioCodec_name, int32(x))
+}
+
+func (VideoProfile_AudioCodec) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_034e29c79f9ba827, []int{8, 1}
+}
+
+type VideoProfile_VideoCodec int32
+
+const (
+	VideoProfile_H264 VideoProfile_VideoCodec = 0
+	VideoProfile_H265 VideoProfile_VideoCodec = 1
+	VideoProfile_VP9  VideoProfile_VideoCodec = 2
+)
+
+var VideoProfile_VideoCodec_name = map[int32]string{
+	0: "H264",
+	1: "H265",
+	2: "VP9",
+}
+
+var VideoProfile_VideoCodec_value = map[string]int32{
+	"H264": 0,
+	"H265": 1,
+	"VP9":  2,
+}
+
+func (x VideoProfile_VideoCodec) String() string {
+	return proto.EnumName(VideoProfile_VideoCodec_name, int32(x))
+}
+
+func (VideoProfile_VideoCodec) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_034e29c79f9ba827, []int{8, 2}
+}
+
+type VideoProfile_Profile int32
+
+const (
+	VideoProfile_ENCODER_DEFAULT VideoProfile_Profile = 0
+	VideoProfile_H264_BASELINE   VideoProfile_Profile = 1
+	VideoProfile_H264_MAIN       VideoProfile_Profile = 2
+	VideoProfile_H264_HIGH       VideoProfile_Profile = 3
+)
+
+var VideoProfile_Profile_name = map[int32]string{
+	0: "ENCODER_DEFAULT",
+	1: "H264_BASELINE",
+	2: "H264_MAIN",
+	3: "H264_HIGH",
+}
+
+var VideoProfile_Profile_value = map[string]int32{
+	"ENCODER_DEFAULT": 0,
+	"H264_BASELINE":   1,
+	"H264_MAIN":       2,
+	"H264_HIGH":       3,
+}
+
+func (x VideoProfile_Profile) String() string {
+	return proto.EnumName(VideoProfile_Profile_name, int32(x))
+}
+
+func (VideoProfile_Profile) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_034e29c79f9ba827, []int{8, 3}
+}
+
+type VideoProfile_ImageFormat int32
+
+const (
+	VideoProfile_NO_IMAGE VideoProfile_ImageFormat = 0
+	VideoProfile_JPEG     VideoProfile_ImageFormat = 1
+	VideoProfile_PNG      VideoProfile_ImageFormat = 2
+)
+
+var VideoProfile_ImageFormat_name = map[int32]string{
+	0: "NO_IMAGE",
+	1: "JPEG",
+	2: "PNG",
+}
+
+var VideoProfile_ImageFormat_value = map[string]int32{
+	"NO_IMAGE": 0,
+	"JPEG":     1,
+	"PNG":      2,
+}
+
+func (x VideoProfile_ImageFormat) String() string {
+	return proto.EnumName(VideoProfile_ImageFormat_name, int32(x))
+}
+
+func (VideoProfile_ImageFormat) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_034e29c79f9ba827, []int{8, 4}
+}
+
 type PingPong struct {
 	// Implementation defined
 	Value                []byte   `protobuf:"bytes,1,opt,name=value,proto3" json:"value,omitempty"`
@@ -206,10 +346,15 @@ type S3OSInfo struct {
 	// Needed for POST policy.
 	Credential string `protobuf:"bytes,5,opt,name=credential,proto3" json:"credential,omitempty"`
 	// Needed for POST policy.
-	XAmzDate             string   `protobuf:"bytes,6,opt,name=xAmzDate,proto3" json:"xAmzDate,omitempty"`
-	XXX_NoUnkeyedLiteral struct{} `json:"-"`
-	XXX_unrecognized     []byte   `json:"-"`
-	XXX_sizecache        int32    `json:"-"`
+	XAmzDate string `protobuf:"bytes,6,opt,name=xAmzDate,proto3" json:"xAmzDate,omitempty"`
+	// Base URL of the S3-compatible service, if not AWS S3.
+	Endpoint string `protobuf:"bytes,7,opt,name=endpoint,proto3" json:"endpoint,omitempty"`
+	// Presigned PUT URLs by object name, relative to the key. Objects listed
+	// here are uploaded using the URL instead of the POST policy.
+	PresignedUrls        map[string]string `protobuf:"bytes,8,rep,name=presignedUrls,proto3" json:"presignedUrls,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
+	XXX_unrecognized     []byte            `json:"-"`
+	XXX_sizecache        int32             `json:"-"`
 }
 
 func (m *S3OSInfo) Reset()         { *m = S3OSInfo{} }
@@ -279,6 +424,20 @@ func (m *S3OSInfo) GetXAmzDate() string {
 	return ""
 }
 
+func (m *S3OSInfo) GetEndpoint() string {
+	if m != nil {
+		return m.Endpoint
+	}
+	return ""
+}
+
+func (m *S3OSInfo) GetPresignedUrls() map[string]string {
+	if m != nil {
+		return m.PresignedUrls
+	}
+	return nil
+}
+
 // PriceInfo conveys pricing info for transcoding services
 type PriceInfo struct {
 	// price in wei
@@ -340,10 +499,12 @@ type OrchestratorInfo struct {
 	// Price Info containing the price per pixel to transcode
 	PriceInfo *PriceInfo `protobuf:"bytes,3,opt,name=price_info,json=priceInfo,proto3" json:"price_info,omitempty"`
 	// Orchestrator returns info about own input object storage, if it wants it to be used.
-	Storage              []*OSInfo `protobuf:"bytes,32,rep,name=storage,proto3" json:"storage,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}  `json:"-"`
-	XXX_unrecognized     []byte    `json:"-"`
-	XXX_sizecache        int32     `json:"-"`
+	Storage []*OSInfo `protobuf:"bytes,32,rep,name=storage,proto3" json:"storage,omitempty"`
+	// Transcoding features supported by the orchestrator
+	Capabilities         *Capabilities `protobuf:"bytes,33,opt,name=capabilities,proto3" json:"capabilities,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}      `json:"-"`
+	XXX_unrecognized     []byte        `json:"-"`
+	XXX_sizecache        int32         `json:"-"`
 }
 
 func (m *OrchestratorInfo) Reset()         { *m = OrchestratorInfo{} }
@@ -399,6 +560,120 @@ func (m *OrchestratorInfo) GetStorage() []*OSInfo {
 	return nil
 }
 
+func (m *OrchestratorInfo) GetCapabilities() *Capabilities {
+	if m != nil {
+		return m.Capabilities
+	}
+	return nil
+}
+
+// Transcoding features supported by a node, or required by a stream.
+// Nodes that don't advertise capabilities only support H.264 renditions in
+// MPEG-TS, uploaded to S3.
+type Capabilities struct {
+	// Video codecs that renditions can be encoded with
+	Codecs []VideoProfile_VideoCodec `protobuf:"varint,1,rep,packed,name=codecs,proto3,enum=net.VideoProfile_VideoCodec" json:"codecs,omitempty"`
+	// Containers that renditions can be muxed into
+	Formats []VideoProfile_Format `protobuf:"varint,2,rep,packed,name=formats,proto3,enum=net.VideoProfile_Format" json:"formats,omitempty"`
+	// Object stores that renditions can be uploaded to
+	Storage []OSInfo_StorageType `protobuf:"varint,3,rep,packed,name=storage,proto3,enum=net.OSInfo_StorageType" json:"storage,omitempty"`
+	// Largest rendition in pixels per frame. Unlimited if unset.
+	MaxPixels int64 `protobuf:"varint,4,opt,name=max_pixels,json=maxPixels,proto3" json:"max_pixels,omitempty"`
+	// Whether transcoding is accelerated by GPUs
+	Gpu bool `protobuf:"varint,5,opt,name=gpu,proto3" json:"gpu,omitempty"`
+	// Whether renditions can have their own audio settings
+	Audio bool `protobuf:"varint,6,opt,name=audio,proto3" json:"audio,omitempty"`
+	// Whether thumbnail renditions can be extracted
+	Images bool `protobuf:"varint,7,opt,name=images,proto3" json:"images,omitempty"`
+	// Rendition pixels per second that can be encoded in real time. Set by
+	// transcoders registering with an orchestrator; unknown if unset.
+	PixelRate            int64    `protobuf:"varint,8,opt,name=pixel_rate,json=pixelRate,proto3" json:"pixel_rate,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Capabilities) Reset()         { *m = Capabilities{} }
+func (m *Capabilities) String() string { return proto.CompactTextString(m) }
+func (*Capabilities) ProtoMessage()    {}
+func (*Capabilities) Descriptor() ([]byte, []int) {
+	return fileDescriptor_034e29c79f9ba827, []int{6}
+}
+
+func (m *Capabilities) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Capabilities.Unmarshal(m, b)
+}
+func (m *Capabilities) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Capabilities.Marshal(b, m, deterministic)
+}
+func (m *Capabilities) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Capabilities.Merge(m, src)
+}
+func (m *Capabilities) XXX_Size() int {
+	return xxx_messageInfo_Capabilities.Size(m)
+}
+func (m *Capabilities) XXX_DiscardUnknown() {
+	xxx_messageInfo_Capabilities.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Capabilities proto.InternalMessageInfo
+
+func (m *Capabilities) GetCodecs() []VideoProfile_VideoCodec {
+	if m != nil {
+		return m.Codecs
+	}
+	return nil
+}
+
+func (m *Capabilities) GetFormats() []VideoProfile_Format {
+	if m != nil {
+		return m.Formats
+	}
+	return nil
+}
+
+func (m *Capabilities) GetStorage() []OSInfo_StorageType {
+	if m != nil {
+		return m.Storage
+	}
+	return nil
+}
+
+func (m *Capabilities) GetMaxPixels() int64 {
+	if m != nil {
+		return m.MaxPixels
+	}
+	return 0
+}
+
+func (m *Capabilities) GetGpu() bool {
+	if m != nil {
+		return m.Gpu
+	}
+	return false
+}
+
+func (m *Capabilities) GetAudio() bool {
+	if m != nil {
+		return m.Audio
+	}
+	return false
+}
+
+func (m *Capabilities) GetImages() bool {
+	if m != nil {
+		return m.Images
+	}
+	return false
+}
+
+func (m *Capabilities) GetPixelRate() int64 {
+	if m != nil {
+		return m.PixelRate
+	}
+	return 0
+}
+
 // Data included by the broadcaster when submitting a segment for transcoding.
 type SegData struct {
 	// Manifest ID this segment belongs to
@@ -426,7 +701,7 @@ func (m *SegData) Reset()         { *m = SegData{} }
 func (m *SegData) String() string { return proto.CompactTextString(m) }
 func (*SegData) ProtoMessage()    {}
 func (*SegData) Descriptor() ([]byte, []int) {
-	return fileDescriptor_034e29c79f9ba827, []int{6}
+	return fileDescriptor_034e29c79f9ba827, []int{7}
 }
 
 func (m *SegData) XXX_Unmarshal(b []byte) error {
@@ -506,17 +781,35 @@ type VideoProfile struct {
 	// Bitrate of VideoProfile
 	Bitrate int32 `protobuf:"varint,19,opt,name=bitrate,proto3" json:"bitrate,omitempty"`
 	// FPS of VideoProfile
-	Fps                  uint32   `protobuf:"varint,20,opt,name=fps,proto3" json:"fps,omitempty"`
-	XXX_NoUnkeyedLiteral struct{} `json:"-"`
-	XXX_unrecognized     []byte   `json:"-"`
-	XXX_sizecache        int32    `json:"-"`
+	Fps uint32 `protobuf:"varint,20,opt,name=fps,proto3" json:"fps,omitempty"`
+	// Container format of the transcoded segments. MP4 is fragmented.
+	Format VideoProfile_Format `protobuf:"varint,21,opt,name=format,proto3,enum=net.VideoProfile_Format" json:"format,omitempty"`
+	// Audio codec of the rendition
+	AudioCodec VideoProfile_AudioCodec `protobuf:"varint,22,opt,name=audio_codec,json=audioCodec,proto3,enum=net.VideoProfile_AudioCodec" json:"audio_codec,omitempty"`
+	// Bitrate of re-encoded audio, in bits per second. Encoder default if unset.
+	AudioBitrate int32 `protobuf:"varint,23,opt,name=audio_bitrate,json=audioBitrate,proto3" json:"audio_bitrate,omitempty"`
+	// Whether the rendition only carries audio, ignoring the video settings
+	AudioOnly bool `protobuf:"varint,24,opt,name=audio_only,json=audioOnly,proto3" json:"audio_only,omitempty"`
+	// Video codec of the rendition
+	Codec VideoProfile_VideoCodec `protobuf:"varint,25,opt,name=codec,proto3,enum=net.VideoProfile_VideoCodec" json:"codec,omitempty"`
+	// Encoder profile of the rendition
+	Profile VideoProfile_Profile `protobuf:"varint,26,opt,name=profile,proto3,enum=net.VideoProfile_Profile" json:"profile,omitempty"`
+	// Number of frames between keyframes. Encoder default if unset.
+	Gop int32 `protobuf:"varint,27,opt,name=gop,proto3" json:"gop,omitempty"`
+	// Constant rate factor. Encodes at the target bitrate if unset.
+	Crf int32 `protobuf:"varint,28,opt,name=crf,proto3" json:"crf,omitempty"`
+	// Image format of thumbnail renditions. Unset for video renditions.
+	Image                VideoProfile_ImageFormat `protobuf:"varint,29,opt,name=image,proto3,enum=net.VideoProfile_ImageFormat" json:"image,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}                 `json:"-"`
+	XXX_unrecognized     []byte                   `json:"-"`
+	XXX_sizecache        int32                    `json:"-"`
 }
 
 func (m *VideoProfile) Reset()         { *m = VideoProfile{} }
 func (m *VideoProfile) String() string { return proto.CompactTextString(m) }
 func (*VideoProfile) ProtoMessage()    {}
 func (*VideoProfile) Descriptor() ([]byte, []int) {
-	return fileDescriptor_034e29c79f9ba827, []int{7}
+	return fileDescriptor_034e29c79f9ba827, []int{8}
 }
 
 func (m *VideoProfile) XXX_Unmarshal(b []byte) error {
@@ -572,6 +865,69 @@ func (m *VideoProfile) GetFps() uint32 {
 	return 0
 }
 
+func (m *VideoProfile) GetFormat() VideoProfile_Format {
+	if m != nil {
+		return m.Format
+	}
+	return VideoProfile_MPEGTS
+}
+
+func (m *VideoProfile) GetAudioCodec() VideoProfile_AudioCodec {
+	if m != nil {
+		return m.AudioCodec
+	}
+	return VideoProfile_AUDIO_COPY
+}
+
+func (m *VideoProfile) GetAudioBitrate() int32 {
+	if m != nil {
+		return m.AudioBitrate
+	}
+	return 0
+}
+
+func (m *VideoProfile) GetAudioOnly() bool {
+	if m != nil {
+		return m.AudioOnly
+	}
+	return false
+}
+
+func (m *VideoProfile) GetCodec() VideoProfile_VideoCodec {
+	if m != nil {
+		return m.Codec
+	}
+	return VideoProfile_H264
+}
+
+func (m *VideoProfile) GetProfile() VideoProfile_Profile {
+	if m != nil {
+		return m.Profile
+	}
+	return VideoProfile_ENCODER_DEFAULT
+}
+
+func (m *VideoProfile) GetGop() int32 {
+	if m != nil {
+		return m.Gop
+	}
+	return 0
+}
+
+func (m *VideoProfile) GetCrf() int32 {
+	if m != nil {
+		return m.Crf
+	}
+	return 0
+}
+
+func (m *VideoProfile) GetImage() VideoProfile_ImageFormat {
+	if m != nil {
+		return m.Image
+	}
+	return VideoProfile_NO_IMAGE
+}
+
 // Individual transcoded segment data.
 type TranscodedSegmentData struct {
 	// URL where the transcoded data can be downloaded from.
@@ -587,7 +943,7 @@ func (m *TranscodedSegmentData) Reset()         { *m = TranscodedSegmentData{} }
 func (m *TranscodedSegmentData) String() string { return proto.CompactTextString(m) }
 func (*TranscodedSegmentData) ProtoMessage()    {}
 func (*TranscodedSegmentData) Descriptor() ([]byte, []int) {
-	return fileDescriptor_034e29c79f9ba827, []int{8}
+	return fileDescriptor_034e29c79f9ba827, []int{9}
 }
 
 func (m *TranscodedSegmentData) XXX_Unmarshal(b []byte) error {
@@ -637,7 +993,7 @@ func (m *TranscodeData) Reset()         { *m = TranscodeData{} }
 func (m *TranscodeData) String() string { return proto.CompactTextString(m) }
 func (*TranscodeData) ProtoMessage()    {}
 func (*TranscodeData) Descriptor() ([]byte, []int) {
-	return fileDescriptor_034e29c79f9ba827, []int{9}
+	return fileDescriptor_034e29c79f9ba827, []int{10}
 }
 
 func (m *TranscodeData) XXX_Unmarshal(b []byte) error {
@@ -693,7 +1049,7 @@ func (m *TranscodeResult) Reset()         { *m = TranscodeResult{} }
 func (m *TranscodeResult) String() string { return proto.CompactTextString(m) }
 func (*TranscodeResult) ProtoMessage()    {}
 func (*TranscodeResult) Descriptor() ([]byte, []int) {
-	return fileDescriptor_034e29c79f9ba827, []int{10}
+	return fileDescriptor_034e29c79f9ba827, []int{11}
 }
 
 func (m *TranscodeResult) XXX_Unmarshal(b []byte) error {
@@ -778,17 +1134,19 @@ type RegisterRequest struct {
 	// Shared secret for auth
 	Secret string `protobuf:"bytes,1,opt,name=secret,proto3" json:"secret,omitempty"`
 	// Transcoder capacity
-	Capacity             int64    `protobuf:"varint,2,opt,name=capacity,proto3" json:"capacity,omitempty"`
-	XXX_NoUnkeyedLiteral struct{} `json:"-"`
-	XXX_unrecognized     []byte   `json:"-"`
-	XXX_sizecache        int32    `json:"-"`
+	Capacity int64 `protobuf:"varint,2,opt,name=capacity,proto3" json:"capacity,omitempty"`
+	// Transcoding features supported by the transcoder
+	Capabilities         *Capabilities `protobuf:"bytes,3,opt,name=capabilities,proto3" json:"capabilities,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}      `json:"-"`
+	XXX_unrecognized     []byte        `json:"-"`
+	XXX_sizecache        int32         `json:"-"`
 }
 
 func (m *RegisterRequest) Reset()         { *m = RegisterRequest{} }
 func (m *RegisterRequest) String() string { return proto.CompactTextString(m) }
 func (*RegisterRequest) ProtoMessage()    {}
 func (*RegisterRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_034e29c79f9ba827, []int{11}
+	return fileDescriptor_034e29c79f9ba827, []int{12}
 }
 
 func (m *RegisterRequest) XXX_Unmarshal(b []byte) error {
@@ -823,6 +1181,13 @@ func (m *RegisterRequest) GetCapacity() int64 {
 	return 0
 }
 
+func (m *RegisterRequest) GetCapabilities() *Capabilities {
+	if m != nil {
+		return m.Capabilities
+	}
+	return nil
+}
+
 // Sent by the orchestrator to the transcoder
 type NotifySegment struct {
 	// URL of the segment to transcode.
@@ -834,17 +1199,26 @@ type NotifySegment struct {
 	// Set of profiles to transcode this segment into.
 	Profiles []byte `protobuf:"bytes,17,opt,name=profiles,proto3" json:"profiles,omitempty"`
 	// Transcoding profiles to use. Supersedes `profiles` field
-	FullProfiles         []*VideoProfile `protobuf:"bytes,33,rep,name=fullProfiles,proto3" json:"fullProfiles,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}        `json:"-"`
-	XXX_unrecognized     []byte          `json:"-"`
-	XXX_sizecache        int32           `json:"-"`
+	FullProfiles []*VideoProfile `protobuf:"bytes,33,rep,name=fullProfiles,proto3" json:"fullProfiles,omitempty"`
+	// Set if this is a liveness check rather than a segment to transcode.
+	// The transcoder answers by posting empty results for the task.
+	Heartbeat bool `protobuf:"varint,34,opt,name=heartbeat,proto3" json:"heartbeat,omitempty"`
+	// Object storage provided by the broadcaster. If set, the transcoder
+	// uploads the renditions there itself and posts back their URIs,
+	// pixel counts and hashes rather than their data.
+	Storage *OSInfo `protobuf:"bytes,35,opt,name=storage,proto3" json:"storage,omitempty"`
+	// Sequence number of the segment, used to name uploaded renditions.
+	SeqNo                int64    `protobuf:"varint,36,opt,name=seqNo,proto3" json:"seqNo,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
 }
 
 func (m *NotifySegment) Reset()         { *m = NotifySegment{} }
 func (m *NotifySegment) String() string { return proto.CompactTextString(m) }
 func (*NotifySegment) ProtoMessage()    {}
 func (*NotifySegment) Descriptor() ([]byte, []int) {
-	return fileDescriptor_034e29c79f9ba827, []int{12}
+	return fileDescriptor_034e29c79f9ba827, []int{13}
 }
 
 func (m *NotifySegment) XXX_Unmarshal(b []byte) error {
@@ -900,6 +1274,27 @@ func (m *NotifySegment) GetFullProfiles() []*VideoProfile {
 	return nil
 }
 
+func (m *NotifySegment) GetHeartbeat() bool {
+	if m != nil {
+		return m.Heartbeat
+	}
+	return false
+}
+
+func (m *NotifySegment) GetStorage() *OSInfo {
+	if m != nil {
+		return m.Storage
+	}
+	return nil
+}
+
+func (m *NotifySegment) GetSeqNo() int64 {
+	if m != nil {
+		return m.SeqNo
+	}
+	return 0
+}
+
 // Required parameters for probabilistic micropayment tickets
 type TicketParams struct {
 	// ETH address of the recipient
@@ -923,7 +1318,7 @@ func (m *TicketParams) Reset()         { *m = TicketParams{} }
 func (m *TicketParams) String() string { return proto.CompactTextString(m) }
 func (*TicketParams) ProtoMessage()    {}
 func (*TicketParams) Descriptor() ([]byte, []int) {
-	return fileDescriptor_034e29c79f9ba827, []int{13}
+	return fileDescriptor_034e29c79f9ba827, []int{14}
 }
 
 func (m *TicketParams) XXX_Unmarshal(b []byte) error {
@@ -995,7 +1390,7 @@ func (m *TicketSenderParams) Reset()         { *m = TicketSenderParams{} }
 func (m *TicketSenderParams) String() string { return proto.CompactTextString(m) }
 func (*TicketSenderParams) ProtoMessage()    {}
 func (*TicketSenderParams) Descriptor() ([]byte, []int) {
-	return fileDescriptor_034e29c79f9ba827, []int{14}
+	return fileDescriptor_034e29c79f9ba827, []int{15}
 }
 
 func (m *TicketSenderParams) XXX_Unmarshal(b []byte) error {
@@ -1045,7 +1440,7 @@ func (m *TicketExpirationParams) Reset()         { *m = TicketExpirationParams{}
 func (m *TicketExpirationParams) String() string { return proto.CompactTextString(m) }
 func (*TicketExpirationParams) ProtoMessage()    {}
 func (*TicketExpirationParams) Descriptor() ([]byte, []int) {
-	return fileDescriptor_034e29c79f9ba827, []int{15}
+	return fileDescriptor_034e29c79f9ba827, []int{16}
 }
 
 func (m *TicketExpirationParams) XXX_Unmarshal(b []byte) error {
@@ -1103,7 +1498,7 @@ func (m *Payment) Reset()         { *m = Payment{} }
 func (m *Payment) String() string { return proto.CompactTextString(m) }
 func (*Payment) ProtoMessage()    {}
 func (*Payment) Descriptor() ([]byte, []int) {
-	return fileDescriptor_034e29c79f9ba827, []int{16}
+	return fileDescriptor_034e29c79f9ba827, []int{17}
 }
 
 func (m *Payment) XXX_Unmarshal(b []byte) error {
@@ -1161,12 +1556,19 @@ func (m *Payment) GetExpectedPrice() *PriceInfo {
 
 func init() {
 	proto.RegisterEnum("net.OSInfo_StorageType", OSInfo_StorageType_name, OSInfo_StorageType_value)
+	proto.RegisterEnum("net.VideoProfile_Format", VideoProfile_Format_name, VideoProfile_Format_value)
+	proto.RegisterEnum("net.VideoProfile_AudioCodec", VideoProfile_AudioCodec_name, VideoProfile_AudioCodec_value)
+	proto.RegisterEnum("net.VideoProfile_VideoCodec", VideoProfile_VideoCodec_name, VideoProfile_VideoCodec_value)
+	proto.RegisterEnum("net.VideoProfile_Profile", VideoProfile_Profile_name, VideoProfile_Profile_value)
+	proto.RegisterEnum("net.VideoProfile_ImageFormat", VideoProfile_ImageFormat_name, VideoProfile_ImageFormat_value)
 	proto.RegisterType((*PingPong)(nil), "net.PingPong")
 	proto.RegisterType((*OrchestratorRequest)(nil), "net.OrchestratorRequest")
 	proto.RegisterType((*OSInfo)(nil), "net.OSInfo")
 	proto.RegisterType((*S3OSInfo)(nil), "net.S3OSInfo")
+	proto.RegisterMapType((map[string]string)(nil), "net.S3OSInfo.PresignedUrlsEntry")
 	proto.RegisterType((*PriceInfo)(nil), "net.PriceInfo")
 	proto.RegisterType((*OrchestratorInfo)(nil), "net.OrchestratorInfo")
+	proto.RegisterType((*Capabilities)(nil), "net.Capabilities")
 	proto.RegisterType((*SegData)(nil), "net.SegData")
 	proto.RegisterType((*VideoProfile)(nil), "net.VideoProfile")
 	proto.RegisterType((*TranscodedSegmentData)(nil), "net.TranscodedSegmentData")
@@ -1183,78 +1585,112 @@ func init() {
 func init() { proto.RegisterFile("net/lp_rpc.proto", fileDescriptor_034e29c79f9ba827) }
 
 var fileDescriptor_034e29c79f9ba827 = []byte{
-	// 1122 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x9c, 0x56, 0xcd, 0x6e, 0xdb, 0x46,
-	0x10, 0x0e, 0x2d, 0x59, 0xb6, 0x46, 0x92, 0x23, 0x6f, 0x1c, 0x87, 0x71, 0xdb, 0x40, 0x21, 0x12,
-	0xc0, 0x3d, 0xc4, 0x2d, 0x6c, 0x24, 0x40, 0x6e, 0x4d, 0x1a, 0x23, 0x36, 0x50, 0xc4, 0xc2, 0xca,
-	0x09, 0xd0, 0x93, 0xb0, 0x22, 0x47, 0xd2, 0xc6, 0xf2, 0x92, 0x59, 0xae, 0x6a, 0x2b, 0xe8, 0x8b,
-	0xb4, 0x87, 0x1e, 0x0a, 0xf4, 0xd2, 0xa7, 0xe8, 0x7b, 0xf4, 0x65, 0x8a, 0x9d, 0x5d, 0xd2, 0x94,
-	0xed, 0x43, 0xd0, 0xdb, 0xce, 0x37, 0xb3, 0xb3, 0xf3, 0xf7, 0x0d, 0x09, 0x5d, 0x85, 0xe6, 0xbb,
-	0x59, 0x36, 0xd4, 0x59, 0xbc, 0x97, 0xe9, 0xd4, 0xa4, 0xac, 0xa6, 0xd0, 0x44, 0x3d, 0x58, 0xef,
-	0x4b, 0x35, 0xe9, 0xa7, 0x6a, 0xc2, 0xb6, 0x60, 0xf5, 0x17, 0x31, 0x9b, 0x63, 0x18, 0xf4, 0x82,
-	0xdd, 0x36, 0x77, 0x42, 0xf4, 0x0a, 0xee, 0x9d, 0xe8, 0x78, 0x8a, 0xb9, 0xd1, 0xc2, 0xa4, 0x9a,
-	0xe3, 0xa7, 0x39, 0xe6, 0x86, 0x85, 0xb0, 0x26, 0x92, 0x44, 0x63, 0x9e, 0x7b, 0xf3, 0x42, 0x64,
-	0x5d, 0xa8, 0xe5, 0x72, 0x12, 0xae, 0x10, 0x6a, 0x8f, 0xd1, 0x6f, 0x01, 0x34, 0x4e, 0x06, 0xc7,
-	0x6a, 0x9c, 0xb2, 0x97, 0xd0, 0xca, 0x4d, 0xaa, 0xc5, 0x04, 0x4f, 0x17, 0x99, 0x7b, 0x69, 0x63,
-	0xff, 0xc1, 0x9e, 0x42, 0xb3, 0xe7, 0x2c, 0xf6, 0x06, 0x57, 0x6a, 0x5e, 0xb5, 0x65, 0x4f, 0xa1,
-	0x91, 0x1f, 0x48, 0x35, 0x4e, 0xc3, 0x6e, 0x2f, 0xd8, 0x6d, 0xed, 0x77, 0xe8, 0xd6, 0xe0, 0xc0,
-	0xdd, 0xe3, 0x5e, 0x19, 0x3d, 0x83, 0x56, 0xc5, 0x05, 0x03, 0x68, 0xbc, 0x39, 0xe6, 0x87, 0x3f,
-	0x9e, 0x76, 0xef, 0xb0, 0x06, 0xac, 0x0c, 0x0e, 0xba, 0x81, 0xc5, 0xde, 0x9e, 0x9c, 0xbc, 0xfd,
-	0xe9, 0xb0, 0xbb, 0x12, 0xfd, 0x19, 0xc0, 0x7a, 0xe1, 0x83, 0x31, 0xa8, 0x4f, 0xd3, 0xdc, 0x50,
-	0x58, 0x4d, 0x4e, 0x67, 0x9b, 0xce, 0x19, 0x2e, 0x28, 0x9d, 0x26, 0xb7, 0x47, 0xb6, 0x0d, 0x8d,
-	0x2c, 0x9d, 0xc9, 0x78, 0x11, 0xd6, 0x08, 0xf4, 0x12, 0xfb, 0x1a, 0x9a, 0xb9, 0x9c, 0x28, 0x61,
-	0xe6, 0x1a, 0xc3, 0x3a, 0xa9, 0xae, 0x00, 0xf6, 0x08, 0x20, 0xd6, 0x98, 0xa0, 0x32, 0x52, 0xcc,
-	0xc2, 0x55, 0x52, 0x57, 0x10, 0xb6, 0x03, 0xeb, 0x97, 0xaf, 0xce, 0x3f, 0xbf, 0x11, 0x06, 0xc3,
-	0x06, 0x69, 0x4b, 0x39, 0x7a, 0x0f, 0xcd, 0xbe, 0x96, 0x31, 0x52, 0x90, 0x11, 0xb4, 0x33, 0x2b,
-	0xf4, 0x51, 0xbf, 0x57, 0xd2, 0x05, 0x5b, 0xe3, 0x4b, 0x18, 0x7b, 0x02, 0x9d, 0x4c, 0x5e, 0xe2,
-	0x2c, 0x2f, 0x8c, 0x56, 0xc8, 0x68, 0x19, 0x8c, 0xfe, 0x09, 0xa0, 0x5b, 0xed, 0x2d, 0xb9, 0x7f,
-	0x04, 0x60, 0xb4, 0x50, 0x79, 0x9c, 0x26, 0xa8, 0x7d, 0x25, 0x2a, 0x08, 0x7b, 0x01, 0x1d, 0x23,
-	0xe3, 0x33, 0x34, 0xc3, 0x4c, 0x68, 0x71, 0x9e, 0x93, 0xeb, 0xd6, 0xfe, 0x26, 0x75, 0xe3, 0x94,
-	0x34, 0x7d, 0x52, 0xf0, 0xb6, 0xa9, 0x48, 0xec, 0x19, 0x00, 0x85, 0x38, 0xa4, 0x16, 0xd6, 0xe8,
-	0xd2, 0x06, 0x5d, 0x2a, 0x53, 0xe3, 0xcd, 0xac, 0xcc, 0xf2, 0x29, 0xac, 0xf9, 0xe6, 0x87, 0xbd,
-	0x5e, 0x6d, 0xb7, 0xb5, 0xdf, 0xaa, 0x0c, 0x09, 0x2f, 0x74, 0xd1, 0xbf, 0x01, 0xac, 0x0d, 0x70,
-	0xf2, 0x46, 0x18, 0x61, 0x23, 0x3f, 0x17, 0x4a, 0x8e, 0x31, 0x37, 0xc7, 0x89, 0x9f, 0xca, 0x0a,
-	0x42, 0x83, 0x89, 0x9f, 0x7c, 0x29, 0xec, 0x91, 0xfa, 0x2d, 0xf2, 0x29, 0x45, 0xd3, 0xe6, 0x74,
-	0xb6, 0x7d, 0xc8, 0x74, 0x3a, 0x96, 0x33, 0xcc, 0xa9, 0x89, 0x6d, 0x5e, 0xca, 0xc5, 0x68, 0xaf,
-	0x96, 0xa3, 0xfd, 0x85, 0x61, 0xb2, 0xe7, 0xd0, 0x1e, 0xcf, 0x67, 0xb3, 0x7e, 0xe1, 0xf8, 0x31,
-	0xd9, 0xba, 0x9a, 0x7d, 0x90, 0x09, 0xa6, 0x5e, 0xc3, 0x97, 0xcc, 0xa2, 0x5f, 0xa1, 0x5d, 0xd5,
-	0xda, 0x78, 0x95, 0x38, 0x47, 0x22, 0x40, 0x93, 0xd3, 0xd9, 0xb2, 0xf6, 0x42, 0x26, 0x66, 0x1a,
-	0x6e, 0xf6, 0x82, 0xdd, 0x55, 0xee, 0x04, 0x3b, 0xa3, 0x53, 0x94, 0x93, 0xa9, 0x09, 0x19, 0xc1,
-	0x5e, 0xb2, 0xb4, 0x1d, 0x49, 0xdb, 0x6d, 0x0c, 0xef, 0x91, 0xa2, 0x10, 0x6d, 0x6e, 0xe3, 0x2c,
-	0x0f, 0xb7, 0x7a, 0xc1, 0x6e, 0x87, 0xdb, 0x63, 0xf4, 0x0a, 0xee, 0x9f, 0x16, 0x7d, 0x4f, 0x06,
-	0x38, 0x39, 0x47, 0x65, 0xa8, 0xd0, 0x5d, 0xa8, 0xcd, 0xf5, 0xcc, 0xcf, 0x86, 0x3d, 0x12, 0x25,
-	0x68, 0xb4, 0x7c, 0x75, 0xbd, 0x14, 0xfd, 0x0c, 0x9d, 0xd2, 0x05, 0x5d, 0x7d, 0x01, 0xeb, 0xb9,
-	0xf3, 0x64, 0xf7, 0x86, 0x2d, 0xc2, 0x8e, 0x1b, 0x9c, 0xdb, 0x1e, 0xe2, 0xa5, 0xed, 0x2d, 0x4b,
-	0xe5, 0xf7, 0x00, 0xee, 0x96, 0xb7, 0x38, 0xe6, 0xf3, 0x99, 0x29, 0x3a, 0x1c, 0x5c, 0x75, 0x78,
-	0x1b, 0x56, 0x51, 0xeb, 0x54, 0x3b, 0xfe, 0x1e, 0xdd, 0xe1, 0x4e, 0x64, 0xbb, 0x50, 0x4f, 0x84,
-	0x11, 0x7e, 0x0e, 0xd9, 0x72, 0x0c, 0xf6, 0xed, 0xa3, 0x3b, 0x9c, 0x2c, 0xd8, 0xb7, 0x50, 0xaf,
-	0x2c, 0x9d, 0xfb, 0xae, 0xbd, 0xd7, 0x48, 0xc3, 0xc9, 0xe4, 0xf5, 0x3a, 0x34, 0x34, 0x05, 0x12,
-	0x1d, 0xc2, 0x5d, 0x8e, 0x13, 0x99, 0x1b, 0x2c, 0x17, 0xe6, 0x36, 0x34, 0x72, 0x8c, 0x35, 0x16,
-	0xdb, 0xc5, 0x4b, 0x76, 0xde, 0x62, 0x91, 0x89, 0x58, 0x9a, 0x85, 0x2f, 0x5e, 0x29, 0x47, 0x7f,
-	0x04, 0xd0, 0x79, 0x97, 0x1a, 0x39, 0x5e, 0xf8, 0xaa, 0xdc, 0x52, 0xfa, 0x2e, 0xd4, 0x3e, 0xa6,
-	0xa3, 0x62, 0x3f, 0x7d, 0x4c, 0x47, 0xf6, 0x25, 0x23, 0xf2, 0xb3, 0xe3, 0x84, 0x62, 0xae, 0x71,
-	0x2f, 0x2d, 0x4d, 0xf6, 0xe6, 0xb5, 0xc9, 0xfe, 0x9f, 0x03, 0xfa, 0x77, 0x00, 0xed, 0x2a, 0xe7,
-	0xed, 0x0e, 0xd4, 0x18, 0xcb, 0x4c, 0xa2, 0x32, 0x9e, 0x82, 0x57, 0x00, 0xfb, 0x06, 0x60, 0x2c,
-	0x62, 0x1c, 0xba, 0xcf, 0x8c, 0x6b, 0x66, 0xd3, 0x22, 0x1f, 0x2c, 0xc0, 0x1e, 0xc2, 0xfa, 0x85,
-	0x54, 0xc3, 0x4c, 0xa7, 0x23, 0x4f, 0xc9, 0xb5, 0x0b, 0xa9, 0xfa, 0x3a, 0x1d, 0xb1, 0x3d, 0xb8,
-	0x57, 0xba, 0x19, 0x6a, 0xa1, 0x92, 0x21, 0x11, 0xd7, 0x11, 0x74, 0xb3, 0x54, 0x71, 0xa1, 0x92,
-	0x23, 0xcb, 0x62, 0x06, 0xf5, 0x1c, 0x31, 0xf1, 0x54, 0xa5, 0x73, 0x74, 0x0c, 0xcc, 0xc5, 0x3a,
-	0x40, 0x95, 0xa0, 0xf6, 0x11, 0x3f, 0x86, 0x76, 0x4e, 0xf2, 0x50, 0xa5, 0x2a, 0x76, 0x9f, 0xa4,
-	0x0e, 0x6f, 0x39, 0xec, 0x9d, 0x85, 0x6e, 0x19, 0xbe, 0xcf, 0xb0, 0xed, 0x5c, 0x1d, 0x5e, 0x66,
-	0x52, 0x0b, 0x23, 0x53, 0xe5, 0xdd, 0x3d, 0x85, 0x8d, 0x58, 0x23, 0x21, 0x43, 0x9d, 0xce, 0x55,
-	0xe2, 0xa7, 0xb1, 0x53, 0xa0, 0xdc, 0x82, 0xec, 0x25, 0x3c, 0x5c, 0x36, 0x1b, 0x8e, 0x66, 0x69,
-	0x7c, 0xe6, 0xb2, 0x72, 0x0f, 0x6d, 0x2f, 0xdd, 0x78, 0x6d, 0xd5, 0x36, 0xb5, 0xe8, 0xaf, 0x15,
-	0x58, 0xeb, 0x8b, 0x05, 0x8d, 0xc3, 0x8d, 0x65, 0x1c, 0x7c, 0xd9, 0x32, 0xa6, 0x61, 0xb4, 0x09,
-	0xfa, 0xb7, 0xbc, 0xc4, 0x8e, 0x60, 0x13, 0xcb, 0x8c, 0x0a, 0x9f, 0x8e, 0x23, 0x5f, 0x55, 0x7c,
-	0x5e, 0xcf, 0x9a, 0x77, 0xf1, 0x7a, 0x1d, 0x8e, 0x61, 0xcb, 0x47, 0xe6, 0xab, 0xeb, 0x9d, 0xd5,
-	0x69, 0xb0, 0x1e, 0x54, 0x9c, 0x55, 0xbb, 0xc1, 0x99, 0xb9, 0xd9, 0xa1, 0xe7, 0xb0, 0x81, 0x97,
-	0x19, 0xc6, 0x06, 0x93, 0x21, 0x7d, 0x20, 0xa8, 0xab, 0x37, 0xbf, 0x1e, 0x9d, 0xc2, 0x8a, 0xa0,
-	0xfd, 0x4b, 0x68, 0x57, 0x79, 0xca, 0x5e, 0xc3, 0xdd, 0xb7, 0x68, 0x96, 0xa0, 0xf0, 0x06, 0x9b,
-	0x3d, 0x5b, 0x77, 0x6e, 0xe7, 0x39, 0x7b, 0x02, 0x75, 0xfb, 0xbb, 0xc4, 0xdc, 0xbf, 0x47, 0xf1,
-	0xe7, 0xb4, 0xb3, 0x2c, 0xee, 0xbf, 0x03, 0x38, 0xbd, 0xfa, 0x60, 0xfe, 0x00, 0xac, 0xd8, 0x05,
-	0x15, 0x74, 0x8b, 0xae, 0x5c, 0x5b, 0x12, 0x3b, 0x6e, 0x11, 0x2d, 0x51, 0xfe, 0xfb, 0x60, 0xd4,
-	0xa0, 0x1f, 0xb6, 0x83, 0xff, 0x02, 0x00, 0x00, 0xff, 0xff, 0x30, 0x9c, 0xf7, 0xdb, 0xc4, 0x09,
-	0x00, 0x00,
+	// 1672 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x9c, 0x57, 0x5f, 0x6f, 0xdb, 0xc8,
+	0x11, 0x37, 0x25, 0xeb, 0xdf, 0x48, 0x72, 0xe8, 0x8d, 0xe3, 0x30, 0xbe, 0xf8, 0xa0, 0xf0, 0x12,
+	0xc0, 0xf7, 0x70, 0xee, 0x55, 0x4e, 0x82, 0xa6, 0x40, 0x81, 0x93, 0x6d, 0xc5, 0x56, 0x91, 0x48,
+	0xc4, 0xda, 0x0e, 0x70, 0x4f, 0x04, 0x45, 0xae, 0x64, 0x5e, 0x24, 0x92, 0x59, 0xae, 0x1a, 0xeb,
+	0xd0, 0x2f, 0xd2, 0xbe, 0xf7, 0xa1, 0xfd, 0x24, 0xfd, 0x0e, 0xfd, 0x1c, 0x45, 0xd1, 0xb7, 0x62,
+	0x67, 0x97, 0x14, 0x65, 0xfb, 0x0e, 0xd7, 0x7b, 0xd2, 0xce, 0x6f, 0xfe, 0xec, 0xcc, 0x70, 0x76,
+	0x66, 0x04, 0x66, 0xc4, 0xc4, 0x6f, 0x66, 0x89, 0xcb, 0x13, 0xff, 0x30, 0xe1, 0xb1, 0x88, 0x49,
+	0x39, 0x62, 0xc2, 0xee, 0x40, 0xdd, 0x09, 0xa3, 0xa9, 0x13, 0x47, 0x53, 0xb2, 0x03, 0x95, 0x3f,
+	0x79, 0xb3, 0x05, 0xb3, 0x8c, 0x8e, 0x71, 0xd0, 0xa2, 0x8a, 0xb0, 0x7b, 0xf0, 0x70, 0xc4, 0xfd,
+	0x6b, 0x96, 0x0a, 0xee, 0x89, 0x98, 0x53, 0xf6, 0x69, 0xc1, 0x52, 0x41, 0x2c, 0xa8, 0x79, 0x41,
+	0xc0, 0x59, 0x9a, 0x6a, 0xf1, 0x8c, 0x24, 0x26, 0x94, 0xd3, 0x70, 0x6a, 0x95, 0x10, 0x95, 0x47,
+	0xfb, 0x2f, 0x06, 0x54, 0x47, 0x17, 0x83, 0x68, 0x12, 0x93, 0x37, 0xd0, 0x4c, 0x45, 0xcc, 0xbd,
+	0x29, 0xbb, 0x5c, 0x26, 0xea, 0xa6, 0xad, 0xee, 0xe3, 0xc3, 0x88, 0x89, 0x43, 0x25, 0x71, 0x78,
+	0xb1, 0x62, 0xd3, 0xa2, 0x2c, 0x79, 0x01, 0xd5, 0xf4, 0x28, 0x8c, 0x26, 0xb1, 0x65, 0x76, 0x8c,
+	0x83, 0x66, 0xb7, 0x8d, 0x5a, 0x17, 0x47, 0x4a, 0x8f, 0x6a, 0xa6, 0xfd, 0x0d, 0x34, 0x0b, 0x26,
+	0x08, 0x40, 0xf5, 0x74, 0x40, 0xfb, 0x27, 0x97, 0xe6, 0x06, 0xa9, 0x42, 0xe9, 0xe2, 0xc8, 0x34,
+	0x24, 0x76, 0x36, 0x1a, 0x9d, 0xbd, 0xeb, 0x9b, 0x25, 0xfb, 0x9f, 0x25, 0xa8, 0x67, 0x36, 0x08,
+	0x81, 0xcd, 0xeb, 0x38, 0x15, 0xe8, 0x56, 0x83, 0xe2, 0x59, 0x86, 0xf3, 0x91, 0x2d, 0x31, 0x9c,
+	0x06, 0x95, 0x47, 0xb2, 0x0b, 0xd5, 0x24, 0x9e, 0x85, 0xfe, 0xd2, 0x2a, 0x23, 0xa8, 0x29, 0xf2,
+	0x14, 0x1a, 0x69, 0x38, 0x8d, 0x3c, 0xb1, 0xe0, 0xcc, 0xda, 0x44, 0xd6, 0x0a, 0x20, 0x5f, 0x02,
+	0xf8, 0x9c, 0x05, 0x2c, 0x12, 0xa1, 0x37, 0xb3, 0x2a, 0xc8, 0x2e, 0x20, 0x64, 0x0f, 0xea, 0x37,
+	0xbd, 0xf9, 0x8f, 0xa7, 0x9e, 0x60, 0x56, 0x15, 0xb9, 0x39, 0x2d, 0x79, 0x2c, 0x0a, 0x92, 0x38,
+	0x8c, 0x84, 0x55, 0x53, 0xbc, 0x8c, 0x26, 0x6f, 0xa1, 0x9d, 0x70, 0x26, 0xef, 0x61, 0xc1, 0x15,
+	0x9f, 0xa5, 0x56, 0xbd, 0x53, 0x3e, 0x68, 0x76, 0x3b, 0x6b, 0xd9, 0x39, 0x74, 0x8a, 0x22, 0xfd,
+	0x48, 0xf0, 0x25, 0x5d, 0x57, 0xdb, 0xfb, 0x0e, 0xc8, 0x5d, 0xa1, 0x2c, 0x7a, 0x63, 0x15, 0x7d,
+	0x5e, 0x25, 0x2a, 0x23, 0x8a, 0xf8, 0x7d, 0xe9, 0x77, 0x86, 0x7d, 0x05, 0x0d, 0x87, 0x87, 0x3e,
+	0xc3, 0x54, 0xda, 0xd0, 0x4a, 0x24, 0xe1, 0x30, 0x7e, 0x15, 0x85, 0x2a, 0xa5, 0x65, 0xba, 0x86,
+	0x91, 0xe7, 0xd0, 0x4e, 0xc2, 0x1b, 0x36, 0x4b, 0x33, 0xa1, 0x12, 0x0a, 0xad, 0x83, 0xf6, 0x7f,
+	0x0c, 0x30, 0x8b, 0x15, 0x88, 0xe6, 0xbf, 0x04, 0x10, 0xdc, 0x8b, 0x52, 0x3f, 0x0e, 0x18, 0xd7,
+	0xee, 0x15, 0x10, 0xf2, 0x1a, 0xda, 0x22, 0xf4, 0x3f, 0x32, 0xe1, 0x26, 0x1e, 0xf7, 0xe6, 0x29,
+	0x9a, 0x6e, 0x76, 0xb7, 0x31, 0x2b, 0x97, 0xc8, 0x71, 0x90, 0x41, 0x5b, 0xa2, 0x40, 0x91, 0x6f,
+	0x00, 0xd0, 0x45, 0x17, 0x0b, 0xad, 0x8c, 0x4a, 0x5b, 0xa8, 0x94, 0x87, 0x46, 0x1b, 0x49, 0x1e,
+	0xe5, 0x0b, 0xa8, 0xe9, 0x12, 0xb5, 0x3a, 0x98, 0xf6, 0x66, 0xa1, 0x94, 0x69, 0xc6, 0x23, 0xaf,
+	0xa0, 0xe5, 0x7b, 0x89, 0x37, 0x0e, 0x67, 0xa1, 0x08, 0x59, 0x6a, 0x3d, 0x2b, 0x38, 0x73, 0x52,
+	0x60, 0xd0, 0x35, 0x31, 0xfb, 0xef, 0x25, 0x68, 0x15, 0xd9, 0xe4, 0x25, 0x54, 0x65, 0x78, 0xbe,
+	0x7c, 0x73, 0xe5, 0x83, 0xad, 0xee, 0x53, 0xb4, 0xf0, 0x21, 0x0c, 0x58, 0xec, 0xf0, 0x78, 0x12,
+	0xce, 0x98, 0x22, 0x4e, 0xa4, 0x10, 0xd5, 0xb2, 0xa4, 0x0b, 0xb5, 0x49, 0xcc, 0xe7, 0x9e, 0x90,
+	0x59, 0x90, 0x6a, 0xd6, 0x5d, 0xb5, 0xb7, 0x28, 0x40, 0x33, 0x41, 0xf2, 0xdb, 0x55, 0x60, 0xe5,
+	0x4e, 0xf9, 0xe7, 0xde, 0x68, 0x1e, 0xe4, 0x3e, 0xc0, 0xdc, 0xbb, 0x71, 0xd5, 0xc7, 0xc3, 0xfa,
+	0x2f, 0xd3, 0xc6, 0xdc, 0xbb, 0x71, 0x10, 0x90, 0x95, 0x34, 0x4d, 0x16, 0x58, 0xf8, 0x75, 0x2a,
+	0x8f, 0xb2, 0x92, 0xbc, 0x45, 0x10, 0xc6, 0x58, 0xee, 0x75, 0xaa, 0x08, 0xf9, 0xba, 0xc2, 0xb9,
+	0x37, 0x65, 0x29, 0x56, 0x7a, 0x9d, 0x6a, 0x4a, 0x9a, 0x47, 0xd3, 0x2e, 0x97, 0x2f, 0xa4, 0xae,
+	0xcc, 0x23, 0x42, 0x3d, 0xc1, 0xec, 0x7f, 0x19, 0x50, 0xbb, 0x60, 0xd3, 0x53, 0x4f, 0x78, 0xb2,
+	0x38, 0xe6, 0x5e, 0x14, 0x4e, 0x58, 0x2a, 0x06, 0x81, 0x6e, 0x4f, 0x05, 0x04, 0x3b, 0x14, 0xfb,
+	0xa4, 0xab, 0x4d, 0x1e, 0xf1, 0xe1, 0x7b, 0xe9, 0x35, 0x7e, 0xf0, 0x16, 0xc5, 0xb3, 0x7c, 0x74,
+	0x89, 0xca, 0x8e, 0x8a, 0xa6, 0x45, 0x73, 0x3a, 0xeb, 0x71, 0x95, 0xbc, 0xc7, 0xfd, 0x1f, 0x95,
+	0x30, 0x59, 0xcc, 0x66, 0x4e, 0x66, 0xf8, 0x59, 0xa7, 0x9c, 0x57, 0x42, 0xf1, 0x83, 0xd0, 0x35,
+	0x31, 0xfb, 0xdf, 0x15, 0x68, 0x15, 0xd9, 0xd2, 0xe1, 0xc8, 0x9b, 0x33, 0x6c, 0x85, 0x0d, 0x8a,
+	0x67, 0x99, 0xcf, 0xcf, 0x61, 0x20, 0xae, 0xad, 0xed, 0x8e, 0x71, 0x50, 0xa1, 0x8a, 0x90, 0xf9,
+	0xbc, 0x66, 0xe1, 0xf4, 0x5a, 0x58, 0x04, 0x61, 0x4d, 0xc9, 0x06, 0x3e, 0x0e, 0x05, 0x26, 0xf3,
+	0x21, 0x32, 0x32, 0x52, 0x06, 0x37, 0x49, 0x52, 0x6b, 0xa7, 0x63, 0x1c, 0xb4, 0xa9, 0x3c, 0x92,
+	0x6f, 0xa1, 0xaa, 0x0a, 0xc3, 0x7a, 0xd4, 0x31, 0x7e, 0xb6, 0x80, 0xb4, 0x1c, 0xf9, 0x03, 0x34,
+	0xf1, 0x73, 0xba, 0x58, 0x83, 0xd6, 0x6e, 0xc7, 0xb8, 0xbf, 0x5c, 0x7b, 0x52, 0x48, 0x95, 0x2b,
+	0x78, 0xf9, 0x99, 0x7c, 0x05, 0x6d, 0xa5, 0x9e, 0xb9, 0xf8, 0x18, 0x5d, 0x6c, 0x21, 0x78, 0xac,
+	0xfd, 0xdc, 0x07, 0xa5, 0xe2, 0xc6, 0xd1, 0x6c, 0x69, 0x59, 0x58, 0x2d, 0x0d, 0x44, 0x46, 0xd1,
+	0x6c, 0x49, 0xba, 0x50, 0x51, 0x97, 0x3f, 0xf9, 0xa9, 0xcb, 0x0b, 0x6f, 0x45, 0x89, 0x92, 0x23,
+	0xa8, 0xe9, 0x6f, 0x6c, 0xed, 0xa1, 0xd6, 0x93, 0xbb, 0x5a, 0xfa, 0x97, 0x66, 0x92, 0x58, 0xd9,
+	0x71, 0x62, 0x7d, 0x81, 0x2e, 0xca, 0xa3, 0x44, 0x7c, 0x3e, 0xb1, 0x9e, 0x2a, 0xc4, 0xe7, 0x13,
+	0x72, 0x04, 0x15, 0xac, 0x63, 0x6b, 0x1f, 0xcd, 0xee, 0xdf, 0x35, 0x3b, 0x90, 0x6c, 0x9d, 0x45,
+	0x25, 0x6b, 0xef, 0x43, 0x55, 0x01, 0x72, 0x62, 0xbd, 0x77, 0xfa, 0x67, 0x97, 0x17, 0xe6, 0x06,
+	0xa9, 0x41, 0xf9, 0xbd, 0xf3, 0xd2, 0x34, 0xec, 0x57, 0x00, 0xab, 0xf4, 0x91, 0x2d, 0x80, 0xde,
+	0xd5, 0xe9, 0x60, 0xe4, 0x9e, 0x8c, 0x9c, 0xef, 0x95, 0x58, 0xaf, 0x77, 0x62, 0x1a, 0x2b, 0xc6,
+	0x70, 0x34, 0x94, 0x13, 0xef, 0x6b, 0x80, 0x55, 0xe0, 0xa4, 0x0e, 0x9b, 0xe7, 0xdd, 0xd7, 0x2f,
+	0xcd, 0x0d, 0x7d, 0x7a, 0x65, 0x1a, 0x52, 0xf5, 0x83, 0xf3, 0xc6, 0x2c, 0xd9, 0x23, 0xa8, 0x65,
+	0x05, 0xf7, 0x10, 0x1e, 0xf4, 0x87, 0x27, 0xa3, 0xd3, 0x3e, 0x75, 0x4f, 0xfb, 0x6f, 0x7b, 0x57,
+	0xef, 0xe4, 0x40, 0xdd, 0x86, 0xb6, 0x54, 0x76, 0x8f, 0x7b, 0x17, 0xfd, 0x77, 0x83, 0x61, 0xdf,
+	0x34, 0x48, 0x1b, 0x1a, 0x08, 0xbd, 0xef, 0x0d, 0x86, 0x66, 0x29, 0x27, 0xcf, 0x07, 0x67, 0xe7,
+	0x66, 0xd9, 0x3e, 0x84, 0x66, 0x21, 0x4e, 0xd2, 0x82, 0xfa, 0x70, 0xe4, 0x0e, 0xde, 0xf7, 0xce,
+	0xfa, 0xca, 0x81, 0x3f, 0x3a, 0xfd, 0x33, 0xe5, 0x80, 0x33, 0x3c, 0x33, 0x4b, 0x76, 0x0f, 0x1e,
+	0x5d, 0x66, 0x4d, 0x3d, 0xb8, 0x60, 0xd3, 0x39, 0x8b, 0x04, 0x3e, 0x71, 0x13, 0xca, 0x0b, 0x3e,
+	0xcb, 0xe6, 0xd2, 0x82, 0xcf, 0x70, 0x2a, 0xab, 0xd6, 0xa3, 0xde, 0xb5, 0xa6, 0xec, 0xef, 0xa1,
+	0x9d, 0x9b, 0x40, 0xd5, 0xd7, 0x50, 0x4f, 0x95, 0x25, 0xd5, 0x46, 0x9b, 0xdd, 0x3d, 0x35, 0x15,
+	0xee, 0xbb, 0x88, 0xe6, 0xb2, 0xf7, 0xec, 0x35, 0x7f, 0x35, 0xe0, 0x41, 0xae, 0x45, 0x59, 0xba,
+	0x98, 0x89, 0xac, 0xb7, 0x18, 0xab, 0xde, 0xb2, 0x0b, 0x15, 0xc6, 0x79, 0xcc, 0xd5, 0xc0, 0x3c,
+	0xdf, 0xa0, 0x8a, 0x24, 0x07, 0xb0, 0x19, 0x78, 0xc2, 0xd3, 0x43, 0x86, 0xac, 0xfb, 0x20, 0xef,
+	0x3e, 0xdf, 0xa0, 0x28, 0x41, 0xbe, 0x86, 0xcd, 0xc2, 0xde, 0xf3, 0x48, 0x35, 0x96, 0x5b, 0x13,
+	0x91, 0xa2, 0xc8, 0x71, 0x1d, 0xaa, 0x1c, 0x1d, 0xb1, 0xff, 0x0c, 0x0f, 0x28, 0x9b, 0x86, 0xa9,
+	0x60, 0xf9, 0xce, 0xb6, 0x0b, 0xd5, 0x94, 0xf9, 0x9c, 0x65, 0x0b, 0x8e, 0xa6, 0x64, 0xa7, 0x93,
+	0x73, 0xc7, 0x0f, 0xc5, 0x52, 0x27, 0x2f, 0xa7, 0xef, 0x8c, 0xae, 0xf2, 0x2f, 0x1b, 0x5d, 0xff,
+	0x35, 0xa0, 0x3d, 0x8c, 0x45, 0x38, 0x59, 0xea, 0x64, 0xde, 0xf3, 0xc5, 0x4c, 0x28, 0xff, 0x10,
+	0x8f, 0xb3, 0xcd, 0xea, 0x87, 0x78, 0x2c, 0x1d, 0x14, 0x5e, 0xfa, 0x71, 0x10, 0x60, 0xa8, 0x65,
+	0xaa, 0xa9, 0xb5, 0x56, 0xbc, 0x7d, 0xab, 0x15, 0xff, 0xba, 0x8e, 0x2a, 0x97, 0xb5, 0x6b, 0xe6,
+	0x71, 0x31, 0x66, 0x9e, 0xb0, 0x6c, 0xd5, 0x3b, 0x72, 0xa0, 0xd8, 0xcd, 0xbf, 0xea, 0x18, 0x3f,
+	0xd9, 0xcd, 0x77, 0xa0, 0x92, 0xb2, 0x4f, 0xc3, 0xd8, 0x7a, 0x8e, 0xee, 0x2a, 0xc2, 0xfe, 0x87,
+	0x01, 0xad, 0xe2, 0x8a, 0x21, 0xef, 0xe2, 0xcc, 0x0f, 0x93, 0x90, 0x45, 0x42, 0x8f, 0xa3, 0x15,
+	0x20, 0xdb, 0xd8, 0xc4, 0xf3, 0x99, 0xbb, 0xda, 0xaa, 0x5a, 0xb4, 0x21, 0x91, 0x0f, 0x12, 0x20,
+	0x4f, 0xa0, 0xfe, 0x39, 0x8c, 0xdc, 0x84, 0xc7, 0x63, 0x3d, 0x9e, 0x6a, 0x9f, 0xc3, 0xc8, 0xe1,
+	0xf1, 0x98, 0x1c, 0xc2, 0xc3, 0xdc, 0x8c, 0xcb, 0xbd, 0x28, 0x70, 0x71, 0x88, 0xa9, 0x61, 0xb5,
+	0x9d, 0xb3, 0xa8, 0x17, 0x05, 0xe7, 0x72, 0xa2, 0x11, 0xd8, 0x4c, 0x19, 0x0b, 0xf4, 0xd8, 0xc2,
+	0xb3, 0x3d, 0x00, 0xa2, 0x7c, 0xbd, 0x60, 0x51, 0xc0, 0xb8, 0xf6, 0xf8, 0x19, 0xb4, 0x52, 0xa4,
+	0xdd, 0x28, 0x8e, 0x7c, 0xb5, 0xa7, 0xb7, 0x69, 0x53, 0x61, 0x43, 0x09, 0xdd, 0xf3, 0x1c, 0x7e,
+	0x84, 0x5d, 0x65, 0xaa, 0x7f, 0x93, 0x84, 0xdc, 0x13, 0x61, 0x1c, 0x69, 0x73, 0x2f, 0x60, 0xcb,
+	0xe7, 0x0c, 0x11, 0x97, 0xc7, 0x8b, 0x28, 0xd0, 0xef, 0xa3, 0x9d, 0xa1, 0x54, 0x82, 0xe4, 0x0d,
+	0x3c, 0x59, 0x17, 0x73, 0xc7, 0xb3, 0xd8, 0xff, 0xa8, 0xa2, 0x52, 0x17, 0xed, 0xae, 0x69, 0x1c,
+	0x4b, 0xb6, 0x0c, 0xcd, 0xfe, 0x5b, 0x09, 0x6a, 0x8e, 0xb7, 0xc4, 0x4a, 0xbb, 0xb3, 0xfb, 0x19,
+	0xbf, 0x6c, 0xf7, 0xc3, 0xe7, 0x21, 0x03, 0xd4, 0x77, 0x69, 0x8a, 0x9c, 0xc3, 0x36, 0xcb, 0x23,
+	0xca, 0x6c, 0xaa, 0x77, 0xf0, 0x45, 0xc1, 0xe6, 0xed, 0xa8, 0xa9, 0xc9, 0x6e, 0xe7, 0x61, 0x00,
+	0x3b, 0xda, 0x33, 0x9d, 0x5d, 0x6d, 0x6c, 0x13, 0x6b, 0xf6, 0x71, 0xc1, 0x58, 0xf1, 0x6b, 0x50,
+	0x22, 0xee, 0x7e, 0xa1, 0x57, 0xb0, 0xc5, 0x6e, 0x12, 0xe6, 0x0b, 0x16, 0xb8, 0xb8, 0x8f, 0x5a,
+	0x95, 0x7b, 0x97, 0xd5, 0x76, 0x26, 0x85, 0x50, 0xf7, 0x06, 0x5a, 0xc5, 0xce, 0x41, 0x8e, 0xe1,
+	0xc1, 0x19, 0x13, 0x6b, 0x90, 0x75, 0xa7, 0xbf, 0xe8, 0xfe, 0xb1, 0x77, 0x7f, 0xe7, 0x21, 0xcf,
+	0x61, 0x53, 0xfe, 0x87, 0x24, 0xea, 0x0f, 0x59, 0xf6, 0x77, 0x72, 0x6f, 0x9d, 0xec, 0x0e, 0x01,
+	0x2e, 0x57, 0xfb, 0xf9, 0x77, 0x40, 0xb2, 0xee, 0x54, 0x40, 0x77, 0x50, 0xe5, 0x56, 0xdb, 0xda,
+	0x53, 0xad, 0x71, 0xad, 0x9b, 0x7c, 0x6b, 0x8c, 0xab, 0xf8, 0x2f, 0xf6, 0xe8, 0x7f, 0x03, 0x00,
+	0x39, 0x43, 0x93, 0x8b, 0xd9, 0x0e, 0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
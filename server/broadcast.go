@@ -1,13 +1,18 @@
 package server
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math"
 	"math/big"
 	"net/url"
+	"path"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/golang/glog"
 
@@ -20,6 +25,7 @@ import (
 	"github.com/livepeer/go-livepeer/net"
 	"github.com/livepeer/go-livepeer/verification"
 
+	"github.com/livepeer/lpms/ffmpeg"
 	"github.com/livepeer/lpms/stream"
 )
 
@@ -27,9 +33,19 @@ var Policy *verification.Policy
 var BroadcastCfg = &BroadcastConfig{}
 var MaxAttempts = 3
 
+// SegmentDeadlineFactor bounds how long a segment is retried for, as a
+// multiple of the segment duration. Attempts already underway when the
+// deadline passes are not interrupted.
+var SegmentDeadlineFactor = 2.0
+
+var errMaxAttempts = errors.New("Hit max transcode attempts")
+var errSegmentDeadline = errors.New("ErrSegmentDeadline")
+
 type BroadcastConfig struct {
-	maxPrice *big.Rat
-	mu       sync.RWMutex
+	maxPrice          *big.Rat
+	selectionStrategy string
+	selectionWeights  *SelectionWeights
+	mu                sync.RWMutex
 }
 
 func (cfg *BroadcastConfig) MaxPrice() *big.Rat {
@@ -44,6 +60,45 @@ func (cfg *BroadcastConfig) SetMaxPrice(price *big.Rat) {
 	cfg.maxPrice = price
 }
 
+// SelectionStrategy returns the session selection strategy for new streams and
+// the weights used by the weighted strategy
+func (cfg *BroadcastConfig) SelectionStrategy() (string, SelectionWeights) {
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	strategy, weights := cfg.selectionStrategy, DefaultSelectionWeights
+	if strategy == "" {
+		strategy = SelectionMinLS
+	}
+	if cfg.selectionWeights != nil {
+		weights = *cfg.selectionWeights
+	}
+	return strategy, weights
+}
+
+// SetSelectionStrategy sets the session selection strategy for new streams.
+// Weights are only used by the weighted strategy; nil keeps the current ones.
+func (cfg *BroadcastConfig) SetSelectionStrategy(strategy string, weights *SelectionWeights) error {
+	if strategy != SelectionMinLS && strategy != SelectionWeighted {
+		return ErrUnknownSelectionStrategy
+	}
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	cfg.selectionStrategy = strategy
+	if weights != nil {
+		cfg.selectionWeights = weights
+	}
+	return nil
+}
+
+// newSelector creates a session selector using the configured strategy
+func (cfg *BroadcastConfig) newSelector(stakeRdr stakeReader) BroadcastSessionsSelector {
+	strategy, weights := cfg.SelectionStrategy()
+	if strategy == SelectionWeighted {
+		return NewWeightedSelector(stakeRdr, weights)
+	}
+	return NewMinLSSelector(stakeRdr, 1.0)
+}
+
 type BroadcastSessionsManager struct {
 	// Accessing or changing any of the below requires ownership of this mutex
 	sessLock *sync.Mutex
@@ -53,8 +108,9 @@ type BroadcastSessionsManager struct {
 	sessMap  map[string]*BroadcastSession
 	numOrchs int // how many orchs to request at once
 
-	refreshing bool // only allow one refresh in-flight
-	finished   bool // set at stream end
+	refreshing bool   // only allow one refresh in-flight
+	finished   bool   // set at stream end
+	lastOrch   string // orchestrator of the last transcoded segment
 
 	createSessions func() ([]*BroadcastSession, error)
 }
@@ -92,6 +148,30 @@ func (bsm *BroadcastSessionsManager) selectSession() *BroadcastSession {
 	return nil
 }
 
+// selectSessions returns up to n distinct sessions to send a segment to
+func (bsm *BroadcastSessionsManager) selectSessions(n int) []*BroadcastSession {
+	var sessions []*BroadcastSession
+	for i := 0; i < n; i++ {
+		sess := bsm.selectSession()
+		if sess == nil {
+			break
+		}
+		sessions = append(sessions, sess)
+	}
+	return sessions
+}
+
+// sessions returns the sessions currently available to the stream
+func (bsm *BroadcastSessionsManager) sessions() []*BroadcastSession {
+	bsm.sessLock.Lock()
+	defer bsm.sessLock.Unlock()
+	sessions := make([]*BroadcastSession, 0, len(bsm.sessMap))
+	for _, sess := range bsm.sessMap {
+		sessions = append(sessions, sess)
+	}
+	return sessions
+}
+
 func (bsm *BroadcastSessionsManager) removeSession(session *BroadcastSession) {
 	bsm.sessLock.Lock()
 	defer bsm.sessLock.Unlock()
@@ -114,6 +194,16 @@ func (bsm *BroadcastSessionsManager) completeSession(sess *BroadcastSession) {
 	}
 }
 
+// switchTo records the session the latest segment was transcoded with,
+// returning the orchestrator used before if it was a different one
+func (bsm *BroadcastSessionsManager) switchTo(sess *BroadcastSession) (string, bool) {
+	bsm.sessLock.Lock()
+	defer bsm.sessLock.Unlock()
+	prev := bsm.lastOrch
+	bsm.lastOrch = sess.OrchestratorInfo.Transcoder
+	return prev, prev != "" && prev != bsm.lastOrch
+}
+
 func (bsm *BroadcastSessionsManager) refreshSessions() {
 
 	glog.V(common.DEBUG).Info("Starting session refresh manifestID=", bsm.mid)
@@ -195,7 +285,8 @@ func selectOrchestrator(n *core.LivepeerNode, params *streamParameters, cpl core
 		return nil, errDiscovery
 	}
 
-	tinfos, err := n.OrchestratorPool.GetOrchestrators(count)
+	tinfos, err := n.OrchestratorPool.GetOrchestrators(count, params.capabilities(cpl.GetOSSession()), params.permitted)
+	tinfos = permittedOrchestrators(tinfos)
 	if len(tinfos) <= 0 {
 		glog.Info("No orchestrators found; not transcoding. Error: ", err)
 		return nil, errNoOrchs
@@ -229,19 +320,23 @@ func selectOrchestrator(n *core.LivepeerNode, params *streamParameters, cpl core
 		if bcastOS.IsExternal() {
 			// Give each O its own OS session to prevent front running uploads
 			pfx := fmt.Sprintf("%v/%v", cpl.ManifestID(), core.RandomManifestID())
-			bcastOS = drivers.NodeStorage.NewSession(pfx)
+			bcastOS = params.storage().NewSession(pfx)
 		}
 
 		session := &BroadcastSession{
 			Broadcaster:      core.NewBroadcaster(n),
 			ManifestID:       params.mid,
 			Profiles:         params.profiles,
+			Format:           params.format,
+			Renditions:       params.renditions,
 			OrchestratorInfo: tinfo,
 			OrchestratorOS:   orchOS,
 			BroadcasterOS:    bcastOS,
 			Sender:           n.Sender,
 			PMSessionID:      sessionID,
 			Balance:          balance,
+			MaxPrice:         params.maxPrice,
+			stats:            params.stats,
 		}
 
 		sessions = append(sessions, session)
@@ -249,33 +344,111 @@ func selectOrchestrator(n *core.LivepeerNode, params *streamParameters, cpl core
 	return sessions, nil
 }
 
+// permittedOrchestrators filters out orchestrators excluded by the access list
+func permittedOrchestrators(tinfos []*net.OrchestratorInfo) []*net.OrchestratorInfo {
+	permitted := tinfos[:0]
+	for _, tinfo := range tinfos {
+		if !OrchAccess.Permitted(tinfo) {
+			glog.V(common.DEBUG).Infof("Skipping orchestrator not permitted by access list orch=%s", tinfo.GetTranscoder())
+			continue
+		}
+		permitted = append(permitted, tinfo)
+	}
+	return permitted
+}
+
+// capabilities returns the capabilities orchestrators need to transcode the
+// stream and upload its renditions to the broadcaster's object store
+func (s *streamParameters) capabilities(bcastOS drivers.OSSession) *net.Capabilities {
+	caps := core.StreamCapabilities(s.profiles, s.format, s.renditions)
+	if bcastOS != nil && bcastOS.IsExternal() {
+		if info := bcastOS.GetInfo(); info != nil {
+			caps.Storage = []net.OSInfo_StorageType{info.StorageType}
+		}
+	}
+	return caps
+}
+
+// permitted checks the orchestrator against the stream's orchestrators and
+// maximum price, for discovery to skip those the stream can't use.
+// Orchestrators without a price are left to payment checks.
+func (s *streamParameters) permitted(tinfo *net.OrchestratorInfo) bool {
+	if len(s.orchestrators) > 0 {
+		found := false
+		for _, key := range orchestratorKeys(tinfo) {
+			found = found || s.orchestrators[key]
+		}
+		if !found {
+			glog.V(common.DEBUG).Infof("Skipping orchestrator not permitted for stream manifestID=%s orch=%s", s.mid, tinfo.GetTranscoder())
+			return false
+		}
+	}
+	if s.maxPrice != nil {
+		price, err := ratPriceInfo(tinfo.GetPriceInfo())
+		if err == nil && price != nil && price.Cmp(s.maxPrice) > 0 {
+			glog.V(common.DEBUG).Infof("Skipping orchestrator above the stream's price manifestID=%s orch=%s", s.mid, tinfo.GetTranscoder())
+			return false
+		}
+	}
+	return true
+}
+
 func processSegment(cxn *rtmpConnection, seg *stream.HLSSegment) ([]string, error) {
+	return processSegmentBody(cxn, seg, nil, 0)
+}
+
+// processSegmentBody is processSegment for a segment whose data is read from
+// body rather than seg.Data, if body is not nil. The body is streamed into
+// the external storage of the stream, which must be a ReaderSession, so the
+// segment is never held in memory; it is then transcoded from its stored
+// copy. size is the length of the body, or -1 if unknown.
+func processSegmentBody(cxn *rtmpConnection, seg *stream.HLSSegment, body *pushBody, size int64) ([]string, error) {
 
 	rtmpStrm := cxn.stream
 	nonce := cxn.nonce
 	cpl := cxn.pl
 	mid := cxn.mid
 	vProfile := cxn.profile
+	stats := cxn.stats()
 
 	glog.V(common.DEBUG).Infof("Processing segment nonce=%d manifestID=%s seqNo=%d dur=%v", nonce, mid, seg.SeqNo, seg.Duration)
 	if monitor.Enabled {
 		monitor.SegmentEmerged(nonce, seg.SeqNo, len(BroadcastJobVideoProfiles))
 	}
+	stats.segmentIngested()
 
+	srcFormat, _ := core.SegmentFormatFromExt(path.Ext(seg.Name))
 	seg.Name = "" // hijack seg.Name to convey the uploaded URI
-	name := fmt.Sprintf("%s/%d.ts", vProfile.Name, seg.SeqNo)
-	uri, err := cpl.GetOSSession().SaveData(name, seg.Data)
+	name := fmt.Sprintf("%s/%d%s", vProfile.Name, seg.SeqNo, srcFormat.MediaExt())
+	var uri, initURI string
+	var err error
+	var srcHash []byte
+	srcSize, srcHead := len(seg.Data), seg.Data
+	if body != nil {
+		uri, err = cpl.GetOSSession().(drivers.ReaderSession).SaveReader(name, body, size)
+		srcHash, srcSize, srcHead = body.Sum(), int(body.n), body.head
+	} else {
+		uri, initURI, err = saveSegment(cpl.GetOSSession(), vProfile.Name, seg.SeqNo, seg.Data, srcFormat)
+	}
 	if err != nil {
 		glog.Errorf("Error saving segment nonce=%d seqNo=%d: %v", nonce, seg.SeqNo, err)
 		if monitor.Enabled {
 			monitor.SegmentUploadFailed(nonce, seg.SeqNo, monitor.SegmentUploadErrorUnknown, err.Error(), true)
 		}
+		stats.segmentFailed(err)
 		return nil, err
 	}
-	if cpl.GetOSSession().IsExternal() {
+	// Fragmented MP4 is stored split, so the orchestrator needs the original
+	if cpl.GetOSSession().IsExternal() && srcFormat == core.FormatMPEGTS {
 		seg.Name = uri // hijack seg.Name to convey the uploaded URI
 	}
-	err = cpl.InsertHLSSegment(vProfile, seg.SeqNo, uri, seg.Duration)
+	if initURI != "" {
+		cpl.SetHLSInitSegment(vProfile, initURI)
+	}
+	recordSegment(cxn, vProfile, seg.SeqNo, uri, initURI, seg.Data, srcFormat, seg.Duration)
+	err = insertSegment(cpl, vProfile, seg.SeqNo, uri, seg.Duration,
+		srcFormat == core.FormatMPEGTS && probeTSKeyframe(srcHead))
+	updateSourceVariant(cxn, seg.Duration, srcSize, srcHead, srcFormat)
 	if monitor.Enabled {
 		monitor.SourceSegmentAppeared(nonce, seg.SeqNo, string(mid), vProfile.Name)
 	}
@@ -286,47 +459,296 @@ func processSegment(cxn *rtmpConnection, seg *stream.HLSSegment) ([]string, erro
 		}
 	}
 
+	policy := Policy
+	if cxn.params != nil {
+		policy = cxn.params.verification
+	}
 	var sv *verification.SegmentVerifier
-	if Policy != nil {
-		sv = verification.NewSegmentVerifier(Policy)
+	if policy != nil {
+		sv = verification.NewSegmentVerifier(policy)
 	}
 
+	// Retry with the next session until an attempt succeeds, attempts run
+	// out or the deadline passes. Attempts still running at the deadline
+	// are abandoned.
+	deadline := segmentDeadline(seg)
+	ctx := context.Background()
+	if !deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
 	for i := 0; i < MaxAttempts; i++ {
-		// if fails, retry; rudimentary
-		if urls, err := transcodeSegment(cxn, seg, name, sv); err == nil {
+		if i > 0 && !deadline.IsZero() && time.Now().After(deadline) {
+			glog.Errorf("Segment retry deadline exceeded nonce=%d manifestID=%s seqNo=%d attempts=%d", nonce, mid, seg.SeqNo, i)
+			if monitor.Enabled {
+				monitor.SegmentTranscodeFailed(monitor.SegmentTranscodeErrorDeadline, nonce, seg.SeqNo, errSegmentDeadline, true)
+			}
+			stats.segmentFailed(errSegmentDeadline)
+			return nil, errSegmentDeadline
+		}
+
+		urls, err := transcodeSegment(ctx, cxn, seg, srcHash, name, sv)
+		if err == nil {
+			if len(urls) > 0 {
+				stats.segmentTranscoded()
+			}
 			return urls, nil
 		}
 
 		if shouldStopStream(err) {
 			glog.Warningf("Stopping current stream due to: %v", err)
+			stats.segmentFailed(err)
 			rtmpStrm.Close()
 			return nil, err
 		}
 
 		// recoverable error, retry
+		glog.Errorf("Transcode attempt failed nonce=%d manifestID=%s seqNo=%d attempt=%d err=%v", nonce, mid, seg.SeqNo, i+1, err)
+	}
+	if monitor.Enabled && MaxAttempts > 0 {
+		monitor.SegmentTranscodeFailed(monitor.SegmentTranscodeErrorMaxAttempts, nonce, seg.SeqNo, errMaxAttempts, true)
+	}
+	stats.segmentFailed(errMaxAttempts)
+	return nil, errMaxAttempts
+}
+
+// segmentDeadline returns the time after which a segment is no longer
+// retried, or zero if the segment has no duration
+func segmentDeadline(seg *stream.HLSSegment) time.Time {
+	if seg.Duration <= 0 || SegmentDeadlineFactor <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(time.Duration(SegmentDeadlineFactor * seg.Duration * float64(time.Second)))
+}
+
+// recordSegment adds a segment, stored for the live stream at uri, to the
+// recording of the stream if any. When the recording goes to the same
+// external store as the live stream, the stored segment is referenced as is.
+// Otherwise a copy is queued, made from data if at hand or else downloaded
+// from uri. Failures don't affect the live stream.
+func recordSegment(cxn *rtmpConnection, profile *ffmpeg.VideoProfile, seqNo uint64, uri, initURI string,
+	data []byte, format core.SegmentFormat, duration float64) {
+
+	if cxn.recorder == nil {
+		return
+	}
+	var err error
+	if cxn.recordInPlace {
+		err = cxn.recorder.InsertSegment(profile, seqNo, uri, initURI, duration)
+	} else {
+		rendition := profile.Name
+		err = cxn.recorder.Record(profile, seqNo, duration, func(sess drivers.OSSession) (string, string, error) {
+			if data == nil {
+				var err error
+				if data, err = drivers.GetSegmentData(uri); err != nil {
+					return "", "", err
+				}
+			}
+			return saveSegment(sess, rendition, seqNo, data, format)
+		})
+	}
+	if err != nil {
+		glog.Errorf("Error recording segment nonce=%d manifestID=%s rendition=%s seqNo=%d err=%v",
+			cxn.nonce, cxn.mid, profile.Name, seqNo, err)
+	}
+}
+
+// updateSourceVariant advertises the source in the master playlist with the
+// bitrate measured from its segments and, for MPEG-TS, the resolution probed
+// from them, since the ingest may not report either. The resolution is
+// probed from the leading data of a segment of the given size, and only
+// until it is found.
+func updateSourceVariant(cxn *rtmpConnection, duration float64, size int, head []byte, format core.SegmentFormat) {
+	var bandwidth uint32
+	if duration > 0 {
+		bandwidth = uint32(float64(size) * 8 / duration)
+	}
+	var resolution string
+	if format == core.FormatMPEGTS && atomic.LoadInt32(&cxn.sourceProbed) == 0 {
+		if resolution = probeTSResolution(head); resolution != "" {
+			atomic.StoreInt32(&cxn.sourceProbed, 1)
+		}
+	}
+	cxn.pl.UpdateHLSVariant(cxn.profile.Name, bandwidth, resolution)
+}
+
+// insertSegment adds a segment to the playlists of the stream. With
+// low-latency HLS, each segment is inserted as a partial segment, which is
+// independent if the segment starts with a keyframe.
+func insertSegment(cpl core.PlaylistManager, profile *ffmpeg.VideoProfile, seqNo uint64, uri string, duration float64,
+	independent bool) error {
+	if cpl.LowLatencyHLS() {
+		return cpl.InsertHLSPart(profile, seqNo, uri, duration, independent)
+	}
+	return cpl.InsertHLSSegment(profile, seqNo, uri, duration)
+}
+
+// saveSegment stores a segment of the given rendition in the OS session.
+// Fragmented MP4 segments are split: the media section is stored as a CMAF
+// fragment and the initialization section is stored separately so it can
+// be referenced via EXT-X-MAP. Returns the URIs of the media segment and of
+// the initialization section, if the segment carried one.
+func saveSegment(sess drivers.OSSession, rendition string, seqNo uint64, data []byte, format core.SegmentFormat) (string, string, error) {
+	if format != core.FormatMP4 {
+		uri, err := sess.SaveData(fmt.Sprintf("%s/%d%s", rendition, seqNo, format.MediaExt()), data)
+		return uri, "", err
+	}
+	initData, media, err := core.SplitFMP4(data)
+	if err != nil {
+		return "", "", err
+	}
+	var initURI string
+	if len(initData) > 0 {
+		// Name the init section by its contents so consecutive segments
+		// carrying the same init share one object
+		name := fmt.Sprintf("%s/init/%x.mp4", rendition, crypto.Keccak256(initData)[:8])
+		if initURI, err = sess.SaveData(name, initData); err != nil {
+			return "", "", err
+		}
 	}
-	return nil, errors.New("Hit max transcode attempts")
+	uri, err := sess.SaveData(fmt.Sprintf("%s/%d%s", rendition, seqNo, format.MediaExt()), media)
+	if err != nil {
+		return "", "", err
+	}
+	return uri, initURI, nil
 }
 
-func transcodeSegment(cxn *rtmpConnection, seg *stream.HLSSegment, name string,
+// transcodeAttempt is the outcome of submitting a segment to one session
+type transcodeAttempt struct {
+	sess *BroadcastSession
+	res  *ReceivedTranscodeResult
+	err  error
+}
+
+func transcodeSegment(ctx context.Context, cxn *rtmpConnection, seg *stream.HLSSegment, srcHash []byte, name string,
 	verifier *verification.SegmentVerifier) ([]string, error) {
 
 	nonce := cxn.nonce
-	cpl := cxn.pl
-	sess := cxn.sessManager.selectSession()
+	sessions := cxn.sessManager.selectSessions(verifier.Redundancy())
 	// Return early under a few circumstances:
 	// View-only (non-transcoded) streams or no sessions available
-	if sess == nil {
+	if len(sessions) == 0 {
 		if monitor.Enabled {
 			monitor.SegmentTranscodeFailed(monitor.SegmentTranscodeErrorNoOrchestrators, nonce, seg.SeqNo, errNoOrchs, true)
 		}
 		glog.Infof("No sessions available for segment nonce=%d manifestID=%s seqNo=%d", nonce, cxn.mid, seg.SeqNo)
+		notifyEvent(EventNoOrchestrators, cxn.mid, map[string]interface{}{"seqNo": seg.SeqNo})
+		cxn.stats().segmentFailed(errNoOrchs)
 		// We may want to introduce a "non-retryable" error type here
 		// would help error propagation for live ingest.
 		// similar to the orchestrator's RemoteTranscoderFatalError
 		return nil, nil
 	}
-	glog.Infof("Trying to transcode segment nonce=%d seqNo=%d", nonce, seg.SeqNo)
+
+	// Send the segment to every session at once
+	attempts := make(chan *transcodeAttempt, len(sessions))
+	for _, sess := range sessions {
+		go func(sess *BroadcastSession) {
+			res, err := submitSegment(ctx, cxn, sess, seg, srcHash, name)
+			attempts <- &transcodeAttempt{sess: sess, res: res, err: err}
+		}(sess)
+	}
+
+	next := func() *transcodeAttempt { return <-attempts }
+	if len(sessions) > 1 && !verifier.ShouldVerify(seg) {
+		// Nothing to verify the results with, so wait for all of them and
+		// go with what most orchestrators agree on
+		all := make([]*transcodeAttempt, 0, len(sessions))
+		for range sessions {
+			all = append(all, <-attempts)
+		}
+		all = majorityFirst(all)
+		next = func() *transcodeAttempt {
+			attempt := all[0]
+			all = all[1:]
+			return attempt
+		}
+	}
+
+	// Take the first result that passes verification
+	var err error
+	for range sessions {
+		attempt := next()
+		if attempt.err != nil {
+			err = attempt.err
+			notifyTranscodeFailed(cxn, seg, attempt.sess, err)
+			continue
+		}
+		urls, verr := processResults(cxn, attempt.sess, seg, attempt.res, verifier)
+		if verr == nil {
+			notifyTranscoded(cxn, seg, attempt.sess, urls)
+			return urls, nil
+		}
+		err = verr
+		notifyTranscodeFailed(cxn, seg, attempt.sess, err)
+	}
+	return nil, err
+}
+
+func notifyTranscoded(cxn *rtmpConnection, seg *stream.HLSSegment, sess *BroadcastSession, urls []string) {
+	orch := sess.OrchestratorInfo.Transcoder
+	if prev, switched := cxn.sessManager.switchTo(sess); switched {
+		notifyEvent(EventSessionSwitched, cxn.mid, map[string]interface{}{
+			"seqNo": seg.SeqNo,
+			"from":  prev,
+			"to":    orch,
+		})
+	}
+	notifyEvent(EventSegmentTranscoded, cxn.mid, map[string]interface{}{
+		"seqNo":        seg.SeqNo,
+		"duration":     seg.Duration,
+		"orchestrator": orch,
+		"renditions":   urls,
+	})
+}
+
+func notifyTranscodeFailed(cxn *rtmpConnection, seg *stream.HLSSegment, sess *BroadcastSession, err error) {
+	cxn.stats().setError(err)
+	notifyEvent(EventTranscodeFailed, cxn.mid, map[string]interface{}{
+		"seqNo":        seg.SeqNo,
+		"orchestrator": sess.OrchestratorInfo.Transcoder,
+		"error":        err.Error(),
+	})
+}
+
+// majorityFirst orders results so those agreeing with the most other
+// results come first and failures come last, keeping arrival order
+// otherwise. Results agree if they report the same pixel counts for every
+// rendition. Renditions from different encoders aren't bit-exact, so this
+// can't compare contents; it only catches results that disagree on frames.
+func majorityFirst(attempts []*transcodeAttempt) []*transcodeAttempt {
+	key := func(attempt *transcodeAttempt) string {
+		if attempt.err != nil {
+			return ""
+		}
+		pixels := []string{"ok"}
+		for _, s := range attempt.res.Segments {
+			pixels = append(pixels, fmt.Sprint(s.Pixels))
+		}
+		return strings.Join(pixels, ",")
+	}
+	votes := make(map[string]int)
+	for _, attempt := range attempts {
+		if attempt.err == nil {
+			votes[key(attempt)]++
+		}
+	}
+	sorted := append([]*transcodeAttempt(nil), attempts...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return votes[key(sorted[i])] > votes[key(sorted[j])]
+	})
+	return sorted
+}
+
+// submitSegment sends the segment to the orchestrator of the session,
+// uploading it to the orchestrator's storage first if needed. Segments
+// streamed into our own storage are downloaded again for the upload.
+func submitSegment(ctx context.Context, cxn *rtmpConnection, sess *BroadcastSession, seg *stream.HLSSegment,
+	srcHash []byte, name string) (*ReceivedTranscodeResult, error) {
+
+	nonce := cxn.nonce
+	glog.Infof("Trying to transcode segment nonce=%d seqNo=%d orch=%s", nonce, seg.SeqNo, sess.OrchestratorInfo.Transcoder)
 	if monitor.Enabled {
 		monitor.TranscodeTry(nonce, seg.SeqNo)
 	}
@@ -334,7 +756,15 @@ func transcodeSegment(cxn *rtmpConnection, seg *stream.HLSSegment, name string,
 	// storage the orchestrator prefers
 	if ios := sess.OrchestratorOS; ios != nil {
 		// XXX handle case when orch expects direct upload
-		uri, err := ios.SaveData(name, seg.Data)
+		data := seg.Data
+		if data == nil && seg.Name != "" {
+			var err error
+			if data, err = drivers.GetSegmentData(seg.Name); err != nil {
+				glog.Errorf("Error downloading segment nonce=%d seqNo=%d: %v", nonce, seg.SeqNo, err)
+				return nil, err
+			}
+		}
+		uri, err := ios.SaveData(name, data)
 		if err != nil {
 			glog.Errorf("Error saving segment to OS nonce=%d seqNo=%d: %v", nonce, seg.SeqNo, err)
 			if monitor.Enabled {
@@ -343,13 +773,22 @@ func transcodeSegment(cxn *rtmpConnection, seg *stream.HLSSegment, name string,
 			cxn.sessManager.removeSession(sess)
 			return nil, err
 		}
-		seg.Name = uri // hijack seg.Name to convey the uploaded URI
+		// Copy the segment, since other orchestrators may be sent the
+		// same one concurrently
+		upload := *seg
+		upload.Name = uri // hijack seg.Name to convey the uploaded URI
+		seg = &upload
 	}
 
 	// send segment to the orchestrator
 	glog.V(common.DEBUG).Infof("Submitting segment nonce=%d manifestID=%s seqNo=%d orch=%s", nonce, cxn.mid, seg.SeqNo, sess.OrchestratorInfo.Transcoder)
 
-	res, err := SubmitSegment(sess, seg, nonce)
+	res, err := SubmitSegment(ctx, sess, seg, srcHash, nonce)
+	if err != nil && ctx.Err() != nil {
+		// We gave up on the segment ourselves, so keep the session
+		cxn.sessManager.completeSession(sess)
+		return nil, err
+	}
 	if err != nil || res == nil {
 		cxn.sessManager.removeSession(sess)
 		if res == nil && err == nil {
@@ -359,6 +798,16 @@ func transcodeSegment(cxn *rtmpConnection, seg *stream.HLSSegment, name string,
 	}
 
 	cxn.sessManager.completeSession(updateSession(sess, res))
+	return res, nil
+}
+
+// processResults downloads the transcoded renditions of a session into our
+// own storage, verifies them and inserts them into the playlists
+func processResults(cxn *rtmpConnection, sess *BroadcastSession, seg *stream.HLSSegment,
+	res *ReceivedTranscodeResult, verifier *verification.SegmentVerifier) ([]string, error) {
+
+	nonce := cxn.nonce
+	cpl := cxn.pl
 
 	// download transcoded segments from the transcoder
 	gotErr := false // only send one error msg per segment list
@@ -376,6 +825,8 @@ func transcodeSegment(cxn *rtmpConnection, seg *stream.HLSSegment, name string,
 	segHashes := make([][]byte, len(res.Segments))
 	n := len(res.Segments)
 	segURLs := make([]string, len(res.Segments))
+	initURLs := make([]string, len(res.Segments))
+	segData := make([][]byte, len(res.Segments))
 	segHashLock := &sync.Mutex{}
 	cond := sync.NewCond(segHashLock)
 
@@ -389,7 +840,11 @@ func transcodeSegment(cxn *rtmpConnection, seg *stream.HLSSegment, name string,
 			cond.L.Unlock()
 		}()
 
-		if bos := sess.BroadcasterOS; bos != nil && !drivers.IsOwnExternal(url) {
+		// Fragmented MP4 needs to be split locally, and thumbnail indexes
+		// need a copy of the data, even if already in our OS
+		thumbnail := sess.Renditions.IsThumbnail(sess.Profiles[i].Name)
+		mustDownload := sess.Format == core.FormatMP4 || thumbnail
+		if bos := sess.BroadcasterOS; bos != nil && (!drivers.IsOwnExternal(url) || mustDownload) {
 			data, err := drivers.GetSegmentData(url)
 			if err != nil {
 				errFunc(monitor.SegmentTranscodeErrorDownload, url, err)
@@ -399,24 +854,30 @@ func transcodeSegment(cxn *rtmpConnection, seg *stream.HLSSegment, name string,
 				cxn.sessManager.removeSession(sess)
 				return
 			}
-			name := fmt.Sprintf("%s/%d.ts", sess.Profiles[i].Name, seg.SeqNo)
-			newURL, err := bos.SaveData(name, data)
-			if err != nil {
-				segHashLock.Lock()
-				segHashLock.Unlock()
-				switch err.Error() {
-				case "Session ended":
-					errFunc(monitor.SegmentTranscodeErrorSessionEnded, url, err)
-				default:
-					errFunc(monitor.SegmentTranscodeErrorSaveData, url, err)
+			// Thumbnail images are saved once they're added to the index
+			var initURL string
+			if !thumbnail {
+				var newURL string
+				newURL, initURL, err = saveSegment(bos, sess.Profiles[i].Name, seg.SeqNo, data, sess.Format)
+				if err != nil {
+					segHashLock.Lock()
+					segHashLock.Unlock()
+					switch err.Error() {
+					case "Session ended":
+						errFunc(monitor.SegmentTranscodeErrorSessionEnded, url, err)
+					default:
+						errFunc(monitor.SegmentTranscodeErrorSaveData, url, err)
+					}
+					return
 				}
-				return
+				url = newURL
 			}
-			url = newURL
 
 			hash := crypto.Keccak256(data)
 			segHashLock.Lock()
 			segHashes[i] = hash
+			initURLs[i] = initURL
+			segData[i] = data
 			segHashLock.Unlock()
 		}
 
@@ -457,7 +918,22 @@ func transcodeSegment(cxn *rtmpConnection, seg *stream.HLSSegment, name string,
 	}
 
 	for i, url := range segURLs {
-		err = cpl.InsertHLSSegment(&sess.Profiles[i], seg.SeqNo, url, seg.Duration)
+		if sess.Renditions.IsThumbnail(sess.Profiles[i].Name) {
+			if segData[i] == nil {
+				continue
+			}
+			if err := cpl.InsertThumbnail(&sess.Profiles[i], seg.SeqNo, segData[i], seg.Duration); err != nil {
+				glog.Errorf("Thumbnail insertion error nonce=%d manifestID=%s rendition=%s seqNo=%d err=%s",
+					nonce, cxn.mid, sess.Profiles[i].Name, seg.SeqNo, err)
+			}
+			continue
+		}
+		if initURLs[i] != "" {
+			cpl.SetHLSInitSegment(&sess.Profiles[i], initURLs[i])
+		}
+		recordSegment(cxn, &sess.Profiles[i], seg.SeqNo, url, initURLs[i], segData[i], sess.Format, seg.Duration)
+		// Transcoders encode every segment from a keyframe
+		err := insertSegment(cpl, &sess.Profiles[i], seg.SeqNo, url, seg.Duration, true)
 		if err != nil {
 			// InsertHLSSegment only returns ErrSegmentAlreadyExists error
 			// Right now InsertHLSSegment call is atomic regarding transcoded segments - we either inserting
@@ -478,7 +954,7 @@ func transcodeSegment(cxn *rtmpConnection, seg *stream.HLSSegment, name string,
 	return segURLs, nil
 }
 
-var sessionErrStrings = []string{"dial tcp", "unexpected EOF", core.ErrOrchBusy.Error(), core.ErrOrchCap.Error()}
+var sessionErrStrings = []string{"dial tcp", "unexpected EOF", core.ErrOrchBusy.Error(), core.ErrOrchCap.Error(), core.ErrOrchOverloaded.Error()}
 
 var sessionErrRegex = common.GenErrRegex(sessionErrStrings)
 
@@ -507,9 +983,9 @@ func verify(verifier *verification.SegmentVerifier, cxn *rtmpConnection,
 		if err != nil {
 			return err // Implies this is retryable?
 		}
-		memOS, ok := sess.BroadcasterOS.(*drivers.MemorySession)
+		localOS, ok := sess.BroadcasterOS.(drivers.LocalSession)
 		if !uri.IsAbs() && ok {
-			data := memOS.GetData(fname)
+			data := localOS.GetData(fname)
 			if data == nil {
 				return errors.New("Missing Local Data")
 			}
@@ -535,9 +1011,11 @@ func verify(verifier *verification.SegmentVerifier, cxn *rtmpConnection,
 	accepted, err := verifier.Verify(params)
 	if verification.IsRetryable(err) {
 		// If retryable, means tampering was detected from this O
-		// Remove the O from the working set for now
+		// Remove the O from the working set for now, and keep it out of
+		// new sessions for a while
 		// Error falls through towards end if necessary
 		cxn.sessManager.removeSession(sess)
+		OrchAccess.Ban(sess.OrchestratorInfo, err.Error())
 	}
 	if accepted != nil {
 		// The returned set of results has been accepted by the verifier
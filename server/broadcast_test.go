@@ -1,11 +1,15 @@
 package server
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math/big"
 	"net/http"
+	"net/http/httptest"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -112,6 +116,7 @@ type stubPlaylistManager struct {
 	seq        uint64
 	profile    ffmpeg.VideoProfile
 	uri        string
+	initURI    string
 	os         drivers.OSSession
 }
 
@@ -126,14 +131,50 @@ func (pm *stubPlaylistManager) InsertHLSSegment(profile *ffmpeg.VideoProfile, se
 	return nil
 }
 
+func (pm *stubPlaylistManager) SetHLSInitSegment(profile *ffmpeg.VideoProfile, uri string) {
+	pm.initURI = uri
+}
+
+func (pm *stubPlaylistManager) LowLatencyHLS() bool {
+	return false
+}
+
+func (pm *stubPlaylistManager) InsertHLSPart(profile *ffmpeg.VideoProfile, seqNo uint64, uri string, duration float64,
+	independent bool) error {
+	return core.ErrLLHLSDisabled
+}
+
+func (pm *stubPlaylistManager) GetLLHLSMediaPlaylist(ctx context.Context, rendition string, req core.LLHLSRequest) ([]byte, error) {
+	return nil, core.ErrLLHLSDisabled
+}
+
+func (pm *stubPlaylistManager) GetLLHLSPart(ctx context.Context, rendition string, msn, part uint64) (string, error) {
+	return "", core.ErrLLHLSDisabled
+}
+
 func (pm *stubPlaylistManager) GetHLSMasterPlaylist() *m3u8.MasterPlaylist {
 	return nil
 }
 
+func (pm *stubPlaylistManager) UpdateHLSVariant(rendition string, bandwidth uint32, resolution string) {
+}
+
 func (pm *stubPlaylistManager) GetHLSMediaPlaylist(rendition string) *m3u8.MediaPlaylist {
 	return nil
 }
 
+func (pm *stubPlaylistManager) GetDASHManifest() *core.MPD {
+	return nil
+}
+
+func (pm *stubPlaylistManager) InsertThumbnail(profile *ffmpeg.VideoProfile, seqNo uint64, data []byte, duration float64) error {
+	return nil
+}
+
+func (pm *stubPlaylistManager) GetThumbnailIndex(rendition string) *core.ThumbnailIndex {
+	return nil
+}
+
 func (pm *stubPlaylistManager) GetOSSession() drivers.OSSession {
 	return pm.os
 }
@@ -500,7 +541,7 @@ func TestTranscodeSegment_CompleteSession(t *testing.T) {
 		sessManager: bsm,
 	}
 
-	_, err = transcodeSegment(cxn, &stream.HLSSegment{Data: []byte("dummy"), Duration: 2.0}, "dummy", nil)
+	_, err = transcodeSegment(context.Background(), cxn, &stream.HLSSegment{Data: []byte("dummy"), Duration: 2.0}, nil, "dummy", nil)
 	assert.Nil(err)
 
 	completedSess := bsm.sessMap[ts.URL]
@@ -517,7 +558,7 @@ func TestTranscodeSegment_CompleteSession(t *testing.T) {
 	buf, err = proto.Marshal(tr)
 	require.Nil(err)
 
-	_, err = transcodeSegment(cxn, &stream.HLSSegment{Data: []byte("dummy"), Duration: 2.0}, "dummy", nil)
+	_, err = transcodeSegment(context.Background(), cxn, &stream.HLSSegment{Data: []byte("dummy"), Duration: 2.0}, nil, "dummy", nil)
 	assert.Nil(err)
 
 	// Check that BroadcastSession.OrchestratorInfo was updated
@@ -590,6 +631,125 @@ func TestProcessSegment_MaxAttempts(t *testing.T) {
 	assert.Len(bsm.sessMap, 0)
 }
 
+func TestProcessSegment_SourceVariant(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	s := setupServer()
+	defer serverCleanup(s)
+	defer func() { SourceVariant = true }()
+
+	data := testTSStream(testFrames(0, 60))
+	newCxn := func(mid core.ManifestID) *rtmpConnection {
+		cxn, err := s.registerConnection(stream.NewBasicRTMPVideoStream(&streamParameters{mid: mid}))
+		require.Nil(err)
+		// No orchestrators are available
+		cxn.sessManager = bsmWithSessList(nil)
+		_, err = processSegment(cxn, &stream.HLSSegment{Name: "0.ts", Data: data, Duration: 2})
+		require.Nil(err)
+		return cxn
+	}
+
+	// The source is listed with its measured bitrate and probed resolution
+	cxn := newCxn("source_listed")
+	variants := cxn.pl.GetHLSMasterPlaylist().Variants
+	require.Len(variants, 1)
+	assert.Equal("source_listed/source.m3u8", variants[0].URI)
+	assert.Equal(uint32(len(data)*8/2), variants[0].Bandwidth)
+	assert.Equal("1280x720", variants[0].Resolution)
+
+	// The resolution is only probed once
+	cxn.pl.UpdateHLSVariant("source", 0, "640x360")
+	_, err := processSegment(cxn, &stream.HLSSegment{SeqNo: 1, Name: "1.ts", Data: data, Duration: 2})
+	require.Nil(err)
+	assert.Equal("640x360", cxn.pl.GetHLSMasterPlaylist().Variants[0].Resolution)
+
+	// Unlisted sources are still served
+	SourceVariant = false
+	cxn = newCxn("source_unlisted")
+	assert.Len(cxn.pl.GetHLSMasterPlaylist().Variants, 0)
+	assert.NotNil(cxn.pl.GetHLSMediaPlaylist("source"))
+}
+
+func TestProcessSegment_Deadline(t *testing.T) {
+	assert := assert.New(t)
+
+	oldAttempts := MaxAttempts
+	oldFactor := SegmentDeadlineFactor
+	defer func() {
+		MaxAttempts = oldAttempts
+		SegmentDeadlineFactor = oldFactor
+	}()
+	MaxAttempts = 5
+
+	var mu sync.Mutex
+	transcodeCalls := 0
+	resp := func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		transcodeCalls++
+		mu.Unlock()
+		time.Sleep(150 * time.Millisecond)
+		w.WriteHeader(http.StatusNotFound)
+	}
+	seg := &stream.HLSSegment{Duration: 0.1}
+
+	var servers []*httptest.Server
+	defer func() {
+		for _, ts := range servers {
+			ts.Close()
+		}
+	}()
+	cxnWithSessions := func() *rtmpConnection {
+		var sessList []*BroadcastSession
+		for i := 0; i < MaxAttempts; i++ {
+			ts, mux := stubTLSServer()
+			mux.HandleFunc("/segment", resp)
+			servers = append(servers, ts)
+			sessList = append(sessList, StubBroadcastSession(ts.URL))
+		}
+		return &rtmpConnection{
+			profile:     &ffmpeg.VideoProfile{Name: "unused"},
+			sessManager: bsmWithSessList(sessList),
+			pl:          &stubPlaylistManager{os: &stubOSSession{}},
+		}
+	}
+
+	// Deadline is 200ms; the second attempt ends past it
+	SegmentDeadlineFactor = 2
+	_, err := processSegment(cxnWithSessions(), seg)
+	assert.Equal(errSegmentDeadline, err)
+	assert.Equal(2, transcodeCalls)
+
+	// No deadline; all attempts are used
+	transcodeCalls = 0
+	SegmentDeadlineFactor = 0
+	_, err = processSegment(cxnWithSessions(), seg)
+	assert.Equal(errMaxAttempts, err)
+	assert.Equal(MaxAttempts, transcodeCalls)
+
+	// Attempts still running at the deadline are abandoned
+	transcodeCalls = 0
+	SegmentDeadlineFactor = 2
+	hang := make(chan struct{})
+	resp = func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		transcodeCalls++
+		mu.Unlock()
+		select {
+		case <-hang:
+		case <-r.Context().Done():
+		}
+	}
+	start := time.Now()
+	cxn := cxnWithSessions()
+	_, err = processSegment(cxn, seg)
+	close(hang)
+	assert.Equal(errSegmentDeadline, err)
+	assert.Equal(1, transcodeCalls)
+	assert.True(time.Since(start) < time.Second)
+	// The orchestrator isn't to blame for the deadline
+	assert.Len(cxn.sessManager.sessions(), MaxAttempts)
+}
+
 func TestTranscodeSegment_VerifyPixels(t *testing.T) {
 	require := require.New(t)
 	assert := assert.New(t)
@@ -632,7 +792,7 @@ func TestTranscodeSegment_VerifyPixels(t *testing.T) {
 		sessManager: bsm,
 	}
 
-	urls, err := transcodeSegment(cxn, &stream.HLSSegment{Data: []byte("dummy")}, "dummy", nil)
+	urls, err := transcodeSegment(context.Background(), cxn, &stream.HLSSegment{Data: []byte("dummy")}, nil, "dummy", nil)
 	assert.Nil(err)
 	assert.NotNil(urls)
 	assert.Len(urls, 1)
@@ -650,7 +810,7 @@ func TestTranscodeSegment_VerifyPixels(t *testing.T) {
 	bsm = bsmWithSessList([]*BroadcastSession{sess})
 	cxn.sessManager = bsm
 
-	urls, err = transcodeSegment(cxn, &stream.HLSSegment{Data: []byte("dummy")}, "dummy", nil)
+	urls, err = transcodeSegment(context.Background(), cxn, &stream.HLSSegment{Data: []byte("dummy")}, nil, "dummy", nil)
 	assert.Nil(err)
 	assert.Equal("test.flv", urls[0])
 
@@ -660,7 +820,7 @@ func TestTranscodeSegment_VerifyPixels(t *testing.T) {
 	bsm = bsmWithSessList([]*BroadcastSession{sess})
 	cxn.sessManager = bsm
 
-	_, err = transcodeSegment(cxn, &stream.HLSSegment{Data: []byte("dummy")}, "dummy", nil)
+	_, err = transcodeSegment(context.Background(), cxn, &stream.HLSSegment{Data: []byte("dummy")}, nil, "dummy", nil)
 	assert.Nil(err)
 
 	// Wait for async pixels verification to finish
@@ -771,7 +931,7 @@ func TestHLSInsertion(t *testing.T) {
 	}
 
 	seg := &stream.HLSSegment{SeqNo: 93}
-	_, err = transcodeSegment(cxn, seg, "dummy", nil)
+	_, err = transcodeSegment(context.Background(), cxn, seg, nil, "dummy", nil)
 	assert.Nil(err)
 
 	// some sanity checks
@@ -823,29 +983,29 @@ func TestVerifier_Invocation(t *testing.T) {
 	}
 
 	seg := &stream.HLSSegment{}
-	_, err = transcodeSegment(cxn, seg, "dummy", segmentVerifier)
+	_, err = transcodeSegment(context.Background(), cxn, seg, nil, "dummy", segmentVerifier)
 	assert.Nil(err)
 	assert.Equal(1, verifier.calls)
 	require.NotNil(verifier.params)
 	assert.Equal(cxn.mid, verifier.params.ManifestID)
 	assert.Equal(seg, verifier.params.Source)
 	// Do it again for good measure
-	_, err = transcodeSegment(cxn, seg, "dummy", segmentVerifier)
+	_, err = transcodeSegment(context.Background(), cxn, seg, nil, "dummy", segmentVerifier)
 	assert.Nil(err)
 	assert.Equal(2, verifier.calls)
 
 	// now "disable" the verifier and ensure no calls
-	_, err = transcodeSegment(cxn, seg, "dummy", nil)
+	_, err = transcodeSegment(context.Background(), cxn, seg, nil, "dummy", nil)
 	assert.Nil(err)
 	assert.Equal(2, verifier.calls)
 
 	// Pass in a nil policy
-	_, err = transcodeSegment(cxn, seg, "dummy", verification.NewSegmentVerifier(nil))
+	_, err = transcodeSegment(context.Background(), cxn, seg, nil, "dummy", verification.NewSegmentVerifier(nil))
 	assert.Nil(err)
 
 	// Pass in a policy but no verifier specified
 	policy = &verification.Policy{}
-	_, err = transcodeSegment(cxn, seg, "dummy", verification.NewSegmentVerifier(policy))
+	_, err = transcodeSegment(context.Background(), cxn, seg, nil, "dummy", verification.NewSegmentVerifier(policy))
 	assert.Nil(err)
 }
 
@@ -902,6 +1062,11 @@ func TestVerifier_Verify(t *testing.T) {
 	assert.Len(bsm.sessMap, 1) // No effect on map for now
 
 	// Check retryable errors, esp broadcast session removal from manager
+	// and banning the orchestrator
+	defer func(l *OrchAccessList) { OrchAccess = l }(OrchAccess)
+	OrchAccess, err = NewOrchAccessList(newStubOrchAccessStore())
+	require.Nil(t, err)
+	assert.True(OrchAccess.Permitted(sess.OrchestratorInfo))
 	sv.err = verification.ErrTampered
 	sv.retries = 10 // Do this to ensure we get a nil result
 	_, retryable := sv.err.(verification.Retryable)
@@ -912,6 +1077,8 @@ func TestVerifier_Verify(t *testing.T) {
 	assert.Equal(2, sv.calls)
 	assert.Equal(sv.err, err)
 	assert.Len(bsm.sessMap, 0)
+	assert.False(OrchAccess.Permitted(sess.OrchestratorInfo))
+	OrchAccess = nil
 
 	// When retries are set to 0, results are returned anyway in case of error
 	// (and more generally, when attempts > retries)
@@ -1021,15 +1188,228 @@ func TestVerifier_HLSInsertion(t *testing.T) {
 		},
 	})
 
-	_, err := transcodeSegment(cxn, seg, "dummy", verifier)
+	_, err := transcodeSegment(context.Background(), cxn, seg, nil, "dummy", verifier)
 	assert.Equal(verification.ErrTampered, err)
 	assert.Empty(pl.uri) // sanity check that no insertion happened
 
-	_, err = transcodeSegment(cxn, seg, "dummy", verifier)
+	_, err = transcodeSegment(context.Background(), cxn, seg, nil, "dummy", verifier)
 	assert.Equal(verification.ErrTampered, err)
 	assert.Empty(pl.uri)
 
-	_, err = transcodeSegment(cxn, seg, "dummy", verifier)
+	_, err = transcodeSegment(context.Background(), cxn, seg, nil, "dummy", verifier)
 	assert.Nil(err)
 	assert.Equal(baseURL+"/resp2", pl.uri)
 }
+
+func TestTranscodeSegment_Redundancy(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	mid := core.ManifestID("foo")
+	drivers.S3BUCKET = "livepeer"
+	defer func() { drivers.S3BUCKET = "" }()
+	bos := drivers.NewS3Driver("", drivers.S3BUCKET, "", "").NewSession(string(mid))
+	baseURL := "https://livepeer.s3.amazonaws.com"
+	var servers []*httptest.Server
+	defer func() {
+		for _, ts := range servers {
+			ts.Close()
+		}
+	}()
+	genBcastSess := func(url string, pixels int64, calls *int32) *BroadcastSession {
+		buf, err := proto.Marshal(&net.TranscodeResult{
+			Result: &net.TranscodeResult_Data{
+				Data: &net.TranscodeData{Segments: []*net.TranscodedSegmentData{{Url: url, Pixels: pixels}}},
+			},
+		})
+		require.Nil(err)
+		ts, mux := stubTLSServer()
+		servers = append(servers, ts)
+		mux.HandleFunc("/segment", func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(calls, 1)
+			w.WriteHeader(http.StatusOK)
+			w.Write(buf)
+		})
+		return &BroadcastSession{
+			Broadcaster:      stubBroadcaster2(),
+			ManifestID:       mid,
+			Profiles:         []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9},
+			BroadcasterOS:    bos,
+			OrchestratorInfo: &net.OrchestratorInfo{Transcoder: ts.URL},
+		}
+	}
+	newCxn := func() (*rtmpConnection, *stubPlaylistManager, *int32) {
+		calls := new(int32)
+		pl := &stubPlaylistManager{manifestID: mid}
+		bsm := bsmWithSessList([]*BroadcastSession{
+			genBcastSess(baseURL+"/resp1", 100, calls),
+			genBcastSess(baseURL+"/resp2", 200, calls),
+			genBcastSess(baseURL+"/resp3", 200, calls),
+		})
+		return &rtmpConnection{mid: mid, pl: pl, profile: &ffmpeg.P240p30fps16x9, sessManager: bsm}, pl, calls
+	}
+
+	// Results agreeing with the majority are used if not verifying
+	policy := &verification.Policy{Redundancy: 3, SampleRate: verification.SampleRate(0)}
+	seg := &stream.HLSSegment{Data: []byte("dummy")}
+	require.False(policy.ShouldVerify(seg))
+	cxn, pl, calls := newCxn()
+	_, err := transcodeSegment(context.Background(), cxn, seg, nil, "dummy", verification.NewSegmentVerifier(policy))
+	assert.Nil(err)
+	assert.Equal(int32(3), atomic.LoadInt32(calls))
+	assert.Contains([]string{baseURL + "/resp2", baseURL + "/resp3"}, pl.uri)
+	assert.Len(cxn.sessManager.sessMap, 3)
+
+	// The first result passing verification is used otherwise
+	sv := &stubVerifier{
+		err:     verification.ErrTampered,
+		retries: 5,
+	}
+	policy = &verification.Policy{Redundancy: 3, Verifier: sv, Retries: sv.retries}
+	cxn, pl, calls = newCxn()
+	_, err = transcodeSegment(context.Background(), cxn, seg, nil, "dummy", verification.NewSegmentVerifier(policy))
+	// all results failed verification
+	assert.Equal(verification.ErrTampered, err)
+	assert.Equal(int32(3), atomic.LoadInt32(calls))
+	assert.Equal(3, sv.calls)
+	assert.Empty(pl.uri)
+	assert.Len(cxn.sessManager.sessMap, 0)
+
+	sv.err = nil
+	sv.calls = 0
+	cxn, pl, _ = newCxn()
+	_, err = transcodeSegment(context.Background(), cxn, seg, nil, "dummy", verification.NewSegmentVerifier(policy))
+	assert.Nil(err)
+	assert.Equal(1, sv.calls)
+	assert.NotEmpty(pl.uri)
+
+	// Fewer sessions than the redundancy
+	cxn, _, calls = newCxn()
+	assert.Len(cxn.sessManager.selectSessions(2), 2)
+	_, err = transcodeSegment(context.Background(), cxn, seg, nil, "dummy", verification.NewSegmentVerifier(policy))
+	assert.Nil(err)
+	assert.Equal(int32(1), atomic.LoadInt32(calls))
+}
+
+func TestStreamVerificationPolicy(t *testing.T) {
+	assert := assert.New(t)
+	defer func(p *verification.Policy) { Policy = p }(Policy)
+
+	Policy = nil
+	assert.Nil(streamVerificationPolicy(nil))
+	assert.Nil(streamVerificationPolicy(&authWebhookResponse{}))
+
+	// Overrides create a policy if the node doesn't have one
+	resp := &authWebhookResponse{}
+	assert.Nil(json.Unmarshal([]byte(`{"verification":{"redundancy":2,"sampleRate":0.5}}`), resp))
+	policy := streamVerificationPolicy(resp)
+	assert.Equal(&verification.Policy{Retries: 2, Redundancy: 2, SampleRate: verification.SampleRate(0.5)}, policy)
+
+	// Node policy is used as the base, without being modified
+	verifier := &stubVerifier{}
+	Policy = &verification.Policy{Verifier: verifier, Retries: 3, Redundancy: 1, SampleRate: verification.SampleRate(1)}
+	assert.Equal(Policy, streamVerificationPolicy(nil))
+	policy = streamVerificationPolicy(resp)
+	assert.Equal(&verification.Policy{Verifier: verifier, Retries: 3, Redundancy: 2, SampleRate: verification.SampleRate(0.5)}, policy)
+	assert.Equal(1, Policy.Redundancy)
+	assert.Equal(1.0, *Policy.SampleRate)
+	resp.Verification.Redundancy = 0
+	assert.Equal(1, streamVerificationPolicy(resp).Redundancy)
+
+	// Streams can opt out of verification with a zero sample rate, while
+	// an omitted rate keeps the node's
+	resp = &authWebhookResponse{}
+	assert.Nil(json.Unmarshal([]byte(`{"verification":{"sampleRate":0}}`), resp))
+	policy = streamVerificationPolicy(resp)
+	assert.Equal(0.0, *policy.SampleRate)
+	assert.False(policy.ShouldVerify(&stream.HLSSegment{Data: []byte("abc")}))
+	resp = &authWebhookResponse{}
+	assert.Nil(json.Unmarshal([]byte(`{"verification":{"redundancy":2}}`), resp))
+	assert.Equal(1.0, *streamVerificationPolicy(resp).SampleRate)
+}
+
+func TestSaveSegment(t *testing.T) {
+	assert := assert.New(t)
+	mem, ok := drivers.NewMemoryDriver(nil).NewSession("streamName").(*drivers.MemorySession)
+	require.True(t, ok)
+
+	// mpegts is stored as-is
+	uri, initURI, err := saveSegment(mem, "P144p30fps16x9", 1, []byte("ts data"), core.FormatMPEGTS)
+	assert.Nil(err)
+	assert.Equal("/stream/streamName/P144p30fps16x9/1.ts", uri)
+	assert.Empty(initURI)
+	assert.Equal([]byte("ts data"), mem.GetData(uri))
+
+	// fragmented mp4 is split into init and media sections
+	box := func(typ string) []byte {
+		return append([]byte{0, 0, 0, 12}, []byte(typ+"data")...)
+	}
+	initData := append(box("ftyp"), box("moov")...)
+	media := append(box("moof"), box("mdat")...)
+	uri, initURI, err = saveSegment(mem, "P144p30fps16x9", 2, append(initData, media...), core.FormatMP4)
+	assert.Nil(err)
+	assert.Equal("/stream/streamName/P144p30fps16x9/2.m4s", uri)
+	assert.Contains(initURI, "/stream/streamName/P144p30fps16x9/init/")
+	assert.Equal(media, mem.GetData(uri))
+	assert.Equal(initData, mem.GetData(initURI))
+
+	// identical init sections map to the same object
+	_, initURI2, err := saveSegment(mem, "P144p30fps16x9", 3, append(initData, media...), core.FormatMP4)
+	assert.Nil(err)
+	assert.Equal(initURI, initURI2)
+
+	// media-only fragments have no init
+	_, initURI, err = saveSegment(mem, "P144p30fps16x9", 4, media, core.FormatMP4)
+	assert.Nil(err)
+	assert.Empty(initURI)
+
+	// malformed mp4
+	_, _, err = saveSegment(mem, "P144p30fps16x9", 5, []byte("bad"), core.FormatMP4)
+	assert.Equal(core.ErrMalformedMP4, err)
+}
+
+func TestRecordSegment(t *testing.T) {
+	assert := assert.New(t)
+	profile := &ffmpeg.P144p30fps16x9
+
+	// no-op without a recorder
+	cxn := &rtmpConnection{mid: "rec"}
+	recordSegment(cxn, profile, 0, "", "", []byte("ts data"), core.FormatMPEGTS, 2)
+
+	mem, ok := drivers.NewMemoryDriver(nil).NewSession("rec/abc").(*drivers.MemorySession)
+	require.True(t, ok)
+	cxn.recorder = core.NewStreamRecorder(cxn.mid, mem)
+	recordSegment(cxn, profile, 0, "", "", []byte("ts data"), core.FormatMPEGTS, 2)
+
+	// malformed data is not recorded
+	recordSegment(cxn, profile, 1, "", "", []byte("bad"), core.FormatMP4, 2)
+
+	// segments not at hand are fetched from the live stream's store
+	live := drivers.NewMemoryDriver(nil).NewSession("live")
+	uri, err := live.SaveData("P144p30fps16x9/2.ts", []byte("stored data"))
+	require.Nil(t, err)
+	recordSegment(cxn, profile, 2, uri, "", nil, core.FormatMPEGTS, 2)
+
+	uri, err = cxn.recorder.Finalize()
+	require.Nil(t, err)
+	assert.Equal([]byte("ts data"), mem.GetData("/stream/rec/abc/P144p30fps16x9/0.ts"))
+	assert.Equal([]byte("stored data"), mem.GetData("/stream/rec/abc/P144p30fps16x9/2.ts"))
+	mpl := string(mem.GetData("/stream/rec/abc/P144p30fps16x9.m3u8"))
+	assert.Contains(mpl, "/stream/rec/abc/P144p30fps16x9/0.ts")
+	assert.Contains(mpl, "/stream/rec/abc/P144p30fps16x9/2.ts")
+	assert.NotContains(mpl, "1.m4s")
+	assert.Contains(string(mem.GetData(uri)), "P144p30fps16x9.m3u8")
+
+	// recordings sharing the live stream's store reference its segments
+	mem, ok = drivers.NewMemoryDriver(nil).NewSession("rec/def").(*drivers.MemorySession)
+	require.True(t, ok)
+	cxn.recorder = core.NewStreamRecorder(cxn.mid, mem)
+	cxn.recordInPlace = true
+	recordSegment(cxn, profile, 0, "https://bucket/live/0.m4s", "https://bucket/live/init/abc.mp4", []byte("data"), core.FormatMP4, 2)
+	_, err = cxn.recorder.Finalize()
+	require.Nil(t, err)
+	assert.Nil(mem.GetData("/stream/rec/def/P144p30fps16x9/0.m4s"))
+	mpl = string(mem.GetData("/stream/rec/def/P144p30fps16x9.m3u8"))
+	assert.Contains(mpl, "https://bucket/live/0.m4s")
+	assert.Contains(mpl, `#EXT-X-MAP:URI="https://bucket/live/init/abc.mp4"`)
+}
@@ -0,0 +1,227 @@
+package server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/monitor"
+)
+
+// Stream lifecycle events sent to the event webhook
+const (
+	EventStreamStarted     = "stream.started"
+	EventStreamEnded       = "stream.ended"
+	EventSegmentTranscoded = "segment.transcoded"
+	EventTranscodeFailed   = "transcode.failed"
+	EventSessionSwitched   = "session.switched"
+	EventNoOrchestrators   = "orchestrators.unavailable"
+)
+
+const (
+	eventSignatureHeader = "Livepeer-Signature"
+	eventTypeHeader      = "Livepeer-Event"
+	eventQueueSize       = 256
+	eventWorkers         = 16
+)
+
+// Events, if set, delivers stream lifecycle events to a webhook
+var Events *EventWebhook
+
+// streamEvent is the JSON body of an event webhook call
+type streamEvent struct {
+	ID         string                 `json:"id"`
+	Type       string                 `json:"type"`
+	Timestamp  int64                  `json:"timestamp"`
+	ManifestID core.ManifestID        `json:"manifestID"`
+	Data       map[string]interface{} `json:"data,omitempty"`
+}
+
+// EventWebhook POSTs stream lifecycle events to a URL. Each stream has its
+// own queue, so events of a stream are delivered in order while a stream
+// whose deliveries are being retried doesn't hold up the others. Failed
+// deliveries are retried with exponential backoff. If a secret is set, each
+// body is signed with HMAC-SHA256 in the Livepeer-Signature header as
+// "sha256=<hex digest>".
+type EventWebhook struct {
+	url    string
+	secret []byte
+	client *http.Client
+	// requests bounds the number of requests in flight across all streams
+	requests chan struct{}
+
+	mu sync.Mutex
+	// queues holds the events waiting to be sent for each stream; a stream
+	// has an entry for as long as a goroutine is sending its events
+	queues    map[core.ManifestID][]*streamEvent
+	queueSize int
+
+	// MaxAttempts is how many times delivery of an event is attempted
+	MaxAttempts int
+	// Backoff is the delay before the first retry; it doubles every retry
+	Backoff time.Duration
+}
+
+// NewEventWebhook returns a webhook delivering events to the URL
+func NewEventWebhook(url, secret string) *EventWebhook {
+	return &EventWebhook{
+		url:         url,
+		secret:      []byte(secret),
+		client:      &http.Client{Timeout: common.HTTPTimeout},
+		requests:    make(chan struct{}, eventWorkers),
+		queues:      make(map[core.ManifestID][]*streamEvent),
+		queueSize:   eventQueueSize,
+		MaxAttempts: 5,
+		Backoff:     time.Second,
+	}
+}
+
+func newStreamEvent(typ string, mid core.ManifestID, data map[string]interface{}) *streamEvent {
+	return &streamEvent{
+		ID:         common.RandName(),
+		Type:       typ,
+		Timestamp:  time.Now().UnixNano() / int64(time.Millisecond),
+		ManifestID: mid,
+		Data:       data,
+	}
+}
+
+// Notify queues an event for delivery without blocking the stream. If the
+// stream's queue is full, the oldest event other than stream.started and
+// stream.ended is dropped; those two are always queued.
+func (w *EventWebhook) Notify(typ string, mid core.ManifestID, data map[string]interface{}) {
+	ev := newStreamEvent(typ, mid, data)
+
+	w.mu.Lock()
+	queue, running := w.queues[mid]
+	queue, dropped := queueEvent(queue, ev, w.queueSize)
+	w.queues[mid] = queue
+	w.mu.Unlock()
+
+	if dropped != nil {
+		glog.Errorf("Event queue full, dropping event type=%s manifestID=%s", dropped.Type, mid)
+		if monitor.Enabled {
+			monitor.EventDropped(dropped.Type)
+		}
+	}
+	if !running {
+		go w.run(mid)
+	}
+}
+
+// queueEvent appends an event to a stream's queue, returning the event
+// dropped to keep the queue within size, if any. Lifecycle events are never
+// dropped.
+func queueEvent(queue []*streamEvent, ev *streamEvent, size int) ([]*streamEvent, *streamEvent) {
+	if len(queue) < size {
+		return append(queue, ev), nil
+	}
+	for i, queued := range queue {
+		if !isLifecycleEvent(queued.Type) {
+			copy(queue[i:], queue[i+1:])
+			queue[len(queue)-1] = ev
+			return queue, queued
+		}
+	}
+	if isLifecycleEvent(ev.Type) {
+		return append(queue, ev), nil
+	}
+	return queue, ev
+}
+
+func isLifecycleEvent(typ string) bool {
+	return typ == EventStreamStarted || typ == EventStreamEnded
+}
+
+// run sends the queued events of a stream until its queue is empty
+func (w *EventWebhook) run(mid core.ManifestID) {
+	for {
+		w.mu.Lock()
+		queue := w.queues[mid]
+		if len(queue) == 0 {
+			delete(w.queues, mid)
+			w.mu.Unlock()
+			return
+		}
+		ev := queue[0]
+		queue[0] = nil
+		w.queues[mid] = queue[1:]
+		w.mu.Unlock()
+
+		w.deliver(ev)
+	}
+}
+
+// deliver sends an event, retrying until it is accepted or MaxAttempts is
+// reached
+func (w *EventWebhook) deliver(ev *streamEvent) {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		glog.Errorf("Error encoding event type=%s manifestID=%s err=%v", ev.Type, ev.ManifestID, err)
+		return
+	}
+	backoff := w.Backoff
+	for attempt := 1; ; attempt++ {
+		w.requests <- struct{}{}
+		retry, err := w.post(ev.Type, body)
+		<-w.requests
+		if err == nil {
+			return
+		}
+		if !retry || attempt >= w.MaxAttempts {
+			glog.Errorf("Error sending event type=%s manifestID=%s attempts=%d err=%v", ev.Type, ev.ManifestID, attempt, err)
+			return
+		}
+		glog.V(common.DEBUG).Infof("Retrying event type=%s manifestID=%s attempt=%d err=%v", ev.Type, ev.ManifestID, attempt, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// post sends an event body once, returning whether a failure is worth
+// retrying. Client errors other than rate limiting are not retried.
+func (w *EventWebhook) post(typ string, body []byte) (bool, error) {
+	req, err := http.NewRequest("POST", w.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(eventTypeHeader, typ)
+	if len(w.secret) > 0 {
+		req.Header.Set(eventSignatureHeader, "sha256="+signEvent(w.secret, body))
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("unexpected status=%s", resp.Status)
+}
+
+// signEvent returns the hex encoded HMAC-SHA256 of an event body
+func signEvent(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// notifyEvent sends an event to the event webhook, if there is one
+func notifyEvent(typ string, mid core.ManifestID, data map[string]interface{}) {
+	if Events == nil {
+		return
+	}
+	Events.Notify(typ, mid, data)
+}
@@ -0,0 +1,291 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/lpms/ffmpeg"
+	"github.com/livepeer/lpms/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// eventRecorder is a webhook endpoint collecting the events it receives
+type eventRecorder struct {
+	*httptest.Server
+	events chan *streamEvent
+}
+
+func newEventRecorder(t *testing.T, handler func(w http.ResponseWriter, r *http.Request, body []byte) bool) *eventRecorder {
+	rec := &eventRecorder{events: make(chan *streamEvent, 100)}
+	rec.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if handler != nil && !handler(w, r, body) {
+			return
+		}
+		var ev streamEvent
+		assert.Nil(t, json.Unmarshal(body, &ev))
+		rec.events <- &ev
+	}))
+	return rec
+}
+
+func (rec *eventRecorder) next(t *testing.T) *streamEvent {
+	select {
+	case ev := <-rec.events:
+		return ev
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for event")
+	}
+	return nil
+}
+
+func TestEventWebhook_Deliver(t *testing.T) {
+	assert := assert.New(t)
+
+	rec := newEventRecorder(t, func(w http.ResponseWriter, r *http.Request, body []byte) bool {
+		assert.Equal("application/json", r.Header.Get("Content-Type"))
+		assert.Equal("sha256="+signEvent([]byte("secret"), body), r.Header.Get("Livepeer-Signature"))
+		return true
+	})
+	defer rec.Close()
+
+	w := NewEventWebhook(rec.URL, "secret")
+	w.Notify(EventStreamStarted, "mid", map[string]interface{}{"resolution": "1280x720"})
+	w.Notify(EventStreamEnded, "mid", nil)
+
+	// Events are delivered in order
+	ev := rec.next(t)
+	assert.Equal(EventStreamStarted, ev.Type)
+	assert.Equal(core.ManifestID("mid"), ev.ManifestID)
+	assert.Equal(map[string]interface{}{"resolution": "1280x720"}, ev.Data)
+	assert.NotEmpty(ev.ID)
+	assert.InDelta(time.Now().UnixNano()/int64(time.Millisecond), ev.Timestamp, 5000)
+	ev = rec.next(t)
+	assert.Equal(EventStreamEnded, ev.Type)
+	assert.Nil(ev.Data)
+}
+
+func TestEventWebhook_Retry(t *testing.T) {
+	assert := assert.New(t)
+
+	var mu sync.Mutex
+	calls := map[string]int{}
+	status := map[string]int{
+		"unavailable": http.StatusServiceUnavailable,
+		"limited":     http.StatusTooManyRequests,
+		"bad":         http.StatusBadRequest,
+	}
+	rec := newEventRecorder(t, func(w http.ResponseWriter, r *http.Request, body []byte) bool {
+		var ev streamEvent
+		assert.Nil(json.Unmarshal(body, &ev))
+		name, _ := ev.Data["name"].(string)
+		mu.Lock()
+		defer mu.Unlock()
+		calls[name]++
+		if code, ok := status[name]; ok && calls[name] < 3 {
+			w.WriteHeader(code)
+			return false
+		}
+		return true
+	})
+	defer rec.Close()
+	notify := func(w *EventWebhook, name string) {
+		w.Notify(EventSegmentTranscoded, "mid", map[string]interface{}{"name": name})
+	}
+	next := func() string {
+		name, _ := rec.next(t).Data["name"].(string)
+		return name
+	}
+
+	w := NewEventWebhook(rec.URL, "")
+	w.Backoff = time.Millisecond
+
+	// Server errors and rate limiting are retried
+	notify(w, "unavailable")
+	assert.Equal("unavailable", next())
+	notify(w, "limited")
+	assert.Equal("limited", next())
+
+	// Client errors aren't
+	notify(w, "bad")
+	notify(w, "ok")
+	assert.Equal("ok", next())
+
+	// Delivery gives up after MaxAttempts
+	mu.Lock()
+	status["unavailable2"] = http.StatusInternalServerError
+	mu.Unlock()
+	w = NewEventWebhook(rec.URL, "")
+	w.Backoff = time.Millisecond
+	w.MaxAttempts = 2
+	notify(w, "unavailable2")
+	notify(w, "ok")
+	assert.Equal("ok", next())
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(3, calls["unavailable"])
+	assert.Equal(3, calls["limited"])
+	assert.Equal(1, calls["bad"])
+	assert.Equal(2, calls["unavailable2"])
+}
+
+func TestEventWebhook_StreamsIndependent(t *testing.T) {
+	assert := assert.New(t)
+
+	// The endpoint hangs on events of one stream
+	hung := make(chan struct{}, 1)
+	release := make(chan struct{})
+	rec := newEventRecorder(t, func(w http.ResponseWriter, r *http.Request, body []byte) bool {
+		var ev streamEvent
+		assert.Nil(json.Unmarshal(body, &ev))
+		if ev.ManifestID == "slow" {
+			select {
+			case hung <- struct{}{}:
+			default:
+			}
+			<-release
+		}
+		return true
+	})
+	defer rec.Close()
+	defer close(release)
+
+	w := NewEventWebhook(rec.URL, "")
+	w.Notify(EventStreamStarted, "slow", nil)
+	w.Notify(EventSegmentTranscoded, "slow", nil)
+	<-hung
+
+	// Other streams' events are still delivered, in order
+	w.Notify(EventStreamStarted, "fast", nil)
+	w.Notify(EventStreamEnded, "fast", nil)
+	ev := rec.next(t)
+	assert.Equal(core.ManifestID("fast"), ev.ManifestID)
+	assert.Equal(EventStreamStarted, ev.Type)
+	ev = rec.next(t)
+	assert.Equal(core.ManifestID("fast"), ev.ManifestID)
+	assert.Equal(EventStreamEnded, ev.Type)
+
+	// While the slow stream's queue is full, the oldest segment events are
+	// dropped and lifecycle events are kept
+	w.mu.Lock()
+	w.queueSize = 2
+	w.mu.Unlock()
+	w.Notify(EventSegmentTranscoded, "slow", map[string]interface{}{"seqNo": 1})
+	w.Notify(EventSegmentTranscoded, "slow", map[string]interface{}{"seqNo": 2})
+	w.Notify(EventStreamEnded, "slow", nil)
+	w.Notify(EventSegmentTranscoded, "slow", map[string]interface{}{"seqNo": 3})
+	w.mu.Lock()
+	queue := w.queues["slow"]
+	w.mu.Unlock()
+	if assert.Len(queue, 2) {
+		assert.Equal(EventStreamEnded, queue[0].Type)
+		assert.Equal(EventSegmentTranscoded, queue[1].Type)
+		assert.Equal(3, queue[1].Data["seqNo"])
+	}
+
+	// The slow stream's events arrive once the endpoint responds
+	release <- struct{}{}
+	assert.Equal(EventStreamStarted, rec.next(t).Type)
+}
+
+func TestQueueEvent(t *testing.T) {
+	assert := assert.New(t)
+
+	started := newStreamEvent(EventStreamStarted, "mid", nil)
+	seg1 := newStreamEvent(EventSegmentTranscoded, "mid", nil)
+	seg2 := newStreamEvent(EventSegmentTranscoded, "mid", nil)
+	ended := newStreamEvent(EventStreamEnded, "mid", nil)
+
+	queue, dropped := queueEvent(nil, started, 2)
+	assert.Nil(dropped)
+	queue, dropped = queueEvent(queue, seg1, 2)
+	assert.Nil(dropped)
+	assert.Equal([]*streamEvent{started, seg1}, queue)
+
+	// The oldest non-lifecycle event makes room
+	queue, dropped = queueEvent(queue, ended, 2)
+	assert.Equal(seg1, dropped)
+	assert.Equal([]*streamEvent{started, ended}, queue)
+
+	// With only lifecycle events queued, new segment events are dropped
+	queue, dropped = queueEvent(queue, seg2, 2)
+	assert.Equal(seg2, dropped)
+	assert.Equal([]*streamEvent{started, ended}, queue)
+
+	// Lifecycle events are always queued
+	queue, dropped = queueEvent(queue, started, 2)
+	assert.Nil(dropped)
+	assert.Len(queue, 3)
+}
+
+func TestEventWebhook_Nil(t *testing.T) {
+	// No webhook configured
+	assert.Nil(t, Events)
+	notifyEvent(EventStreamStarted, "mid", nil)
+}
+
+func TestTranscodeSegment_Events(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	rec := newEventRecorder(t, nil)
+	defer rec.Close()
+	Events = NewEventWebhook(rec.URL, "")
+	defer func() { Events = nil }()
+
+	ts, mux := stubTLSServer()
+	defer ts.Close()
+	mux.HandleFunc("/segment", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	sess := StubBroadcastSession(ts.URL)
+	cxn := &rtmpConnection{
+		mid:         "mid",
+		profile:     &ffmpeg.VideoProfile{Name: "unused"},
+		sessManager: bsmWithSessList([]*BroadcastSession{sess}),
+		pl:          &stubPlaylistManager{os: &stubOSSession{}},
+	}
+	seg := &stream.HLSSegment{SeqNo: 7}
+
+	// Failed attempts are reported with the orchestrator
+	_, err := transcodeSegment(context.Background(), cxn, seg, nil, "dummy", nil)
+	require.NotNil(err)
+	ev := rec.next(t)
+	assert.Equal(EventTranscodeFailed, ev.Type)
+	assert.Equal(core.ManifestID("mid"), ev.ManifestID)
+	assert.Equal(float64(7), ev.Data["seqNo"])
+	assert.Equal(ts.URL, ev.Data["orchestrator"])
+	assert.Equal(err.Error(), ev.Data["error"])
+
+	// The failed session was removed, leaving no orchestrators
+	_, err = transcodeSegment(context.Background(), cxn, seg, nil, "dummy", nil)
+	assert.Nil(err)
+	ev = rec.next(t)
+	assert.Equal(EventNoOrchestrators, ev.Type)
+	assert.Equal(float64(7), ev.Data["seqNo"])
+}
+
+func TestSessionManager_SwitchTo(t *testing.T) {
+	assert := assert.New(t)
+
+	bsm := bsmWithSessList(nil)
+	sess1, sess2 := StubBroadcastSession("https://a"), StubBroadcastSession("https://b")
+
+	// The first session isn't a switch
+	_, switched := bsm.switchTo(sess1)
+	assert.False(switched)
+	_, switched = bsm.switchTo(sess1)
+	assert.False(switched)
+	prev, switched := bsm.switchTo(sess2)
+	assert.True(switched)
+	assert.Equal("https://a", prev)
+}
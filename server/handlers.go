@@ -5,9 +5,12 @@ import (
 	"fmt"
 	"math/big"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/core"
 	"github.com/livepeer/go-livepeer/eth"
 	"github.com/livepeer/go-livepeer/pm"
 )
@@ -309,3 +312,266 @@ func signMessageHandler(client eth.LivepeerEthClient) http.Handler {
 		w.Write(signed)
 	})
 }
+
+// Orchestrator access list
+
+func orchAccessListHandler(list *OrchAccessList) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if list == nil {
+			respondWith500(w, "missing orchestrator access list")
+			return
+		}
+
+		data, err := json.Marshal(list.Entries())
+		if err != nil {
+			respondWith500(w, err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(data)
+	})
+}
+
+func allowOrchestratorHandler(list *OrchAccessList) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if list == nil {
+			respondWith500(w, "missing orchestrator access list")
+			return
+		}
+
+		orch := r.FormValue("orchestrator")
+		if err := list.Allow(orch, r.FormValue("reason")); err != nil {
+			respondWithOrchAccessError(w, orch, err)
+			return
+		}
+
+		glog.Infof("Allowed orchestrator orch=%s", orch)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("success"))
+	})
+}
+
+func denyOrchestratorHandler(list *OrchAccessList) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if list == nil {
+			respondWith500(w, "missing orchestrator access list")
+			return
+		}
+
+		// Deny indefinitely unless a duration is given
+		var ttl time.Duration
+		if d := r.FormValue("duration"); d != "" {
+			var err error
+			ttl, err = time.ParseDuration(d)
+			if err != nil || ttl <= 0 {
+				respondWith400(w, fmt.Sprintf("invalid duration: %v", d))
+				return
+			}
+		}
+
+		orch := r.FormValue("orchestrator")
+		if err := list.Deny(orch, r.FormValue("reason"), ttl); err != nil {
+			respondWithOrchAccessError(w, orch, err)
+			return
+		}
+
+		glog.Infof("Denied orchestrator orch=%s duration=%v", orch, ttl)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("success"))
+	})
+}
+
+func removeOrchestratorAccessHandler(list *OrchAccessList) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if list == nil {
+			respondWith500(w, "missing orchestrator access list")
+			return
+		}
+
+		orch := r.FormValue("orchestrator")
+		if err := list.Remove(orch); err != nil {
+			respondWithOrchAccessError(w, orch, err)
+			return
+		}
+
+		glog.Infof("Removed orchestrator from access list orch=%s", orch)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("success"))
+	})
+}
+
+func respondWithOrchAccessError(w http.ResponseWriter, orch string, err error) {
+	if err == ErrInvalidOrchestrator {
+		respondWith400(w, fmt.Sprintf("invalid orchestrator address or URI: %v", orch))
+		return
+	}
+	respondWith500(w, fmt.Sprintf("could not update orchestrator access list: %v", err))
+}
+
+// Remote transcoders
+
+func registeredTranscodersHandler(rtm *core.RemoteTranscoderManager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rtm == nil {
+			respondWith500(w, "missing transcoder manager")
+			return
+		}
+
+		data, err := json.Marshal(rtm.RegisteredTranscodersState())
+		if err != nil {
+			respondWith500(w, err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(data)
+	})
+}
+
+func drainTranscoderHandler(rtm *core.RemoteTranscoderManager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rtm == nil {
+			respondWith500(w, "missing transcoder manager")
+			return
+		}
+
+		addr := r.FormValue("address")
+		if err := rtm.Drain(addr); err != nil {
+			if err == core.ErrUnknownTranscoder {
+				respondWithError(w, fmt.Sprintf("unknown transcoder: %v", addr), http.StatusNotFound)
+				return
+			}
+			respondWith500(w, fmt.Sprintf("could not drain transcoder: %v", err))
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("success"))
+	})
+}
+
+func transcoderTokensHandler(tokens *core.TranscoderTokens) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tokens == nil {
+			respondWith500(w, "missing transcoder tokens")
+			return
+		}
+
+		data, err := json.Marshal(tokens.List())
+		if err != nil {
+			respondWith500(w, err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(data)
+	})
+}
+
+// issueTranscoderTokenHandler responds with a new token for the named
+// transcoder, replacing its previous one
+func issueTranscoderTokenHandler(tokens *core.TranscoderTokens) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tokens == nil {
+			respondWith500(w, "missing transcoder tokens")
+			return
+		}
+
+		name := r.FormValue("name")
+		token, err := tokens.Issue(name)
+		if err == core.ErrInvalidTranscoderName {
+			respondWith400(w, fmt.Sprintf("invalid transcoder name: %q", name))
+			return
+		}
+		if err != nil {
+			respondWith500(w, fmt.Sprintf("could not issue transcoder token: %v", err))
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(token))
+	})
+}
+
+// revokeTranscoderTokenHandler revokes the token of the named transcoder and
+// disconnects the transcoders using it
+func revokeTranscoderTokenHandler(tokens *core.TranscoderTokens, rtm *core.RemoteTranscoderManager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tokens == nil {
+			respondWith500(w, "missing transcoder tokens")
+			return
+		}
+
+		name := r.FormValue("name")
+		if err := tokens.Revoke(name); err != nil {
+			if err == core.ErrUnknownTranscoderToken {
+				respondWithError(w, fmt.Sprintf("unknown transcoder token: %v", name), http.StatusNotFound)
+				return
+			}
+			respondWith500(w, fmt.Sprintf("could not revoke transcoder token: %v", err))
+			return
+		}
+		if rtm != nil {
+			rtm.Disconnect(name)
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("success"))
+	})
+}
+
+// Streams
+
+// streamsHandler serves the statistics of the broadcaster's streams at
+// /streams and /streams/{manifestID}, and ends a stream on a POST to
+// /streams/{manifestID}/terminate
+func streamsHandler(s *LivepeerServer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/streams"), "/"), "/")
+		mid := core.ManifestID(parts[0])
+		switch {
+		case len(parts) == 1:
+			if r.Method != "GET" {
+				respondWithError(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			statuses := s.streamStatuses(mid)
+			var resp interface{} = statuses
+			if mid != "" {
+				if len(statuses) == 0 {
+					respondWithError(w, fmt.Sprintf("unknown stream: %v", mid), http.StatusNotFound)
+					return
+				}
+				resp = statuses[0]
+			}
+			data, err := json.Marshal(resp)
+			if err != nil {
+				respondWith500(w, err.Error())
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			w.Write(data)
+
+		case len(parts) == 2 && parts[1] == "terminate" && mid != "":
+			if r.Method != "POST" {
+				respondWithError(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			if err := removeRTMPStream(s, mid); err != nil {
+				respondWithError(w, fmt.Sprintf("unknown stream: %v", mid), http.StatusNotFound)
+				return
+			}
+			glog.Infof("Terminated stream manifestID=%s", mid)
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("success"))
+
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
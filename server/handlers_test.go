@@ -12,11 +12,17 @@ import (
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ethereum/go-ethereum/accounts"
 	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/core"
 	"github.com/livepeer/go-livepeer/eth"
+	"github.com/livepeer/go-livepeer/net"
 	"github.com/livepeer/go-livepeer/pm"
+	"github.com/livepeer/lpms/ffmpeg"
+	"github.com/livepeer/lpms/stream"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -715,3 +721,275 @@ func httpResp(handler http.Handler, method string, body io.Reader, headers map[s
 
 	return w.Result()
 }
+
+func TestOrchAccessHandlers_MissingList(t *testing.T) {
+	assert := assert.New(t)
+	handlers := []http.Handler{
+		orchAccessListHandler(nil),
+		allowOrchestratorHandler(nil),
+		denyOrchestratorHandler(nil),
+		removeOrchestratorAccessHandler(nil),
+	}
+	for _, handler := range handlers {
+		resp := httpPostFormResp(handler, nil)
+		body, _ := ioutil.ReadAll(resp.Body)
+		assert.Equal(http.StatusInternalServerError, resp.StatusCode)
+		assert.Equal("missing orchestrator access list", strings.TrimSpace(string(body)))
+	}
+}
+
+func TestOrchAccessHandlers(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	store := newStubOrchAccessStore()
+	list, err := NewOrchAccessList(store)
+	require.Nil(err)
+
+	post := func(handler http.Handler, form url.Values) (int, string) {
+		resp := httpPostFormResp(handler, strings.NewReader(form.Encode()))
+		body, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, strings.TrimSpace(string(body))
+	}
+
+	// invalid orchestrator
+	code, body := post(allowOrchestratorHandler(list), url.Values{"orchestrator": {"https://"}})
+	assert.Equal(http.StatusBadRequest, code)
+	assert.Equal("invalid orchestrator address or URI: https://", body)
+
+	// invalid duration
+	code, body = post(denyOrchestratorHandler(list), url.Values{"orchestrator": {"https://a:8935"}, "duration": {"foo"}})
+	assert.Equal(http.StatusBadRequest, code)
+	assert.Equal("invalid duration: foo", body)
+	code, _ = post(denyOrchestratorHandler(list), url.Values{"orchestrator": {"https://a:8935"}, "duration": {"-1h"}})
+	assert.Equal(http.StatusBadRequest, code)
+
+	code, body = post(allowOrchestratorHandler(list), url.Values{"orchestrator": {"b:8935"}, "reason": {"trusted"}})
+	assert.Equal(http.StatusOK, code)
+	assert.Equal("success", body)
+	code, _ = post(denyOrchestratorHandler(list), url.Values{"orchestrator": {"https://a:8935"}, "duration": {"1h"}, "reason": {"bad output"}})
+	assert.Equal(http.StatusOK, code)
+
+	resp := httpGetResp(orchAccessListHandler(list))
+	require.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal("application/json", resp.Header.Get("Content-Type"))
+	var entries []*common.DBOrchAccess
+	require.Nil(json.NewDecoder(resp.Body).Decode(&entries))
+	require.Len(entries, 2)
+	assert.Equal(&common.DBOrchAccess{Orchestrator: "https://b:8935", Policy: common.OrchAccessAllow, Reason: "trusted"}, entries[0])
+	assert.Equal("https://a:8935", entries[1].Orchestrator)
+	assert.Equal(common.OrchAccessDeny, entries[1].Policy)
+	assert.Equal("bad output", entries[1].Reason)
+	assert.NotZero(entries[1].ExpiresAt)
+
+	code, _ = post(removeOrchestratorAccessHandler(list), url.Values{"orchestrator": {"https://a:8935"}})
+	assert.Equal(http.StatusOK, code)
+	assert.Len(list.Entries(), 1)
+
+	// store errors
+	store.err = errors.New("store error")
+	code, body = post(removeOrchestratorAccessHandler(list), url.Values{"orchestrator": {"https://b:8935"}})
+	assert.Equal(http.StatusInternalServerError, code)
+	assert.Equal("could not update orchestrator access list: store error", body)
+}
+
+func TestTranscoderHandlers(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	for _, handler := range []http.Handler{registeredTranscodersHandler(nil), drainTranscoderHandler(nil)} {
+		resp := httpPostFormResp(handler, nil)
+		body, _ := ioutil.ReadAll(resp.Body)
+		assert.Equal(http.StatusInternalServerError, resp.StatusCode)
+		assert.Equal("missing transcoder manager", strings.TrimSpace(string(body)))
+	}
+
+	rtm := core.NewRemoteTranscoderManager()
+	done := make(chan error, 1)
+	go func() { done <- rtm.Manage(&common.StubServerStream{}, "", 5, nil) }()
+	time.Sleep(1 * time.Millisecond)
+
+	resp := httpGetResp(registeredTranscodersHandler(rtm))
+	require.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal("application/json", resp.Header.Get("Content-Type"))
+	var state []net.RemoteTranscoderState
+	require.Nil(json.NewDecoder(resp.Body).Decode(&state))
+	require.Len(state, 1)
+	assert.Equal("TestAddress", state[0].Address)
+	assert.Equal(5, state[0].Capacity)
+	assert.False(state[0].Draining)
+	assert.False(state[0].LastSeen.IsZero())
+
+	post := func(form url.Values) (int, string) {
+		resp := httpPostFormResp(drainTranscoderHandler(rtm), strings.NewReader(form.Encode()))
+		body, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, strings.TrimSpace(string(body))
+	}
+
+	code, body := post(url.Values{"address": {"unknown"}})
+	assert.Equal(http.StatusNotFound, code)
+	assert.Equal("unknown transcoder: unknown", body)
+
+	code, body = post(url.Values{"address": {"TestAddress"}})
+	assert.Equal(http.StatusOK, code)
+	assert.Equal("success", body)
+	select {
+	case err := <-done:
+		assert.Equal(core.ErrTranscoderDrained, err)
+	case <-time.After(time.Second):
+		assert.Fail("transcoder was not disconnected")
+	}
+}
+
+func TestTranscoderTokenHandlers(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	for _, handler := range []http.Handler{transcoderTokensHandler(nil), issueTranscoderTokenHandler(nil), revokeTranscoderTokenHandler(nil, nil)} {
+		resp := httpPostFormResp(handler, nil)
+		body, _ := ioutil.ReadAll(resp.Body)
+		assert.Equal(http.StatusInternalServerError, resp.StatusCode)
+		assert.Equal("missing transcoder tokens", strings.TrimSpace(string(body)))
+	}
+
+	dbh, dbraw, err := common.TempDB(t)
+	require.Nil(err)
+	defer dbh.Close()
+	defer dbraw.Close()
+	tokens, err := core.NewTranscoderTokens(dbh)
+	require.Nil(err)
+	rtm := core.NewRemoteTranscoderManager()
+
+	post := func(handler http.Handler, name string) (int, string) {
+		form := url.Values{"name": {name}}
+		resp := httpPostFormResp(handler, strings.NewReader(form.Encode()))
+		body, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, strings.TrimSpace(string(body))
+	}
+
+	code, body := post(issueTranscoderTokenHandler(tokens), "rig 1")
+	assert.Equal(http.StatusBadRequest, code)
+	assert.Equal(`invalid transcoder name: "rig 1"`, body)
+
+	code, token := post(issueTranscoderTokenHandler(tokens), "rig1")
+	require.Equal(http.StatusOK, code)
+	name, ok := tokens.Identify(token)
+	assert.True(ok)
+	assert.Equal("rig1", name)
+
+	// Token hashes aren't listed
+	resp := httpGetResp(transcoderTokensHandler(tokens))
+	require.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal("application/json", resp.Header.Get("Content-Type"))
+	listed, _ := ioutil.ReadAll(resp.Body)
+	assert.NotContains(string(listed), "TokenHash")
+	var list []common.DBTranscoderToken
+	require.Nil(json.Unmarshal(listed, &list))
+	require.Len(list, 1)
+	assert.Equal("rig1", list[0].Name)
+
+	// Revoking disconnects transcoders using the token
+	done := make(chan error, 1)
+	go func() { done <- rtm.Manage(&common.StubServerStream{}, "rig1", 5, nil) }()
+	time.Sleep(1 * time.Millisecond)
+
+	code, body = post(revokeTranscoderTokenHandler(tokens, rtm), "unknown")
+	assert.Equal(http.StatusNotFound, code)
+	assert.Equal("unknown transcoder token: unknown", body)
+
+	code, body = post(revokeTranscoderTokenHandler(tokens, rtm), "rig1")
+	assert.Equal(http.StatusOK, code)
+	assert.Equal("success", body)
+	_, ok = tokens.Identify(token)
+	assert.False(ok)
+	select {
+	case err := <-done:
+		assert.Nil(err)
+	case <-time.After(time.Second):
+		assert.Fail("transcoder was not disconnected")
+	}
+}
+
+func TestStreamsHandler(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	s := setupServer()
+	defer serverCleanup(s)
+	s.rtmpConnections = map[core.ManifestID]*rtmpConnection{}
+	defer func() { s.rtmpConnections = map[core.ManifestID]*rtmpConnection{} }()
+
+	do := func(method, path string) (int, string) {
+		req := httptest.NewRequest(method, "http://example.com"+path, nil)
+		w := httptest.NewRecorder()
+		streamsHandler(s).ServeHTTP(w, req)
+		body, _ := ioutil.ReadAll(w.Result().Body)
+		return w.Result().StatusCode, strings.TrimSpace(string(body))
+	}
+
+	code, body := do("GET", "/streams")
+	assert.Equal(http.StatusOK, code)
+	assert.Equal("[]", body)
+	code, body = do("GET", "/streams/unknown")
+	assert.Equal(http.StatusNotFound, code)
+	assert.Equal("unknown stream: unknown", body)
+
+	params := &streamParameters{mid: "mid1", profiles: []ffmpeg.VideoProfile{ffmpeg.P240p30fps16x9}}
+	_, err := s.registerConnection(stream.NewBasicRTMPVideoStream(params))
+	require.Nil(err)
+	stats := params.stats
+	require.NotNil(stats)
+	stats.segmentIngested()
+	stats.segmentIngested()
+	stats.segmentIngested()
+	stats.segmentTranscoded()
+	stats.segmentTranscoded()
+	stats.segmentFailed(errMaxAttempts)
+	stats.paid(2, big.NewRat(3000, 1))
+	stats.paid(1, big.NewRat(1500, 1))
+
+	sess := StubBroadcastSession("https://orch:8935")
+	sess.LatencyScore = 0.5
+	sess.OrchestratorInfo.PriceInfo = &net.PriceInfo{PricePerUnit: 1, PixelsPerUnit: 4}
+	s.rtmpConnections["mid1"].sessManager = bsmWithSessList([]*BroadcastSession{sess})
+
+	code, body = do("GET", "/streams/mid1")
+	require.Equal(http.StatusOK, code)
+	var st streamStatus
+	require.Nil(json.Unmarshal([]byte(body), &st))
+	assert.Equal(core.ManifestID("mid1"), st.ManifestID)
+	assert.InDelta(time.Now().Unix(), st.StartedAt, 5)
+	assert.Equal([]string{ffmpeg.P240p30fps16x9.Name}, st.Renditions)
+	assert.Equal(3, st.SegmentsIngested)
+	assert.Equal(2, st.SegmentsTranscoded)
+	assert.Equal(1, st.SegmentsFailed)
+	assert.InDelta(2.0/3, st.SuccessRate, 0.0001)
+	assert.Equal([]orchestratorStatus{{Address: "https://orch:8935", LatencyScore: 0.5, PricePerPixel: "0.250"}}, st.Orchestrators)
+	assert.Equal(int64(3), st.TicketsSent)
+	assert.Equal("4500", st.ValueSent)
+	require.NotNil(st.LastError)
+	assert.Equal(errMaxAttempts.Error(), st.LastError.Message)
+
+	var list []streamStatus
+	code, body = do("GET", "/streams/")
+	assert.Equal(http.StatusOK, code)
+	require.Nil(json.Unmarshal([]byte(body), &list))
+	require.Len(list, 1)
+	assert.Equal(st, list[0])
+
+	// Termination
+	code, _ = do("GET", "/streams/mid1/terminate")
+	assert.Equal(http.StatusMethodNotAllowed, code)
+	code, _ = do("POST", "/streams/mid1")
+	assert.Equal(http.StatusMethodNotAllowed, code)
+	code, body = do("POST", "/streams/mid1/terminate")
+	assert.Equal(http.StatusOK, code)
+	assert.Equal("success", body)
+	code, _ = do("GET", "/streams/mid1")
+	assert.Equal(http.StatusNotFound, code)
+	code, body = do("POST", "/streams/mid1/terminate")
+	assert.Equal(http.StatusNotFound, code)
+	assert.Equal("unknown stream: mid1", body)
+
+	code, _ = do("GET", "/streams/mid1/other")
+	assert.Equal(http.StatusNotFound, code)
+}
@@ -9,8 +9,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"io/ioutil"
+	"math/big"
 	"math/rand"
 	"mime/multipart"
 	"net/http"
@@ -19,6 +21,7 @@ import (
 	"path"
 	"regexp"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -28,6 +31,8 @@ import (
 	"github.com/livepeer/go-livepeer/monitor"
 	"github.com/livepeer/go-livepeer/net"
 	"github.com/livepeer/go-livepeer/pm"
+	"github.com/livepeer/go-livepeer/srt"
+	"github.com/livepeer/go-livepeer/verification"
 
 	"github.com/golang/glog"
 	"github.com/livepeer/go-livepeer/common"
@@ -38,6 +43,7 @@ import (
 	"github.com/livepeer/lpms/stream"
 	"github.com/livepeer/lpms/vidplayer"
 	"github.com/livepeer/m3u8"
+	"golang.org/x/crypto/sha3"
 )
 
 var errAlreadyExists = errors.New("StreamAlreadyExists")
@@ -48,6 +54,8 @@ var errDiscovery = errors.New("ErrDiscovery")
 var errNoOrchs = errors.New("ErrNoOrchs")
 var errUnknownStream = errors.New("ErrUnknownStream")
 var errMismatchedParams = errors.New("Mismatched type for stream params")
+var errPushBodyTooLarge = errors.New("ErrPushBodyTooLarge")
+var errStreamObjectStore = errors.New("ErrStreamObjectStore")
 
 const HLSWaitInterval = time.Second
 const HLSBufferCap = uint(43200) //12 hrs assuming 1s segment
@@ -63,17 +71,59 @@ var AuthWebhookURL string
 
 var refreshIntervalHttpPush = 1 * time.Minute
 
+// MaxPushBodySize is the largest segment in bytes accepted over HTTP push; <= 0 for no limit
+var MaxPushBodySize int64 = 64 * 1024 * 1024
+
+// LowLatencyHLS enables LL-HLS media playlists with partial segments
+var LowLatencyHLS bool
+
+// SourceVariant lists the untouched source in the master playlist, which
+// keeps streams playable when no orchestrator is available
+var SourceVariant = true
+
+// RecordStorage, if set, receives a copy of every source and rendition
+// segment so streams can be replayed as VOD once they end
+var RecordStorage drivers.OSDriver
+
 type streamParameters struct {
 	mid        core.ManifestID
 	rtmpKey    string
 	profiles   []ffmpeg.VideoProfile
 	resolution string
+	format     core.SegmentFormat
+	// Audio, encoding and thumbnail settings of the renditions; nil if
+	// every rendition uses the defaults
+	renditions core.RenditionProfiles
+	// Verification policy for the stream; nil if segments aren't verified
+	verification *verification.Policy
+	// Maximum price for the stream; nil to only apply the node's maximum
+	maxPrice *big.Rat
+	// Object store for the stream; nil to use the node's storage
+	os drivers.OSDriver
+	// Orchestrators the stream is restricted to, keyed as in the access
+	// list; empty to permit any orchestrator
+	orchestrators map[string]bool
+	// Object store the stream is recorded into; nil if not recorded
+	recordOS drivers.OSDriver
+	// URL notified once the stream ends
+	streamEndURL string
+	// Live statistics of the stream, also updated by its sessions
+	stats *streamStats
 }
 
 func (s *streamParameters) StreamID() string {
 	return string(s.mid) + "/" + s.rtmpKey
 }
 
+// storage returns the object store that the stream's segments and playlists
+// are written to
+func (s *streamParameters) storage() drivers.OSDriver {
+	if s.os != nil {
+		return s.os
+	}
+	return drivers.NodeStorage
+}
+
 type rtmpConnection struct {
 	mid         core.ManifestID
 	nonce       uint64
@@ -83,6 +133,12 @@ type rtmpConnection struct {
 	params      *streamParameters
 	sessManager *BroadcastSessionsManager
 	lastUsed    time.Time
+	recorder    *core.StreamRecorder
+	// Whether the recording shares the external object store of the live
+	// stream, so stored segments can be recorded without copying them
+	recordInPlace bool
+	// Set once the source resolution has been probed; accessed atomically
+	sourceProbed int32
 }
 
 type LivepeerServer struct {
@@ -110,7 +166,48 @@ type authWebhookResponse struct {
 		Height  int    `json:"height"`
 		Bitrate int    `json:"bitrate"`
 		FPS     uint   `json:"fps"`
+		// Audio codec of the rendition: copy (default), aac or none
+		AudioCodec   string `json:"audioCodec"`
+		AudioBitrate int    `json:"audioBitrate"`
+		// Whether the rendition only carries audio, ignoring the video
+		// settings above
+		AudioOnly bool `json:"audioOnly"`
+		// Video codec: h264 (default), h265 or vp9
+		Codec string `json:"codec"`
+		// H.264 encoder profile: baseline, main or high
+		Profile string `json:"profile"`
+		// Number of frames between keyframes
+		GOP int `json:"gop"`
+		// Constant rate factor; encodes at the target bitrate if omitted
+		CRF int `json:"crf"`
+		// Image format of a thumbnail rendition: jpeg or png. The rendition
+		// carries video if omitted.
+		Thumbnail string `json:"thumbnail"`
+		// Minimum number of seconds between images of a thumbnail rendition
+		ThumbnailInterval float64 `json:"thumbnailInterval"`
 	} `json:"profiles"`
+	Format string `json:"format"`
+	// Overrides of the node's verification policy for the stream
+	Verification *struct {
+		// Number of orchestrators to send each segment to
+		Redundancy int `json:"redundancy"`
+		// Fraction of segments to verify; zero verifies none
+		SampleRate *float64 `json:"sampleRate"`
+	} `json:"verification"`
+	// Maximum price for the stream, in wei per pixelsPerUnit pixels
+	MaxPrice *struct {
+		PricePerUnit  int64 `json:"pricePerUnit"`
+		PixelsPerUnit int64 `json:"pixelsPerUnit"`
+	} `json:"maxPrice"`
+	// S3 or GS object store URL for the stream, as for -recordStore
+	ObjectStore string `json:"objectStore"`
+	// Ethereum addresses or service URIs the stream is restricted to
+	Orchestrators []string `json:"orchestrators"`
+	// Whether to record the stream; the node's -recordStore setting
+	// applies if omitted
+	Record *bool `json:"record"`
+	// URL to POST to once the stream ends
+	StreamEndCallback string `json:"streamEndCallback"`
 }
 
 func NewLivepeerServer(rtmpAddr string, lpNode *core.LivepeerNode) *LivepeerServer {
@@ -131,6 +228,20 @@ func NewLivepeerServer(rtmpAddr string, lpNode *core.LivepeerNode) *LivepeerServ
 	if lpNode.NodeType == core.BroadcasterNode {
 		opts.HttpMux.HandleFunc("/live/", ls.HandlePush)
 	}
+	// Serve segments and playlists kept in filesystem storage
+	served := make(map[string]*drivers.FSOS)
+	for _, d := range []drivers.OSDriver{drivers.NodeStorage, RecordStorage} {
+		fs, ok := d.(*drivers.FSOS)
+		if !ok || served[fs.Prefix()] == fs {
+			continue
+		}
+		if served[fs.Prefix()] != nil {
+			glog.Errorf("Storage prefix=%s already in use; use a different prefix for each storage directory", fs.Prefix())
+			continue
+		}
+		opts.HttpMux.Handle(fs.Prefix(), fs)
+		served[fs.Prefix()] = fs
+	}
 	return ls
 }
 
@@ -150,7 +261,7 @@ func (s *LivepeerServer) StartMediaServer(ctx context.Context, transcodingOption
 	//Start the LPMS server
 	lpmsCtx, cancel := context.WithCancel(ctx)
 
-	ec := make(chan error, 2)
+	ec := make(chan error, 3)
 	go func() {
 		if err := s.LPMS.Start(lpmsCtx); err != nil {
 			// typically triggered if there's an error with broadcaster LPMS
@@ -161,7 +272,19 @@ func (s *LivepeerServer) StartMediaServer(ctx context.Context, transcodingOption
 	if s.LivepeerNode.NodeType == core.BroadcasterNode {
 		go func() {
 			glog.V(4).Infof("HTTP Server listening on http://%v", httpAddr)
-			ec <- http.ListenAndServe(httpAddr, s.HTTPMux)
+			ec <- http.ListenAndServe(httpAddr, s.streamHandler())
+		}()
+	}
+	if s.LivepeerNode.NodeType == core.BroadcasterNode && SRTAddr != "" {
+		ln, err := srt.Listen(SRTAddr, srt.Config{Passphrase: SRTPassphrase})
+		if err != nil {
+			cancel()
+			return err
+		}
+		defer ln.Close()
+		go func() {
+			glog.V(4).Infof("SRT Server listening on srt://%v", ln.Addr())
+			ec <- s.serveSRT(ln)
 		}()
 	}
 
@@ -189,10 +312,19 @@ func createRTMPStreamIDHandler(s *LivepeerServer) func(url *url.URL) (strmID str
 		var err error
 		var key string
 		profiles := []ffmpeg.VideoProfile{}
+		var renditions core.RenditionProfiles
 		if resp, err = authenticateStream(url.String()); err != nil {
 			glog.Error("Authentication denied for ", err)
 			return nil
 		}
+		// Renditions follow the ingest container unless requested otherwise
+		format, _ := core.SegmentFormatFromExt(path.Ext(url.Path))
+		if resp != nil && resp.Format != "" {
+			if format, err = core.ParseSegmentFormat(resp.Format); err != nil {
+				glog.Errorf("Invalid format=%s from auth webhook: %v", resp.Format, err)
+				return nil
+			}
+		}
 		if resp != nil {
 			mid, key = parseManifestID(resp.ManifestID), resp.StreamKey
 			// Process transcoding options presets
@@ -201,12 +333,42 @@ func createRTMPStreamIDHandler(s *LivepeerServer) func(url *url.URL) (strmID str
 			}
 
 			for _, profile := range resp.Profiles {
+				codec, err := core.ParseAudioCodec(profile.AudioCodec)
+				if err != nil {
+					glog.Errorf("Invalid audioCodec=%s from auth webhook: %v", profile.AudioCodec, err)
+					return nil
+				}
+				r := core.RenditionProfile{
+					Audio: core.AudioProfile{Codec: codec, Bitrate: profile.AudioBitrate, AudioOnly: profile.AudioOnly},
+				}
+				if r.Encoding, err = parseWebhookEncoding(profile.Codec, profile.Profile, profile.GOP, profile.CRF); err != nil {
+					glog.Errorf("Invalid encoding for profile=%s from auth webhook: %v", profile.Name, err)
+					return nil
+				}
+				if r.Thumbnail, err = parseWebhookThumbnail(profile.Thumbnail, profile.ThumbnailInterval); err != nil {
+					glog.Errorf("Invalid thumbnail settings for profile=%s from auth webhook: %v", profile.Name, err)
+					return nil
+				}
+				if err := r.Validate(); err != nil {
+					glog.Errorf("Invalid settings for profile=%s from auth webhook: %v", profile.Name, err)
+					return nil
+				}
+				if r.Audio.AudioOnly {
+					// Video settings don't apply
+					profile.Width, profile.Height, profile.Bitrate, profile.FPS = 0, 0, 0, 0
+					r.Encoding = core.VideoEncoding{}
+				} else if r.Thumbnail != nil {
+					// Images have neither audio nor encoder settings
+					profile.Bitrate = 0
+					r.Audio, r.Encoding = core.AudioProfile{}, core.VideoEncoding{}
+				}
 				name := profile.Name
+				if name != "" && profileNameTaken(profiles, name) {
+					glog.Errorf("Duplicate profile=%s from auth webhook", name)
+					return nil
+				}
 				if name == "" {
-					name = "webhook_" + common.DefaultProfileName(
-						profile.Width,
-						profile.Height,
-						profile.Bitrate)
+					name = uniqueProfileName(profiles, webhookProfileName(profile.Width, profile.Height, profile.Bitrate, r))
 				}
 				prof := ffmpeg.VideoProfile{
 					Name:       name,
@@ -215,6 +377,16 @@ func createRTMPStreamIDHandler(s *LivepeerServer) func(url *url.URL) (strmID str
 					Resolution: fmt.Sprintf("%dx%d", profile.Width, profile.Height),
 				}
 				profiles = append(profiles, prof)
+				if !r.IsDefault() {
+					if renditions == nil {
+						renditions = make(core.RenditionProfiles)
+					}
+					renditions[name] = r
+				}
+			}
+			if renditions.RequiresMP4() && format != core.FormatMP4 {
+				glog.Errorf("Codec from auth webhook requires the mp4 format, got format=%s", format)
+				return nil
 			}
 
 			// Only set defaults if user did not specify a preset/profile
@@ -249,12 +421,174 @@ func createRTMPStreamIDHandler(s *LivepeerServer) func(url *url.URL) (strmID str
 		if key == "" {
 			key = common.RandomIDGenerator(StreamKeyBytes)
 		}
-		return &streamParameters{
-			mid:      mid,
-			rtmpKey:  key,
-			profiles: profiles,
+		params := &streamParameters{
+			mid:          mid,
+			rtmpKey:      key,
+			profiles:     profiles,
+			format:       format,
+			renditions:   renditions,
+			verification: streamVerificationPolicy(resp),
+			recordOS:     RecordStorage,
+		}
+		if err := applyWebhookStreamSettings(params, resp); err != nil {
+			glog.Errorf("Invalid stream settings from auth webhook manifestID=%s err=%v", mid, err)
+			return nil
 		}
+		return params
+	}
+}
+
+// webhookProfileName returns the name of a profile returned by the auth
+// webhook without one
+func webhookProfileName(width, height, bitrate int, r core.RenditionProfile) string {
+	if r.Audio.AudioOnly {
+		if r.Audio.Codec == core.AudioAAC && r.Audio.Bitrate > 0 {
+			return fmt.Sprintf("webhook_audio_%v_%d", r.Audio.Codec, r.Audio.Bitrate)
+		}
+		return fmt.Sprintf("webhook_audio_%v", r.Audio.Codec)
+	}
+	if r.Thumbnail != nil {
+		return fmt.Sprintf("webhook_thumbnail_%dx%d", width, height)
+	}
+	return "webhook_" + common.DefaultProfileName(width, height, bitrate)
+}
+
+func profileNameTaken(profiles []ffmpeg.VideoProfile, name string) bool {
+	for _, p := range profiles {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// uniqueProfileName numbers a generated profile name if another profile
+// already has it, since renditions are keyed by name
+func uniqueProfileName(profiles []ffmpeg.VideoProfile, name string) string {
+	unique := name
+	for i := 2; profileNameTaken(profiles, unique); i++ {
+		unique = fmt.Sprintf("%s_%d", name, i)
+	}
+	return unique
+}
+
+// parseWebhookEncoding parses the video encoding settings of a profile
+// returned by the auth webhook
+func parseWebhookEncoding(codec, profile string, gop, crf int) (core.VideoEncoding, error) {
+	var enc core.VideoEncoding
+	var err error
+	if enc.Codec, err = core.ParseVideoCodec(codec); err != nil {
+		return enc, err
+	}
+	if enc.Profile, err = core.ParseEncoderProfile(profile); err != nil {
+		return enc, err
+	}
+	enc.GOP, enc.CRF = gop, crf
+	return enc, enc.Validate()
+}
+
+// parseWebhookThumbnail parses the thumbnail settings of a profile returned
+// by the auth webhook. Returns nil if the profile carries video.
+func parseWebhookThumbnail(format string, interval float64) (*core.ThumbnailProfile, error) {
+	if format == "" {
+		return nil, nil
+	}
+	imgFormat, err := core.ParseImageFormat(format)
+	if err != nil {
+		return nil, err
+	}
+	thumb := &core.ThumbnailProfile{
+		Format:   imgFormat,
+		Interval: time.Duration(interval * float64(time.Second)),
+	}
+	return thumb, thumb.Validate()
+}
+
+// applyWebhookStreamSettings sets the per-stream price cap, storage,
+// orchestrators, recording and callback returned by the auth webhook
+func applyWebhookStreamSettings(params *streamParameters, resp *authWebhookResponse) error {
+	if resp == nil {
+		return nil
+	}
+	if resp.MaxPrice != nil {
+		if resp.MaxPrice.PricePerUnit < 0 || resp.MaxPrice.PixelsPerUnit <= 0 {
+			return fmt.Errorf("invalid maxPrice pricePerUnit=%d pixelsPerUnit=%d", resp.MaxPrice.PricePerUnit, resp.MaxPrice.PixelsPerUnit)
+		}
+		params.maxPrice = big.NewRat(resp.MaxPrice.PricePerUnit, resp.MaxPrice.PixelsPerUnit)
+	}
+	if resp.ObjectStore != "" {
+		store, err := parseStreamObjectStore(resp.ObjectStore)
+		if err != nil {
+			return err
+		}
+		params.os = store
+	}
+	if len(resp.Orchestrators) > 0 {
+		params.orchestrators = make(map[string]bool)
+		for _, orch := range resp.Orchestrators {
+			key, err := NormalizeOrchestrator(orch)
+			if err != nil {
+				return fmt.Errorf("invalid orchestrator=%q", orch)
+			}
+			params.orchestrators[key] = true
+		}
+	}
+	if resp.Record != nil {
+		params.recordOS = nil
+		if *resp.Record {
+			// Recordings go along with the rest of the stream if it has
+			// its own object store
+			params.recordOS = RecordStorage
+			if params.os != nil {
+				params.recordOS = params.os
+			}
+			if params.recordOS == nil {
+				return errors.New("recording requested without a record store")
+			}
+		}
+	}
+	if resp.StreamEndCallback != "" {
+		u, err := url.ParseRequestURI(resp.StreamEndCallback)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("invalid streamEndCallback=%q", resp.StreamEndCallback)
+		}
+		params.streamEndURL = u.String()
+	}
+	return nil
+}
+
+// parseStreamObjectStore creates the driver for a stream's own object store.
+// Local directories can't be served per stream, so only remote object stores
+// are accepted.
+func parseStreamObjectStore(uri string) (drivers.OSDriver, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "s3" && u.Scheme != "gs" {
+		return nil, errStreamObjectStore
 	}
+	return drivers.ParseOSURL(uri)
+}
+
+// streamVerificationPolicy returns the node's verification policy with any
+// overrides from the auth webhook applied
+func streamVerificationPolicy(resp *authWebhookResponse) *verification.Policy {
+	if resp == nil || resp.Verification == nil {
+		return Policy
+	}
+	// Same retries as the node's default policy
+	policy := &verification.Policy{Retries: 2}
+	if Policy != nil {
+		*policy = *Policy
+	}
+	if resp.Verification.Redundancy > 0 {
+		policy.Redundancy = resp.Verification.Redundancy
+	}
+	if resp.Verification.SampleRate != nil {
+		policy.SampleRate = verification.SampleRate(*resp.Verification.SampleRate)
+	}
+	return policy
 }
 
 func authenticateStream(url string) (*authWebhookResponse, error) {
@@ -380,11 +714,14 @@ func (s *LivepeerServer) registerConnection(rtmpStrm stream.RTMPVideoStream) (*r
 		return nil, errMismatchedParams
 	}
 	mid := params.mid
-	if drivers.NodeStorage == nil {
+	if params.storage() == nil {
 		glog.Error("Missing node storage")
 		return nil, errStorage
 	}
-	storage := drivers.NodeStorage.NewSession(string(mid))
+	storage := params.storage().NewSession(string(mid))
+	if params.stats == nil {
+		params.stats = newStreamStats()
+	}
 	// Build the source video profile from the RTMP stream.
 	if params.resolution == "" {
 		params.resolution = fmt.Sprintf("%vx%v", rtmpStrm.Width(), rtmpStrm.Height())
@@ -405,6 +742,13 @@ func (s *LivepeerServer) registerConnection(rtmpStrm stream.RTMPVideoStream) (*r
 	}
 
 	playlist := core.NewBasicPlaylistManager(mid, storage)
+	if LowLatencyHLS {
+		playlist.EnableLowLatencyHLS()
+	}
+	playlist.SetRenditionProfiles(params.renditions)
+	if !SourceVariant {
+		playlist.UnlistHLSVariant(vProfile.Name)
+	}
 	var stakeRdr stakeReader
 	if s.LivepeerNode.Eth != nil {
 		stakeRdr = &storeStakeReader{store: s.LivepeerNode.Database}
@@ -416,9 +760,14 @@ func (s *LivepeerServer) registerConnection(rtmpStrm stream.RTMPVideoStream) (*r
 		pl:          playlist,
 		profile:     &vProfile,
 		params:      params,
-		sessManager: NewSessionManager(s.LivepeerNode, params, playlist, NewMinLSSelector(stakeRdr, 1.0)),
+		sessManager: NewSessionManager(s.LivepeerNode, params, playlist, BroadcastCfg.newSelector(stakeRdr)),
 		lastUsed:    time.Now(),
 	}
+	if params.recordOS != nil {
+		recordPath := fmt.Sprintf("%s/%s", mid, common.RandName())
+		cxn.recorder = core.NewStreamRecorder(mid, params.recordOS.NewSession(recordPath))
+		cxn.recordInPlace = params.recordOS == params.storage() && storage.IsExternal()
+	}
 
 	s.connectionLock.Lock()
 	_, exists = s.rtmpConnections[mid]
@@ -438,6 +787,14 @@ func (s *LivepeerServer) registerConnection(rtmpStrm stream.RTMPVideoStream) (*r
 	if monitor.Enabled {
 		monitor.CurrentSessions(sessionsNumber)
 	}
+	renditions := make([]string, 0, len(params.profiles))
+	for _, p := range params.profiles {
+		renditions = append(renditions, p.Name)
+	}
+	notifyEvent(EventStreamStarted, mid, map[string]interface{}{
+		"resolution": params.resolution,
+		"renditions": renditions,
+	})
 
 	return cxn, nil
 }
@@ -453,8 +810,16 @@ func removeRTMPStream(s *LivepeerServer, mid core.ManifestID) error {
 	cxn.stream.Close()
 	cxn.sessManager.cleanup()
 	cxn.pl.Cleanup()
+	if cxn.recorder != nil {
+		// Writing playlists to object storage may be slow; don't hold the lock
+		go cxn.recorder.Finalize()
+	}
+	if cxn.params != nil && cxn.params.streamEndURL != "" {
+		go notifyStreamEnd(cxn.params.streamEndURL, mid)
+	}
 	glog.Infof("Ended stream with id=%s", mid)
 	delete(s.rtmpConnections, mid)
+	notifyEvent(EventStreamEnded, mid, nil)
 
 	if monitor.Enabled {
 		monitor.StreamEnded(cxn.nonce)
@@ -464,6 +829,12 @@ func removeRTMPStream(s *LivepeerServer, mid core.ManifestID) error {
 	return nil
 }
 
+// notifyStreamEnd calls the stream-end callback returned by the auth
+// webhook with a stream.ended event, retried as event webhook calls are
+func notifyStreamEnd(callbackURL string, mid core.ManifestID) {
+	NewEventWebhook(callbackURL, "").deliver(newStreamEvent(EventStreamEnded, mid, nil))
+}
+
 //End RTMP Publish Handlers
 
 //HLS Play Handlers
@@ -547,6 +918,270 @@ func getHLSSegmentHandler(s *LivepeerServer) func(url *url.URL) ([]byte, error)
 	}
 }
 
+func getDASHManifestHandler(s *LivepeerServer) func(url *url.URL) (*core.MPD, error) {
+	return func(url *url.URL) (*core.MPD, error) {
+		var manifestID core.ManifestID
+		if s.ExposeCurrentManifest && "/stream/current.mpd" == strings.ToLower(url.Path) {
+			manifestID = s.LastManifestID()
+		} else {
+			sid := parseStreamID(url.Path)
+			if sid.Rendition != "" {
+				// DASH has a single manifest per stream
+				return nil, vidplayer.ErrNotFound
+			}
+			manifestID = sid.ManifestID
+		}
+
+		s.connectionLock.RLock()
+		cxn, ok := s.rtmpConnections[manifestID]
+		s.connectionLock.RUnlock()
+		if !ok || cxn.pl == nil {
+			return nil, vidplayer.ErrNotFound
+		}
+		mpd := cxn.pl.GetDASHManifest()
+		if mpd == nil {
+			return nil, vidplayer.ErrNotFound
+		}
+		return mpd, nil
+	}
+}
+
+// getLLHLSMediaPlaylistHandler returns the low-latency media playlist of a
+// stream, honouring the blocking reload (_HLS_msn, _HLS_part) and delta
+// update (_HLS_skip) directives. The m3u8 encoder used by the LPMS player
+// has no support for the LL-HLS tags, so the playlist comes pre-encoded.
+func getLLHLSMediaPlaylistHandler(s *LivepeerServer) func(ctx context.Context, url *url.URL) ([]byte, error) {
+	return func(ctx context.Context, url *url.URL) ([]byte, error) {
+		strmID := parseStreamID(url.Path)
+		s.connectionLock.RLock()
+		cxn, ok := s.rtmpConnections[strmID.ManifestID]
+		s.connectionLock.RUnlock()
+		if !ok || cxn.pl == nil {
+			return nil, vidplayer.ErrNotFound
+		}
+
+		req := core.LLHLSRequest{MSN: -1, Part: -1}
+		query := url.Query()
+		var err error
+		if msn := query.Get("_HLS_msn"); msn != "" {
+			if req.MSN, err = strconv.ParseInt(msn, 10, 64); err != nil || req.MSN < 0 {
+				return nil, core.ErrLLHLSBadRequest
+			}
+		}
+		if part := query.Get("_HLS_part"); part != "" {
+			if req.Part, err = strconv.ParseInt(part, 10, 64); err != nil || req.Part < 0 {
+				return nil, core.ErrLLHLSBadRequest
+			}
+		}
+		req.Skip = query.Get("_HLS_skip") == "YES"
+
+		pl, err := cxn.pl.GetLLHLSMediaPlaylist(ctx, strmID.Rendition, req)
+		if err != nil {
+			return nil, err
+		}
+		if pl == nil {
+			return nil, vidplayer.ErrNotFound
+		}
+		return pl, nil
+	}
+}
+
+// Low-latency parts are served under this directory of their rendition,
+// as /stream/<manifestID>/<rendition>/part/<msn>.<part><ext>
+const llhlsPartDir = "/part/"
+
+// getLLHLSPartHandler looks up a low-latency part, waiting for it if it was
+// requested ahead of time. Returns the URI the part is stored at, along with
+// its data if kept on this node.
+func getLLHLSPartHandler(s *LivepeerServer) func(ctx context.Context, url *url.URL) (string, []byte, error) {
+	return func(ctx context.Context, url *url.URL) (string, []byte, error) {
+		i := strings.LastIndex(url.Path, llhlsPartDir)
+		if i < 0 {
+			return "", nil, vidplayer.ErrNotFound
+		}
+		strmID := parseStreamID(url.Path[:i])
+		name := url.Path[i+len(llhlsPartDir):]
+		nums := strings.Split(strings.TrimSuffix(name, path.Ext(name)), ".")
+		if len(nums) != 2 {
+			return "", nil, vidplayer.ErrNotFound
+		}
+		msn, err := strconv.ParseUint(nums[0], 10, 64)
+		if err != nil {
+			return "", nil, vidplayer.ErrNotFound
+		}
+		part, err := strconv.ParseUint(nums[1], 10, 64)
+		if err != nil {
+			return "", nil, vidplayer.ErrNotFound
+		}
+
+		s.connectionLock.RLock()
+		cxn, ok := s.rtmpConnections[strmID.ManifestID]
+		s.connectionLock.RUnlock()
+		if !ok || cxn.pl == nil {
+			return "", nil, vidplayer.ErrNotFound
+		}
+		uri, err := cxn.pl.GetLLHLSPart(ctx, strmID.Rendition, msn, part)
+		if err != nil {
+			return "", nil, err
+		}
+		if uri == "" {
+			return "", nil, vidplayer.ErrNotFound
+		}
+		if local, ok := cxn.pl.GetOSSession().(drivers.LocalSession); ok {
+			if data := local.GetData(uri); data != nil {
+				return uri, data, nil
+			}
+		}
+		return uri, nil, nil
+	}
+}
+
+func getThumbnailIndexHandler(s *LivepeerServer) func(url *url.URL) (*core.ThumbnailIndex, error) {
+	return func(url *url.URL) (*core.ThumbnailIndex, error) {
+		sid := parseStreamID(url.Path)
+		if sid.Rendition == "" {
+			return nil, vidplayer.ErrNotFound
+		}
+
+		s.connectionLock.RLock()
+		cxn, ok := s.rtmpConnections[sid.ManifestID]
+		s.connectionLock.RUnlock()
+		if !ok || cxn.pl == nil {
+			return nil, vidplayer.ErrNotFound
+		}
+		index := cxn.pl.GetThumbnailIndex(sid.Rendition)
+		if index == nil {
+			return nil, vidplayer.ErrNotFound
+		}
+		return index, nil
+	}
+}
+
+// streamHandler serves fragmented MP4 segments, initialization sections and
+// thumbnail images from local storage, since the LPMS player only serves
+// MPEG-TS segments, as well as DASH manifests, thumbnail indexes and
+// low-latency HLS media playlists. Everything else is deferred to the HTTP
+// mux.
+func (s *LivepeerServer) streamHandler() http.Handler {
+	getSegment := getHLSSegmentHandler(s)
+	getLLPlaylist := getLLHLSMediaPlaylistHandler(s)
+	getLLPart := getLLHLSPartHandler(s)
+	getMPD := getDASHManifestHandler(s)
+	getThumbnails := getThumbnailIndexHandler(s)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/stream/") {
+			s.HTTPMux.ServeHTTP(w, r)
+			return
+		}
+		ext := path.Ext(r.URL.Path)
+		if ext == ".mpd" {
+			mpd, err := getMPD(r.URL)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			data, err := mpd.Encode()
+			if err != nil {
+				glog.Errorf("Error encoding DASH manifest url=%s err=%v", r.URL.Path, err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("Content-Type", "application/dash+xml")
+			w.Write(data)
+			return
+		}
+		if ext == ".json" {
+			index, err := getThumbnails(r.URL)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(index)
+			return
+		}
+		if imgFormat, ok := core.ImageFormatFromExt(ext); ok {
+			data, err := getSegment(r.URL)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			w.Header().Set("Content-Type", imgFormat.ContentType())
+			w.Write(data)
+			return
+		}
+		if ext == ".m3u8" && s.isLowLatencyHLS(parseStreamID(r.URL.Path)) {
+			pl, err := getLLPlaylist(r.Context(), r.URL)
+			if err != nil {
+				llhlsError(w, err)
+				return
+			}
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+			w.Write(pl)
+			return
+		}
+		format, ok := core.SegmentFormatFromExt(ext)
+		if ok && strings.Contains(r.URL.Path, llhlsPartDir) {
+			uri, data, err := getLLPart(r.Context(), r.URL)
+			if err != nil {
+				llhlsError(w, err)
+				return
+			}
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			if data == nil {
+				http.Redirect(w, r, uri, http.StatusFound)
+				return
+			}
+			w.Header().Set("Content-Type", format.ContentType())
+			w.Write(data)
+			return
+		}
+		if !ok || format != core.FormatMP4 {
+			s.HTTPMux.ServeHTTP(w, r)
+			return
+		}
+		data, err := getSegment(r.URL)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Content-Type", format.ContentType())
+		w.Write(data)
+	})
+}
+
+// llhlsError replies to a low-latency HLS request that failed
+func llhlsError(w http.ResponseWriter, err error) {
+	switch err {
+	case core.ErrLLHLSBadRequest:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case core.ErrLLHLSTimeout:
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	default:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	}
+}
+
+// isLowLatencyHLS checks whether the ID refers to a media playlist of a
+// stream with low-latency HLS enabled
+func (s *LivepeerServer) isLowLatencyHLS(strmID core.StreamID) bool {
+	if strmID.Rendition == "" {
+		return false
+	}
+	s.connectionLock.RLock()
+	defer s.connectionLock.RUnlock()
+	cxn, ok := s.rtmpConnections[strmID.ManifestID]
+	return ok && cxn.pl != nil && cxn.pl.LowLatencyHLS()
+}
+
 //End HLS Play Handlers
 
 //Start RTMP Play Handlers
@@ -570,73 +1205,32 @@ func getRTMPStreamHandler(s *LivepeerServer) func(url *url.URL) (stream.RTMPVide
 
 // HandlePush processes request for HTTP ingest
 func (s *LivepeerServer) HandlePush(w http.ResponseWriter, r *http.Request) {
-	// we read this unconditionally, mostly for ffmpeg
-	body, err := ioutil.ReadAll(r.Body)
-
-	if err != nil {
-		httpErr := fmt.Sprintf(`Error reading http request body: %s`, err.Error())
-		glog.Error(httpErr)
-		http.Error(w, httpErr, http.StatusInternalServerError)
-		return
-	}
-	r.Body.Close()
 	r.URL = &url.URL{Scheme: "http", Host: r.Host, Path: r.URL.Path}
 
-	if ".ts" != path.Ext(r.URL.Path) {
+	if _, ok := core.SegmentFormatFromExt(path.Ext(r.URL.Path)); !ok {
 		// ffmpeg sends us a m3u8 as well, so ignore
 		// Alternatively, reject m3u8s explicitly and take any other type
 		// TODO also look at use content-type
+		io.Copy(ioutil.Discard, r.Body)
+		r.Body.Close()
 		http.Error(w, fmt.Sprintf(`ignoring file extension: %s`, path.Ext(r.URL.Path)), http.StatusBadRequest)
 		return
 	}
 
-	now := time.Now()
 	mid := parseManifestID(r.URL.Path)
 	if mid == "" {
+		readPushBody(r.Body, MaxPushBodySize)
+		r.Body.Close()
 		http.Error(w, `Bad URL`, http.StatusBadRequest)
 		return
 	}
-	s.connectionLock.Lock()
-	cxn, exists := s.rtmpConnections[mid]
-	if exists && cxn != nil {
-		cxn.lastUsed = now
-	}
-	s.connectionLock.Unlock()
-
-	// Check for presence and register if a fresh cxn
-	if !exists {
-		appData := (createRTMPStreamIDHandler(s))(r.URL)
-		if appData == nil {
-			http.Error(w, "Could not create stream ID: ", http.StatusInternalServerError)
-			return
-		}
-		st := stream.NewBasicRTMPVideoStream(appData)
-		params := streamParams(st)
-		params.resolution = r.Header.Get("Content-Resolution")
 
-		cxn, err = s.registerConnection(st)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		ticker := time.NewTicker(refreshIntervalHttpPush)
-
-		go func(s *LivepeerServer, mid core.ManifestID) {
-			defer ticker.Stop()
-			for range ticker.C {
-				var lastUsed time.Time
-				s.connectionLock.RLock()
-				if cxn, exists := s.rtmpConnections[mid]; exists {
-					lastUsed = cxn.lastUsed
-				}
-				s.connectionLock.RUnlock()
-				if time.Since(lastUsed) > refreshIntervalHttpPush {
-					_ = removeRTMPStream(s, mid)
-					return
-				}
-			}
-		}(s, mid)
+	if MaxPushBodySize > 0 && r.ContentLength > MaxPushBodySize {
+		// Fast path for encoders that announce the length upfront.
+		// Don't bother draining a body we know to be oversized.
+		r.Body.Close()
+		http.Error(w, errPushBodyTooLarge.Error(), http.StatusRequestEntityTooLarge)
+		return
 	}
 
 	fname := path.Base(r.URL.Path)
@@ -652,18 +1246,84 @@ func (s *LivepeerServer) HandlePush(w http.ResponseWriter, r *http.Request) {
 	}
 
 	seg := &stream.HLSSegment{
-		Data:     body,
 		Name:     fname,
 		SeqNo:    seq,
 		Duration: float64(duration) / 1000.0,
 	}
 
+	// Segments of a running stream are streamed straight into its external
+	// storage while they arrive, if the storage supports it
+	body := newPushBody(r.Body, MaxPushBodySize)
+	cxn := s.pushConnection(mid)
+	if cxn != nil && canStreamPushBody(cxn, seg) {
+		urls, err := processSegmentBody(cxn, seg, body, r.ContentLength)
+		r.Body.Close()
+		if body.tooLarge {
+			glog.Errorf("Rejecting segment for manifestID=%s: %v", mid, errPushBodyTooLarge)
+			http.Error(w, errPushBodyTooLarge.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.writePushResponse(w, r, cxn, seq, urls)
+		return
+	}
+
+	// Otherwise the segment is buffered. Authenticate a new stream while the
+	// body is still arriving, since the auth webhook may take a while, but
+	// only register the stream once the body has been accepted.
+	appDatac := make(chan stream.AppData, 1)
+	if cxn == nil {
+		go func() {
+			appDatac <- createRTMPStreamIDHandler(s)(r.URL)
+		}()
+	}
+
+	// Chunked bodies are read incrementally as they arrive
+	seg.Data, err = body.readAll()
+	r.Body.Close()
+	var appData stream.AppData
+	if cxn == nil {
+		appData = <-appDatac
+	}
+
+	if err == errPushBodyTooLarge {
+		glog.Errorf("Rejecting segment for manifestID=%s: %v", mid, err)
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		httpErr := fmt.Sprintf(`Error reading http request body: %s`, err.Error())
+		glog.Error(httpErr)
+		http.Error(w, httpErr, http.StatusInternalServerError)
+		return
+	}
+	if cxn == nil {
+		if appData == nil {
+			http.Error(w, "Could not create stream ID: ", http.StatusInternalServerError)
+			return
+		}
+		if cxn, err = s.registerPushConnection(r, mid, appData); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
 	// Do the transcoding!
 	urls, err := processSegment(cxn, seg)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	s.writePushResponse(w, r, cxn, seq, urls)
+}
+
+// writePushResponse replies to an HTTP push with the renditions of the
+// segment, inline if they are in memory and as URIs otherwise
+func (s *LivepeerServer) writePushResponse(w http.ResponseWriter, r *http.Request, cxn *rtmpConnection,
+	seq uint64, urls []string) {
 	if len(urls) == 0 {
 		http.Error(w, "No sessions available", http.StatusServiceUnavailable)
 		return
@@ -695,6 +1355,9 @@ func (s *LivepeerServer) HandlePush(w http.ResponseWriter, r *http.Request) {
 	for i, url := range urls {
 		mw.SetBoundary(boundary)
 		typ, ext, length := "video/MP2T", "ts", len(renditionData[i])
+		if cxn.params.format == core.FormatMP4 {
+			typ, ext = "video/mp4", "m4s"
+		}
 		if length == 0 {
 			typ, ext, length = "application/vnd+livepeer.uri", "txt", len(url)
 		}
@@ -720,6 +1383,140 @@ func (s *LivepeerServer) HandlePush(w http.ResponseWriter, r *http.Request) {
 	mw.Close()
 }
 
+// pushConnection returns the connection for an HTTP push stream, if the
+// stream is running, and marks it as used
+func (s *LivepeerServer) pushConnection(mid core.ManifestID) *rtmpConnection {
+	s.connectionLock.Lock()
+	defer s.connectionLock.Unlock()
+	cxn, exists := s.rtmpConnections[mid]
+	if exists && cxn != nil {
+		cxn.lastUsed = time.Now()
+	}
+	return cxn
+}
+
+// registerPushConnection registers a new HTTP push stream, which is removed
+// once no segment has been pushed to it for a while
+func (s *LivepeerServer) registerPushConnection(r *http.Request, mid core.ManifestID,
+	appData stream.AppData) (*rtmpConnection, error) {
+
+	st := stream.NewBasicRTMPVideoStream(appData)
+	params := streamParams(st)
+	params.resolution = r.Header.Get("Content-Resolution")
+
+	cxn, err := s.registerConnection(st)
+	if err != nil {
+		return nil, err
+	}
+
+	ticker := time.NewTicker(refreshIntervalHttpPush)
+
+	go func(s *LivepeerServer, mid core.ManifestID) {
+		defer ticker.Stop()
+		for range ticker.C {
+			var lastUsed time.Time
+			s.connectionLock.RLock()
+			if cxn, exists := s.rtmpConnections[mid]; exists {
+				lastUsed = cxn.lastUsed
+			}
+			s.connectionLock.RUnlock()
+			if time.Since(lastUsed) > refreshIntervalHttpPush {
+				_ = removeRTMPStream(s, mid)
+				return
+			}
+		}
+	}(s, mid)
+
+	return cxn, nil
+}
+
+// pushBodyHeadSize is how much of a pushed segment is kept to probe it
+// when the segment is streamed into storage
+const pushBodyHeadSize = 64 * 1024
+
+// pushBody reads an ingest segment as it arrives, failing with
+// errPushBodyTooLarge once more than `limit` bytes have been received. It
+// hashes the data read and keeps the start of it, so a segment streamed
+// into storage can still be signed and probed. A non-positive limit
+// disables the check.
+type pushBody struct {
+	r        io.Reader
+	limit    int64
+	n        int64
+	hash     hash.Hash
+	head     []byte
+	tooLarge bool
+}
+
+func newPushBody(body io.Reader, limit int64) *pushBody {
+	if body == nil {
+		body = bytes.NewReader(nil)
+	}
+	return &pushBody{r: body, limit: limit, hash: sha3.NewLegacyKeccak256()}
+}
+
+func (b *pushBody) Read(p []byte) (int, error) {
+	if b.tooLarge {
+		return 0, errPushBodyTooLarge
+	}
+	// Read one byte past the limit to detect oversized bodies without
+	// relying on the Content-Length header, which is absent when chunked
+	if b.limit > 0 && int64(len(p)) > b.limit-b.n+1 {
+		p = p[:b.limit-b.n+1]
+	}
+	n, err := b.r.Read(p)
+	if b.limit > 0 && b.n+int64(n) > b.limit {
+		b.tooLarge = true
+		return 0, errPushBodyTooLarge
+	}
+	b.n += int64(n)
+	b.hash.Write(p[:n])
+	if keep := pushBodyHeadSize - len(b.head); keep > 0 {
+		if keep > n {
+			keep = n
+		}
+		b.head = append(b.head, p[:keep]...)
+	}
+	return n, err
+}
+
+// Sum returns the Keccak256 hash of the data read so far
+func (b *pushBody) Sum() []byte {
+	return b.hash.Sum(nil)
+}
+
+// readAll reads the rest of the body into memory
+func (b *pushBody) readAll() ([]byte, error) {
+	data, err := ioutil.ReadAll(b)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// readPushBody reads a whole ingest segment into memory, subject to the
+// same limit as pushBody
+func readPushBody(body io.Reader, limit int64) ([]byte, error) {
+	if body == nil {
+		return nil, nil
+	}
+	return newPushBody(body, limit).readAll()
+}
+
+// canStreamPushBody returns whether segments pushed to the stream can be
+// streamed into its storage. This takes external storage, since the
+// orchestrators then fetch the source from there, and MPEG-TS, since
+// fragmented MP4 needs splitting before it is stored.
+func canStreamPushBody(cxn *rtmpConnection, seg *stream.HLSSegment) bool {
+	format, _ := core.SegmentFormatFromExt(path.Ext(seg.Name))
+	if format != core.FormatMPEGTS {
+		return false
+	}
+	sess := cxn.pl.GetOSSession()
+	_, ok := sess.(drivers.ReaderSession)
+	return ok && sess.IsExternal()
+}
+
 //Helper Methods Begin
 
 // StreamPrefix match all leading spaces, slashes and optionally `stream/`
@@ -797,6 +1594,26 @@ func (s *LivepeerServer) GetNodeStatus() *net.NodeStatus {
 	return res
 }
 
+// streamStatuses returns the statistics of the given stream, or of every
+// stream if the manifest ID is empty
+func (s *LivepeerServer) streamStatuses(mid core.ManifestID) []*streamStatus {
+	var cxns []*rtmpConnection
+	s.connectionLock.RLock()
+	for _, cxn := range s.rtmpConnections {
+		if cxn != nil && (mid == "" || cxn.mid == mid) {
+			cxns = append(cxns, cxn)
+		}
+	}
+	s.connectionLock.RUnlock()
+
+	statuses := make([]*streamStatus, 0, len(cxns))
+	for _, cxn := range cxns {
+		statuses = append(statuses, cxn.status())
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].ManifestID < statuses[j].ManifestID })
+	return statuses
+}
+
 // Debug helpers
 func (s *LivepeerServer) LatestPlaylist() core.PlaylistManager {
 	s.connectionLock.RLock()
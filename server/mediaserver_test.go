@@ -70,13 +70,14 @@ type stubDiscovery struct {
 	lock         *sync.Mutex
 	getOrchCalls int
 	getOrchError error
+	getOrchCaps  *net.Capabilities
 }
 
 func (d *stubDiscovery) GetURLs() []*url.URL {
 	return nil
 }
 
-func (d *stubDiscovery) GetOrchestrators(num int) ([]*net.OrchestratorInfo, error) {
+func (d *stubDiscovery) GetOrchestrators(num int, caps *net.Capabilities, pred func(*net.OrchestratorInfo) bool) ([]*net.OrchestratorInfo, error) {
 	if d.waitGetOrch != nil {
 		<-d.waitGetOrch
 	}
@@ -84,10 +85,20 @@ func (d *stubDiscovery) GetOrchestrators(num int) ([]*net.OrchestratorInfo, erro
 	if d.lock != nil {
 		d.lock.Lock()
 		d.getOrchCalls++
+		d.getOrchCaps = caps
 		err = d.getOrchError
 		d.lock.Unlock()
 	}
-	return d.infos, err
+	if pred == nil {
+		return d.infos, err
+	}
+	var infos []*net.OrchestratorInfo
+	for _, info := range d.infos {
+		if pred(info) {
+			infos = append(infos, info)
+		}
+	}
+	return infos, err
 }
 
 func (d *stubDiscovery) Size() int {
@@ -240,6 +251,61 @@ func TestSelectOrchestrator(t *testing.T) {
 	assert.Equal(sess[1].OrchestratorInfo, &net.OrchestratorInfo{TicketParams: protoParams2})
 }
 
+func TestSelectOrchestrator_Capabilities(t *testing.T) {
+	s := setupServer()
+	defer serverCleanup(s)
+	assert := assert.New(t)
+
+	mid := core.RandomManifestID()
+	sd := &stubDiscovery{lock: &sync.Mutex{}, infos: []*net.OrchestratorInfo{&net.OrchestratorInfo{}}}
+	s.LivepeerNode.OrchestratorPool = sd
+
+	// Discovery is asked for orchestrators that can transcode the stream
+	sp := &streamParameters{
+		mid:        mid,
+		profiles:   []ffmpeg.VideoProfile{ffmpeg.P720p30fps16x9, ffmpeg.P144p30fps16x9},
+		format:     core.FormatMP4,
+		renditions: core.RenditionProfiles{ffmpeg.P144p30fps16x9.Name: {Encoding: core.VideoEncoding{Codec: core.CodecH265}}},
+	}
+	pl := core.NewBasicPlaylistManager(mid, drivers.NodeStorage.NewSession(string(mid)))
+	_, err := selectOrchestrator(s.LivepeerNode, sp, pl, 1)
+	assert.Nil(err)
+	caps := sd.getOrchCaps
+	assert.Equal([]net.VideoProfile_VideoCodec{net.VideoProfile_H264, net.VideoProfile_H265}, caps.Codecs)
+	assert.Equal([]net.VideoProfile_Format{net.VideoProfile_MP4}, caps.Formats)
+	assert.Empty(caps.Storage)
+	assert.Equal(int64(1280*720), caps.MaxPixels)
+
+	// Orchestrators need to upload to the broadcaster's object store
+	bos := drivers.NewS3Driver("", drivers.S3BUCKET, "", "").NewSession(string(mid))
+	pl = core.NewBasicPlaylistManager(mid, bos)
+	_, err = selectOrchestrator(s.LivepeerNode, sp, pl, 1)
+	assert.Nil(err)
+	assert.Equal([]net.OSInfo_StorageType{net.OSInfo_S3}, sd.getOrchCaps.Storage)
+}
+
+func TestSelectOrchestrator_StreamOrchestrators(t *testing.T) {
+	s := setupServer()
+	defer serverCleanup(s)
+	assert := assert.New(t)
+
+	mid := core.RandomManifestID()
+	infos := []*net.OrchestratorInfo{{Transcoder: "https://a:8935"}, {Transcoder: "https://b:8935"}}
+	s.LivepeerNode.OrchestratorPool = &stubDiscovery{infos: infos}
+	pl := core.NewBasicPlaylistManager(mid, drivers.NodeStorage.NewSession(string(mid)))
+
+	// Discovery skips the orchestrators the stream can't use
+	sp := &streamParameters{mid: mid, orchestrators: map[string]bool{"https://b:8935": true}}
+	sess, err := selectOrchestrator(s.LivepeerNode, sp, pl, 2)
+	assert.Nil(err)
+	assert.Len(sess, 1)
+	assert.Equal("https://b:8935", sess[0].OrchestratorInfo.Transcoder)
+
+	sp.orchestrators = map[string]bool{"https://c:8935": true}
+	_, err = selectOrchestrator(s.LivepeerNode, sp, pl, 2)
+	assert.Equal(errNoOrchs, err)
+}
+
 func newStreamParams(mid core.ManifestID, rtmpKey string) *streamParameters {
 	return &streamParameters{mid: mid, rtmpKey: rtmpKey}
 }
@@ -434,6 +500,254 @@ func TestCreateRTMPStreamHandlerWebhook(t *testing.T) {
 	assert.Len(params.profiles, 0, "Unexpected value in presets")
 }
 
+func TestCreateRTMPStreamHandlerWebhook_StreamSettings(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	s := setupServer()
+	defer serverCleanup(s)
+	createSid := createRTMPStreamIDHandler(s)
+	u, _ := url.Parse("http://hot/something/id1")
+	defer func() { AuthWebhookURL = "" }()
+	defer func(os drivers.OSDriver) { RecordStorage = os }(RecordStorage)
+	RecordStorage = nil
+
+	var resp string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(resp))
+	}))
+	defer ts.Close()
+	AuthWebhookURL = ts.URL
+
+	// Nothing set by default
+	resp = `{"manifestID":"a"}`
+	params := createSid(u).(*streamParameters)
+	assert.Nil(params.maxPrice)
+	assert.Nil(params.os)
+	assert.Nil(params.orchestrators)
+	assert.Nil(params.recordOS)
+	assert.Equal("", params.streamEndURL)
+
+	resp = `{"manifestID":"a",
+		"maxPrice": {"pricePerUnit": 10, "pixelsPerUnit": 4},
+		"objectStore": "s3://key:secret@us-east-1/bucket",
+		"orchestrators": ["0xd4c6d36b6e3ffdb70b9dc1eec1a1bf2bbbee2d82", "o1.livepeer.org:8935"],
+		"record": true,
+		"streamEndCallback": "https://example.com/ended?id=a"}`
+	params = createSid(u).(*streamParameters)
+	require.NotNil(params)
+	assert.Zero(big.NewRat(5, 2).Cmp(params.maxPrice))
+	require.NotNil(params.os)
+	assert.Equal(params.os, params.storage())
+	assert.Equal(params.os, params.recordOS, "Should record into the stream's object store")
+	assert.Equal(map[string]bool{
+		"0xd4c6d36B6E3fFdB70b9dc1EEC1A1BF2BbBee2D82": true,
+		"https://o1.livepeer.org:8935":               true,
+	}, params.orchestrators)
+	assert.Equal("https://example.com/ended?id=a", params.streamEndURL)
+
+	// Recording follows the node's record store unless overridden
+	RecordStorage = drivers.NewMemoryDriver(nil)
+	resp = `{"manifestID":"a"}`
+	assert.Equal(RecordStorage, createSid(u).(*streamParameters).recordOS)
+	resp = `{"manifestID":"a", "record": true}`
+	assert.Equal(RecordStorage, createSid(u).(*streamParameters).recordOS)
+	resp = `{"manifestID":"a", "record": false}`
+	assert.Nil(createSid(u).(*streamParameters).recordOS)
+
+	// Invalid settings deny the stream
+	RecordStorage = nil
+	for _, invalid := range []string{
+		`"maxPrice": {"pricePerUnit": 1, "pixelsPerUnit": 0}`,
+		`"maxPrice": {"pricePerUnit": -1, "pixelsPerUnit": 1}`,
+		`"objectStore": "file:///tmp/streams"`,
+		`"objectStore": "s3://bucket"`,
+		`"orchestrators": ["not a url"]`,
+		`"record": true`,
+		`"streamEndCallback": "/ended"`,
+		`"streamEndCallback": "ftp://example.com/ended"`,
+	} {
+		resp = `{"manifestID":"a", ` + invalid + `}`
+		assert.Nil(createSid(u), invalid)
+	}
+}
+
+func TestCreateRTMPStreamHandlerWebhook_Audio(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	s := setupServer()
+	defer serverCleanup(s)
+	createSid := createRTMPStreamIDHandler(s)
+	u, _ := url.Parse("http://hot/something/id1")
+	defer func() { AuthWebhookURL = "" }()
+
+	var resp string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(resp))
+	}))
+	defer ts.Close()
+	AuthWebhookURL = ts.URL
+
+	// Source audio is passed through by default
+	resp = `{"manifestID":"a", "profiles": [{"name": "prof1", "bitrate": 432, "fps": 30, "width": 123, "height": 456}]}`
+	params := createSid(u).(*streamParameters)
+	assert.Nil(params.renditions)
+
+	resp = `{"manifestID":"a", "profiles": [
+		{"name": "prof1", "bitrate": 432, "fps": 30, "width": 123, "height": 456, "audioCodec": "none"},
+		{"name": "prof2", "bitrate": 765, "fps": 30, "width": 456, "height": 987, "audioCodec": "aac", "audioBitrate": 96000},
+		{"audioOnly": true, "audioCodec": "aac", "audioBitrate": 64000, "width": 123, "height": 456}]}`
+	params = createSid(u).(*streamParameters)
+	require.NotNil(params)
+	require.Len(params.profiles, 3)
+	assert.Equal(ffmpeg.VideoProfile{Name: "webhook_audio_aac_64000", Bitrate: "0", Resolution: "0x0"}, params.profiles[2])
+	assert.Equal(core.RenditionProfiles{
+		"prof1":                   {Audio: core.AudioProfile{Codec: core.AudioNone}},
+		"prof2":                   {Audio: core.AudioProfile{Codec: core.AudioAAC, Bitrate: 96000}},
+		"webhook_audio_aac_64000": {Audio: core.AudioProfile{Codec: core.AudioAAC, Bitrate: 64000, AudioOnly: true}},
+	}, params.renditions)
+
+	// Generated names are unique, even for renditions that only differ in
+	// settings left out of the name
+	resp = `{"manifestID":"a", "profiles": [
+		{"audioOnly": true},
+		{"audioOnly": true, "audioCodec": "aac"},
+		{"audioOnly": true, "audioCodec": "aac", "audioBitrate": 128000},
+		{"audioOnly": true, "audioCodec": "aac", "audioBitrate": 128000},
+		{"name": "webhook_audio_aac_2", "audioOnly": true, "audioCodec": "aac", "audioBitrate": 96000},
+		{"audioOnly": true, "audioCodec": "aac", "audioBitrate": 64000}]}`
+	params = createSid(u).(*streamParameters)
+	require.NotNil(params)
+	var names []string
+	for _, p := range params.profiles {
+		names = append(names, p.Name)
+	}
+	assert.Equal([]string{
+		"webhook_audio_copy",
+		"webhook_audio_aac",
+		"webhook_audio_aac_128000",
+		"webhook_audio_aac_128000_2",
+		"webhook_audio_aac_2",
+		"webhook_audio_aac_64000",
+	}, names)
+	assert.Len(params.renditions, 6)
+	assert.Equal(core.AudioProfile{Codec: core.AudioAAC, Bitrate: 96000, AudioOnly: true}, params.renditions["webhook_audio_aac_2"].Audio)
+
+	// Explicit names must be unique
+	resp = `{"manifestID":"a", "presets": ["P144p30fps16x9"], "profiles": [{"name": "P144p30fps16x9", "audioOnly": true}]}`
+	assert.Nil(createSid(u))
+	resp = `{"manifestID":"a", "profiles": [{"name": "p", "audioOnly": true}, {"name": "p", "audioCodec": "none"}]}`
+	assert.Nil(createSid(u))
+
+	// Invalid audio settings deny the stream
+	for _, invalid := range []string{
+		`{"name": "p", "audioCodec": "opus"}`,
+		`{"name": "p", "audioCodec": "none", "audioOnly": true}`,
+		`{"name": "p", "audioCodec": "aac", "audioBitrate": -1}`,
+	} {
+		resp = `{"manifestID":"a", "profiles": [` + invalid + `]}`
+		assert.Nil(createSid(u), invalid)
+	}
+}
+
+func TestCreateRTMPStreamHandlerWebhook_Encodings(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	s := setupServer()
+	defer serverCleanup(s)
+	createSid := createRTMPStreamIDHandler(s)
+	u, _ := url.Parse("http://hot/something/id1")
+	defer func() { AuthWebhookURL = "" }()
+
+	var resp string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(resp))
+	}))
+	defer ts.Close()
+	AuthWebhookURL = ts.URL
+
+	// Default encoding settings
+	resp = `{"manifestID":"a", "profiles": [{"name": "prof1", "bitrate": 432, "fps": 30, "width": 123, "height": 456}]}`
+	params := createSid(u).(*streamParameters)
+	assert.Nil(params.renditions)
+
+	resp = `{"manifestID":"a", "format": "mp4", "profiles": [
+		{"name": "prof1", "bitrate": 432, "width": 123, "height": 456, "profile": "baseline", "gop": 60},
+		{"name": "prof2", "bitrate": 765, "width": 456, "height": 987, "codec": "hevc", "crf": 28},
+		{"name": "prof3", "bitrate": 765, "width": 456, "height": 987, "codec": "vp9"},
+		{"name": "audio", "audioOnly": true, "codec": "h265"}]}`
+	params = createSid(u).(*streamParameters)
+	require.NotNil(params)
+	assert.Equal(core.RenditionProfiles{
+		"prof1": {Encoding: core.VideoEncoding{Profile: core.ProfileH264Baseline, GOP: 60}},
+		"prof2": {Encoding: core.VideoEncoding{Codec: core.CodecH265, CRF: 28}},
+		"prof3": {Encoding: core.VideoEncoding{Codec: core.CodecVP9}},
+		"audio": {Audio: core.AudioProfile{AudioOnly: true}},
+	}, params.renditions)
+
+	// Invalid encoding settings deny the stream
+	for _, invalid := range []string{
+		`{"name": "p", "codec": "av1"}`,
+		`{"name": "p", "profile": "extended"}`,
+		`{"name": "p", "codec": "h265", "profile": "high"}`,
+		`{"name": "p", "gop": -1}`,
+		`{"name": "p", "crf": 64}`,
+	} {
+		resp = `{"manifestID":"a", "profiles": [` + invalid + `]}`
+		assert.Nil(createSid(u), invalid)
+	}
+
+	// VP9 can only be muxed into MP4
+	resp = `{"manifestID":"a", "profiles": [{"name": "p", "codec": "vp9"}]}`
+	assert.Nil(createSid(u))
+}
+
+func TestCreateRTMPStreamHandlerWebhook_Thumbnails(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	s := setupServer()
+	defer serverCleanup(s)
+	createSid := createRTMPStreamIDHandler(s)
+	u, _ := url.Parse("http://hot/something/id1")
+	defer func() { AuthWebhookURL = "" }()
+
+	var resp string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(resp))
+	}))
+	defer ts.Close()
+	AuthWebhookURL = ts.URL
+
+	resp = `{"manifestID":"a", "profiles": [{"name": "prof1", "bitrate": 432, "width": 123, "height": 456}]}`
+	params := createSid(u).(*streamParameters)
+	assert.Nil(params.renditions)
+
+	// Thumbnail renditions ignore the audio and encoder settings
+	resp = `{"manifestID":"a", "profiles": [
+		{"name": "prof1", "bitrate": 432, "width": 123, "height": 456},
+		{"name": "thumb", "width": 320, "height": 180, "bitrate": 100, "thumbnail": "png", "thumbnailInterval": 2.5, "audioCodec": "aac", "gop": 60},
+		{"width": 640, "height": 360, "thumbnail": "jpeg"}]}`
+	params = createSid(u).(*streamParameters)
+	require.NotNil(params)
+	assert.Equal(core.RenditionProfiles{
+		"thumb":                     {Thumbnail: &core.ThumbnailProfile{Format: core.ImagePNG, Interval: 2500 * time.Millisecond}},
+		"webhook_thumbnail_640x360": {Thumbnail: &core.ThumbnailProfile{Format: core.ImageJPEG}},
+	}, params.renditions)
+	require.Len(params.profiles, 3)
+	assert.Equal("320x180", params.profiles[1].Resolution)
+	assert.Equal("0", params.profiles[1].Bitrate)
+	assert.Equal("webhook_thumbnail_640x360", params.profiles[2].Name)
+
+	// Invalid thumbnail settings deny the stream
+	for _, invalid := range []string{
+		`{"name": "p", "thumbnail": "gif"}`,
+		`{"name": "p", "thumbnail": "jpeg", "thumbnailInterval": -1}`,
+		`{"name": "p", "thumbnail": "jpeg", "audioOnly": true}`,
+	} {
+		resp = `{"manifestID":"a", "profiles": [` + invalid + `]}`
+		assert.Nil(createSid(u), invalid)
+	}
+}
+
 func TestCreateRTMPStreamHandler(t *testing.T) {
 
 	// Monkey patch rng to avoid unpredictability even when seeding
@@ -537,6 +851,46 @@ func TestEndRTMPStreamHandler(t *testing.T) {
 	}
 }
 
+func TestEndRTMPStreamHandler_Callback(t *testing.T) {
+	assert := assert.New(t)
+	s := setupServer()
+	defer serverCleanup(s)
+
+	var mu sync.Mutex
+	calls := 0
+	called := make(chan *streamEvent, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		first := calls == 1
+		mu.Unlock()
+		// Retried like event webhook calls
+		if first {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var ev streamEvent
+		assert.Nil(json.NewDecoder(r.Body).Decode(&ev))
+		assert.Equal(EventStreamEnded, r.Header.Get("Livepeer-Event"))
+		called <- &ev
+	}))
+	defer ts.Close()
+
+	params := &streamParameters{mid: core.ManifestID(t.Name()), streamEndURL: ts.URL}
+	st := stream.NewBasicRTMPVideoStream(params)
+	_, err := s.registerConnection(st)
+	require.Nil(t, err)
+	assert.Nil(endRTMPStreamHandler(s)(nil, st))
+
+	select {
+	case ev := <-called:
+		assert.Equal(EventStreamEnded, ev.Type)
+		assert.Equal(core.ManifestID(t.Name()), ev.ManifestID)
+	case <-time.After(3 * time.Second):
+		t.Error("Stream end callback not called")
+	}
+}
+
 // Should publish RTMP stream, turn the RTMP stream into HLS, and broadcast the HLS stream.
 func TestGotRTMPStreamHandler(t *testing.T) {
 	s := setupServer()
@@ -744,6 +1098,17 @@ func TestRegisterConnection(t *testing.T) {
 	_, err = s.registerConnection(strm)
 	assert.Equal(err, errAlreadyExists)
 
+	// Streams with their own object store write to it, and record into
+	// their record store
+	store := drivers.NewMemoryDriver(nil)
+	mid2 := core.ManifestID(t.Name() + "_os")
+	params := &streamParameters{mid: mid2, os: store, recordOS: drivers.NewMemoryDriver(nil)}
+	cxn, err = s.registerConnection(stream.NewBasicRTMPVideoStream(params))
+	assert.Nil(err)
+	assert.NotNil(store.GetSession(string(mid2)))
+	assert.Nil(drivers.NodeStorage.(*drivers.MemoryOS).GetSession(string(mid2)))
+	assert.NotNil(cxn.recorder)
+
 	// Ensure thread-safety under -race
 	var wg sync.WaitGroup
 	for i := 0; i < 500; i++ {
@@ -915,3 +1280,215 @@ func TestParsePresets(t *testing.T) {
 	assert.Equal([]ffmpeg.VideoProfile{ffmpeg.P240p30fps16x9, ffmpeg.P720p30fps16x9}, p)
 
 }
+
+func TestStreamHandler_FragmentedMP4(t *testing.T) {
+	assert := assert.New(t)
+	s := setupServer()
+	defer serverCleanup(s)
+
+	sess := drivers.NodeStorage.NewSession("fmp4")
+	defer sess.EndSession()
+	_, err := sess.SaveData("P144p30fps16x9/init/abc.mp4", []byte("init"))
+	require.Nil(t, err)
+	_, err = sess.SaveData("P144p30fps16x9/1.m4s", []byte("fragment"))
+	require.Nil(t, err)
+
+	handler := s.streamHandler()
+	get := func(path string) *http.Response {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w.Result()
+	}
+
+	resp := get("/stream/fmp4/P144p30fps16x9/init/abc.mp4")
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal("video/mp4", resp.Header.Get("Content-Type"))
+	assert.Equal("init", string(body))
+
+	resp = get("/stream/fmp4/P144p30fps16x9/1.m4s")
+	body, _ = ioutil.ReadAll(resp.Body)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal("fragment", string(body))
+
+	resp = get("/stream/fmp4/P144p30fps16x9/2.m4s")
+	assert.Equal(http.StatusNotFound, resp.StatusCode)
+}
+
+func TestStreamHandler_LowLatencyHLS(t *testing.T) {
+	assert := assert.New(t)
+	s := setupServer()
+	defer serverCleanup(s)
+
+	mid := core.ManifestID("llhls")
+	storage := drivers.NodeStorage.NewSession(string(mid))
+	pl := core.NewBasicPlaylistManager(mid, storage)
+	pl.EnableLowLatencyHLS()
+	s.connectionLock.Lock()
+	s.rtmpConnections[mid] = &rtmpConnection{mid: mid, pl: pl}
+	s.connectionLock.Unlock()
+	defer func() {
+		s.connectionLock.Lock()
+		delete(s.rtmpConnections, mid)
+		s.connectionLock.Unlock()
+		storage.EndSession()
+	}()
+
+	profile := &ffmpeg.P144p30fps16x9
+	uri, err := storage.SaveData(profile.Name+"/0.ts", []byte("part"))
+	require.Nil(t, err)
+	require.Nil(t, pl.InsertHLSPart(profile, 0, uri, 2, true))
+
+	handler := s.streamHandler()
+	get := func(path string) *http.Response {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w.Result()
+	}
+
+	resp := get("/stream/llhls/P144p30fps16x9.m3u8?_HLS_msn=0&_HLS_part=0")
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal("application/vnd.apple.mpegurl", resp.Header.Get("Content-Type"))
+	assert.Contains(string(body), "#EXT-X-PART:DURATION=2.000,URI=\"/stream/llhls/P144p30fps16x9/part/0.0.ts\"")
+	assert.Contains(string(body), "#EXT-X-PRELOAD-HINT:TYPE=PART,URI=\"/stream/llhls/P144p30fps16x9/part/0.1.ts\"")
+
+	// parts are served at their fixed URIs
+	resp = get("/stream/llhls/P144p30fps16x9/part/0.0.ts")
+	body, _ = ioutil.ReadAll(resp.Body)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal("part", string(body))
+	resp = get("/stream/llhls/P144p30fps16x9/part/0.x.ts")
+	assert.Equal(http.StatusNotFound, resp.StatusCode)
+	resp = get("/stream/llhls/P144p30fps16x9/part/5.0.ts")
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+
+	resp = get("/stream/llhls/P144p30fps16x9.m3u8?_HLS_msn=abc")
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+	resp = get("/stream/llhls/P144p30fps16x9.m3u8?_HLS_part=0")
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+	resp = get("/stream/llhls/P144p30fps16x9.m3u8?_HLS_msn=5")
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+
+	// request is held until the part is available
+	done := make(chan *http.Response)
+	go func() { done <- get("/stream/llhls/P144p30fps16x9.m3u8?_HLS_msn=0&_HLS_part=1") }()
+	time.Sleep(20 * time.Millisecond)
+	uri, err = storage.SaveData(profile.Name+"/1.ts", []byte("part"))
+	require.Nil(t, err)
+	require.Nil(t, pl.InsertHLSPart(profile, 1, uri, 2, true))
+	resp = <-done
+	body, _ = ioutil.ReadAll(resp.Body)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Contains(string(body), "/stream/llhls/P144p30fps16x9/part/0.1.ts")
+
+	// the hinted part is held until available
+	go func() { done <- get("/stream/llhls/P144p30fps16x9/part/0.2.ts") }()
+	time.Sleep(20 * time.Millisecond)
+	uri, err = storage.SaveData(profile.Name+"/2.ts", []byte("part2"))
+	require.Nil(t, err)
+	require.Nil(t, pl.InsertHLSPart(profile, 2, uri, 2, true))
+	resp = <-done
+	body, _ = ioutil.ReadAll(resp.Body)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal("part2", string(body))
+
+	// unknown rendition
+	resp = get("/stream/llhls/P240p30fps16x9.m3u8")
+	assert.Equal(http.StatusNotFound, resp.StatusCode)
+}
+
+func TestStreamHandler_DASH(t *testing.T) {
+	assert := assert.New(t)
+	s := setupServer()
+	defer serverCleanup(s)
+
+	mid := core.ManifestID("dash")
+	pl := core.NewBasicPlaylistManager(mid, nil)
+	s.connectionLock.Lock()
+	s.rtmpConnections[mid] = &rtmpConnection{mid: mid, pl: pl}
+	s.connectionLock.Unlock()
+	defer func() {
+		s.connectionLock.Lock()
+		delete(s.rtmpConnections, mid)
+		s.connectionLock.Unlock()
+	}()
+
+	handler := s.streamHandler()
+	get := func(path string) *http.Response {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w.Result()
+	}
+
+	// no segments yet
+	resp := get("/stream/dash.mpd")
+	assert.Equal(http.StatusNotFound, resp.StatusCode)
+
+	require.Nil(t, pl.InsertHLSSegment(&ffmpeg.P144p30fps16x9, 0, "/stream/dash/P144p30fps16x9/0.ts", 2))
+	resp = get("/stream/dash.mpd")
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal("application/dash+xml", resp.Header.Get("Content-Type"))
+	assert.Contains(string(body), `<SegmentURL media="/stream/dash/P144p30fps16x9/0.ts"></SegmentURL>`)
+
+	resp = get("/stream/dash/P144p30fps16x9.mpd")
+	assert.Equal(http.StatusNotFound, resp.StatusCode)
+	resp = get("/stream/unknown.mpd")
+	assert.Equal(http.StatusNotFound, resp.StatusCode)
+}
+
+func TestStreamHandler_Thumbnails(t *testing.T) {
+	assert := assert.New(t)
+	s := setupServer()
+	defer serverCleanup(s)
+
+	mid := core.ManifestID("thumbs")
+	storage := drivers.NodeStorage.NewSession(string(mid))
+	pl := core.NewBasicPlaylistManager(mid, storage)
+	profile := &ffmpeg.P144p30fps16x9
+	pl.SetRenditionProfiles(core.RenditionProfiles{profile.Name: {Thumbnail: &core.ThumbnailProfile{Format: core.ImagePNG}}})
+	s.connectionLock.Lock()
+	s.rtmpConnections[mid] = &rtmpConnection{mid: mid, pl: pl}
+	s.connectionLock.Unlock()
+	defer func() {
+		s.connectionLock.Lock()
+		delete(s.rtmpConnections, mid)
+		s.connectionLock.Unlock()
+		storage.EndSession()
+	}()
+
+	handler := s.streamHandler()
+	get := func(path string) *http.Response {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w.Result()
+	}
+
+	// no images yet
+	resp := get("/stream/thumbs/P144p30fps16x9.json")
+	assert.Equal(http.StatusNotFound, resp.StatusCode)
+
+	require.Nil(t, pl.InsertThumbnail(profile, 0, []byte("image"), 2))
+	resp = get("/stream/thumbs/P144p30fps16x9.json")
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal("application/json", resp.Header.Get("Content-Type"))
+	var index core.ThumbnailIndex
+	require.Nil(t, json.NewDecoder(resp.Body).Decode(&index))
+	require.Len(t, index.Images, 1)
+	assert.Equal("/stream/thumbs/P144p30fps16x9/0.png", index.Images[0].URI)
+	assert.Equal(2.0, index.Images[0].Time)
+
+	resp = get(index.Images[0].URI)
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal("image/png", resp.Header.Get("Content-Type"))
+	assert.Equal("image", string(body))
+
+	resp = get("/stream/thumbs/P144p30fps16x9/1.png")
+	assert.Equal(http.StatusNotFound, resp.StatusCode)
+	resp = get("/stream/thumbs.json")
+	assert.Equal(http.StatusNotFound, resp.StatusCode)
+	resp = get("/stream/unknown/P144p30fps16x9.json")
+	assert.Equal(http.StatusNotFound, resp.StatusCode)
+}
@@ -0,0 +1,240 @@
+package server
+
+import (
+	"errors"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/golang/glog"
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/net"
+)
+
+// OrchAccess restricts the orchestrators a broadcaster uses. If nil, every
+// orchestrator is permitted.
+var OrchAccess *OrchAccessList
+
+// OrchBanDuration is how long an orchestrator is denied after failing
+// verification. Zero disables automatic bans.
+var OrchBanDuration = time.Hour
+
+var ErrInvalidOrchestrator = errors.New("ErrInvalidOrchestrator")
+
+// OrchAccessList is a persisted allow/deny list of orchestrators, keyed by
+// Ethereum address or service URI. Deny entries take precedence. If there
+// are allow entries, only orchestrators matching one of them are permitted.
+type OrchAccessList struct {
+	store common.OrchAccessStore
+
+	mu    sync.RWMutex
+	allow map[string]*common.DBOrchAccess
+	deny  map[string]*common.DBOrchAccess
+}
+
+// NewOrchAccessList loads the access list kept in the store
+func NewOrchAccessList(store common.OrchAccessStore) (*OrchAccessList, error) {
+	entries, err := store.OrchAccessList(time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	l := &OrchAccessList{
+		store: store,
+		allow: make(map[string]*common.DBOrchAccess),
+		deny:  make(map[string]*common.DBOrchAccess),
+	}
+	for _, entry := range entries {
+		l.entries(entry.Policy)[entry.Orchestrator] = entry
+	}
+	return l, nil
+}
+
+// NormalizeOrchestrator returns the canonical form of an orchestrator's
+// Ethereum address or service URI, as used for access list entries
+func NormalizeOrchestrator(orch string) (string, error) {
+	orch = strings.TrimSpace(orch)
+	if ethcommon.IsHexAddress(orch) {
+		return ethcommon.HexToAddress(orch).Hex(), nil
+	}
+	if !strings.HasPrefix(orch, "http") {
+		orch = "https://" + orch
+	}
+	uri, err := url.ParseRequestURI(orch)
+	if err != nil || uri.Host == "" {
+		return "", ErrInvalidOrchestrator
+	}
+	return uri.Scheme + "://" + uri.Host, nil
+}
+
+// Allow adds an orchestrator to the allow list, removing it from the deny list
+func (l *OrchAccessList) Allow(orch, reason string) error {
+	return l.set(orch, common.OrchAccessAllow, reason, 0, true)
+}
+
+// Deny adds an orchestrator to the deny list, removing it from the allow
+// list. A ttl of zero denies it until removed.
+func (l *OrchAccessList) Deny(orch, reason string, ttl time.Duration) error {
+	return l.set(orch, common.OrchAccessDeny, reason, ttl, true)
+}
+
+// Remove removes an orchestrator from the allow and deny lists
+func (l *OrchAccessList) Remove(orch string) error {
+	key, err := NormalizeOrchestrator(orch)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.store.DeleteOrchAccess(key); err != nil {
+		return err
+	}
+	delete(l.allow, key)
+	delete(l.deny, key)
+	return nil
+}
+
+// Ban temporarily denies the orchestrator for OrchBanDuration, without
+// touching an explicit allow entry. Orchestrators already denied
+// indefinitely stay that way.
+func (l *OrchAccessList) Ban(info *net.OrchestratorInfo, reason string) {
+	if l == nil || OrchBanDuration <= 0 || info == nil {
+		return
+	}
+	orch := info.GetTranscoder()
+	if recipient := info.GetTicketParams().GetRecipient(); len(recipient) > 0 {
+		orch = ethcommon.BytesToAddress(recipient).Hex()
+	}
+	if key, err := NormalizeOrchestrator(orch); err == nil {
+		l.mu.RLock()
+		entry, ok := l.deny[key]
+		l.mu.RUnlock()
+		if ok && entry.ExpiresAt == 0 {
+			return
+		}
+	}
+	if err := l.set(orch, common.OrchAccessDeny, reason, OrchBanDuration, false); err != nil {
+		glog.Errorf("Error banning orchestrator orch=%s err=%v", orch, err)
+		return
+	}
+	glog.Infof("Banned orchestrator orch=%s duration=%v reason=%q", orch, OrchBanDuration, reason)
+}
+
+func (l *OrchAccessList) set(orch, policy, reason string, ttl time.Duration, replace bool) error {
+	key, err := NormalizeOrchestrator(orch)
+	if err != nil {
+		return err
+	}
+	entry := &common.DBOrchAccess{Orchestrator: key, Policy: policy, Reason: reason}
+	if ttl > 0 {
+		entry.ExpiresAt = time.Now().Add(ttl).Unix()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if replace {
+		if err := l.store.DeleteOrchAccess(key); err != nil {
+			return err
+		}
+		delete(l.allow, key)
+		delete(l.deny, key)
+	}
+	if err := l.store.SetOrchAccess(entry); err != nil {
+		return err
+	}
+	l.entries(policy)[key] = entry
+	return nil
+}
+
+func (l *OrchAccessList) entries(policy string) map[string]*common.DBOrchAccess {
+	if policy == common.OrchAccessAllow {
+		return l.allow
+	}
+	return l.deny
+}
+
+// Entries returns the entries that have not expired, allow entries first
+func (l *OrchAccessList) Entries() []*common.DBOrchAccess {
+	if l == nil {
+		return []*common.DBOrchAccess{}
+	}
+	now := time.Now().Unix()
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	entries := []*common.DBOrchAccess{}
+	for _, m := range []map[string]*common.DBOrchAccess{l.allow, l.deny} {
+		var keys []string
+		for key, entry := range m {
+			if !expired(entry, now) {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			entries = append(entries, m[key])
+		}
+	}
+	return entries
+}
+
+// Permitted checks whether the orchestrator can be used, by its Ethereum
+// address and advertised service URI
+func (l *OrchAccessList) Permitted(info *net.OrchestratorInfo) bool {
+	if l == nil {
+		return true
+	}
+	return l.permitted(orchestratorKeys(info), true)
+}
+
+// orchestratorKeys returns the access list keys of an orchestrator: its
+// Ethereum address, if known, and its service URI
+func orchestratorKeys(info *net.OrchestratorInfo) []string {
+	var keys []string
+	if recipient := info.GetTicketParams().GetRecipient(); len(recipient) > 0 {
+		keys = append(keys, ethcommon.BytesToAddress(recipient).Hex())
+	}
+	if key, err := NormalizeOrchestrator(info.GetTranscoder()); err == nil {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// PermittedURI checks whether an orchestrator can be used by its service
+// URI alone. Allow entries are not considered since they may be keyed by
+// address, which is only known once the orchestrator is contacted.
+func (l *OrchAccessList) PermittedURI(uri *url.URL) bool {
+	if l == nil || uri == nil {
+		return true
+	}
+	key, err := NormalizeOrchestrator(uri.String())
+	if err != nil {
+		return true
+	}
+	return l.permitted([]string{key}, false)
+}
+
+func (l *OrchAccessList) permitted(keys []string, checkAllow bool) bool {
+	now := time.Now().Unix()
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for _, key := range keys {
+		if entry, ok := l.deny[key]; ok && !expired(entry, now) {
+			return false
+		}
+	}
+	if !checkAllow || len(l.allow) == 0 {
+		return true
+	}
+	for _, key := range keys {
+		if _, ok := l.allow[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func expired(entry *common.DBOrchAccess, now int64) bool {
+	return entry.ExpiresAt > 0 && entry.ExpiresAt <= now
+}
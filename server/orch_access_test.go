@@ -0,0 +1,270 @@
+package server
+
+import (
+	"errors"
+	"math/big"
+	"net/url"
+	"testing"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/net"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubOrchAccessStore struct {
+	entries map[string]*common.DBOrchAccess
+	err     error
+}
+
+func newStubOrchAccessStore() *stubOrchAccessStore {
+	return &stubOrchAccessStore{entries: make(map[string]*common.DBOrchAccess)}
+}
+
+func (s *stubOrchAccessStore) SetOrchAccess(entry *common.DBOrchAccess) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.entries[entry.Orchestrator+"/"+entry.Policy] = entry
+	return nil
+}
+
+func (s *stubOrchAccessStore) DeleteOrchAccess(orch string) error {
+	if s.err != nil {
+		return s.err
+	}
+	delete(s.entries, orch+"/"+common.OrchAccessAllow)
+	delete(s.entries, orch+"/"+common.OrchAccessDeny)
+	return nil
+}
+
+func (s *stubOrchAccessStore) OrchAccessList(now int64) ([]*common.DBOrchAccess, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	var entries []*common.DBOrchAccess
+	for _, entry := range s.entries {
+		if entry.ExpiresAt == 0 || entry.ExpiresAt > now {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func orchInfo(addr string, uri string) *net.OrchestratorInfo {
+	info := &net.OrchestratorInfo{Transcoder: uri}
+	if addr != "" {
+		info.TicketParams = &net.TicketParams{Recipient: ethcommon.HexToAddress(addr).Bytes()}
+	}
+	return info
+}
+
+func TestNormalizeOrchestrator(t *testing.T) {
+	assert := assert.New(t)
+
+	addr := ethcommon.HexToAddress("0xd4c6d36b6e3ffdb70b9dc1eec1a1bf2bbbee2d82").Hex()
+	tests := map[string]string{
+		"0xd4c6d36b6e3ffdb70b9dc1eec1a1bf2bbbee2d82": addr,
+		" " + addr + " ":                    addr,
+		"https://127.0.0.1:8935":            "https://127.0.0.1:8935",
+		"https://127.0.0.1:8935/":           "https://127.0.0.1:8935",
+		"127.0.0.1:8935":                    "https://127.0.0.1:8935",
+		"http://orch.example.com:8935/path": "http://orch.example.com:8935",
+	}
+	for in, expected := range tests {
+		out, err := NormalizeOrchestrator(in)
+		assert.Nil(err, in)
+		assert.Equal(expected, out, in)
+	}
+
+	for _, in := range []string{"", "https://", "http://%zz"} {
+		_, err := NormalizeOrchestrator(in)
+		assert.Equal(ErrInvalidOrchestrator, err, in)
+	}
+}
+
+func TestOrchAccessList_Nil(t *testing.T) {
+	assert := assert.New(t)
+	var l *OrchAccessList
+	assert.True(l.Permitted(orchInfo("0x01", "https://a:8935")))
+	assert.True(l.PermittedURI(&url.URL{Scheme: "https", Host: "a:8935"}))
+	assert.Empty(l.Entries())
+	l.Ban(orchInfo("0x01", "https://a:8935"), "bad")
+}
+
+func TestOrchAccessList_AllowDeny(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	store := newStubOrchAccessStore()
+	l, err := NewOrchAccessList(store)
+	require.Nil(err)
+
+	a := orchInfo("0x01", "https://a:8935")
+	b := orchInfo("0x02", "https://b:8935")
+	c := orchInfo("", "https://c:8935")
+	uriA, _ := url.Parse("https://a:8935")
+
+	// everything is permitted by default
+	assert.True(l.Permitted(a))
+	assert.True(l.Permitted(b))
+	assert.True(l.Permitted(c))
+
+	// deny by address
+	require.Nil(l.Deny("0x0000000000000000000000000000000000000001", "bad output", 0))
+	assert.False(l.Permitted(a))
+	assert.True(l.Permitted(b))
+	// not known by URI
+	assert.True(l.PermittedURI(uriA))
+
+	// deny by URI
+	require.Nil(l.Deny("a:8935", "", 0))
+	assert.False(l.PermittedURI(uriA))
+
+	// allowing restricts to the allow list, but deny takes precedence
+	require.Nil(l.Allow("https://c:8935", "trusted"))
+	assert.True(l.Permitted(c))
+	assert.False(l.Permitted(b))
+	assert.False(l.Permitted(a))
+	require.Nil(l.Allow("0x0000000000000000000000000000000000000002", ""))
+	assert.True(l.Permitted(b))
+
+	// allowing a denied orchestrator replaces the deny entry
+	require.Nil(l.Allow("https://a:8935", ""))
+	assert.True(l.PermittedURI(uriA))
+	assert.False(l.Permitted(a)) // still denied by address
+
+	assert.Len(l.Entries(), 4)
+	assert.Equal(common.OrchAccessAllow, l.Entries()[0].Policy)
+	assert.Equal(common.OrchAccessDeny, l.Entries()[3].Policy)
+
+	// removing
+	require.Nil(l.Remove("0x0000000000000000000000000000000000000001"))
+	assert.True(l.Permitted(a))
+	assert.Equal(ErrInvalidOrchestrator, l.Remove(""))
+
+	// entries are persisted
+	l, err = NewOrchAccessList(store)
+	require.Nil(err)
+	assert.Len(l.Entries(), 3)
+	assert.True(l.Permitted(a))
+	assert.True(l.Permitted(b))
+	assert.True(l.Permitted(c))
+	assert.False(l.Permitted(orchInfo("0x03", "https://d:8935")))
+
+	// store errors
+	store.err = errors.New("store error")
+	assert.Equal(store.err, l.Deny("https://d:8935", "", 0))
+	assert.True(l.Permitted(orchInfo("", "https://b:8935")))
+	_, err = NewOrchAccessList(store)
+	assert.Equal(store.err, err)
+}
+
+func TestOrchAccessList_Expiry(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	l, err := NewOrchAccessList(newStubOrchAccessStore())
+	require.Nil(err)
+
+	a := orchInfo("0x01", "https://a:8935")
+	require.Nil(l.Deny("https://a:8935", "", time.Hour))
+	assert.False(l.Permitted(a))
+	assert.NotZero(l.Entries()[0].ExpiresAt)
+
+	l.deny["https://a:8935"].ExpiresAt = time.Now().Unix() - 1
+	assert.True(l.Permitted(a))
+	assert.Empty(l.Entries())
+}
+
+func TestOrchAccessList_Ban(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	defer func(d time.Duration) { OrchBanDuration = d }(OrchBanDuration)
+	store := newStubOrchAccessStore()
+	l, err := NewOrchAccessList(store)
+	require.Nil(err)
+
+	a := orchInfo("0x01", "https://a:8935")
+	b := orchInfo("", "https://b:8935")
+	require.Nil(l.Allow("0x0000000000000000000000000000000000000001", ""))
+	require.Nil(l.Allow("https://b:8935", ""))
+
+	// disabled
+	OrchBanDuration = 0
+	l.Ban(a, "verification failed")
+	assert.True(l.Permitted(a))
+
+	// banned by address if known, keeping allow entries
+	OrchBanDuration = time.Hour
+	l.Ban(a, "verification failed")
+	l.Ban(b, "verification failed")
+	assert.False(l.Permitted(a))
+	assert.False(l.Permitted(b))
+	entries := l.Entries()
+	require.Len(entries, 4)
+	assert.Equal("0x0000000000000000000000000000000000000001", entries[2].Orchestrator)
+	assert.Equal("verification failed", entries[2].Reason)
+	assert.InDelta(time.Now().Add(time.Hour).Unix(), entries[2].ExpiresAt, 5)
+	assert.Equal("https://b:8935", entries[3].Orchestrator)
+	assert.Len(store.entries, 4)
+
+	// bans expire
+	l.deny["https://b:8935"].ExpiresAt = time.Now().Unix() - 1
+	assert.True(l.Permitted(b))
+
+	// indefinite denials are not shortened
+	require.Nil(l.Deny("https://c:8935", "", 0))
+	l.Ban(orchInfo("", "https://c:8935"), "verification failed")
+	assert.Zero(l.deny["https://c:8935"].ExpiresAt)
+}
+
+func TestPermittedOrchestrators(t *testing.T) {
+	defer func(l *OrchAccessList) { OrchAccess = l }(OrchAccess)
+	assert := assert.New(t)
+
+	infos := []*net.OrchestratorInfo{orchInfo("0x01", "https://a:8935"), orchInfo("0x02", "https://b:8935")}
+	OrchAccess = nil
+	assert.Len(permittedOrchestrators(infos), 2)
+
+	l, err := NewOrchAccessList(newStubOrchAccessStore())
+	require.Nil(t, err)
+	require.Nil(t, l.Deny("https://a:8935", "", 0))
+	OrchAccess = l
+	permitted := permittedOrchestrators(infos)
+	assert.Len(permitted, 1)
+	assert.Equal("https://b:8935", permitted[0].Transcoder)
+}
+
+func TestStreamParameters_Permitted(t *testing.T) {
+	assert := assert.New(t)
+
+	a, b, c := orchInfo("0x01", "https://a:8935"), orchInfo("0x02", "https://b:8935"), orchInfo("", "https://c:8935")
+	a.PriceInfo = &net.PriceInfo{PricePerUnit: 1, PixelsPerUnit: 1}
+	b.PriceInfo = &net.PriceInfo{PricePerUnit: 3, PixelsPerUnit: 1}
+
+	// Any orchestrator by default
+	params := &streamParameters{}
+	assert.True(params.permitted(a))
+	assert.True(params.permitted(b))
+	assert.True(params.permitted(c))
+
+	// Orchestrators are matched by address or service URI
+	params = &streamParameters{orchestrators: map[string]bool{
+		"0x0000000000000000000000000000000000000002": true,
+		"https://c:8935": true,
+	}}
+	assert.False(params.permitted(a))
+	assert.True(params.permitted(b))
+	assert.True(params.permitted(c))
+
+	// Orchestrators above the stream's price are skipped, but not those
+	// without a price
+	params = &streamParameters{maxPrice: big.NewRat(2, 1)}
+	assert.True(params.permitted(a))
+	assert.False(params.permitted(b))
+	assert.True(params.permitted(c))
+
+	params.orchestrators = map[string]bool{"https://b:8935": true}
+	assert.False(params.permitted(b))
+}
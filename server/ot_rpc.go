@@ -21,6 +21,7 @@ import (
 	"time"
 
 	"github.com/cenkalti/backoff"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/golang/glog"
 	"github.com/livepeer/lpms/ffmpeg"
 	"golang.org/x/net/http2"
@@ -31,11 +32,14 @@ import (
 
 	"github.com/livepeer/go-livepeer/common"
 	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/drivers"
 	"github.com/livepeer/go-livepeer/net"
 )
 
 const protoVerLPT = "Livepeer-Transcoder-1.0"
 const transcodingErrorMimeType = "livepeer/transcoding-error"
+const heartbeatMimeType = "livepeer/heartbeat"
+const renditionURIMimeType = "application/vnd+livepeer.uri"
 
 var errSecret = errors.New("Invalid secret")
 var errZeroCapacity = errors.New("Zero capacity")
@@ -71,6 +75,9 @@ func checkTranscoderError(err error) error {
 		if s.Message() == errZeroCapacity.Error() { // consider this unrecoverable
 			return core.NewRemoteTranscoderFatalError(errZeroCapacity)
 		}
+		if s.Message() == core.ErrTranscoderDrained.Error() { // the operator wants the transcoder gone
+			return core.NewRemoteTranscoderFatalError(core.ErrTranscoderDrained)
+		}
 		if status.Code(err) == codes.Canceled {
 			return core.NewRemoteTranscoderFatalError(fmt.Errorf("Execution interrupted"))
 		}
@@ -93,7 +100,7 @@ func runTranscoder(n *core.LivepeerNode, orchAddr string, capacity int) error {
 	ctx, cancel := context.WithCancel(ctx)
 	// Silence linter
 	defer cancel()
-	r, err := c.RegisterTranscoder(ctx, &net.RegisterRequest{Secret: n.OrchSecret, Capacity: int64(capacity)})
+	r, err := c.RegisterTranscoder(ctx, &net.RegisterRequest{Secret: n.OrchSecret, Capacity: int64(capacity), Capabilities: n.Capabilities()})
 	if err := checkTranscoderError(err); err != nil {
 		glog.Error("Could not register transcoder to orchestrator ", err)
 		return err
@@ -122,6 +129,10 @@ func runTranscoder(n *core.LivepeerNode, orchAddr string, capacity int) error {
 			wg.Wait()
 			return err
 		}
+		if notify.Heartbeat {
+			go sendHeartbeat(n, orchAddr, httpc, notify)
+			continue
+		}
 		wg.Add(1)
 		go func() {
 			runTranscode(n, orchAddr, httpc, notify)
@@ -146,27 +157,52 @@ func runTranscode(n *core.LivepeerNode, orchAddr string, httpc *http.Client, not
 	var contentType string
 	var body bytes.Buffer
 
-	tData, err := n.Transcoder.Transcode(notify.Job, notify.Url, profiles)
+	md := &core.SegTranscodingMetadata{
+		ManifestID: core.ManifestID(notify.Job),
+		Profiles:   profiles,
+		Format:     netSegmentFormat(notify.FullProfiles),
+		Renditions: core.NetRenditionProfiles(notify.FullProfiles, profiles),
+		Fname:      notify.Url,
+	}
+	tData, err := n.Transcoder.Transcode(md)
 	glog.V(common.VERBOSE).Infof("Transcoding done for taskId=%d url=%s err=%v", notify.TaskId, notify.Url, err)
 	if err != nil {
 		glog.Error("Unable to transcode ", err)
 		body.Write([]byte(err.Error()))
 		contentType = transcodingErrorMimeType
 	} else {
+		// Upload straight to the broadcaster's storage if we were given
+		// access, falling back to sending the renditions to the orchestrator
+		var uris []string
+		if bos := drivers.NewSession(notify.Storage); bos != nil {
+			uris, err = uploadRenditions(bos, md, notify.SeqNo, tData)
+			if err != nil {
+				glog.Errorf("Unable to upload renditions taskId=%d url=%s err=%v", notify.TaskId, notify.Url, err)
+				uris = nil
+			}
+			bos.EndSession()
+		}
 		boundary := common.RandName()
 		w := multipart.NewWriter(&body)
-		for _, v := range tData.Segments {
+		for i, v := range tData.Segments {
 			w.SetBoundary(boundary)
 			hdrs := textproto.MIMEHeader{
-				"Content-Type":   {"video/MP2T"},
+				"Content-Type":   {md.Format.ContentType()},
 				"Content-Length": {strconv.Itoa(len(v.Data))},
 				"Pixels":         {strconv.FormatInt(v.Pixels, 10)},
 			}
+			data := v.Data
+			if uris != nil {
+				data = []byte(uris[i])
+				hdrs.Set("Content-Type", renditionURIMimeType)
+				hdrs.Set("Content-Length", strconv.Itoa(len(data)))
+				hdrs.Set("Hash", hex.EncodeToString(crypto.Keccak256(v.Data)))
+			}
 			fw, err := w.CreatePart(hdrs)
 			if err != nil {
 				glog.Error("Could not create multipart part ", err)
 			}
-			io.Copy(fw, bytes.NewBuffer(v.Data))
+			io.Copy(fw, bytes.NewBuffer(data))
 		}
 		w.Close()
 		contentType = "multipart/mixed; boundary=" + boundary
@@ -192,14 +228,55 @@ func runTranscode(n *core.LivepeerNode, orchAddr string, httpc *http.Client, not
 	glog.V(common.VERBOSE).Infof("Transcoding done results sent for taskId=%d url=%s err=%v", notify.TaskId, notify.Url, err)
 }
 
+// uploadRenditions saves the transcoded renditions of a segment into the
+// broadcaster's storage, named as the orchestrator would name them, and
+// returns their URIs
+func uploadRenditions(bos drivers.OSSession, md *core.SegTranscodingMetadata, seqNo int64, tData *core.TranscodeData) ([]string, error) {
+	if len(tData.Segments) != len(md.Profiles) {
+		return nil, fmt.Errorf("MismatchedSegments")
+	}
+	uris := make([]string, len(tData.Segments))
+	for i, v := range tData.Segments {
+		p := md.Profiles[i]
+		name := fmt.Sprintf("%s/%d%s", p.Name, seqNo, core.RenditionExt(p.Name, md.Format, md.Renditions))
+		uri, err := bos.SaveData(name, v.Data)
+		if err != nil {
+			return nil, err
+		}
+		uris[i] = uri
+	}
+	return uris, nil
+}
+
+// sendHeartbeat answers a liveness check from the orchestrator
+func sendHeartbeat(n *core.LivepeerNode, orchAddr string, httpc *http.Client, notify *net.NotifySegment) {
+	req, err := http.NewRequest("POST", "https://"+orchAddr+"/transcodeResults", nil)
+	if err != nil {
+		glog.Error("Error creating heartbeat ", err)
+		return
+	}
+	req.Header.Set("Authorization", protoVerLPT)
+	req.Header.Set("Credentials", n.OrchSecret)
+	req.Header.Set("Content-Type", heartbeatMimeType)
+	req.Header.Set("TaskId", strconv.FormatInt(notify.TaskId, 10))
+	resp, err := httpc.Do(req)
+	if err != nil {
+		glog.Error("Error sending heartbeat ", err)
+		return
+	}
+	ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+}
+
 // Orchestrator gRPC
 
 func (h *lphttp) RegisterTranscoder(req *net.RegisterRequest, stream net.Transcoder_RegisterTranscoderServer) error {
 	from := common.GetConnectionAddr(stream.Context())
 	glog.Infof("Got a RegisterTranscoder request from transcoder=%s capacity=%d", from, req.Capacity)
 
-	if req.Secret != h.orchestrator.TranscoderSecret() {
-		glog.Info(errSecret.Error())
+	name, err := h.orchestrator.AuthenticateTranscoder(req.Secret)
+	if err != nil {
+		glog.Infof("%s transcoder=%s", errSecret.Error(), from)
 		return errSecret
 	}
 	if req.Capacity <= 0 {
@@ -208,8 +285,7 @@ func (h *lphttp) RegisterTranscoder(req *net.RegisterRequest, stream net.Transco
 	}
 
 	// blocks until stream is finished
-	h.orchestrator.ServeTranscoder(stream, int(req.Capacity))
-	return nil
+	return h.orchestrator.ServeTranscoder(stream, name, int(req.Capacity), req.Capabilities)
 }
 
 // Orchestrator HTTP
@@ -225,8 +301,9 @@ func (h *lphttp) TranscodeResults(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if creds != orch.TranscoderSecret() {
-		glog.Error("Invalid shared secret")
+	name, err := orch.AuthenticateTranscoder(creds)
+	if err != nil {
+		glog.Error("Invalid transcoder credentials")
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
@@ -245,6 +322,12 @@ func (h *lphttp) TranscodeResults(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if heartbeatMimeType == mediaType {
+		orch.TranscoderResults(tid, &core.RemoteTranscoderResult{Transcoder: name})
+		w.Write([]byte("OK"))
+		return
+	}
+
 	decodedPixels, err := strconv.ParseInt(r.Header.Get("Pixels"), 10, 64)
 	if err != nil {
 		glog.Error("Could not parse decoded pixels", err)
@@ -252,7 +335,7 @@ func (h *lphttp) TranscodeResults(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var res core.RemoteTranscoderResult
+	res := core.RemoteTranscoderResult{Transcoder: name}
 	if transcodingErrorMimeType == mediaType {
 		w.Write([]byte("OK"))
 		body, err := ioutil.ReadAll(r.Body)
@@ -294,6 +377,18 @@ func (h *lphttp) TranscodeResults(w http.ResponseWriter, r *http.Request) {
 				break
 			}
 
+			if p.Header.Get("Content-Type") == renditionURIMimeType {
+				// Uploaded into the broadcaster's storage by the transcoder
+				hash, err := hex.DecodeString(p.Header.Get("Hash"))
+				if err != nil {
+					glog.Error("Error getting hash in header:", err)
+					res.Err = err
+					break
+				}
+				segments = append(segments, &core.TranscodedSegmentData{URI: string(body), Hash: hash, Pixels: encodedPixels})
+				continue
+			}
+
 			segments = append(segments, &core.TranscodedSegmentData{Data: body, Pixels: encodedPixels})
 		}
 		res.TranscodeData = &core.TranscodeData{
@@ -15,6 +15,7 @@ import (
 	"strconv"
 	"testing"
 
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/livepeer/go-livepeer/common"
 	"github.com/livepeer/go-livepeer/core"
 	"github.com/livepeer/go-livepeer/net"
@@ -26,6 +27,7 @@ type stubTranscoder struct {
 	called   int
 	profiles []ffmpeg.VideoProfile
 	fname    string
+	format   core.SegmentFormat
 	err      error
 }
 
@@ -37,10 +39,11 @@ var testRemoteTranscoderResults = &core.TranscodeData{
 	Pixels: 999,
 }
 
-func (st *stubTranscoder) Transcode(job string, fname string, profiles []ffmpeg.VideoProfile) (*core.TranscodeData, error) {
+func (st *stubTranscoder) Transcode(md *core.SegTranscodingMetadata) (*core.TranscodeData, error) {
 	st.called++
-	st.fname = fname
-	st.profiles = profiles
+	st.fname = md.Fname
+	st.profiles = md.Profiles
+	st.format = md.Format
 	if st.err != nil {
 		return nil, st.err
 	}
@@ -154,6 +157,15 @@ func TestRemoteTranscoder_FullProfiles(t *testing.T) {
 	profiles[1].Bitrate = "765000"
 	assert.Equal(profiles, tr.profiles)
 	assert.Equal("linktomanifest", tr.fname)
+	assert.Equal(core.FormatMPEGTS, tr.format)
+
+	// Requested container is passed through to the transcoder
+	for _, p := range fullProfiles {
+		p.Format = net.VideoProfile_MP4
+	}
+	runTranscode(node, "badaddress", httpc, notify)
+	assert.Equal(2, tr.called)
+	assert.Equal(core.FormatMP4, tr.format)
 }
 
 func TestRemoteTranscoderError(t *testing.T) {
@@ -194,3 +206,163 @@ func TestRemoteTranscoderError(t *testing.T) {
 	assert.Equal(protoVerLPT, headers.Get("Authorization"))
 	assert.Equal(errText, string(body))
 }
+
+func TestRemoteTranscoder_Heartbeat(t *testing.T) {
+	assert := assert.New(t)
+	httpc := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	node, _ := core.NewLivepeerNode(nil, "/tmp/thisdirisnotactuallyusedinthistest", nil)
+	node.OrchSecret = "verbigsecret"
+
+	// Heartbeats are answered without transcoding
+	var headers http.Header
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header
+		w.Write(nil)
+	}))
+	defer ts.Close()
+	parsedURL, _ := url.Parse(ts.URL)
+	sendHeartbeat(node, parsedURL.Host, httpc, &net.NotifySegment{TaskId: 742, Heartbeat: true})
+	assert.Equal("742", headers.Get("TaskId"))
+	assert.Equal(heartbeatMimeType, headers.Get("Content-Type"))
+	assert.Equal(node.OrchSecret, headers.Get("Credentials"))
+	assert.Equal(protoVerLPT, headers.Get("Authorization"))
+
+	// The orchestrator passes the answer on as empty results
+	orch := &mockOrchestrator{}
+	orch.On("AuthenticateTranscoder", "").Return("", nil)
+	orch.On("TranscoderResults", int64(742), &core.RemoteTranscoderResult{})
+	lp := &lphttp{orchestrator: orch}
+	req := httptest.NewRequest("POST", "/transcodeResults", nil)
+	for k := range headers {
+		req.Header.Set(k, headers.Get(k))
+	}
+	req.Header.Set("Credentials", "")
+	w := httptest.NewRecorder()
+	lp.TranscodeResults(w, req)
+	assert.Equal(http.StatusOK, w.Code)
+	orch.AssertCalled(t, "TranscoderResults", int64(742), &core.RemoteTranscoderResult{})
+}
+
+func TestRemoteTranscoder_Authentication(t *testing.T) {
+	assert := assert.New(t)
+	orch := &mockOrchestrator{}
+	orch.On("AuthenticateTranscoder", "bad").Return("", core.ErrTranscoderAuth)
+	orch.On("AuthenticateTranscoder", "token").Return("rig1", nil)
+	lp := &lphttp{orchestrator: orch}
+	strm := &common.StubServerStream{}
+
+	// Registration is refused with unknown credentials
+	err := lp.RegisterTranscoder(&net.RegisterRequest{Secret: "bad", Capacity: 1}, strm)
+	assert.Equal(errSecret, err)
+
+	// The transcoder is served under the name of its token
+	orch.On("ServeTranscoder", strm, "rig1").Return(nil)
+	assert.Nil(lp.RegisterTranscoder(&net.RegisterRequest{Secret: "token", Capacity: 1}, strm))
+	orch.AssertCalled(t, "ServeTranscoder", strm, "rig1")
+
+	// Results are refused with unknown credentials
+	req := httptest.NewRequest("POST", "/transcodeResults", nil)
+	req.Header.Set("Authorization", protoVerLPT)
+	req.Header.Set("Credentials", "bad")
+	req.Header.Set("Content-Type", heartbeatMimeType)
+	req.Header.Set("TaskId", "7")
+	w := httptest.NewRecorder()
+	lp.TranscodeResults(w, req)
+	assert.Equal(http.StatusUnauthorized, w.Code)
+
+	// Results are passed on with the name of the token
+	orch.On("TranscoderResults", int64(7), &core.RemoteTranscoderResult{Transcoder: "rig1"})
+	req.Header.Set("Credentials", "token")
+	w = httptest.NewRecorder()
+	lp.TranscodeResults(w, req)
+	assert.Equal(http.StatusOK, w.Code)
+	orch.AssertCalled(t, "TranscoderResults", int64(7), &core.RemoteTranscoderResult{Transcoder: "rig1"})
+}
+
+func TestRemoteTranscoder_Upload(t *testing.T) {
+	assert := assert.New(t)
+	httpc := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+
+	// Broadcaster storage accepting presigned uploads
+	uploaded := make(map[string][]byte)
+	storageErr := false
+	store := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if storageErr {
+			http.Error(w, "storage error", http.StatusInternalServerError)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		uploaded[r.URL.Path] = body
+	}))
+	defer store.Close()
+
+	profiles := []ffmpeg.VideoProfile{ffmpeg.P720p60fps16x9, ffmpeg.P144p30fps16x9}
+	fullProfiles, err := common.FFmpegProfiletoNetProfile(profiles)
+	assert.Nil(err)
+	urls := make(map[string]string)
+	for _, p := range profiles {
+		urls[p.Name+"/5.ts"] = store.URL + "/key/" + p.Name + "/5.ts"
+	}
+	notify := &net.NotifySegment{
+		TaskId:       742,
+		FullProfiles: fullProfiles,
+		Url:          "linktomanifest",
+		SeqNo:        5,
+		Storage: &net.OSInfo{
+			StorageType: net.OSInfo_S3,
+			S3Info:      &net.S3OSInfo{Host: store.URL, Key: "key", PresignedUrls: urls},
+		},
+	}
+	node, _ := core.NewLivepeerNode(nil, "/tmp/thisdirisnotactuallyusedinthistest", nil)
+	node.OrchSecret = "verbigsecret"
+	node.Transcoder = &stubTranscoder{}
+
+	var req *http.Request
+	var body []byte
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = ioutil.ReadAll(r.Body)
+		req = r
+		w.Write(nil)
+	}))
+	defer ts.Close()
+	parsedURL, _ := url.Parse(ts.URL)
+
+	// Renditions are uploaded by the transcoder, which only posts their URIs
+	runTranscode(node, parsedURL.Host, httpc, notify)
+	for i, p := range profiles {
+		assert.Equal(testRemoteTranscoderResults.Segments[i].Data, uploaded["/key/"+p.Name+"/5.ts"])
+	}
+	orch := &mockOrchestrator{}
+	orch.On("AuthenticateTranscoder", node.OrchSecret).Return("", nil)
+	expected := &core.RemoteTranscoderResult{TranscodeData: &core.TranscodeData{Pixels: 999}}
+	for i, p := range profiles {
+		seg := testRemoteTranscoderResults.Segments[i]
+		expected.TranscodeData.Segments = append(expected.TranscodeData.Segments, &core.TranscodedSegmentData{
+			URI:    store.URL + "/key/" + p.Name + "/5.ts",
+			Hash:   crypto.Keccak256(seg.Data),
+			Pixels: seg.Pixels,
+		})
+	}
+	orch.On("TranscoderResults", int64(742), expected)
+	lp := &lphttp{orchestrator: orch}
+	results := httptest.NewRequest("POST", "/transcodeResults", bytes.NewReader(body))
+	results.Header = req.Header
+	w := httptest.NewRecorder()
+	lp.TranscodeResults(w, results)
+	assert.Equal(http.StatusOK, w.Code)
+	orch.AssertCalled(t, "TranscoderResults", int64(742), expected)
+
+	// Renditions are posted to the orchestrator if the upload fails
+	storageErr = true
+	runTranscode(node, parsedURL.Host, httpc, notify)
+	_, params, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	assert.Nil(err)
+	mr := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for i := range profiles {
+		p, err := mr.NextPart()
+		assert.Nil(err)
+		data, _ := ioutil.ReadAll(p)
+		assert.Equal(testRemoteTranscoderResults.Segments[i].Data, data)
+		assert.Empty(p.Header.Get("Hash"))
+	}
+}
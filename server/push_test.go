@@ -18,6 +18,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"go.uber.org/goleak"
 
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/golang/glog"
 	"github.com/golang/protobuf/proto"
 	"github.com/livepeer/go-livepeer/core"
@@ -211,6 +212,150 @@ func TestMemoryRequestError(t *testing.T) {
 	assert.Contains(strings.TrimSpace(string(body)), "Error reading http request body")
 }
 
+func TestPushBodyTooLarge(t *testing.T) {
+	assert := assert.New(t)
+	s := setupServer()
+	defer serverCleanup(s)
+
+	oldMax := MaxPushBodySize
+	defer func() { MaxPushBodySize = oldMax }()
+	MaxPushBodySize = 4
+
+	// Content-Length exceeds the limit
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/live/mani2/1.ts", strings.NewReader("too large"))
+	s.HandlePush(w, req)
+	resp := w.Result()
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	require.Nil(t, err)
+	assert.Equal(http.StatusRequestEntityTooLarge, resp.StatusCode)
+	assert.Equal("ErrPushBodyTooLarge", strings.TrimSpace(string(body)))
+
+	// Chunked body without a Content-Length exceeds the limit
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("POST", "/live/mani2/2.ts", strings.NewReader("too large"))
+	req.ContentLength = -1
+	s.HandlePush(w, req)
+	resp = w.Result()
+	defer resp.Body.Close()
+	body, err = ioutil.ReadAll(resp.Body)
+	require.Nil(t, err)
+	assert.Equal(http.StatusRequestEntityTooLarge, resp.StatusCode)
+	assert.Equal("ErrPushBodyTooLarge", strings.TrimSpace(string(body)))
+
+	// Rejected segments don't leave a stream behind
+	assert.NotContains(s.rtmpConnections, core.ManifestID("mani2"))
+
+	// Body at the limit is accepted
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("POST", "/live/mani2/3.ts", strings.NewReader("fits"))
+	req.ContentLength = -1
+	s.HandlePush(w, req)
+	resp = w.Result()
+	defer resp.Body.Close()
+	assert.NotEqual(http.StatusRequestEntityTooLarge, resp.StatusCode)
+}
+
+type stubReaderDriver struct {
+	sess *stubReaderSession
+}
+
+func (d *stubReaderDriver) NewSession(path string) drivers.OSSession {
+	return d.sess
+}
+
+// stubReaderSession is external storage that records how segments were saved
+type stubReaderSession struct {
+	stubOSSession
+	saved    map[string]string
+	streamed []string
+}
+
+func (s *stubReaderSession) SaveData(name string, data []byte) (string, error) {
+	s.saved[name] = string(data)
+	return "https://bucket/" + name, nil
+}
+func (s *stubReaderSession) SaveReader(name string, r io.Reader, size int64) (string, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	s.streamed = append(s.streamed, name)
+	return s.SaveData(name, data)
+}
+func (s *stubReaderSession) IsExternal() bool {
+	return true
+}
+
+func TestPushStreamedToStorage(t *testing.T) {
+	assert := assert.New(t)
+	s := setupServer()
+	defer serverCleanup(s)
+
+	oldStorage := drivers.NodeStorage
+	defer func() { drivers.NodeStorage = oldStorage }()
+	sess := &stubReaderSession{saved: make(map[string]string)}
+	drivers.NodeStorage = &stubReaderDriver{sess}
+
+	oldMax := MaxPushBodySize
+	defer func() { MaxPushBodySize = oldMax }()
+	MaxPushBodySize = 8
+
+	push := func(path, body string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.ContentLength = -1
+		s.HandlePush(w, req)
+		return w.Result().StatusCode
+	}
+
+	// The first segment of a stream is buffered until the stream is set up
+	assert.Equal(http.StatusServiceUnavailable, push("/live/mani3/1.ts", "first"))
+	assert.Equal("first", sess.saved["source/1.ts"])
+	assert.Empty(sess.streamed)
+
+	// Later segments are streamed into storage
+	assert.Equal(http.StatusServiceUnavailable, push("/live/mani3/2.ts", "second"))
+	assert.Equal("second", sess.saved["source/2.ts"])
+	assert.Equal([]string{"source/2.ts"}, sess.streamed)
+
+	// Streamed segments are still subject to the limit
+	assert.Equal(http.StatusRequestEntityTooLarge, push("/live/mani3/3.ts", "too large"))
+	assert.NotContains(sess.saved, "source/3.ts")
+	assert.Contains(s.rtmpConnections, core.ManifestID("mani3"))
+}
+
+func TestReadPushBody(t *testing.T) {
+	assert := assert.New(t)
+
+	data, err := readPushBody(strings.NewReader("abcd"), 4)
+	assert.Nil(err)
+	assert.Equal("abcd", string(data))
+
+	data, err = readPushBody(strings.NewReader("abcde"), 4)
+	assert.Equal(errPushBodyTooLarge, err)
+	assert.Nil(data)
+
+	// no limit
+	data, err = readPushBody(strings.NewReader("abcde"), 0)
+	assert.Nil(err)
+	assert.Equal("abcde", string(data))
+
+	// streamed bodies are hashed and their start is kept
+	body := newPushBody(strings.NewReader("abcd"), 4)
+	_, err = io.Copy(ioutil.Discard, body)
+	assert.Nil(err)
+	assert.Equal(crypto.Keccak256([]byte("abcd")), body.Sum())
+	assert.Equal("abcd", string(body.head))
+	assert.False(body.tooLarge)
+
+	body = newPushBody(strings.NewReader("abcde"), 4)
+	_, err = io.Copy(ioutil.Discard, body)
+	assert.Equal(errPushBodyTooLarge, err)
+	assert.True(body.tooLarge)
+}
+
 func TestEmptyURLError(t *testing.T) {
 	// assert http request body error returned
 	assert := assert.New(t)
@@ -226,6 +371,25 @@ func TestEmptyURLError(t *testing.T) {
 	require.Nil(t, err)
 	assert.Equal(http.StatusBadRequest, resp.StatusCode)
 	assert.Equal("Bad URL\n", string(body))
+
+	// body is drained and closed
+	reqBody := &trackingBody{Reader: strings.NewReader("segment")}
+	req = httptest.NewRequest("POST", "/live/.ts", reqBody)
+	w = httptest.NewRecorder()
+	s.HandlePush(w, req)
+	assert.Equal(http.StatusBadRequest, w.Result().StatusCode)
+	assert.Equal(0, reqBody.Len())
+	assert.True(reqBody.closed)
+}
+
+type trackingBody struct {
+	*strings.Reader
+	closed bool
+}
+
+func (b *trackingBody) Close() error {
+	b.closed = true
+	return nil
 }
 
 func TestShouldUpdateLastUsed(t *testing.T) {
@@ -254,7 +418,7 @@ func ignoreRoutines() []goleak.Option {
 		"github.com/ethereum/go-ethereum/consensus/ethash.(*Ethash).remote", "github.com/ethereum/go-ethereum/core.(*txSenderCacher).cache",
 		"internal/poll.runtime_pollWait", "github.com/livepeer/go-livepeer/core.(*RemoteTranscoderManager).Manage", "github.com/livepeer/lpms/core.(*LPMS).Start",
 		"github.com/livepeer/go-livepeer/server.(*LivepeerServer).StartMediaServer", "github.com/livepeer/go-livepeer/core.(*RemoteTranscoderManager).Manage.func1",
-		"github.com/livepeer/go-livepeer/server.(*LivepeerServer).HandlePush.func1", "github.com/rjeczalik/notify.(*nonrecursiveTree).dispatch",
+		"github.com/livepeer/go-livepeer/server.(*LivepeerServer).registerPushConnection.func1", "github.com/rjeczalik/notify.(*nonrecursiveTree).dispatch",
 		"github.com/rjeczalik/notify.(*nonrecursiveTree).internal"}
 
 	res := make([]goleak.Option, 0, len(funcs2ignore))
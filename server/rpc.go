@@ -33,19 +33,20 @@ const GRPCTimeout = 8 * time.Second
 type Orchestrator interface {
 	ServiceURI() *url.URL
 	Address() ethcommon.Address
-	TranscoderSecret() string
+	AuthenticateTranscoder(creds string) (string, error)
 	Sign([]byte) ([]byte, error)
 	VerifySig(ethcommon.Address, string, []byte) bool
 	CurrentBlock() *big.Int
-	CheckCapacity(core.ManifestID) error
+	CheckCapacity(*core.SegTranscodingMetadata) error
 	TranscodeSeg(*core.SegTranscodingMetadata, *stream.HLSSegment) (*core.TranscodeResult, error)
-	ServeTranscoder(stream net.Transcoder_RegisterTranscoderServer, capacity int)
+	ServeTranscoder(stream net.Transcoder_RegisterTranscoderServer, name string, capacity int, caps *net.Capabilities) error
 	TranscoderResults(job int64, res *core.RemoteTranscoderResult)
 	ProcessPayment(payment net.Payment, manifestID core.ManifestID) error
 	TicketParams(sender ethcommon.Address) (*net.TicketParams, error)
 	PriceInfo(sender ethcommon.Address) (*net.PriceInfo, error)
 	SufficientBalance(addr ethcommon.Address, manifestID core.ManifestID) bool
 	DebitFees(addr ethcommon.Address, manifestID core.ManifestID, price *net.PriceInfo, pixels int64)
+	Capabilities() *net.Capabilities
 }
 
 // Balance describes methods for a session's balance maintenance
@@ -92,6 +93,8 @@ type BroadcastSession struct {
 	Broadcaster      common.Broadcaster
 	ManifestID       core.ManifestID
 	Profiles         []ffmpeg.VideoProfile
+	Format           core.SegmentFormat
+	Renditions       core.RenditionProfiles
 	OrchestratorInfo *net.OrchestratorInfo
 	OrchestratorOS   drivers.OSSession
 	BroadcasterOS    drivers.OSSession
@@ -99,6 +102,10 @@ type BroadcastSession struct {
 	PMSessionID      string
 	Balance          Balance
 	LatencyScore     float64
+	// Maximum price for the stream, if lower than the node's maximum price
+	MaxPrice *big.Rat
+
+	stats *streamStats
 }
 
 // ReceivedTranscodeResult contains received transcode result data and related metadata
@@ -267,12 +274,15 @@ func orchestratorInfo(orch Orchestrator, addr ethcommon.Address, serviceURI stri
 		Transcoder:   serviceURI,
 		TicketParams: params,
 		PriceInfo:    priceInfo,
+		Capabilities: orch.Capabilities(),
 	}
 
 	os := drivers.NodeStorage.NewSession(string(core.RandomManifestID()))
 
 	if os != nil && os.IsExternal() {
-		tr.Storage = []*net.OSInfo{os.GetInfo()}
+		if info := os.GetInfo(); info != nil {
+			tr.Storage = []*net.OSInfo{info}
+		}
 	}
 
 	return &tr, nil
@@ -283,7 +293,7 @@ func verifyOrchestratorReq(orch Orchestrator, addr ethcommon.Address, sig []byte
 		glog.Error("orchestrator req sig check failed")
 		return fmt.Errorf("orchestrator req sig check failed")
 	}
-	return orch.CheckCapacity("")
+	return orch.CheckCapacity(nil)
 }
 
 func pmTicketParams(params *net.TicketParams) *pm.TicketParams {
@@ -64,6 +64,7 @@ type stubOrchestrator struct {
 	block      *big.Int
 	signErr    error
 	sessCapErr error
+	caps       *net.Capabilities
 }
 
 func (r *stubOrchestrator) ServiceURI() *url.URL {
@@ -129,6 +130,10 @@ func (r *stubOrchestrator) SufficientBalance(addr ethcommon.Address, manifestID
 func (r *stubOrchestrator) DebitFees(addr ethcommon.Address, manifestID core.ManifestID, price *net.PriceInfo, pixels int64) {
 }
 
+func (r *stubOrchestrator) Capabilities() *net.Capabilities {
+	return r.caps
+}
+
 func newStubOrchestrator() *stubOrchestrator {
 	pk, err := ethcrypto.GenerateKey()
 	if err != nil {
@@ -137,15 +142,16 @@ func newStubOrchestrator() *stubOrchestrator {
 	return &stubOrchestrator{priv: pk, block: big.NewInt(5)}
 }
 
-func (r *stubOrchestrator) CheckCapacity(mid core.ManifestID) error {
+func (r *stubOrchestrator) CheckCapacity(md *core.SegTranscodingMetadata) error {
 	return r.sessCapErr
 }
-func (r *stubOrchestrator) ServeTranscoder(stream net.Transcoder_RegisterTranscoderServer, capacity int) {
+func (r *stubOrchestrator) ServeTranscoder(stream net.Transcoder_RegisterTranscoderServer, name string, capacity int, caps *net.Capabilities) error {
+	return nil
 }
 func (r *stubOrchestrator) TranscoderResults(job int64, res *core.RemoteTranscoderResult) {
 }
-func (r *stubOrchestrator) TranscoderSecret() string {
-	return ""
+func (r *stubOrchestrator) AuthenticateTranscoder(creds string) (string, error) {
+	return "", nil
 }
 func stubBroadcaster2() *stubOrchestrator {
 	return newStubOrchestrator() // lazy; leverage subtyping for interface commonalities
@@ -207,7 +213,7 @@ func TestRPCSeg(t *testing.T) {
 
 	segData := &stream.HLSSegment{}
 
-	creds, err := genSegCreds(s, segData)
+	creds, err := genSegCreds(s, segData, nil)
 	if err != nil {
 		t.Error("Unable to generate seg creds ", err)
 		return
@@ -219,7 +225,7 @@ func TestRPCSeg(t *testing.T) {
 
 	// error signing
 	b.signErr = fmt.Errorf("SignErr")
-	if _, err := genSegCreds(s, segData); err != b.signErr {
+	if _, err := genSegCreds(s, segData, nil); err != b.signErr {
 		t.Error("Generating seg creds ", err)
 	}
 	b.signErr = nil
@@ -604,6 +610,26 @@ func TestValidatePrice(t *testing.T) {
 	err = validatePrice(s)
 	assert.EqualError(err, fmt.Sprintf("Orchestrator price higher than the set maximum price of %v wei per %v pixels", int64(1), int64(5)))
 
+	// Stream MaxPrice < B MaxPrice
+	BroadcastCfg.SetMaxPrice(big.NewRat(5, 1))
+	s.MaxPrice = big.NewRat(1, 4)
+	err = validatePrice(s)
+	assert.EqualError(err, fmt.Sprintf("Orchestrator price higher than the set maximum price of %v wei per %v pixels", int64(1), int64(4)))
+
+	// Stream MaxPrice can't raise B MaxPrice
+	BroadcastCfg.SetMaxPrice(big.NewRat(1, 5))
+	s.MaxPrice = big.NewRat(5, 1)
+	err = validatePrice(s)
+	assert.EqualError(err, fmt.Sprintf("Orchestrator price higher than the set maximum price of %v wei per %v pixels", int64(1), int64(5)))
+
+	// Stream MaxPrice without B MaxPrice
+	BroadcastCfg.SetMaxPrice(nil)
+	err = validatePrice(s)
+	assert.Nil(err)
+	s.MaxPrice = big.NewRat(1, 4)
+	assert.NotNil(validatePrice(s))
+	s.MaxPrice = nil
+
 	// O.PriceInfo is nil
 	s.OrchestratorInfo.PriceInfo = nil
 	err = validatePrice(s)
@@ -795,6 +821,22 @@ func TestGetOrchestrator_PriceInfoError(t *testing.T) {
 	assert.EqualError(t, err, expErr.Error())
 }
 
+func TestOrchestratorInfo_Capabilities(t *testing.T) {
+	assert := assert.New(t)
+	drivers.NodeStorage = drivers.NewMemoryDriver(nil)
+	orch := newStubOrchestrator()
+
+	// Capabilities aren't advertised if the orchestrator has none
+	oInfo, err := orchestratorInfo(orch, ethcommon.Address{}, "http://someuri.com")
+	assert.Nil(err)
+	assert.Nil(oInfo.Capabilities)
+
+	orch.caps = core.NewCapabilities([]core.VideoCodec{core.CodecH264, core.CodecH265}, true, 1920*1080)
+	oInfo, err = orchestratorInfo(orch, ethcommon.Address{}, "http://someuri.com")
+	assert.Nil(err)
+	assert.Equal(orch.caps, oInfo.Capabilities)
+}
+
 type mockOSSession struct {
 	mock.Mock
 }
@@ -836,9 +878,9 @@ func (o *mockOrchestrator) Address() ethcommon.Address {
 	o.Called()
 	return ethcommon.Address{}
 }
-func (o *mockOrchestrator) TranscoderSecret() string {
-	o.Called()
-	return ""
+func (o *mockOrchestrator) AuthenticateTranscoder(creds string) (string, error) {
+	args := o.Called(creds)
+	return args.String(0), args.Error(1)
 }
 func (o *mockOrchestrator) Sign(msg []byte) ([]byte, error) {
 	o.Called(msg)
@@ -862,8 +904,9 @@ func (o *mockOrchestrator) TranscodeSeg(md *core.SegTranscodingMetadata, seg *st
 
 	return res, args.Error(1)
 }
-func (o *mockOrchestrator) ServeTranscoder(stream net.Transcoder_RegisterTranscoderServer, capacity int) {
-	o.Called(stream)
+func (o *mockOrchestrator) ServeTranscoder(stream net.Transcoder_RegisterTranscoderServer, name string, capacity int, caps *net.Capabilities) error {
+	args := o.Called(stream, name)
+	return args.Error(0)
 }
 func (o *mockOrchestrator) TranscoderResults(job int64, res *core.RemoteTranscoderResult) {
 	o.Called(job, res)
@@ -889,7 +932,7 @@ func (o *mockOrchestrator) PriceInfo(sender ethcommon.Address) (*net.PriceInfo,
 	return nil, args.Error(1)
 }
 
-func (o *mockOrchestrator) CheckCapacity(mid core.ManifestID) error {
+func (o *mockOrchestrator) CheckCapacity(md *core.SegTranscodingMetadata) error {
 	return nil
 }
 
@@ -902,6 +945,10 @@ func (o *mockOrchestrator) DebitFees(addr ethcommon.Address, manifestID core.Man
 	o.Called(addr, manifestID, price, pixels)
 }
 
+func (o *mockOrchestrator) Capabilities() *net.Capabilities {
+	return nil
+}
+
 func defaultTicketParams() *net.TicketParams {
 	return &net.TicketParams{
 		Recipient:         pm.RandBytes(123),
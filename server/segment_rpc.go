@@ -2,6 +2,7 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/base64"
 	"fmt"
@@ -60,6 +61,12 @@ func (h *lphttp) ServeSegment(w http.ResponseWriter, r *http.Request) {
 	seg := r.Header.Get(segmentHeader)
 
 	segData, err := verifySegCreds(orch, seg, sender)
+	if err == core.ErrOrchOverloaded {
+		// Broadcasters retry the segment elsewhere
+		glog.Error("Refusing segment for lack of transcoding capacity")
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
 	if err != nil {
 		glog.Error("Could not verify segment creds")
 		http.Error(w, err.Error(), http.StatusForbidden)
@@ -147,11 +154,16 @@ func (h *lphttp) ServeSegment(w http.ResponseWriter, r *http.Request) {
 	var segments []*net.TranscodedSegmentData
 	var pixels int64
 	for i := 0; err == nil && i < len(res.TranscodeData.Segments); i++ {
-		name := fmt.Sprintf("%s/%d.ts", segData.Profiles[i].Name, segData.Seq) // ANGIE - NEED TO EDIT OUT JOB PROFILES
-		uri, err := res.OS.SaveData(name, res.TranscodeData.Segments[i].Data)
-		if err != nil {
-			glog.Error("Could not upload segment ", segData.Seq)
-			break
+		// Renditions may have been uploaded by the transcoder already
+		uri := res.TranscodeData.Segments[i].URI
+		if uri == "" {
+			name := fmt.Sprintf("%s/%d%s", segData.Profiles[i].Name, segData.Seq, core.RenditionExt(segData.Profiles[i].Name, segData.Format, segData.Renditions)) // ANGIE - NEED TO EDIT OUT JOB PROFILES
+			saved, err := res.OS.SaveData(name, res.TranscodeData.Segments[i].Data)
+			if err != nil {
+				glog.Error("Could not upload segment ", segData.Seq)
+				break
+			}
+			uri = saved
 		}
 		pixels += res.TranscodeData.Segments[i].Pixels
 		d := &net.TranscodedSegmentData{
@@ -229,6 +241,19 @@ func makeFfmpegVideoProfiles(protoProfiles []*net.VideoProfile) []ffmpeg.VideoPr
 	return profiles
 }
 
+// netSegmentFormat returns the container requested for a set of profiles.
+// All profiles of a segment are expected to share the same container.
+func netSegmentFormat(protoProfiles []*net.VideoProfile) core.SegmentFormat {
+	if len(protoProfiles) <= 0 {
+		return core.FormatMPEGTS
+	}
+	switch protoProfiles[0].Format {
+	case net.VideoProfile_MP4:
+		return core.FormatMP4
+	}
+	return core.FormatMPEGTS
+}
+
 func verifySegCreds(orch Orchestrator, segCreds string, broadcaster ethcommon.Address) (*core.SegTranscodingMetadata, error) {
 	buf, err := base64.StdEncoding.DecodeString(segCreds)
 	if err != nil {
@@ -266,6 +291,8 @@ func verifySegCreds(orch Orchestrator, segCreds string, broadcaster ethcommon.Ad
 		Hash:       ethcommon.BytesToHash(segData.Hash),
 		Profiles:   profiles,
 		OS:         os,
+		Format:     netSegmentFormat(segData.FullProfiles),
+		Renditions: core.NetRenditionProfiles(segData.FullProfiles, profiles),
 	}
 
 	if !orch.VerifySig(broadcaster, string(md.Flatten()), segData.Sig) {
@@ -273,7 +300,7 @@ func verifySegCreds(orch Orchestrator, segCreds string, broadcaster ethcommon.Ad
 		return nil, errSegSig
 	}
 
-	if err := orch.CheckCapacity(mid); err != nil {
+	if err := orch.CheckCapacity(md); err != nil {
 		glog.Error("Cannot process manifest: ", err)
 		return nil, err
 	}
@@ -281,10 +308,15 @@ func verifySegCreds(orch Orchestrator, segCreds string, broadcaster ethcommon.Ad
 	return md, nil
 }
 
-func SubmitSegment(sess *BroadcastSession, seg *stream.HLSSegment, nonce uint64) (*ReceivedTranscodeResult, error) {
+// SubmitSegment sends the segment to the orchestrator of the session and
+// waits for the results, giving up once the context is done. srcHash is the
+// hash of the segment data, or nil to hash seg.Data; segments streamed into
+// storage have no data left to hash.
+func SubmitSegment(ctx context.Context, sess *BroadcastSession, seg *stream.HLSSegment, srcHash []byte,
+	nonce uint64) (*ReceivedTranscodeResult, error) {
 	uploaded := seg.Name != "" // hijack seg.Name to convey the uploaded URI
 
-	segCreds, err := genSegCreds(sess, seg)
+	segCreds, err := genSegCreds(sess, seg, srcHash)
 	if err != nil {
 		if monitor.Enabled {
 			monitor.SegmentUploadFailed(nonce, seg.SeqNo, monitor.SegmentUploadErrorGenCreds, err.Error(), false)
@@ -338,6 +370,7 @@ func SubmitSegment(sess *BroadcastSession, seg *stream.HLSSegment, nonce uint64)
 		}
 		return nil, err
 	}
+	req = req.WithContext(ctx)
 
 	req.Header.Set(segmentHeader, segCreds)
 	req.Header.Set(paymentHeader, payment)
@@ -363,6 +396,7 @@ func SubmitSegment(sess *BroadcastSession, seg *stream.HLSSegment, nonce uint64)
 	// If the segment was submitted then we assume that any payment included was
 	// submitted as well so we consider the update's credit as spent
 	balUpdate.Status = CreditSpent
+	sess.stats.paid(balUpdate.NumTickets, balUpdate.NewCredit)
 	if monitor.Enabled && sess.OrchestratorInfo.TicketParams != nil {
 		recipient := ethcommon.BytesToAddress(sess.OrchestratorInfo.TicketParams.Recipient).String()
 		mid := string(sess.ManifestID)
@@ -468,15 +502,20 @@ func SubmitSegment(sess *BroadcastSession, seg *stream.HLSSegment, nonce uint64)
 	}, nil
 }
 
-func genSegCreds(sess *BroadcastSession, seg *stream.HLSSegment) (string, error) {
+func genSegCreds(sess *BroadcastSession, seg *stream.HLSSegment, srcHash []byte) (string, error) {
 
 	// Generate signature for relevant parts of segment
-	hash := crypto.Keccak256(seg.Data)
+	hash := srcHash
+	if hash == nil {
+		hash = crypto.Keccak256(seg.Data)
+	}
 	md := &core.SegTranscodingMetadata{
 		ManifestID: sess.ManifestID,
 		Seq:        int64(seg.SeqNo),
 		Hash:       ethcommon.BytesToHash(hash),
 		Profiles:   sess.Profiles,
+		Format:     sess.Format,
+		Renditions: sess.Renditions,
 	}
 	sig, err := sess.Broadcaster.Sign(md.Flatten())
 	if err != nil {
@@ -486,13 +525,32 @@ func genSegCreds(sess *BroadcastSession, seg *stream.HLSSegment) (string, error)
 	// Send credentials for our own storage
 	var storage []*net.OSInfo
 	if bos := sess.BroadcasterOS; bos != nil && bos.IsExternal() {
-		storage = []*net.OSInfo{bos.GetInfo()}
+		info := bos.GetInfo()
+		if ps, ok := bos.(drivers.PresignedSession); ok {
+			// Presign the renditions the orchestrator will upload
+			names := make([]string, len(sess.Profiles))
+			for i, p := range sess.Profiles {
+				names[i] = fmt.Sprintf("%s/%d%s", p.Name, seg.SeqNo, core.RenditionExt(p.Name, sess.Format, sess.Renditions))
+			}
+			if pinfo := ps.PresignedInfo(names); pinfo != nil {
+				info = pinfo
+			}
+		}
+		if info != nil {
+			storage = []*net.OSInfo{info}
+		}
 	}
 
 	fullProfiles, err := common.FFmpegProfiletoNetProfile(sess.Profiles)
 	if err != nil {
 		return "", err
 	}
+	if sess.Format == core.FormatMP4 {
+		for _, p := range fullProfiles {
+			p.Format = net.VideoProfile_MP4
+		}
+	}
+	core.SetNetRenditionProfiles(fullProfiles, sess.Profiles, sess.Renditions)
 
 	// Generate serialized segment info
 	segData := &net.SegData{
@@ -666,6 +724,9 @@ func validatePrice(sess *BroadcastSession) error {
 	}
 
 	maxPrice := BroadcastCfg.MaxPrice()
+	if sess.MaxPrice != nil && (maxPrice == nil || sess.MaxPrice.Cmp(maxPrice) < 0) {
+		maxPrice = sess.MaxPrice
+	}
 	if maxPrice != nil && oPrice.Cmp(maxPrice) == 1 {
 		return fmt.Errorf("Orchestrator price higher than the set maximum price of %v wei per %v pixels", maxPrice.Num().Int64(), maxPrice.Denom().Int64())
 	}
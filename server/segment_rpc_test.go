@@ -2,6 +2,7 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/base64"
 	"errors"
@@ -15,6 +16,7 @@ import (
 	"testing"
 
 	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/golang/protobuf/proto"
 	"github.com/livepeer/go-livepeer/common"
 	"github.com/livepeer/go-livepeer/core"
@@ -75,6 +77,45 @@ func TestServeSegment_VerifySegCredsError(t *testing.T) {
 	assert.Equal(errSegEncoding.Error(), strings.TrimSpace(string(body)))
 }
 
+// overloadedOrchestrator refuses new streams for lack of capacity
+type overloadedOrchestrator struct {
+	*mockOrchestrator
+}
+
+func (o *overloadedOrchestrator) CheckCapacity(md *core.SegTranscodingMetadata) error {
+	return core.ErrOrchOverloaded
+}
+
+func TestServeSegment_OverloadedError(t *testing.T) {
+	orch := &overloadedOrchestrator{&mockOrchestrator{}}
+	handler := serveSegmentHandler(orch)
+
+	orch.On("VerifySig", mock.Anything, mock.Anything, mock.Anything).Return(true)
+
+	s := &BroadcastSession{
+		Broadcaster: stubBroadcaster2(),
+		ManifestID:  core.RandomManifestID(),
+	}
+	creds, err := genSegCreds(s, &stream.HLSSegment{}, nil)
+	require.Nil(t, err)
+
+	headers := map[string]string{
+		paymentHeader: "",
+		segmentHeader: creds,
+	}
+	resp := httpPostResp(handler, bytes.NewReader([]byte("foo")), headers)
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	require.Nil(t, err)
+
+	// Broadcasters retry the segment with another orchestrator
+	assert := assert.New(t)
+	assert.Equal(http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(core.ErrOrchOverloaded.Error(), strings.TrimSpace(string(body)))
+	assert.True(shouldStopSession(errors.New(strings.TrimSpace(string(body)))))
+}
+
 func TestServeSegment_MismatchHashError(t *testing.T) {
 	orch := &mockOrchestrator{}
 	handler := serveSegmentHandler(orch)
@@ -85,7 +126,7 @@ func TestServeSegment_MismatchHashError(t *testing.T) {
 		Broadcaster: stubBroadcaster2(),
 		ManifestID:  core.RandomManifestID(),
 	}
-	creds, err := genSegCreds(s, &stream.HLSSegment{})
+	creds, err := genSegCreds(s, &stream.HLSSegment{}, nil)
 	require.Nil(t, err)
 
 	orch.On("ProcessPayment", net.Payment{}, s.ManifestID).Return(nil)
@@ -118,7 +159,7 @@ func TestServeSegment_TranscodeSegError(t *testing.T) {
 		ManifestID:  core.RandomManifestID(),
 	}
 	seg := &stream.HLSSegment{Data: []byte("foo")}
-	creds, err := genSegCreds(s, seg)
+	creds, err := genSegCreds(s, seg, nil)
 	require.Nil(err)
 
 	md, err := verifySegCreds(orch, creds, ethcommon.Address{})
@@ -195,7 +236,7 @@ func TestGenSegCreds_FullProfiles(t *testing.T) {
 	}
 	seg := &stream.HLSSegment{Data: []byte("foo")}
 
-	data, err := genSegCreds(s, seg)
+	data, err := genSegCreds(s, seg, nil)
 	assert.Nil(err)
 
 	buf, err := base64.StdEncoding.DecodeString(data)
@@ -221,7 +262,7 @@ func TestGenSegCreds_Profiles(t *testing.T) {
 
 	seg := &stream.HLSSegment{Data: []byte("foo")}
 
-	data, err := genSegCreds(s, seg)
+	data, err := genSegCreds(s, seg, nil)
 	assert.Nil(err)
 
 	buf, err := base64.StdEncoding.DecodeString(data)
@@ -236,6 +277,44 @@ func TestGenSegCreds_Profiles(t *testing.T) {
 	assert.Equal(expectedProfiles, segData.FullProfiles)
 }
 
+func TestGenSegCreds_PresignedStorage(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	profiles := []ffmpeg.VideoProfile{ffmpeg.P720p60fps16x9, ffmpeg.P360p30fps16x9}
+	os, err := drivers.NewS3DriverWithConfig(drivers.S3Config{
+		Endpoint:        "http://minio:9000",
+		Bucket:          "bucket",
+		PathStyle:       true,
+		AccessKey:       "user",
+		AccessKeySecret: "secret",
+		PresignedPut:    true,
+	})
+	require.Nil(err)
+	s := &BroadcastSession{
+		Broadcaster:   stubBroadcaster2(),
+		ManifestID:    core.RandomManifestID(),
+		Profiles:      profiles,
+		BroadcasterOS: os.NewSession("mid"),
+	}
+
+	data, err := genSegCreds(s, &stream.HLSSegment{SeqNo: 7, Data: []byte("foo")}, nil)
+	require.Nil(err)
+	buf, err := base64.StdEncoding.DecodeString(data)
+	require.Nil(err)
+	segData := net.SegData{}
+	require.Nil(proto.Unmarshal(buf, &segData))
+
+	// each rendition the orchestrator uploads is presigned
+	require.Len(segData.Storage, 1)
+	info := segData.Storage[0].S3Info
+	assert.Equal("http://minio:9000/bucket", info.Host)
+	assert.Equal("http://minio:9000", info.Endpoint)
+	assert.Empty(info.Policy)
+	require.Len(info.PresignedUrls, 2)
+	assert.Contains(info.PresignedUrls["P720p60fps16x9/7.ts"], "http://minio:9000/bucket/mid/P720p60fps16x9/7.ts?")
+	assert.Contains(info.PresignedUrls["P360p30fps16x9/7.ts"], "http://minio:9000/bucket/mid/P360p30fps16x9/7.ts?")
+}
+
 func TestVerifySegCreds_FullProfiles(t *testing.T) {
 	assert := assert.New(t)
 	orch := &mockOrchestrator{}
@@ -276,6 +355,143 @@ func TestVerifySegCreds_FullProfiles(t *testing.T) {
 	assert.Equal(profiles, md.Profiles)
 }
 
+func TestGenVerifySegCreds_Format(t *testing.T) {
+	assert := assert.New(t)
+	orch := &mockOrchestrator{}
+
+	profiles := []ffmpeg.VideoProfile{ffmpeg.P720p60fps16x9, ffmpeg.P360p30fps16x9}
+	s := &BroadcastSession{
+		Broadcaster: stubBroadcaster2(),
+		ManifestID:  core.RandomManifestID(),
+		Profiles:    profiles,
+		Format:      core.FormatMP4,
+	}
+	seg := &stream.HLSSegment{Data: []byte("foo")}
+
+	// The format is covered by the signature
+	md := &core.SegTranscodingMetadata{
+		ManifestID: s.ManifestID,
+		Hash:       ethcommon.BytesToHash(crypto.Keccak256(seg.Data)),
+		Profiles:   profiles,
+		Format:     core.FormatMP4,
+	}
+	orch.On("VerifySig", mock.Anything, string(md.Flatten()), mock.Anything).Return(true).Once()
+	md.Format = core.FormatMPEGTS
+	orch.On("VerifySig", mock.Anything, string(md.Flatten()), mock.Anything).Return(true).Once()
+
+	creds, err := genSegCreds(s, seg, nil)
+	assert.Nil(err)
+
+	buf, err := base64.StdEncoding.DecodeString(creds)
+	assert.Nil(err)
+	segData := net.SegData{}
+	err = proto.Unmarshal(buf, &segData)
+	assert.Nil(err)
+	for _, p := range segData.FullProfiles {
+		assert.Equal(net.VideoProfile_MP4, p.Format)
+	}
+
+	md, err = verifySegCreds(orch, creds, ethcommon.Address{})
+	assert.Nil(err)
+	assert.Equal(core.FormatMP4, md.Format)
+
+	// Default format is mpegts
+	s.Format = core.FormatMPEGTS
+	creds, err = genSegCreds(s, seg, nil)
+	assert.Nil(err)
+	md, err = verifySegCreds(orch, creds, ethcommon.Address{})
+	assert.Nil(err)
+	assert.Equal(core.FormatMPEGTS, md.Format)
+	assert.Equal(core.FormatMPEGTS, netSegmentFormat(nil))
+}
+
+func TestGenVerifySegCreds_Audio(t *testing.T) {
+	assert := assert.New(t)
+	orch := &mockOrchestrator{}
+	audioProfile := ffmpeg.VideoProfile{Name: "audio", Resolution: "0x0", Bitrate: "0"}
+	profiles := []ffmpeg.VideoProfile{ffmpeg.P720p60fps16x9, ffmpeg.P360p30fps16x9, audioProfile}
+	s := &BroadcastSession{
+		Broadcaster: stubBroadcaster2(),
+		ManifestID:  core.RandomManifestID(),
+		Profiles:    profiles,
+		Renditions: core.RenditionProfiles{
+			ffmpeg.P360p30fps16x9.Name: {Audio: core.AudioProfile{Codec: core.AudioNone}},
+			"audio":                    {Audio: core.AudioProfile{Codec: core.AudioAAC, Bitrate: 64000, AudioOnly: true}},
+		},
+	}
+	seg := &stream.HLSSegment{Data: []byte("foo")}
+
+	// The audio settings are covered by the signature
+	signed := (&core.SegTranscodingMetadata{
+		ManifestID: s.ManifestID,
+		Hash:       ethcommon.BytesToHash(crypto.Keccak256(seg.Data)),
+		Profiles:   profiles,
+		Renditions: s.Renditions,
+	}).Flatten()
+	orch.On("VerifySig", mock.Anything, string(signed), mock.Anything).Return(true)
+
+	creds, err := genSegCreds(s, seg, nil)
+	assert.Nil(err)
+
+	buf, err := base64.StdEncoding.DecodeString(creds)
+	assert.Nil(err)
+	segData := net.SegData{}
+	err = proto.Unmarshal(buf, &segData)
+	assert.Nil(err)
+	assert.Equal(net.VideoProfile_AUDIO_COPY, segData.FullProfiles[0].AudioCodec)
+	assert.Equal(net.VideoProfile_AUDIO_NONE, segData.FullProfiles[1].AudioCodec)
+	assert.Equal(net.VideoProfile_AAC, segData.FullProfiles[2].AudioCodec)
+	assert.Equal(int32(64000), segData.FullProfiles[2].AudioBitrate)
+	assert.True(segData.FullProfiles[2].AudioOnly)
+
+	md, err := verifySegCreds(orch, creds, ethcommon.Address{})
+	assert.Nil(err)
+	assert.Equal(s.Renditions, md.Renditions)
+}
+
+func TestGenVerifySegCreds_Encodings(t *testing.T) {
+	assert := assert.New(t)
+	orch := &mockOrchestrator{}
+	profiles := []ffmpeg.VideoProfile{ffmpeg.P720p60fps16x9, ffmpeg.P360p30fps16x9}
+	s := &BroadcastSession{
+		Broadcaster: stubBroadcaster2(),
+		ManifestID:  core.RandomManifestID(),
+		Profiles:    profiles,
+		Renditions: core.RenditionProfiles{
+			ffmpeg.P720p60fps16x9.Name: {Encoding: core.VideoEncoding{Profile: core.ProfileH264High, GOP: 120, CRF: 21}},
+			ffmpeg.P360p30fps16x9.Name: {Encoding: core.VideoEncoding{Codec: core.CodecVP9}},
+		},
+	}
+	seg := &stream.HLSSegment{Data: []byte("foo")}
+
+	// The encoding settings are covered by the signature
+	signed := (&core.SegTranscodingMetadata{
+		ManifestID: s.ManifestID,
+		Hash:       ethcommon.BytesToHash(crypto.Keccak256(seg.Data)),
+		Profiles:   profiles,
+		Renditions: s.Renditions,
+	}).Flatten()
+	orch.On("VerifySig", mock.Anything, string(signed), mock.Anything).Return(true)
+
+	creds, err := genSegCreds(s, seg, nil)
+	assert.Nil(err)
+
+	buf, err := base64.StdEncoding.DecodeString(creds)
+	assert.Nil(err)
+	segData := net.SegData{}
+	err = proto.Unmarshal(buf, &segData)
+	assert.Nil(err)
+	assert.Equal(net.VideoProfile_H264, segData.FullProfiles[0].Codec)
+	assert.Equal(net.VideoProfile_H264_HIGH, segData.FullProfiles[0].Profile)
+	assert.Equal(int32(120), segData.FullProfiles[0].Gop)
+	assert.Equal(int32(21), segData.FullProfiles[0].Crf)
+	assert.Equal(net.VideoProfile_VP9, segData.FullProfiles[1].Codec)
+
+	md, err := verifySegCreds(orch, creds, ethcommon.Address{})
+	assert.Nil(err)
+	assert.Equal(s.Renditions, md.Renditions)
+}
+
 func TestMakeFfmpegVideoProfiles(t *testing.T) {
 	assert := assert.New(t)
 	videoProfiles := []*net.VideoProfile{
@@ -339,7 +555,7 @@ func TestServeSegment_OSSaveDataError(t *testing.T) {
 		},
 	}
 	seg := &stream.HLSSegment{Data: []byte("foo")}
-	creds, err := genSegCreds(s, seg)
+	creds, err := genSegCreds(s, seg, nil)
 	require.Nil(err)
 
 	md, err := verifySegCreds(orch, creds, ethcommon.Address{})
@@ -400,7 +616,7 @@ func TestServeSegment_ReturnSingleTranscodedSegmentData(t *testing.T) {
 		},
 	}
 	seg := &stream.HLSSegment{Data: []byte("foo")}
-	creds, err := genSegCreds(s, seg)
+	creds, err := genSegCreds(s, seg, nil)
 	require.Nil(err)
 
 	md, err := verifySegCreds(orch, creds, ethcommon.Address{})
@@ -458,7 +674,7 @@ func TestServeSegment_ReturnMultipleTranscodedSegmentData(t *testing.T) {
 		},
 	}
 	seg := &stream.HLSSegment{Data: []byte("foo")}
-	creds, err := genSegCreds(s, seg)
+	creds, err := genSegCreds(s, seg, nil)
 	require.Nil(err)
 
 	md, err := verifySegCreds(orch, creds, ethcommon.Address{})
@@ -515,7 +731,7 @@ func TestServeSegment_UnacceptableProcessPaymentError(t *testing.T) {
 		},
 	}
 	seg := &stream.HLSSegment{Data: []byte("foo")}
-	creds, err := genSegCreds(s, seg)
+	creds, err := genSegCreds(s, seg, nil)
 	require.Nil(err)
 
 	_, err = verifySegCreds(orch, creds, ethcommon.Address{})
@@ -566,7 +782,7 @@ func TestServeSegment_UpdateOrchestratorInfo(t *testing.T) {
 		},
 	}
 	seg := &stream.HLSSegment{Data: []byte("foo")}
-	creds, err := genSegCreds(s, seg)
+	creds, err := genSegCreds(s, seg, nil)
 	require.Nil(err)
 
 	md, err := verifySegCreds(orch, creds, ethcommon.Address{})
@@ -679,7 +895,7 @@ func TestServeSegment_InsufficientBalanceError(t *testing.T) {
 		ManifestID:  core.RandomManifestID(),
 	}
 	seg := &stream.HLSSegment{Data: []byte("foo")}
-	creds, err := genSegCreds(s, seg)
+	creds, err := genSegCreds(s, seg, nil)
 	require.Nil(err)
 
 	_, err = verifySegCreds(orch, creds, ethcommon.Address{})
@@ -718,7 +934,7 @@ func TestServeSegment_DebitFees_SingleRendition(t *testing.T) {
 		},
 	}
 	seg := &stream.HLSSegment{Data: []byte("foo")}
-	creds, err := genSegCreds(s, seg)
+	creds, err := genSegCreds(s, seg, nil)
 	require.Nil(err)
 
 	md, err := verifySegCreds(orch, creds, ethcommon.Address{})
@@ -778,7 +994,7 @@ func TestServeSegment_DebitFees_MultipleRenditions(t *testing.T) {
 		},
 	}
 	seg := &stream.HLSSegment{Data: []byte("foo")}
-	creds, err := genSegCreds(s, seg)
+	creds, err := genSegCreds(s, seg, nil)
 	require.Nil(err)
 
 	md, err := verifySegCreds(orch, creds, ethcommon.Address{})
@@ -848,7 +1064,7 @@ func TestServeSegment_DebitFees_OSSaveDataError_BreakLoop(t *testing.T) {
 		},
 	}
 	seg := &stream.HLSSegment{Data: []byte("foo")}
-	creds, err := genSegCreds(s, seg)
+	creds, err := genSegCreds(s, seg, nil)
 	require.Nil(err)
 
 	md, err := verifySegCreds(orch, creds, ethcommon.Address{})
@@ -920,7 +1136,7 @@ func TestServeSegment_DebitFees_TranscodeSegError_ZeroPixelsBilled(t *testing.T)
 		},
 	}
 	seg := &stream.HLSSegment{Data: []byte("foo")}
-	creds, err := genSegCreds(s, seg)
+	creds, err := genSegCreds(s, seg, nil)
 	require.Nil(err)
 
 	md, err := verifySegCreds(orch, creds, ethcommon.Address{})
@@ -963,7 +1179,7 @@ func TestSubmitSegment_GenSegCredsError(t *testing.T) {
 		ManifestID:  core.RandomManifestID(),
 	}
 
-	_, err := SubmitSegment(s, &stream.HLSSegment{}, 0)
+	_, err := SubmitSegment(context.Background(), s, &stream.HLSSegment{}, nil, 0)
 
 	assert.Equal(t, "Sign error", err.Error())
 }
@@ -979,7 +1195,7 @@ func TestSubmitSegment_RatPriceInfoError(t *testing.T) {
 		},
 	}
 
-	_, err := SubmitSegment(s, &stream.HLSSegment{}, 0)
+	_, err := SubmitSegment(context.Background(), s, &stream.HLSSegment{}, nil, 0)
 
 	assert.EqualError(t, err, "invalid priceInfo.pixelsPerUnit")
 }
@@ -997,7 +1213,7 @@ func TestSubmitSegment_EstimateFeeError(t *testing.T) {
 		},
 	}
 
-	_, err := SubmitSegment(s, &stream.HLSSegment{}, 0)
+	_, err := SubmitSegment(context.Background(), s, &stream.HLSSegment{}, nil, 0)
 
 	assert.Error(t, err)
 }
@@ -1018,7 +1234,7 @@ func TestSubmitSegment_NewBalanceUpdateError(t *testing.T) {
 		},
 	}
 
-	_, err := SubmitSegment(s, &stream.HLSSegment{}, 0)
+	_, err := SubmitSegment(context.Background(), s, &stream.HLSSegment{}, nil, 0)
 
 	assert.EqualError(t, err, expErr.Error())
 }
@@ -1049,7 +1265,7 @@ func TestSubmitSegment_GenPaymentError_CreateTicketBatchError(t *testing.T) {
 		OrchestratorInfo: oInfo,
 	}
 
-	_, err := SubmitSegment(s, &stream.HLSSegment{}, 0)
+	_, err := SubmitSegment(context.Background(), s, &stream.HLSSegment{}, nil, 0)
 
 	assert.EqualError(t, err, expErr.Error())
 	// Check that completeBalanceUpdate() adds back the existing credit when the update status is Staged
@@ -1083,7 +1299,7 @@ func TestSubmitSegment_GenPaymentError_ValidatePriceError(t *testing.T) {
 	BroadcastCfg.SetMaxPrice(big.NewRat(1, 5))
 	defer BroadcastCfg.SetMaxPrice(nil)
 
-	_, err := SubmitSegment(s, &stream.HLSSegment{}, 0)
+	_, err := SubmitSegment(context.Background(), s, &stream.HLSSegment{}, nil, 0)
 
 	assert.EqualErrorf(t, err, err.Error(), "Orchestrator price higher than the set maximum price of %v wei per %v pixels", int64(1), int64(5))
 	balance.AssertCalled(t, "Credit", existingCredit)
@@ -1102,7 +1318,7 @@ func TestSubmitSegment_HttpPostError(t *testing.T) {
 		},
 	}
 
-	_, err := SubmitSegment(s, &stream.HLSSegment{}, 0)
+	_, err := SubmitSegment(context.Background(), s, &stream.HLSSegment{}, nil, 0)
 
 	assert.Contains(t, err.Error(), "connection refused")
 
@@ -1116,7 +1332,7 @@ func TestSubmitSegment_HttpPostError(t *testing.T) {
 	s.Balance = balance
 	s.Sender = sender
 
-	_, err = SubmitSegment(s, &stream.HLSSegment{}, 0)
+	_, err = SubmitSegment(context.Background(), s, &stream.HLSSegment{}, nil, 0)
 
 	assert.Contains(t, err.Error(), "connection refused")
 	balance.AssertCalled(t, "Credit", existingCredit)
@@ -1141,7 +1357,7 @@ func TestSubmitSegment_Non200StatusCode(t *testing.T) {
 		},
 	}
 
-	_, err := SubmitSegment(s, &stream.HLSSegment{}, 0)
+	_, err := SubmitSegment(context.Background(), s, &stream.HLSSegment{}, nil, 0)
 
 	assert.Equal(t, "Server error", err.Error())
 
@@ -1155,7 +1371,7 @@ func TestSubmitSegment_Non200StatusCode(t *testing.T) {
 	s.Balance = balance
 	s.Sender = sender
 
-	_, err = SubmitSegment(s, &stream.HLSSegment{}, 0)
+	_, err = SubmitSegment(context.Background(), s, &stream.HLSSegment{}, nil, 0)
 
 	assert.Equal(t, "Server error", err.Error())
 	balance.AssertNotCalled(t, "Credit", mock.Anything)
@@ -1181,7 +1397,7 @@ func TestSubmitSegment_ProtoUnmarshalError(t *testing.T) {
 		},
 	}
 
-	_, err := SubmitSegment(s, &stream.HLSSegment{}, 0)
+	_, err := SubmitSegment(context.Background(), s, &stream.HLSSegment{}, nil, 0)
 
 	assert.Contains(t, err.Error(), "proto")
 
@@ -1195,7 +1411,7 @@ func TestSubmitSegment_ProtoUnmarshalError(t *testing.T) {
 	s.Balance = balance
 	s.Sender = sender
 
-	_, err = SubmitSegment(s, &stream.HLSSegment{}, 0)
+	_, err = SubmitSegment(context.Background(), s, &stream.HLSSegment{}, nil, 0)
 
 	assert.Contains(t, err.Error(), "proto")
 	balance.AssertNotCalled(t, "Credit", mock.Anything)
@@ -1227,7 +1443,7 @@ func TestSubmitSegment_TranscodeResultError(t *testing.T) {
 		},
 	}
 
-	_, err = SubmitSegment(s, &stream.HLSSegment{}, 0)
+	_, err = SubmitSegment(context.Background(), s, &stream.HLSSegment{}, nil, 0)
 
 	assert.Equal(t, "TranscodeResult error", err.Error())
 
@@ -1241,7 +1457,7 @@ func TestSubmitSegment_TranscodeResultError(t *testing.T) {
 	s.Balance = balance
 	s.Sender = sender
 
-	_, err = SubmitSegment(s, &stream.HLSSegment{}, 0)
+	_, err = SubmitSegment(context.Background(), s, &stream.HLSSegment{}, nil, 0)
 
 	assert.Equal(t, "TranscodeResult error", err.Error())
 	balance.AssertNotCalled(t, "Credit", mock.Anything)
@@ -1305,7 +1521,7 @@ func TestSubmitSegment_Success(t *testing.T) {
 	}
 
 	noNameSeg := &stream.HLSSegment{Data: []byte("dummy")}
-	tdata, err := SubmitSegment(s, noNameSeg, 0)
+	tdata, err := SubmitSegment(context.Background(), s, noNameSeg, nil, 0)
 
 	assert.Nil(err)
 	assert.Equal(1, len(tdata.Segments))
@@ -1316,17 +1532,17 @@ func TestSubmitSegment_Success(t *testing.T) {
 	// Check that latency score calculation is different for different segment durations
 	// The transcode duration calculated in SubmitSegment should be about the same across all calls
 	noNameSeg.Duration = 5.0
-	tdata, err = SubmitSegment(s, noNameSeg, 0)
+	tdata, err = SubmitSegment(context.Background(), s, noNameSeg, nil, 0)
 	assert.Nil(err)
 	latencyScore1 := tdata.LatencyScore
 
 	noNameSeg.Duration = 10.0
-	tdata, err = SubmitSegment(s, noNameSeg, 0)
+	tdata, err = SubmitSegment(context.Background(), s, noNameSeg, nil, 0)
 	assert.Nil(err)
 	latencyScore2 := tdata.LatencyScore
 
 	noNameSeg.Duration = .5
-	tdata, err = SubmitSegment(s, noNameSeg, 0)
+	tdata, err = SubmitSegment(context.Background(), s, noNameSeg, nil, 0)
 	assert.Nil(err)
 	latencyScore3 := tdata.LatencyScore
 
@@ -1338,7 +1554,7 @@ func TestSubmitSegment_Success(t *testing.T) {
 	buf, err = proto.Marshal(tr)
 	require.Nil(err)
 
-	tdata, err = SubmitSegment(s, noNameSeg, 0)
+	tdata, err = SubmitSegment(context.Background(), s, noNameSeg, nil, 0)
 	assert.Nil(err)
 	assert.NotEqual(tdata.Info, s.OrchestratorInfo)
 	assert.Equal(tdata.Info, tr.Info)
@@ -1354,7 +1570,7 @@ func TestSubmitSegment_Success(t *testing.T) {
 	}
 
 	seg := &stream.HLSSegment{Name: "foo", Data: []byte("dummy")}
-	SubmitSegment(s, seg, 0)
+	SubmitSegment(context.Background(), s, seg, nil, 0)
 
 	// Test completeBalanceUpdate() adds back change when the update status is ReceivedChange
 
@@ -1374,7 +1590,7 @@ func TestSubmitSegment_Success(t *testing.T) {
 	s.Balance = balance
 	s.Sender = sender
 
-	SubmitSegment(s, seg, 0)
+	SubmitSegment(context.Background(), s, seg, nil, 0)
 
 	balance.AssertCalled(t, "Credit", ratMatcher(newCredit))
 
@@ -1383,7 +1599,7 @@ func TestSubmitSegment_Success(t *testing.T) {
 	balance.On("StageUpdate", mock.Anything, mock.Anything).Return(0, big.NewRat(0, 1), existingCredit).Once()
 	balance.On("Credit", ratMatcher(existingCredit)).Once()
 
-	SubmitSegment(s, seg, 0)
+	SubmitSegment(context.Background(), s, seg, nil, 0)
 
 	balance.AssertCalled(t, "Credit", ratMatcher(existingCredit))
 
@@ -1392,7 +1608,7 @@ func TestSubmitSegment_Success(t *testing.T) {
 	balance.On("StageUpdate", mock.Anything, mock.Anything).Return(0, newCredit, existingCredit).Once()
 	balance.On("Credit", ratMatcher(totalCredit)).Once()
 
-	SubmitSegment(s, seg, 0)
+	SubmitSegment(context.Background(), s, seg, nil, 0)
 
 	balance.AssertCalled(t, "Credit", ratMatcher(totalCredit))
 
@@ -1407,7 +1623,7 @@ func TestSubmitSegment_Success(t *testing.T) {
 	balance.On("StageUpdate", mock.Anything, mock.Anything).Return(0, newCredit, existingCredit).Once()
 	balance.On("Credit", ratMatcher(change)).Once()
 
-	SubmitSegment(s, seg, 0)
+	SubmitSegment(context.Background(), s, seg, nil, 0)
 
 	balance.AssertCalled(t, "Credit", ratMatcher(change))
 
@@ -1421,7 +1637,7 @@ func TestSubmitSegment_Success(t *testing.T) {
 	balance.On("StageUpdate", mock.Anything, mock.Anything).Return(0, newCredit, existingCredit).Once()
 	balance.On("Credit", ratMatcher(change)).Once()
 
-	SubmitSegment(s, seg, 0)
+	SubmitSegment(context.Background(), s, seg, nil, 0)
 
 	balance.AssertCalled(t, "Credit", ratMatcher(change))
 
@@ -1435,7 +1651,7 @@ func TestSubmitSegment_Success(t *testing.T) {
 	balance.On("StageUpdate", mock.Anything, mock.Anything).Return(0, newCredit, existingCredit).Once()
 	balance.On("Credit", ratMatcher(change))
 
-	SubmitSegment(s, seg, 0)
+	SubmitSegment(context.Background(), s, seg, nil, 0)
 
 	balance.AssertCalled(t, "Credit", ratMatcher(change))
 }
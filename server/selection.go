@@ -2,7 +2,12 @@ package server
 
 import (
 	"container/heap"
+	"errors"
+	"fmt"
+	"math"
 	"math/rand"
+	"strconv"
+	"strings"
 
 	ethcommon "github.com/ethereum/go-ethereum/common"
 	"github.com/golang/glog"
@@ -239,3 +244,242 @@ func (s *LIFOSelector) Size() int {
 func (s *LIFOSelector) Clear() {
 	*s = nil
 }
+
+// Names of the session selection strategies
+const (
+	SelectionMinLS    = "minls"
+	SelectionWeighted = "weighted"
+)
+
+var ErrUnknownSelectionStrategy = errors.New("ErrUnknownSelectionStrategy")
+
+// SelectionWeights configures how much each factor counts towards the score
+// of a session in WeightedSelector. Weights are relative to each other.
+type SelectionWeights struct {
+	// Preference for cheaper orchestrators
+	Price float64
+	// Preference for orchestrators that returned results for more segments
+	SuccessRate float64
+	// Preference for orchestrators that transcode faster
+	LatencyScore float64
+	// Preference for orchestrators with more stake
+	Stake float64
+}
+
+// DefaultSelectionWeights weighs every factor equally
+var DefaultSelectionWeights = SelectionWeights{Price: 1, SuccessRate: 1, LatencyScore: 1, Stake: 1}
+
+// ParseSelectionWeights parses weights given as comma separated name=value
+// pairs, eg "price=2,success=1,latency=1,stake=0". Omitted weights are zero.
+func ParseSelectionWeights(s string) (SelectionWeights, error) {
+	var weights SelectionWeights
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(kv) != 2 {
+			return weights, fmt.Errorf("invalid selection weight %q", pair)
+		}
+		w, err := strconv.ParseFloat(kv[1], 64)
+		if err != nil || w < 0 {
+			return weights, fmt.Errorf("invalid selection weight %q", pair)
+		}
+		switch kv[0] {
+		case "price":
+			weights.Price = w
+		case "success":
+			weights.SuccessRate = w
+		case "latency":
+			weights.LatencyScore = w
+		case "stake":
+			weights.Stake = w
+		default:
+			return weights, fmt.Errorf("unknown selection weight %q", kv[0])
+		}
+	}
+	return weights, nil
+}
+
+func (w SelectionWeights) String() string {
+	return fmt.Sprintf("price=%v,success=%v,latency=%v,stake=%v", w.Price, w.SuccessRate, w.LatencyScore, w.Stake)
+}
+
+// WeightedSelector selects the BroadcastSession with the highest weighted score of price,
+// success rate, latency score and stake, relative to the other sessions.
+// Sessions priced above BroadcastCfg.MaxPrice are dropped.
+// WeightedSelector is not concurrency safe so the caller is responsible for ensuring safety for concurrent method calls
+type WeightedSelector struct {
+	sessions []*BroadcastSession
+
+	stakeRdr stakeReader
+	weights  SelectionWeights
+	// Stakes of the orchestrators, read when their sessions are added
+	orchStakes map[ethcommon.Address]int64
+
+	// Number of segments sent and transcoded by each orchestrator over the
+	// lifetime of the selector, keyed by transcoder URI
+	attempts  map[string]int
+	successes map[string]int
+}
+
+// NewWeightedSelector returns an instance of WeightedSelector configured with the given weights
+func NewWeightedSelector(stakeRdr stakeReader, weights SelectionWeights) *WeightedSelector {
+	return &WeightedSelector{
+		stakeRdr:  stakeRdr,
+		weights:   weights,
+		attempts:  make(map[string]int),
+		successes: make(map[string]int),
+	}
+}
+
+// Add adds the sessions to the selector's list of sessions and reads the
+// stakes of their orchestrators
+func (s *WeightedSelector) Add(sessions []*BroadcastSession) {
+	s.sessions = append(s.sessions, sessions...)
+	s.readStakes(sessions)
+}
+
+// Complete adds the session back to the selector's list of sessions and records its success
+func (s *WeightedSelector) Complete(sess *BroadcastSession) {
+	s.successes[sess.OrchestratorInfo.Transcoder]++
+	s.sessions = append(s.sessions, sess)
+}
+
+// Select returns the session with the highest score
+func (s *WeightedSelector) Select() *BroadcastSession {
+	s.dropOverpriced()
+	if len(s.sessions) == 0 {
+		return nil
+	}
+
+	scores := s.scores()
+	best := 0
+	for i := range s.sessions {
+		if scores[i] > scores[best] {
+			best = i
+		}
+	}
+	sess := s.sessions[best]
+	s.sessions = append(s.sessions[:best], s.sessions[best+1:]...)
+	s.attempts[sess.OrchestratorInfo.Transcoder]++
+	return sess
+}
+
+// Size returns the number of sessions stored by the selector
+func (s *WeightedSelector) Size() int {
+	return len(s.sessions)
+}
+
+// Clear resets the selector's state
+func (s *WeightedSelector) Clear() {
+	s.sessions = nil
+	s.stakeRdr = nil
+	s.orchStakes = nil
+}
+
+// dropOverpriced removes sessions whose price went above the maximum price
+func (s *WeightedSelector) dropOverpriced() {
+	sessions := s.sessions[:0]
+	for _, sess := range s.sessions {
+		if err := validatePrice(sess); err != nil && sess.OrchestratorInfo.GetPriceInfo() != nil {
+			glog.V(common.DEBUG).Infof("Dropping session orch=%s err=%v", sess.OrchestratorInfo.Transcoder, err)
+			continue
+		}
+		sessions = append(sessions, sess)
+	}
+	s.sessions = sessions
+}
+
+// scores computes the weighted score of every session. Each factor is
+// scaled to [0, 1] before weighing.
+func (s *WeightedSelector) scores() []float64 {
+	n := len(s.sessions)
+	// Sessions without a price are treated as the most expensive ones
+	prices := make([]float64, n)
+	minPrice, maxPrice := math.Inf(1), 0.0
+	for i, sess := range s.sessions {
+		prices[i] = math.NaN()
+		if price, err := ratPriceInfo(sess.OrchestratorInfo.GetPriceInfo()); err == nil && price != nil {
+			prices[i], _ = price.Float64()
+			minPrice = math.Min(minPrice, prices[i])
+			maxPrice = math.Max(maxPrice, prices[i])
+		}
+	}
+	for i := range prices {
+		if math.IsNaN(prices[i]) {
+			prices[i] = maxPrice
+		}
+	}
+
+	stakes := s.stakes()
+	maxStake := 0.0
+	for _, stake := range stakes {
+		maxStake = math.Max(maxStake, stake)
+	}
+
+	scores := make([]float64, n)
+	for i, sess := range s.sessions {
+		// Cheapest session scores 1, most expensive 0
+		priceScore := 1.0
+		if maxPrice > minPrice {
+			priceScore = (maxPrice - prices[i]) / (maxPrice - minPrice)
+		}
+
+		// Sessions without history start at 0.5
+		transcoder := sess.OrchestratorInfo.Transcoder
+		successScore := float64(s.successes[transcoder]+1) / float64(s.attempts[transcoder]+2)
+
+		// Transcoding in real time scores 0.5, as do sessions without a latency score
+		latencyScore := 0.5
+		if sess.LatencyScore > 0 {
+			latencyScore = 1 / (1 + sess.LatencyScore)
+		}
+
+		stakeScore := 0.0
+		if maxStake > 0 {
+			stakeScore = stakes[i] / maxStake
+		}
+
+		scores[i] = s.weights.Price*priceScore + s.weights.SuccessRate*successScore +
+			s.weights.LatencyScore*latencyScore + s.weights.Stake*stakeScore
+	}
+	return scores
+}
+
+// readStakes caches the stakes of the orchestrators of the sessions. Stakes
+// that can't be read are left as they were.
+func (s *WeightedSelector) readStakes(sessions []*BroadcastSession) {
+	if s.stakeRdr == nil || s.weights.Stake == 0 {
+		return
+	}
+	addrs := make([]ethcommon.Address, 0, len(sessions))
+	for _, sess := range sessions {
+		if sess.OrchestratorInfo.TicketParams != nil {
+			addrs = append(addrs, ethcommon.BytesToAddress(sess.OrchestratorInfo.TicketParams.Recipient))
+		}
+	}
+	if len(addrs) == 0 {
+		return
+	}
+	stakeMap, err := s.stakeRdr.Stakes(addrs)
+	if err != nil {
+		glog.Errorf("failed to read stake weights for selection: %v", err)
+		return
+	}
+	if s.orchStakes == nil {
+		s.orchStakes = make(map[ethcommon.Address]int64)
+	}
+	for _, addr := range addrs {
+		s.orchStakes[addr] = stakeMap[addr]
+	}
+}
+
+// stakes returns the cached stake of every session's orchestrator, or zero
+// if unknown
+func (s *WeightedSelector) stakes() []float64 {
+	stakes := make([]float64, len(s.sessions))
+	for i, sess := range s.sessions {
+		if sess.OrchestratorInfo.TicketParams != nil {
+			stakes[i] = float64(s.orchStakes[ethcommon.BytesToAddress(sess.OrchestratorInfo.TicketParams.Recipient)])
+		}
+	}
+	return stakes
+}
@@ -66,6 +66,7 @@ func TestStoreStakeReader(t *testing.T) {
 type stubStakeReader struct {
 	stakes map[ethcommon.Address]int64
 	err    error
+	calls  int
 }
 
 func newStubStakeReader() *stubStakeReader {
@@ -73,6 +74,7 @@ func newStubStakeReader() *stubStakeReader {
 }
 
 func (r *stubStakeReader) Stakes(addrs []ethcommon.Address) (map[ethcommon.Address]int64, error) {
+	r.calls++
 	if r.err != nil {
 		return nil, r.err
 	}
@@ -429,3 +431,185 @@ func TestMinLSSelector_RemoveUnknownSession(t *testing.T) {
 	sel.removeUnknownSession(0)
 	assert.Empty(sel.unknownSessions)
 }
+
+func TestParseSelectionWeights(t *testing.T) {
+	assert := assert.New(t)
+
+	w, err := ParseSelectionWeights("price=2,success=1.5, latency=0.5,stake=0")
+	assert.Nil(err)
+	assert.Equal(SelectionWeights{Price: 2, SuccessRate: 1.5, LatencyScore: 0.5}, w)
+	assert.Equal("price=2,success=1.5,latency=0.5,stake=0", w.String())
+
+	// omitted weights are zero
+	w, err = ParseSelectionWeights("price=1")
+	assert.Nil(err)
+	assert.Equal(SelectionWeights{Price: 1}, w)
+
+	for _, s := range []string{"", "price", "price=abc", "price=-1", "foo=1"} {
+		_, err = ParseSelectionWeights(s)
+		assert.NotNil(err, s)
+	}
+}
+
+func weightedTestSession(transcoder string, price int64) *BroadcastSession {
+	info := &net.OrchestratorInfo{
+		Transcoder:   transcoder,
+		TicketParams: &net.TicketParams{Recipient: ethcommon.BytesToAddress([]byte(transcoder)).Bytes()},
+	}
+	if price > 0 {
+		info.PriceInfo = &net.PriceInfo{PricePerUnit: price, PixelsPerUnit: 1}
+	}
+	return &BroadcastSession{OrchestratorInfo: info}
+}
+
+func TestWeightedSelector_Price(t *testing.T) {
+	assert := assert.New(t)
+	defer BroadcastCfg.SetMaxPrice(nil)
+
+	sel := NewWeightedSelector(nil, SelectionWeights{Price: 1})
+	assert.Nil(sel.Select())
+
+	sel.Add([]*BroadcastSession{
+		weightedTestSession("a", 3),
+		weightedTestSession("b", 1),
+		weightedTestSession("c", 2),
+	})
+	assert.Equal(3, sel.Size())
+	assert.Equal("b", sel.Select().OrchestratorInfo.Transcoder)
+	assert.Equal("c", sel.Select().OrchestratorInfo.Transcoder)
+	assert.Equal("a", sel.Select().OrchestratorInfo.Transcoder)
+	assert.Nil(sel.Select())
+
+	// sessions above the max price are dropped
+	BroadcastCfg.SetMaxPrice(big.NewRat(2, 1))
+	sel.Add([]*BroadcastSession{
+		weightedTestSession("a", 3),
+		weightedTestSession("b", 2),
+		weightedTestSession("c", 0),
+	})
+	// unpriced sessions are least preferred
+	assert.Equal("b", sel.Select().OrchestratorInfo.Transcoder)
+	assert.Equal(1, sel.Size())
+	assert.Equal("c", sel.Select().OrchestratorInfo.Transcoder)
+	assert.Nil(sel.Select())
+}
+
+func TestWeightedSelector_SuccessRate(t *testing.T) {
+	assert := assert.New(t)
+
+	sel := NewWeightedSelector(nil, SelectionWeights{SuccessRate: 1})
+	a, b := weightedTestSession("a", 0), weightedTestSession("b", 0)
+	sel.Add([]*BroadcastSession{a, b})
+
+	// a fails and is not completed
+	assert.Equal(a, sel.Select())
+	sel.Add([]*BroadcastSession{a})
+	// b succeeds
+	assert.Equal(b, sel.Select())
+	sel.Complete(b)
+
+	assert.Equal(b, sel.Select())
+	assert.Equal(a, sel.Select())
+}
+
+func TestWeightedSelector_LatencyScore(t *testing.T) {
+	assert := assert.New(t)
+
+	sel := NewWeightedSelector(nil, SelectionWeights{LatencyScore: 1})
+	slow, fast, unknown := weightedTestSession("slow", 0), weightedTestSession("fast", 0), weightedTestSession("unknown", 0)
+	slow.LatencyScore = 2.0
+	fast.LatencyScore = 0.5
+	sel.Add([]*BroadcastSession{slow, unknown, fast})
+
+	assert.Equal(fast, sel.Select())
+	assert.Equal(unknown, sel.Select())
+	assert.Equal(slow, sel.Select())
+}
+
+func TestWeightedSelector_Stake(t *testing.T) {
+	assert := assert.New(t)
+
+	stakeRdr := newStubStakeReader()
+	a, b := weightedTestSession("a", 0), weightedTestSession("b", 0)
+	stakeRdr.SetStakes(map[ethcommon.Address]int64{
+		ethcommon.BytesToAddress(a.OrchestratorInfo.TicketParams.Recipient): 100,
+		ethcommon.BytesToAddress(b.OrchestratorInfo.TicketParams.Recipient): 500,
+	})
+	sel := NewWeightedSelector(stakeRdr, SelectionWeights{Stake: 1})
+	sel.Add([]*BroadcastSession{a, b})
+	assert.Equal(b, sel.Select())
+
+	// stakes are read when sessions are added, not on every selection
+	assert.Equal(1, stakeRdr.calls)
+	sel.Complete(b)
+	assert.Equal(b, sel.Select())
+	assert.Equal(a, sel.Select())
+	assert.Equal(1, stakeRdr.calls)
+
+	// stakes that can't be read are left as they were
+	stakeRdr.err = errors.New("Stakes error")
+	sel.Add([]*BroadcastSession{a, b})
+	assert.Equal(2, stakeRdr.calls)
+	assert.Equal(b, sel.Select())
+
+	// stake read errors are ignored
+	stakeRdr.calls = 0
+	sel = NewWeightedSelector(stakeRdr, SelectionWeights{Stake: 1})
+	sel.Add([]*BroadcastSession{a, b})
+	assert.Equal(a, sel.Select())
+
+	// refreshed stakes are used; b wasn't refreshed so its stake is unknown
+	stakeRdr.err = nil
+	sel.Add([]*BroadcastSession{a})
+	assert.Equal(a, sel.Select())
+	assert.Equal(b, sel.Select())
+	assert.Equal(2, stakeRdr.calls)
+}
+
+func TestWeightedSelector_Combined(t *testing.T) {
+	assert := assert.New(t)
+
+	// a cheap but slow orchestrator loses to a slightly pricier fast one
+	// unless price is weighed more
+	cheap, fast := weightedTestSession("cheap", 1), weightedTestSession("fast", 2)
+	cheap.LatencyScore = 9.0
+	fast.LatencyScore = 0.25
+
+	sel := NewWeightedSelector(nil, SelectionWeights{Price: 1, LatencyScore: 2})
+	sel.Add([]*BroadcastSession{cheap, fast})
+	assert.Equal(fast, sel.Select())
+
+	sel = NewWeightedSelector(nil, SelectionWeights{Price: 2, LatencyScore: 1})
+	sel.Add([]*BroadcastSession{cheap, fast})
+	assert.Equal(cheap, sel.Select())
+
+	sel.Clear()
+	assert.Zero(sel.Size())
+	assert.Nil(sel.Select())
+}
+
+func TestBroadcastConfig_SelectionStrategy(t *testing.T) {
+	assert := assert.New(t)
+	cfg := &BroadcastConfig{}
+
+	strategy, weights := cfg.SelectionStrategy()
+	assert.Equal(SelectionMinLS, strategy)
+	assert.Equal(DefaultSelectionWeights, weights)
+	assert.IsType(&MinLSSelector{}, cfg.newSelector(nil))
+
+	assert.Equal(ErrUnknownSelectionStrategy, cfg.SetSelectionStrategy("foo", nil))
+
+	assert.Nil(cfg.SetSelectionStrategy(SelectionWeighted, &SelectionWeights{Price: 3}))
+	strategy, weights = cfg.SelectionStrategy()
+	assert.Equal(SelectionWeighted, strategy)
+	assert.Equal(SelectionWeights{Price: 3}, weights)
+	sel, ok := cfg.newSelector(nil).(*WeightedSelector)
+	assert.True(ok)
+	assert.Equal(SelectionWeights{Price: 3}, sel.weights)
+
+	// nil weights keep the current ones
+	assert.Nil(cfg.SetSelectionStrategy(SelectionMinLS, nil))
+	strategy, weights = cfg.SelectionStrategy()
+	assert.Equal(SelectionMinLS, strategy)
+	assert.Equal(SelectionWeights{Price: 3}, weights)
+}
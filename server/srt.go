@@ -0,0 +1,132 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/livepeer/go-livepeer/monitor"
+	"github.com/livepeer/go-livepeer/srt"
+	"github.com/livepeer/lpms/stream"
+)
+
+// SRTAddr is the address broadcasters listen on for SRT ingest. SRT ingest
+// is disabled if empty.
+var SRTAddr string
+
+// SRTPassphrase, if set, is the passphrase SRT callers must encrypt their
+// stream with
+var SRTPassphrase string
+
+var errSRTMode = errors.New("ErrSRTMode")
+
+// srtConn is an SRT connection as far as ingest is concerned
+type srtConn interface {
+	io.ReadCloser
+	StreamID() string
+}
+
+func (s *LivepeerServer) serveSRT(ln *srt.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handleSRT(conn)
+	}
+}
+
+// handleSRT ingests an SRT stream the same way as an RTMP stream: the auth
+// webhook is consulted with the stream ID, and the MPEG-TS stream is cut
+// into segments for transcoding
+func (s *LivepeerServer) handleSRT(conn srtConn) {
+	defer conn.Close()
+
+	u, err := srtStreamURL(conn.StreamID())
+	if err != nil {
+		glog.Errorf("Rejecting SRT stream streamID=%q err=%v", conn.StreamID(), err)
+		return
+	}
+	appData := (createRTMPStreamIDHandler(s))(u)
+	if appData == nil {
+		glog.Errorf("Rejecting SRT stream streamID=%q", conn.StreamID())
+		return
+	}
+	st := stream.NewBasicRTMPVideoStream(appData)
+	params := streamParams(st)
+
+	// The stream is registered once the first segment is cut, so the
+	// source resolution is known
+	segmenter := newTSSegmenter(conn, SegLen)
+	var cxn *rtmpConnection
+	for {
+		seg, err := segmenter.Next()
+		if err != nil {
+			if err != io.EOF {
+				glog.Errorf("Error segmenting SRT stream manifestID=%s err=%v", params.mid, err)
+			}
+			break
+		}
+		if cxn == nil {
+			params.resolution = segmenter.Resolution()
+			if cxn, err = s.registerConnection(st); err != nil {
+				glog.Errorf("Error registering SRT stream manifestID=%s err=%v", params.mid, err)
+				return
+			}
+			if monitor.Enabled {
+				monitor.StreamCreated(string(cxn.mid), cxn.nonce)
+				monitor.StreamStarted(cxn.nonce)
+			}
+			glog.Infof("Video Created With ManifestID: %v streamID=%q", cxn.mid, conn.StreamID())
+		} else if !s.hasConnection(cxn) {
+			// The stream was ended from elsewhere
+			return
+		}
+		go processSegment(cxn, seg)
+	}
+	if cxn != nil && s.hasConnection(cxn) {
+		removeRTMPStream(s, cxn.mid)
+	}
+}
+
+func (s *LivepeerServer) hasConnection(cxn *rtmpConnection) bool {
+	s.connectionLock.RLock()
+	defer s.connectionLock.RUnlock()
+	return s.rtmpConnections[cxn.mid] == cxn
+}
+
+// srtStreamURL returns the ingest URL that an SRT stream ID stands for. The
+// stream ID is either the path of the URL, as for RTMP ingest, or follows
+// the SRT access control syntax, eg. "#!::r=movie1,m=publish", where the
+// resource is the path. The stream ID is passed on to the auth webhook in
+// the `streamid` query parameter.
+func srtStreamURL(streamID string) (*url.URL, error) {
+	path := streamID
+	if strings.HasPrefix(streamID, "#!::") {
+		path = ""
+		for _, kv := range strings.Split(strings.TrimPrefix(streamID, "#!::"), ",") {
+			parts := strings.SplitN(kv, "=", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			switch parts[0] {
+			case "r":
+				path = parts[1]
+			case "m":
+				// Streams can only be pushed
+				if parts[1] != "publish" {
+					return nil, errSRTMode
+				}
+			}
+		}
+	}
+	u := &url.URL{
+		Scheme:   "srt",
+		Host:     SRTAddr,
+		Path:     "/" + strings.TrimLeft(path, "/"),
+		RawQuery: url.Values{"streamid": {streamID}}.Encode(),
+	}
+	return u, nil
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubSRTConn struct {
+	io.Reader
+	streamID string
+	closed   bool
+}
+
+func (c *stubSRTConn) StreamID() string {
+	return c.streamID
+}
+
+func (c *stubSRTConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestSRTStreamURL(t *testing.T) {
+	assert := assert.New(t)
+	oldAddr := SRTAddr
+	defer func() { SRTAddr = oldAddr }()
+	SRTAddr = "127.0.0.1:9000"
+
+	tests := []struct {
+		streamID string
+		path     string
+	}{
+		{"", "/"},
+		{"movie1", "/movie1"},
+		{"/stream/movie1/key", "/stream/movie1/key"},
+		{"#!::r=movie1,m=publish", "/movie1"},
+		{"#!::u=admin,r=live/movie1", "/live/movie1"},
+		{"#!::u=admin", "/"},
+	}
+	for _, tt := range tests {
+		u, err := srtStreamURL(tt.streamID)
+		assert.Nil(err)
+		assert.Equal("srt", u.Scheme)
+		assert.Equal(SRTAddr, u.Host)
+		assert.Equal(tt.path, u.Path)
+		assert.Equal(tt.streamID, u.Query().Get("streamid"))
+	}
+
+	// Only publishing is supported
+	_, err := srtStreamURL("#!::r=movie1,m=request")
+	assert.Equal(errSRTMode, err)
+}
+
+func TestHandleSRT(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	s := setupServer()
+	defer serverCleanup(s)
+	s.rtmpConnections = map[core.ManifestID]*rtmpConnection{}
+	defer func() { s.rtmpConnections = map[core.ManifestID]*rtmpConnection{} }()
+
+	var webhookURL string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		out, _ := ioutil.ReadAll(r.Body)
+		var req authWebhookReq
+		assert.Nil(json.Unmarshal(out, &req))
+		webhookURL = req.URL
+		if req.URL == "srt:///denied?streamid=denied" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write(nil)
+	}))
+	defer ts.Close()
+	AuthWebhookURL = ts.URL
+	defer func() { AuthWebhookURL = "" }()
+
+	// Rejected by the webhook
+	conn := &stubSRTConn{Reader: strings.NewReader(""), streamID: "denied"}
+	s.handleSRT(conn)
+	assert.Equal("srt:///denied?streamid=denied", webhookURL)
+	assert.True(conn.closed)
+	assert.Len(s.rtmpConnections, 0)
+
+	// The stream is registered once the first segment arrives, with the
+	// resolution in the stream
+	pr, pw := io.Pipe()
+	conn = &stubSRTConn{Reader: pr, streamID: "#!::r=srtMovie,m=publish"}
+	done := make(chan struct{})
+	go func() {
+		s.handleSRT(conn)
+		close(done)
+	}()
+	data := testTSStream(testFrames(0, 150))
+	_, err := pw.Write(data[:len(data)/2])
+	require.Nil(err)
+	assert.Equal("srt:///srtMovie?streamid=%23%21%3A%3Ar%3DsrtMovie%2Cm%3Dpublish", webhookURL)
+	var cxn *rtmpConnection
+	for i := 0; i < 100 && cxn == nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+		s.connectionLock.RLock()
+		cxn = s.rtmpConnections["srtMovie"]
+		s.connectionLock.RUnlock()
+	}
+	require.NotNil(cxn)
+	assert.Equal("1280x720", cxn.profile.Resolution)
+
+	// The stream ends with the connection
+	_, err = pw.Write(data[len(data)/2:])
+	require.Nil(err)
+	pw.Close()
+	<-done
+	assert.True(conn.closed)
+	s.connectionLock.RLock()
+	assert.Len(s.rtmpConnections, 0)
+	s.connectionLock.RUnlock()
+}
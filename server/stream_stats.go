@@ -0,0 +1,178 @@
+package server
+
+import (
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/monitor"
+)
+
+// streamStats keeps live statistics of a broadcast stream. A nil
+// *streamStats ignores updates.
+type streamStats struct {
+	mu          sync.Mutex
+	started     time.Time
+	ingested    int
+	transcoded  int
+	failed      int
+	ticketsSent int64
+	valueSent   *big.Rat
+	lastErr     error
+	lastErrTime time.Time
+}
+
+func newStreamStats() *streamStats {
+	return &streamStats{started: time.Now(), valueSent: new(big.Rat)}
+}
+
+func (s *streamStats) segmentIngested() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ingested++
+}
+
+func (s *streamStats) segmentTranscoded() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.transcoded++
+}
+
+// segmentFailed counts a segment that won't be transcoded
+func (s *streamStats) segmentFailed(err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failed++
+	s.lastErr, s.lastErrTime = err, time.Now()
+}
+
+// setError records an error that may not fail the segment, eg. a failed
+// attempt that will be retried
+func (s *streamStats) setError(err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastErr, s.lastErrTime = err, time.Now()
+}
+
+// paid records tickets sent for the stream and their expected value in wei
+func (s *streamStats) paid(numTickets int, value *big.Rat) {
+	if s == nil || value == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ticketsSent += int64(numTickets)
+	s.valueSent.Add(s.valueSent, value)
+}
+
+// streamStatus is the JSON representation of a stream's statistics
+type streamStatus struct {
+	ManifestID         core.ManifestID      `json:"manifestID"`
+	StartedAt          int64                `json:"startedAt"`
+	Resolution         string               `json:"resolution"`
+	Renditions         []string             `json:"renditions"`
+	SegmentsIngested   int                  `json:"segmentsIngested"`
+	SegmentsTranscoded int                  `json:"segmentsTranscoded"`
+	SegmentsFailed     int                  `json:"segmentsFailed"`
+	SuccessRate        float64              `json:"successRate"`
+	Orchestrators      []orchestratorStatus `json:"orchestrators"`
+	TicketsSent        int64                `json:"ticketsSent"`
+	// Expected value of the tickets sent, in wei
+	ValueSent string       `json:"valueSent"`
+	LastError *streamError `json:"lastError,omitempty"`
+}
+
+type orchestratorStatus struct {
+	Address      string  `json:"address"`
+	LatencyScore float64 `json:"latencyScore"`
+	// Price in wei per pixel; empty if the orchestrator has no price
+	PricePerPixel string `json:"pricePerPixel,omitempty"`
+}
+
+type streamError struct {
+	Message   string `json:"message"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// stats returns the statistics of the stream on the connection, if kept
+func (cxn *rtmpConnection) stats() *streamStats {
+	if cxn.params == nil {
+		return nil
+	}
+	return cxn.params.stats
+}
+
+// status returns the statistics of the stream on the connection
+func (cxn *rtmpConnection) status() *streamStatus {
+	st := &streamStatus{
+		ManifestID:    cxn.mid,
+		Renditions:    []string{},
+		Orchestrators: []orchestratorStatus{},
+		SuccessRate:   1,
+		ValueSent:     "0",
+	}
+	if cxn.profile != nil {
+		st.Resolution = cxn.profile.Resolution
+	}
+	if cxn.params != nil {
+		for _, p := range cxn.params.profiles {
+			st.Renditions = append(st.Renditions, p.Name)
+		}
+		if s := cxn.params.stats; s != nil {
+			s.mu.Lock()
+			st.StartedAt = s.started.Unix()
+			st.SegmentsIngested = s.ingested
+			st.SegmentsTranscoded = s.transcoded
+			st.SegmentsFailed = s.failed
+			st.TicketsSent = s.ticketsSent
+			st.ValueSent = s.valueSent.FloatString(0)
+			if s.lastErr != nil {
+				st.LastError = &streamError{Message: s.lastErr.Error(), Timestamp: s.lastErrTime.Unix()}
+			}
+			s.mu.Unlock()
+		}
+	}
+
+	// Prefer the success rate kept for metrics, which disregards segments
+	// still in flight
+	rate, ok := 0.0, false
+	if monitor.Enabled {
+		rate, ok = monitor.StreamSuccessRate(cxn.nonce)
+	}
+	if ok {
+		st.SuccessRate = rate
+	} else if done := st.SegmentsTranscoded + st.SegmentsFailed; done > 0 {
+		st.SuccessRate = float64(st.SegmentsTranscoded) / float64(done)
+	}
+
+	if cxn.sessManager != nil {
+		for _, sess := range cxn.sessManager.sessions() {
+			orch := orchestratorStatus{
+				Address:      sess.OrchestratorInfo.GetTranscoder(),
+				LatencyScore: sess.LatencyScore,
+			}
+			if price, err := ratPriceInfo(sess.OrchestratorInfo.GetPriceInfo()); err == nil && price != nil {
+				orch.PricePerPixel = price.FloatString(3)
+			}
+			st.Orchestrators = append(st.Orchestrators, orch)
+		}
+		sort.Slice(st.Orchestrators, func(i, j int) bool {
+			return st.Orchestrators[i].Address < st.Orchestrators[j].Address
+		})
+	}
+	return st
+}
@@ -0,0 +1,538 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/livepeer/lpms/stream"
+)
+
+const (
+	tsPacketLen = 188
+	tsSync      = 0x47
+	tsClockRate = 90000
+	// PTS is 33 bits and wraps around
+	ptsMask = 1<<33 - 1
+	// Larger jumps in PTS are discontinuities
+	maxPTSJump = 60 * tsClockRate
+	// How much of each video frame is checked for keyframe NAL units
+	unitProbeLen = 1024
+	// How many packets are held back while probing a unit that doesn't fill up
+	maxHeldLen = 256 * tsPacketLen
+
+	streamTypeMPEG2 = 0x02
+	streamTypeH264  = 0x1b
+	streamTypeHEVC  = 0x24
+)
+
+var errTSSync = errors.New("ErrTSSync")
+
+// Segments are cut short past this size, so a stream that stops sending
+// keyframes can't grow them without bound. Whatever follows is dropped
+// until the next keyframe.
+var maxTSSegmentLen = 64 * 1024 * 1024
+
+// tsSegmenter cuts an MPEG-TS stream into segments of at least segLen.
+// Segments start on a video keyframe, or on any packetized elementary
+// stream unit for streams without video, and each start with the program
+// tables so they can be decoded on their own.
+type tsSegmenter struct {
+	r      *bufio.Reader
+	segLen int64
+	seq    uint64
+
+	pat, pmt   []byte
+	pmtPID     int
+	pid        int
+	streamType byte
+	resolution string
+
+	// Start of the unit being probed for a keyframe, and the packets held
+	// back until it is known which segment they go in
+	unit *pesUnit
+	held []byte
+
+	buf        []byte
+	start, pts int64
+	ready      []*stream.HLSSegment
+}
+
+type pesUnit struct {
+	pts          int64
+	randomAccess bool
+	es           []byte
+}
+
+func newTSSegmenter(r io.Reader, segLen time.Duration) *tsSegmenter {
+	return &tsSegmenter{
+		r:      bufio.NewReaderSize(r, 64*tsPacketLen),
+		segLen: int64(segLen.Seconds() * tsClockRate),
+		pmtPID: -1,
+		pid:    -1,
+		start:  -1,
+	}
+}
+
+// Resolution returns the video resolution read from the stream, if known
+func (s *tsSegmenter) Resolution() string {
+	return s.resolution
+}
+
+// probeTSResolution returns the video resolution from the parameter sets
+// in MPEG-TS data, or an empty string if none are found
+func probeTSResolution(data []byte) string {
+	s := newTSSegmenter(bytes.NewReader(data), 0)
+	pkt := make([]byte, tsPacketLen)
+	for s.resolution == "" {
+		if err := s.readPacket(pkt); err != nil {
+			s.endUnit()
+			break
+		}
+		s.handlePacket(pkt)
+	}
+	return s.resolution
+}
+
+// probeTSKeyframe checks whether MPEG-TS data starts with a keyframe, so
+// it can be decoded without the data that came before it
+func probeTSKeyframe(data []byte) bool {
+	s := newTSSegmenter(bytes.NewReader(data), 0)
+	pkt := make([]byte, tsPacketLen)
+	var first *pesUnit
+	for {
+		if err := s.readPacket(pkt); err != nil {
+			s.endUnit()
+			break
+		}
+		s.handlePacket(pkt)
+		if first == nil {
+			first = s.unit
+		} else if s.unit != first {
+			break
+		}
+	}
+	// Segments only start on a keyframe
+	return first != nil && s.start >= 0
+}
+
+// Next returns the next segment. At the end of the stream, it returns the
+// remainder of the stream before returning io.EOF.
+func (s *tsSegmenter) Next() (*stream.HLSSegment, error) {
+	pkt := make([]byte, tsPacketLen)
+	for len(s.ready) == 0 {
+		err := s.readPacket(pkt)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			s.endUnit()
+			return s.flush(s.pts)
+		}
+		if err != nil {
+			return nil, err
+		}
+		s.handlePacket(pkt)
+	}
+	seg := s.ready[0]
+	s.ready = s.ready[1:]
+	return seg, nil
+}
+
+func (s *tsSegmenter) readPacket(pkt []byte) error {
+	// Skip ahead to the next sync byte if the stream is corrupt
+	for skipped := 0; ; skipped++ {
+		b, err := s.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if b == tsSync {
+			pkt[0] = b
+			break
+		}
+		if skipped > 10*tsPacketLen {
+			return errTSSync
+		}
+	}
+	_, err := io.ReadFull(s.r, pkt[1:])
+	return err
+}
+
+func (s *tsSegmenter) handlePacket(pkt []byte) {
+	pid := int(pkt[1]&0x1f)<<8 | int(pkt[2])
+	unitStart := pkt[1]&0x40 != 0
+	afc := pkt[3] >> 4 & 0x3
+	payload := pkt[4:]
+	randomAccess := false
+	if afc&0x2 != 0 {
+		afLen := int(pkt[4])
+		if afLen > tsPacketLen-5 {
+			return
+		}
+		randomAccess = afLen > 0 && pkt[5]&0x40 != 0
+		payload = pkt[5+afLen:]
+	}
+	if afc&0x1 == 0 {
+		payload = nil
+	}
+
+	switch {
+	case pid == 0 && unitStart:
+		if s.parsePAT(payload) {
+			s.pat = append([]byte{}, pkt...)
+		}
+	case pid == s.pmtPID && unitStart:
+		if s.parsePMT(payload) {
+			s.pmt = append([]byte{}, pkt...)
+		}
+	case pid == s.pid && unitStart:
+		s.endUnit()
+		if pts, es, ok := parsePES(payload); ok {
+			s.unit = &pesUnit{pts: pts, randomAccess: randomAccess, es: append([]byte{}, es...)}
+		}
+	case pid == s.pid && s.unit != nil:
+		s.unit.es = append(s.unit.es, payload...)
+	}
+
+	if s.unit == nil {
+		if s.start >= 0 {
+			s.buf = append(s.buf, pkt...)
+			s.capSegment()
+		}
+		return
+	}
+	s.held = append(s.held, pkt...)
+	if len(s.unit.es) >= unitProbeLen || len(s.held) >= maxHeldLen {
+		s.endUnit()
+	}
+}
+
+// endUnit decides whether the probed unit starts a new segment, and
+// releases the packets held back
+func (s *tsSegmenter) endUnit() {
+	u := s.unit
+	if u == nil {
+		return
+	}
+	s.unit = nil
+	// Always probe, for the resolution in the parameter sets
+	keyframe := s.isKeyframe(u.es) || u.randomAccess
+	if keyframe && s.start >= 0 {
+		if elapsed := (u.pts - s.start) & ptsMask; elapsed > maxPTSJump {
+			// Timestamps jumped, eg. the encoder restarted
+			s.cut(s.pts)
+		} else if elapsed >= s.segLen {
+			s.cut(u.pts)
+		}
+	}
+	if keyframe && s.start < 0 {
+		s.start, s.pts = u.pts, u.pts
+		s.buf = append(append([]byte{}, s.pat...), s.pmt...)
+	}
+	// Frames may be out of presentation order
+	if s.start >= 0 && (u.pts-s.pts)&ptsMask < maxPTSJump {
+		s.pts = u.pts
+	}
+	if s.start >= 0 {
+		s.buf = append(s.buf, s.held...)
+		s.capSegment()
+	}
+	s.held = s.held[:0]
+}
+
+func (s *tsSegmenter) capSegment() {
+	if s.start >= 0 && len(s.buf) >= maxTSSegmentLen {
+		s.cut(s.pts)
+	}
+}
+
+func (s *tsSegmenter) cut(end int64) {
+	if seg, err := s.flush(end); err == nil {
+		s.ready = append(s.ready, seg)
+	}
+}
+
+// flush returns the segment buffered so far, ending at the given PTS
+func (s *tsSegmenter) flush(end int64) (*stream.HLSSegment, error) {
+	if s.start < 0 {
+		return nil, io.EOF
+	}
+	seg := &stream.HLSSegment{
+		SeqNo:    s.seq,
+		Name:     fmt.Sprintf("%d.ts", s.seq),
+		Data:     s.buf,
+		Duration: float64((end-s.start)&ptsMask) / tsClockRate,
+	}
+	s.seq++
+	s.start, s.buf = -1, nil
+	return seg, nil
+}
+
+// parsePAT finds the PID of the first program's map table
+func (s *tsSegmenter) parsePAT(payload []byte) bool {
+	section, ok := psiSection(payload, 0x00)
+	if !ok {
+		return false
+	}
+	// Program loop follows the 8 byte header, up to the CRC
+	for i := 8; i+4 <= len(section)-4; i += 4 {
+		program := int(section[i])<<8 | int(section[i+1])
+		if program != 0 {
+			s.pmtPID = int(section[i+2]&0x1f)<<8 | int(section[i+3])
+			return true
+		}
+	}
+	return false
+}
+
+// parsePMT picks the stream to cut segments on: the video stream, or the
+// first stream if there is no video
+func (s *tsSegmenter) parsePMT(payload []byte) bool {
+	section, ok := psiSection(payload, 0x02)
+	if !ok || len(section) < 12 {
+		return false
+	}
+	pid, streamType := -1, byte(0)
+	infoLen := int(section[10]&0x0f)<<8 | int(section[11])
+	for i := 12 + infoLen; i+5 <= len(section)-4; {
+		typ := section[i]
+		esPID := int(section[i+1]&0x1f)<<8 | int(section[i+2])
+		esInfoLen := int(section[i+3]&0x0f)<<8 | int(section[i+4])
+		if pid < 0 || (isVideoStreamType(typ) && !isVideoStreamType(streamType)) {
+			pid, streamType = esPID, typ
+		}
+		i += 5 + esInfoLen
+	}
+	if pid < 0 {
+		return false
+	}
+	s.pid, s.streamType = pid, streamType
+	return true
+}
+
+func isVideoStreamType(typ byte) bool {
+	return typ == streamTypeH264 || typ == streamTypeHEVC || typ == streamTypeMPEG2
+}
+
+// isKeyframe checks the start of an access unit for the NAL units that
+// begin a keyframe. Streams without video start a segment anywhere.
+func (s *tsSegmenter) isKeyframe(es []byte) bool {
+	if !isVideoStreamType(s.streamType) {
+		return true
+	}
+	keyframe := false
+	for _, nal := range splitNALUnits(es) {
+		switch s.streamType {
+		case streamTypeH264:
+			switch nal[0] & 0x1f {
+			case 5:
+				keyframe = true
+			case 7:
+				keyframe = true
+				if s.resolution == "" {
+					if w, h, err := parseH264SPS(nal); err == nil {
+						s.resolution = fmt.Sprintf("%dx%d", w, h)
+					}
+				}
+			}
+		case streamTypeHEVC:
+			// IRAP pictures and parameter sets
+			if typ := nal[0] >> 1 & 0x3f; (typ >= 16 && typ <= 21) || (typ >= 32 && typ <= 34) {
+				keyframe = true
+			}
+		}
+	}
+	return keyframe
+}
+
+// psiSection returns the table section that starts in the payload
+func psiSection(payload []byte, tableID byte) ([]byte, bool) {
+	if len(payload) < 1 || int(payload[0])+1 >= len(payload) {
+		return nil, false
+	}
+	section := payload[1+int(payload[0]):]
+	if len(section) < 3 || section[0] != tableID {
+		return nil, false
+	}
+	length := 3 + (int(section[1]&0x0f)<<8 | int(section[2]))
+	if length > len(section) {
+		return nil, false
+	}
+	return section[:length], true
+}
+
+// parsePES returns the presentation timestamp of a packetized elementary
+// stream unit, and whatever part of its data is in the payload
+func parsePES(payload []byte) (int64, []byte, bool) {
+	if len(payload) < 14 || !bytes.HasPrefix(payload, []byte{0, 0, 1}) || payload[7]&0x80 == 0 {
+		return 0, nil, false
+	}
+	hdrLen := 9 + int(payload[8])
+	if hdrLen > len(payload) {
+		return 0, nil, false
+	}
+	p := payload[9:14]
+	pts := int64(p[0]>>1&0x07)<<30 | int64(p[1])<<22 | int64(p[2]>>1)<<15 | int64(p[3])<<7 | int64(p[4]>>1)
+	return pts, payload[hdrLen:], true
+}
+
+// splitNALUnits splits Annex B data on start codes
+func splitNALUnits(b []byte) [][]byte {
+	var nals [][]byte
+	start := -1
+	for i := 0; i+2 < len(b); i++ {
+		if b[i] != 0 || b[i+1] != 0 || b[i+2] != 1 {
+			continue
+		}
+		if start >= 0 {
+			nals = append(nals, bytes.TrimRight(b[start:i], "\x00"))
+		}
+		start = i + 3
+		i += 2
+	}
+	if start >= 0 && start < len(b) {
+		nals = append(nals, b[start:])
+	}
+	var nonEmpty [][]byte
+	for _, nal := range nals {
+		if len(nal) > 0 {
+			nonEmpty = append(nonEmpty, nal)
+		}
+	}
+	return nonEmpty
+}
+
+var errBadSPS = errors.New("ErrBadSPS")
+
+// parseH264SPS returns the display resolution in an H.264 sequence
+// parameter set NAL unit
+func parseH264SPS(nal []byte) (int, int, error) {
+	// Remove emulation prevention bytes
+	rbsp := make([]byte, 0, len(nal))
+	for i := 1; i < len(nal); i++ {
+		if i >= 3 && nal[i] == 3 && nal[i-1] == 0 && nal[i-2] == 0 {
+			continue
+		}
+		rbsp = append(rbsp, nal[i])
+	}
+	r := &bitReader{b: rbsp}
+
+	profile := r.bits(8)
+	r.bits(16) // constraint flags and level
+	r.ue()     // seq_parameter_set_id
+	chromaFormat := 1
+	switch profile {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		chromaFormat = r.ue()
+		if chromaFormat == 3 {
+			r.bits(1) // separate_colour_plane_flag
+		}
+		r.ue()    // bit_depth_luma_minus8
+		r.ue()    // bit_depth_chroma_minus8
+		r.bits(1) // qpprime_y_zero_transform_bypass_flag
+		if r.bits(1) == 1 {
+			lists := 8
+			if chromaFormat == 3 {
+				lists = 12
+			}
+			for i := 0; i < lists; i++ {
+				if r.bits(1) == 0 {
+					continue
+				}
+				size := 16
+				if i >= 6 {
+					size = 64
+				}
+				last, next := 8, 8
+				for j := 0; j < size && next != 0; j++ {
+					next = (last + r.se() + 256) % 256
+					if next != 0 {
+						last = next
+					}
+				}
+			}
+		}
+	}
+	r.ue() // log2_max_frame_num_minus4
+	switch r.ue() {
+	case 0:
+		r.ue() // log2_max_pic_order_cnt_lsb_minus4
+	case 1:
+		r.bits(1) // delta_pic_order_always_zero_flag
+		r.se()    // offset_for_non_ref_pic
+		r.se()    // offset_for_top_to_bottom_field
+		for n := r.ue(); n > 0 && r.err == nil; n-- {
+			r.se()
+		}
+	}
+	r.ue()    // max_num_ref_frames
+	r.bits(1) // gaps_in_frame_num_value_allowed_flag
+	widthMbs := r.ue() + 1
+	heightMapUnits := r.ue() + 1
+	frameMbsOnly := r.bits(1)
+	if frameMbsOnly == 0 {
+		r.bits(1) // mb_adaptive_frame_field_flag
+	}
+	r.bits(1) // direct_8x8_inference_flag
+	var cropLeft, cropRight, cropTop, cropBottom int
+	if r.bits(1) == 1 {
+		cropLeft, cropRight, cropTop, cropBottom = r.ue(), r.ue(), r.ue(), r.ue()
+	}
+	if r.err != nil {
+		return 0, 0, r.err
+	}
+
+	cropX, cropY := 1, 2-frameMbsOnly
+	switch chromaFormat {
+	case 1:
+		cropX, cropY = 2, 2*(2-frameMbsOnly)
+	case 2:
+		cropX = 2
+	}
+	width := widthMbs*16 - cropX*(cropLeft+cropRight)
+	height := (2-frameMbsOnly)*heightMapUnits*16 - cropY*(cropTop+cropBottom)
+	if width <= 0 || height <= 0 {
+		return 0, 0, errBadSPS
+	}
+	return width, height, nil
+}
+
+// bitReader reads the exp-Golomb coded fields of parameter sets
+type bitReader struct {
+	b   []byte
+	pos int
+	err error
+}
+
+func (r *bitReader) bits(n int) int {
+	v := 0
+	for i := 0; i < n; i++ {
+		if r.pos >= 8*len(r.b) {
+			r.err = errBadSPS
+			return 0
+		}
+		v = v<<1 | int(r.b[r.pos/8]>>(7-uint(r.pos%8))&1)
+		r.pos++
+	}
+	return v
+}
+
+func (r *bitReader) ue() int {
+	zeros := 0
+	for r.bits(1) == 0 {
+		if r.err != nil || zeros > 31 {
+			r.err = errBadSPS
+			return 0
+		}
+		zeros++
+	}
+	return 1<<uint(zeros) - 1 + r.bits(zeros)
+}
+
+func (r *bitReader) se() int {
+	v := r.ue()
+	if v%2 == 0 {
+		return -v / 2
+	}
+	return (v + 1) / 2
+}
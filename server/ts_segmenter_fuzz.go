@@ -0,0 +1,30 @@
+//go:build gofuzz
+// +build gofuzz
+
+package server
+
+import (
+	"bytes"
+	"time"
+)
+
+// FuzzTSSegmenter is the go-fuzz entry point for the segmenter, which reads
+// streams from untrusted broadcasters:
+//
+//	go-fuzz-build -func FuzzTSSegmenter github.com/livepeer/go-livepeer/server
+//	go-fuzz -bin server-fuzz.zip -workdir fuzz/ts
+func FuzzTSSegmenter(data []byte) int {
+	probeTSResolution(data)
+	s := newTSSegmenter(bytes.NewReader(data), time.Second)
+	found := 0
+	for {
+		seg, err := s.Next()
+		if err != nil {
+			return found
+		}
+		if len(seg.Data)%tsPacketLen != 0 || seg.Duration < 0 {
+			panic("invalid segment")
+		}
+		found = 1
+	}
+}
@@ -0,0 +1,374 @@
+package server
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/livepeer/lpms/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testPMTPID   = 0x1000
+	testVideoPID = 0x100
+	testAudioPID = 0x101
+)
+
+// 1280x720 High 4:2:2 profile
+var testSPS, _ = hex.DecodeString("677a001fbcb200a00b742000007d20001d4c11e30649")
+
+// testTSPacket builds a single TS packet, padding the payload with an
+// adaptation field
+func testTSPacket(pid int, unitStart, randomAccess bool, payload []byte) []byte {
+	pkt := []byte{tsSync, byte(pid >> 8 & 0x1f), byte(pid), 0x10}
+	if unitStart {
+		pkt[1] |= 0x40
+	}
+	if stuffing := tsPacketLen - 4 - len(payload); stuffing > 0 || randomAccess {
+		pkt[3] |= 0x20
+		af := make([]byte, stuffing)
+		af[0] = byte(stuffing - 1)
+		if stuffing > 1 {
+			af[1] = 0
+			if randomAccess {
+				af[1] = 0x40
+			}
+			for i := 2; i < len(af); i++ {
+				af[i] = 0xff
+			}
+		}
+		pkt = append(pkt, af...)
+	}
+	return append(pkt, payload...)
+}
+
+// testPSI wraps a table section with a pointer field and a dummy CRC
+func testPSI(tableID byte, body []byte) []byte {
+	length := len(body) + 4
+	section := []byte{0, tableID, 0xb0 | byte(length>>8), byte(length)}
+	section = append(section, body...)
+	return append(section, 0, 0, 0, 0)
+}
+
+func testPAT() []byte {
+	return testTSPacket(0, true, false, testPSI(0x00, []byte{
+		0, 1, 0xc1, 0, 0, // transport stream ID, version, section numbers
+		0, 1, 0xe0 | testPMTPID>>8, testPMTPID & 0xff,
+	}))
+}
+
+func testPMT(streamTypes ...byte) []byte {
+	body := []byte{
+		0, 1, 0xc1, 0, 0, // program number, version, section numbers
+		0xe0 | testVideoPID>>8, testVideoPID & 0xff, // PCR PID
+		0xf0, 0, // program info length
+	}
+	for i, typ := range streamTypes {
+		pid := testVideoPID + i
+		body = append(body, typ, 0xe0|byte(pid>>8), byte(pid), 0xf0, 0)
+	}
+	return testTSPacket(testPMTPID, true, false, testPSI(0x02, body))
+}
+
+func testPES(pts int64, es []byte) []byte {
+	pes := []byte{0, 0, 1, 0xe0, 0, 0, 0x80, 0x80, 5,
+		byte(0x21 | pts>>29&0x0e), byte(pts >> 22), byte(pts>>14 | 1), byte(pts >> 7), byte(pts<<1 | 1)}
+	return append(pes, es...)
+}
+
+type testFrame struct {
+	pts          int64
+	keyframe     bool
+	randomAccess bool
+}
+
+// testTSStream builds a stream with a video frame per packet. Keyframes
+// carry parameter sets unless they are only flagged as random access points.
+func testTSStream(frames []testFrame) []byte {
+	data := append(testPAT(), testPMT(streamTypeH264, 0x0f)...)
+	aud := []byte{0, 0, 0, 1, 0x09, 0xf0}
+	for _, f := range frames {
+		es := append([]byte{}, aud...)
+		if f.keyframe && !f.randomAccess {
+			es = append(append(es, 0, 0, 0, 1), testSPS...)
+			es = append(es, 0, 0, 1, 0x65, 0x88, 0x84)
+		} else {
+			es = append(es, 0, 0, 1, 0x41, 0x9a, 0x02)
+		}
+		data = append(data, testTSPacket(testVideoPID, true, f.randomAccess, testPES(f.pts, es))...)
+		data = append(data, testTSPacket(testAudioPID, true, false, testPES(f.pts, []byte{0xff, 0xf1}))...)
+	}
+	return data
+}
+
+// testFrames returns frames at 30fps with a keyframe every second
+func testFrames(start int64, n int) []testFrame {
+	var frames []testFrame
+	for i := 0; i < n; i++ {
+		frames = append(frames, testFrame{pts: (start + int64(i)*3000) & ptsMask, keyframe: i%30 == 0})
+	}
+	return frames
+}
+
+func readSegments(t *testing.T, s *tsSegmenter) []*stream.HLSSegment {
+	var segs []*stream.HLSSegment
+	for {
+		seg, err := s.Next()
+		if err == io.EOF {
+			return segs
+		}
+		require.NoError(t, err)
+		segs = append(segs, seg)
+	}
+}
+
+func TestTSSegmenter(t *testing.T) {
+	assert := assert.New(t)
+
+	data := testTSStream(testFrames(0, 180))
+	s := newTSSegmenter(bytes.NewReader(data), 2*time.Second)
+	segs := readSegments(t, s)
+	require.Len(t, segs, 3)
+	assert.Equal("1280x720", s.Resolution())
+
+	total := 0
+	for i, seg := range segs {
+		assert.Equal(uint64(i), seg.SeqNo)
+		// Every segment starts with the program tables and a keyframe
+		assert.Equal(testPAT(), seg.Data[:tsPacketLen])
+		assert.Equal(testPMT(streamTypeH264, 0x0f), seg.Data[tsPacketLen:2*tsPacketLen])
+		assert.True(bytes.Contains(seg.Data[2*tsPacketLen:3*tsPacketLen], testSPS))
+		assert.Equal(0, len(seg.Data)%tsPacketLen)
+		total += len(seg.Data)
+	}
+	assert.Equal("0.ts", segs[0].Name)
+	assert.Equal(2.0, segs[0].Duration)
+	assert.Equal(2.0, segs[1].Duration)
+	// The last segment ends at the last frame
+	assert.InDelta(59.0/30, segs[2].Duration, 0.0001)
+	// Only the tables are repeated
+	assert.Equal(len(data)+2*2*tsPacketLen, total)
+}
+
+func TestTSSegmenter_Keyframes(t *testing.T) {
+	assert := assert.New(t)
+
+	// Frames before the first keyframe are dropped
+	frames := testFrames(0, 90)[15:]
+	s := newTSSegmenter(bytes.NewReader(testTSStream(frames)), 2*time.Second)
+	segs := readSegments(t, s)
+	require.Len(t, segs, 1)
+	assert.InDelta(59.0/30, segs[0].Duration, 0.0001)
+
+	// Keyframes may only be flagged as random access points
+	frames = testFrames(0, 90)
+	for i := range frames {
+		frames[i].randomAccess = frames[i].keyframe
+	}
+	s = newTSSegmenter(bytes.NewReader(testTSStream(frames)), time.Second)
+	segs = readSegments(t, s)
+	assert.Len(segs, 3)
+	assert.Equal("", s.Resolution())
+
+	// Without keyframes, there is nothing to segment
+	frames = testFrames(0, 90)
+	for i := range frames {
+		frames[i].keyframe = false
+	}
+	s = newTSSegmenter(bytes.NewReader(testTSStream(frames)), time.Second)
+	assert.Len(readSegments(t, s), 0)
+}
+
+func TestTSSegmenter_Timestamps(t *testing.T) {
+	assert := assert.New(t)
+
+	// PTS wraps around in the middle of the first segment
+	frames := testFrames(ptsMask-30*3000, 120)
+	s := newTSSegmenter(bytes.NewReader(testTSStream(frames)), 2*time.Second)
+	segs := readSegments(t, s)
+	require.Len(t, segs, 2)
+	assert.Equal(2.0, segs[0].Duration)
+
+	// Timestamps reset, eg. if the encoder restarts
+	frames = append(testFrames(90000*100, 45), testFrames(0, 60)...)
+	s = newTSSegmenter(bytes.NewReader(testTSStream(frames)), 2*time.Second)
+	segs = readSegments(t, s)
+	require.Len(t, segs, 2)
+	assert.InDelta(44.0/30, segs[0].Duration, 0.0001)
+	assert.InDelta(59.0/30, segs[1].Duration, 0.0001)
+}
+
+func TestTSSegmenter_AudioOnly(t *testing.T) {
+	assert := assert.New(t)
+
+	data := append(testPAT(), testPMT(0x0f)...)
+	for i := 0; i < 100; i++ {
+		data = append(data, testTSPacket(testVideoPID, true, false, testPES(int64(i)*1920, []byte{0xff, 0xf1}))...)
+	}
+	s := newTSSegmenter(bytes.NewReader(data), time.Second)
+	segs := readSegments(t, s)
+	// Cut on the first audio frame past each second
+	require.Len(t, segs, 3)
+	assert.Equal(float64(47*1920)/tsClockRate, segs[0].Duration)
+	assert.Equal(float64(47*1920)/tsClockRate, segs[1].Duration)
+}
+
+func TestTSSegmenter_Corrupt(t *testing.T) {
+	assert := assert.New(t)
+
+	// Garbage before the stream is skipped
+	data := append([]byte("garbage"), testTSStream(testFrames(0, 60))...)
+	segs := readSegments(t, newTSSegmenter(bytes.NewReader(data), time.Second))
+	assert.Len(segs, 2)
+
+	// Truncated stream
+	data = testTSStream(testFrames(0, 60))
+	segs = readSegments(t, newTSSegmenter(bytes.NewReader(data[:len(data)-10]), time.Second))
+	assert.Len(segs, 2)
+
+	// Not a transport stream at all
+	_, err := newTSSegmenter(bytes.NewReader(make([]byte, 20*tsPacketLen)), time.Second).Next()
+	assert.Equal(errTSSync, err)
+}
+
+func TestTSSegmenter_MaxSize(t *testing.T) {
+	assert := assert.New(t)
+	oldMax := maxTSSegmentLen
+	defer func() { maxTSSegmentLen = oldMax }()
+	maxTSSegmentLen = 20 * tsPacketLen
+
+	// Cut short, then frames up to the next keyframe are dropped
+	segs := readSegments(t, newTSSegmenter(bytes.NewReader(testTSStream(testFrames(0, 60))), 10*time.Second))
+	require.Len(t, segs, 2)
+	for _, seg := range segs {
+		assert.Equal(maxTSSegmentLen, len(seg.Data))
+	}
+	assert.Equal(float64(8*3000)/tsClockRate, segs[0].Duration)
+	assert.Equal(float64(38*3000-30*3000)/tsClockRate, segs[1].Duration)
+}
+
+// Segments of a stream muxed by ffmpeg can be decoded on their own
+func TestTSSegmenter_File(t *testing.T) {
+	assert := assert.New(t)
+	data, err := ioutil.ReadFile("../core/test.ts")
+	require.NoError(t, err)
+
+	s := newTSSegmenter(bytes.NewReader(data), 2*time.Second)
+	segs := readSegments(t, s)
+	require.Len(t, segs, 4)
+	for i, d := range []float64{2.035, 2.169, 2.403, 2.035} {
+		assert.InDelta(d, segs[i].Duration, 0.001)
+		assert.Zero(len(segs[i].Data) % tsPacketLen)
+		// Starts with the program association table
+		assert.Equal([]byte{tsSync, 0x40, 0}, segs[i].Data[:3])
+	}
+	assert.Equal("1280x720", s.Resolution())
+
+	ffprobe, err := exec.LookPath("ffprobe")
+	if err != nil {
+		t.Skip("ffprobe not found")
+	}
+	dir, err := ioutil.TempDir("", "segments")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	for _, seg := range segs {
+		fname := filepath.Join(dir, seg.Name)
+		require.NoError(t, ioutil.WriteFile(fname, seg.Data, 0644))
+		out, err := exec.Command(ffprobe, "-v", "error", "-select_streams", "v", "-show_entries", "frame=key_frame",
+			"-read_intervals", "%+#1", "-of", "csv=p=0", fname).Output()
+		require.NoError(t, err)
+		assert.Equal("1", strings.TrimSpace(string(out)), seg.Name)
+	}
+}
+
+// Corrupted streams are segmented without panicking, as with go-fuzz; see
+// FuzzTSSegmenter
+func TestTSSegmenter_Random(t *testing.T) {
+	file, err := ioutil.ReadFile("../core/test.ts")
+	require.NoError(t, err)
+	streams := [][]byte{testTSStream(testFrames(0, 120)), file[:200*tsPacketLen]}
+
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		data := append([]byte{}, streams[i%len(streams)]...)
+		for n := r.Intn(50); n >= 0; n-- {
+			switch pos := r.Intn(len(data)); r.Intn(3) {
+			case 0:
+				data[pos] = byte(r.Intn(256))
+			case 1:
+				data = append(data[:pos], data[pos+r.Intn(len(data)-pos):]...)
+			case 2:
+				data = append(data[:pos], append(make([]byte, r.Intn(tsPacketLen)), data[pos:]...)...)
+			}
+			if len(data) == 0 {
+				break
+			}
+		}
+		probeTSResolution(data)
+		s := newTSSegmenter(bytes.NewReader(data), time.Second)
+		for {
+			seg, err := s.Next()
+			if err != nil {
+				break
+			}
+			require.Zero(t, len(seg.Data)%tsPacketLen)
+			require.True(t, seg.Duration >= 0)
+		}
+	}
+}
+
+func TestProbeTSResolution(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("1280x720", probeTSResolution(testTSStream(testFrames(0, 60))))
+	// A lone keyframe is probed at the end of the data
+	assert.Equal("1280x720", probeTSResolution(testTSStream(testFrames(0, 1))))
+
+	// No parameter sets
+	frames := testFrames(0, 30)
+	frames[0].randomAccess = true
+	assert.Equal("", probeTSResolution(testTSStream(frames)))
+	assert.Equal("", probeTSResolution(nil))
+}
+
+func TestProbeTSKeyframe(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(probeTSKeyframe(testTSStream(testFrames(0, 30))))
+	assert.False(probeTSKeyframe(testTSStream(testFrames(0, 30)[1:])))
+
+	// Flagged as a random access point
+	frames := testFrames(0, 30)[1:]
+	frames[0].randomAccess = true
+	assert.True(probeTSKeyframe(testTSStream(frames)))
+	assert.False(probeTSKeyframe(nil))
+}
+
+func TestParseH264SPS(t *testing.T) {
+	assert := assert.New(t)
+
+	w, h, err := parseH264SPS(testSPS)
+	assert.Nil(err)
+	assert.Equal(1280, w)
+	assert.Equal(720, h)
+
+	// Baseline profile 1920x1080, cropped from 1088
+	sps, _ := hex.DecodeString("6742c028d900780227e5c04400000300040000030180")
+	w, h, err = parseH264SPS(sps)
+	assert.Nil(err)
+	assert.Equal(1920, w)
+	assert.Equal(1080, h)
+
+	_, _, err = parseH264SPS(testSPS[:8])
+	assert.Equal(errBadSPS, err)
+}
@@ -124,6 +124,22 @@ func (s *LivepeerServer) cliWebServerHandlers(bindAddr string) *http.ServeMux {
 			glog.Errorf("Invalid transcoding options: %v", transcodingOptions)
 			return
 		}
+		// Selection strategy is optional; keep the current one if omitted
+		strategy, weights := BroadcastCfg.SelectionStrategy()
+		if v := r.FormValue("selectionStrategy"); v != "" {
+			strategy = v
+		}
+		if v := r.FormValue("selectionWeights"); v != "" {
+			if weights, err = ParseSelectionWeights(v); err != nil {
+				glog.Errorf("Invalid selection weights: %v", err)
+				return
+			}
+		}
+		if err := BroadcastCfg.SetSelectionStrategy(strategy, &weights); err != nil {
+			glog.Errorf("Invalid selection strategy %q: %v", strategy, err)
+			return
+		}
+
 		BroadcastCfg.SetMaxPrice(price)
 		BroadcastJobVideoProfiles = profiles
 		if price != nil {
@@ -132,6 +148,7 @@ func (s *LivepeerServer) cliWebServerHandlers(bindAddr string) *http.ServeMux {
 			glog.Info("Maximum transcoding price per pixel not set, broadcaster is currently set to accept ANY price.\n")
 		}
 		glog.Infof("Transcode Job Type: %v", BroadcastJobVideoProfiles)
+		glog.Infof("Orchestrator selection strategy: %s weights: %v", strategy, weights)
 	})
 
 	mux.HandleFunc("/getBroadcastConfig", func(w http.ResponseWriter, r *http.Request) {
@@ -139,12 +156,17 @@ func (s *LivepeerServer) cliWebServerHandlers(bindAddr string) *http.ServeMux {
 		for _, p := range BroadcastJobVideoProfiles {
 			pNames = append(pNames, p.Name)
 		}
+		strategy, weights := BroadcastCfg.SelectionStrategy()
 		config := struct {
 			MaxPrice           *big.Rat
 			TranscodingOptions string
+			SelectionStrategy  string
+			SelectionWeights   SelectionWeights
 		}{
 			BroadcastCfg.MaxPrice(),
 			strings.Join(pNames, ","),
+			strategy,
+			weights,
 		}
 
 		data, err := json.Marshal(config)
@@ -1106,6 +1128,26 @@ func (s *LivepeerServer) cliWebServerHandlers(bindAddr string) *http.ServeMux {
 	mux.Handle("/senderInfo", senderInfoHandler(s.LivepeerNode.Eth))
 	mux.Handle("/ticketBrokerParams", ticketBrokerParamsHandler(s.LivepeerNode.Eth))
 
+	// Orchestrator access list
+
+	mux.Handle("/orchestratorAccessList", orchAccessListHandler(OrchAccess))
+	mux.Handle("/allowOrchestrator", mustHaveFormParams(allowOrchestratorHandler(OrchAccess), "orchestrator"))
+	mux.Handle("/denyOrchestrator", mustHaveFormParams(denyOrchestratorHandler(OrchAccess), "orchestrator"))
+	mux.Handle("/removeOrchestratorAccess", mustHaveFormParams(removeOrchestratorAccessHandler(OrchAccess), "orchestrator"))
+
+	// Remote transcoders
+
+	mux.Handle("/registeredTranscoders", registeredTranscodersHandler(s.LivepeerNode.TranscoderManager))
+	mux.Handle("/drainTranscoder", mustHaveFormParams(drainTranscoderHandler(s.LivepeerNode.TranscoderManager), "address"))
+	mux.Handle("/transcoderTokens", transcoderTokensHandler(s.LivepeerNode.TranscoderTokens))
+	mux.Handle("/issueTranscoderToken", mustHaveFormParams(issueTranscoderTokenHandler(s.LivepeerNode.TranscoderTokens), "name"))
+	mux.Handle("/revokeTranscoderToken", mustHaveFormParams(revokeTranscoderTokenHandler(s.LivepeerNode.TranscoderTokens, s.LivepeerNode.TranscoderManager), "name"))
+
+	// Streams
+
+	mux.Handle("/streams", streamsHandler(s))
+	mux.Handle("/streams/", streamsHandler(s))
+
 	// Metrics
 	if monitor.Enabled {
 		mux.Handle("/metrics", monitor.Exporter)
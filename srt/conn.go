@@ -0,0 +1,372 @@
+package srt
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	ackInterval       = 10 * time.Millisecond
+	nakInterval       = 50 * time.Millisecond
+	keepaliveInterval = time.Second
+	// Packets buffered for the reader before newer ones are dropped
+	recvQueueLen = 8192
+	// Loss reports are capped to fit a single packet
+	maxLossEntries = 256
+
+	defaultRTT = 100 * time.Millisecond
+)
+
+// Conn is a connection from an SRT caller. Reads return the stream in
+// order; packets lost for longer than the latency are skipped.
+type Conn struct {
+	l          *Listener
+	addr       *net.UDPAddr
+	socketID   uint32
+	peerID     uint32
+	streamID   string
+	crypto     *cryptoCtx
+	latency    time.Duration
+	start      time.Time
+	conclusion []byte
+
+	mu sync.Mutex
+	// Next sequence number to hand to the reader
+	next uint32
+	// Highest sequence number received, plus one
+	highest uint32
+	// Packets received ahead of a gap
+	ahead map[uint32][]byte
+	// When the gap at `next` was first noticed
+	lossSince time.Time
+	lastAcked uint32
+	ackNo     uint32
+	ackTimes  map[uint32]time.Time
+	rtt       time.Duration
+	lastRecv  time.Time
+	dropped   int
+
+	data      chan []byte
+	pending   []byte
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newConn(l *Listener, addr *net.UDPAddr, socketID, peerID, isn uint32, streamID string, crypto *cryptoCtx, latency time.Duration) *Conn {
+	now := time.Now()
+	return &Conn{
+		l:         l,
+		addr:      addr,
+		socketID:  socketID,
+		peerID:    peerID,
+		streamID:  streamID,
+		crypto:    crypto,
+		latency:   latency,
+		start:     now,
+		next:      isn,
+		highest:   isn,
+		lastAcked: isn,
+		ahead:     make(map[uint32][]byte),
+		ackTimes:  make(map[uint32]time.Time),
+		rtt:       defaultRTT,
+		lastRecv:  now,
+		data:      make(chan []byte, recvQueueLen),
+		closed:    make(chan struct{}),
+	}
+}
+
+// StreamID returns the stream ID the caller connected with, if any
+func (c *Conn) StreamID() string {
+	return c.streamID
+}
+
+// RemoteAddr returns the address of the caller
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.addr
+}
+
+// Read reads the stream. It returns io.EOF once the caller disconnects and
+// everything received has been read.
+func (c *Conn) Read(b []byte) (int, error) {
+	if len(c.pending) == 0 {
+		select {
+		case c.pending = <-c.data:
+		default:
+			select {
+			case c.pending = <-c.data:
+			case <-c.closed:
+				select {
+				case c.pending = <-c.data:
+				default:
+					return 0, io.EOF
+				}
+			}
+		}
+	}
+	n := copy(b, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// Close disconnects the caller
+func (c *Conn) Close() error {
+	c.close(true)
+	return nil
+}
+
+func (c *Conn) close(notify bool) {
+	c.closeOnce.Do(func() {
+		c.l.remove(c)
+		if notify {
+			c.sendControl(ctrlShutdown, 0, 0, make([]byte, 4))
+		}
+		close(c.closed)
+		c.mu.Lock()
+		dropped := c.dropped
+		c.mu.Unlock()
+		glog.V(5).Infof("Closed SRT connection addr=%s streamID=%q dropped=%d", c.addr, c.streamID, dropped)
+	})
+}
+
+// handle processes a packet from the caller
+func (c *Conn) handle(p *packet) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastRecv = time.Now()
+
+	if !p.control {
+		c.handleData(p)
+		return
+	}
+	switch p.ctrlType {
+	case ctrlShutdown:
+		go c.close(false)
+	case ctrlAckAck:
+		if sent, ok := c.ackTimes[p.info]; ok {
+			// Smoothed as in TCP
+			c.rtt = (7*c.rtt + time.Since(sent)) / 8
+			delete(c.ackTimes, p.info)
+		}
+	case ctrlDropReq:
+		// The caller gave up on sending these packets
+		if len(p.payload) < 8 {
+			return
+		}
+		first := binary.BigEndian.Uint32(p.payload[0:4]) & maxSeq
+		last := binary.BigEndian.Uint32(p.payload[4:8]) & maxSeq
+		if seqDiff(first, c.next) <= 0 && seqDiff(last, c.next) >= 0 {
+			for seq := range c.ahead {
+				if seqDiff(seq, last) <= 0 {
+					delete(c.ahead, seq)
+				}
+			}
+			c.next = seqAdd(last, 1)
+			if seqDiff(c.next, c.highest) > 0 {
+				c.highest = c.next
+			}
+			c.drain()
+		}
+	case ctrlUser:
+		// Refreshed keys
+		if p.subtype != extKMReq || c.crypto == nil {
+			return
+		}
+		if err := c.crypto.update(p.payload); err != nil {
+			glog.Errorf("Error updating SRT keys addr=%s streamID=%q err=%v", c.addr, c.streamID, err)
+			return
+		}
+		c.sendControl(ctrlUser, extKMRsp, 0, p.payload)
+	}
+}
+
+func (c *Conn) handleData(p *packet) {
+	if c.crypto != nil {
+		if err := c.crypto.decrypt(p); err != nil {
+			glog.V(5).Infof("Error decrypting SRT packet addr=%s seq=%d err=%v", c.addr, p.seq, err)
+			return
+		}
+	}
+	d := seqDiff(p.seq, c.next)
+	if d < 0 {
+		// Already delivered or skipped
+		return
+	}
+	if d > defaultFlowWindow {
+		// Further ahead than the caller could have sent; it must have
+		// skipped packets, so pick up from here
+		c.ahead = make(map[uint32][]byte)
+		c.next, c.highest, d = p.seq, p.seq, 0
+	}
+	if _, ok := c.ahead[p.seq]; ok {
+		return
+	}
+	if gap := seqDiff(p.seq, c.highest); gap > 0 {
+		// Report the packets skipped over right away
+		c.sendLoss([][2]uint32{{c.highest, seqAdd(p.seq, -1)}})
+	}
+	if seqDiff(p.seq, c.highest) >= 0 {
+		c.highest = seqAdd(p.seq, 1)
+	}
+	if d > 0 {
+		if c.lossSince.IsZero() {
+			c.lossSince = time.Now()
+		}
+		c.ahead[p.seq] = p.payload
+		return
+	}
+	c.deliver(p.payload)
+	c.drain()
+}
+
+// drain delivers packets that were waiting on the gap at `next`
+func (c *Conn) drain() {
+	for {
+		payload, ok := c.ahead[c.next]
+		if !ok {
+			break
+		}
+		delete(c.ahead, c.next)
+		c.deliver(payload)
+	}
+	c.lossSince = time.Time{}
+	if len(c.ahead) > 0 {
+		c.lossSince = time.Now()
+	}
+}
+
+func (c *Conn) deliver(payload []byte) {
+	c.next = seqAdd(c.next, 1)
+	select {
+	case c.data <- payload:
+	default:
+		// The reader isn't keeping up
+		c.dropped++
+	}
+}
+
+// run sends acknowledgements, loss reports and keepalives until the
+// connection is closed
+func (c *Conn) run() {
+	ticker := time.NewTicker(ackInterval)
+	defer ticker.Stop()
+	var lastNak, lastKeepalive time.Time
+	for {
+		select {
+		case <-c.closed:
+			return
+		case now := <-ticker.C:
+			c.mu.Lock()
+			if now.Sub(c.lastRecv) > c.l.cfg.PeerIdleTimeout {
+				c.mu.Unlock()
+				glog.Errorf("SRT caller timed out addr=%s streamID=%q", c.addr, c.streamID)
+				c.close(true)
+				return
+			}
+			if !c.lossSince.IsZero() && now.Sub(c.lossSince) > c.latency {
+				c.skipLoss()
+			}
+			if c.next != c.lastAcked {
+				c.sendAck(now)
+			}
+			if len(c.ahead) > 0 && now.Sub(lastNak) > nakInterval {
+				c.sendLoss(c.lossList())
+				lastNak = now
+			}
+			if now.Sub(lastKeepalive) > keepaliveInterval {
+				c.sendControl(ctrlKeepalive, 0, 0, make([]byte, 4))
+				lastKeepalive = now
+			}
+			c.mu.Unlock()
+		}
+	}
+}
+
+// skipLoss gives up on the packets missing at `next`
+func (c *Conn) skipLoss() {
+	var first uint32
+	found := false
+	for seq := range c.ahead {
+		if !found || seqDiff(seq, first) < 0 {
+			first, found = seq, true
+		}
+	}
+	if !found {
+		c.lossSince = time.Time{}
+		return
+	}
+	glog.V(5).Infof("Skipping lost SRT packets addr=%s streamID=%q count=%d", c.addr, c.streamID, seqDiff(first, c.next))
+	c.next = first
+	c.drain()
+}
+
+// lossList returns the ranges of sequence numbers still missing
+func (c *Conn) lossList() [][2]uint32 {
+	var ranges [][2]uint32
+	for seq := c.next; seqDiff(seq, c.highest) < 0 && len(ranges) < maxLossEntries; seq = seqAdd(seq, 1) {
+		if _, ok := c.ahead[seq]; ok {
+			continue
+		}
+		if n := len(ranges); n > 0 && ranges[n-1][1] == seqAdd(seq, -1) {
+			ranges[n-1][1] = seq
+		} else {
+			ranges = append(ranges, [2]uint32{seq, seq})
+		}
+	}
+	return ranges
+}
+
+func (c *Conn) sendLoss(ranges [][2]uint32) {
+	var b []byte
+	for _, r := range ranges {
+		if r[0] == r[1] {
+			b = appendUint32(b, r[0])
+		} else {
+			// Ranges are flagged on the first sequence number
+			b = appendUint32(b, r[0]|0x80000000)
+			b = appendUint32(b, r[1])
+		}
+	}
+	if len(b) > 0 {
+		c.sendControl(ctrlNak, 0, 0, b)
+	}
+}
+
+func (c *Conn) sendAck(now time.Time) {
+	c.ackNo++
+	c.ackTimes[c.ackNo] = now
+	for no, sent := range c.ackTimes {
+		if now.Sub(sent) > c.l.cfg.PeerIdleTimeout {
+			delete(c.ackTimes, no)
+		}
+	}
+	rtt := uint32(c.rtt / time.Microsecond)
+	var b []byte
+	for _, v := range []uint32{c.next, rtt, rtt / 2, uint32(recvQueueLen - len(c.data)), 0, 0, 0} {
+		b = appendUint32(b, v)
+	}
+	c.sendControl(ctrlAck, 0, c.ackNo, b)
+	c.lastAcked = c.next
+}
+
+func (c *Conn) sendControl(typ, subtype uint16, info uint32, payload []byte) {
+	c.l.send(&packet{
+		control:   true,
+		ctrlType:  typ,
+		subtype:   subtype,
+		info:      info,
+		timestamp: uint32(time.Since(c.start) / time.Microsecond),
+		dest:      c.peerID,
+		payload:   payload,
+	}, c.addr)
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	var w [4]byte
+	binary.BigEndian.PutUint32(w[:], v)
+	return append(b, w[:]...)
+}
@@ -0,0 +1,158 @@
+package srt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	kmSign       = 0x2029
+	kmCipherCTR  = 2
+	kmSEStream   = 2
+	kmSaltLen    = 16
+	pbkdf2Iter   = 2048
+	pbkdf2Salt   = 8
+	minPassLen   = 10
+	maxPassLen   = 79
+	keyFlagEven  = 1
+	keyFlagOdd   = 2
+	ivPacketIdx  = 10
+	ivSaltedBits = 14
+)
+
+var (
+	ErrInvalidPassphrase = errors.New("ErrInvalidPassphrase")
+
+	errBadKeyMaterial = errors.New("ErrBadKeyMaterial")
+	errBadSecret      = errors.New("ErrBadSecret")
+	errNoKey          = errors.New("ErrNoKey")
+)
+
+var keyWrapIV = []byte{0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6}
+
+// keyMaterial is the message callers send their stream encryption keys in,
+// wrapped with a key derived from the passphrase
+type keyMaterial struct {
+	keyFlags int
+	salt     []byte
+	keyLen   int
+	wrapped  []byte
+}
+
+func parseKeyMaterial(b []byte) (*keyMaterial, error) {
+	// Version 1, packet type 2 (key material) and the signature
+	if len(b) < 16 || b[0] != 0x12 || binary.BigEndian.Uint16(b[1:3]) != kmSign {
+		return nil, errBadKeyMaterial
+	}
+	km := &keyMaterial{keyFlags: int(b[3] & 0x3)}
+	if b[8] != kmCipherCTR || b[10] != kmSEStream || km.keyFlags == 0 {
+		return nil, errBadKeyMaterial
+	}
+	saltLen, keyLen := 4*int(b[14]), 4*int(b[15])
+	nkeys := 1
+	if km.keyFlags == keyFlagEven|keyFlagOdd {
+		nkeys = 2
+	}
+	if saltLen != kmSaltLen || (keyLen != 16 && keyLen != 24 && keyLen != 32) ||
+		len(b) != 16+saltLen+8+nkeys*keyLen {
+		return nil, errBadKeyMaterial
+	}
+	km.salt = b[16 : 16+saltLen]
+	km.keyLen = keyLen
+	km.wrapped = b[16+saltLen:]
+	return km, nil
+}
+
+// cryptoCtx decrypts the data packets of a connection
+type cryptoCtx struct {
+	passphrase string
+	salt       []byte
+	// Even and odd keys, indexed by key flag
+	keys [3]cipher.Block
+}
+
+func newCryptoCtx(passphrase string) *cryptoCtx {
+	return &cryptoCtx{passphrase: passphrase}
+}
+
+// update takes on the keys in a key material message
+func (c *cryptoCtx) update(b []byte) error {
+	km, err := parseKeyMaterial(b)
+	if err != nil {
+		return err
+	}
+	kek := pbkdf2.Key([]byte(c.passphrase), km.salt[len(km.salt)-pbkdf2Salt:], pbkdf2Iter, km.keyLen, sha1.New)
+	keys, err := unwrapKey(kek, km.wrapped)
+	if err != nil {
+		return err
+	}
+	for _, flag := range []int{keyFlagEven, keyFlagOdd} {
+		if km.keyFlags&flag == 0 {
+			continue
+		}
+		block, err := aes.NewCipher(keys[:km.keyLen])
+		if err != nil {
+			return err
+		}
+		c.keys[flag] = block
+		keys = keys[km.keyLen:]
+	}
+	c.salt = km.salt
+	return nil
+}
+
+// decrypt decrypts the payload of a data packet in place
+func (c *cryptoCtx) decrypt(p *packet) error {
+	flag := p.keyFlag()
+	if flag == 0 {
+		return nil
+	}
+	if flag > keyFlagOdd || c.keys[flag] == nil {
+		return errNoKey
+	}
+	// The counter starts from the packet index, salted
+	iv := make([]byte, aes.BlockSize)
+	binary.BigEndian.PutUint32(iv[ivPacketIdx:], p.seq)
+	for i := 0; i < ivSaltedBits; i++ {
+		iv[i] ^= c.salt[i]
+	}
+	cipher.NewCTR(c.keys[flag], iv).XORKeyStream(p.payload, p.payload)
+	return nil
+}
+
+// unwrapKey unwraps keys per RFC 3394. A mismatched integrity check means
+// the keys were wrapped with a different passphrase.
+func unwrapKey(kek, wrapped []byte) ([]byte, error) {
+	if len(wrapped)%8 != 0 || len(wrapped) < 24 {
+		return nil, errBadKeyMaterial
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	n := len(wrapped)/8 - 1
+	a := make([]byte, 8)
+	copy(a, wrapped[:8])
+	r := make([]byte, 8*n)
+	copy(r, wrapped[8:])
+	buf := make([]byte, aes.BlockSize)
+	for j := 5; j >= 0; j-- {
+		for i := n; i >= 1; i-- {
+			binary.BigEndian.PutUint64(buf, binary.BigEndian.Uint64(a)^uint64(n*j+i))
+			copy(buf[8:], r[(i-1)*8:i*8])
+			block.Decrypt(buf, buf)
+			copy(a, buf[:8])
+			copy(r[(i-1)*8:], buf[8:])
+		}
+	}
+	if !bytes.Equal(a, keyWrapIV) {
+		return nil, errBadSecret
+	}
+	return r, nil
+}
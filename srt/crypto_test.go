@@ -0,0 +1,77 @@
+package srt
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnwrapKey(t *testing.T) {
+	assert := assert.New(t)
+	unhex := func(s string) []byte {
+		b, err := hex.DecodeString(s)
+		require.NoError(t, err)
+		return b
+	}
+
+	// RFC 3394 section 4.1
+	kek := unhex("000102030405060708090A0B0C0D0E0F")
+	wrapped := unhex("1FA68B0A8112B447AEF34BD8FB5A7B829D3E862371D2CFE5")
+	key, err := unwrapKey(kek, wrapped)
+	assert.Nil(err)
+	assert.Equal(unhex("00112233445566778899AABBCCDDEEFF"), key)
+	assert.Equal(wrapped, wrapKey(t, kek, key))
+
+	// Wrong key encryption key
+	kek[0] = 1
+	_, err = unwrapKey(kek, wrapped)
+	assert.Equal(errBadSecret, err)
+
+	_, err = unwrapKey(kek, wrapped[:16])
+	assert.Equal(errBadKeyMaterial, err)
+}
+
+func TestParseKeyMaterial(t *testing.T) {
+	assert := assert.New(t)
+	tc := &testCaller{t: t}
+	b := tc.keyMaterial("correct horse battery")
+
+	km, err := parseKeyMaterial(b)
+	assert.Nil(err)
+	assert.Equal(keyFlagEven, km.keyFlags)
+	assert.Equal(16, km.keyLen)
+	assert.Equal(tc.salt, km.salt)
+	assert.Len(km.wrapped, 24)
+
+	// Both keys announced but only one included
+	b[3] = keyFlagEven | keyFlagOdd
+	_, err = parseKeyMaterial(b)
+	assert.Equal(errBadKeyMaterial, err)
+	b[3] = keyFlagEven
+
+	// Not key material
+	b[1] = 0
+	_, err = parseKeyMaterial(b)
+	assert.Equal(errBadKeyMaterial, err)
+}
+
+func TestCryptoCtx_Decrypt(t *testing.T) {
+	assert := assert.New(t)
+	tc := &testCaller{t: t}
+	c := newCryptoCtx("correct horse battery")
+	assert.Nil(c.update(tc.keyMaterial("correct horse battery")))
+
+	// Unencrypted packets are left as is
+	p := &packet{seq: 5, payload: []byte("plain")}
+	assert.Nil(c.decrypt(p))
+	assert.Equal("plain", string(p.payload))
+
+	// No odd key
+	p = &packet{seq: 5, msgInfo: keyFlagOdd << 27, payload: []byte("plain")}
+	assert.Equal(errNoKey, c.decrypt(p))
+
+	c = newCryptoCtx("staple battery horse")
+	assert.Equal(errBadSecret, c.update(tc.keyMaterial("correct horse battery")))
+}
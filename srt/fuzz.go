@@ -0,0 +1,79 @@
+//go:build gofuzz
+// +build gofuzz
+
+package srt
+
+import (
+	"crypto/aes"
+	"encoding/binary"
+	"net"
+	"sync"
+	"time"
+)
+
+var (
+	fuzzOnce     sync.Once
+	fuzzListener *Listener
+	fuzzCaller   *net.UDPAddr
+)
+
+// Fuzz is the go-fuzz entry point for everything read off the wire from
+// callers. The input is a sequence of datagrams, each prefixed with its
+// 16 bit length, handled as if they came from the caller of an encrypted
+// connection:
+//
+//	go-fuzz-build github.com/livepeer/go-livepeer/srt
+//	go-fuzz -bin srt-fuzz.zip -workdir fuzz/srt
+func Fuzz(data []byte) int {
+	fuzzOnce.Do(func() {
+		var err error
+		if fuzzListener, err = Listen("127.0.0.1:0", Config{}); err != nil {
+			panic(err)
+		}
+		// Responses go to a socket that is never read
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			panic(err)
+		}
+		fuzzCaller = conn.LocalAddr().(*net.UDPAddr)
+	})
+
+	crypto := newCryptoCtx("passphrase")
+	crypto.salt = make([]byte, kmSaltLen)
+	crypto.keys[keyFlagEven], _ = aes.NewCipher(make([]byte, 16))
+	c := newConn(fuzzListener, fuzzCaller, 1, 2, 0, "", crypto, DefaultLatency)
+
+	found := 0
+	for len(data) >= 2 {
+		n := int(binary.BigEndian.Uint16(data))
+		if n > len(data)-2 {
+			n = len(data) - 2
+		}
+		b := data[2 : 2+n]
+		data = data[2+n:]
+
+		p, err := parsePacket(b)
+		if err != nil {
+			continue
+		}
+		found = 1
+		if p.control && p.ctrlType == ctrlHandshake {
+			hs, err := parseHandshake(p.payload)
+			if err != nil {
+				continue
+			}
+			hsReqLatency(hs.hsReq)
+			if hs.km != nil {
+				newCryptoCtx("passphrase").update(hs.km)
+			}
+			continue
+		}
+		c.handle(p)
+		c.mu.Lock()
+		c.sendLoss(c.lossList())
+		c.sendAck(time.Now())
+		c.skipLoss()
+		c.mu.Unlock()
+	}
+	return found
+}
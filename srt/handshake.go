@@ -0,0 +1,187 @@
+package srt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+)
+
+const (
+	hsLen = 48
+
+	hsInduction  = 1
+	hsConclusion = 0xffffffff
+
+	// Extension field of the listener's induction response
+	hsMagic = 0x4a17
+
+	// Extension field flags of a conclusion handshake
+	hsFlagHSReq  = 0x1
+	hsFlagKMReq  = 0x2
+	hsFlagConfig = 0x4
+
+	// Handshake extension and SRT control packet subtypes
+	extHSReq = 1
+	extHSRsp = 2
+	extKMReq = 3
+	extKMRsp = 4
+	extSID   = 5
+
+	// SRT 1.4.1
+	srtVersion = 0x010401
+
+	srtOptTSBPDRcv     = 0x2
+	srtOptCrypt        = 0x4
+	srtOptTLPktDrop    = 0x8
+	srtOptPeriodicNAK  = 0x10
+	srtOptRexmitFlag   = 0x20
+	srtRcvOpts         = srtOptTSBPDRcv | srtOptTLPktDrop | srtOptPeriodicNAK | srtOptRexmitFlag
+	maxStreamIDLen     = 512
+	defaultFlowWindow  = 8192
+	defaultMTU         = 1500
+	rejectReasonOffset = 1000
+)
+
+// Reasons a connection is rejected, sent to the caller as the handshake type
+const (
+	rejectPeer      = 2
+	rejectBacklog   = 5
+	rejectVersion   = 8
+	rejectBadSecret = 10
+	rejectUnsecure  = 11
+)
+
+var errBadHandshake = errors.New("ErrBadHandshake")
+
+type handshake struct {
+	version    uint32
+	encryption uint16
+	extension  uint16
+	isn        uint32
+	mtu        uint32
+	flowWindow uint32
+	hsType     uint32
+	socketID   uint32
+	cookie     uint32
+	peerIP     [16]byte
+
+	// Extensions of a conclusion handshake
+	hsReq    []byte
+	km       []byte
+	streamID string
+}
+
+func parseHandshake(b []byte) (*handshake, error) {
+	if len(b) < hsLen {
+		return nil, errBadHandshake
+	}
+	hs := &handshake{
+		version:    binary.BigEndian.Uint32(b[0:4]),
+		encryption: binary.BigEndian.Uint16(b[4:6]),
+		extension:  binary.BigEndian.Uint16(b[6:8]),
+		isn:        binary.BigEndian.Uint32(b[8:12]),
+		mtu:        binary.BigEndian.Uint32(b[12:16]),
+		flowWindow: binary.BigEndian.Uint32(b[16:20]),
+		hsType:     binary.BigEndian.Uint32(b[20:24]),
+		socketID:   binary.BigEndian.Uint32(b[24:28]),
+		cookie:     binary.BigEndian.Uint32(b[28:32]),
+	}
+	copy(hs.peerIP[:], b[32:48])
+	if hs.version < 5 || hs.hsType != hsConclusion {
+		return hs, nil
+	}
+
+	for ext := b[hsLen:]; len(ext) >= 4; {
+		typ := binary.BigEndian.Uint16(ext[0:2])
+		size := 4 * int(binary.BigEndian.Uint16(ext[2:4]))
+		if len(ext) < 4+size {
+			return nil, errBadHandshake
+		}
+		content := ext[4 : 4+size]
+		switch typ {
+		case extHSReq:
+			hs.hsReq = content
+		case extKMReq:
+			hs.km = content
+		case extSID:
+			if size > maxStreamIDLen {
+				return nil, errBadHandshake
+			}
+			hs.streamID = string(bytes.TrimRight(swapWords(content), "\x00"))
+		}
+		ext = ext[4+size:]
+	}
+	return hs, nil
+}
+
+// marshal serializes the handshake along with the given extensions, which
+// are keyed by extension type and must be padded to a multiple of 4 bytes
+func (hs *handshake) marshal(exts ...extension) []byte {
+	b := make([]byte, hsLen)
+	binary.BigEndian.PutUint32(b[0:4], hs.version)
+	binary.BigEndian.PutUint16(b[4:6], hs.encryption)
+	binary.BigEndian.PutUint16(b[6:8], hs.extension)
+	binary.BigEndian.PutUint32(b[8:12], hs.isn)
+	binary.BigEndian.PutUint32(b[12:16], hs.mtu)
+	binary.BigEndian.PutUint32(b[16:20], hs.flowWindow)
+	binary.BigEndian.PutUint32(b[20:24], hs.hsType)
+	binary.BigEndian.PutUint32(b[24:28], hs.socketID)
+	binary.BigEndian.PutUint32(b[28:32], hs.cookie)
+	copy(b[32:48], hs.peerIP[:])
+	for _, ext := range exts {
+		hdr := make([]byte, 4)
+		binary.BigEndian.PutUint16(hdr[0:2], ext.typ)
+		binary.BigEndian.PutUint16(hdr[2:4], uint16(len(ext.content)/4))
+		b = append(b, hdr...)
+		b = append(b, ext.content...)
+	}
+	return b
+}
+
+type extension struct {
+	typ     uint16
+	content []byte
+}
+
+// hsReqLatency returns the latency the caller asked for in a handshake
+// request extension, in milliseconds
+func hsReqLatency(hsReq []byte) uint16 {
+	if len(hsReq) < 12 {
+		return 0
+	}
+	// Receiver delay in the upper half, sender delay in the lower half
+	return binary.BigEndian.Uint16(hsReq[10:12])
+}
+
+func hsRsp(flags uint32, latency uint16) []byte {
+	b := make([]byte, 12)
+	binary.BigEndian.PutUint32(b[0:4], srtVersion)
+	binary.BigEndian.PutUint32(b[4:8], flags)
+	binary.BigEndian.PutUint16(b[8:10], latency)
+	binary.BigEndian.PutUint16(b[10:12], latency)
+	return b
+}
+
+// swapWords reverses the bytes of every 32 bit word, which is how strings
+// such as the stream ID are laid out in handshake extensions
+func swapWords(b []byte) []byte {
+	out := make([]byte, (len(b)+3)/4*4)
+	copy(out, b)
+	for i := 0; i < len(out); i += 4 {
+		out[i], out[i+1], out[i+2], out[i+3] = out[i+3], out[i+2], out[i+1], out[i]
+	}
+	return out
+}
+
+// ipField encodes an address the way peers expect it in a handshake
+func ipField(ip net.IP) [16]byte {
+	var f [16]byte
+	if ip4 := ip.To4(); ip4 != nil {
+		copy(f[:4], ip4)
+	} else {
+		copy(f[:], ip.To16())
+	}
+	copy(f[:], swapWords(f[:]))
+	return f
+}
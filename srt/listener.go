@@ -0,0 +1,313 @@
+// Package srt implements the receiving side of SRT (Secure Reliable
+// Transport) in live mode, enough for encoders to push a stream to a
+// listener. Callers are identified by the stream ID they connect with, and
+// may be required to encrypt their stream with a passphrase.
+package srt
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	DefaultLatency         = 120 * time.Millisecond
+	DefaultPeerIdleTimeout = 5 * time.Second
+
+	acceptBacklog = 16
+	// Cookies are valid for the window they are issued in and the next one
+	cookieWindow = time.Minute
+)
+
+var ErrListenerClosed = errors.New("ErrListenerClosed")
+
+// Config holds the options of a listener
+type Config struct {
+	// Passphrase callers must encrypt their stream with. If empty, callers
+	// must not encrypt their stream.
+	Passphrase string
+	// Latency is how long lost packets are waited on before being skipped.
+	// Callers may ask for more.
+	Latency time.Duration
+	// PeerIdleTimeout is how long a connection is kept open after the
+	// caller stops sending anything
+	PeerIdleTimeout time.Duration
+}
+
+// Listener accepts SRT connections on a UDP socket
+type Listener struct {
+	cfg    Config
+	conn   *net.UDPConn
+	secret []byte
+
+	mu sync.Mutex
+	// Connections by the socket ID assigned to them
+	conns map[uint32]*Conn
+	// Connections by remote address and caller socket ID
+	peers map[string]*Conn
+
+	accept    chan *Conn
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// Listen listens for SRT callers on the given UDP address
+func Listen(addr string, cfg Config) (*Listener, error) {
+	if cfg.Passphrase != "" && (len(cfg.Passphrase) < minPassLen || len(cfg.Passphrase) > maxPassLen) {
+		return nil, ErrInvalidPassphrase
+	}
+	if cfg.Latency <= 0 {
+		cfg.Latency = DefaultLatency
+	}
+	if cfg.PeerIdleTimeout <= 0 {
+		cfg.PeerIdleTimeout = DefaultPeerIdleTimeout
+	}
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return nil, err
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	l := &Listener{
+		cfg:    cfg,
+		conn:   conn,
+		secret: secret,
+		conns:  make(map[uint32]*Conn),
+		peers:  make(map[string]*Conn),
+		accept: make(chan *Conn, acceptBacklog),
+		closed: make(chan struct{}),
+	}
+	go l.serve()
+	return l, nil
+}
+
+// Accept waits for the next caller to connect
+func (l *Listener) Accept() (*Conn, error) {
+	select {
+	case c := <-l.accept:
+		return c, nil
+	case <-l.closed:
+		return nil, ErrListenerClosed
+	}
+}
+
+// Addr returns the address the listener is bound to
+func (l *Listener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
+
+// Close stops listening and closes every connection
+func (l *Listener) Close() error {
+	var err error
+	l.closeOnce.Do(func() {
+		close(l.closed)
+		l.mu.Lock()
+		var conns []*Conn
+		for _, c := range l.conns {
+			conns = append(conns, c)
+		}
+		l.mu.Unlock()
+		for _, c := range conns {
+			c.Close()
+		}
+		err = l.conn.Close()
+	})
+	return err
+}
+
+func (l *Listener) serve() {
+	buf := make([]byte, maxPacketLen)
+	for {
+		n, addr, err := l.conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-l.closed:
+				return
+			default:
+			}
+			glog.Errorf("Error reading SRT packet err=%v", err)
+			continue
+		}
+		b := make([]byte, n)
+		copy(b, buf[:n])
+		p, err := parsePacket(b)
+		if err != nil {
+			continue
+		}
+		if p.control && p.ctrlType == ctrlHandshake && p.dest == 0 {
+			l.handleHandshake(p, addr)
+			continue
+		}
+		l.mu.Lock()
+		c, ok := l.conns[p.dest]
+		l.mu.Unlock()
+		if ok && c.addr.String() == addr.String() {
+			c.handle(p)
+		}
+	}
+}
+
+func (l *Listener) handleHandshake(p *packet, addr *net.UDPAddr) {
+	hs, err := parseHandshake(p.payload)
+	if err != nil {
+		glog.V(5).Infof("Invalid SRT handshake addr=%s err=%v", addr, err)
+		return
+	}
+	now := time.Now()
+	resp := &handshake{
+		version:    5,
+		isn:        hs.isn,
+		mtu:        defaultMTU,
+		flowWindow: defaultFlowWindow,
+		hsType:     hs.hsType,
+		peerIP:     ipField(addr.IP),
+	}
+	if hs.mtu > 0 && hs.mtu < resp.mtu {
+		resp.mtu = hs.mtu
+	}
+	if hs.flowWindow > 0 && hs.flowWindow < resp.flowWindow {
+		resp.flowWindow = hs.flowWindow
+	}
+
+	switch hs.hsType {
+	case hsInduction:
+		resp.extension = hsMagic
+		resp.cookie = l.cookie(addr, now)
+		l.sendHandshake(resp, hs.socketID, addr)
+		return
+	case hsConclusion:
+	default:
+		return
+	}
+
+	if hs.cookie != l.cookie(addr, now) && hs.cookie != l.cookie(addr, now.Add(-cookieWindow)) {
+		glog.V(5).Infof("Invalid SRT handshake cookie addr=%s", addr)
+		return
+	}
+
+	// Retransmitted conclusion for a connection that was already set up
+	peer := fmt.Sprintf("%s/%d", addr, hs.socketID)
+	l.mu.Lock()
+	c, ok := l.peers[peer]
+	l.mu.Unlock()
+	if ok {
+		l.send(&packet{control: true, ctrlType: ctrlHandshake, dest: hs.socketID, payload: c.conclusion}, addr)
+		return
+	}
+
+	reject := func(reason uint32) {
+		glog.Errorf("Rejecting SRT caller addr=%s streamID=%q reason=%d", addr, hs.streamID, reason)
+		resp.hsType = rejectReasonOffset + reason
+		l.sendHandshake(resp, hs.socketID, addr)
+	}
+	if hs.version < 5 || hs.hsReq == nil {
+		reject(rejectVersion)
+		return
+	}
+
+	var crypto *cryptoCtx
+	switch {
+	case l.cfg.Passphrase == "" && hs.km != nil, l.cfg.Passphrase != "" && hs.km == nil:
+		reject(rejectUnsecure)
+		return
+	case hs.km != nil:
+		crypto = newCryptoCtx(l.cfg.Passphrase)
+		if err := crypto.update(hs.km); err == errBadSecret {
+			reject(rejectBadSecret)
+			return
+		} else if err != nil {
+			reject(rejectPeer)
+			return
+		}
+	}
+
+	latency := l.cfg.Latency
+	if peerLatency := time.Duration(hsReqLatency(hs.hsReq)) * time.Millisecond; peerLatency > latency {
+		latency = peerLatency
+	}
+	flags := uint32(srtRcvOpts)
+	resp.extension = hsFlagHSReq
+	exts := []extension{{extHSRsp, nil}}
+	if crypto != nil {
+		flags |= srtOptCrypt
+		resp.extension |= hsFlagKMReq
+		exts = append(exts, extension{extKMRsp, hs.km})
+	}
+	exts[0].content = hsRsp(flags, uint16(latency/time.Millisecond))
+
+	l.mu.Lock()
+	select {
+	case <-l.closed:
+		l.mu.Unlock()
+		return
+	default:
+	}
+	if len(l.accept) == cap(l.accept) {
+		l.mu.Unlock()
+		reject(rejectBacklog)
+		return
+	}
+	resp.socketID = l.newSocketID()
+	c = newConn(l, addr, resp.socketID, hs.socketID, hs.isn, hs.streamID, crypto, latency)
+	c.conclusion = resp.marshal(exts...)
+	l.conns[c.socketID] = c
+	l.peers[peer] = c
+	l.mu.Unlock()
+
+	l.send(&packet{control: true, ctrlType: ctrlHandshake, dest: hs.socketID, payload: c.conclusion}, addr)
+	glog.V(5).Infof("Accepted SRT caller addr=%s streamID=%q encrypted=%v latency=%v", addr, hs.streamID, crypto != nil, latency)
+	go c.run()
+	l.accept <- c
+}
+
+func (l *Listener) sendHandshake(hs *handshake, dest uint32, addr *net.UDPAddr) {
+	l.send(&packet{control: true, ctrlType: ctrlHandshake, dest: dest, payload: hs.marshal()}, addr)
+}
+
+func (l *Listener) send(p *packet, addr *net.UDPAddr) {
+	if _, err := l.conn.WriteToUDP(p.marshal(), addr); err != nil {
+		glog.V(5).Infof("Error sending SRT packet addr=%s err=%v", addr, err)
+	}
+}
+
+func (l *Listener) remove(c *Conn) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.conns, c.socketID)
+	delete(l.peers, fmt.Sprintf("%s/%d", c.addr, c.peerID))
+}
+
+// cookie is the SYN cookie the caller must echo back to conclude the
+// handshake, so callers can't spoof their address
+func (l *Listener) cookie(addr *net.UDPAddr, t time.Time) uint32 {
+	mac := hmac.New(sha256.New, l.secret)
+	fmt.Fprintf(mac, "%s/%d", addr, t.Unix()/int64(cookieWindow/time.Second))
+	return binary.BigEndian.Uint32(mac.Sum(nil))
+}
+
+// newSocketID returns an unused socket ID. Must be called with the lock held.
+func (l *Listener) newSocketID() uint32 {
+	b := make([]byte, 4)
+	for {
+		rand.Read(b)
+		id := binary.BigEndian.Uint32(b) & maxSeq
+		if _, ok := l.conns[id]; !ok && id != 0 {
+			return id
+		}
+	}
+}
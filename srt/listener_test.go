@@ -0,0 +1,440 @@
+package srt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	mrand "math/rand"
+	"net"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// testCaller is a bare bones SRT caller that sends whatever packets it is
+// told to
+type testCaller struct {
+	t        *testing.T
+	conn     *net.UDPConn
+	socketID uint32
+	peerID   uint32
+	isn      uint32
+	salt     []byte
+	key      cipher.Block
+}
+
+func newTestCaller(t *testing.T, addr net.Addr) *testCaller {
+	conn, err := net.DialUDP("udp", nil, addr.(*net.UDPAddr))
+	require.NoError(t, err)
+	return &testCaller{t: t, conn: conn, socketID: 1234, isn: 1000}
+}
+
+// connect performs the handshake, returning the handshake type of the
+// listener's conclusion response, which is a rejection reason on failure
+func (tc *testCaller) connect(streamID, passphrase string) uint32 {
+	require := require.New(tc.t)
+
+	induction := &handshake{version: 4, extension: 2, isn: tc.isn, mtu: 1500, flowWindow: 8192, hsType: hsInduction, socketID: tc.socketID}
+	tc.send(&packet{control: true, ctrlType: ctrlHandshake, payload: induction.marshal()})
+	resp := tc.readHandshake()
+	require.Equal(uint32(5), resp.version)
+	require.Equal(uint16(hsMagic), resp.extension)
+	require.Equal(uint32(hsInduction), resp.hsType)
+
+	hsReq := make([]byte, 12)
+	binary.BigEndian.PutUint32(hsReq[0:4], srtVersion)
+	binary.BigEndian.PutUint32(hsReq[4:8], 0xbf)
+	binary.BigEndian.PutUint32(hsReq[8:12], 200<<16|200)
+	exts := []extension{{extHSReq, hsReq}}
+	conclusion := &handshake{version: 5, extension: hsFlagHSReq, isn: tc.isn, mtu: 1500, flowWindow: 8192, hsType: hsConclusion, socketID: tc.socketID, cookie: resp.cookie}
+	if passphrase != "" {
+		conclusion.extension |= hsFlagKMReq
+		exts = append(exts, extension{extKMReq, tc.keyMaterial(passphrase)})
+	}
+	if streamID != "" {
+		conclusion.extension |= hsFlagConfig
+		exts = append(exts, extension{extSID, swapWords([]byte(streamID))})
+	}
+	tc.send(&packet{control: true, ctrlType: ctrlHandshake, payload: conclusion.marshal(exts...)})
+	resp = tc.readHandshake()
+	tc.peerID = resp.socketID
+	return resp.hsType
+}
+
+// keyMaterial generates a stream key and wraps it with the passphrase
+func (tc *testCaller) keyMaterial(passphrase string) []byte {
+	tc.salt = make([]byte, kmSaltLen)
+	rand.Read(tc.salt)
+	key := make([]byte, 16)
+	rand.Read(key)
+	var err error
+	tc.key, err = aes.NewCipher(key)
+	require.NoError(tc.t, err)
+	kek := pbkdf2.Key([]byte(passphrase), tc.salt[8:], pbkdf2Iter, 16, sha1.New)
+
+	km := []byte{0x12, 0x20, 0x29, keyFlagEven, 0, 0, 0, 0, kmCipherCTR, 0, kmSEStream, 0, 0, 0, kmSaltLen / 4, 16 / 4}
+	km = append(km, tc.salt...)
+	return append(km, wrapKey(tc.t, kek, key)...)
+}
+
+func (tc *testCaller) sendData(seq uint32, payload []byte) {
+	p := &packet{seq: seq, msgInfo: 0xc0000000, dest: tc.peerID, payload: append([]byte{}, payload...)}
+	if tc.key != nil {
+		p.msgInfo |= keyFlagEven << 27
+		iv := make([]byte, aes.BlockSize)
+		binary.BigEndian.PutUint32(iv[ivPacketIdx:], seq)
+		for i := 0; i < ivSaltedBits; i++ {
+			iv[i] ^= tc.salt[i]
+		}
+		cipher.NewCTR(tc.key, iv).XORKeyStream(p.payload, p.payload)
+	}
+	tc.send(p)
+}
+
+func (tc *testCaller) send(p *packet) {
+	_, err := tc.conn.Write(p.marshal())
+	require.NoError(tc.t, err)
+}
+
+// readControl returns the next control packet of the given type
+func (tc *testCaller) readControl(typ uint16) *packet {
+	buf := make([]byte, maxPacketLen)
+	for {
+		tc.conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := tc.conn.Read(buf)
+		require.NoError(tc.t, err)
+		p, err := parsePacket(append([]byte{}, buf[:n]...))
+		require.NoError(tc.t, err)
+		if p.control && p.ctrlType == typ {
+			require.Equal(tc.t, tc.socketID, p.dest)
+			return p
+		}
+	}
+}
+
+func (tc *testCaller) readHandshake() *handshake {
+	hs, err := parseHandshake(tc.readControl(ctrlHandshake).payload)
+	require.NoError(tc.t, err)
+	return hs
+}
+
+func wrapKey(t *testing.T, kek, key []byte) []byte {
+	block, err := aes.NewCipher(kek)
+	require.NoError(t, err)
+	n := len(key) / 8
+	a := append([]byte{}, keyWrapIV...)
+	r := append([]byte{}, key...)
+	buf := make([]byte, aes.BlockSize)
+	for j := 0; j <= 5; j++ {
+		for i := 1; i <= n; i++ {
+			copy(buf, a)
+			copy(buf[8:], r[(i-1)*8:i*8])
+			block.Encrypt(buf, buf)
+			binary.BigEndian.PutUint64(a, binary.BigEndian.Uint64(buf[:8])^uint64(n*j+i))
+			copy(r[(i-1)*8:], buf[8:])
+		}
+	}
+	return append(a, r...)
+}
+
+func listen(t *testing.T, cfg Config) *Listener {
+	l, err := Listen("127.0.0.1:0", cfg)
+	require.NoError(t, err)
+	return l
+}
+
+func accept(t *testing.T, l *Listener) *Conn {
+	cc := make(chan *Conn, 1)
+	go func() {
+		c, err := l.Accept()
+		if err == nil {
+			cc <- c
+		}
+	}()
+	select {
+	case c := <-cc:
+		return c
+	case <-time.After(time.Second):
+		require.Fail(t, "Timed out accepting connection")
+	}
+	return nil
+}
+
+func readAll(t *testing.T, c *Conn, n int) []byte {
+	var data []byte
+	buf := make([]byte, 4)
+	for len(data) < n {
+		read, err := c.Read(buf)
+		require.NoError(t, err)
+		data = append(data, buf[:read]...)
+	}
+	return data
+}
+
+func TestListener_StreamID(t *testing.T) {
+	assert := assert.New(t)
+	l := listen(t, Config{})
+	defer l.Close()
+
+	tc := newTestCaller(t, l.Addr())
+	assert.Equal(uint32(hsConclusion), tc.connect("#!::r=live/abc,m=publish", ""))
+	c := accept(t, l)
+	assert.Equal("#!::r=live/abc,m=publish", c.StreamID())
+	assert.Equal(tc.conn.LocalAddr().String(), c.RemoteAddr().String())
+
+	tc.sendData(1000, []byte("hello "))
+	tc.sendData(1001, []byte("world"))
+	assert.Equal("hello world", string(readAll(t, c, 11)))
+
+	// Acknowledged up to the next expected packet
+	ack := tc.readControl(ctrlAck)
+	assert.Equal(uint32(1002), binary.BigEndian.Uint32(ack.payload[0:4]))
+
+	// Data received before the caller disconnects is still read
+	tc.sendData(1002, []byte("bye"))
+	time.Sleep(20 * time.Millisecond)
+	tc.send(&packet{control: true, ctrlType: ctrlShutdown, dest: tc.peerID, payload: make([]byte, 4)})
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal("bye", string(readAll(t, c, 3)))
+	_, err := c.Read(make([]byte, 4))
+	assert.Equal(io.EOF, err)
+}
+
+func TestListener_Passphrase(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := Listen("127.0.0.1:0", Config{Passphrase: "tooshort"})
+	assert.Equal(ErrInvalidPassphrase, err)
+
+	l := listen(t, Config{Passphrase: "correct horse battery"})
+	defer l.Close()
+
+	// Wrong passphrase
+	tc := newTestCaller(t, l.Addr())
+	assert.Equal(uint32(rejectReasonOffset+rejectBadSecret), tc.connect("abc", "staple battery horse"))
+
+	// Unencrypted
+	tc = newTestCaller(t, l.Addr())
+	assert.Equal(uint32(rejectReasonOffset+rejectUnsecure), tc.connect("abc", ""))
+
+	// Correct passphrase; the stream is decrypted
+	tc = newTestCaller(t, l.Addr())
+	assert.Equal(uint32(hsConclusion), tc.connect("abc", "correct horse battery"))
+	c := accept(t, l)
+	assert.Equal("abc", c.StreamID())
+	tc.sendData(1000, []byte("secret"))
+	assert.Equal("secret", string(readAll(t, c, 6)))
+
+	// Rejected callers were never handed out
+	select {
+	case <-l.accept:
+		assert.Fail("Unexpected connection")
+	default:
+	}
+
+	// Encrypting without a passphrase on the listener
+	l2 := listen(t, Config{})
+	defer l2.Close()
+	tc = newTestCaller(t, l2.Addr())
+	assert.Equal(uint32(rejectReasonOffset+rejectUnsecure), tc.connect("abc", "correct horse battery"))
+}
+
+func TestListener_BadCookie(t *testing.T) {
+	l := listen(t, Config{})
+	defer l.Close()
+
+	tc := newTestCaller(t, l.Addr())
+	hsReq := hsRsp(0, 0)
+	conclusion := &handshake{version: 5, extension: hsFlagHSReq, isn: tc.isn, hsType: hsConclusion, socketID: tc.socketID, cookie: 42}
+	tc.send(&packet{control: true, ctrlType: ctrlHandshake, payload: conclusion.marshal(extension{extHSReq, hsReq})})
+
+	time.Sleep(50 * time.Millisecond)
+	l.mu.Lock()
+	assert.Len(t, l.conns, 0)
+	l.mu.Unlock()
+}
+
+func TestConn_Loss(t *testing.T) {
+	assert := assert.New(t)
+	l := listen(t, Config{Latency: 100 * time.Millisecond})
+	defer l.Close()
+
+	tc := newTestCaller(t, l.Addr())
+	tc.connect("", "")
+	c := accept(t, l)
+
+	// Lost packets are reported, and the stream is held back until they
+	// are retransmitted
+	tc.sendData(1000, []byte("a"))
+	tc.sendData(1003, []byte("d"))
+	nak := tc.readControl(ctrlNak)
+	assert.Equal(uint32(1001|0x80000000), binary.BigEndian.Uint32(nak.payload[0:4]))
+	assert.Equal(uint32(1002), binary.BigEndian.Uint32(nak.payload[4:8]))
+	tc.sendData(1002, []byte("c"))
+	tc.sendData(1001, []byte("b"))
+	assert.Equal("abcd", string(readAll(t, c, 4)))
+
+	// Packets that aren't retransmitted in time are skipped
+	start := time.Now()
+	tc.sendData(1005, []byte("f"))
+	assert.Equal("f", string(readAll(t, c, 1)))
+	assert.True(time.Since(start) >= 100*time.Millisecond)
+
+	// Late and duplicate packets are dropped
+	tc.sendData(1004, []byte("e"))
+	tc.sendData(1005, []byte("f"))
+	tc.sendData(1006, []byte("g"))
+	assert.Equal("g", string(readAll(t, c, 1)))
+
+	// Packets the caller gave up on are skipped right away
+	tc.sendData(1008, []byte("i"))
+	drop := make([]byte, 8)
+	binary.BigEndian.PutUint32(drop[0:4], 1007)
+	binary.BigEndian.PutUint32(drop[4:8], 1007)
+	tc.send(&packet{control: true, ctrlType: ctrlDropReq, dest: tc.peerID, payload: drop})
+	start = time.Now()
+	assert.Equal("i", string(readAll(t, c, 1)))
+	assert.True(time.Since(start) < 100*time.Millisecond)
+}
+
+func TestConn_IdleTimeout(t *testing.T) {
+	l := listen(t, Config{PeerIdleTimeout: 50 * time.Millisecond})
+	defer l.Close()
+
+	tc := newTestCaller(t, l.Addr())
+	tc.connect("", "")
+	c := accept(t, l)
+
+	_, err := c.Read(make([]byte, 4))
+	assert.Equal(t, io.EOF, err)
+	tc.readControl(ctrlShutdown)
+	l.mu.Lock()
+	assert.Len(t, l.conns, 0)
+	assert.Len(t, l.peers, 0)
+	l.mu.Unlock()
+}
+
+func TestListener_Close(t *testing.T) {
+	l := listen(t, Config{})
+	tc := newTestCaller(t, l.Addr())
+	tc.connect("", "")
+	c := accept(t, l)
+
+	assert.Nil(t, l.Close())
+	_, err := c.Read(make([]byte, 4))
+	assert.Equal(t, io.EOF, err)
+	_, err = l.Accept()
+	assert.Equal(t, ErrListenerClosed, err)
+}
+
+// Malformed packets don't disrupt the listener; see Fuzz for the go-fuzz
+// entry point
+func TestListener_Random(t *testing.T) {
+	l := listen(t, Config{Passphrase: "passphrase1"})
+	defer l.Close()
+	tc := newTestCaller(t, l.Addr())
+	require.Equal(t, uint32(hsConclusion), tc.connect("live/abc", "passphrase1"))
+	accept(t, l)
+
+	// A valid packet of each kind to mutate
+	km := newTestCaller(t, l.Addr()).keyMaterial("passphrase1")
+	hsReq := hsRsp(0xbf, 200)
+	conclusion := &handshake{version: 5, extension: hsFlagHSReq | hsFlagKMReq | hsFlagConfig, isn: 1, hsType: hsConclusion, socketID: 1}
+	induction := &handshake{version: 4, extension: 2, hsType: hsInduction, socketID: 1}
+	seeds := []*packet{
+		{control: true, ctrlType: ctrlHandshake, payload: induction.marshal()},
+		{control: true, ctrlType: ctrlHandshake, payload: conclusion.marshal(
+			extension{extHSReq, hsReq}, extension{extKMReq, km}, extension{extSID, swapWords([]byte("live/abc"))})},
+		{control: true, ctrlType: ctrlUser, subtype: extKMReq, dest: tc.peerID, payload: km},
+		{control: true, ctrlType: ctrlDropReq, dest: tc.peerID, payload: make([]byte, 8)},
+		{control: true, ctrlType: ctrlAckAck, info: 1, dest: tc.peerID},
+		{seq: 1000, msgInfo: 0xc8000000, dest: tc.peerID, payload: make([]byte, 1316)},
+	}
+	r := mrand.New(mrand.NewSource(1))
+	for i := 0; i < 5000; i++ {
+		b := seeds[r.Intn(len(seeds))].marshal()
+		for n := r.Intn(8); n >= 0; n-- {
+			b[r.Intn(len(b))] = byte(r.Intn(256))
+		}
+		if r.Intn(4) == 0 {
+			b = b[:r.Intn(len(b))]
+		}
+		_, err := tc.conn.Write(b)
+		require.NoError(t, err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	// Callers still connect
+	tc = newTestCaller(t, l.Addr())
+	require.Equal(t, uint32(hsConclusion), tc.connect("live/def", "passphrase1"))
+	c := accept(t, l)
+	tc.sendData(1000, []byte("hello"))
+	assert.Equal(t, "hello", string(readAll(t, c, 5)))
+}
+
+// srtSender returns a command that pushes its input to the URL with the
+// reference SRT implementation, and whether the stream is sent unchanged
+func srtSender(t *testing.T, url string) (*exec.Cmd, bool) {
+	if path, err := exec.LookPath("srt-live-transmit"); err == nil {
+		return exec.Command(path, "file://con", url), true
+	}
+	if path, err := exec.LookPath("ffmpeg"); err == nil {
+		out, err := exec.Command(path, "-hide_banner", "-protocols").Output()
+		for _, proto := range strings.Fields(string(out)) {
+			if err == nil && proto == "srt" {
+				return exec.Command(path, "-hide_banner", "-loglevel", "error", "-f", "mpegts", "-i", "pipe:0",
+					"-c", "copy", "-f", "mpegts", url), false
+			}
+		}
+	}
+	t.Skip("Neither srt-live-transmit nor ffmpeg with SRT support found")
+	return nil, false
+}
+
+func TestListener_Interop(t *testing.T) {
+	data, err := ioutil.ReadFile("../core/test.ts")
+	require.NoError(t, err)
+
+	for _, passphrase := range []string{"", "passphrase1"} {
+		l := listen(t, Config{Passphrase: passphrase})
+		url := fmt.Sprintf("srt://%s?streamid=live/abc", l.Addr())
+		if passphrase != "" {
+			url += "&passphrase=" + passphrase
+		}
+		cmd, unchanged := srtSender(t, url)
+		cmd.Stdin = bytes.NewReader(data)
+		require.NoError(t, cmd.Start())
+		c := accept(t, l)
+		assert.Equal(t, "live/abc", c.StreamID())
+
+		received := make(chan []byte)
+		go func() {
+			b, _ := ioutil.ReadAll(c)
+			received <- b
+		}()
+		select {
+		case b := <-received:
+			if unchanged {
+				assert.True(t, bytes.Equal(data, b), passphrase)
+			} else {
+				assert.Zero(t, len(b)%188)
+				assert.True(t, len(b) > len(data)/2)
+			}
+		case <-time.After(10 * time.Second):
+			assert.Fail(t, "Timed out reading stream")
+		}
+		assert.Nil(t, cmd.Wait())
+		l.Close()
+	}
+}
@@ -0,0 +1,98 @@
+package srt
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	headerLen = 16
+	// Largest UDP payload read off the wire; SRT packets fit a 1500 byte MTU
+	maxPacketLen = 1500
+
+	ctrlHandshake = 0x0
+	ctrlKeepalive = 0x1
+	ctrlAck       = 0x2
+	ctrlNak       = 0x3
+	ctrlShutdown  = 0x5
+	ctrlAckAck    = 0x6
+	ctrlDropReq   = 0x7
+	ctrlUser      = 0x7fff
+
+	// Sequence numbers are 31 bits and wrap around
+	maxSeq = 0x7fffffff
+)
+
+var errShortPacket = errors.New("ErrShortPacket")
+
+// packet is a data or control packet. For data packets, the payload is the
+// message data. For control packets, it is the control information field.
+type packet struct {
+	control bool
+
+	// Data packets
+	seq     uint32
+	msgInfo uint32
+
+	// Control packets
+	ctrlType uint16
+	subtype  uint16
+	info     uint32
+
+	timestamp uint32
+	dest      uint32
+	payload   []byte
+}
+
+func parsePacket(b []byte) (*packet, error) {
+	if len(b) < headerLen {
+		return nil, errShortPacket
+	}
+	w0 := binary.BigEndian.Uint32(b[0:4])
+	w1 := binary.BigEndian.Uint32(b[4:8])
+	p := &packet{
+		timestamp: binary.BigEndian.Uint32(b[8:12]),
+		dest:      binary.BigEndian.Uint32(b[12:16]),
+		payload:   b[headerLen:],
+	}
+	if w0&0x80000000 != 0 {
+		p.control = true
+		p.ctrlType = uint16(w0>>16) & 0x7fff
+		p.subtype = uint16(w0)
+		p.info = w1
+	} else {
+		p.seq = w0
+		p.msgInfo = w1
+	}
+	return p, nil
+}
+
+func (p *packet) marshal() []byte {
+	b := make([]byte, headerLen+len(p.payload))
+	if p.control {
+		binary.BigEndian.PutUint32(b[0:4], 0x80000000|uint32(p.ctrlType)<<16|uint32(p.subtype))
+		binary.BigEndian.PutUint32(b[4:8], p.info)
+	} else {
+		binary.BigEndian.PutUint32(b[0:4], p.seq&maxSeq)
+		binary.BigEndian.PutUint32(b[4:8], p.msgInfo)
+	}
+	binary.BigEndian.PutUint32(b[8:12], p.timestamp)
+	binary.BigEndian.PutUint32(b[12:16], p.dest)
+	copy(b[headerLen:], p.payload)
+	return b
+}
+
+// keyFlag returns which key a data packet is encrypted with: 0 if it is not
+// encrypted, 1 for the even key and 2 for the odd key
+func (p *packet) keyFlag() int {
+	return int(p.msgInfo>>27) & 0x3
+}
+
+func seqAdd(seq uint32, n int) uint32 {
+	return uint32(int64(seq)+int64(n)) & maxSeq
+}
+
+// seqDiff returns a - b, accounting for sequence numbers wrapping around
+func seqDiff(a, b uint32) int {
+	return int(int32((a-b)<<1) >> 1)
+}
@@ -0,0 +1,52 @@
+package srt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPacket_Marshal(t *testing.T) {
+	assert := assert.New(t)
+
+	data := &packet{seq: 42, msgInfo: 0xc8000001, timestamp: 7, dest: 9, payload: []byte("data")}
+	p, err := parsePacket(data.marshal())
+	assert.Nil(err)
+	assert.Equal(data, p)
+	assert.Equal(keyFlagEven, p.keyFlag())
+
+	ctrl := &packet{control: true, ctrlType: ctrlUser, subtype: extKMRsp, info: 3, timestamp: 7, dest: 9, payload: []byte{}}
+	p, err = parsePacket(ctrl.marshal())
+	assert.Nil(err)
+	assert.Equal(ctrl, p)
+
+	_, err = parsePacket(make([]byte, headerLen-1))
+	assert.Equal(errShortPacket, err)
+}
+
+func TestSeq(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(uint32(0), seqAdd(maxSeq, 1))
+	assert.Equal(uint32(maxSeq), seqAdd(0, -1))
+	assert.Equal(1, seqDiff(0, maxSeq))
+	assert.Equal(-1, seqDiff(maxSeq, 0))
+	assert.Equal(0, seqDiff(5, 5))
+	assert.Equal(10, seqDiff(15, 5))
+}
+
+func TestHandshake_StreamID(t *testing.T) {
+	assert := assert.New(t)
+	hs := &handshake{version: 5, hsType: hsConclusion}
+	b := hs.marshal(extension{extSID, swapWords([]byte("live/abcde"))})
+
+	// Each word of the stream ID is byte swapped on the wire
+	assert.Equal("evil", string(b[hsLen+4:hsLen+8]))
+
+	parsed, err := parseHandshake(b)
+	assert.Nil(err)
+	assert.Equal("live/abcde", parsed.streamID)
+
+	// Truncated extension
+	_, err = parseHandshake(b[:len(b)-4])
+	assert.Equal(errBadHandshake, err)
+}
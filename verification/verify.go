@@ -1,9 +1,11 @@
 package verification
 
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"net/url"
 	"os"
 	"sort"
@@ -76,11 +78,43 @@ type Policy struct {
 	// Maximum number of retries until the policy chooses a winner
 	Retries int
 
-	// How often to invoke the verifier, on a per-segment basis
-	SampleRate float64 // XXX for later
+	// Fraction of segments to invoke the verifier on, between 0 and 1.
+	// Unset verifies every segment; zero verifies none.
+	SampleRate *float64
 
-	// How many parallel transcodes to support
-	Redundancy int // XXX for later
+	// How many orchestrators to send each segment to in parallel
+	Redundancy int
+}
+
+// ShouldVerify reports whether the segment is sampled for verification.
+// The sample is seeded with the segment data, so the decision is the same
+// for every result of a segment. Segments streamed into storage without
+// keeping their data are seeded with their URI instead.
+func (p *Policy) ShouldVerify(source *stream.HLSSegment) bool {
+	if p == nil {
+		return false
+	}
+	if p.SampleRate == nil || *p.SampleRate >= 1 {
+		return true
+	}
+	if *p.SampleRate <= 0 {
+		return false
+	}
+	if source == nil {
+		return true
+	}
+	seed := source.Data
+	if len(seed) == 0 {
+		seed = []byte(source.Name)
+	}
+	hash := crypto.Keccak256(seed)
+	sample := float64(binary.BigEndian.Uint64(hash[:8])) / math.MaxUint64
+	return sample < *p.SampleRate
+}
+
+// SampleRate returns a sample rate for a Policy
+func SampleRate(rate float64) *float64 {
+	return &rate
 }
 
 type SegmentVerifierResults struct {
@@ -107,6 +141,20 @@ func NewSegmentVerifier(p *Policy) *SegmentVerifier {
 	return &SegmentVerifier{policy: p, verifySig: lpcrypto.VerifySig}
 }
 
+// Redundancy returns how many orchestrators each segment should be sent to
+func (sv *SegmentVerifier) Redundancy() int {
+	if sv == nil || sv.policy == nil || sv.policy.Redundancy < 1 {
+		return 1
+	}
+	return sv.policy.Redundancy
+}
+
+// ShouldVerify reports whether results for the segment are checked by the
+// verifier, or only have their signatures checked
+func (sv *SegmentVerifier) ShouldVerify(source *stream.HLSSegment) bool {
+	return sv != nil && sv.policy.ShouldVerify(source)
+}
+
 func (sv *SegmentVerifier) Verify(params *Params) (*Params, error) {
 	if sv.policy == nil {
 		return nil, nil
@@ -116,11 +164,14 @@ func (sv *SegmentVerifier) Verify(params *Params) (*Params, error) {
 		return nil, err
 	}
 
+	// Skip the verifier and pixel checks for segments not sampled
+	if !sv.policy.ShouldVerify(params.Source) {
+		return params, nil
+	}
+
 	var err error
 	res := &Results{}
 
-	// TODO Use policy sampling rate to determine whether to invoke verifier.
-	//      If not, exit early. Seed sample using source data for repeatability!
 	if sv.policy.Verifier != nil {
 		res, err = sv.policy.Verifier.Verify(params)
 	}
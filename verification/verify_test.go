@@ -2,6 +2,7 @@ package verification
 
 import (
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"testing"
 
@@ -13,6 +14,7 @@ import (
 	"github.com/livepeer/go-livepeer/drivers"
 	"github.com/livepeer/go-livepeer/net"
 	"github.com/livepeer/lpms/ffmpeg"
+	"github.com/livepeer/lpms/stream"
 )
 
 type stubVerifier struct {
@@ -237,6 +239,73 @@ func TestVerify(t *testing.T) {
 	assert.Nil(res)
 }
 
+func TestPolicy_Sampling(t *testing.T) {
+	assert := assert.New(t)
+
+	var policy *Policy
+	assert.False(policy.ShouldVerify(&stream.HLSSegment{}))
+
+	// Every segment is verified by default
+	policy = &Policy{}
+	assert.True(policy.ShouldVerify(&stream.HLSSegment{Data: []byte("abc")}))
+	assert.True(policy.ShouldVerify(nil))
+	policy.SampleRate = SampleRate(1.5)
+	assert.True(policy.ShouldVerify(&stream.HLSSegment{Data: []byte("abc")}))
+
+	// No segment is verified with a zero rate
+	policy.SampleRate = SampleRate(0)
+	assert.False(policy.ShouldVerify(&stream.HLSSegment{Data: []byte("abc")}))
+	assert.False(policy.ShouldVerify(nil))
+
+	// Roughly the requested fraction is sampled, consistently per segment
+	policy.SampleRate = SampleRate(0.25)
+	sampled := 0
+	for i := 0; i < 1000; i++ {
+		seg := &stream.HLSSegment{Data: []byte(fmt.Sprintf("segment%d", i))}
+		if policy.ShouldVerify(seg) {
+			sampled++
+			assert.True(policy.ShouldVerify(seg))
+		}
+	}
+	assert.InDelta(250, sampled, 50)
+
+	// Segments without data are sampled by their URI
+	sampled = 0
+	for i := 0; i < 1000; i++ {
+		seg := &stream.HLSSegment{Name: fmt.Sprintf("https://bucket/source/%d.ts", i)}
+		if policy.ShouldVerify(seg) {
+			sampled++
+			assert.True(policy.ShouldVerify(seg))
+		}
+	}
+	assert.InDelta(250, sampled, 50)
+
+	// Verifier and pixel checks are skipped for segments not sampled
+	verifier := &stubVerifier{err: errors.New("Stub Verifier Error")}
+	sv := NewSegmentVerifier(&Policy{Verifier: verifier, SampleRate: SampleRate(0.25)})
+	for i := 0; ; i++ {
+		seg := &stream.HLSSegment{Data: []byte(fmt.Sprintf("segment%d", i))}
+		if sv.ShouldVerify(seg) {
+			continue
+		}
+		params := &Params{Source: seg}
+		res, err := sv.Verify(params)
+		assert.Nil(err)
+		assert.Equal(params, res)
+		break
+	}
+}
+
+func TestPolicy_Redundancy(t *testing.T) {
+	assert := assert.New(t)
+	var sv *SegmentVerifier
+	assert.Equal(1, sv.Redundancy())
+	assert.False(sv.ShouldVerify(&stream.HLSSegment{}))
+	assert.Equal(1, NewSegmentVerifier(nil).Redundancy())
+	assert.Equal(1, NewSegmentVerifier(&Policy{}).Redundancy())
+	assert.Equal(3, NewSegmentVerifier(&Policy{Redundancy: 3}).Redundancy())
+}
+
 func TestPixels(t *testing.T) {
 	ffmpeg.InitFFmpeg()
 